@@ -2,48 +2,146 @@ package app
 
 import (
 	agentService "hostlink/app/service/agent"
+	auditService "hostlink/app/service/audit"
+	"hostlink/app/service/certauthority"
+	enrollmentService "hostlink/app/service/enrollment"
+	"hostlink/app/service/metricrollup"
+	operatorService "hostlink/app/service/operator"
+	webhookService "hostlink/app/service/webhook"
 	"hostlink/domain/agent"
+	"hostlink/domain/audit"
+	"hostlink/domain/credential"
+	"hostlink/domain/enrollment"
+	"hostlink/domain/metrics"
 	"hostlink/domain/nonce"
+	"hostlink/domain/operator"
+	"hostlink/domain/secret"
 	"hostlink/domain/task"
+	"hostlink/domain/webhook"
 	gormRepo "hostlink/internal/repository/gorm"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type Container struct {
-	DB                  *gorm.DB
-	AgentRepository     agent.Repository
-	TaskRepository      task.Repository
-	RegistrationService *agentService.RegistrationService
+	DB                   *gorm.DB
+	AgentRepository      agent.Repository
+	TaskRepository       task.Repository
+	TaskOutputRepository task.OutputRepository
+	MetricsRepository    metrics.Repository
+	CredentialRepository credential.Repository
+	SecretRepository     secret.Repository
+	WebhookRepository    webhook.Repository
+	OperatorRepository   operator.Repository
+	AuditRepository      audit.Repository
+	EnrollmentRepository enrollment.Repository
+	RegistrationService  *agentService.RegistrationService
+	// MetricRollup downsamples stored metrics and answers series queries
+	MetricRollup *metricrollup.Service
+	// KeyRotation switches agents to a new key without re-registration
+	KeyRotation *agentService.KeyRotationService
+	// Liveness marks agents stale or offline once they stop heartbeating
+	Liveness *agentService.LivenessService
+	// Webhooks queues and delivers webhook notifications
+	Webhooks *webhookService.Service
+	// Operators authenticates the API tokens operators present
+	Operators *operatorService.Service
+	// Audit verifies the hash chain of the audit log
+	Audit *auditService.Service
+	// Enrollment manages the tokens agents register with
+	Enrollment *enrollmentService.Service
+
+	// CertificateAuthority issues agent mTLS client certificates when configured
+	CertificateAuthority *certauthority.Authority
+	// RequireClientCertificate enforces mTLS on authenticated agent routes
+	RequireClientCertificate bool
+	// RequireOperatorToken rejects operator API requests without a token
+	RequireOperatorToken bool
+	// Nonces, when set, tracks agent request nonces to reject replays
+	Nonces nonce.Store
+	// MinSignatureVersion rejects agent requests signed with an older
+	// version; zero accepts every version
+	MinSignatureVersion int
+	// TaskClaimLease and TaskRunLease bound how long an agent may hold a
+	// claimed or running task without reporting; zero uses the defaults
+	TaskClaimLease time.Duration
+	TaskRunLease   time.Duration
 }
 
 func NewContainer(db *gorm.DB) *Container {
 	// Initialize repositories
 	agentRepo := gormRepo.NewAgentRepository(db)
 	taskRepo := gormRepo.NewTaskRepository(db)
+	metricsRepo := gormRepo.NewMetricsRepository(db)
+	credentialRepo := gormRepo.NewCredentialRepository(db)
+	webhookRepo := gormRepo.NewWebhookRepository(db)
+	operatorRepo := gormRepo.NewOperatorRepository(db)
+	auditRepo := gormRepo.NewAuditRepository(db)
+	enrollmentRepo := gormRepo.NewEnrollmentRepository(db)
 
 	// Initialize services
-	registrationSvc := agentService.NewRegistrationService(agentRepo)
+	enrollmentSvc := enrollmentService.NewService(enrollmentRepo)
+	registrationSvc := agentService.NewRegistrationService(agentRepo).WithEnrollment(enrollmentSvc, false)
+	webhookSvc := webhookService.NewService(webhookRepo, webhookService.DefaultConfig())
 
 	return &Container{
-		DB:                  db,
-		AgentRepository:     agentRepo,
-		TaskRepository:      taskRepo,
-		RegistrationService: registrationSvc,
+		DB:                   db,
+		AgentRepository:      agentRepo,
+		TaskRepository:       taskRepo,
+		TaskOutputRepository: gormRepo.NewTaskOutputRepository(db),
+		MetricsRepository:    metricsRepo,
+		CredentialRepository: credentialRepo,
+		SecretRepository:     gormRepo.NewSecretRepository(db),
+		WebhookRepository:    webhookRepo,
+		OperatorRepository:   operatorRepo,
+		AuditRepository:      auditRepo,
+		EnrollmentRepository: enrollmentRepo,
+		RegistrationService:  registrationSvc,
+		KeyRotation:          agentService.NewKeyRotationService(agentRepo, agentService.DefaultKeyRotationOverlap),
+		MetricRollup:         metricrollup.NewService(metricsRepo, metricrollup.DefaultRetention()),
+		Liveness:             agentService.NewLivenessService(agentRepo, agentService.DefaultLivenessThresholds()).WithPublisher(webhookSvc),
+		Webhooks:             webhookSvc,
+		Operators:            operatorService.NewService(operatorRepo),
+		Audit:                auditService.NewService(auditRepo),
+		Enrollment:           enrollmentSvc,
 	}
 }
 
 func (c *Container) Migrate() error {
+	if err := gormRepo.MigrateNonces(c.DB); err != nil {
+		return err
+	}
+	if err := gormRepo.MigrateAgentTags(c.DB); err != nil {
+		return err
+	}
+
 	// Migrate domain models
 	if err := c.DB.AutoMigrate(
 		&agent.Agent{},
 		&agent.AgentTag{},
 		&agent.AgentRegistration{},
+		&agent.StatusEvent{},
+		&agent.PendingRegistration{},
 		&nonce.Nonce{},
 		&task.Task{},
+		&task.Execution{},
+		&task.OutputChunk{},
+		&metrics.Sample{},
+		&credential.Credential{},
+		&secret.Secret{},
+		&webhook.Subscription{},
+		&webhook.Delivery{},
+		&operator.Operator{},
+		&operator.Token{},
+		&audit.Entry{},
+		&enrollment.Token{},
 	); err != nil {
 		return err
 	}
 
-	return nil
+	if err := gormRepo.MigrateAuditLog(c.DB); err != nil {
+		return err
+	}
+	return gormRepo.MigrateMetricRollups(c.DB)
 }
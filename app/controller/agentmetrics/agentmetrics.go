@@ -0,0 +1,165 @@
+// Package agentmetrics ingests the metric payloads agents push and serves
+// the aggregated time series
+package agentmetrics
+
+import (
+	"context"
+	"errors"
+	"hostlink/app/service/metricrollup"
+	"hostlink/domain/metrics"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	Handler struct {
+		repo    metrics.Repository
+		querier Querier
+	}
+
+	// Querier answers aggregated series queries
+	Querier interface {
+		Query(ctx context.Context, q metricrollup.Query) (*metricrollup.QueryResult, error)
+	}
+)
+
+func NewHandler(repo metrics.Repository, querier Querier) *Handler {
+	return &Handler{repo: repo, querier: querier}
+}
+
+// Ingest stores a metric payload pushed by an authenticated agent
+func (h *Handler) Ingest(c echo.Context) error {
+	agentID := c.Param("id")
+	if agentID != c.Request().Header.Get("X-Agent-ID") {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Agent ID does not match authenticated agent",
+		})
+	}
+
+	var payload metrics.MetricPayload
+	if err := c.Bind(&payload); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+
+	samples, err := metrics.SamplesFromPayload(agentID, payload)
+	if err != nil {
+		if errors.Is(err, metrics.ErrAgentMismatch) {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "Payload agent does not match authenticated agent",
+			})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.repo.Append(c.Request().Context(), samples); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to store metrics: " + err.Error(),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Query returns an agent's aggregated series of one metric type. It takes
+// type, from and to (RFC 3339, default: the last hour), step (a duration),
+// and repeatable field and attribute=key=value filters.
+func (h *Handler) Query(c echo.Context) error {
+	if h.querier == nil {
+		return c.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "Metrics queries are not enabled",
+		})
+	}
+
+	to := time.Now().UTC()
+	parsedTo, err := timeParam(c, "to")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid to: " + err.Error(),
+		})
+	}
+	if parsedTo != nil {
+		to = *parsedTo
+	}
+	from := to.Add(-time.Hour)
+	parsedFrom, err := timeParam(c, "from")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid from: " + err.Error(),
+		})
+	}
+	if parsedFrom != nil {
+		from = *parsedFrom
+	}
+
+	query := metricrollup.Query{
+		AgentID: c.Param("id"),
+		Type:    c.QueryParam("type"),
+		Fields:  c.QueryParams()["field"],
+		From:    from,
+		To:      to,
+	}
+	if step := c.QueryParam("step"); step != "" {
+		if query.Step, err = time.ParseDuration(step); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid step: " + err.Error(),
+			})
+		}
+	}
+	for _, attribute := range c.QueryParams()["attribute"] {
+		key, value, ok := strings.Cut(attribute, "=")
+		if !ok || key == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid attribute " + attribute + ": expected key=value",
+			})
+		}
+		if query.Attributes == nil {
+			query.Attributes = map[string]string{}
+		}
+		query.Attributes[key] = value
+	}
+
+	result, err := h.querier.Query(c.Request().Context(), query)
+	if err != nil {
+		if errors.Is(err, metricrollup.ErrInvalidQuery) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to query metrics: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func timeParam(c echo.Context, name string) (*time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// RegisterAgentRoutes registers the push endpoint on a group mounted at
+// /:id with agent authentication applied
+func (h *Handler) RegisterAgentRoutes(g *echo.Group) {
+	g.POST("/metrics", h.Ingest)
+}
+
+// RegisterRoutes registers the query endpoint on a group mounted at /:id
+// with operator authentication applied
+func (h *Handler) RegisterRoutes(g *echo.Group) {
+	g.GET("/metrics", h.Query)
+}
@@ -0,0 +1,168 @@
+package agentmetrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hostlink/app/service/metricrollup"
+	"hostlink/domain/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockMetricsRepository implements Append; any other method panics through
+// the nil embedded interface.
+type mockMetricsRepository struct {
+	metrics.Repository
+	appendFunc func(ctx context.Context, samples []metrics.Sample) error
+}
+
+func (m *mockMetricsRepository) Append(ctx context.Context, samples []metrics.Sample) error {
+	if m.appendFunc != nil {
+		return m.appendFunc(ctx, samples)
+	}
+	return nil
+}
+
+func push(handler *Handler, pathID, headerID string, payload metrics.MetricPayload) *httptest.ResponseRecorder {
+	e := echo.New()
+	handler.RegisterAgentRoutes(e.Group("/agents/:id"))
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/agents/"+pathID+"/metrics", bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-Agent-ID", headerID)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIngest(t *testing.T) {
+	payload := metrics.MetricPayload{
+		Version:     "1",
+		TimestampMs: 1700000000000,
+		Resource:    metrics.Resource{AgentID: "agt_123", HostName: "db-1"},
+		MetricSets: []metrics.MetricSet{
+			{Type: metrics.MetricTypeSystem, Metrics: metrics.SystemMetrics{CPUPercent: 12.5}},
+			{
+				Type:       metrics.MetricTypeStorage,
+				Attributes: map[string]any{"mount_point": "/", "device": "sda1"},
+				Metrics:    metrics.StorageMetrics{DiskUsedPercent: 40},
+			},
+		},
+	}
+
+	t.Run("stores one sample per metric set", func(t *testing.T) {
+		var stored []metrics.Sample
+		handler := NewHandler(&mockMetricsRepository{appendFunc: func(ctx context.Context, samples []metrics.Sample) error {
+			stored = samples
+			return nil
+		}}, nil)
+
+		rec := push(handler, "agt_123", "agt_123", payload)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		require.Len(t, stored, 2)
+		assert.Equal(t, "agt_123", stored[0].AgentID)
+		assert.Equal(t, metrics.MetricTypeSystem, stored[0].Type)
+		assert.Equal(t, "db-1", stored[0].HostName)
+		assert.True(t, stored[0].Timestamp.Equal(time.UnixMilli(1700000000000)))
+		assert.JSONEq(t, `{"device":"sda1","mount_point":"/"}`, stored[1].SeriesKey)
+		assert.Contains(t, stored[1].Metrics, `"disk_used_percent":40`)
+	})
+
+	t.Run("returns 403 when pushing for another agent", func(t *testing.T) {
+		handler := NewHandler(&mockMetricsRepository{}, nil)
+
+		rec := push(handler, "agt_other", "agt_123", payload)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("returns 403 when the payload names another agent", func(t *testing.T) {
+		handler := NewHandler(&mockMetricsRepository{}, nil)
+
+		rec := push(handler, "agt_456", "agt_456", payload)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("returns 400 for a metric set without type", func(t *testing.T) {
+		handler := NewHandler(&mockMetricsRepository{}, nil)
+		invalid := metrics.MetricPayload{MetricSets: []metrics.MetricSet{{Metrics: map[string]int{"x": 1}}}}
+
+		rec := push(handler, "agt_123", "agt_123", invalid)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+type mockQuerier struct {
+	queryFunc func(ctx context.Context, q metricrollup.Query) (*metricrollup.QueryResult, error)
+}
+
+func (m *mockQuerier) Query(ctx context.Context, q metricrollup.Query) (*metricrollup.QueryResult, error) {
+	return m.queryFunc(ctx, q)
+}
+
+func TestQuery(t *testing.T) {
+	query := func(handler *Handler, rawQuery string) *httptest.ResponseRecorder {
+		e := echo.New()
+		handler.RegisterRoutes(e.Group("/agents/:id"))
+		req := httptest.NewRequest(http.MethodGet, "/agents/agt_123/metrics"+rawQuery, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("passes the query and returns the series", func(t *testing.T) {
+		var got metricrollup.Query
+		handler := NewHandler(&mockMetricsRepository{}, &mockQuerier{queryFunc: func(ctx context.Context, q metricrollup.Query) (*metricrollup.QueryResult, error) {
+			got = q
+			return &metricrollup.QueryResult{AgentID: q.AgentID, Type: q.Type, Step: "5m", Resolution: "5m", Series: []metricrollup.SeriesField{}}, nil
+		}})
+
+		rec := query(handler, "?type=storage&from=2024-01-01T00:00:00Z&to=2024-01-01T06:00:00Z&step=5m&attribute=mount_point=/&field=disk_used_percent")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "agt_123", got.AgentID)
+		assert.Equal(t, "storage", got.Type)
+		assert.Equal(t, 5*time.Minute, got.Step)
+		assert.Equal(t, map[string]string{"mount_point": "/"}, got.Attributes)
+		assert.Equal(t, []string{"disk_used_percent"}, got.Fields)
+		assert.Equal(t, 6*time.Hour, got.To.Sub(got.From))
+		var resp metricrollup.QueryResult
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "5m", resp.Resolution)
+	})
+
+	t.Run("defaults to the last hour", func(t *testing.T) {
+		var got metricrollup.Query
+		handler := NewHandler(&mockMetricsRepository{}, &mockQuerier{queryFunc: func(ctx context.Context, q metricrollup.Query) (*metricrollup.QueryResult, error) {
+			got = q
+			return &metricrollup.QueryResult{}, nil
+		}})
+
+		rec := query(handler, "?type=system")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, time.Hour, got.To.Sub(got.From))
+		assert.WithinDuration(t, time.Now(), got.To, time.Minute)
+	})
+
+	t.Run("returns 400 for an invalid query", func(t *testing.T) {
+		handler := NewHandler(&mockMetricsRepository{}, &mockQuerier{queryFunc: func(ctx context.Context, q metricrollup.Query) (*metricrollup.QueryResult, error) {
+			return nil, metricrollup.ErrInvalidQuery
+		}})
+
+		for _, rawQuery := range []string{"?type=system&step=soon", "?type=system&from=yesterday", "?type=system&attribute=mount_point", ""} {
+			rec := query(handler, rawQuery)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, rawQuery)
+		}
+	})
+}
@@ -2,18 +2,46 @@
 package agents
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hostlink/app/middleware/agentauth"
+	"hostlink/app/middleware/auditlog"
+	"hostlink/app/middleware/operatorauth"
 	agentService "hostlink/app/service/agent"
+	"hostlink/app/service/certauthority"
+	webhookService "hostlink/app/service/webhook"
 	"hostlink/domain/agent"
+	"hostlink/domain/audit"
+	"hostlink/domain/task"
+	"hostlink/domain/webhook"
+	hlcrypto "hostlink/internal/crypto"
+	"hostlink/internal/update"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
+// defaultEventsLimit caps the status events returned without a limit.
+const defaultEventsLimit = 50
+
 type (
 	Handler struct {
 		registrationSvc agentService.Registrar
 		agentRepo       agent.Repository
+		certIssuer      certauthority.Issuer
+		taskClaimer     TaskClaimer
+		claimLease      time.Duration
+		publisher       webhookService.Publisher
+		keyRotator      agentService.KeyRotator
+	}
+
+	// TaskClaimer hands an agent the pending tasks it may run
+	TaskClaimer interface {
+		Claim(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error)
 	}
 
 	// RegistrationRequest represents the incoming registration request from agent
@@ -24,6 +52,19 @@ type (
 		PublicKey     string    `json:"public_key" validate:"required"`
 		PublicKeyType string    `json:"public_key_type" validate:"required"`
 		Tags          []TagPair `json:"tags"`
+		// CSR optionally requests an mTLS client certificate for PublicKey
+		CSR string `json:"csr,omitempty"`
+
+		// Hardware the agent runs on, compared with the agent it resembles
+		// when its fingerprint is unknown
+		Hostname     string          `json:"hostname,omitempty"`
+		IPAddress    string          `json:"ip_address,omitempty"`
+		MACAddress   string          `json:"mac_address,omitempty"`
+		MachineID    string          `json:"machine_id,omitempty"`
+		HardwareInfo json.RawMessage `json:"hardware_info,omitempty"`
+		// PreviousFingerprint is the fingerprint the agent had before its
+		// hardware drifted, if it did
+		PreviousFingerprint string `json:"previous_fingerprint,omitempty"`
 	}
 
 	// TagPair represents a key-value tag
@@ -39,6 +80,94 @@ type (
 		Status       string    `json:"status"`
 		Message      string    `json:"message"`
 		RegisteredAt time.Time `json:"registered_at"`
+		// ClientCertificate is the PEM certificate issued for the CSR, if any
+		ClientCertificate string `json:"client_certificate,omitempty"`
+		// RegistrationID identifies a registration held for approval
+		RegistrationID string `json:"registration_id,omitempty"`
+	}
+
+	// CertificateRenewalRequest carries a CSR for the agent's current key
+	CertificateRenewalRequest struct {
+		CSR string `json:"csr" validate:"required"`
+	}
+
+	// CertificateResponse returns an issued client certificate
+	CertificateResponse struct {
+		Certificate string `json:"certificate"`
+	}
+
+	// KeyRotationRequest switches an authenticated agent to a new key
+	KeyRotationRequest struct {
+		PublicKey     string `json:"public_key" validate:"required"`
+		PublicKeyType string `json:"public_key_type" validate:"required"`
+		// Proof is agent.KeyProofMessage signed with the new key
+		Proof       string              `json:"proof" validate:"required"`
+		Credentials []RotatedCredential `json:"credentials"`
+		Secrets     []RotatedSecret     `json:"secrets"`
+		// CSR optionally requests an mTLS client certificate for PublicKey
+		CSR string `json:"csr,omitempty"`
+	}
+
+	// RotatedCredential is a credential password re-encrypted with the new
+	// key, replacing PreviousPasswdEnc
+	RotatedCredential struct {
+		ID                string `json:"id" validate:"required"`
+		PreviousPasswdEnc string `json:"previous_passwd_enc" validate:"required"`
+		PasswdEnc         string `json:"passwd_enc" validate:"required"`
+	}
+
+	// RotatedSecret is a secret value sealed again for the new key,
+	// replacing PreviousValueEnc
+	RotatedSecret struct {
+		ID               string `json:"id" validate:"required"`
+		PreviousValueEnc string `json:"previous_value_enc" validate:"required"`
+		ValueEnc         string `json:"value_enc" validate:"required"`
+	}
+
+	// KeyRotationResponse reports until when the previous key still
+	// authenticates the agent
+	KeyRotationResponse struct {
+		RotatedAt             *time.Time `json:"rotated_at"`
+		PreviousKeyValidUntil *time.Time `json:"previous_key_valid_until"`
+		// Certificate is the PEM certificate issued for the CSR, if any
+		Certificate string `json:"certificate,omitempty"`
+	}
+
+	// UpdateStatusRequest reports the outcome of an agent self-update, in
+	// the shape of the agent's update state file
+	UpdateStatusRequest struct {
+		UpdateID      string `json:"update_id"`
+		State         string `json:"state" validate:"required"`
+		SourceVersion string `json:"source_version"`
+		TargetVersion string `json:"target_version"`
+		Error         string `json:"error"`
+	}
+
+	// AccessRequest gives the reason an agent is quarantined, released or
+	// revoked
+	AccessRequest struct {
+		Reason string `json:"reason"`
+	}
+
+	// AccessResponse reports an agent's access state after a change
+	AccessResponse struct {
+		ID              string     `json:"id"`
+		Access          string     `json:"access"`
+		AccessReason    string     `json:"access_reason,omitempty"`
+		AccessChangedAt *time.Time `json:"access_changed_at,omitempty"`
+	}
+
+	// HeartbeatRequest optionally carries the tags the agent declares. A
+	// nil list leaves its declared tags unchanged; an empty one clears them.
+	HeartbeatRequest struct {
+		DeclaredTags []TagPair `json:"declared_tags" validate:"max=100,dive"`
+	}
+
+	// HeartbeatResponse acknowledges a heartbeat and carries the tasks
+	// claimed for the agent
+	HeartbeatResponse struct {
+		Message      string      `json:"message"`
+		PendingTasks []task.Task `json:"pending_tasks"`
 	}
 )
 
@@ -53,6 +182,33 @@ func NewHandlerWithRepo(svc agentService.Registrar, repo agent.Repository) *Hand
 	}
 }
 
+// WithCertificateIssuer enables issuing mTLS client certificates
+func (h *Handler) WithCertificateIssuer(issuer certauthority.Issuer) *Handler {
+	h.certIssuer = issuer
+	return h
+}
+
+// WithKeyRotation lets agents replace their key without re-registering
+func (h *Handler) WithKeyRotation(rotator agentService.KeyRotator) *Handler {
+	h.keyRotator = rotator
+	return h
+}
+
+// WithTaskClaimer makes heartbeats claim and return the agent's pending
+// tasks under the given claim lease
+func (h *Handler) WithTaskClaimer(claimer TaskClaimer, lease time.Duration) *Handler {
+	h.taskClaimer = claimer
+	h.claimLease = lease
+	return h
+}
+
+// WithPublisher publishes agent.registered and update.rolled_back webhook
+// events
+func (h *Handler) WithPublisher(publisher webhookService.Publisher) *Handler {
+	h.publisher = publisher
+	return h
+}
+
 // RegisterAgent handles agent registration at /hostlink/v1/register
 func (h *Handler) RegisterAgent(c echo.Context) error {
 	var req RegistrationRequest
@@ -68,6 +224,24 @@ func (h *Handler) RegisterAgent(c echo.Context) error {
 		})
 	}
 
+	entry := auditlog.EntryFrom(c)
+	entry.TokenID = req.TokenID
+	entry.SetDetail(map[string]string{"fingerprint": req.Fingerprint})
+
+	if req.CSR != "" && h.certIssuer != nil {
+		csr, err := hlcrypto.ParseCertificateRequestPEM(req.CSR)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid certificate request: " + err.Error(),
+			})
+		}
+		if err := certauthority.MatchesPublicKey(csr, req.PublicKey); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid certificate request: " + err.Error(),
+			})
+		}
+	}
+
 	ctx := c.Request().Context()
 
 	// Convert request to service layer format
@@ -77,6 +251,13 @@ func (h *Handler) RegisterAgent(c echo.Context) error {
 		TokenKey:      req.TokenKey,
 		PublicKey:     req.PublicKey,
 		PublicKeyType: req.PublicKeyType,
+
+		Hostname:            req.Hostname,
+		IPAddress:           req.IPAddress,
+		MACAddress:          req.MACAddress,
+		MachineID:           req.MachineID,
+		HardwareInfo:        string(req.HardwareInfo),
+		PreviousFingerprint: req.PreviousFingerprint,
 	}
 
 	// Convert tags
@@ -89,6 +270,21 @@ func (h *Handler) RegisterAgent(c echo.Context) error {
 
 	// Call service
 	agent, err := h.registrationSvc.RegisterAgent(ctx, svcReq)
+	var held *agentService.PendingApprovalError
+	if errors.As(err, &held) {
+		entry.Target = held.Registration.ID
+		entry.SetDetail(map[string]string{
+			"fingerprint": req.Fingerprint,
+			"status":      held.Registration.Status,
+			"candidate":   held.Registration.CandidateAgentID,
+		})
+		return c.JSON(http.StatusAccepted, RegistrationResponse{
+			Fingerprint:    req.Fingerprint,
+			Status:         held.Registration.Status,
+			Message:        "Registration is held until an operator approves it",
+			RegistrationID: held.Registration.ID,
+		})
+	}
 	if err != nil {
 		switch err {
 		case agentService.ErrInvalidToken:
@@ -99,6 +295,10 @@ func (h *Handler) RegisterAgent(c echo.Context) error {
 			return c.JSON(http.StatusConflict, map[string]string{
 				"error": "Agent already exists",
 			})
+		case agentService.ErrAgentRevoked:
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "Agent revoked",
+			})
 		default:
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": err.Error(),
@@ -109,17 +309,302 @@ func (h *Handler) RegisterAgent(c echo.Context) error {
 	// Determine if new or re-registration
 	isNewRegistration := agent.CreatedAt.Equal(agent.UpdatedAt)
 
-	// Return success response
-	return c.JSON(http.StatusOK, RegistrationResponse{
+	entry.ActorType = audit.ActorAgent
+	entry.ActorID = agent.ID
+	entry.Target = agent.ID
+	entry.SetDetail(map[string]any{"fingerprint": agent.Fingerprint, "new": isNewRegistration})
+
+	response := RegistrationResponse{
 		ID:           agent.ID,
 		Fingerprint:  agent.Fingerprint,
 		Status:       "registered",
 		Message:      determineMessage(isNewRegistration),
 		RegisteredAt: agent.RegisteredAt,
+	}
+
+	if req.CSR != "" && h.certIssuer != nil {
+		cert, err := h.certIssuer.Issue(req.CSR, agent.ID, agent.PublicKey)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to issue client certificate: " + err.Error(),
+			})
+		}
+		response.ClientCertificate = cert
+	}
+
+	if isNewRegistration {
+		h.publish(c, webhook.EventAgentRegistered, webhook.AgentData{
+			ID:          agent.ID,
+			Fingerprint: agent.Fingerprint,
+			Hostname:    agent.Hostname,
+			Status:      agent.Status,
+			LastSeen:    agent.LastSeen,
+		})
+	}
+
+	// Return success response
+	return c.JSON(http.StatusOK, response)
+}
+
+// RenewCertificate issues a fresh client certificate for an authenticated agent
+func (h *Handler) RenewCertificate(c echo.Context) error {
+	agentID := c.Param("id")
+	if agentID != c.Request().Header.Get("X-Agent-ID") {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Agent ID does not match authenticated agent",
+		})
+	}
+	if h.certIssuer == nil {
+		return c.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "Client certificates are not enabled",
+		})
+	}
+
+	var req CertificateRenewalRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Validation failed: " + err.Error(),
+		})
+	}
+
+	publicKey, err := h.agentRepo.GetPublicKeyByAgentID(c.Request().Context(), agentID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Agent not found",
+		})
+	}
+
+	cert, err := h.certIssuer.Issue(req.CSR, agentID, publicKey)
+	if err != nil {
+		if errors.Is(err, certauthority.ErrPublicKeyMismatch) || errors.Is(err, certauthority.ErrInvalidRequest) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to issue client certificate: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, CertificateResponse{Certificate: cert})
+}
+
+// RotateKey switches an authenticated agent to a new key. The request is
+// signed with the current key and carries a proof made with the new one;
+// the previous key keeps authenticating the agent for an overlap window,
+// but cannot rotate the key again.
+func (h *Handler) RotateKey(c echo.Context) error {
+	agentID := c.Param("id")
+	if agentID != c.Request().Header.Get("X-Agent-ID") {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Agent ID does not match authenticated agent",
+		})
+	}
+	if agentauth.SignedWithPreviousKey(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Key rotation must be signed with the current key",
+		})
+	}
+	if h.keyRotator == nil {
+		return c.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "Key rotation is not enabled",
+		})
+	}
+
+	var req KeyRotationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Validation failed: " + err.Error(),
+		})
+	}
+
+	// The certificate is issued first so a bad CSR leaves the key in place
+	var cert string
+	if req.CSR != "" && h.certIssuer != nil {
+		var err error
+		cert, err = h.certIssuer.Issue(req.CSR, agentID, req.PublicKey)
+		if err != nil {
+			if errors.Is(err, certauthority.ErrPublicKeyMismatch) || errors.Is(err, certauthority.ErrInvalidRequest) {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": err.Error(),
+				})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to issue client certificate: " + err.Error(),
+			})
+		}
+	}
+
+	rotation := agentService.KeyRotationRequest{
+		PublicKey:     req.PublicKey,
+		PublicKeyType: req.PublicKeyType,
+		Proof:         req.Proof,
+	}
+	for _, cred := range req.Credentials {
+		rotation.Credentials = append(rotation.Credentials, agentService.RotatedCredential{
+			ID:                cred.ID,
+			PreviousPasswdEnc: cred.PreviousPasswdEnc,
+			PasswdEnc:         cred.PasswdEnc,
+		})
+	}
+	for _, secret := range req.Secrets {
+		rotation.Secrets = append(rotation.Secrets, agentService.RotatedSecret{
+			ID:               secret.ID,
+			PreviousValueEnc: secret.PreviousValueEnc,
+			ValueEnc:         secret.ValueEnc,
+		})
+	}
+
+	rotated, err := h.keyRotator.RotateKey(c.Request().Context(), agentID, rotation)
+	if err != nil {
+		switch {
+		case errors.Is(err, agentService.ErrInvalidPublicKey), errors.Is(err, agentService.ErrInvalidKeyProof):
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, agent.ErrKeyChanged), errors.Is(err, agent.ErrCredentialsChanged), errors.Is(err, agent.ErrSecretsChanged):
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, agent.ErrAgentNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Agent not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to rotate key: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, KeyRotationResponse{
+		RotatedAt:             rotated.KeyRotatedAt,
+		PreviousKeyValidUntil: rotated.PreviousPublicKeyExpiresAt,
+		Certificate:           cert,
 	})
 }
 
-// List returns all registered agents
+// Heartbeat records that an authenticated agent is alive, replaces its
+// declared tags when it sends them and returns the tasks claimed for it. A
+// quarantined agent is claimed no tasks.
+func (h *Handler) Heartbeat(c echo.Context) error {
+	agentID := c.Param("id")
+	if agentID != c.Request().Header.Get("X-Agent-ID") {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Agent ID does not match authenticated agent",
+		})
+	}
+
+	// Heartbeats had no body before agents declared tags; a body that is
+	// not JSON is still ignored
+	var req HeartbeatRequest
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request format: " + err.Error(),
+			})
+		}
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Validation failed: " + err.Error(),
+		})
+	}
+	declared, err := declaredTags(req.DeclaredTags)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	if err := h.agentRepo.RecordHeartbeat(ctx, agentID, time.Now()); err != nil {
+		if errors.Is(err, agent.ErrAgentNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Agent not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to record heartbeat: " + err.Error(),
+		})
+	}
+	if req.DeclaredTags != nil {
+		if err := h.agentRepo.SetDeclaredTags(ctx, agentID, declared); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to update declared tags: " + err.Error(),
+			})
+		}
+	}
+
+	response := HeartbeatResponse{Message: "ok", PendingTasks: []task.Task{}}
+	if h.taskClaimer != nil && !agentauth.IsQuarantined(c) {
+		tasks, err := h.taskClaimer.Claim(ctx, agentID, h.claimLease)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to fetch tasks: " + err.Error(),
+			})
+		}
+		response.PendingTasks = append(response.PendingTasks, tasks...)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ReportUpdate accepts an agent's self-update outcome and publishes
+// update.rolled_back when the update was rolled back
+func (h *Handler) ReportUpdate(c echo.Context) error {
+	agentID := c.Param("id")
+	if agentID != c.Request().Header.Get("X-Agent-ID") {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Agent ID does not match authenticated agent",
+		})
+	}
+
+	var req UpdateStatusRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Validation failed: " + err.Error(),
+		})
+	}
+
+	if req.State == string(update.StateRolledBack) {
+		h.publish(c, webhook.EventUpdateRolledBack, webhook.UpdateData{
+			AgentID:       agentID,
+			UpdateID:      req.UpdateID,
+			SourceVersion: req.SourceVersion,
+			TargetVersion: req.TargetVersion,
+			Error:         req.Error,
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// publish queues a webhook event. Notifications are best effort, so a
+// failure is logged rather than failing the request.
+func (h *Handler) publish(c echo.Context, eventType string, data any) {
+	if h.publisher == nil {
+		return
+	}
+	if err := h.publisher.Publish(c.Request().Context(), eventType, data); err != nil {
+		c.Logger().Errorf("publish %s webhook: %v", eventType, err)
+	}
+}
+
+// List returns the registered agents; a scoped operator only gets those in
+// its scope
 func (h *Handler) List(c echo.Context) error {
 	ctx := c.Request().Context()
 
@@ -140,6 +625,16 @@ func (h *Handler) List(c echo.Context) error {
 		})
 	}
 
+	if o := operatorauth.FromContext(c); o != nil && o.Scoped() {
+		inScope := agents[:0]
+		for _, a := range agents {
+			if o.InScope(a.Tags) {
+				inScope = append(inScope, a)
+			}
+		}
+		agents = inScope
+	}
+
 	return c.JSON(http.StatusOK, agents)
 }
 
@@ -147,14 +642,18 @@ type AgentDetailsResponse struct {
 	ID           string        `json:"id"`
 	Fingerprint  string        `json:"fingerprint"`
 	Status       string        `json:"status"`
+	Access       string        `json:"access"`
+	AccessReason string        `json:"access_reason,omitempty"`
 	LastSeen     time.Time     `json:"last_seen"`
 	Tags         []TagResponse `json:"tags"`
 	RegisteredAt time.Time     `json:"registered_at"`
+	KeyRotatedAt *time.Time    `json:"key_rotated_at"`
 }
 
 type TagResponse struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
 }
 
 func (h *Handler) Show(c echo.Context) error {
@@ -176,8 +675,9 @@ func (h *Handler) Show(c echo.Context) error {
 	tags := make([]TagResponse, len(agent.Tags))
 	for i, tag := range agent.Tags {
 		tags[i] = TagResponse{
-			Key:   tag.Key,
-			Value: tag.Value,
+			Key:    tag.Key,
+			Value:  tag.Value,
+			Source: tagSource(tag.Source),
 		}
 	}
 
@@ -185,14 +685,118 @@ func (h *Handler) Show(c echo.Context) error {
 		ID:           agent.ID,
 		Fingerprint:  agent.Fingerprint,
 		Status:       agent.Status,
+		Access:       agent.Access,
+		AccessReason: agent.AccessReason,
 		LastSeen:     agent.LastSeen,
 		Tags:         tags,
 		RegisteredAt: agent.RegisteredAt,
+		KeyRotatedAt: agent.KeyRotatedAt,
 	}
 
 	return c.JSON(http.StatusOK, response)
 }
 
+// Events lists an agent's status transitions, newest first. The optional
+// limit query parameter caps the result (default 50).
+func (h *Handler) Events(c echo.Context) error {
+	id := c.Param("id")
+	ctx := c.Request().Context()
+
+	limit := defaultEventsLimit
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "limit must be a positive integer",
+			})
+		}
+		limit = parsed
+	}
+
+	if _, err := h.agentRepo.FindByID(ctx, id); err != nil {
+		if err.Error() == "record not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Agent not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch agent: " + err.Error(),
+		})
+	}
+
+	events, err := h.agentRepo.FindStatusEvents(ctx, id, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch agent events: " + err.Error(),
+		})
+	}
+	if events == nil {
+		events = []agent.StatusEvent{}
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
+
+// Quarantine stops handing the agent tasks; it keeps heartbeating and
+// pushing metrics.
+func (h *Handler) Quarantine(c echo.Context) error {
+	return h.setAccess(c, agent.AccessQuarantined)
+}
+
+// Release lifts an agent's quarantine.
+func (h *Handler) Release(c echo.Context) error {
+	return h.setAccess(c, agent.AccessActive)
+}
+
+// Revoke rejects every further request of the agent. Revocation is final:
+// the agent cannot be released or register again.
+func (h *Handler) Revoke(c echo.Context) error {
+	return h.setAccess(c, agent.AccessRevoked)
+}
+
+func (h *Handler) setAccess(c echo.Context, access string) error {
+	var req AccessRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+
+	agentID := c.Param("id")
+	entry := auditlog.EntryFrom(c)
+	entry.Target = agentID
+	entry.SetDetail(map[string]string{"access": access, "reason": req.Reason})
+
+	now := time.Now()
+	err := h.agentRepo.SetAccess(c.Request().Context(), agent.AccessChange{
+		AgentID: agentID,
+		Access:  access,
+		Reason:  req.Reason,
+		At:      now,
+	})
+	switch {
+	case errors.Is(err, agent.ErrAgentNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Agent not found",
+		})
+	case errors.Is(err, agent.ErrAgentRevoked):
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "Agent is revoked",
+		})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to change agent access: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, AccessResponse{
+		ID:              agentID,
+		Access:          access,
+		AccessReason:    req.Reason,
+		AccessChangedAt: &now,
+	})
+}
+
 func determineEvent(isNew bool) string {
 	if isNew {
 		return "register"
@@ -207,12 +811,56 @@ func determineMessage(isNew bool) string {
 	return "Agent successfully re-registered"
 }
 
-// RegisterRoutes registers all agent-related routes
+// RegisterRoutes registers the route agents register with
 func (h *Handler) RegisterRoutes(g *echo.Group) {
 	// Registration endpoint as specified in the issue
 	g.POST("/register", h.RegisterAgent)
+}
 
-	// Additional endpoints for management
+// RegisterListRoutes registers the route operators list agents with. The
+// group is expected to have operator authentication applied.
+func (h *Handler) RegisterListRoutes(g *echo.Group) {
 	g.GET("", h.List)
-	g.GET("/:id", h.Show)
+}
+
+// RegisterReadRoutes registers the routes operators read an agent's state
+// with. The group is expected to be mounted at /:id with operator
+// authentication applied.
+func (h *Handler) RegisterReadRoutes(g *echo.Group) {
+	g.GET("", h.Show)
+	g.GET("/events", h.Events)
+}
+
+// RegisterAdminRoutes registers the routes operators change an agent's
+// access and server tags with. The group is expected to be mounted at /:id.
+func (h *Handler) RegisterAdminRoutes(g *echo.Group) {
+	g.POST("/quarantine", h.Quarantine)
+	g.POST("/release", h.Release)
+	g.POST("/revoke", h.Revoke)
+	g.GET("/tags", h.Tags)
+	g.PUT("/tags/:key", h.SetTag)
+	g.DELETE("/tags/:key", h.DeleteTag)
+}
+
+// RegisterAgentRoutes registers routes called by an authenticated agent on
+// its own resource. The group is expected to be mounted at /:id with agent
+// authentication that rejects quarantined agents applied.
+func (h *Handler) RegisterAgentRoutes(g *echo.Group) {
+	g.POST("/rotate-key", h.RotateKey)
+	g.POST("/update-status", h.ReportUpdate)
+}
+
+// RegisterHeartbeatRoutes registers the route an agent heartbeats on. The
+// group is expected to be mounted at /:id with agent authentication
+// applied; a quarantined agent keeps heartbeating.
+func (h *Handler) RegisterHeartbeatRoutes(g *echo.Group) {
+	g.POST("/heartbeat", h.Heartbeat)
+}
+
+// RegisterRenewalRoutes registers the route an agent renews its client
+// certificate with. The group is expected to be mounted at /:id with agent
+// authentication that does not require a client certificate, so an agent
+// whose certificate expired can still get a new one.
+func (h *Handler) RegisterRenewalRoutes(g *echo.Group) {
+	g.POST("/certificate", h.RenewCertificate)
 }
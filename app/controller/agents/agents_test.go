@@ -5,13 +5,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"hostlink/app/middleware/operatorauth"
 	"hostlink/domain/agent"
+	"hostlink/domain/operator"
+	"hostlink/domain/task"
+	"hostlink/domain/webhook"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	agentService "hostlink/app/service/agent"
+	"hostlink/app/service/certauthority"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -30,8 +36,17 @@ func (m *mockRegistrationService) RegisterAgent(ctx context.Context, req agentSe
 }
 
 type mockAgentRepository struct {
-	findAllFunc  func(ctx context.Context, filters agent.AgentFilters) ([]agent.Agent, error)
-	findByIDFunc func(ctx context.Context, id string) (*agent.Agent, error)
+	findAllFunc          func(ctx context.Context, filters agent.AgentFilters) ([]agent.Agent, error)
+	findByIDFunc         func(ctx context.Context, id string) (*agent.Agent, error)
+	publicKeyFunc        func(ctx context.Context, agentID string) (string, error)
+	recordHeartbeatFunc  func(ctx context.Context, agentID string, seenAt time.Time) error
+	markStatusFunc       func(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error)
+	findStatusEventsFunc func(ctx context.Context, agentID string, limit int) ([]agent.StatusEvent, error)
+	setAccessFunc        func(ctx context.Context, change agent.AccessChange) error
+	findTagsFunc         func(ctx context.Context, agentID string) ([]agent.AgentTag, error)
+	setTagFunc           func(ctx context.Context, agentID, key, value string) (*agent.AgentTag, error)
+	deleteTagFunc        func(ctx context.Context, agentID, key string) error
+	setDeclaredTagsFunc  func(ctx context.Context, agentID string, tags []agent.AgentTag) error
 }
 
 func (m *mockAgentRepository) Create(ctx context.Context, a *agent.Agent) error {
@@ -61,14 +76,60 @@ func (m *mockAgentRepository) FindAll(ctx context.Context, filters agent.AgentFi
 }
 
 func (m *mockAgentRepository) GetPublicKeyByAgentID(ctx context.Context, agentID string) (string, error) {
+	if m.publicKeyFunc != nil {
+		return m.publicKeyFunc(ctx, agentID)
+	}
 	return "", nil
 }
 
+func (m *mockAgentRepository) GetPublicKeysByAgentID(ctx context.Context, agentID string, at time.Time) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockAgentRepository) GetAccessByAgentID(ctx context.Context, agentID string) (string, error) {
+	return agent.AccessActive, nil
+}
+
+func (m *mockAgentRepository) SetAccess(ctx context.Context, change agent.AccessChange) error {
+	if m.setAccessFunc != nil {
+		return m.setAccessFunc(ctx, change)
+	}
+	return nil
+}
+
+func (m *mockAgentRepository) RotateKey(ctx context.Context, rotation *agent.KeyRotation) error {
+	return nil
+}
+
 func (m *mockAgentRepository) AddTags(ctx context.Context, agentID string, tags []agent.AgentTag) error {
 	return nil
 }
 
-func (m *mockAgentRepository) UpdateTags(ctx context.Context, agentID string, tags []agent.AgentTag) error {
+func (m *mockAgentRepository) FindTags(ctx context.Context, agentID string) ([]agent.AgentTag, error) {
+	if m.findTagsFunc != nil {
+		return m.findTagsFunc(ctx, agentID)
+	}
+	return nil, nil
+}
+
+func (m *mockAgentRepository) SetTag(ctx context.Context, agentID, key, value string) (*agent.AgentTag, error) {
+	if m.setTagFunc != nil {
+		return m.setTagFunc(ctx, agentID, key, value)
+	}
+	return &agent.AgentTag{AgentID: agentID, Key: key, Value: value, Source: agent.TagSourceServer}, nil
+}
+
+func (m *mockAgentRepository) DeleteTag(ctx context.Context, agentID, key string) error {
+	if m.deleteTagFunc != nil {
+		return m.deleteTagFunc(ctx, agentID, key)
+	}
+	return nil
+}
+
+func (m *mockAgentRepository) SetDeclaredTags(ctx context.Context, agentID string, tags []agent.AgentTag) error {
+	if m.setDeclaredTagsFunc != nil {
+		return m.setDeclaredTagsFunc(ctx, agentID, tags)
+	}
 	return nil
 }
 
@@ -76,6 +137,55 @@ func (m *mockAgentRepository) AddRegistration(ctx context.Context, registration
 	return nil
 }
 
+func (m *mockAgentRepository) FindHardwareSnapshot(ctx context.Context, agentID string) (string, error) {
+	return "", nil
+}
+
+func (m *mockAgentRepository) CreatePendingRegistration(ctx context.Context, pending *agent.PendingRegistration) error {
+	return nil
+}
+
+func (m *mockAgentRepository) FindPendingRegistration(ctx context.Context, id string) (*agent.PendingRegistration, error) {
+	return nil, agent.ErrPendingRegistrationNotFound
+}
+
+func (m *mockAgentRepository) FindPendingRegistrationByFingerprint(ctx context.Context, fingerprint string) (*agent.PendingRegistration, error) {
+	return nil, agent.ErrPendingRegistrationNotFound
+}
+
+func (m *mockAgentRepository) FindPendingRegistrations(ctx context.Context, status string) ([]agent.PendingRegistration, error) {
+	return []agent.PendingRegistration{}, nil
+}
+
+func (m *mockAgentRepository) ResolvePendingRegistration(ctx context.Context, pending *agent.PendingRegistration) error {
+	return nil
+}
+
+func (m *mockAgentRepository) RecordHeartbeat(ctx context.Context, agentID string, seenAt time.Time) error {
+	if m.recordHeartbeatFunc != nil {
+		return m.recordHeartbeatFunc(ctx, agentID, seenAt)
+	}
+	return nil
+}
+
+func (m *mockAgentRepository) MarkStatus(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error) {
+	if m.markStatusFunc != nil {
+		return m.markStatusFunc(ctx, from, to, seenBefore, reason)
+	}
+	return nil, nil
+}
+
+func (m *mockAgentRepository) FindStatusEvents(ctx context.Context, agentID string, limit int) ([]agent.StatusEvent, error) {
+	if m.findStatusEventsFunc != nil {
+		return m.findStatusEventsFunc(ctx, agentID, limit)
+	}
+	return nil, nil
+}
+
+func (m *mockAgentRepository) ConsumeEnrollmentToken(ctx context.Context, tokenID string, now time.Time) error {
+	return nil
+}
+
 func (m *mockAgentRepository) Transaction(ctx context.Context, fn func(agent.Repository) error) error {
 	return fn(m)
 }
@@ -435,6 +545,57 @@ func TestAgentController(t *testing.T) {
 			assert.Equal(t, "team", capturedRequest.Tags[2].Key)
 			assert.Equal(t, "platform", capturedRequest.Tags[2].Value)
 		})
+
+		t.Run("should pass the hardware to the service", func(t *testing.T) {
+			var capturedRequest agentService.RegistrationRequest
+			mockSvc := &mockRegistrationService{
+				registerAgentFunc: func(ctx context.Context, req agentService.RegistrationRequest) (*agent.Agent, error) {
+					capturedRequest = req
+					return &agent.Agent{ID: "agt_123456"}, nil
+				},
+			}
+			handler := NewHandler(mockSvc)
+			e := setupEcho()
+
+			body := `{"fingerprint":"fp-new","token_id":"token-123","token_key":"key-456","public_key":"key","public_key_type":"rsa",
+				"hostname":"web-1","machine_id":"machine-1","previous_fingerprint":"fp-old","hardware_info":{"machine-id":"machine-1"}}`
+			req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			require.NoError(t, handler.RegisterAgent(e.NewContext(req, rec)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "web-1", capturedRequest.Hostname)
+			assert.Equal(t, "machine-1", capturedRequest.MachineID)
+			assert.Equal(t, "fp-old", capturedRequest.PreviousFingerprint)
+			assert.JSONEq(t, `{"machine-id":"machine-1"}`, capturedRequest.HardwareInfo)
+		})
+
+		t.Run("should return 202 when the registration is held for approval", func(t *testing.T) {
+			mockSvc := &mockRegistrationService{
+				registerAgentFunc: func(ctx context.Context, req agentService.RegistrationRequest) (*agent.Agent, error) {
+					return nil, &agentService.PendingApprovalError{Registration: &agent.PendingRegistration{
+						ID: "reg_123", Fingerprint: req.Fingerprint, Status: agent.ApprovalPending, CandidateAgentID: "agt_123456",
+					}}
+				},
+			}
+			handler := NewHandler(mockSvc)
+			e := setupEcho()
+
+			body := `{"fingerprint":"fp-clone","token_id":"token-123","token_key":"key-456","public_key":"key","public_key_type":"rsa"}`
+			req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			require.NoError(t, handler.RegisterAgent(e.NewContext(req, rec)))
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			var resp RegistrationResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Empty(t, resp.ID)
+			assert.Equal(t, "fp-clone", resp.Fingerprint)
+			assert.Equal(t, agent.ApprovalPending, resp.Status)
+			assert.Equal(t, "reg_123", resp.RegistrationID)
+		})
 	})
 
 	t.Run("GET /agents", func(t *testing.T) {
@@ -465,6 +626,30 @@ func TestAgentController(t *testing.T) {
 			assert.Len(t, resp, 2)
 		})
 
+		t.Run("should only return agents in a scoped operator's scope", func(t *testing.T) {
+			mockRepo := &mockAgentRepository{
+				findAllFunc: func(ctx context.Context, filters agent.AgentFilters) ([]agent.Agent, error) {
+					return []agent.Agent{
+						{ID: "agt_staging", Tags: []agent.AgentTag{{Key: "env", Value: "staging"}}},
+						{ID: "agt_production", Tags: []agent.AgentTag{{Key: "env", Value: "production"}}},
+					}, nil
+				},
+			}
+
+			e := setupEcho()
+			NewHandlerWithRepo(nil, mockRepo).RegisterListRoutes(e.Group("/agents", operatorauth.New(scopedAuthenticator{})))
+			req := httptest.NewRequest(http.MethodGet, "/agents", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer staging")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			var resp []agent.Agent
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			require.Len(t, resp, 1)
+			assert.Equal(t, "agt_staging", resp[0].ID)
+		})
+
 		t.Run("should filter agents by status", func(t *testing.T) {
 			var capturedFilters agent.AgentFilters
 			mockRepo := &mockAgentRepository{
@@ -610,7 +795,7 @@ func TestAgentController(t *testing.T) {
 			}
 
 			handler := NewHandlerWithRepo(&mockRegistrationService{}, mockRepo)
-			handler.RegisterRoutes(e.Group("/agents"))
+			handler.RegisterReadRoutes(e.Group("/agents/:id"))
 
 			req := httptest.NewRequest(http.MethodGet, "/agents/agt_test123", nil)
 			rec := httptest.NewRecorder()
@@ -638,7 +823,7 @@ func TestAgentController(t *testing.T) {
 			}
 
 			handler := NewHandlerWithRepo(&mockRegistrationService{}, mockRepo)
-			handler.RegisterRoutes(e.Group("/agents"))
+			handler.RegisterReadRoutes(e.Group("/agents/:id"))
 
 			req := httptest.NewRequest(http.MethodGet, "/agents/nonexistent", nil)
 			rec := httptest.NewRecorder()
@@ -656,7 +841,7 @@ func TestAgentController(t *testing.T) {
 			}
 
 			handler := NewHandlerWithRepo(&mockRegistrationService{}, mockRepo)
-			handler.RegisterRoutes(e.Group("/agents"))
+			handler.RegisterReadRoutes(e.Group("/agents/:id"))
 
 			req := httptest.NewRequest(http.MethodGet, "/agents/agt_test123", nil)
 			rec := httptest.NewRecorder()
@@ -667,3 +852,645 @@ func TestAgentController(t *testing.T) {
 	})
 }
 
+// scopedAuthenticator authenticates the token "staging" as a viewer scoped
+// to env=staging
+type scopedAuthenticator struct{}
+
+func (scopedAuthenticator) Authenticate(ctx context.Context, token string) (*operator.Operator, *operator.Token, error) {
+	if token != "staging" {
+		return nil, nil, errors.New("invalid token")
+	}
+	return &operator.Operator{ID: "opr_staging", Role: operator.RoleViewer, Scope: []string{"env=staging"}}, nil, nil
+}
+
+type mockCertIssuer struct {
+	issueFunc func(csrPEM, agentID, agentPublicKey string) (string, error)
+}
+
+func (m *mockCertIssuer) Issue(csrPEM, agentID, agentPublicKey string) (string, error) {
+	return m.issueFunc(csrPEM, agentID, agentPublicKey)
+}
+
+func TestRenewCertificate(t *testing.T) {
+	repo := &mockAgentRepository{
+		publicKeyFunc: func(ctx context.Context, agentID string) (string, error) {
+			return "agent-public-key", nil
+		},
+	}
+
+	renew := func(handler *Handler, pathID, headerID string) *httptest.ResponseRecorder {
+		e := setupEcho()
+		handler.RegisterRenewalRoutes(e.Group("/agents/:id"))
+		body, _ := json.Marshal(CertificateRenewalRequest{CSR: "csr-pem"})
+		req := httptest.NewRequest(http.MethodPost, "/agents/"+pathID+"/certificate", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Agent-ID", headerID)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("issues certificate for the authenticated agent", func(t *testing.T) {
+		issuer := &mockCertIssuer{issueFunc: func(csrPEM, agentID, agentPublicKey string) (string, error) {
+			assert.Equal(t, "csr-pem", csrPEM)
+			assert.Equal(t, "agt_123", agentID)
+			assert.Equal(t, "agent-public-key", agentPublicKey)
+			return "cert-pem", nil
+		}}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo).WithCertificateIssuer(issuer)
+
+		rec := renew(handler, "agt_123", "agt_123")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp CertificateResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "cert-pem", resp.Certificate)
+	})
+
+	t.Run("returns 403 when renewing another agent", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo).WithCertificateIssuer(&mockCertIssuer{})
+
+		rec := renew(handler, "agt_other", "agt_123")
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("returns 400 when CSR key does not match", func(t *testing.T) {
+		issuer := &mockCertIssuer{issueFunc: func(csrPEM, agentID, agentPublicKey string) (string, error) {
+			return "", certauthority.ErrPublicKeyMismatch
+		}}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo).WithCertificateIssuer(issuer)
+
+		rec := renew(handler, "agt_123", "agt_123")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("returns 501 when certificates are disabled", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo)
+
+		rec := renew(handler, "agt_123", "agt_123")
+
+		assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	})
+}
+
+type mockKeyRotator struct {
+	rotateKeyFunc func(ctx context.Context, agentID string, req agentService.KeyRotationRequest) (*agent.Agent, error)
+}
+
+func (m *mockKeyRotator) RotateKey(ctx context.Context, agentID string, req agentService.KeyRotationRequest) (*agent.Agent, error) {
+	return m.rotateKeyFunc(ctx, agentID, req)
+}
+
+func TestRotateKey(t *testing.T) {
+	rotatedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	validUntil := rotatedAt.Add(time.Hour)
+	rotationReq := KeyRotationRequest{
+		PublicKey:     "new-public-key",
+		PublicKeyType: "rsa",
+		Proof:         "proof",
+		Credentials:   []RotatedCredential{{ID: "crd_1", PreviousPasswdEnc: "old-enc", PasswdEnc: "new-enc"}},
+		Secrets:       []RotatedSecret{{ID: "sec_1", PreviousValueEnc: "old-sealed", ValueEnc: "new-sealed"}},
+	}
+
+	rotate := func(handler *Handler, pathID, headerID string, body KeyRotationRequest) *httptest.ResponseRecorder {
+		e := setupEcho()
+		handler.RegisterAgentRoutes(e.Group("/agents/:id"))
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/agents/"+pathID+"/rotate-key", bytes.NewReader(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Agent-ID", headerID)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	rotatorReturning := func(err error) *mockKeyRotator {
+		return &mockKeyRotator{rotateKeyFunc: func(ctx context.Context, agentID string, req agentService.KeyRotationRequest) (*agent.Agent, error) {
+			if err != nil {
+				return nil, err
+			}
+			return &agent.Agent{ID: agentID, KeyRotatedAt: &rotatedAt, PreviousPublicKeyExpiresAt: &validUntil}, nil
+		}}
+	}
+
+	t.Run("rotates the authenticated agent's key", func(t *testing.T) {
+		rotator := &mockKeyRotator{rotateKeyFunc: func(ctx context.Context, agentID string, req agentService.KeyRotationRequest) (*agent.Agent, error) {
+			assert.Equal(t, "agt_123", agentID)
+			assert.Equal(t, "new-public-key", req.PublicKey)
+			assert.Equal(t, "proof", req.Proof)
+			assert.Equal(t, []agentService.RotatedCredential{{ID: "crd_1", PreviousPasswdEnc: "old-enc", PasswdEnc: "new-enc"}}, req.Credentials)
+			assert.Equal(t, []agentService.RotatedSecret{{ID: "sec_1", PreviousValueEnc: "old-sealed", ValueEnc: "new-sealed"}}, req.Secrets)
+			return &agent.Agent{ID: agentID, KeyRotatedAt: &rotatedAt, PreviousPublicKeyExpiresAt: &validUntil}, nil
+		}}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{}).WithKeyRotation(rotator)
+
+		rec := rotate(handler, "agt_123", "agt_123", rotationReq)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp KeyRotationResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.NotNil(t, resp.PreviousKeyValidUntil)
+		assert.True(t, validUntil.Equal(*resp.PreviousKeyValidUntil))
+		assert.Empty(t, resp.Certificate)
+	})
+
+	t.Run("issues a certificate for the new key", func(t *testing.T) {
+		issuer := &mockCertIssuer{issueFunc: func(csrPEM, agentID, agentPublicKey string) (string, error) {
+			assert.Equal(t, "new-public-key", agentPublicKey)
+			return "cert-pem", nil
+		}}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{}).
+			WithKeyRotation(rotatorReturning(nil)).
+			WithCertificateIssuer(issuer)
+		req := rotationReq
+		req.CSR = "csr-pem"
+
+		rec := rotate(handler, "agt_123", "agt_123", req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp KeyRotationResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "cert-pem", resp.Certificate)
+	})
+
+	t.Run("keeps the key when the CSR is rejected", func(t *testing.T) {
+		issuer := &mockCertIssuer{issueFunc: func(csrPEM, agentID, agentPublicKey string) (string, error) {
+			return "", certauthority.ErrPublicKeyMismatch
+		}}
+		rotator := &mockKeyRotator{rotateKeyFunc: func(ctx context.Context, agentID string, req agentService.KeyRotationRequest) (*agent.Agent, error) {
+			t.Fatal("key must not be rotated")
+			return nil, nil
+		}}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{}).
+			WithKeyRotation(rotator).
+			WithCertificateIssuer(issuer)
+		req := rotationReq
+		req.CSR = "csr-pem"
+
+		rec := rotate(handler, "agt_123", "agt_123", req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("returns 403 when rotating another agent", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{}).WithKeyRotation(rotatorReturning(nil))
+
+		rec := rotate(handler, "agt_other", "agt_123", rotationReq)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("maps rotation errors", func(t *testing.T) {
+		for err, code := range map[error]int{
+			agentService.ErrInvalidKeyProof:  http.StatusBadRequest,
+			agentService.ErrInvalidPublicKey: http.StatusBadRequest,
+			agent.ErrKeyChanged:              http.StatusConflict,
+			agent.ErrCredentialsChanged:      http.StatusConflict,
+			agent.ErrSecretsChanged:          http.StatusConflict,
+			agent.ErrAgentNotFound:           http.StatusNotFound,
+		} {
+			handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{}).WithKeyRotation(rotatorReturning(err))
+
+			rec := rotate(handler, "agt_123", "agt_123", rotationReq)
+
+			assert.Equal(t, code, rec.Code, err.Error())
+		}
+	})
+
+	t.Run("returns 501 when key rotation is disabled", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{})
+
+		rec := rotate(handler, "agt_123", "agt_123", rotationReq)
+
+		assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	})
+}
+
+type mockTaskClaimer struct {
+	claimFunc func(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error)
+}
+
+func (m *mockTaskClaimer) Claim(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error) {
+	return m.claimFunc(ctx, agentID, lease)
+}
+
+func TestHeartbeat(t *testing.T) {
+	heartbeat := func(handler *Handler, pathID, headerID string, body ...string) *httptest.ResponseRecorder {
+		e := setupEcho()
+		handler.RegisterHeartbeatRoutes(e.Group("/agents/:id"))
+		req := httptest.NewRequest(http.MethodPost, "/agents/"+pathID+"/heartbeat", strings.NewReader(strings.Join(body, "")))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Agent-ID", headerID)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("records the heartbeat and returns claimed tasks", func(t *testing.T) {
+		var seenAgent string
+		repo := &mockAgentRepository{
+			recordHeartbeatFunc: func(ctx context.Context, agentID string, seenAt time.Time) error {
+				seenAgent = agentID
+				assert.WithinDuration(t, time.Now(), seenAt, time.Minute)
+				return nil
+			},
+		}
+		claimer := &mockTaskClaimer{claimFunc: func(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error) {
+			assert.Equal(t, "agt_123", agentID)
+			assert.Equal(t, 2*time.Minute, lease)
+			return []task.Task{{ID: "tsk_1", Status: task.StatusClaimed}}, nil
+		}}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo).WithTaskClaimer(claimer, 2*time.Minute)
+
+		rec := heartbeat(handler, "agt_123", "agt_123")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "agt_123", seenAgent)
+		var resp HeartbeatResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp.PendingTasks, 1)
+		assert.Equal(t, "tsk_1", resp.PendingTasks[0].ID)
+	})
+
+	t.Run("returns an empty task list without a claimer", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{})
+
+		rec := heartbeat(handler, "agt_123", "agt_123")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"message":"ok","pending_tasks":[]}`, rec.Body.String())
+	})
+
+	t.Run("returns 403 for another agent", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{})
+
+		rec := heartbeat(handler, "agt_other", "agt_123")
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("returns 404 for an unknown agent", func(t *testing.T) {
+		repo := &mockAgentRepository{
+			recordHeartbeatFunc: func(ctx context.Context, agentID string, seenAt time.Time) error {
+				return agent.ErrAgentNotFound
+			},
+		}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo)
+
+		rec := heartbeat(handler, "agt_123", "agt_123")
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("replaces the declared tags the agent sends", func(t *testing.T) {
+		var declared []agent.AgentTag
+		repo := &mockAgentRepository{
+			setDeclaredTagsFunc: func(ctx context.Context, agentID string, tags []agent.AgentTag) error {
+				assert.Equal(t, "agt_123", agentID)
+				declared = tags
+				return nil
+			},
+		}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo)
+
+		rec := heartbeat(handler, "agt_123", "agt_123", `{"declared_tags":[{"key":"role","value":"web"}]}`)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []agent.AgentTag{{Key: "role", Value: "web"}}, declared)
+	})
+
+	t.Run("keeps the declared tags when the agent sends none", func(t *testing.T) {
+		repo := &mockAgentRepository{
+			setDeclaredTagsFunc: func(ctx context.Context, agentID string, tags []agent.AgentTag) error {
+				t.Error("declared tags must not change")
+				return nil
+			},
+		}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo)
+
+		assert.Equal(t, http.StatusOK, heartbeat(handler, "agt_123", "agt_123").Code)
+		assert.Equal(t, http.StatusOK, heartbeat(handler, "agt_123", "agt_123", `{}`).Code)
+
+		e := setupEcho()
+		handler.RegisterHeartbeatRoutes(e.Group("/agents/:id"))
+		req := httptest.NewRequest(http.MethodPost, "/agents/agt_123/heartbeat", strings.NewReader(`{"declared_tags":[]}`))
+		req.Header.Set("X-Agent-ID", "agt_123")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, "a body that is not JSON is ignored")
+	})
+
+	t.Run("returns 400 for a declared tag that is not key=value", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{})
+
+		rec := heartbeat(handler, "agt_123", "agt_123", `{"declared_tags":[{"key":"a=b","value":"web"}]}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestTags(t *testing.T) {
+	serve := func(handler *Handler, method, path, body string) *httptest.ResponseRecorder {
+		e := setupEcho()
+		handler.RegisterAdminRoutes(e.Group("/agents/:id"))
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("lists tags and marks shadowed agent tags", func(t *testing.T) {
+		repo := &mockAgentRepository{findTagsFunc: func(ctx context.Context, agentID string) ([]agent.AgentTag, error) {
+			return []agent.AgentTag{
+				{ID: 1, Key: "env", Value: "prod"},
+				{ID: 2, Key: "env", Value: "dev", Source: agent.TagSourceAgent},
+				{ID: 3, Key: "role", Value: "web", Source: agent.TagSourceAgent},
+			}, nil
+		}}
+
+		rec := serve(NewHandlerWithRepo(&mockRegistrationService{}, repo), http.MethodGet, "/agents/agt_123/tags", "")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[
+			{"key":"env","value":"prod","source":"server"},
+			{"key":"env","value":"dev","source":"agent","shadowed":true},
+			{"key":"role","value":"web","source":"agent"}
+		]`, rec.Body.String())
+	})
+
+	t.Run("sets a server tag", func(t *testing.T) {
+		var set []string
+		repo := &mockAgentRepository{setTagFunc: func(ctx context.Context, agentID, key, value string) (*agent.AgentTag, error) {
+			set = []string{agentID, key, value}
+			return &agent.AgentTag{AgentID: agentID, Key: key, Value: value, Source: agent.TagSourceServer}, nil
+		}}
+
+		rec := serve(NewHandlerWithRepo(&mockRegistrationService{}, repo), http.MethodPut, "/agents/agt_123/tags/env", `{"value":"prod"}`)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"agt_123", "env", "prod"}, set)
+		assert.JSONEq(t, `{"key":"env","value":"prod","source":"server"}`, rec.Body.String())
+	})
+
+	t.Run("returns 400 for a tag that is not key=value", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{})
+
+		for path, body := range map[string]string{
+			"/agents/agt_123/tags/env":  `{"value":"a,b"}`,
+			"/agents/agt_123/tags/a=b":  `{"value":"prod"}`,
+			"/agents/agt_123/tags/role": `{}`,
+		} {
+			rec := serve(handler, http.MethodPut, path, body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+		}
+	})
+
+	t.Run("maps repository errors", func(t *testing.T) {
+		repo := &mockAgentRepository{
+			findTagsFunc: func(ctx context.Context, agentID string) ([]agent.AgentTag, error) {
+				return nil, agent.ErrAgentNotFound
+			},
+			setTagFunc: func(ctx context.Context, agentID, key, value string) (*agent.AgentTag, error) {
+				return nil, agent.ErrAgentNotFound
+			},
+			deleteTagFunc: func(ctx context.Context, agentID, key string) error {
+				return agent.ErrTagNotFound
+			},
+		}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo)
+
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/agents/agt_123/tags", "").Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodPut, "/agents/agt_123/tags/env", `{"value":"prod"}`).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodDelete, "/agents/agt_123/tags/env", "").Code)
+	})
+
+	t.Run("deletes a server tag", func(t *testing.T) {
+		var deleted string
+		repo := &mockAgentRepository{deleteTagFunc: func(ctx context.Context, agentID, key string) error {
+			deleted = key
+			return nil
+		}}
+
+		rec := serve(NewHandlerWithRepo(&mockRegistrationService{}, repo), http.MethodDelete, "/agents/agt_123/tags/env", "")
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "env", deleted)
+	})
+}
+
+func TestAccess(t *testing.T) {
+	setAccess := func(handler *Handler, action, agentID, body string) *httptest.ResponseRecorder {
+		e := setupEcho()
+		handler.RegisterAdminRoutes(e.Group("/agents/:id"))
+		req := httptest.NewRequest(http.MethodPost, "/agents/"+agentID+"/"+action, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("moves the agent to the action's access state", func(t *testing.T) {
+		for action, access := range map[string]string{
+			"quarantine": agent.AccessQuarantined,
+			"release":    agent.AccessActive,
+			"revoke":     agent.AccessRevoked,
+		} {
+			var change agent.AccessChange
+			repo := &mockAgentRepository{setAccessFunc: func(ctx context.Context, c agent.AccessChange) error {
+				change = c
+				return nil
+			}}
+
+			rec := setAccess(NewHandlerWithRepo(&mockRegistrationService{}, repo), action, "agt_123", `{"reason":"host compromised"}`)
+
+			assert.Equal(t, http.StatusOK, rec.Code, action)
+			assert.Equal(t, "agt_123", change.AgentID)
+			assert.Equal(t, access, change.Access, action)
+			assert.Equal(t, "host compromised", change.Reason)
+			var resp AccessResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, access, resp.Access)
+		}
+	})
+
+	t.Run("maps repository errors", func(t *testing.T) {
+		for err, code := range map[error]int{
+			agent.ErrAgentNotFound: http.StatusNotFound,
+			agent.ErrAgentRevoked:  http.StatusConflict,
+		} {
+			repo := &mockAgentRepository{setAccessFunc: func(ctx context.Context, c agent.AccessChange) error {
+				return err
+			}}
+
+			rec := setAccess(NewHandlerWithRepo(&mockRegistrationService{}, repo), "release", "agt_123", `{}`)
+
+			assert.Equal(t, code, rec.Code, err.Error())
+		}
+	})
+}
+
+func TestEvents(t *testing.T) {
+	events := func(handler *Handler, query string) *httptest.ResponseRecorder {
+		e := setupEcho()
+		handler.RegisterReadRoutes(e.Group("/agents/:id"))
+		req := httptest.NewRequest(http.MethodGet, "/agents/agt_123/events"+query, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	found := func(ctx context.Context, id string) (*agent.Agent, error) {
+		return &agent.Agent{ID: id}, nil
+	}
+
+	t.Run("returns the agent's status events", func(t *testing.T) {
+		var capturedLimit int
+		repo := &mockAgentRepository{
+			findByIDFunc: found,
+			findStatusEventsFunc: func(ctx context.Context, agentID string, limit int) ([]agent.StatusEvent, error) {
+				assert.Equal(t, "agt_123", agentID)
+				capturedLimit = limit
+				return []agent.StatusEvent{{AgentID: agentID, From: agent.StatusOnline, To: agent.StatusStale}}, nil
+			},
+		}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo)
+
+		rec := events(handler, "?limit=10")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 10, capturedLimit)
+		var resp []agent.StatusEvent
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp, 1)
+		assert.Equal(t, agent.StatusStale, resp[0].To)
+	})
+
+	t.Run("returns an empty list without events", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{findByIDFunc: found})
+
+		rec := events(handler, "")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[]`, rec.Body.String())
+	})
+
+	t.Run("returns 400 for an invalid limit", func(t *testing.T) {
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, &mockAgentRepository{findByIDFunc: found})
+
+		rec := events(handler, "?limit=zero")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("returns 404 for an unknown agent", func(t *testing.T) {
+		repo := &mockAgentRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*agent.Agent, error) {
+				return nil, errors.New("record not found")
+			},
+		}
+		handler := NewHandlerWithRepo(&mockRegistrationService{}, repo)
+
+		rec := events(handler, "")
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+type mockPublisher struct {
+	events []string
+	data   []any
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, eventType string, data any) error {
+	m.events = append(m.events, eventType)
+	m.data = append(m.data, data)
+	return nil
+}
+
+func TestRegisterAgentPublishesWebhook(t *testing.T) {
+	register := func(handler *Handler) *httptest.ResponseRecorder {
+		e := setupEcho()
+		body, _ := json.Marshal(RegistrationRequest{
+			Fingerprint:   "test-fingerprint",
+			TokenID:       "token-123",
+			TokenKey:      "key-456",
+			PublicKey:     "ssh-rsa AAAAB3...",
+			PublicKeyType: "ssh-rsa",
+		})
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		require.NoError(t, handler.RegisterAgent(e.NewContext(req, rec)))
+		return rec
+	}
+	registered := func(updatedAfter time.Duration) *mockRegistrationService {
+		return &mockRegistrationService{
+			registerAgentFunc: func(ctx context.Context, req agentService.RegistrationRequest) (*agent.Agent, error) {
+				now := time.Now()
+				return &agent.Agent{ID: "agt_123", Fingerprint: req.Fingerprint, CreatedAt: now, UpdatedAt: now.Add(updatedAfter)}, nil
+			},
+		}
+	}
+
+	t.Run("publishes agent.registered for a new agent", func(t *testing.T) {
+		publisher := &mockPublisher{}
+		rec := register(NewHandler(registered(0)).WithPublisher(publisher))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, []string{webhook.EventAgentRegistered}, publisher.events)
+		assert.Equal(t, "agt_123", publisher.data[0].(webhook.AgentData).ID)
+	})
+
+	t.Run("publishes nothing on re-registration", func(t *testing.T) {
+		publisher := &mockPublisher{}
+		rec := register(NewHandler(registered(time.Hour)).WithPublisher(publisher))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, publisher.events)
+	})
+}
+
+func TestReportUpdate(t *testing.T) {
+	report := func(handler *Handler, pathID, headerID, body string) *httptest.ResponseRecorder {
+		e := setupEcho()
+		handler.RegisterAgentRoutes(e.Group("/agents/:id"))
+		req := httptest.NewRequest(http.MethodPost, "/agents/"+pathID+"/update-status", bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Agent-ID", headerID)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("publishes update.rolled_back for a rolled back update", func(t *testing.T) {
+		publisher := &mockPublisher{}
+		handler := NewHandler(&mockRegistrationService{}).WithPublisher(publisher)
+
+		rec := report(handler, "agt_123", "agt_123",
+			`{"update_id":"u1","state":"RolledBack","source_version":"1.0.0","target_version":"1.1.0","error":"health check failed"}`)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		require.Equal(t, []string{webhook.EventUpdateRolledBack}, publisher.events)
+		data := publisher.data[0].(webhook.UpdateData)
+		assert.Equal(t, "agt_123", data.AgentID)
+		assert.Equal(t, "1.1.0", data.TargetVersion)
+		assert.Equal(t, "health check failed", data.Error)
+	})
+
+	t.Run("publishes nothing for other states", func(t *testing.T) {
+		publisher := &mockPublisher{}
+		handler := NewHandler(&mockRegistrationService{}).WithPublisher(publisher)
+
+		rec := report(handler, "agt_123", "agt_123", `{"state":"Completed"}`)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, publisher.events)
+	})
+
+	t.Run("returns 403 for another agent", func(t *testing.T) {
+		rec := report(NewHandler(&mockRegistrationService{}), "agt_other", "agt_123", `{"state":"RolledBack"}`)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
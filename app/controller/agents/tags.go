@@ -0,0 +1,144 @@
+package agents
+
+import (
+	"errors"
+	"hostlink/app/middleware/auditlog"
+	"hostlink/domain/agent"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// TagRequest sets the value of a server tag
+	TagRequest struct {
+		Value string `json:"value" validate:"required"`
+	}
+
+	// AgentTagResponse is one of an agent's tags. Shadowed marks an agent
+	// tag hidden by a server tag with the same key.
+	AgentTagResponse struct {
+		Key      string `json:"key"`
+		Value    string `json:"value"`
+		Source   string `json:"source"`
+		Shadowed bool   `json:"shadowed,omitempty"`
+	}
+)
+
+// Tags lists every tag of the agent, the agent tags a server tag shadows
+// included.
+func (h *Handler) Tags(c echo.Context) error {
+	tags, err := h.agentRepo.FindTags(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, agent.ErrAgentNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Agent not found",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch tags: " + err.Error(),
+		})
+	}
+
+	effective := make(map[uint]bool, len(tags))
+	for _, tag := range agent.EffectiveTags(tags) {
+		effective[tag.ID] = true
+	}
+	response := make([]AgentTagResponse, len(tags))
+	for i, tag := range tags {
+		response[i] = AgentTagResponse{
+			Key:      tag.Key,
+			Value:    tag.Value,
+			Source:   tagSource(tag.Source),
+			Shadowed: !effective[tag.ID],
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// SetTag sets the agent's server tag with the key in the path. The agent
+// cannot change it, and it shadows the agent's own tag with that key.
+func (h *Handler) SetTag(c echo.Context) error {
+	var req TagRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Validation failed: " + err.Error(),
+		})
+	}
+
+	agentID := c.Param("id")
+	key := c.Param("key")
+	entry := auditlog.EntryFrom(c)
+	entry.Target = agentID
+	entry.SetDetail(map[string]string{"key": key, "value": req.Value})
+	if err := agent.ValidateTag(key, req.Value); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	tag, err := h.agentRepo.SetTag(c.Request().Context(), agentID, key, req.Value)
+	if errors.Is(err, agent.ErrAgentNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Agent not found",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to set tag: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, AgentTagResponse{Key: tag.Key, Value: tag.Value, Source: agent.TagSourceServer})
+}
+
+// DeleteTag removes the agent's server tag with the key in the path. An
+// agent tag it shadowed takes effect again; agent tags themselves are only
+// changed by the agent.
+func (h *Handler) DeleteTag(c echo.Context) error {
+	agentID := c.Param("id")
+	key := c.Param("key")
+	entry := auditlog.EntryFrom(c)
+	entry.Target = agentID
+	entry.SetDetail(map[string]string{"key": key})
+
+	err := h.agentRepo.DeleteTag(c.Request().Context(), agentID, key)
+	if errors.Is(err, agent.ErrTagNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Tag not found",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to delete tag: " + err.Error(),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// declaredTags converts the tags an agent declares, rejecting any that
+// cannot be written as key=value
+func declaredTags(pairs []TagPair) ([]agent.AgentTag, error) {
+	tags := make([]agent.AgentTag, 0, len(pairs))
+	for _, pair := range pairs {
+		if err := agent.ValidateTag(pair.Key, pair.Value); err != nil {
+			return nil, err
+		}
+		tags = append(tags, agent.AgentTag{Key: pair.Key, Value: pair.Value})
+	}
+	return tags, nil
+}
+
+// tagSource returns the source of a tag, which is the server when none was
+// recorded
+func tagSource(source string) string {
+	if source == "" {
+		return agent.TagSourceServer
+	}
+	return source
+}
@@ -0,0 +1,155 @@
+// Package audits queries, exports and verifies the audit log.
+package audits
+
+import (
+	"encoding/json"
+	"fmt"
+	auditService "hostlink/app/service/audit"
+	"hostlink/domain/audit"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultLimit caps the entries returned without a limit, and maxLimit
+	// caps a requested one.
+	defaultLimit = 100
+	maxLimit     = 1000
+	// exportBatchSize is how many entries Export reads at a time.
+	exportBatchSize = 500
+)
+
+type Handler struct {
+	repo    audit.Repository
+	service *auditService.Service
+}
+
+func NewHandler(repo audit.Repository, service *auditService.Service) *Handler {
+	return &Handler{repo: repo, service: service}
+}
+
+// Index lists entries newest first. It filters by the actor, action,
+// target, outcome, since and until query parameters; before takes the
+// sequence of the last entry of the previous page.
+func (h *Handler) Index(c echo.Context) error {
+	filters, err := parseFilters(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	filters.Limit = defaultLimit
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "limit must be a positive integer",
+			})
+		}
+		filters.Limit = min(parsed, maxLimit)
+	}
+	if raw := c.QueryParam("before"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "before must be a positive sequence",
+			})
+		}
+		filters.BeforeSequence = parsed
+	}
+
+	entries, err := h.repo.Find(c.Request().Context(), filters)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch audit log: " + err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// Export streams every matching entry oldest first as JSON lines, with the
+// same filters as Index. An unfiltered export can be verified offline.
+func (h *Handler) Export(c echo.Context) error {
+	filters, err := parseFilters(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	filters.Ascending = true
+	filters.Limit = exportBatchSize
+
+	ctx := c.Request().Context()
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="audit.jsonl"`)
+	res.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(res)
+	for {
+		entries, err := h.repo.Find(ctx, filters)
+		if err != nil {
+			// The status is already sent; a truncated export fails to
+			// verify, so the error is only logged
+			c.Logger().Errorf("failed to export audit log: %v", err)
+			return nil
+		}
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return nil
+			}
+		}
+		if len(entries) < filters.Limit {
+			return nil
+		}
+		filters.AfterSequence = entries[len(entries)-1].Sequence
+		res.Flush()
+	}
+}
+
+// Verify checks the hash chain of the whole log.
+func (h *Handler) Verify(c echo.Context) error {
+	result, err := h.service.Verify(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to verify audit log: " + err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func parseFilters(c echo.Context) (audit.Filters, error) {
+	filters := audit.Filters{
+		ActorID: c.QueryParam("actor"),
+		Action:  c.QueryParam("action"),
+		Target:  c.QueryParam("target"),
+		Outcome: c.QueryParam("outcome"),
+	}
+	var err error
+	if filters.Since, err = timeParam(c, "since"); err != nil {
+		return filters, err
+	}
+	if filters.Until, err = timeParam(c, "until"); err != nil {
+		return filters, err
+	}
+	return filters, nil
+}
+
+func timeParam(c echo.Context, name string) (*time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %w", name, err)
+	}
+	return &parsed, nil
+}
+
+// RegisterRoutes registers the audit log endpoints.
+func (h *Handler) RegisterRoutes(g *echo.Group) {
+	g.GET("", h.Index)
+	g.GET("/export", h.Export)
+	g.GET("/verify", h.Verify)
+}
@@ -0,0 +1,217 @@
+// Package credentials manages the database credentials each agent collects
+// metrics with. Passwords are sealed in an envelope for the agent's public
+// key and bound to the credential, so only the agent can read them.
+package credentials
+
+import (
+	"errors"
+	"hostlink/app/middleware/auditlog"
+	"hostlink/domain/agent"
+	"hostlink/domain/credential"
+	"hostlink/internal/crypto"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type (
+	Handler struct {
+		repo      credential.Repository
+		agentRepo agent.Repository
+	}
+	CredentialRequest struct {
+		Dialect       string  `json:"dialect" validate:"required"`
+		Host          string  `json:"host"`
+		Port          int     `json:"port"`
+		Username      string  `json:"username"`
+		Database      string  `json:"database"`
+		Password      *string `json:"password"`
+		DataDirectory string  `json:"data_directory"`
+	}
+)
+
+func NewHandler(repo credential.Repository, agentRepo agent.Repository) *Handler {
+	return &Handler{repo: repo, agentRepo: agentRepo}
+}
+
+// Index lists an agent's credentials. An authenticated agent may only list
+// its own.
+func (h *Handler) Index(c echo.Context) error {
+	agentID := c.Param("id")
+	if header := c.Request().Header.Get("X-Agent-ID"); header != "" && header != agentID {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Agent ID does not match authenticated agent",
+		})
+	}
+
+	credentials, err := h.repo.FindAll(c.Request().Context(), credential.CredentialFilters{AgentID: &agentID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch credentials: " + err.Error(),
+		})
+	}
+	if credentials == nil {
+		credentials = []credential.Credential{}
+	}
+
+	return c.JSON(http.StatusOK, credentials)
+}
+
+func (h *Handler) Create(c echo.Context) error {
+	var req CredentialRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Validation failed: " + err.Error(),
+		})
+	}
+
+	auditCredential(c, req)
+
+	agentID := c.Param("id")
+	if _, err := h.agentRepo.FindByID(c.Request().Context(), agentID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Agent not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch agent: " + err.Error(),
+		})
+	}
+
+	cred := &credential.Credential{ID: credential.NewID(), AgentID: agentID}
+	if err := h.apply(c, cred, req); err != nil {
+		return c.JSON(err.status, map[string]string{"error": err.message})
+	}
+
+	if err := h.repo.Create(c.Request().Context(), cred); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to create credential: " + err.Error(),
+		})
+	}
+
+	auditlog.EntryFrom(c).Target = cred.ID
+	return c.JSON(http.StatusCreated, cred)
+}
+
+// Update replaces a credential. A request without a password keeps the
+// stored one.
+func (h *Handler) Update(c echo.Context) error {
+	var req CredentialRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Validation failed: " + err.Error(),
+		})
+	}
+
+	auditCredential(c, req)
+	auditlog.EntryFrom(c).Target = c.Param("credential_id")
+
+	ctx := c.Request().Context()
+	cred, err := h.repo.FindByID(ctx, c.Param("credential_id"))
+	if errors.Is(err, credential.ErrCredentialNotFound) || (err == nil && cred.AgentID != c.Param("id")) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Credential not found",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch credential: " + err.Error(),
+		})
+	}
+
+	if err := h.apply(c, cred, req); err != nil {
+		return c.JSON(err.status, map[string]string{"error": err.message})
+	}
+
+	if err := h.repo.Update(ctx, cred); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to update credential: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, cred)
+}
+
+// auditCredential describes the change for the audit log, leaving out the
+// password.
+func auditCredential(c echo.Context, req CredentialRequest) {
+	auditlog.EntryFrom(c).SetDetail(map[string]any{
+		"agent_id":         c.Param("id"),
+		"dialect":          req.Dialect,
+		"host":             req.Host,
+		"username":         req.Username,
+		"database":         req.Database,
+		"password_changed": req.Password != nil,
+	})
+}
+
+// applyError is a failure to apply a request, with the status to answer.
+type applyError struct {
+	status  int
+	message string
+}
+
+// apply copies the request onto cred, sealing a new password for the
+// credential's agent.
+func (h *Handler) apply(c echo.Context, cred *credential.Credential, req CredentialRequest) *applyError {
+	if req.Password != nil {
+		passwdEnc, err := h.encryptPassword(c, cred, *req.Password)
+		if err != nil {
+			return err
+		}
+		cred.PasswdEnc = passwdEnc
+	}
+
+	cred.Dialect = req.Dialect
+	cred.Host = req.Host
+	cred.Port = req.Port
+	cred.Username = req.Username
+	cred.Database = req.Database
+	cred.DataDirectory = req.DataDirectory
+	return nil
+}
+
+func (h *Handler) encryptPassword(c echo.Context, cred *credential.Credential, password string) (string, *applyError) {
+	if password == "" {
+		return "", nil
+	}
+
+	publicKeyBase64, err := h.agentRepo.GetPublicKeyByAgentID(c.Request().Context(), cred.AgentID)
+	if err != nil {
+		return "", &applyError{http.StatusNotFound, "Agent not found"}
+	}
+	publicKey, err := crypto.ParsePublicKeyBase64(publicKeyBase64)
+	if err != nil {
+		return "", &applyError{http.StatusUnprocessableEntity, "Agent public key is unusable: " + err.Error()}
+	}
+	passwdEnc, err := crypto.SealEnvelope([]byte(password), publicKey, credential.EnvelopeContext(cred.AgentID, cred.ID)...)
+	if err != nil {
+		return "", &applyError{http.StatusInternalServerError, "Failed to encrypt password: " + err.Error()}
+	}
+	return passwdEnc, nil
+}
+
+// RegisterAgentRoutes registers the endpoint an authenticated agent reads
+// its credentials from. The group is expected to be mounted at /:id.
+func (h *Handler) RegisterAgentRoutes(g *echo.Group) {
+	g.GET("/credentials", h.Index)
+}
+
+// RegisterRoutes registers credential management on a group mounted at /:id
+func (h *Handler) RegisterRoutes(g *echo.Group) {
+	g.GET("/credentials", h.Index)
+	g.POST("/credentials", h.Create)
+	g.PUT("/credentials/:credential_id", h.Update)
+}
@@ -0,0 +1,236 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hostlink/domain/agent"
+	"hostlink/domain/credential"
+	"hostlink/internal/crypto"
+	"hostlink/internal/validator"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type mockCredentialRepository struct {
+	createFunc   func(ctx context.Context, c *credential.Credential) error
+	findAllFunc  func(ctx context.Context, filters credential.CredentialFilters) ([]credential.Credential, error)
+	findByIDFunc func(ctx context.Context, id string) (*credential.Credential, error)
+	updateFunc   func(ctx context.Context, c *credential.Credential) error
+}
+
+func (m *mockCredentialRepository) Create(ctx context.Context, c *credential.Credential) error {
+	if m.createFunc != nil {
+		return m.createFunc(ctx, c)
+	}
+	c.ID = "crd_test"
+	return nil
+}
+
+func (m *mockCredentialRepository) FindAll(ctx context.Context, filters credential.CredentialFilters) ([]credential.Credential, error) {
+	if m.findAllFunc != nil {
+		return m.findAllFunc(ctx, filters)
+	}
+	return nil, nil
+}
+
+func (m *mockCredentialRepository) FindByID(ctx context.Context, id string) (*credential.Credential, error) {
+	if m.findByIDFunc != nil {
+		return m.findByIDFunc(ctx, id)
+	}
+	return nil, credential.ErrCredentialNotFound
+}
+
+func (m *mockCredentialRepository) Update(ctx context.Context, c *credential.Credential) error {
+	if m.updateFunc != nil {
+		return m.updateFunc(ctx, c)
+	}
+	return nil
+}
+
+// mockAgentRepository implements the agent lookups the handler uses; any
+// other method panics through the nil embedded interface.
+type mockAgentRepository struct {
+	agent.Repository
+	publicKey string
+}
+
+func (m *mockAgentRepository) FindByID(ctx context.Context, id string) (*agent.Agent, error) {
+	if id != "agt_123" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &agent.Agent{ID: id, PublicKey: m.publicKey}, nil
+}
+
+func (m *mockAgentRepository) GetPublicKeyByAgentID(ctx context.Context, agentID string) (string, error) {
+	if agentID != "agt_123" {
+		return "", gorm.ErrRecordNotFound
+	}
+	return m.publicKey, nil
+}
+
+func serve(handler *Handler, method, path, agentHeader string, body any) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Validator = validator.New()
+	handler.RegisterRoutes(e.Group("/agents/:id"))
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if agentHeader != "" {
+		req.Header.Set("X-Agent-ID", agentHeader)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCredentials(t *testing.T) {
+	privateKey, err := crypto.GenerateRSAKeypair(2048)
+	require.NoError(t, err)
+	publicKey, err := crypto.GetPublicKeyBase64(privateKey)
+	require.NoError(t, err)
+	agents := &mockAgentRepository{publicKey: publicKey}
+	password := "s3cret"
+
+	t.Run("Create encrypts the password for the agent", func(t *testing.T) {
+		var created *credential.Credential
+		repo := &mockCredentialRepository{createFunc: func(ctx context.Context, c *credential.Credential) error {
+			created = c
+			return nil
+		}}
+
+		rec := serve(NewHandler(repo, agents), http.MethodPost, "/agents/agt_123/credentials", "", CredentialRequest{
+			Dialect:  "postgresql",
+			Host:     "localhost",
+			Port:     5432,
+			Username: "postgres",
+			Password: &password,
+		})
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		require.NotNil(t, created)
+		assert.Equal(t, "agt_123", created.AgentID)
+		assert.Nil(t, created.Password)
+		assert.True(t, crypto.IsEnvelope(created.PasswdEnc))
+		decrypted, err := crypto.OpenEnvelope(created.PasswdEnc, privateKey, credential.EnvelopeContext("agt_123", created.ID)...)
+		require.NoError(t, err)
+		assert.Equal(t, password, string(decrypted))
+		_, err = crypto.OpenEnvelope(created.PasswdEnc, privateKey, credential.EnvelopeContext("agt_123", "crd_other")...)
+		assert.Error(t, err, "the password is bound to its credential")
+		assert.NotContains(t, rec.Body.String(), password)
+	})
+
+	t.Run("Create seals the password for an Ed25519 agent", func(t *testing.T) {
+		agentKey, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+		require.NoError(t, err)
+		agentPublicKey, err := crypto.PublicKeyBase64(agentKey)
+		require.NoError(t, err)
+		var created *credential.Credential
+		repo := &mockCredentialRepository{createFunc: func(ctx context.Context, c *credential.Credential) error {
+			created = c
+			return nil
+		}}
+
+		rec := serve(NewHandler(repo, &mockAgentRepository{publicKey: agentPublicKey}), http.MethodPost, "/agents/agt_123/credentials", "", CredentialRequest{
+			Dialect:  "postgresql",
+			Password: &password,
+		})
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		require.NotNil(t, created)
+		decrypted, err := crypto.OpenEnvelope(created.PasswdEnc, agentKey, credential.EnvelopeContext("agt_123", created.ID)...)
+		require.NoError(t, err)
+		assert.Equal(t, password, string(decrypted))
+	})
+
+	t.Run("Create returns 404 for an unknown agent", func(t *testing.T) {
+		rec := serve(NewHandler(&mockCredentialRepository{}, agents), http.MethodPost, "/agents/agt_missing/credentials", "", CredentialRequest{
+			Dialect: "mysql",
+		})
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Create returns 400 without dialect", func(t *testing.T) {
+		rec := serve(NewHandler(&mockCredentialRepository{}, agents), http.MethodPost, "/agents/agt_123/credentials", "", CredentialRequest{})
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Update keeps the stored password when none is given", func(t *testing.T) {
+		var updated *credential.Credential
+		repo := &mockCredentialRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*credential.Credential, error) {
+				return &credential.Credential{ID: id, AgentID: "agt_123", Dialect: "postgresql", PasswdEnc: "old-enc"}, nil
+			},
+			updateFunc: func(ctx context.Context, c *credential.Credential) error {
+				updated = c
+				return nil
+			},
+		}
+
+		rec := serve(NewHandler(repo, agents), http.MethodPut, "/agents/agt_123/credentials/crd_1", "", CredentialRequest{
+			Dialect: "postgresql",
+			Host:    "db.internal",
+		})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, updated)
+		assert.Equal(t, "db.internal", updated.Host)
+		assert.Equal(t, "old-enc", updated.PasswdEnc)
+	})
+
+	t.Run("Update returns 404 for another agent's credential", func(t *testing.T) {
+		repo := &mockCredentialRepository{findByIDFunc: func(ctx context.Context, id string) (*credential.Credential, error) {
+			return &credential.Credential{ID: id, AgentID: "agt_other"}, nil
+		}}
+
+		rec := serve(NewHandler(repo, agents), http.MethodPut, "/agents/agt_123/credentials/crd_1", "", CredentialRequest{
+			Dialect: "postgresql",
+		})
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Index returns the agent's credentials", func(t *testing.T) {
+		repo := &mockCredentialRepository{findAllFunc: func(ctx context.Context, filters credential.CredentialFilters) ([]credential.Credential, error) {
+			require.NotNil(t, filters.AgentID)
+			assert.Equal(t, "agt_123", *filters.AgentID)
+			return []credential.Credential{{ID: "crd_1", AgentID: "agt_123", PasswdEnc: "enc"}}, nil
+		}}
+
+		rec := serve(NewHandler(repo, agents), http.MethodGet, "/agents/agt_123/credentials", "agt_123", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var got []credential.Credential
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		require.Len(t, got, 1)
+		assert.Equal(t, "enc", got[0].PasswdEnc)
+	})
+
+	t.Run("Index returns an empty list when there are none", func(t *testing.T) {
+		rec := serve(NewHandler(&mockCredentialRepository{}, agents), http.MethodGet, "/agents/agt_123/credentials", "agt_123", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[]`, rec.Body.String())
+	})
+
+	t.Run("Index returns 403 for another agent", func(t *testing.T) {
+		rec := serve(NewHandler(&mockCredentialRepository{}, agents), http.MethodGet, "/agents/agt_other/credentials", "agt_123", nil)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -0,0 +1,134 @@
+// Package enrollmenttokens manages the tokens agents register with.
+package enrollmenttokens
+
+import (
+	"errors"
+	"hostlink/app/middleware/auditlog"
+	"hostlink/app/middleware/operatorauth"
+	enrollmentService "hostlink/app/service/enrollment"
+	"hostlink/domain/enrollment"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	Handler struct {
+		service *enrollmentService.Service
+	}
+	// TokenRequest creates a token. Tags are key=value and are applied to
+	// every agent registering with the token. A zero MaxUses is unlimited;
+	// ExpiresIn is a duration such as 72h, and empty never expires.
+	TokenRequest struct {
+		Name      string   `json:"name" validate:"required"`
+		Tags      []string `json:"tags"`
+		MaxUses   int      `json:"max_uses"`
+		ExpiresIn string   `json:"expires_in"`
+	}
+	// CreatedToken is a new token with its key, which is not shown again.
+	CreatedToken struct {
+		enrollment.Token
+		Key string `json:"key"`
+	}
+)
+
+func NewHandler(service *enrollmentService.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// Create adds a token and returns its key, which is not shown again.
+func (h *Handler) Create(c echo.Context) error {
+	var req TokenRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+	entry := auditlog.EntryFrom(c)
+	entry.SetDetail(req)
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		parsed, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "expires_in must be a positive duration",
+			})
+		}
+		ttl = parsed
+	}
+	if req.MaxUses < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "max_uses must not be negative",
+		})
+	}
+
+	var createdBy string
+	if o := operatorauth.FromContext(c); o != nil {
+		createdBy = o.Name
+	}
+
+	key, token, err := h.service.Create(c.Request().Context(), req.Name, req.Tags, req.MaxUses, ttl, createdBy)
+	if errors.Is(err, enrollment.ErrInvalidTag) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to create token: " + err.Error(),
+		})
+	}
+
+	entry.Target = token.ID
+	return c.JSON(http.StatusCreated, CreatedToken{Token: *token, Key: key})
+}
+
+// Index lists tokens, newest first, without their keys.
+func (h *Handler) Index(c echo.Context) error {
+	tokens, err := h.service.List(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch tokens: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+func (h *Handler) Show(c echo.Context) error {
+	token, err := h.service.Find(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, enrollment.ErrTokenNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Token not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch token: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, token)
+}
+
+// Revoke stops the token from enrolling further agents.
+func (h *Handler) Revoke(c echo.Context) error {
+	err := h.service.Revoke(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, enrollment.ErrTokenNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Token not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to revoke token: " + err.Error(),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegisterRoutes registers enrollment token management.
+func (h *Handler) RegisterRoutes(g *echo.Group) {
+	g.POST("", h.Create)
+	g.GET("", h.Index)
+	g.GET("/:id", h.Show)
+	g.DELETE("/:id", h.Revoke)
+}
@@ -0,0 +1,119 @@
+package enrollmenttokens
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	enrollmentService "hostlink/app/service/enrollment"
+	"hostlink/domain/enrollment"
+	gormRepo "hostlink/internal/repository/gorm"
+	"hostlink/internal/validator"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type testEnv struct {
+	echo    *echo.Echo
+	service *enrollmentService.Service
+}
+
+func setup(t *testing.T) *testEnv {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&enrollment.Token{}))
+
+	service := enrollmentService.NewService(gormRepo.NewEnrollmentRepository(db))
+	e := echo.New()
+	e.Validator = validator.New()
+	NewHandler(service).RegisterRoutes(e.Group("/enrollment-tokens"))
+	return &testEnv{echo: e, service: service}
+}
+
+func (env *testEnv) serve(method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	env.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCreate(t *testing.T) {
+	t.Run("returns the key once", func(t *testing.T) {
+		env := setup(t)
+
+		rec := env.serve(http.MethodPost, "/enrollment-tokens", `{"name":"staging","tags":["env=staging"],"max_uses":10,"expires_in":"72h"}`)
+
+		require.Equal(t, http.StatusCreated, rec.Code)
+		var resp CreatedToken
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.True(t, strings.HasPrefix(resp.ID, "enr_"))
+		assert.True(t, strings.HasPrefix(resp.Key, enrollment.KeyPrefix))
+		assert.Equal(t, []string{"env=staging"}, resp.Tags)
+		assert.Equal(t, 10, resp.MaxUses)
+		assert.NotNil(t, resp.ExpiresAt)
+
+		rec = env.serve(http.MethodGet, "/enrollment-tokens/"+resp.ID, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), resp.Key)
+		assert.NotContains(t, rec.Body.String(), "key_hash")
+	})
+
+	t.Run("rejects bad input", func(t *testing.T) {
+		env := setup(t)
+
+		for _, body := range []string{
+			`{"tags":["env=staging"]}`,
+			`{"name":"staging","tags":["staging"]}`,
+			`{"name":"staging","max_uses":-1}`,
+			`{"name":"staging","expires_in":"soon"}`,
+		} {
+			rec := env.serve(http.MethodPost, "/enrollment-tokens", body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		}
+	})
+}
+
+func TestIndex(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+	_, _, err := env.service.Create(ctx, "first", nil, 0, 0, "")
+	require.NoError(t, err)
+	_, _, err = env.service.Create(ctx, "second", nil, 0, 0, "")
+	require.NoError(t, err)
+
+	rec := env.serve(http.MethodGet, "/enrollment-tokens", "")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var tokens []enrollment.Token
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tokens))
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "second", tokens[0].Name)
+}
+
+func TestRevoke(t *testing.T) {
+	env := setup(t)
+	_, token, err := env.service.Create(context.Background(), "staging", nil, 0, 0, "")
+	require.NoError(t, err)
+
+	rec := env.serve(http.MethodDelete, "/enrollment-tokens/"+token.ID, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	found, err := env.service.Find(context.Background(), token.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, found.RevokedAt)
+
+	rec = env.serve(http.MethodDelete, "/enrollment-tokens/enr_missing", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = env.serve(http.MethodGet, "/enrollment-tokens/enr_missing", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
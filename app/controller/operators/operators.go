@@ -0,0 +1,239 @@
+// Package operators manages operators and their API tokens.
+package operators
+
+import (
+	"errors"
+	"hostlink/app/middleware/auditlog"
+	"hostlink/app/middleware/operatorauth"
+	operatorService "hostlink/app/service/operator"
+	"hostlink/domain/operator"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	Handler struct {
+		service *operatorService.Service
+		repo    operator.Repository
+	}
+	// OperatorRequest creates an operator. Scope limits it to agents
+	// carrying every key=value tag.
+	OperatorRequest struct {
+		Name  string   `json:"name" validate:"required"`
+		Role  string   `json:"role" validate:"required"`
+		Scope []string `json:"scope"`
+	}
+	// OperatorUpdateRequest changes the fields that are set.
+	OperatorUpdateRequest struct {
+		Role     *string  `json:"role"`
+		Scope    []string `json:"scope"`
+		Disabled *bool    `json:"disabled"`
+	}
+	// TokenRequest issues a token. ExpiresIn is a duration such as 720h;
+	// empty never expires.
+	TokenRequest struct {
+		Name      string `json:"name"`
+		ExpiresIn string `json:"expires_in"`
+	}
+	// IssuedToken is a new token with its plaintext, which is not shown
+	// again.
+	IssuedToken struct {
+		operator.Token
+		Secret string `json:"token"`
+	}
+)
+
+func NewHandler(service *operatorService.Service, repo operator.Repository) *Handler {
+	return &Handler{service: service, repo: repo}
+}
+
+func (h *Handler) Create(c echo.Context) error {
+	var req OperatorRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+	entry := auditlog.EntryFrom(c)
+	entry.SetDetail(req)
+
+	o, err := h.service.Create(c.Request().Context(), req.Name, req.Role, req.Scope)
+	if errors.Is(err, operator.ErrOperatorExists) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	entry.Target = o.ID
+	return c.JSON(http.StatusCreated, o)
+}
+
+func (h *Handler) Index(c echo.Context) error {
+	operators, err := h.repo.FindOperators(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch operators: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, operators)
+}
+
+func (h *Handler) Show(c echo.Context) error {
+	o, err := h.find(c)
+	if err != nil || o == nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, o)
+}
+
+// Me returns the operator whose token authenticated the request.
+func (h *Handler) Me(c echo.Context) error {
+	o := operatorauth.FromContext(c)
+	if o == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "No operator token presented"})
+	}
+
+	return c.JSON(http.StatusOK, o)
+}
+
+func (h *Handler) Update(c echo.Context) error {
+	var req OperatorUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	auditlog.EntryFrom(c).SetDetail(req)
+
+	o, err := h.find(c)
+	if err != nil || o == nil {
+		return err
+	}
+
+	if req.Role != nil {
+		o.Role = *req.Role
+	}
+	if req.Scope != nil {
+		o.Scope = req.Scope
+	}
+	if req.Disabled != nil {
+		o.Disabled = *req.Disabled
+	}
+	if err := operatorService.Validate(o.Role, o.Scope); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.repo.UpdateOperator(c.Request().Context(), o); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to update operator: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, o)
+}
+
+// CreateToken issues a token for the operator and returns its plaintext,
+// which is not shown again.
+func (h *Handler) CreateToken(c echo.Context) error {
+	var req TokenRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	entry := auditlog.EntryFrom(c)
+	entry.SetDetail(req)
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		parsed, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "expires_in must be a positive duration",
+			})
+		}
+		ttl = parsed
+	}
+
+	o, err := h.find(c)
+	if err != nil || o == nil {
+		return err
+	}
+
+	plaintext, token, err := h.service.IssueToken(c.Request().Context(), o.ID, req.Name, ttl)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to issue token: " + err.Error(),
+		})
+	}
+
+	entry.SetDetail(map[string]string{"token_id": token.ID, "name": req.Name, "expires_in": req.ExpiresIn})
+	return c.JSON(http.StatusCreated, IssuedToken{Token: *token, Secret: plaintext})
+}
+
+// Tokens lists the operator's tokens, newest first, without their
+// plaintext.
+func (h *Handler) Tokens(c echo.Context) error {
+	o, err := h.find(c)
+	if err != nil || o == nil {
+		return err
+	}
+
+	tokens, err := h.repo.FindTokens(c.Request().Context(), o.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch tokens: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+func (h *Handler) RevokeToken(c echo.Context) error {
+	auditlog.EntryFrom(c).SetDetail(map[string]string{"token_id": c.Param("token_id")})
+	err := h.repo.RevokeToken(c.Request().Context(), c.Param("id"), c.Param("token_id"), time.Now().UTC())
+	if errors.Is(err, operator.ErrTokenNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Token not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to revoke token: " + err.Error(),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// find loads the operator named by the id parameter. When it returns a nil
+// operator, the error response has already been written.
+func (h *Handler) find(c echo.Context) (*operator.Operator, error) {
+	o, err := h.repo.FindOperator(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, operator.ErrOperatorNotFound) {
+		return nil, c.JSON(http.StatusNotFound, map[string]string{"error": "Operator not found"})
+	}
+	if err != nil {
+		return nil, c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch operator: " + err.Error(),
+		})
+	}
+	return o, nil
+}
+
+// RegisterRoutes registers operator and token management.
+func (h *Handler) RegisterRoutes(g *echo.Group) {
+	g.POST("", h.Create)
+	g.GET("", h.Index)
+	g.GET("/:id", h.Show)
+	g.PUT("/:id", h.Update)
+	g.POST("/:id/tokens", h.CreateToken)
+	g.GET("/:id/tokens", h.Tokens)
+	g.DELETE("/:id/tokens/:token_id", h.RevokeToken)
+}
+
+// RegisterSelfRoutes registers the endpoint any operator reads its own
+// identity from, on a group mounted next to RegisterRoutes.
+func (h *Handler) RegisterSelfRoutes(g *echo.Group) {
+	g.GET("/me", h.Me)
+}
@@ -0,0 +1,149 @@
+package operators
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hostlink/app/middleware/operatorauth"
+	operatorService "hostlink/app/service/operator"
+	"hostlink/domain/operator"
+	gormRepo "hostlink/internal/repository/gorm"
+	"hostlink/internal/validator"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type testEnv struct {
+	echo    *echo.Echo
+	service *operatorService.Service
+	repo    operator.Repository
+}
+
+func setup(t *testing.T) *testEnv {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&operator.Operator{}, &operator.Token{}))
+
+	repo := gormRepo.NewOperatorRepository(db)
+	service := operatorService.NewService(repo)
+	handler := NewHandler(service, repo)
+
+	e := echo.New()
+	e.Validator = validator.New()
+	auth := operatorauth.NewWithConfig(service, operatorauth.Config{})
+	handler.RegisterRoutes(e.Group("/operators", auth))
+	handler.RegisterSelfRoutes(e.Group("/operators", auth))
+	return &testEnv{echo: e, service: service, repo: repo}
+}
+
+func (env *testEnv) serve(method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	env.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCreate(t *testing.T) {
+	t.Run("creates a scoped operator", func(t *testing.T) {
+		env := setup(t)
+
+		rec := env.serve(http.MethodPost, "/operators", `{"name":"alice","role":"operator","scope":["env=staging"]}`, "")
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		var resp operator.Operator
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.True(t, strings.HasPrefix(resp.ID, "opr_"))
+		assert.Equal(t, []string{"env=staging"}, resp.Scope)
+	})
+
+	t.Run("rejects unknown roles and duplicate names", func(t *testing.T) {
+		env := setup(t)
+		env.serve(http.MethodPost, "/operators", `{"name":"alice","role":"viewer"}`, "")
+
+		rec := env.serve(http.MethodPost, "/operators", `{"name":"bob","role":"root"}`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "unknown operator role")
+
+		rec = env.serve(http.MethodPost, "/operators", `{"name":"alice","role":"viewer"}`, "")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	env := setup(t)
+	o, err := env.service.Create(context.Background(), "alice", operator.RoleViewer, []string{"env=staging"})
+	require.NoError(t, err)
+
+	rec := env.serve(http.MethodPut, "/operators/"+o.ID, `{"role":"admin","scope":[]}`, "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	found, err := env.repo.FindOperator(context.Background(), o.ID)
+	require.NoError(t, err)
+	assert.Equal(t, operator.RoleAdmin, found.Role)
+	assert.False(t, found.Scoped())
+
+	rec = env.serve(http.MethodPut, "/operators/"+o.ID, `{"scope":["staging"]}`, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.serve(http.MethodPut, "/operators/opr_missing", `{"disabled":true}`, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestTokens(t *testing.T) {
+	env := setup(t)
+	o, err := env.service.Create(context.Background(), "alice", operator.RoleViewer, nil)
+	require.NoError(t, err)
+
+	rec := env.serve(http.MethodPost, "/operators/"+o.ID+"/tokens", `{"name":"laptop","expires_in":"720h"}`, "")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var issued struct {
+		ID        string  `json:"id"`
+		Token     string  `json:"token"`
+		Prefix    string  `json:"prefix"`
+		ExpiresAt *string `json:"expires_at"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+	assert.True(t, strings.HasPrefix(issued.Token, operator.TokenPrefix))
+	assert.True(t, strings.HasPrefix(issued.Token, issued.Prefix))
+	assert.NotNil(t, issued.ExpiresAt)
+
+	rec = env.serve(http.MethodGet, "/operators/me", "", issued.Token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"alice"`)
+
+	rec = env.serve(http.MethodGet, "/operators/"+o.ID+"/tokens", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), issued.Token)
+
+	rec = env.serve(http.MethodDelete, "/operators/"+o.ID+"/tokens/"+issued.ID, "", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = env.serve(http.MethodGet, "/operators/me", "", issued.Token)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.serve(http.MethodDelete, "/operators/"+o.ID+"/tokens/otk_missing", "", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = env.serve(http.MethodPost, "/operators/"+o.ID+"/tokens", `{"expires_in":"soon"}`, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestMe(t *testing.T) {
+	env := setup(t)
+
+	rec := env.serve(http.MethodGet, "/operators/me", "", "")
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
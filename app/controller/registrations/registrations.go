@@ -0,0 +1,150 @@
+// Package registrations lets operators approve the agent registrations
+// held because they look like a clone or a replacement of an existing
+// agent.
+package registrations
+
+import (
+	"errors"
+	"hostlink/app/middleware/auditlog"
+	agentService "hostlink/app/service/agent"
+	webhookService "hostlink/app/service/webhook"
+	"hostlink/domain/agent"
+	"hostlink/domain/webhook"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// How a held registration is approved
+const (
+	AsReplacement = "replacement"
+	AsNew         = "new"
+)
+
+type (
+	Handler struct {
+		approver  agentService.Approver
+		publisher webhookService.Publisher
+	}
+	// ApproveRequest approves a held registration as the replacement of
+	// the agent it resembles, or as a new agent.
+	ApproveRequest struct {
+		As string `json:"as" validate:"required"`
+	}
+	// ApproveResponse reports the agent a registration was approved as.
+	ApproveResponse struct {
+		ID      string `json:"id"`
+		Status  string `json:"status"`
+		AgentID string `json:"agent_id"`
+	}
+)
+
+func NewHandler(approver agentService.Approver) *Handler {
+	return &Handler{approver: approver}
+}
+
+// WithPublisher publishes agent.registered when a registration is approved
+// as a new agent
+func (h *Handler) WithPublisher(publisher webhookService.Publisher) *Handler {
+	h.publisher = publisher
+	return h
+}
+
+// Index lists held registrations, newest first. The status query parameter
+// filters them (default: pending_approval; "all" lists every status).
+func (h *Handler) Index(c echo.Context) error {
+	status := c.QueryParam("status")
+	switch status {
+	case "":
+		status = agent.ApprovalPending
+	case "all":
+		status = ""
+	}
+
+	pending, err := h.approver.ListPending(c.Request().Context(), status)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch registrations: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, pending)
+}
+
+// Approve resolves a held registration. The agent registers successfully
+// on its next attempt.
+func (h *Handler) Approve(c echo.Context) error {
+	var req ApproveRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Validation failed: " + err.Error(),
+		})
+	}
+
+	id := c.Param("id")
+	entry := auditlog.EntryFrom(c)
+	entry.Target = id
+	entry.SetDetail(map[string]string{"as": req.As})
+
+	ctx := c.Request().Context()
+	var approved *agent.Agent
+	var status string
+	var err error
+	switch req.As {
+	case AsReplacement:
+		approved, err = h.approver.ApproveReplacement(ctx, id)
+		status = agent.ApprovalReplacement
+	case AsNew:
+		approved, err = h.approver.ApproveNew(ctx, id)
+		status = agent.ApprovalNew
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": `as must be "replacement" or "new"`,
+		})
+	}
+	switch {
+	case errors.Is(err, agent.ErrPendingRegistrationNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Registration not found"})
+	case errors.Is(err, agent.ErrRegistrationResolved):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Registration already resolved"})
+	case errors.Is(err, agentService.ErrAgentRevoked):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Agent revoked"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Agent to replace no longer exists"})
+	case errors.Is(err, agentService.ErrInvalidToken):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Enrollment token can no longer be used"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to approve registration: " + err.Error(),
+		})
+	}
+	entry.SetDetail(map[string]string{"as": req.As, "agent_id": approved.ID})
+
+	if req.As == AsNew && h.publisher != nil {
+		err := h.publisher.Publish(ctx, webhook.EventAgentRegistered, webhook.AgentData{
+			ID:          approved.ID,
+			Fingerprint: approved.Fingerprint,
+			Hostname:    approved.Hostname,
+			Status:      approved.Status,
+			LastSeen:    approved.LastSeen,
+		})
+		if err != nil {
+			c.Logger().Errorf("publish %s webhook: %v", webhook.EventAgentRegistered, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, ApproveResponse{ID: id, Status: status, AgentID: approved.ID})
+}
+
+// RegisterRoutes registers registration approval on a group mounted at
+// /registrations
+func (h *Handler) RegisterRoutes(g *echo.Group) {
+	g.GET("", h.Index)
+	g.POST("/:id/approve", h.Approve)
+}
@@ -0,0 +1,160 @@
+package registrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	agentService "hostlink/app/service/agent"
+	"hostlink/domain/agent"
+	gormRepo "hostlink/internal/repository/gorm"
+	"hostlink/internal/validator"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type testEnv struct {
+	echo    *echo.Echo
+	service *agentService.RegistrationService
+	repo    agent.Repository
+}
+
+func setup(t *testing.T) *testEnv {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&agent.Agent{}, &agent.AgentTag{}, &agent.AgentRegistration{}, &agent.PendingRegistration{}))
+
+	repo := gormRepo.NewAgentRepository(db)
+	service := agentService.NewRegistrationService(repo)
+	e := echo.New()
+	e.Validator = validator.New()
+	NewHandler(service).RegisterRoutes(e.Group("/registrations"))
+	return &testEnv{echo: e, service: service, repo: repo}
+}
+
+func (env *testEnv) serve(method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	env.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+// hold registers an agent on machine-1, then holds a second registration
+// from the same machine.
+func (env *testEnv) hold(t *testing.T) (*agent.Agent, *agent.PendingRegistration) {
+	t.Helper()
+	ctx := context.Background()
+	original, err := env.service.RegisterAgent(ctx, agentService.RegistrationRequest{
+		Fingerprint: "fp-original", TokenID: "token", TokenKey: "key", PublicKey: "original-key", MachineID: "machine-1",
+	})
+	require.NoError(t, err)
+	_, err = env.service.RegisterAgent(ctx, agentService.RegistrationRequest{
+		Fingerprint: "fp-clone", TokenID: "token", TokenKey: "key", PublicKey: "clone-key", MachineID: "machine-1",
+	})
+	var held *agentService.PendingApprovalError
+	require.ErrorAs(t, err, &held)
+	return original, held.Registration
+}
+
+func TestIndex(t *testing.T) {
+	env := setup(t)
+	original, pending := env.hold(t)
+
+	rec := env.serve(http.MethodGet, "/registrations", "")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp []agent.PendingRegistration
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp, 1)
+	assert.Equal(t, pending.ID, resp[0].ID)
+	assert.Equal(t, original.ID, resp[0].CandidateAgentID)
+	assert.Equal(t, agent.DriftClone, resp[0].Reason)
+	assert.NotContains(t, rec.Body.String(), "clone-key")
+
+	_, err := env.service.ApproveNew(context.Background(), pending.ID)
+	require.NoError(t, err)
+	rec = env.serve(http.MethodGet, "/registrations", "")
+	assert.JSONEq(t, `[]`, rec.Body.String(), "resolved registrations are not pending")
+	rec = env.serve(http.MethodGet, "/registrations?status=all", "")
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp, 1)
+	assert.Equal(t, agent.ApprovalNew, resp[0].Status)
+}
+
+func TestApprove(t *testing.T) {
+	t.Run("approves as a replacement", func(t *testing.T) {
+		env := setup(t)
+		original, pending := env.hold(t)
+
+		rec := env.serve(http.MethodPost, "/registrations/"+pending.ID+"/approve", `{"as":"replacement"}`)
+
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp ApproveResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, ApproveResponse{ID: pending.ID, Status: agent.ApprovalReplacement, AgentID: original.ID}, resp)
+		stored, err := env.repo.FindByFingerprint(context.Background(), "fp-clone")
+		require.NoError(t, err)
+		assert.Equal(t, original.ID, stored.ID)
+	})
+
+	t.Run("approves as a new agent", func(t *testing.T) {
+		env := setup(t)
+		original, pending := env.hold(t)
+
+		rec := env.serve(http.MethodPost, "/registrations/"+pending.ID+"/approve", `{"as":"new"}`)
+
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp ApproveResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, agent.ApprovalNew, resp.Status)
+		assert.NotEqual(t, original.ID, resp.AgentID)
+	})
+
+	t.Run("rejects an unknown choice", func(t *testing.T) {
+		env := setup(t)
+		_, pending := env.hold(t)
+
+		for _, body := range []string{`{}`, `{"as":"clone"}`} {
+			rec := env.serve(http.MethodPost, "/registrations/"+pending.ID+"/approve", body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		}
+	})
+
+	t.Run("returns not found for an unknown registration", func(t *testing.T) {
+		env := setup(t)
+
+		rec := env.serve(http.MethodPost, "/registrations/reg_missing/approve", `{"as":"new"}`)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("refuses a resolved registration", func(t *testing.T) {
+		env := setup(t)
+		_, pending := env.hold(t)
+		rec := env.serve(http.MethodPost, "/registrations/"+pending.ID+"/approve", `{"as":"new"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		rec = env.serve(http.MethodPost, "/registrations/"+pending.ID+"/approve", `{"as":"replacement"}`)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("refuses to replace a revoked agent", func(t *testing.T) {
+		env := setup(t)
+		original, pending := env.hold(t)
+		require.NoError(t, env.repo.SetAccess(context.Background(), agent.AccessChange{AgentID: original.ID, Access: agent.AccessRevoked}))
+
+		rec := env.serve(http.MethodPost, "/registrations/"+pending.ID+"/approve", `{"as":"replacement"}`)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
@@ -0,0 +1,164 @@
+// Package secrets manages the named secrets tasks inject into their
+// environment. Values are sealed in an envelope for the agent's public key
+// and bound to the secret, so only the agent can read them.
+package secrets
+
+import (
+	"errors"
+	"hostlink/app/middleware/auditlog"
+	"hostlink/domain/agent"
+	"hostlink/domain/secret"
+	"hostlink/internal/crypto"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type (
+	Handler struct {
+		repo      secret.Repository
+		agentRepo agent.Repository
+	}
+	SecretRequest struct {
+		Value string `json:"value" validate:"required"`
+	}
+)
+
+func NewHandler(repo secret.Repository, agentRepo agent.Repository) *Handler {
+	return &Handler{repo: repo, agentRepo: agentRepo}
+}
+
+// Index lists an agent's secrets. An authenticated agent may only list its
+// own.
+func (h *Handler) Index(c echo.Context) error {
+	agentID := c.Param("id")
+	if header := c.Request().Header.Get("X-Agent-ID"); header != "" && header != agentID {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "Agent ID does not match authenticated agent",
+		})
+	}
+
+	secrets, err := h.repo.FindAll(c.Request().Context(), agentID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch secrets: " + err.Error(),
+		})
+	}
+	if secrets == nil {
+		secrets = []secret.Secret{}
+	}
+
+	return c.JSON(http.StatusOK, secrets)
+}
+
+// Put sets the value of the agent's secret with the name in the path,
+// creating the secret if the agent has none by that name.
+func (h *Handler) Put(c echo.Context) error {
+	var req SecretRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request format: " + err.Error(),
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Validation failed: " + err.Error(),
+		})
+	}
+
+	agentID := c.Param("id")
+	name := c.Param("name")
+	auditSecret(c)
+	if err := secret.ValidateName(name); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	a, err := h.agentRepo.FindByID(ctx, agentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Agent not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch agent: " + err.Error(),
+		})
+	}
+
+	status := http.StatusOK
+	s, err := h.repo.FindByName(ctx, agentID, name)
+	if errors.Is(err, secret.ErrSecretNotFound) {
+		status = http.StatusCreated
+		s = &secret.Secret{ID: secret.NewID(), AgentID: agentID, Name: name}
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch secret: " + err.Error(),
+		})
+	}
+
+	publicKey, err := crypto.ParsePublicKeyBase64(a.PublicKey)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+			"error": "Agent public key is unusable: " + err.Error(),
+		})
+	}
+	s.ValueEnc, err = crypto.SealEnvelope([]byte(req.Value), publicKey, secret.EnvelopeContext(agentID, s.ID, s.Name)...)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to encrypt secret: " + err.Error(),
+		})
+	}
+
+	if err := h.repo.Save(ctx, s); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to save secret: " + err.Error(),
+		})
+	}
+
+	auditlog.EntryFrom(c).Target = s.ID
+	return c.JSON(status, s)
+}
+
+// Delete removes the agent's secret with the name in the path. Tasks that
+// still reference it fail on the agent.
+func (h *Handler) Delete(c echo.Context) error {
+	auditSecret(c)
+
+	err := h.repo.Delete(c.Request().Context(), c.Param("id"), c.Param("name"))
+	if errors.Is(err, secret.ErrSecretNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Secret not found",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to delete secret: " + err.Error(),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// auditSecret describes the change for the audit log, leaving out the
+// value.
+func auditSecret(c echo.Context) {
+	auditlog.EntryFrom(c).SetDetail(map[string]any{
+		"agent_id": c.Param("id"),
+		"name":     c.Param("name"),
+	})
+}
+
+// RegisterAgentRoutes registers the endpoint an authenticated agent reads
+// its secrets from. The group is expected to be mounted at /:id.
+func (h *Handler) RegisterAgentRoutes(g *echo.Group) {
+	g.GET("/secrets", h.Index)
+}
+
+// RegisterRoutes registers secret management on a group mounted at /:id
+func (h *Handler) RegisterRoutes(g *echo.Group) {
+	g.GET("/secrets", h.Index)
+	g.PUT("/secrets/:name", h.Put)
+	g.DELETE("/secrets/:name", h.Delete)
+}
@@ -0,0 +1,194 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hostlink/domain/agent"
+	"hostlink/domain/secret"
+	"hostlink/internal/crypto"
+	"hostlink/internal/validator"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memorySecretRepository keeps secrets in memory, keyed by agent and name.
+type memorySecretRepository struct {
+	secrets map[string]secret.Secret
+}
+
+func newMemorySecretRepository() *memorySecretRepository {
+	return &memorySecretRepository{secrets: map[string]secret.Secret{}}
+}
+
+func (m *memorySecretRepository) Save(ctx context.Context, s *secret.Secret) error {
+	m.secrets[s.AgentID+"/"+s.Name] = *s
+	return nil
+}
+
+func (m *memorySecretRepository) FindAll(ctx context.Context, agentID string) ([]secret.Secret, error) {
+	var secrets []secret.Secret
+	for _, s := range m.secrets {
+		if s.AgentID == agentID {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets, nil
+}
+
+func (m *memorySecretRepository) FindByName(ctx context.Context, agentID, name string) (*secret.Secret, error) {
+	s, ok := m.secrets[agentID+"/"+name]
+	if !ok {
+		return nil, secret.ErrSecretNotFound
+	}
+	return &s, nil
+}
+
+func (m *memorySecretRepository) FindByNames(ctx context.Context, agentID string, names []string) ([]secret.Secret, error) {
+	var secrets []secret.Secret
+	for _, name := range names {
+		if s, ok := m.secrets[agentID+"/"+name]; ok {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets, nil
+}
+
+func (m *memorySecretRepository) Delete(ctx context.Context, agentID, name string) error {
+	if _, ok := m.secrets[agentID+"/"+name]; !ok {
+		return secret.ErrSecretNotFound
+	}
+	delete(m.secrets, agentID+"/"+name)
+	return nil
+}
+
+// mockAgentRepository implements the agent lookup the handler uses; any
+// other method panics through the nil embedded interface.
+type mockAgentRepository struct {
+	agent.Repository
+	publicKey string
+}
+
+func (m *mockAgentRepository) FindByID(ctx context.Context, id string) (*agent.Agent, error) {
+	if id != "agt_123" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &agent.Agent{ID: id, PublicKey: m.publicKey}, nil
+}
+
+func serve(handler *Handler, method, path, agentHeader string, body any) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Validator = validator.New()
+	handler.RegisterRoutes(e.Group("/agents/:id"))
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if agentHeader != "" {
+		req.Header.Set("X-Agent-ID", agentHeader)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSecrets(t *testing.T) {
+	privateKey, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+	require.NoError(t, err)
+	publicKey, err := crypto.PublicKeyBase64(privateKey)
+	require.NoError(t, err)
+	agents := &mockAgentRepository{publicKey: publicKey}
+
+	t.Run("Put seals the value for the agent and the secret", func(t *testing.T) {
+		repo := newMemorySecretRepository()
+
+		rec := serve(NewHandler(repo, agents), http.MethodPut, "/agents/agt_123/secrets/db_password", "", SecretRequest{Value: "s3cret"})
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "s3cret")
+		stored, err := repo.FindByName(context.Background(), "agt_123", "db_password")
+		require.NoError(t, err)
+		value, err := crypto.OpenEnvelope(stored.ValueEnc, privateKey, secret.EnvelopeContext("agt_123", stored.ID, "db_password")...)
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", string(value))
+		_, err = crypto.OpenEnvelope(stored.ValueEnc, privateKey, secret.EnvelopeContext("agt_123", stored.ID, "other")...)
+		assert.Error(t, err, "the value is bound to the secret's name")
+	})
+
+	t.Run("Put replaces the value and keeps the secret", func(t *testing.T) {
+		repo := newMemorySecretRepository()
+		handler := NewHandler(repo, agents)
+		require.Equal(t, http.StatusCreated, serve(handler, http.MethodPut, "/agents/agt_123/secrets/token", "", SecretRequest{Value: "one"}).Code)
+		first, err := repo.FindByName(context.Background(), "agt_123", "token")
+		require.NoError(t, err)
+
+		rec := serve(handler, http.MethodPut, "/agents/agt_123/secrets/token", "", SecretRequest{Value: "two"})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		second, err := repo.FindByName(context.Background(), "agt_123", "token")
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, second.ID)
+		value, err := crypto.OpenEnvelope(second.ValueEnc, privateKey, secret.EnvelopeContext("agt_123", second.ID, "token")...)
+		require.NoError(t, err)
+		assert.Equal(t, "two", string(value))
+	})
+
+	t.Run("Put rejects an invalid name", func(t *testing.T) {
+		rec := serve(NewHandler(newMemorySecretRepository(), agents), http.MethodPut, "/agents/agt_123/secrets/db-password", "", SecretRequest{Value: "x"})
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Put returns 400 without a value", func(t *testing.T) {
+		rec := serve(NewHandler(newMemorySecretRepository(), agents), http.MethodPut, "/agents/agt_123/secrets/token", "", SecretRequest{})
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Put returns 404 for an unknown agent", func(t *testing.T) {
+		rec := serve(NewHandler(newMemorySecretRepository(), agents), http.MethodPut, "/agents/agt_missing/secrets/token", "", SecretRequest{Value: "x"})
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Index returns the agent's secrets", func(t *testing.T) {
+		repo := newMemorySecretRepository()
+		require.NoError(t, repo.Save(context.Background(), &secret.Secret{ID: "sec_1", AgentID: "agt_123", Name: "token", ValueEnc: "enc"}))
+		require.NoError(t, repo.Save(context.Background(), &secret.Secret{ID: "sec_2", AgentID: "agt_other", Name: "token", ValueEnc: "enc"}))
+
+		rec := serve(NewHandler(repo, agents), http.MethodGet, "/agents/agt_123/secrets", "agt_123", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var got []secret.Secret
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		require.Len(t, got, 1)
+		assert.Equal(t, "sec_1", got[0].ID)
+	})
+
+	t.Run("Index returns 403 for another agent", func(t *testing.T) {
+		rec := serve(NewHandler(newMemorySecretRepository(), agents), http.MethodGet, "/agents/agt_other/secrets", "agt_123", nil)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("Delete removes the secret", func(t *testing.T) {
+		repo := newMemorySecretRepository()
+		require.NoError(t, repo.Save(context.Background(), &secret.Secret{ID: "sec_1", AgentID: "agt_123", Name: "token"}))
+		handler := NewHandler(repo, agents)
+
+		assert.Equal(t, http.StatusNoContent, serve(handler, http.MethodDelete, "/agents/agt_123/secrets/token", "", nil).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodDelete, "/agents/agt_123/secrets/token", "", nil).Code)
+	})
+}
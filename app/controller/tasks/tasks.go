@@ -2,10 +2,22 @@
 package tasks
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hostlink/app/middleware/agentauth"
+	"hostlink/app/middleware/auditlog"
+	"hostlink/app/middleware/operatorauth"
+	webhookService "hostlink/app/service/webhook"
+	"hostlink/domain/agent"
+	"hostlink/domain/operator"
+	"hostlink/domain/secret"
 	"hostlink/domain/task"
+	"hostlink/domain/webhook"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -15,32 +27,131 @@ import (
 
 type (
 	Handler struct {
-		repo task.Repository
+		repo       task.Repository
+		claimLease time.Duration
+		runLease   time.Duration
+		publisher  webhookService.Publisher
+		output     task.OutputRepository
+		streamPoll time.Duration
+		agents     AgentFinder
+		secrets    SecretFinder
+	}
+	// AgentFinder looks up the agents a task targets, whose tags decide
+	// whether a scoped operator may reach it.
+	AgentFinder interface {
+		FindByID(ctx context.Context, id string) (*agent.Agent, error)
+	}
+	// SecretFinder looks up the secrets of the agents a task targets.
+	SecretFinder interface {
+		FindByNames(ctx context.Context, agentID string, names []string) ([]secret.Secret, error)
 	}
 	OkCommand struct {
 		Command string `json:"command"`
 	}
 	TaskRequest struct {
-		Command  string `json:"command" validate:"required"`
-		Priority int    `json:"priority"`
+		Command      string            `json:"command" validate:"required"`
+		Priority     int               `json:"priority"`
+		OutputPolicy task.OutputPolicy `json:"output_policy"`
+		AgentIDs     []string          `json:"agent_ids"`
+		EnvSecrets   []string          `json:"env_secrets"`
 	}
 	TaskUpdateRequest struct {
-		Status   string `json:"status" validate:"required"`
-		Output   string `json:"output"`
-		Error    string `json:"error"`
-		ExitCode int    `json:"exit_code"`
+		Status             string `json:"status" validate:"required"`
+		ExecutionAttemptID string `json:"execution_attempt_id"`
+		Output             string `json:"output"`
+		Error              string `json:"error"`
+		ExitCode           int    `json:"exit_code"`
+	}
+	// OutputRequest is a chunk of output an agent streams while running a
+	// task. Sequence counts the agent's chunks of the stream from 1.
+	OutputRequest struct {
+		ExecutionAttemptID string `json:"execution_attempt_id"`
+		Stream             string `json:"stream" validate:"required"`
+		Sequence           int64  `json:"sequence"`
+		Data               string `json:"data"`
+	}
+	// StreamStatus is the data of a task stream's status and done events.
+	// ExitCode of a targeted task is the first non-zero execution exit code.
+	StreamStatus struct {
+		Status   string                 `json:"status"`
+		ExitCode int                    `json:"exit_code"`
+		Summary  *task.ExecutionSummary `json:"summary,omitempty"`
 	}
 	TaskResponse struct {
-		ID        string    `json:"id"`
-		Command   string    `json:"command"`
-		Status    string    `json:"status"`
-		Priority  int       `json:"priority"`
-		CreatedAt time.Time `json:"created_at"`
+		ID           string                 `json:"id"`
+		Command      string                 `json:"command"`
+		Status       string                 `json:"status"`
+		Priority     int                    `json:"priority"`
+		OutputPolicy task.OutputPolicy      `json:"output_policy,omitempty"`
+		AgentIDs     []string               `json:"agent_ids,omitempty"`
+		EnvSecrets   []string               `json:"env_secrets,omitempty"`
+		Summary      *task.ExecutionSummary `json:"summary,omitempty"`
+		CreatedAt    time.Time              `json:"created_at"`
 	}
 )
 
+const (
+	// DefaultClaimLease is how long an agent has to start a claimed task
+	// before it is requeued.
+	DefaultClaimLease = 5 * time.Minute
+	// DefaultRunLease is how long a running task may go without a report
+	// before it is timed out.
+	DefaultRunLease = time.Hour
+	// DefaultStreamPollInterval is how often a task stream checks for new
+	// output and status changes.
+	DefaultStreamPollInterval = 500 * time.Millisecond
+)
+
+const (
+	// outputPageSize caps the chunks read per query.
+	outputPageSize = 500
+	// streamKeepalive is how long a quiet stream waits before sending a
+	// comment, so proxies do not close it.
+	streamKeepalive = 15 * time.Second
+)
+
 func NewHandler(repo task.Repository) *Handler {
-	return &Handler{repo: repo}
+	return &Handler{repo: repo, claimLease: DefaultClaimLease, runLease: DefaultRunLease, streamPoll: DefaultStreamPollInterval}
+}
+
+// WithLeases overrides the claim and run leases. Zero keeps the default.
+func (h *Handler) WithLeases(claimLease, runLease time.Duration) *Handler {
+	if claimLease > 0 {
+		h.claimLease = claimLease
+	}
+	if runLease > 0 {
+		h.runLease = runLease
+	}
+	return h
+}
+
+// WithPublisher publishes task.completed and task.failed webhook events
+// when a task finishes.
+func (h *Handler) WithPublisher(publisher webhookService.Publisher) *Handler {
+	h.publisher = publisher
+	return h
+}
+
+// WithOutput stores the output agents stream while tasks run and serves it
+// live to task streams.
+func (h *Handler) WithOutput(output task.OutputRepository) *Handler {
+	h.output = output
+	return h
+}
+
+// WithSecrets checks that every agent a task targets has the secrets the
+// task references. Without it, a missing secret fails the task on the
+// agent.
+func (h *Handler) WithSecrets(secrets SecretFinder) *Handler {
+	h.secrets = secrets
+	return h
+}
+
+// WithAgents looks up target agents to enforce operator tag scopes. Without
+// it, scoped operators reach no tasks.
+func (h *Handler) WithAgents(agents AgentFinder) *Handler {
+	h.agents = agents
+	return h
 }
 
 func (h Handler) Create(c echo.Context) error {
@@ -60,11 +171,63 @@ func (h Handler) Create(c echo.Context) error {
 		})
 	}
 
+	if !req.OutputPolicy.Valid() {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid output_policy: " + string(req.OutputPolicy),
+		})
+	}
+
+	secretNames, err := secret.References(req.Command, req.EnvSecrets)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	detail := map[string]any{"command": req.Command, "agent_ids": req.AgentIDs}
+	if len(secretNames) > 0 {
+		detail["secrets"] = secretNames
+	}
+	entry := auditlog.EntryFrom(c)
+	entry.SetDetail(detail)
+
 	ctx := c.Request().Context()
 
+	if o := scopedOperator(c); o != nil {
+		if len(req.AgentIDs) == 0 {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "Scoped operators must target agents",
+			})
+		}
+		for _, agentID := range req.AgentIDs {
+			if !h.agentInScope(ctx, o, agentID) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "Agent " + agentID + " is outside your scope",
+				})
+			}
+		}
+	}
+
+	if len(secretNames) > 0 && h.secrets != nil {
+		for _, agentID := range req.AgentIDs {
+			missing, err := h.missingSecrets(ctx, agentID, secretNames)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": "Failed to fetch secrets: " + err.Error(),
+				})
+			}
+			if len(missing) > 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "Agent " + agentID + " has no secret " + strings.Join(missing, ", "),
+				})
+			}
+		}
+	}
+
 	newTask := &task.Task{
-		Command:  req.Command,
-		Priority: req.Priority,
+		Command:      req.Command,
+		Priority:     req.Priority,
+		OutputPolicy: req.OutputPolicy,
+		AgentIDs:     req.AgentIDs,
+		EnvSecrets:   req.EnvSecrets,
 	}
 
 	err = h.repo.Create(ctx, newTask)
@@ -74,17 +237,64 @@ func (h Handler) Create(c echo.Context) error {
 		})
 	}
 
+	entry.Target = newTask.ID
+
 	response := TaskResponse{
-		ID:        newTask.ID,
-		Command:   newTask.Command,
-		Status:    newTask.Status,
-		Priority:  newTask.Priority,
-		CreatedAt: newTask.CreatedAt,
+		ID:           newTask.ID,
+		Command:      newTask.Command,
+		Status:       newTask.Status,
+		Priority:     newTask.Priority,
+		OutputPolicy: newTask.OutputPolicy,
+		AgentIDs:     newTask.AgentIDs,
+		EnvSecrets:   newTask.EnvSecrets,
+		Summary:      newTask.Summary,
+		CreatedAt:    newTask.CreatedAt,
 	}
 
 	return c.JSON(http.StatusCreated, response)
 }
 
+// missingSecrets returns the names among names agentID has no secret for.
+func (h Handler) missingSecrets(ctx context.Context, agentID string, names []string) ([]string, error) {
+	found, err := h.secrets.FindByNames(ctx, agentID, names)
+	if err != nil {
+		return nil, err
+	}
+	has := make(map[string]bool, len(found))
+	for _, s := range found {
+		has[s.Name] = true
+	}
+	var missing []string
+	for _, name := range names {
+		if !has[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// Poll claims the tasks the authenticated agent may run, so no task is
+// handed to two agents or run twice. A quarantined agent may run none.
+func (h Handler) Poll(c echo.Context) error {
+	agentID := agentauth.AgentIDFromContext(c)
+	if agentID == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": "Tasks must be polled by an authenticated agent",
+		})
+	}
+	if agentauth.IsQuarantined(c) {
+		return c.JSON(http.StatusOK, []task.Task{})
+	}
+
+	tasks, err := h.repo.Claim(c.Request().Context(), agentID, h.claimLease)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch tasks: " + err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, tasks)
+}
+
 func (h Handler) Index(c echo.Context) error {
 	ctx := c.Request().Context()
 
@@ -101,6 +311,10 @@ func (h Handler) Index(c echo.Context) error {
 		}
 	}
 
+	if agent := c.QueryParam("agent"); agent != "" {
+		filters.AgentID = &agent
+	}
+
 	tasks, err := h.repo.FindAll(ctx, filters)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
@@ -108,6 +322,17 @@ func (h Handler) Index(c echo.Context) error {
 		})
 	}
 
+	if o := scopedOperator(c); o != nil {
+		inScope := make(map[string]bool)
+		visible := make([]task.Task, 0, len(tasks))
+		for _, t := range tasks {
+			if h.targetsInScope(ctx, o, t.AgentIDs, inScope) {
+				visible = append(visible, t)
+			}
+		}
+		tasks = visible
+	}
+
 	return c.JSON(http.StatusOK, tasks)
 }
 
@@ -127,7 +352,7 @@ func (h Handler) Get(c echo.Context) error {
 		})
 	}
 
-	if task == nil {
+	if task == nil || !h.visible(c, task) {
 		return c.JSON(http.StatusNotFound, map[string]string{
 			"error": "Task not found",
 		})
@@ -136,10 +361,19 @@ func (h Handler) Get(c echo.Context) error {
 	return c.JSON(http.StatusOK, task)
 }
 
+// Update records the authenticated agent's report on a task it claimed.
+// Operators stop a task with Cancel instead.
 func (h Handler) Update(c echo.Context) error {
 	ctx := c.Request().Context()
 	taskID := c.Param("id")
 
+	agentID := agentauth.AgentIDFromContext(c)
+	if agentID == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": "Task results must be reported by an authenticated agent",
+		})
+	}
+
 	var req TaskUpdateRequest
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
@@ -148,6 +382,13 @@ func (h Handler) Update(c echo.Context) error {
 	if err := c.Validate(&req); err != nil {
 		return err
 	}
+	auditlog.EntryFrom(c).SetDetail(map[string]any{"status": req.Status, "exit_code": req.ExitCode})
+
+	if !task.ValidStatus(req.Status) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid status: " + req.Status,
+		})
+	}
 
 	existingTask, err := h.repo.FindByID(ctx, taskID)
 	if err != nil {
@@ -167,24 +408,546 @@ func (h Handler) Update(c echo.Context) error {
 		})
 	}
 
+	if len(existingTask.AgentIDs) > 0 {
+		return h.updateExecution(c, existingTask, agentID, req)
+	}
+
+	if existingTask.ClaimedBy != agentID {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "Task is not claimed by this agent",
+		})
+	}
+	if req.ExecutionAttemptID != "" && req.ExecutionAttemptID != existingTask.ExecutionAttemptID {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "Execution attempt is no longer current",
+		})
+	}
+
+	previousStatus := existingTask.Status
 	existingTask.Status = req.Status
 	existingTask.Output = req.Output
 	existingTask.Error = req.Error
 	existingTask.ExitCode = req.ExitCode
+	existingTask.LeaseExpiresAt = h.leaseFor(req.Status, existingTask.LeaseExpiresAt)
 
 	err = h.repo.Update(ctx, existingTask)
+	if err != nil {
+		return updateError(c, err)
+	}
+	if previousStatus != existingTask.Status {
+		h.publishFinished(c, existingTask)
+	}
+
+	return c.JSON(http.StatusOK, existingTask)
+}
+
+// updateExecution records agentID's result for a targeted task.
+func (h Handler) updateExecution(c echo.Context, parent *task.Task, agentID string, req TaskUpdateRequest) error {
+	ctx := c.Request().Context()
+	execution, err := h.repo.UpdateExecution(ctx, parent.ID, agentID, task.Execution{
+		AttemptID:      req.ExecutionAttemptID,
+		Status:         req.Status,
+		Output:         req.Output,
+		Error:          req.Error,
+		ExitCode:       req.ExitCode,
+		LeaseExpiresAt: h.leaseFor(req.Status, nil),
+	})
+	if err != nil {
+		if errors.Is(err, task.ErrExecutionNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Task is not assigned to this agent",
+			})
+		}
+		return updateError(c, err)
+	}
+
+	if h.publisher != nil && task.IsTerminal(execution.Status) {
+		if updated, err := h.repo.FindByID(ctx, parent.ID); err == nil && updated.Status != parent.Status {
+			h.publishFinished(c, updated)
+		}
+	}
+
+	return c.JSON(http.StatusOK, execution)
+}
+
+// Cancel stops a task that has not finished. Every unfinished execution of
+// a targeted task is cancelled; an agent's later report on it is rejected.
+func (h Handler) Cancel(c echo.Context) error {
+	ctx := c.Request().Context()
+	existingTask, err := h.repo.FindByID(ctx, c.Param("id"))
+	if err != nil {
+		return findError(c, err)
+	}
+	if existingTask == nil || !h.visible(c, existingTask) {
+		return findError(c, nil)
+	}
+	auditlog.EntryFrom(c).Target = existingTask.ID
+
+	if len(existingTask.AgentIDs) == 0 {
+		existingTask.Status = task.StatusCancelled
+		existingTask.LeaseExpiresAt = nil
+		if err := h.repo.Update(ctx, existingTask); err != nil {
+			return updateError(c, err)
+		}
+		return c.JSON(http.StatusOK, existingTask)
+	}
+
+	executions, err := h.repo.FindExecutions(ctx, existingTask.ID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to update task: " + err.Error(),
+			"error": "Failed to fetch executions: " + err.Error(),
+		})
+	}
+	cancelled := 0
+	for _, execution := range executions {
+		if execution.Finished() {
+			continue
+		}
+		_, err := h.repo.UpdateExecution(ctx, existingTask.ID, execution.AgentID, task.Execution{
+			AttemptID: execution.AttemptID,
+			Status:    task.StatusCancelled,
+			Output:    execution.Output,
+			Error:     execution.Error,
+			ExitCode:  execution.ExitCode,
+		})
+		if err != nil {
+			return updateError(c, err)
+		}
+		cancelled++
+	}
+	if cancelled == 0 {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "Task has already finished",
 		})
 	}
 
-	return c.JSON(http.StatusOK, existingTask)
+	updated, err := h.repo.FindByID(ctx, existingTask.ID)
+	if err != nil || updated == nil {
+		return findError(c, err)
+	}
+	return c.JSON(http.StatusOK, updated)
+}
+
+// leaseFor returns the lease a task holds after moving to status: a running
+// report renews the run lease, and other statuses keep the current one.
+func (h Handler) leaseFor(status string, current *time.Time) *time.Time {
+	if status != task.StatusRunning {
+		return current
+	}
+	expiresAt := time.Now().UTC().Add(h.runLease)
+	return &expiresAt
+}
+
+// publishFinished publishes the webhook event of a task that just reached
+// a terminal status. A completed task that exited non-zero or reported an
+// error counts as failed; cancelled tasks publish nothing. Notifications are
+// best effort, so a failure is logged rather than failing the report.
+func (h Handler) publishFinished(c echo.Context, t *task.Task) {
+	if h.publisher == nil {
+		return
+	}
+
+	var eventType string
+	switch t.Status {
+	case task.StatusCompleted:
+		eventType = webhook.EventTaskCompleted
+		if t.ExitCode != 0 || t.Error != "" {
+			eventType = webhook.EventTaskFailed
+		}
+	case task.StatusFailed, task.StatusTimedOut:
+		eventType = webhook.EventTaskFailed
+	default:
+		return
+	}
+
+	data := webhook.TaskData{
+		ID:       t.ID,
+		Command:  t.Command,
+		Status:   t.Status,
+		ExitCode: t.ExitCode,
+		Error:    t.Error,
+		AgentID:  t.ClaimedBy,
+		AgentIDs: t.AgentIDs,
+	}
+	if err := h.publisher.Publish(c.Request().Context(), eventType, data); err != nil {
+		c.Logger().Errorf("publish %s webhook: %v", eventType, err)
+	}
+}
+
+func updateError(c echo.Context, err error) error {
+	if errors.Is(err, task.ErrInvalidTransition) || errors.Is(err, task.ErrLeaseNotHeld) {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{
+		"error": "Failed to update task: " + err.Error(),
+	})
+}
+
+func (h Handler) Executions(c echo.Context) error {
+	ctx := c.Request().Context()
+	taskID := c.Param("id")
+
+	existingTask, err := h.repo.FindByID(ctx, taskID)
+	if err != nil {
+		return findError(c, err)
+	}
+	if existingTask != nil && !h.visible(c, existingTask) {
+		return findError(c, nil)
+	}
+
+	executions, err := h.repo.FindExecutions(ctx, taskID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch executions: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, executions)
+}
+
+// ReportOutput stores a chunk of output from the agent running the task.
+// Only the agent holding the task's current claim may report output.
+func (h Handler) ReportOutput(c echo.Context) error {
+	if h.output == nil {
+		return c.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "Task output streaming is not enabled",
+		})
+	}
+
+	agentID := agentauth.AgentIDFromContext(c)
+	if agentID == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": "Output must be reported by an authenticated agent",
+		})
+	}
+
+	var req OutputRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+	if !task.ValidStream(req.Stream) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid stream: " + req.Stream,
+		})
+	}
+
+	ctx := c.Request().Context()
+	existingTask, err := h.repo.FindByID(ctx, c.Param("id"))
+	if err != nil || existingTask == nil {
+		return findError(c, err)
+	}
+
+	if err := h.checkRunning(c, existingTask, agentID, req.ExecutionAttemptID); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	chunk := &task.OutputChunk{
+		TaskID:             existingTask.ID,
+		AgentID:            agentID,
+		ExecutionAttemptID: req.ExecutionAttemptID,
+		Stream:             req.Stream,
+		AgentSequence:      req.Sequence,
+		Data:               req.Data,
+	}
+	if err := h.output.AppendOutput(ctx, chunk); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to save output: " + err.Error(),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkRunning returns an error unless agentID holds a claim on t that has
+// not finished, under attemptID when one is given.
+func (h Handler) checkRunning(c echo.Context, t *task.Task, agentID, attemptID string) error {
+	if len(t.AgentIDs) == 0 {
+		if t.ClaimedBy != agentID {
+			return fmt.Errorf("%w: task is not claimed by this agent", task.ErrLeaseNotHeld)
+		}
+		if attemptID != "" && attemptID != t.ExecutionAttemptID {
+			return fmt.Errorf("%w: attempt %s is no longer current", task.ErrLeaseNotHeld, attemptID)
+		}
+		if t.Status != task.StatusClaimed && t.Status != task.StatusRunning {
+			return fmt.Errorf("task is %s", t.Status)
+		}
+		return nil
+	}
+
+	executions, err := h.repo.FindExecutions(c.Request().Context(), t.ID)
+	if err != nil {
+		return err
+	}
+	for _, execution := range executions {
+		if execution.AgentID != agentID {
+			continue
+		}
+		if attemptID != "" && attemptID != execution.AttemptID {
+			return fmt.Errorf("%w: attempt %s is no longer current", task.ErrLeaseNotHeld, attemptID)
+		}
+		if execution.Status != task.StatusClaimed && execution.Status != task.StatusRunning {
+			return fmt.Errorf("execution is %s", execution.Status)
+		}
+		return nil
+	}
+	return task.ErrExecutionNotFound
+}
+
+// Output lists the task's output chunks after ?since, in order.
+func (h Handler) Output(c echo.Context) error {
+	if h.output == nil {
+		return c.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "Task output streaming is not enabled",
+		})
+	}
+
+	since, ok := parseSequence(c.QueryParam("since"))
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid since: " + c.QueryParam("since"),
+		})
+	}
+
+	ctx := c.Request().Context()
+	existingTask, err := h.repo.FindByID(ctx, c.Param("id"))
+	if err != nil || existingTask == nil || !h.visible(c, existingTask) {
+		return findError(c, err)
+	}
+
+	chunks, err := h.output.FindOutput(ctx, existingTask.ID, since, 0)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch output: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, chunks)
+}
+
+// Stream sends the task's output and status changes as server-sent events
+// until the task finishes. Output events carry their sequence as the event
+// ID, so a client resumes with ?since or the Last-Event-ID header. A status
+// event is sent on connect and whenever the status changes, and a done
+// event ends the stream.
+func (h Handler) Stream(c echo.Context) error {
+	if h.output == nil {
+		return c.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "Task output streaming is not enabled",
+		})
+	}
+
+	sinceParam := c.QueryParam("since")
+	if lastEventID := c.Request().Header.Get("Last-Event-ID"); lastEventID != "" {
+		sinceParam = lastEventID
+	}
+	since, ok := parseSequence(sinceParam)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid since: " + sinceParam,
+		})
+	}
+
+	ctx := c.Request().Context()
+	taskID := c.Param("id")
+	if existingTask, err := h.repo.FindByID(ctx, taskID); err != nil || existingTask == nil || !h.visible(c, existingTask) {
+		return findError(c, err)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	ticker := time.NewTicker(h.streamPoll)
+	defer ticker.Stop()
+
+	lastStatus := ""
+	lastWrite := time.Now()
+	for {
+		current, err := h.repo.FindByID(ctx, taskID)
+		if err != nil || current == nil {
+			return nil
+		}
+		// Output is read after the status, so a finished task's stream
+		// holds everything the agent sent before its final report.
+		for {
+			chunks, err := h.output.FindOutput(ctx, taskID, since, outputPageSize)
+			if err != nil {
+				return nil
+			}
+			for _, chunk := range chunks {
+				if err := writeEvent(res, strconv.FormatInt(chunk.Sequence, 10), "output", chunk); err != nil {
+					return nil
+				}
+				since = chunk.Sequence
+			}
+			if len(chunks) > 0 {
+				lastWrite = time.Now()
+			}
+			if len(chunks) < outputPageSize {
+				break
+			}
+		}
+
+		if current.Status != lastStatus || task.IsTerminal(current.Status) {
+			status := h.streamStatus(ctx, current)
+			event := "status"
+			if task.IsTerminal(current.Status) {
+				event = "done"
+			}
+			if err := writeEvent(res, "", event, status); err != nil || event == "done" {
+				return nil
+			}
+			lastStatus = current.Status
+			lastWrite = time.Now()
+		}
+
+		if time.Since(lastWrite) >= streamKeepalive {
+			if _, err := fmt.Fprint(res, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+			lastWrite = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
 }
 
+// streamStatus describes t for a status or done event.
+func (h Handler) streamStatus(ctx context.Context, t *task.Task) StreamStatus {
+	status := StreamStatus{Status: t.Status, ExitCode: t.ExitCode, Summary: t.Summary}
+	if len(t.AgentIDs) == 0 {
+		return status
+	}
+	executions, err := h.repo.FindExecutions(ctx, t.ID)
+	if err != nil {
+		return status
+	}
+	for _, execution := range executions {
+		if execution.ExitCode != 0 {
+			status.ExitCode = execution.ExitCode
+			break
+		}
+	}
+	return status
+}
+
+func writeEvent(res *echo.Response, id, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(res, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
+
+// parseSequence parses an output sequence; empty means from the start.
+func parseSequence(value string) (int64, bool) {
+	if value == "" {
+		return 0, true
+	}
+	sequence, err := strconv.ParseInt(value, 10, 64)
+	return sequence, err == nil && sequence >= 0
+}
+
+// scopedOperator returns the operator making the request when its scope
+// limits the agents it may reach.
+func scopedOperator(c echo.Context) *operator.Operator {
+	if o := operatorauth.FromContext(c); o != nil && o.Scoped() {
+		return o
+	}
+	return nil
+}
+
+// visible reports whether the operator making the request may see t.
+func (h Handler) visible(c echo.Context, t *task.Task) bool {
+	o := scopedOperator(c)
+	return o == nil || h.targetsInScope(c.Request().Context(), o, t.AgentIDs, nil)
+}
+
+// targetsInScope reports whether every agent in agentIDs is within o's
+// scope. A task without targets may run on any agent, so it is outside
+// every scope. inScope, when given, caches the answer per agent.
+func (h Handler) targetsInScope(ctx context.Context, o *operator.Operator, agentIDs []string, inScope map[string]bool) bool {
+	if len(agentIDs) == 0 {
+		return false
+	}
+	for _, agentID := range agentIDs {
+		ok, cached := inScope[agentID]
+		if !cached {
+			ok = h.agentInScope(ctx, o, agentID)
+			if inScope != nil {
+				inScope[agentID] = ok
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// agentInScope reports whether agentID exists and is within o's scope.
+func (h Handler) agentInScope(ctx context.Context, o *operator.Operator, agentID string) bool {
+	if h.agents == nil {
+		return false
+	}
+	a, err := h.agents.FindByID(ctx, agentID)
+	return err == nil && a != nil && o.InScope(a.Tags)
+}
+
+// findError responds to a failed task lookup; a nil error means the task
+// was not found.
+func findError(c echo.Context, err error) error {
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Task not found",
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{
+		"error": "Failed to fetch task: " + err.Error(),
+	})
+}
+
+// RegisterRoutes registers the routes operators create, inspect and cancel
+// tasks with.
 func (h *Handler) RegisterRoutes(g *echo.Group) {
 	g.POST("", h.Create)
 	g.GET("", h.Index)
 	g.GET("/:id", h.Get)
+	g.GET("/:id/executions", h.Executions)
+	g.GET("/:id/output", h.Output)
+	g.GET("/:id/stream", h.Stream)
+	g.POST("/:id/cancel", h.Cancel)
+}
+
+// RegisterAgentRoutes registers the routes an agent claims tasks and
+// reports on them with. The group is expected to have agent
+// authentication applied.
+func (h *Handler) RegisterAgentRoutes(g *echo.Group) {
+	g.GET("", h.Poll)
 	g.PUT("/:id", h.Update)
+	g.POST("/:id/output", h.ReportOutput)
 }
@@ -5,11 +5,18 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"hostlink/app/middleware/agentauth"
+	"hostlink/app/middleware/operatorauth"
+	"hostlink/domain/agent"
+	"hostlink/domain/operator"
+	"hostlink/domain/secret"
 	"hostlink/domain/task"
+	"hostlink/domain/webhook"
 	"hostlink/internal/validator"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -17,9 +24,13 @@ import (
 )
 
 type mockTaskRepository struct {
-	createFunc   func(ctx context.Context, t *task.Task) error
-	findAllFunc  func(ctx context.Context, tf task.TaskFilters) ([]task.Task, error)
-	findByIDFunc func(ctx context.Context, id string) (*task.Task, error)
+	createFunc          func(ctx context.Context, t *task.Task) error
+	findAllFunc         func(ctx context.Context, tf task.TaskFilters) ([]task.Task, error)
+	findByIDFunc        func(ctx context.Context, id string) (*task.Task, error)
+	claimFunc           func(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error)
+	updateFunc          func(ctx context.Context, t *task.Task) error
+	updateExecutionFunc func(ctx context.Context, taskID, agentID string, result task.Execution) (*task.Execution, error)
+	findExecutionsFunc  func(ctx context.Context, taskID string) ([]task.Execution, error)
 }
 
 func (m *mockTaskRepository) Create(ctx context.Context, t *task.Task) error {
@@ -48,9 +59,37 @@ func (m *mockTaskRepository) FindByID(ctx context.Context, id string) (*task.Tas
 }
 
 func (m *mockTaskRepository) Update(ctx context.Context, t *task.Task) error {
+	if m.updateFunc != nil {
+		return m.updateFunc(ctx, t)
+	}
 	return nil
 }
 
+func (m *mockTaskRepository) Claim(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error) {
+	if m.claimFunc != nil {
+		return m.claimFunc(ctx, agentID, lease)
+	}
+	return []task.Task{}, nil
+}
+
+func (m *mockTaskRepository) ExpireLeases(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockTaskRepository) FindExecutions(ctx context.Context, taskID string) ([]task.Execution, error) {
+	if m.findExecutionsFunc != nil {
+		return m.findExecutionsFunc(ctx, taskID)
+	}
+	return []task.Execution{}, nil
+}
+
+func (m *mockTaskRepository) UpdateExecution(ctx context.Context, taskID, agentID string, result task.Execution) (*task.Execution, error) {
+	if m.updateExecutionFunc != nil {
+		return m.updateExecutionFunc(ctx, taskID, agentID, result)
+	}
+	return &result, nil
+}
+
 func TestHandler_Create(t *testing.T) {
 	t.Run("should create task successfully", func(t *testing.T) {
 		repo := &mockTaskRepository{
@@ -135,6 +174,92 @@ func TestHandler_Create(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
 	})
 
+	t.Run("should store output policy", func(t *testing.T) {
+		var created *task.Task
+		repo := &mockTaskRepository{
+			createFunc: func(ctx context.Context, tsk *task.Task) error {
+				created = tsk
+				return nil
+			},
+		}
+		handler := NewHandler(repo)
+
+		e := echo.New()
+		e.Validator = validator.New()
+
+		reqBody := TaskRequest{
+			Command:      "tail -f /var/log/syslog",
+			OutputPolicy: task.OutputPolicyDropOldest,
+		}
+		body, _ := json.Marshal(reqBody)
+
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Create(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		require.NotNil(t, created)
+		assert.Equal(t, task.OutputPolicyDropOldest, created.OutputPolicy)
+	})
+
+	t.Run("should fan out to requested agents", func(t *testing.T) {
+		var created *task.Task
+		repo := &mockTaskRepository{
+			createFunc: func(ctx context.Context, tsk *task.Task) error {
+				created = tsk
+				tsk.ID = "tsk_123"
+				tsk.Summary = &task.ExecutionSummary{Total: len(tsk.AgentIDs), Pending: len(tsk.AgentIDs)}
+				return nil
+			},
+		}
+		handler := NewHandler(repo)
+
+		e := echo.New()
+		e.Validator = validator.New()
+
+		body := []byte(`{"command":"uptime","agent_ids":["agt_1","agt_2"]}`)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		require.NoError(t, handler.Create(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, []string{"agt_1", "agt_2"}, created.AgentIDs)
+
+		var response TaskResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, []string{"agt_1", "agt_2"}, response.AgentIDs)
+		require.NotNil(t, response.Summary)
+		assert.Equal(t, 2, response.Summary.Pending)
+	})
+
+	t.Run("should return 400 when output policy is unknown", func(t *testing.T) {
+		repo := &mockTaskRepository{}
+		handler := NewHandler(repo)
+
+		e := echo.New()
+		e.Validator = validator.New()
+
+		reqBody := TaskRequest{
+			Command:      "echo hello",
+			OutputPolicy: "discard-all",
+		}
+		body, _ := json.Marshal(reqBody)
+
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler.Create(c)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
 	t.Run("should return 500 when repository fails", func(t *testing.T) {
 		repo := &mockTaskRepository{
 			createFunc: func(ctx context.Context, tsk *task.Task) error {
@@ -265,9 +390,10 @@ func TestHandler_Update(t *testing.T) {
 		repo := &mockTaskRepository{
 			findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
 				return &task.Task{
-					ID:      "tsk_123",
-					Command: "ls -la",
-					Status:  "pending",
+					ID:        "tsk_123",
+					Command:   "ls -la",
+					Status:    task.StatusClaimed,
+					ClaimedBy: "agt_1",
 				}, nil
 			},
 		}
@@ -290,6 +416,7 @@ func TestHandler_Update(t *testing.T) {
 		c := e.NewContext(req, rec)
 		c.SetParamNames("id")
 		c.SetParamValues("tsk_123")
+		agentauth.SetAgent(c, "agt_1", agent.AccessActive)
 
 		err := handler.Update(c)
 		require.NoError(t, err)
@@ -314,6 +441,7 @@ func TestHandler_Update(t *testing.T) {
 		c := e.NewContext(req, rec)
 		c.SetParamNames("id")
 		c.SetParamValues("tsk_123")
+		agentauth.SetAgent(c, "agt_1", agent.AccessActive)
 
 		err := handler.Update(c)
 		require.Error(t, err)
@@ -343,9 +471,781 @@ func TestHandler_Update(t *testing.T) {
 		c := e.NewContext(req, rec)
 		c.SetParamNames("id")
 		c.SetParamValues("nonexistent")
+		agentauth.SetAgent(c, "agt_1", agent.AccessActive)
 
 		err := handler.Update(c)
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusNotFound, rec.Code)
 	})
+
+	t.Run("should reject a report without an authenticated agent", func(t *testing.T) {
+		repo := &mockTaskRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+				t.Fatal("the task must not be looked up")
+				return nil, nil
+			},
+		}
+		e := echo.New()
+		e.Validator = validator.New()
+		body := []byte(`{"status":"completed","exit_code":0}`)
+		req := httptest.NewRequest(http.MethodPut, "/tasks/tsk_123", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Agent-ID", "agt_1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("tsk_123")
+
+		require.NoError(t, NewHandler(repo).Update(c))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "the X-Agent-ID header alone does not identify an agent")
+	})
+}
+
+func TestHandler_Poll(t *testing.T) {
+	poll := func(handler *Handler, agentID, access string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Agent-ID", "agt_header")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if agentID != "" {
+			agentauth.SetAgent(c, agentID, access)
+		}
+		require.NoError(t, handler.Poll(c))
+		return rec
+	}
+
+	t.Run("should claim the authenticated agent's tasks", func(t *testing.T) {
+		var requestedAgent string
+		var requestedLease time.Duration
+		repo := &mockTaskRepository{
+			findAllFunc: func(ctx context.Context, tf task.TaskFilters) ([]task.Task, error) {
+				t.Fatal("agents must not list every task")
+				return nil, nil
+			},
+			claimFunc: func(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error) {
+				requestedAgent, requestedLease = agentID, lease
+				return []task.Task{{ID: "tsk_1", ExecutionAttemptID: "att_1", Status: task.StatusClaimed}}, nil
+			},
+		}
+
+		rec := poll(NewHandler(repo).WithLeases(time.Minute, 0), "agt_1", agent.AccessActive)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "agt_1", requestedAgent)
+		assert.Equal(t, time.Minute, requestedLease)
+
+		var tasks []task.Task
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tasks))
+		require.Len(t, tasks, 1)
+		assert.Equal(t, "att_1", tasks[0].ExecutionAttemptID)
+	})
+
+	t.Run("should claim nothing without an authenticated agent or for a quarantined one", func(t *testing.T) {
+		repo := &mockTaskRepository{
+			claimFunc: func(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error) {
+				t.Fatal("no task may be claimed")
+				return nil, nil
+			},
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, poll(NewHandler(repo), "", "").Code)
+		rec := poll(NewHandler(repo), "agt_1", agent.AccessQuarantined)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[]`, rec.Body.String())
+	})
+}
+
+func TestHandler_IndexIgnoresAgentHeader(t *testing.T) {
+	repo := &mockTaskRepository{
+		claimFunc: func(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error) {
+			t.Fatal("listing tasks must not claim them")
+			return nil, nil
+		},
+	}
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Agent-ID", "agt_1")
+	rec := httptest.NewRecorder()
+
+	require.NoError(t, NewHandler(repo).Index(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandler_Cancel(t *testing.T) {
+	cancel := func(handler *Handler) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("tsk_1")
+		require.NoError(t, handler.Cancel(c))
+		return rec
+	}
+
+	t.Run("cancels an untargeted task", func(t *testing.T) {
+		var saved *task.Task
+		repo := &mockTaskRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+				return &task.Task{ID: id, Status: task.StatusRunning, ClaimedBy: "agt_1", ExecutionAttemptID: "att_1"}, nil
+			},
+			updateFunc: func(ctx context.Context, tsk *task.Task) error {
+				saved = tsk
+				return nil
+			},
+		}
+
+		rec := cancel(NewHandler(repo))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, saved)
+		assert.Equal(t, task.StatusCancelled, saved.Status)
+		assert.Equal(t, "att_1", saved.ExecutionAttemptID)
+	})
+
+	t.Run("cancels every unfinished execution of a targeted task", func(t *testing.T) {
+		var cancelled []string
+		repo := &mockTaskRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+				return &task.Task{ID: id, Status: task.StatusRunning, AgentIDs: []string{"agt_1", "agt_2", "agt_3"}}, nil
+			},
+			findExecutionsFunc: func(ctx context.Context, taskID string) ([]task.Execution, error) {
+				return []task.Execution{
+					{AgentID: "agt_1", AttemptID: "att_1", Status: task.StatusCompleted},
+					{AgentID: "agt_2", AttemptID: "att_2", Status: task.StatusRunning},
+					{AgentID: "agt_3", Status: task.StatusPending},
+				}, nil
+			},
+			updateExecutionFunc: func(ctx context.Context, taskID, agentID string, result task.Execution) (*task.Execution, error) {
+				assert.Equal(t, task.StatusCancelled, result.Status)
+				cancelled = append(cancelled, agentID+"/"+result.AttemptID)
+				return &result, nil
+			},
+		}
+
+		rec := cancel(NewHandler(repo))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"agt_2/att_2", "agt_3/"}, cancelled)
+	})
+
+	t.Run("returns 409 for a finished task", func(t *testing.T) {
+		repo := &mockTaskRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+				return &task.Task{ID: id, Status: task.StatusCompleted, ClaimedBy: "agt_1"}, nil
+			},
+			updateFunc: func(ctx context.Context, tsk *task.Task) error {
+				return task.ValidateTransition(task.StatusCompleted, tsk.Status)
+			},
+		}
+
+		assert.Equal(t, http.StatusConflict, cancel(NewHandler(repo)).Code)
+	})
+}
+
+func TestHandler_UpdateTargetedTask(t *testing.T) {
+	targeted := func(ctx context.Context, id string) (*task.Task, error) {
+		return &task.Task{ID: id, AgentIDs: []string{"agt_1", "agt_2"}}, nil
+	}
+
+	newUpdateContext := func(agentID string) (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		e.Validator = validator.New()
+		body := []byte(`{"status":"completed","output":"up 3 days","exit_code":0}`)
+		req := httptest.NewRequest(http.MethodPut, "/tasks/tsk_123", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if agentID != "" {
+			agentauth.SetAgent(c, agentID, agent.AccessActive)
+		}
+		c.SetParamNames("id")
+		c.SetParamValues("tsk_123")
+		return c, rec
+	}
+
+	t.Run("should record the result against the reporting agent", func(t *testing.T) {
+		var gotTask, gotAgent string
+		repo := &mockTaskRepository{
+			findByIDFunc: targeted,
+			updateExecutionFunc: func(ctx context.Context, taskID, agentID string, result task.Execution) (*task.Execution, error) {
+				gotTask, gotAgent = taskID, agentID
+				result.ID = "exe_1"
+				return &result, nil
+			},
+		}
+		c, rec := newUpdateContext("agt_2")
+
+		require.NoError(t, NewHandler(repo).Update(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "tsk_123", gotTask)
+		assert.Equal(t, "agt_2", gotAgent)
+
+		var execution task.Execution
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &execution))
+		assert.Equal(t, "up 3 days", execution.Output)
+	})
+
+	t.Run("should return 404 for an agent the task is not assigned to", func(t *testing.T) {
+		repo := &mockTaskRepository{
+			findByIDFunc: targeted,
+			updateExecutionFunc: func(ctx context.Context, taskID, agentID string, result task.Execution) (*task.Execution, error) {
+				return nil, task.ErrExecutionNotFound
+			},
+		}
+		c, rec := newUpdateContext("agt_9")
+
+		require.NoError(t, NewHandler(repo).Update(c))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("should return 401 without a reporting agent", func(t *testing.T) {
+		repo := &mockTaskRepository{findByIDFunc: targeted}
+		c, rec := newUpdateContext("")
+
+		require.NoError(t, NewHandler(repo).Update(c))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestHandler_UpdateLifecycle(t *testing.T) {
+	newUpdateContext := func(body, agentID string) (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		e.Validator = validator.New()
+		req := httptest.NewRequest(http.MethodPut, "/tasks/tsk_123", bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if agentID != "" {
+			agentauth.SetAgent(c, agentID, agent.AccessActive)
+		}
+		c.SetParamNames("id")
+		c.SetParamValues("tsk_123")
+		return c, rec
+	}
+	claimed := func(ctx context.Context, id string) (*task.Task, error) {
+		return &task.Task{ID: id, Status: task.StatusClaimed, ClaimedBy: "agt_1", ExecutionAttemptID: "att_1"}, nil
+	}
+
+	t.Run("should renew the lease when the agent reports running", func(t *testing.T) {
+		var saved *task.Task
+		repo := &mockTaskRepository{
+			findByIDFunc: claimed,
+			updateFunc: func(ctx context.Context, tsk *task.Task) error {
+				saved = tsk
+				return nil
+			},
+		}
+		c, rec := newUpdateContext(`{"status":"running","execution_attempt_id":"att_1"}`, "agt_1")
+
+		require.NoError(t, NewHandler(repo).WithLeases(0, time.Hour).Update(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, saved.LeaseExpiresAt)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *saved.LeaseExpiresAt, time.Minute)
+	})
+
+	t.Run("should return 409 for another agent's claim", func(t *testing.T) {
+		repo := &mockTaskRepository{findByIDFunc: claimed}
+		c, rec := newUpdateContext(`{"status":"running"}`, "agt_2")
+
+		require.NoError(t, NewHandler(repo).Update(c))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("should return 409 for a stale execution attempt", func(t *testing.T) {
+		repo := &mockTaskRepository{findByIDFunc: claimed}
+		c, rec := newUpdateContext(`{"status":"completed","execution_attempt_id":"att_0"}`, "agt_1")
+
+		require.NoError(t, NewHandler(repo).Update(c))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("should return 409 for an invalid transition", func(t *testing.T) {
+		repo := &mockTaskRepository{
+			findByIDFunc: claimed,
+			updateFunc: func(ctx context.Context, tsk *task.Task) error {
+				return task.ValidateTransition(task.StatusCompleted, tsk.Status)
+			},
+		}
+		c, rec := newUpdateContext(`{"status":"running"}`, "agt_1")
+
+		require.NoError(t, NewHandler(repo).Update(c))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("should return 400 for an unknown status", func(t *testing.T) {
+		repo := &mockTaskRepository{findByIDFunc: claimed}
+		c, rec := newUpdateContext(`{"status":"done"}`, "agt_1")
+
+		require.NoError(t, NewHandler(repo).Update(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+type mockPublisher struct {
+	events []string
+	data   []any
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, eventType string, data any) error {
+	m.events = append(m.events, eventType)
+	m.data = append(m.data, data)
+	return nil
+}
+
+func TestHandler_UpdatePublishesWebhooks(t *testing.T) {
+	report := func(handler *Handler, body string) *httptest.ResponseRecorder {
+		e := echo.New()
+		e.Validator = validator.New()
+		req := httptest.NewRequest(http.MethodPut, "/tasks/tsk_123", bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		agentauth.SetAgent(c, "agt_1", agent.AccessActive)
+		c.SetParamNames("id")
+		c.SetParamValues("tsk_123")
+		require.NoError(t, handler.Update(c))
+		return rec
+	}
+	running := func(ctx context.Context, id string) (*task.Task, error) {
+		return &task.Task{ID: id, Command: "uptime", Status: task.StatusRunning, ClaimedBy: "agt_1"}, nil
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		event string
+	}{
+		{"completed", `{"status":"completed","exit_code":0}`, webhook.EventTaskCompleted},
+		{"completed with non-zero exit", `{"status":"completed","exit_code":2}`, webhook.EventTaskFailed},
+		{"failed", `{"status":"failed","error":"boom"}`, webhook.EventTaskFailed},
+		{"timed out", `{"status":"timed_out"}`, webhook.EventTaskFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &mockPublisher{}
+			handler := NewHandler(&mockTaskRepository{findByIDFunc: running}).WithPublisher(publisher)
+
+			rec := report(handler, tt.body)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, []string{tt.event}, publisher.events)
+			data := publisher.data[0].(webhook.TaskData)
+			assert.Equal(t, "tsk_123", data.ID)
+			assert.Equal(t, "agt_1", data.AgentID)
+		})
+	}
+
+	t.Run("publishes nothing for cancelled or unfinished tasks", func(t *testing.T) {
+		publisher := &mockPublisher{}
+		handler := NewHandler(&mockTaskRepository{findByIDFunc: running}).WithPublisher(publisher)
+
+		report(handler, `{"status":"cancelled"}`)
+		report(handler, `{"status":"running"}`)
+
+		assert.Empty(t, publisher.events)
+	})
+
+	t.Run("publishes once a targeted task finishes", func(t *testing.T) {
+		calls := 0
+		repo := &mockTaskRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+				calls++
+				status := task.StatusRunning
+				if calls > 1 {
+					status = task.StatusFailed
+				}
+				return &task.Task{ID: id, Status: status, AgentIDs: []string{"agt_1", "agt_2"}}, nil
+			},
+		}
+		publisher := &mockPublisher{}
+		handler := NewHandler(repo).WithPublisher(publisher)
+
+		rec := report(handler, `{"status":"failed","exit_code":1}`)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, []string{webhook.EventTaskFailed}, publisher.events)
+		assert.Equal(t, []string{"agt_1", "agt_2"}, publisher.data[0].(webhook.TaskData).AgentIDs)
+	})
+}
+
+type mockOutputRepository struct {
+	chunks []task.OutputChunk
+}
+
+func (m *mockOutputRepository) AppendOutput(ctx context.Context, chunk *task.OutputChunk) error {
+	chunk.Sequence = int64(len(m.chunks) + 1)
+	m.chunks = append(m.chunks, *chunk)
+	return nil
+}
+
+func (m *mockOutputRepository) FindOutput(ctx context.Context, taskID string, afterSequence int64, limit int) ([]task.OutputChunk, error) {
+	var found []task.OutputChunk
+	for _, chunk := range m.chunks {
+		if chunk.TaskID == taskID && chunk.Sequence > afterSequence {
+			found = append(found, chunk)
+		}
+	}
+	return found, nil
+}
+
+func TestHandler_ReportOutput(t *testing.T) {
+	running := func(ctx context.Context, id string) (*task.Task, error) {
+		return &task.Task{ID: id, Status: task.StatusRunning, ClaimedBy: "agt_1", ExecutionAttemptID: "att_1"}, nil
+	}
+
+	send := func(handler *Handler, agentID string, body string) *httptest.ResponseRecorder {
+		e := echo.New()
+		e.Validator = validator.New()
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if agentID != "" {
+			agentauth.SetAgent(c, agentID, agent.AccessActive)
+		}
+		c.SetParamNames("id")
+		c.SetParamValues("tsk_1")
+		require.NoError(t, handler.ReportOutput(c))
+		return rec
+	}
+
+	t.Run("stores output from the claiming agent", func(t *testing.T) {
+		output := &mockOutputRepository{}
+		handler := NewHandler(&mockTaskRepository{findByIDFunc: running}).WithOutput(output)
+
+		rec := send(handler, "agt_1", `{"execution_attempt_id":"att_1","stream":"stderr","sequence":3,"data":"oops\n"}`)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		require.Len(t, output.chunks, 1)
+		assert.Equal(t, "tsk_1", output.chunks[0].TaskID)
+		assert.Equal(t, "agt_1", output.chunks[0].AgentID)
+		assert.Equal(t, task.StreamStderr, output.chunks[0].Stream)
+		assert.Equal(t, int64(3), output.chunks[0].AgentSequence)
+		assert.Equal(t, "oops\n", output.chunks[0].Data)
+	})
+
+	t.Run("rejects output from another agent or attempt", func(t *testing.T) {
+		output := &mockOutputRepository{}
+		handler := NewHandler(&mockTaskRepository{findByIDFunc: running}).WithOutput(output)
+
+		assert.Equal(t, http.StatusConflict, send(handler, "agt_2", `{"stream":"stdout","data":"x"}`).Code)
+		assert.Equal(t, http.StatusConflict, send(handler, "agt_1", `{"execution_attempt_id":"att_0","stream":"stdout","data":"x"}`).Code)
+		assert.Empty(t, output.chunks)
+	})
+
+	t.Run("rejects output for a finished task", func(t *testing.T) {
+		repo := &mockTaskRepository{findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+			return &task.Task{ID: id, Status: task.StatusCompleted, ClaimedBy: "agt_1"}, nil
+		}}
+		handler := NewHandler(repo).WithOutput(&mockOutputRepository{})
+
+		assert.Equal(t, http.StatusConflict, send(handler, "agt_1", `{"stream":"stdout","data":"x"}`).Code)
+	})
+
+	t.Run("accepts output for the agent's execution of a targeted task", func(t *testing.T) {
+		repo := &mockTaskRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+				return &task.Task{ID: id, Status: task.StatusRunning, AgentIDs: []string{"agt_1", "agt_2"}}, nil
+			},
+			findExecutionsFunc: func(ctx context.Context, taskID string) ([]task.Execution, error) {
+				return []task.Execution{
+					{AgentID: "agt_1", AttemptID: "att_1", Status: task.StatusCompleted},
+					{AgentID: "agt_2", AttemptID: "att_2", Status: task.StatusRunning},
+				}, nil
+			},
+		}
+		handler := NewHandler(repo).WithOutput(&mockOutputRepository{})
+
+		assert.Equal(t, http.StatusNoContent, send(handler, "agt_2", `{"execution_attempt_id":"att_2","stream":"stdout","data":"x"}`).Code)
+		assert.Equal(t, http.StatusConflict, send(handler, "agt_1", `{"stream":"stdout","data":"x"}`).Code)
+		assert.Equal(t, http.StatusConflict, send(handler, "agt_3", `{"stream":"stdout","data":"x"}`).Code)
+	})
+
+	t.Run("validates the request", func(t *testing.T) {
+		handler := NewHandler(&mockTaskRepository{findByIDFunc: running}).WithOutput(&mockOutputRepository{})
+
+		assert.Equal(t, http.StatusBadRequest, send(handler, "agt_1", `{"stream":"stdin","data":"x"}`).Code)
+	})
+
+	t.Run("rejects output without an authenticated agent", func(t *testing.T) {
+		output := &mockOutputRepository{}
+		handler := NewHandler(&mockTaskRepository{findByIDFunc: running}).WithOutput(output)
+		e := echo.New()
+		e.Validator = validator.New()
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"execution_attempt_id":"att_1","stream":"stdout","data":"x"}`)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Agent-ID", "agt_1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("tsk_1")
+
+		require.NoError(t, handler.ReportOutput(c))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "the X-Agent-ID header alone does not identify an agent")
+		assert.Empty(t, output.chunks)
+	})
+}
+
+func TestHandler_Stream(t *testing.T) {
+	output := &mockOutputRepository{chunks: []task.OutputChunk{
+		{TaskID: "tsk_1", Sequence: 1, Stream: task.StreamStdout, Data: "one\n"},
+		{TaskID: "tsk_1", Sequence: 2, Stream: task.StreamStderr, Data: "two\n"},
+		{TaskID: "tsk_1", Sequence: 3, Stream: task.StreamStdout, Data: "three\n"},
+	}}
+
+	stream := func(repo *mockTaskRepository, target string, header map[string]string) string {
+		handler := NewHandler(repo).WithOutput(output)
+		handler.streamPoll = time.Millisecond
+
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("tsk_1")
+		require.NoError(t, handler.Stream(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/event-stream", rec.Header().Get(echo.HeaderContentType))
+		return rec.Body.String()
+	}
+
+	t.Run("sends output and status changes until the task finishes", func(t *testing.T) {
+		calls := 0
+		repo := &mockTaskRepository{findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+			calls++
+			if calls < 3 {
+				return &task.Task{ID: id, Status: task.StatusRunning}, nil
+			}
+			return &task.Task{ID: id, Status: task.StatusCompleted, ExitCode: 3}, nil
+		}}
+
+		body := stream(repo, "/", nil)
+
+		assert.Equal(t, "id: 1\nevent: output\ndata: {\"task_id\":\"tsk_1\",\"sequence\":1,\"agent_id\":\"\",\"stream\":\"stdout\",\"data\":\"one\\n\",\"created_at\":\"0001-01-01T00:00:00Z\"}\n\n"+
+			"id: 2\nevent: output\ndata: {\"task_id\":\"tsk_1\",\"sequence\":2,\"agent_id\":\"\",\"stream\":\"stderr\",\"data\":\"two\\n\",\"created_at\":\"0001-01-01T00:00:00Z\"}\n\n"+
+			"id: 3\nevent: output\ndata: {\"task_id\":\"tsk_1\",\"sequence\":3,\"agent_id\":\"\",\"stream\":\"stdout\",\"data\":\"three\\n\",\"created_at\":\"0001-01-01T00:00:00Z\"}\n\n"+
+			"event: status\ndata: {\"status\":\"running\",\"exit_code\":0}\n\n"+
+			"event: done\ndata: {\"status\":\"completed\",\"exit_code\":3}\n\n",
+			body)
+	})
+
+	t.Run("resumes after since or Last-Event-ID", func(t *testing.T) {
+		repo := &mockTaskRepository{findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+			return &task.Task{ID: id, Status: task.StatusFailed}, nil
+		}}
+
+		body := stream(repo, "/?since=1", nil)
+		assert.NotContains(t, body, "id: 1\n")
+		assert.Contains(t, body, "id: 2\n")
+		assert.Contains(t, body, "event: done\ndata: {\"status\":\"failed\",\"exit_code\":0}")
+
+		body = stream(repo, "/?since=1", map[string]string{"Last-Event-ID": "2"})
+		assert.NotContains(t, body, "id: 2\n")
+		assert.Contains(t, body, "id: 3\n")
+	})
+
+	t.Run("reports the first failing execution's exit code", func(t *testing.T) {
+		repo := &mockTaskRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+				return &task.Task{ID: id, Status: task.StatusFailed, AgentIDs: []string{"agt_1", "agt_2"}}, nil
+			},
+			findExecutionsFunc: func(ctx context.Context, taskID string) ([]task.Execution, error) {
+				return []task.Execution{{AgentID: "agt_1"}, {AgentID: "agt_2", ExitCode: 2}}, nil
+			},
+		}
+
+		body := stream(repo, "/?since=3", nil)
+		assert.Equal(t, "event: done\ndata: {\"status\":\"failed\",\"exit_code\":2}\n\n", body)
+	})
+}
+
+type mockAgentFinder struct {
+	agents map[string]*agent.Agent
+}
+
+func (m *mockAgentFinder) FindByID(ctx context.Context, id string) (*agent.Agent, error) {
+	if a, ok := m.agents[id]; ok {
+		return a, nil
+	}
+	return nil, agent.ErrAgentNotFound
+}
+
+type mockAuthenticator struct{}
+
+func (mockAuthenticator) Authenticate(ctx context.Context, token string) (*operator.Operator, *operator.Token, error) {
+	switch token {
+	case "staging":
+		return &operator.Operator{ID: "opr_staging", Role: operator.RoleOperator, Scope: []string{"env=staging"}}, nil, nil
+	case "admin":
+		return &operator.Operator{ID: "opr_admin", Role: operator.RoleAdmin}, nil, nil
+	}
+	return nil, nil, errors.New("invalid token")
+}
+
+func TestHandler_OperatorScope(t *testing.T) {
+	tasks := map[string]*task.Task{
+		"tsk_staging":    {ID: "tsk_staging", Status: task.StatusPending, AgentIDs: []string{"agt_staging"}},
+		"tsk_production": {ID: "tsk_production", Status: task.StatusPending, AgentIDs: []string{"agt_staging", "agt_production"}},
+		"tsk_any":        {ID: "tsk_any", Status: task.StatusPending},
+	}
+	var created *task.Task
+	repo := &mockTaskRepository{
+		createFunc: func(ctx context.Context, t *task.Task) error {
+			created = t
+			return nil
+		},
+		findAllFunc: func(ctx context.Context, tf task.TaskFilters) ([]task.Task, error) {
+			return []task.Task{*tasks["tsk_staging"], *tasks["tsk_production"], *tasks["tsk_any"]}, nil
+		},
+		findByIDFunc: func(ctx context.Context, id string) (*task.Task, error) {
+			return tasks[id], nil
+		},
+		findExecutionsFunc: func(ctx context.Context, taskID string) ([]task.Execution, error) {
+			return []task.Execution{}, nil
+		},
+	}
+	agents := &mockAgentFinder{agents: map[string]*agent.Agent{
+		"agt_staging":    {ID: "agt_staging", Tags: []agent.AgentTag{{Key: "env", Value: "staging"}}},
+		"agt_production": {ID: "agt_production", Tags: []agent.AgentTag{{Key: "env", Value: "production"}}},
+	}}
+
+	e := echo.New()
+	e.Validator = validator.New()
+	NewHandler(repo).WithAgents(agents).RegisterRoutes(e.Group("/tasks", operatorauth.New(mockAuthenticator{})))
+	serve := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("creates tasks for agents in scope", func(t *testing.T) {
+		created = nil
+		rec := serve(http.MethodPost, "/tasks", `{"command":"uptime","agent_ids":["agt_staging"]}`, "staging")
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		require.NotNil(t, created)
+	})
+
+	t.Run("rejects untargeted and out of scope tasks", func(t *testing.T) {
+		created = nil
+		rec := serve(http.MethodPost, "/tasks", `{"command":"uptime"}`, "staging")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		rec = serve(http.MethodPost, "/tasks", `{"command":"uptime","agent_ids":["agt_staging","agt_production"]}`, "staging")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "agt_production")
+
+		rec = serve(http.MethodPost, "/tasks", `{"command":"uptime","agent_ids":["agt_unknown"]}`, "staging")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Nil(t, created)
+	})
+
+	t.Run("hides tasks outside the scope", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/tasks", "", "staging")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var listed []task.Task
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+		require.Len(t, listed, 1)
+		assert.Equal(t, "tsk_staging", listed[0].ID)
+
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/tasks/tsk_staging", "", "staging").Code)
+		for _, path := range []string{"/tasks/tsk_production", "/tasks/tsk_any", "/tasks/tsk_any/executions"} {
+			assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, path, "", "staging").Code, path)
+		}
+	})
+
+	t.Run("leaves unscoped operators unrestricted", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/tasks", "", "admin")
+		var listed []task.Task
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+		assert.Len(t, listed, 3)
+
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/tasks/tsk_any", "", "admin").Code)
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/tasks", `{"command":"uptime"}`, "admin").Code)
+	})
+}
+
+// mockSecretFinder has the secrets listed per agent.
+type mockSecretFinder map[string][]string
+
+func (m mockSecretFinder) FindByNames(ctx context.Context, agentID string, names []string) ([]secret.Secret, error) {
+	var found []secret.Secret
+	for _, name := range names {
+		for _, has := range m[agentID] {
+			if has == name {
+				found = append(found, secret.Secret{AgentID: agentID, Name: name})
+			}
+		}
+	}
+	return found, nil
+}
+
+func TestHandler_CreateWithSecrets(t *testing.T) {
+	create := func(handler *Handler, req TaskRequest) *httptest.ResponseRecorder {
+		e := echo.New()
+		e.Validator = validator.New()
+		body, _ := json.Marshal(req)
+		httpReq := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		httpReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		require.NoError(t, handler.Create(e.NewContext(httpReq, rec)))
+		return rec
+	}
+	secrets := mockSecretFinder{"agt_1": {"db_password", "api_token"}, "agt_2": {"db_password"}}
+
+	t.Run("stores the env secrets of the task", func(t *testing.T) {
+		var created *task.Task
+		repo := &mockTaskRepository{createFunc: func(ctx context.Context, tsk *task.Task) error {
+			created = tsk
+			return nil
+		}}
+
+		rec := create(NewHandler(repo).WithSecrets(secrets), TaskRequest{
+			Command:    `psql "postgres://app:{{secret:db_password}}@db/app"`,
+			EnvSecrets: []string{"api_token"},
+			AgentIDs:   []string{"agt_1"},
+		})
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		require.NotNil(t, created)
+		assert.Equal(t, []string{"api_token"}, created.EnvSecrets)
+		var response TaskResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, []string{"api_token"}, response.EnvSecrets)
+	})
+
+	t.Run("rejects a target agent missing a secret", func(t *testing.T) {
+		rec := create(NewHandler(&mockTaskRepository{}).WithSecrets(secrets), TaskRequest{
+			Command:    "echo {{secret:db_password}}",
+			EnvSecrets: []string{"api_token"},
+			AgentIDs:   []string{"agt_1", "agt_2"},
+		})
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Agent agt_2 has no secret api_token")
+	})
+
+	t.Run("rejects an invalid secret name", func(t *testing.T) {
+		rec := create(NewHandler(&mockTaskRepository{}).WithSecrets(secrets), TaskRequest{
+			Command: "echo {{secret:db-password}}",
+		})
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("leaves untargeted tasks to the claiming agent", func(t *testing.T) {
+		rec := create(NewHandler(&mockTaskRepository{}).WithSecrets(secrets), TaskRequest{
+			Command: "echo {{secret:unknown}}",
+		})
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
 }
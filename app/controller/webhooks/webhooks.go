@@ -0,0 +1,256 @@
+// Package webhooks manages webhook subscriptions and exposes their delivery
+// log.
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"hostlink/app/middleware/auditlog"
+	"hostlink/domain/webhook"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultDeliveriesLimit caps the deliveries returned without a limit.
+const defaultDeliveriesLimit = 50
+
+type (
+	Handler struct {
+		repo webhook.Repository
+	}
+	// SubscriptionRequest creates a subscription. A missing secret is
+	// generated, and a subscription is active unless Active is false.
+	SubscriptionRequest struct {
+		URL         string   `json:"url" validate:"required"`
+		Events      []string `json:"events" validate:"required"`
+		Secret      string   `json:"secret"`
+		Description string   `json:"description"`
+		Active      *bool    `json:"active"`
+	}
+	// SubscriptionUpdateRequest changes the fields that are set.
+	SubscriptionUpdateRequest struct {
+		URL         *string  `json:"url"`
+		Events      []string `json:"events"`
+		Description *string  `json:"description"`
+		Active      *bool    `json:"active"`
+	}
+)
+
+func NewHandler(repo webhook.Repository) *Handler {
+	return &Handler{repo: repo}
+}
+
+// Create adds a subscription and returns it with its secret, which is not
+// shown again.
+func (h *Handler) Create(c echo.Context) error {
+	var req SubscriptionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+	if err := validateURL(req.URL); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := validateEvents(req.Events); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		generated, err := generateSecret()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to generate secret: " + err.Error(),
+			})
+		}
+		secret = generated
+	}
+
+	subscription := &webhook.Subscription{
+		URL:         req.URL,
+		Secret:      secret,
+		Events:      req.Events,
+		Description: req.Description,
+		Active:      req.Active == nil || *req.Active,
+	}
+	if err := h.repo.CreateSubscription(c.Request().Context(), subscription); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to create webhook: " + err.Error(),
+		})
+	}
+
+	entry := auditlog.EntryFrom(c)
+	entry.Target = subscription.ID
+	entry.SetDetail(map[string]any{"url": subscription.URL, "events": subscription.Events, "active": subscription.Active})
+	return c.JSON(http.StatusCreated, subscription)
+}
+
+func (h *Handler) Index(c echo.Context) error {
+	subscriptions, err := h.repo.FindSubscriptions(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch webhooks: " + err.Error(),
+		})
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+
+	return c.JSON(http.StatusOK, subscriptions)
+}
+
+func (h *Handler) Show(c echo.Context) error {
+	subscription, err := h.find(c)
+	if err != nil {
+		return err
+	}
+	if subscription == nil {
+		return nil
+	}
+	subscription.Secret = ""
+
+	return c.JSON(http.StatusOK, subscription)
+}
+
+func (h *Handler) Update(c echo.Context) error {
+	var req SubscriptionUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	auditlog.EntryFrom(c).SetDetail(req)
+
+	subscription, err := h.find(c)
+	if err != nil || subscription == nil {
+		return err
+	}
+
+	if req.URL != nil {
+		if err := validateURL(*req.URL); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		subscription.URL = *req.URL
+	}
+	if req.Events != nil {
+		if err := validateEvents(req.Events); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		subscription.Events = req.Events
+	}
+	if req.Description != nil {
+		subscription.Description = *req.Description
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+
+	if err := h.repo.UpdateSubscription(c.Request().Context(), subscription); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to update webhook: " + err.Error(),
+		})
+	}
+	subscription.Secret = ""
+
+	return c.JSON(http.StatusOK, subscription)
+}
+
+func (h *Handler) Delete(c echo.Context) error {
+	err := h.repo.DeleteSubscription(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, webhook.ErrSubscriptionNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Webhook not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to delete webhook: " + err.Error(),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Deliveries lists a subscription's deliveries, newest first. The optional
+// limit query parameter caps the result (default 50).
+func (h *Handler) Deliveries(c echo.Context) error {
+	limit := defaultDeliveriesLimit
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "limit must be a positive integer",
+			})
+		}
+		limit = parsed
+	}
+
+	subscription, err := h.find(c)
+	if err != nil || subscription == nil {
+		return err
+	}
+
+	deliveries, err := h.repo.FindDeliveries(c.Request().Context(), subscription.ID, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch deliveries: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// find loads the subscription named by the id parameter. When it returns a
+// nil subscription, the error response has already been written.
+func (h *Handler) find(c echo.Context) (*webhook.Subscription, error) {
+	subscription, err := h.repo.FindSubscription(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, webhook.ErrSubscriptionNotFound) {
+		return nil, c.JSON(http.StatusNotFound, map[string]string{"error": "Webhook not found"})
+	}
+	if err != nil {
+		return nil, c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch webhook: " + err.Error(),
+		})
+	}
+	return subscription, nil
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+func validateEvents(events []string) error {
+	if len(events) == 0 {
+		return errors.New("at least one event is required")
+	}
+	for _, event := range events {
+		if !webhook.ValidEvent(event) {
+			return errors.New("unknown event " + event + "; valid events: " + strings.Join(webhook.Events, ", "))
+		}
+	}
+	return nil
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+func (h *Handler) RegisterRoutes(g *echo.Group) {
+	g.POST("", h.Create)
+	g.GET("", h.Index)
+	g.GET("/:id", h.Show)
+	g.PUT("/:id", h.Update)
+	g.DELETE("/:id", h.Delete)
+	g.GET("/:id/deliveries", h.Deliveries)
+}
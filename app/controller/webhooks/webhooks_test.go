@@ -0,0 +1,190 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hostlink/domain/webhook"
+	"hostlink/internal/validator"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockWebhookRepository struct {
+	webhook.Repository
+	subscriptions map[string]*webhook.Subscription
+	deliveries    []webhook.Delivery
+	deliveryLimit int
+}
+
+func newMockRepository() *mockWebhookRepository {
+	return &mockWebhookRepository{subscriptions: map[string]*webhook.Subscription{}}
+}
+
+func (m *mockWebhookRepository) CreateSubscription(ctx context.Context, s *webhook.Subscription) error {
+	s.ID = "whk_1"
+	stored := *s
+	m.subscriptions[s.ID] = &stored
+	return nil
+}
+
+func (m *mockWebhookRepository) UpdateSubscription(ctx context.Context, s *webhook.Subscription) error {
+	stored := *s
+	m.subscriptions[s.ID] = &stored
+	return nil
+}
+
+func (m *mockWebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	if _, ok := m.subscriptions[id]; !ok {
+		return webhook.ErrSubscriptionNotFound
+	}
+	delete(m.subscriptions, id)
+	return nil
+}
+
+func (m *mockWebhookRepository) FindSubscription(ctx context.Context, id string) (*webhook.Subscription, error) {
+	s, ok := m.subscriptions[id]
+	if !ok {
+		return nil, webhook.ErrSubscriptionNotFound
+	}
+	found := *s
+	return &found, nil
+}
+
+func (m *mockWebhookRepository) FindSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	subscriptions := []webhook.Subscription{}
+	for _, s := range m.subscriptions {
+		subscriptions = append(subscriptions, *s)
+	}
+	return subscriptions, nil
+}
+
+func (m *mockWebhookRepository) FindDeliveries(ctx context.Context, subscriptionID string, limit int) ([]webhook.Delivery, error) {
+	m.deliveryLimit = limit
+	return m.deliveries, nil
+}
+
+func serve(repo webhook.Repository, method, path, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Validator = validator.New()
+	NewHandler(repo).RegisterRoutes(e.Group("/webhooks"))
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCreate(t *testing.T) {
+	t.Run("creates an active subscription with a generated secret", func(t *testing.T) {
+		repo := newMockRepository()
+
+		rec := serve(repo, http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com","events":["task.failed","agent.offline"]}`)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		var resp webhook.Subscription
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "whk_1", resp.ID)
+		assert.True(t, resp.Active)
+		assert.True(t, strings.HasPrefix(resp.Secret, "whsec_"))
+		assert.Equal(t, []string{"task.failed", "agent.offline"}, resp.Events)
+		assert.Equal(t, resp.Secret, repo.subscriptions["whk_1"].Secret)
+	})
+
+	t.Run("keeps a given secret", func(t *testing.T) {
+		repo := newMockRepository()
+
+		rec := serve(repo, http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com","events":["task.completed"],"secret":"mine","active":false}`)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "mine", repo.subscriptions["whk_1"].Secret)
+		assert.False(t, repo.subscriptions["whk_1"].Active)
+	})
+
+	t.Run("rejects unknown events", func(t *testing.T) {
+		rec := serve(newMockRepository(), http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com","events":["task.exploded"]}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "unknown event task.exploded")
+	})
+
+	t.Run("rejects relative URLs", func(t *testing.T) {
+		rec := serve(newMockRepository(), http.MethodPost, "/webhooks", `{"url":"/hooks","events":["task.failed"]}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestShowAndIndexHideSecrets(t *testing.T) {
+	repo := newMockRepository()
+	repo.subscriptions["whk_1"] = &webhook.Subscription{ID: "whk_1", Secret: "s3cret", Events: []string{"task.failed"}}
+
+	rec := serve(repo, http.MethodGet, "/webhooks/whk_1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "s3cret")
+
+	rec = serve(repo, http.MethodGet, "/webhooks", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "s3cret")
+
+	rec = serve(repo, http.MethodGet, "/webhooks/whk_missing", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUpdate(t *testing.T) {
+	t.Run("changes only the given fields", func(t *testing.T) {
+		repo := newMockRepository()
+		repo.subscriptions["whk_1"] = &webhook.Subscription{ID: "whk_1", URL: "https://a.example.com", Secret: "s3cret", Events: []string{"task.failed"}, Active: true}
+
+		rec := serve(repo, http.MethodPut, "/webhooks/whk_1", `{"active":false,"events":["agent.offline"]}`)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		stored := repo.subscriptions["whk_1"]
+		assert.False(t, stored.Active)
+		assert.Equal(t, []string{"agent.offline"}, stored.Events)
+		assert.Equal(t, "https://a.example.com", stored.URL)
+		assert.Equal(t, "s3cret", stored.Secret)
+		assert.NotContains(t, rec.Body.String(), "s3cret")
+	})
+
+	t.Run("rejects an empty event list", func(t *testing.T) {
+		repo := newMockRepository()
+		repo.subscriptions["whk_1"] = &webhook.Subscription{ID: "whk_1", Events: []string{"task.failed"}}
+
+		rec := serve(repo, http.MethodPut, "/webhooks/whk_1", `{"events":[]}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestDelete(t *testing.T) {
+	repo := newMockRepository()
+	repo.subscriptions["whk_1"] = &webhook.Subscription{ID: "whk_1"}
+
+	assert.Equal(t, http.StatusNoContent, serve(repo, http.MethodDelete, "/webhooks/whk_1", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(repo, http.MethodDelete, "/webhooks/whk_1", "").Code)
+}
+
+func TestDeliveries(t *testing.T) {
+	repo := newMockRepository()
+	repo.subscriptions["whk_1"] = &webhook.Subscription{ID: "whk_1"}
+	repo.deliveries = []webhook.Delivery{{ID: "whd_1", Status: webhook.DeliveryDelivered, Attempts: 1}}
+
+	rec := serve(repo, http.MethodGet, "/webhooks/whk_1/deliveries?limit=5", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 5, repo.deliveryLimit)
+	var deliveries []webhook.Delivery
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &deliveries))
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "whd_1", deliveries[0].ID)
+
+	rec = serve(repo, http.MethodGet, "/webhooks/whk_1/deliveries?limit=-1", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
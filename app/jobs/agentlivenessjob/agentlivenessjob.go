@@ -0,0 +1,66 @@
+// Package agentlivenessjob periodically marks agents that stopped sending
+// heartbeats as stale or offline
+package agentlivenessjob
+
+import (
+	"context"
+	"sync"
+
+	"hostlink/domain/agent"
+)
+
+// Sweeper updates agent statuses from when agents were last seen.
+type Sweeper interface {
+	Sweep(ctx context.Context) ([]agent.StatusEvent, error)
+}
+
+type TriggerFunc func(context.Context, func() error)
+
+type Config struct {
+	Trigger TriggerFunc
+}
+
+type AgentLivenessJob struct {
+	config Config
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() AgentLivenessJob {
+	return NewWithConfig(Config{
+		Trigger: Trigger,
+	})
+}
+
+func NewWithConfig(cfg Config) AgentLivenessJob {
+	if cfg.Trigger == nil {
+		cfg.Trigger = Trigger
+	}
+
+	return AgentLivenessJob{
+		config: cfg,
+	}
+}
+
+func (j *AgentLivenessJob) Register(ctx context.Context, svc Sweeper) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	j.cancel = cancel
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.config.Trigger(ctx, func() error {
+			_, err := svc.Sweep(ctx)
+			return err
+		})
+	}()
+
+	return cancel
+}
+
+func (j *AgentLivenessJob) Shutdown() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+}
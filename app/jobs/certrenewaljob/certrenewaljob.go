@@ -0,0 +1,57 @@
+// Package certrenewaljob periodically renews the agent's mTLS client certificate
+package certrenewaljob
+
+import (
+	"context"
+	"sync"
+
+	"hostlink/app/services/certrenewal"
+)
+
+type TriggerFunc func(context.Context, func() error)
+
+type Config struct {
+	Trigger TriggerFunc
+}
+
+type CertRenewalJob struct {
+	config Config
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() CertRenewalJob {
+	return NewWithConfig(Config{
+		Trigger: Trigger,
+	})
+}
+
+func NewWithConfig(cfg Config) CertRenewalJob {
+	if cfg.Trigger == nil {
+		cfg.Trigger = Trigger
+	}
+
+	return CertRenewalJob{
+		config: cfg,
+	}
+}
+
+func (j *CertRenewalJob) Register(ctx context.Context, svc certrenewal.Service) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	j.cancel = cancel
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.config.Trigger(ctx, svc.RenewIfNeeded)
+	}()
+
+	return cancel
+}
+
+func (j *CertRenewalJob) Shutdown() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+}
@@ -0,0 +1,57 @@
+// Package keyrotationjob periodically rotates the agent's key
+package keyrotationjob
+
+import (
+	"context"
+	"sync"
+
+	"hostlink/app/services/keyrotation"
+)
+
+type TriggerFunc func(context.Context, func() error)
+
+type Config struct {
+	Trigger TriggerFunc
+}
+
+type KeyRotationJob struct {
+	config Config
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() KeyRotationJob {
+	return NewWithConfig(Config{
+		Trigger: Trigger,
+	})
+}
+
+func NewWithConfig(cfg Config) KeyRotationJob {
+	if cfg.Trigger == nil {
+		cfg.Trigger = Trigger
+	}
+
+	return KeyRotationJob{
+		config: cfg,
+	}
+}
+
+func (j *KeyRotationJob) Register(ctx context.Context, svc keyrotation.Service) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	j.cancel = cancel
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.config.Trigger(ctx, svc.RotateIfDue)
+	}()
+
+	return cancel
+}
+
+func (j *KeyRotationJob) Shutdown() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+}
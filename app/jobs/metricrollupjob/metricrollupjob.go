@@ -0,0 +1,66 @@
+// Package metricrollupjob periodically downsamples stored agent metrics and
+// enforces their retention
+package metricrollupjob
+
+import (
+	"context"
+	"sync"
+
+	"hostlink/app/service/metricrollup"
+)
+
+// Roller rolls raw metrics up and prunes expired data.
+type Roller interface {
+	RollUp(ctx context.Context) (metricrollup.Result, error)
+}
+
+type TriggerFunc func(context.Context, func() error)
+
+type Config struct {
+	Trigger TriggerFunc
+}
+
+type MetricRollupJob struct {
+	config Config
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() MetricRollupJob {
+	return NewWithConfig(Config{
+		Trigger: Trigger,
+	})
+}
+
+func NewWithConfig(cfg Config) MetricRollupJob {
+	if cfg.Trigger == nil {
+		cfg.Trigger = Trigger
+	}
+
+	return MetricRollupJob{
+		config: cfg,
+	}
+}
+
+func (j *MetricRollupJob) Register(ctx context.Context, svc Roller) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	j.cancel = cancel
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.config.Trigger(ctx, func() error {
+			_, err := svc.RollUp(ctx)
+			return err
+		})
+	}()
+
+	return cancel
+}
+
+func (j *MetricRollupJob) Shutdown() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+}
@@ -0,0 +1,73 @@
+// Package noncecleanupjob periodically forgets request nonces whose
+// timestamps are too old to be accepted again
+package noncecleanupjob
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cleaner deletes nonces recorded more than olderThan ago.
+type Cleaner interface {
+	DeleteExpired(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+type TriggerFunc func(context.Context, func() error)
+
+type Config struct {
+	Trigger TriggerFunc
+	// MaxAge is how long a nonce is kept after the request was signed;
+	// zero uses DefaultMaxAge
+	MaxAge time.Duration
+}
+
+// DefaultMaxAge matches the timestamp window of request authentication.
+const DefaultMaxAge = 5 * time.Minute
+
+type NonceCleanupJob struct {
+	config Config
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() NonceCleanupJob {
+	return NewWithConfig(Config{
+		Trigger: Trigger,
+	})
+}
+
+func NewWithConfig(cfg Config) NonceCleanupJob {
+	if cfg.Trigger == nil {
+		cfg.Trigger = Trigger
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = DefaultMaxAge
+	}
+	return NonceCleanupJob{
+		config: cfg,
+	}
+}
+
+func (j *NonceCleanupJob) Register(ctx context.Context, store Cleaner) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	j.cancel = cancel
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.config.Trigger(ctx, func() error {
+			_, err := store.DeleteExpired(ctx, j.config.MaxAge)
+			return err
+		})
+	}()
+
+	return cancel
+}
+
+func (j *NonceCleanupJob) Shutdown() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+}
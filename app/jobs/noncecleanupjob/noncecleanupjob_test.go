@@ -0,0 +1,71 @@
+package noncecleanupjob
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockCleaner struct {
+	mock.Mock
+}
+
+func (m *MockCleaner) DeleteExpired(ctx context.Context, olderThan time.Duration) (int64, error) {
+	args := m.Called(olderThan)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func immediateTrigger(callCount int, done chan struct{}) TriggerFunc {
+	return func(ctx context.Context, fn func() error) {
+		for i := 0; i < callCount; i++ {
+			fn()
+		}
+		close(done)
+		<-ctx.Done()
+	}
+}
+
+// TestNewWithConfig_Defaults - nil trigger and zero max age use the defaults
+func TestNewWithConfig_Defaults(t *testing.T) {
+	job := NewWithConfig(Config{})
+	assert.NotNil(t, job.config.Trigger)
+	assert.Equal(t, DefaultMaxAge, job.config.MaxAge)
+}
+
+// TestRegister_DeletesExpiredNonces - trigger deletes nonces older than the max age
+func TestRegister_DeletesExpiredNonces(t *testing.T) {
+	store := new(MockCleaner)
+	store.On("DeleteExpired", 10*time.Minute).Return(int64(3), nil).Times(2)
+	done := make(chan struct{})
+	job := NewWithConfig(Config{Trigger: immediateTrigger(2, done), MaxAge: 10 * time.Minute})
+
+	cancel := job.Register(context.Background(), store)
+	<-done
+	cancel()
+	job.Shutdown()
+
+	store.AssertExpectations(t)
+}
+
+// TestTriggerWithConfig_RunsImmediatelyAndSurvivesErrors - a failed run does not stop the schedule
+func TestTriggerWithConfig_RunsImmediatelyAndSurvivesErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 3)
+	go TriggerWithConfig(ctx, func() error {
+		calls <- struct{}{}
+		return errors.New("database is locked")
+	}, TriggerConfig{Interval: 10 * time.Millisecond})
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-calls:
+		case <-time.After(time.Second):
+			t.Fatalf("cleanup ran %d times, want 3", i)
+		}
+	}
+}
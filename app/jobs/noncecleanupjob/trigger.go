@@ -0,0 +1,50 @@
+package noncecleanupjob
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+type TriggerConfig struct {
+	Interval time.Duration
+}
+
+func DefaultTriggerConfig() TriggerConfig {
+	return TriggerConfig{
+		Interval: time.Minute,
+	}
+}
+
+// TriggerWithConfig runs fn once immediately and then on every interval.
+func TriggerWithConfig(ctx context.Context, fn func() error, config TriggerConfig) {
+	if err := safeCall(fn); err != nil {
+		log.Errorf("nonce cleanup failed: %s", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(config.Interval):
+			if err := safeCall(fn); err != nil {
+				log.Errorf("nonce cleanup failed: %s", err)
+			}
+		}
+	}
+}
+
+func safeCall(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Panic recovered in nonce cleanup: %v", r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+func Trigger(ctx context.Context, fn func() error) {
+	TriggerWithConfig(ctx, fn, DefaultTriggerConfig())
+}
@@ -1,23 +1,29 @@
 package registrationjob
 
 import (
+	"errors"
 	"hostlink/app/services/agentregistrar"
 	"hostlink/app/services/agentstate"
 	"hostlink/app/services/fingerprint"
 	"hostlink/config/appconf"
+	"time"
 
 	"github.com/labstack/gommon/log"
 )
 
 type TriggerFunc func(func() error)
 
+// DefaultPendingApprovalInterval is how often a registration held for
+// approval is retried
+const DefaultPendingApprovalInterval = time.Minute
+
 type FingerprintManager interface {
 	LoadOrGenerate() (*fingerprint.FingerprintData, bool, error)
 }
 
 type Registrar interface {
 	PreparePublicKey() (string, error)
-	Register(fingerprint string, publicKey string, tags []agentregistrar.TagPair) (*agentregistrar.RegistrationResponse, error)
+	RegisterWithHardware(fingerprint string, publicKey string, tags []agentregistrar.TagPair, hw agentregistrar.Hardware) (*agentregistrar.RegistrationResponse, error)
 	GetDefaultTags() []agentregistrar.TagPair
 }
 
@@ -26,6 +32,9 @@ type Job struct {
 	fingerprintMgr FingerprintManager
 	registrar      Registrar
 	agentState     *agentstate.AgentState
+	// pendingInterval is how often a registration held for approval is
+	// retried. Held attempts do not count against the trigger's retries.
+	pendingInterval time.Duration
 }
 
 type Config struct {
@@ -34,6 +43,9 @@ type Config struct {
 	Registrar          Registrar
 	AgentState         *agentstate.AgentState
 	Trigger            TriggerFunc
+	// PendingApprovalInterval is how often a registration held for
+	// approval is retried (default: DefaultPendingApprovalInterval)
+	PendingApprovalInterval time.Duration
 }
 
 func New() *Job {
@@ -42,6 +54,8 @@ func New() *Job {
 		Registrar:       agentregistrar.New(),
 		AgentState:      agentstate.New(appconf.AgentStatePath()),
 		Trigger:         Trigger,
+
+		PendingApprovalInterval: appconf.RegistrationPendingInterval(),
 	})
 }
 
@@ -60,11 +74,17 @@ func NewWithConfig(cfg *Config) *Job {
 		registrar = agentregistrar.New()
 	}
 
+	pendingInterval := cfg.PendingApprovalInterval
+	if pendingInterval <= 0 {
+		pendingInterval = DefaultPendingApprovalInterval
+	}
+
 	return &Job{
-		trigger:        cfg.Trigger,
-		fingerprintMgr: fingerprintMgr,
-		registrar:      registrar,
-		agentState:     cfg.AgentState,
+		trigger:         cfg.Trigger,
+		fingerprintMgr:  fingerprintMgr,
+		registrar:       registrar,
+		agentState:      cfg.AgentState,
+		pendingInterval: pendingInterval,
 	}
 }
 
@@ -103,7 +123,16 @@ func (j *Job) Register(registeredChan chan<- bool) {
 
 		tags := j.registrar.GetDefaultTags()
 
-		response, err := j.registrar.Register(fingerprintData.Fingerprint, publicKey, tags)
+		hw := agentregistrar.Hardware{
+			Info:                fingerprintData.HardwareHash,
+			PreviousFingerprint: fingerprintData.PreviousFingerprint,
+		}
+		response, err := j.registrar.RegisterWithHardware(fingerprintData.Fingerprint, publicKey, tags, hw)
+		for errors.Is(err, agentregistrar.ErrPendingApproval) {
+			log.Infof("Registration awaiting operator approval (%v), checking again in %v", err, j.pendingInterval)
+			time.Sleep(j.pendingInterval)
+			response, err = j.registrar.RegisterWithHardware(fingerprintData.Fingerprint, publicKey, tags, hw)
+		}
 		if err != nil {
 			log.Errorf("Registration failed: %v", err)
 			return err
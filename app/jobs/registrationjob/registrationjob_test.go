@@ -587,6 +587,52 @@ func TestRegister(t *testing.T) {
 	})
 }
 
+func TestRegister_PendingApproval(t *testing.T) {
+	t.Run("should report the hardware and retry until the registration is approved", func(t *testing.T) {
+		_, state := setupTestState(t)
+		attempts := 0
+		mockRegistrar := &mockRegistrar{
+			registerFunc: func(fp string, pk string, tags []agentregistrar.TagPair) (*agentregistrar.RegistrationResponse, error) {
+				attempts++
+				if attempts < 3 {
+					return nil, fmt.Errorf("%w: reg_123", agentregistrar.ErrPendingApproval)
+				}
+				return &agentregistrar.RegistrationResponse{ID: "agt_approved"}, nil
+			},
+		}
+		triggerAttempts := 0
+		job := NewWithConfig(&Config{
+			FingerprintManager: &mockFingerprintManager{
+				loadOrGenerateFunc: func() (*fingerprint.FingerprintData, bool, error) {
+					return &fingerprint.FingerprintData{Fingerprint: "fp-new", PreviousFingerprint: "fp-old"}, true, nil
+				},
+			},
+			Registrar:  mockRegistrar,
+			AgentState: state,
+			Trigger: func(fn func() error) {
+				triggerAttempts++
+				require.NoError(t, fn())
+			},
+			PendingApprovalInterval: time.Millisecond,
+		})
+
+		registered := make(chan bool, 1)
+		job.Register(registered)
+
+		select {
+		case <-registered:
+		case <-time.After(time.Second):
+			t.Fatal("registration did not complete")
+		}
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, 1, triggerAttempts, "held attempts are not retries")
+		require.Len(t, mockRegistrar.hardware, 3)
+		assert.Equal(t, "fp-old", mockRegistrar.hardware[0].PreviousFingerprint)
+		require.NoError(t, state.Load())
+		assert.Equal(t, "agt_approved", state.GetAgentID())
+	})
+}
+
 func TestTrigger(t *testing.T) {
 	t.Run("should execute function successfully on first attempt", func(t *testing.T) {
 		executionCount := 0
@@ -1626,6 +1672,7 @@ type mockRegistrar struct {
 	preparePublicKeyFunc func() (string, error)
 	registerFunc         func(fingerprint string, publicKey string, tags []agentregistrar.TagPair) (*agentregistrar.RegistrationResponse, error)
 	getDefaultTagsFunc   func() []agentregistrar.TagPair
+	hardware             []agentregistrar.Hardware
 }
 
 func (m *mockRegistrar) PreparePublicKey() (string, error) {
@@ -1635,7 +1682,8 @@ func (m *mockRegistrar) PreparePublicKey() (string, error) {
 	return "mock-public-key", nil
 }
 
-func (m *mockRegistrar) Register(fingerprint string, publicKey string, tags []agentregistrar.TagPair) (*agentregistrar.RegistrationResponse, error) {
+func (m *mockRegistrar) RegisterWithHardware(fingerprint string, publicKey string, tags []agentregistrar.TagPair, hw agentregistrar.Hardware) (*agentregistrar.RegistrationResponse, error) {
+	m.hardware = append(m.hardware, hw)
 	if m.registerFunc != nil {
 		return m.registerFunc(fingerprint, publicKey, tags)
 	}
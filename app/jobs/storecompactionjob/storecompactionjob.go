@@ -0,0 +1,65 @@
+// Package storecompactionjob periodically prunes and vacuums the local task store
+package storecompactionjob
+
+import (
+	"context"
+	"sync"
+
+	"hostlink/app/services/localtaskstore"
+)
+
+// Compactor enforces retention on a local task store.
+type Compactor interface {
+	Compact() (localtaskstore.CompactionResult, error)
+}
+
+type TriggerFunc func(context.Context, func() error)
+
+type Config struct {
+	Trigger TriggerFunc
+}
+
+type StoreCompactionJob struct {
+	config Config
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() StoreCompactionJob {
+	return NewWithConfig(Config{
+		Trigger: Trigger,
+	})
+}
+
+func NewWithConfig(cfg Config) StoreCompactionJob {
+	if cfg.Trigger == nil {
+		cfg.Trigger = Trigger
+	}
+
+	return StoreCompactionJob{
+		config: cfg,
+	}
+}
+
+func (j *StoreCompactionJob) Register(ctx context.Context, store Compactor) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	j.cancel = cancel
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.config.Trigger(ctx, func() error {
+			_, err := store.Compact()
+			return err
+		})
+	}()
+
+	return cancel
+}
+
+func (j *StoreCompactionJob) Shutdown() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+}
@@ -0,0 +1,80 @@
+package storecompactionjob
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"hostlink/app/services/localtaskstore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockCompactor struct {
+	mock.Mock
+}
+
+func (m *MockCompactor) Compact() (localtaskstore.CompactionResult, error) {
+	args := m.Called()
+	return args.Get(0).(localtaskstore.CompactionResult), args.Error(1)
+}
+
+func immediateTrigger(callCount int, done chan struct{}) TriggerFunc {
+	return func(ctx context.Context, fn func() error) {
+		for i := 0; i < callCount; i++ {
+			fn()
+		}
+		close(done)
+		<-ctx.Done()
+	}
+}
+
+// TestNewWithConfig_DefaultsNilTrigger - nil trigger defaults to Trigger
+func TestNewWithConfig_DefaultsNilTrigger(t *testing.T) {
+	job := NewWithConfig(Config{Trigger: nil})
+
+	assert.NotNil(t, job.config.Trigger)
+}
+
+// TestRegister_CallsCompact - trigger calls Compactor.Compact()
+func TestRegister_CallsCompact(t *testing.T) {
+	store := new(MockCompactor)
+	store.On("Compact").Return(localtaskstore.CompactionResult{}, nil).Times(2)
+
+	done := make(chan struct{})
+	job := NewWithConfig(Config{Trigger: immediateTrigger(2, done)})
+	cancel := job.Register(context.Background(), store)
+	<-done
+	cancel()
+	job.Shutdown()
+
+	store.AssertExpectations(t)
+}
+
+// TestTriggerWithConfig_RunsImmediatelyAndSurvivesErrors - a failed run does not stop the schedule
+func TestTriggerWithConfig_RunsImmediatelyAndSurvivesErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 3)
+	go TriggerWithConfig(ctx, func() error {
+		calls <- struct{}{}
+		return errors.New("disk I/O error")
+	}, TriggerConfig{Interval: 10 * time.Millisecond})
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-calls:
+		case <-time.After(time.Second):
+			t.Fatalf("compaction ran %d times, want 3", i)
+		}
+	}
+}
+
+// TestSafeCall_RecoversPanic - a panicking compaction is reported as an error
+func TestSafeCall_RecoversPanic(t *testing.T) {
+	err := safeCall(func() error { panic("boom") })
+
+	assert.EqualError(t, err, "panic: boom")
+}
@@ -0,0 +1,127 @@
+package taskjob
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// redactedValue replaces a secret value in a task's output.
+const redactedValue = "[REDACTED]"
+
+// redactor masks the values of a task's secrets in its output.
+type redactor struct {
+	// values are ordered longest first, so a value containing another is
+	// masked as a whole.
+	values [][]byte
+}
+
+// newRedactor returns a redactor for the values of secrets, or nil when
+// there is nothing to redact.
+func newRedactor(secrets map[string]string) *redactor {
+	var values [][]byte
+	for _, value := range secrets {
+		if value != "" {
+			values = append(values, []byte(value))
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	return &redactor{values: values}
+}
+
+// Redact masks every secret value in data.
+func (r *redactor) Redact(data []byte) []byte {
+	if r == nil {
+		return data
+	}
+	redacted, _ := r.redact(data, true)
+	return redacted
+}
+
+// Reader returns a reader masking every secret value read from src, even
+// when a value is split across reads.
+func (r *redactor) Reader(src io.Reader) io.Reader {
+	if r == nil {
+		return src
+	}
+	return &redactingReader{redactor: r, src: src}
+}
+
+// redact masks the values in data. Unless final, it stops at a tail that
+// may still turn into a value and returns that tail as held.
+func (r *redactor) redact(data []byte, final bool) (redacted, held []byte) {
+	redacted = make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		rest := data[i:]
+		if !final && r.mayMatch(rest) {
+			return redacted, rest
+		}
+		if value := r.match(rest); value != nil {
+			redacted = append(redacted, redactedValue...)
+			i += len(value)
+			continue
+		}
+		redacted = append(redacted, data[i])
+		i++
+	}
+	return redacted, nil
+}
+
+// mayMatch reports whether rest is the start of a longer value.
+func (r *redactor) mayMatch(rest []byte) bool {
+	for _, value := range r.values {
+		if len(rest) < len(value) && bytes.HasPrefix(value, rest) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the longest value rest starts with.
+func (r *redactor) match(rest []byte) []byte {
+	for _, value := range r.values {
+		if bytes.HasPrefix(rest, value) {
+			return value
+		}
+	}
+	return nil
+}
+
+type redactingReader struct {
+	redactor *redactor
+	src      io.Reader
+	buf      []byte
+	// held is read but not yet redacted, as it may be part of a value.
+	held []byte
+	// out is redacted and not yet returned.
+	out []byte
+	err error
+}
+
+func (rr *redactingReader) Read(p []byte) (int, error) {
+	for len(rr.out) == 0 {
+		if rr.err != nil {
+			if len(rr.held) == 0 {
+				return 0, rr.err
+			}
+			rr.out, rr.held = rr.redactor.redact(rr.held, true)
+			continue
+		}
+		if rr.buf == nil {
+			rr.buf = make([]byte, 32*1024)
+		}
+		n, err := rr.src.Read(rr.buf)
+		rr.err = err
+		if n > 0 {
+			data := append(rr.held, rr.buf[:n]...)
+			rr.out, rr.held = rr.redactor.redact(data, false)
+			rr.held = append([]byte(nil), rr.held...)
+		}
+	}
+	n := copy(p, rr.out)
+	rr.out = rr.out[n:]
+	return n, nil
+}
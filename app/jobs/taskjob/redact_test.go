@@ -0,0 +1,106 @@
+package taskjob
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"hostlink/domain/task"
+)
+
+func TestRedactorMasksSecretValues(t *testing.T) {
+	r := newRedactor(map[string]string{"short": "pass", "long": "password123", "empty": ""})
+
+	got := string(r.Redact([]byte("pass password123 passport")))
+
+	if want := "[REDACTED] [REDACTED] [REDACTED]port"; got != want {
+		t.Fatalf("Redact = %q, want %q", got, want)
+	}
+}
+
+func TestRedactorReaderMasksValuesSplitAcrossReads(t *testing.T) {
+	r := newRedactor(map[string]string{"token": "s3cr3t-value"})
+	src := strings.NewReader("before s3cr3t-value middle s3cr3t-val after s3cr3t-")
+
+	got, err := io.ReadAll(r.Reader(iotest.OneByteReader(src)))
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+
+	if want := "before [REDACTED] middle s3cr3t-val after s3cr3t-"; string(got) != want {
+		t.Fatalf("read = %q, want %q", got, want)
+	}
+}
+
+func TestRedactorWithoutSecretsPassesOutputThrough(t *testing.T) {
+	r := newRedactor(nil)
+	src := strings.NewReader("output")
+
+	if r.Reader(src) != io.Reader(src) {
+		t.Fatalf("Reader wrapped the output without any secret")
+	}
+	if got := string(r.Redact([]byte("output"))); got != "output" {
+		t.Fatalf("Redact = %q, want output", got)
+	}
+}
+
+type fakeSecretOpener struct {
+	values map[string]string
+}
+
+func (f fakeSecretOpener) Open(t task.Task) (map[string]string, error) {
+	return f.values, nil
+}
+
+func TestTaskJobInjectsSecretsAndRedactsThemFromOutput(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetcher := &fakeTaskFetcher{tasks: []task.Task{{
+		ID:         "poll-task",
+		Command:    `printf '%s|%s' "{{secret:db_password}}" "$API_TOKEN"; grep -c "hunter[2]" "$0" >&2`,
+		EnvSecrets: []string{"api_token"},
+		Status:     "pending",
+	}}}
+	reporter := &fakeTaskReporter{}
+	job := NewJobWithConf(TaskJobConfig{
+		Trigger: runOnceTrigger,
+		Secrets: fakeSecretOpener{values: map[string]string{"db_password": "hunter2", "api_token": "tok-123"}},
+	})
+
+	cancelJob := job.Register(ctx, fetcher, reporter)
+	defer func() {
+		cancelJob()
+		job.Shutdown()
+	}()
+	waitForReports(t, reporter, 1)
+
+	result := reporter.resultsSnapshot()[0]
+	if result.Status != task.StatusCompleted {
+		t.Fatalf("result = %+v, want completed", result)
+	}
+	if want := "[REDACTED]|[REDACTED]0\n"; result.Output != want {
+		t.Fatalf("output = %q, want %q: values injected, redacted and absent from the script", result.Output, want)
+	}
+}
+
+func TestTaskJobFailsTaskUsingSecretsWithoutOpener(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetcher := &fakeTaskFetcher{tasks: []task.Task{{ID: "poll-task", Command: "echo {{secret:token}}", Status: "pending"}}}
+	reporter := &fakeTaskReporter{}
+	job := NewJobWithConf(TaskJobConfig{Trigger: runOnceTrigger})
+
+	cancelJob := job.Register(ctx, fetcher, reporter)
+	defer func() {
+		cancelJob()
+		job.Shutdown()
+	}()
+	waitForReports(t, reporter, 1)
+
+	result := reporter.resultsSnapshot()[0]
+	if result.Status != "failed" || !strings.Contains(result.Error, "failed to open secrets") {
+		t.Fatalf("result = %+v, want failed to open secrets", result)
+	}
+}
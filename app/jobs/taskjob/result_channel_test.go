@@ -171,6 +171,76 @@ func TestCaptureStreamRetainsChunkWhenPersistFails(t *testing.T) {
 	}
 }
 
+func TestCaptureStreamPassesTaskOutputPolicy(t *testing.T) {
+	reader, writer := io.Pipe()
+	channel := &fakePolicyResultChannel{}
+	job := NewJobWithConf(TaskJobConfig{
+		OutputFlushInterval:  time.Hour,
+		OutputFlushThreshold: 4,
+	})
+	done := make(chan struct{})
+
+	go func() {
+		var sink bytes.Buffer
+		job.captureStream(context.Background(), task.Task{ID: "task-1", ExecutionAttemptID: "attempt-1", OutputPolicy: task.OutputPolicyDropOldest}, "stdout", reader, &sink, channel)
+		close(done)
+	}()
+
+	_, _ = writer.Write([]byte("abcd"))
+	waitForOutputs(t, &channel.fakeResultChannel, 1)
+	_ = writer.Close()
+	<-done
+
+	channel.mu.Lock()
+	defer channel.mu.Unlock()
+	if len(channel.policies) != 1 || channel.policies[0] != task.OutputPolicyDropOldest {
+		t.Fatalf("policies = %v, want [drop-oldest]", channel.policies)
+	}
+}
+
+func TestCaptureStreamStopsReadingWhileOutputIsBlocked(t *testing.T) {
+	reader, writer := io.Pipe()
+	channel := &fakePolicyResultChannel{gate: make(chan struct{})}
+	job := NewJobWithConf(TaskJobConfig{
+		OutputFlushInterval:  time.Hour,
+		OutputFlushThreshold: 4,
+	})
+	done := make(chan struct{})
+
+	go func() {
+		var sink bytes.Buffer
+		job.captureStream(context.Background(), task.Task{ID: "task-1", ExecutionAttemptID: "attempt-1"}, "stdout", reader, &sink, channel)
+		close(done)
+	}()
+
+	writesDone := make(chan struct{})
+	go func() {
+		for i := 0; i < 8; i++ {
+			_, _ = writer.Write([]byte("abcd"))
+		}
+		_ = writer.Close()
+		close(writesDone)
+	}()
+
+	select {
+	case <-writesDone:
+		t.Fatal("writer finished while output was blocked; expected backpressure")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(channel.gate)
+	<-writesDone
+	<-done
+
+	var total int
+	for _, output := range channel.outputs {
+		total += len(output.Payload)
+	}
+	if total != 32 {
+		t.Fatalf("delivered %d bytes, want 32", total)
+	}
+}
+
 func TestTaskJobEnqueueEmitsRunnerQueueDepthTelemetry(t *testing.T) {
 	telemetryPath := filepath.Join(t.TempDir(), "hostlink-taskjob-telemetry.jsonl")
 	t.Setenv("HOSTLINK_WS_TELEMETRY_PATH", telemetryPath)
@@ -260,6 +330,26 @@ func (f *fakeResultChannel) SendFinal(ctx context.Context, result localtaskstore
 	return f.finalErr
 }
 
+type fakePolicyResultChannel struct {
+	fakeResultChannel
+	policies []task.OutputPolicy
+	gate     chan struct{}
+}
+
+func (f *fakePolicyResultChannel) SendOutputWithPolicy(ctx context.Context, chunk localtaskstore.OutputChunk, policy task.OutputPolicy) error {
+	if f.gate != nil {
+		select {
+		case <-f.gate:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f.mu.Lock()
+	f.policies = append(f.policies, policy)
+	f.mu.Unlock()
+	return f.SendOutput(ctx, chunk)
+}
+
 func waitForOutputs(t *testing.T, channel *fakeResultChannel, count int) {
 	t.Helper()
 	deadline := time.Now().Add(time.Second)
@@ -2,8 +2,13 @@ package taskjob
 
 import (
 	"context"
+	"errors"
 	"hostlink/app/services/taskreporter"
 	"hostlink/domain/task"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -49,6 +54,57 @@ func TestTaskJobRunsPollingFetchWhenPollingGateEnabled(t *testing.T) {
 	}
 }
 
+func TestTaskJobReportsRunningBeforeExecutingClaimedTask(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetcher := &fakeTaskFetcher{tasks: []task.Task{{ID: "poll-task", ExecutionAttemptID: "att_1", Command: "printf poll", Status: task.StatusClaimed}}}
+	reporter := &fakeTaskReporter{}
+	job := NewJobWithConf(TaskJobConfig{Trigger: runOnceTrigger})
+
+	cancelJob := job.Register(ctx, fetcher, reporter)
+	defer func() {
+		cancelJob()
+		job.Shutdown()
+	}()
+	waitForReports(t, reporter, 2)
+
+	results := reporter.resultsSnapshot()
+	if results[0].Status != task.StatusRunning || results[0].ExecutionAttemptID != "att_1" {
+		t.Fatalf("first report = %+v, want running for att_1", results[0])
+	}
+	if results[1].Status != task.StatusCompleted || results[1].ExecutionAttemptID != "att_1" {
+		t.Fatalf("final report = %+v, want completed for att_1", results[1])
+	}
+}
+
+func TestTaskJobSkipsClaimedTaskWhenStartIsRejected(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	fetcher := &fakeTaskFetcher{tasks: []task.Task{{ID: "poll-task", ExecutionAttemptID: "att_1", Command: "touch " + marker, Status: task.StatusClaimed}}}
+	reporter := &rejectingTaskReporter{}
+	job := NewJobWithConf(TaskJobConfig{Trigger: runOnceTrigger})
+
+	cancelJob := job.Register(context.Background(), fetcher, reporter)
+	time.Sleep(100 * time.Millisecond)
+	cancelJob()
+	job.Shutdown()
+
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("claimed task ran after its start report was rejected")
+	}
+	if reporter.calls.Load() != 1 {
+		t.Fatalf("report count = %d, want only the rejected start", reporter.calls.Load())
+	}
+}
+
+type rejectingTaskReporter struct {
+	calls atomic.Int32
+}
+
+func (r *rejectingTaskReporter) Report(taskID string, result *taskreporter.TaskResult) error {
+	r.calls.Add(1)
+	return errors.New("unexpected status code: 409")
+}
+
 type fakePollingGate struct {
 	shouldPoll bool
 }
@@ -76,3 +132,78 @@ func waitForReports(t *testing.T, reporter *fakeTaskReporter, count int) {
 	}
 	t.Fatalf("timed out waiting for %d reports", count)
 }
+
+func TestTaskJobStreamsOutputThroughReporter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetcher := &fakeTaskFetcher{tasks: []task.Task{{ID: "poll-task", ExecutionAttemptID: "att_1", Command: "printf out; printf err >&2", Status: task.StatusClaimed}}}
+	reporter := &fakeOutputReporter{}
+	job := NewJobWithConf(TaskJobConfig{Trigger: runOnceTrigger})
+
+	cancelJob := job.Register(ctx, fetcher, reporter)
+	defer func() {
+		cancelJob()
+		job.Shutdown()
+	}()
+	waitForReports(t, &reporter.fakeTaskReporter, 2)
+
+	chunks := reporter.chunksSnapshot()
+	streams := map[string]string{}
+	for _, chunk := range chunks {
+		if chunk.ExecutionAttemptID != "att_1" || chunk.Sequence != 1 {
+			t.Fatalf("chunk = %+v, want the first chunk of att_1", chunk)
+		}
+		streams[chunk.Stream] += chunk.Data
+	}
+	if streams["stdout"] != "out" || streams["stderr"] != "err" {
+		t.Fatalf("streamed = %v, want stdout out and stderr err", streams)
+	}
+
+	final := reporter.resultsSnapshot()[1]
+	if len(final.Output) != len("outerr") {
+		t.Fatalf("final output = %q, want both streams", final.Output)
+	}
+}
+
+func TestTaskJobKeepsRunningWhenOutputStreamingFails(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetcher := &fakeTaskFetcher{tasks: []task.Task{{ID: "poll-task", ExecutionAttemptID: "att_1", Command: "printf a; sleep 0.3; printf b", Status: task.StatusClaimed}}}
+	reporter := &fakeOutputReporter{outputErr: errors.New("not found")}
+	job := NewJobWithConf(TaskJobConfig{Trigger: runOnceTrigger})
+
+	cancelJob := job.Register(ctx, fetcher, reporter)
+	defer func() {
+		cancelJob()
+		job.Shutdown()
+	}()
+	waitForReports(t, &reporter.fakeTaskReporter, 2)
+
+	if got := len(reporter.chunksSnapshot()); got != 1 {
+		t.Fatalf("output attempts = %d, want 1 before streaming stops", got)
+	}
+	final := reporter.resultsSnapshot()[1]
+	if final.Status != task.StatusCompleted || final.Output != "ab" {
+		t.Fatalf("final report = %+v, want completed with output ab", final)
+	}
+}
+
+type fakeOutputReporter struct {
+	fakeTaskReporter
+	chunkMu   sync.Mutex
+	chunks    []taskreporter.OutputChunk
+	outputErr error
+}
+
+func (f *fakeOutputReporter) ReportOutput(taskID string, chunk *taskreporter.OutputChunk) error {
+	f.chunkMu.Lock()
+	defer f.chunkMu.Unlock()
+	f.chunks = append(f.chunks, *chunk)
+	return f.outputErr
+}
+
+func (f *fakeOutputReporter) chunksSnapshot() []taskreporter.OutputChunk {
+	f.chunkMu.Lock()
+	defer f.chunkMu.Unlock()
+	return append([]taskreporter.OutputChunk(nil), f.chunks...)
+}
@@ -7,10 +7,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hostlink/app/services/localtaskstore"
 	"hostlink/app/services/taskfetcher"
 	"hostlink/app/services/taskreporter"
+	"hostlink/domain/secret"
 	"hostlink/domain/task"
 	"hostlink/internal/telemetry"
 	"io"
@@ -18,6 +20,7 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/labstack/gommon/log"
@@ -29,11 +32,20 @@ type PollingGate interface {
 	ShouldPoll() bool
 }
 
+// SecretOpener opens the secrets delivered with a task, returning their
+// values by name.
+type SecretOpener interface {
+	Open(t task.Task) (map[string]string, error)
+}
+
 type TaskJobConfig struct {
 	Trigger              TriggerFunc
 	OutputFlushInterval  time.Duration
 	OutputFlushThreshold int
 	PollingGate          PollingGate
+	// Secrets opens the secrets tasks use. Without it, a task using
+	// secrets fails.
+	Secrets SecretOpener
 }
 
 type ResultChannel interface {
@@ -42,6 +54,12 @@ type ResultChannel interface {
 	SendFinal(context.Context, localtaskstore.FinalResult) error
 }
 
+// PolicyResultChannel is implemented by result channels that flow-control
+// output and need the task's policy for when the output window runs out.
+type PolicyResultChannel interface {
+	SendOutputWithPolicy(context.Context, localtaskstore.OutputChunk, task.OutputPolicy) error
+}
+
 type TaskJob struct {
 	config    TaskJobConfig
 	enqueueCh chan task.Task
@@ -143,15 +161,35 @@ func (tj *TaskJob) processTaskSafe(ctx context.Context, t task.Task, tr taskrepo
 }
 
 func (tj *TaskJob) processTask(ctx context.Context, t task.Task, tr taskreporter.TaskReporter, channel ResultChannel) {
+	// A claimed task only runs once the control plane accepts that this
+	// attempt started; a lapsed or reassigned claim is skipped, not rerun.
+	if t.Status == task.StatusClaimed {
+		if err := tr.Report(t.ID, &taskreporter.TaskResult{
+			Status:             task.StatusRunning,
+			ExecutionAttemptID: t.ExecutionAttemptID,
+		}); err != nil {
+			log.Errorf("skipping task %s: failed to report start: %v", t.ID, err)
+			return
+		}
+	}
+
+	secrets, err := tj.openSecrets(t)
+	if err != nil {
+		tj.reportHTTPResult(t, tr, "failed", "", fmt.Sprintf("failed to open secrets: %v", err), 1)
+		return
+	}
+	redactor := newRedactor(secrets)
+
 	tempFile, err := os.CreateTemp("", "*_script.sh")
 	if err != nil {
 		t.Error = fmt.Sprintf("failed to create temp file: %v", err)
 		t.Status = "failed"
 		if reportErr := tr.Report(t.ID, &taskreporter.TaskResult{
-			Status:   t.Status,
-			Output:   t.Output,
-			Error:    t.Error,
-			ExitCode: t.ExitCode,
+			Status:             t.Status,
+			ExecutionAttemptID: t.ExecutionAttemptID,
+			Output:             t.Output,
+			Error:              t.Error,
+			ExitCode:           t.ExitCode,
 		}); reportErr != nil {
 			log.Errorf("failed to report task %s: %v", t.ID, reportErr)
 		}
@@ -159,15 +197,16 @@ func (tj *TaskJob) processTask(ctx context.Context, t task.Task, tr taskreporter
 	}
 	defer os.Remove(tempFile.Name())
 
-	if _, err := tempFile.WriteString(t.Command); err != nil {
+	if _, err := tempFile.WriteString(secret.ExpandPlaceholders(t.Command)); err != nil {
 		tempFile.Close()
 		t.Error = fmt.Sprintf("failed to write script: %v", err)
 		t.Status = "failed"
 		if reportErr := tr.Report(t.ID, &taskreporter.TaskResult{
-			Status:   t.Status,
-			Output:   t.Output,
-			Error:    t.Error,
-			ExitCode: t.ExitCode,
+			Status:             t.Status,
+			ExecutionAttemptID: t.ExecutionAttemptID,
+			Output:             t.Output,
+			Error:              t.Error,
+			ExitCode:           t.ExitCode,
 		}); reportErr != nil {
 			log.Errorf("failed to report task %s: %v", t.ID, reportErr)
 		}
@@ -179,22 +218,29 @@ func (tj *TaskJob) processTask(ctx context.Context, t task.Task, tr taskreporter
 		t.Error = fmt.Sprintf("failed to chmod: %v", err)
 		t.Status = "failed"
 		if reportErr := tr.Report(t.ID, &taskreporter.TaskResult{
-			Status:   t.Status,
-			Output:   t.Output,
-			Error:    t.Error,
-			ExitCode: t.ExitCode,
+			Status:             t.Status,
+			ExecutionAttemptID: t.ExecutionAttemptID,
+			Output:             t.Output,
+			Error:              t.Error,
+			ExitCode:           t.ExitCode,
 		}); reportErr != nil {
 			log.Errorf("failed to report task %s: %v", t.ID, reportErr)
 		}
 		return
 	}
 	execCmd := exec.Command("/bin/sh", "-c", tempFile.Name())
+	if len(secrets) > 0 {
+		execCmd.Env = os.Environ()
+		for name, value := range secrets {
+			execCmd.Env = append(execCmd.Env, secret.EnvName(name)+"="+value)
+		}
+	}
 	if channel != nil && t.ExecutionAttemptID != "" {
-		tj.processTaskWithResultChannel(ctx, t, execCmd, tr, channel)
+		tj.processTaskWithResultChannel(ctx, t, execCmd, tr, channel, redactor)
 		return
 	}
 
-	output, err := execCmd.CombinedOutput()
+	output, err := tj.runCapturingOutput(ctx, t, execCmd, tr, redactor)
 	exitCode := 0
 	errMsg := ""
 	if err != nil {
@@ -208,16 +254,32 @@ func (tj *TaskJob) processTask(ctx context.Context, t task.Task, tr taskreporter
 	t.Output = string(output)
 	t.Status = "completed"
 	if reportErr := tr.Report(t.ID, &taskreporter.TaskResult{
-		Status:   t.Status,
-		Output:   t.Output,
-		Error:    t.Error,
-		ExitCode: t.ExitCode,
+		Status:             t.Status,
+		ExecutionAttemptID: t.ExecutionAttemptID,
+		Output:             t.Output,
+		Error:              t.Error,
+		ExitCode:           t.ExitCode,
 	}); reportErr != nil {
 		log.Errorf("failed to report task %s: %v", t.ID, reportErr)
 	}
 }
 
-func (tj *TaskJob) processTaskWithResultChannel(ctx context.Context, t task.Task, execCmd *exec.Cmd, tr taskreporter.TaskReporter, channel ResultChannel) {
+// openSecrets returns the values of the secrets t uses, by name.
+func (tj *TaskJob) openSecrets(t task.Task) (map[string]string, error) {
+	names, err := secret.References(t.Command, t.EnvSecrets)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if tj.config.Secrets == nil {
+		return nil, errors.New("the agent cannot open secrets")
+	}
+	return tj.config.Secrets.Open(t)
+}
+
+func (tj *TaskJob) processTaskWithResultChannel(ctx context.Context, t task.Task, execCmd *exec.Cmd, tr taskreporter.TaskReporter, channel ResultChannel, redactor *redactor) {
 	stdout, err := execCmd.StdoutPipe()
 	if err != nil {
 		tj.reportHTTPResult(t, tr, "failed", "", fmt.Sprintf("failed to capture stdout: %v", err), 1)
@@ -245,11 +307,11 @@ func (tj *TaskJob) processTaskWithResultChannel(ctx context.Context, t task.Task
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		tj.captureStream(ctx, t, "stdout", stdout, &stdoutBuf, channel)
+		tj.captureStream(ctx, t, "stdout", redactor.Reader(stdout), &stdoutBuf, channel)
 	}()
 	go func() {
 		defer wg.Done()
-		tj.captureStream(ctx, t, "stderr", stderr, &stderrBuf, channel)
+		tj.captureStream(ctx, t, "stderr", redactor.Reader(stderr), &stderrBuf, channel)
 	}()
 	wg.Wait()
 
@@ -290,7 +352,105 @@ func (tj *TaskJob) processTaskWithResultChannel(ctx context.Context, t task.Task
 	}
 }
 
-func (tj *TaskJob) captureStream(ctx context.Context, t task.Task, stream string, reader io.Reader, sink *bytes.Buffer, channel ResultChannel) {
+// runCapturingOutput runs execCmd and returns its combined output. When the
+// reporter streams output and the task was claimed, stdout and stderr are
+// also sent to the control plane as they are written, so the task can be
+// followed live. Streaming stops at the first chunk that fails; the final
+// report still carries the whole output. Secret values are masked by
+// redactor before the output leaves the agent.
+func (tj *TaskJob) runCapturingOutput(ctx context.Context, t task.Task, execCmd *exec.Cmd, tr taskreporter.TaskReporter, redactor *redactor) ([]byte, error) {
+	outputReporter, ok := tr.(taskreporter.OutputReporter)
+	if !ok || t.ExecutionAttemptID == "" {
+		output, err := execCmd.CombinedOutput()
+		return redactor.Redact(output), err
+	}
+
+	stdout, err := execCmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := execCmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := execCmd.Start(); err != nil {
+		return nil, err
+	}
+
+	channel := &reporterChannel{reporter: outputReporter}
+	// Like CombinedOutput, the command runs to completion even if the job
+	// is shut down, so both pipes must be drained until it exits.
+	captureCtx := context.WithoutCancel(ctx)
+	var combined lockedBuffer
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		tj.captureStream(captureCtx, t, "stdout", redactor.Reader(stdout), &combined, channel)
+	}()
+	go func() {
+		defer wg.Done()
+		tj.captureStream(captureCtx, t, "stderr", redactor.Reader(stderr), &combined, channel)
+	}()
+	wg.Wait()
+
+	err = execCmd.Wait()
+	return combined.Bytes(), err
+}
+
+// reporterChannel streams the output of a task run over HTTP through an
+// OutputReporter; the task's start and final result are reported by the
+// TaskReporter. It stops sending after the first failure and never fails a
+// send, so the command is not held up.
+type reporterChannel struct {
+	reporter taskreporter.OutputReporter
+	failed   atomic.Bool
+}
+
+func (rc *reporterChannel) SendStarted(context.Context, localtaskstore.TaskReceipt) error {
+	return nil
+}
+
+func (rc *reporterChannel) SendOutput(ctx context.Context, chunk localtaskstore.OutputChunk) error {
+	if rc.failed.Load() {
+		return nil
+	}
+	err := rc.reporter.ReportOutput(chunk.TaskID, &taskreporter.OutputChunk{
+		ExecutionAttemptID: chunk.ExecutionAttemptID,
+		Stream:             chunk.Stream,
+		Sequence:           chunk.Sequence,
+		Data:               chunk.Payload,
+	})
+	if err != nil && rc.failed.CompareAndSwap(false, true) {
+		log.Warnf("stopped streaming output of task %s: %v", chunk.TaskID, err)
+	}
+	return nil
+}
+
+func (rc *reporterChannel) SendFinal(context.Context, localtaskstore.FinalResult) error {
+	return nil
+}
+
+// lockedBuffer collects a command's stdout and stderr, which are captured
+// concurrently.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
+
+func (tj *TaskJob) captureStream(ctx context.Context, t task.Task, stream string, reader io.Reader, sink io.Writer, channel ResultChannel) {
 	sequence := int64(1)
 	chunks := make(chan string, 1)
 	go func() {
@@ -317,7 +477,7 @@ func (tj *TaskJob) captureStream(ctx context.Context, t task.Task, stream string
 			return true
 		}
 		chunk := pending.String()
-		err := channel.SendOutput(ctx, localtaskstore.OutputChunk{
+		err := sendOutput(ctx, channel, localtaskstore.OutputChunk{
 			MessageID:          messageID(t.ID, t.ExecutionAttemptID, stream, sequence),
 			TaskID:             t.ID,
 			ExecutionAttemptID: t.ExecutionAttemptID,
@@ -325,7 +485,7 @@ func (tj *TaskJob) captureStream(ctx context.Context, t task.Task, stream string
 			Sequence:           sequence,
 			Payload:            chunk,
 			ByteCount:          int64(len(chunk)),
-		})
+		}, t.OutputPolicy)
 		if err != nil {
 			return false
 		}
@@ -341,7 +501,7 @@ func (tj *TaskJob) captureStream(ctx context.Context, t task.Task, stream string
 				flush()
 				return
 			}
-			sink.WriteString(chunk)
+			io.WriteString(sink, chunk)
 			pending.WriteString(chunk)
 			if pending.Len() >= tj.config.OutputFlushThreshold {
 				flush()
@@ -354,12 +514,23 @@ func (tj *TaskJob) captureStream(ctx context.Context, t task.Task, stream string
 	}
 }
 
+// sendOutput hands a chunk to the channel. A flow-controlled channel may block
+// here; captureStream then stops draining the pipe, so the process itself
+// blocks on write instead of its output being dropped.
+func sendOutput(ctx context.Context, channel ResultChannel, chunk localtaskstore.OutputChunk, policy task.OutputPolicy) error {
+	if pc, ok := channel.(PolicyResultChannel); ok {
+		return pc.SendOutputWithPolicy(ctx, chunk, policy)
+	}
+	return channel.SendOutput(ctx, chunk)
+}
+
 func (tj *TaskJob) reportHTTPResult(t task.Task, tr taskreporter.TaskReporter, status, output, errMsg string, exitCode int) {
 	if reportErr := tr.Report(t.ID, &taskreporter.TaskResult{
-		Status:   status,
-		Output:   output,
-		Error:    errMsg,
-		ExitCode: exitCode,
+		Status:             status,
+		ExecutionAttemptID: t.ExecutionAttemptID,
+		Output:             output,
+		Error:              errMsg,
+		ExitCode:           exitCode,
 	}); reportErr != nil {
 		log.Errorf("failed to report task %s: %v", t.ID, reportErr)
 	}
@@ -0,0 +1,64 @@
+// Package webhookdeliveryjob periodically sends queued webhook deliveries
+// and retries failed ones once their backoff has passed
+package webhookdeliveryjob
+
+import (
+	"context"
+	"sync"
+)
+
+// Deliverer attempts the webhook deliveries that are due.
+type Deliverer interface {
+	Deliver(ctx context.Context) (int, error)
+}
+
+type TriggerFunc func(context.Context, func() error)
+
+type Config struct {
+	Trigger TriggerFunc
+}
+
+type WebhookDeliveryJob struct {
+	config Config
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() WebhookDeliveryJob {
+	return NewWithConfig(Config{
+		Trigger: Trigger,
+	})
+}
+
+func NewWithConfig(cfg Config) WebhookDeliveryJob {
+	if cfg.Trigger == nil {
+		cfg.Trigger = Trigger
+	}
+
+	return WebhookDeliveryJob{
+		config: cfg,
+	}
+}
+
+func (j *WebhookDeliveryJob) Register(ctx context.Context, svc Deliverer) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	j.cancel = cancel
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.config.Trigger(ctx, func() error {
+			_, err := svc.Deliver(ctx)
+			return err
+		})
+	}()
+
+	return cancel
+}
+
+func (j *WebhookDeliveryJob) Shutdown() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+}
@@ -0,0 +1,78 @@
+package webhookdeliveryjob
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockDeliverer struct {
+	mock.Mock
+}
+
+func (m *MockDeliverer) Deliver(ctx context.Context) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func immediateTrigger(callCount int, done chan struct{}) TriggerFunc {
+	return func(ctx context.Context, fn func() error) {
+		for i := 0; i < callCount; i++ {
+			fn()
+		}
+		close(done)
+		<-ctx.Done()
+	}
+}
+
+// TestNewWithConfig_DefaultsNilTrigger - nil trigger defaults to Trigger
+func TestNewWithConfig_DefaultsNilTrigger(t *testing.T) {
+	job := NewWithConfig(Config{Trigger: nil})
+
+	assert.NotNil(t, job.config.Trigger)
+}
+
+// TestRegister_CallsDeliver - trigger calls Deliverer.Deliver()
+func TestRegister_CallsDeliver(t *testing.T) {
+	svc := new(MockDeliverer)
+	svc.On("Deliver", mock.Anything).Return(0, nil).Times(2)
+
+	done := make(chan struct{})
+	job := NewWithConfig(Config{Trigger: immediateTrigger(2, done)})
+	cancel := job.Register(context.Background(), svc)
+	<-done
+	cancel()
+	job.Shutdown()
+
+	svc.AssertExpectations(t)
+}
+
+// TestTriggerWithConfig_RunsImmediatelyAndSurvivesErrors - a failed run does not stop the schedule
+func TestTriggerWithConfig_RunsImmediatelyAndSurvivesErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 3)
+	go TriggerWithConfig(ctx, func() error {
+		calls <- struct{}{}
+		return errors.New("database is locked")
+	}, TriggerConfig{Interval: 10 * time.Millisecond})
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-calls:
+		case <-time.After(time.Second):
+			t.Fatalf("delivery ran %d times, want 3", i)
+		}
+	}
+}
+
+// TestSafeCall_RecoversPanic - a panicking delivery run is reported as an error
+func TestSafeCall_RecoversPanic(t *testing.T) {
+	err := safeCall(func() error { panic("boom") })
+
+	assert.EqualError(t, err, "panic: boom")
+}
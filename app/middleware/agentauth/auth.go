@@ -2,22 +2,59 @@ package agentauth
 
 import (
 	"context"
+	gocrypto "crypto"
 	"hostlink/app/services/reqauth"
+	"hostlink/domain/agent"
+	"hostlink/domain/nonce"
 	"hostlink/internal/crypto"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
+// contextKey is where the ID of the authenticated agent is stored on the
+// echo context, accessContextKey its access state and previousKeyContextKey
+// whether the request was signed with its previous key.
+const (
+	contextKey            = "agent_id"
+	accessContextKey      = "agent_access"
+	previousKeyContextKey = "agent_previous_key"
+)
+
 type AgentRepository interface {
-	GetPublicKeyByAgentID(ctx context.Context, agentID string) (string, error)
+	GetPublicKeysByAgentID(ctx context.Context, agentID string, at time.Time) ([]string, error)
+	GetAccessByAgentID(ctx context.Context, agentID string) (string, error)
+}
+
+type Config struct {
+	// RequireClientCertificate rejects requests that did not present a
+	// verified mTLS client certificate issued to the requesting agent.
+	RequireClientCertificate bool
+	// Nonces, when set, rejects requests reusing a nonce the agent already
+	// used within the timestamp window.
+	Nonces nonce.Store
+	// MinSignatureVersion rejects requests signed with an older version;
+	// zero accepts every version.
+	MinSignatureVersion int
+	// RejectQuarantined rejects quarantined agents. It is left off only on
+	// the routes a quarantined agent keeps using: heartbeats and metrics.
+	RejectQuarantined bool
 }
 
 func New(repo AgentRepository) echo.MiddlewareFunc {
 	return Middleware(repo)
 }
 
+func NewWithConfig(repo AgentRepository, cfg Config) echo.MiddlewareFunc {
+	return MiddlewareWithConfig(repo, cfg)
+}
+
 func Middleware(repo AgentRepository) echo.MiddlewareFunc {
+	return MiddlewareWithConfig(repo, Config{})
+}
+
+func MiddlewareWithConfig(repo AgentRepository, cfg Config) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			agentID := c.Request().Header.Get("X-Agent-ID")
@@ -25,22 +62,95 @@ func Middleware(repo AgentRepository) echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusUnauthorized, "missing agent ID")
 			}
 
-			publicKeyBase64, err := repo.GetPublicKeyByAgentID(c.Request().Context(), agentID)
+			if cfg.RequireClientCertificate && !hasClientCertificateFor(c.Request(), agentID) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "client certificate required")
+			}
+
+			// The previous key is among them while a key rotation overlaps
+			publicKeysBase64, err := repo.GetPublicKeysByAgentID(c.Request().Context(), agentID, time.Now())
 			if err != nil {
 				return echo.NewHTTPError(http.StatusUnauthorized, "authentication failed")
 			}
 
-			publicKey, err := crypto.ParsePublicKeyFromBase64(publicKeyBase64)
+			publicKeys := make([]gocrypto.PublicKey, 0, len(publicKeysBase64))
+			for _, publicKeyBase64 := range publicKeysBase64 {
+				publicKey, err := crypto.ParsePublicKeyBase64(publicKeyBase64)
+				if err != nil {
+					return echo.NewHTTPError(http.StatusUnauthorized, "invalid public key")
+				}
+				publicKeys = append(publicKeys, publicKey)
+			}
+
+			authenticator := reqauth.New(publicKeys...)
+			if cfg.Nonces != nil {
+				authenticator.WithNonceStore(cfg.Nonces)
+			}
+			if cfg.MinSignatureVersion > 0 {
+				authenticator.WithMinVersion(cfg.MinSignatureVersion)
+			}
+			key, err := authenticator.AuthenticateKey(c.Request())
 			if err != nil {
-				return echo.NewHTTPError(http.StatusUnauthorized, "invalid public key")
+				return echo.NewHTTPError(http.StatusUnauthorized, "authentication failed")
 			}
 
-			authenticator := reqauth.New(publicKey)
-			if err := authenticator.Authenticate(c.Request()); err != nil {
+			// Checked once the agent proved its identity, so the access
+			// state is not disclosed to anyone else
+			access, err := repo.GetAccessByAgentID(c.Request().Context(), agentID)
+			if err != nil {
 				return echo.NewHTTPError(http.StatusUnauthorized, "authentication failed")
 			}
+			if access == agent.AccessRevoked {
+				return echo.NewHTTPError(http.StatusForbidden, "agent revoked")
+			}
+			if cfg.RejectQuarantined && access == agent.AccessQuarantined {
+				return echo.NewHTTPError(http.StatusForbidden, "agent quarantined")
+			}
 
+			SetAgent(c, agentID, access)
+			// The repository lists the current key first
+			if key > 0 {
+				c.Set(previousKeyContextKey, true)
+			}
 			return next(c)
 		}
 	}
 }
+
+// SetAgent records on c that agentID, in the given access state,
+// authenticated the request. The middleware calls it once a request
+// verifies; handlers read it back with AgentIDFromContext.
+func SetAgent(c echo.Context, agentID, access string) {
+	c.Set(contextKey, agentID)
+	c.Set(accessContextKey, access)
+}
+
+// AgentIDFromContext returns the ID of the agent that authenticated the
+// request, or "" when it did not pass through the middleware.
+func AgentIDFromContext(c echo.Context) string {
+	id, _ := c.Get(contextKey).(string)
+	return id
+}
+
+// SignedWithPreviousKey reports whether the request was signed with the
+// agent's previous key during a key rotation overlap rather than its
+// current one.
+func SignedWithPreviousKey(c echo.Context) bool {
+	previous, _ := c.Get(previousKeyContextKey).(bool)
+	return previous
+}
+
+// IsQuarantined reports whether the agent that authenticated the request is
+// quarantined, so it must not be handed tasks.
+func IsQuarantined(c echo.Context) bool {
+	access, _ := c.Get(accessContextKey).(string)
+	return access == agent.AccessQuarantined
+}
+
+// hasClientCertificateFor reports whether the TLS layer verified a client
+// certificate whose subject is agentID.
+func hasClientCertificateFor(r *http.Request, agentID string) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return false
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName == agentID
+}
@@ -6,7 +6,9 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"fmt"
 	"net/http"
@@ -15,7 +17,10 @@ import (
 	"testing"
 	"time"
 
+	"hostlink/app/services/reqauth"
 	"hostlink/domain/agent"
+	hlcrypto "hostlink/internal/crypto"
+	"hostlink/internal/repository/memory"
 
 	"github.com/labstack/echo/v4"
 )
@@ -38,7 +43,9 @@ func TestMiddleware(t *testing.T) {
 		c := e.NewContext(req, rec)
 
 		middleware := Middleware(repo)
+		var agentID string
 		handler := middleware(func(c echo.Context) error {
+			agentID = AgentIDFromContext(c)
 			return c.String(http.StatusOK, "success")
 		})
 
@@ -50,6 +57,10 @@ func TestMiddleware(t *testing.T) {
 		if rec.Code != http.StatusOK {
 			t.Errorf("Expected status 200, got: %d", rec.Code)
 		}
+
+		if agentID != "agt_test123" {
+			t.Errorf("Expected agent ID agt_test123 in context, got: %q", agentID)
+		}
 	})
 
 	t.Run("returns 401 when X-Agent-ID header is missing", func(t *testing.T) {
@@ -209,6 +220,254 @@ func TestMiddleware(t *testing.T) {
 	})
 }
 
+func TestMiddlewareWithConfig_RequireClientCertificate(t *testing.T) {
+	privateKey, publicKeyBase64 := generateTestKeys(t)
+	repo := &mockAgentRepository{
+		getPublicKeyByAgentID: func(ctx context.Context, agentID string) (string, error) {
+			return publicKeyBase64, nil
+		},
+	}
+	middleware := MiddlewareWithConfig(repo, Config{RequireClientCertificate: true})
+
+	tests := []struct {
+		name     string
+		tlsState *tls.ConnectionState
+		wantCode int
+	}{
+		{
+			name:     "rejects request without TLS",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "rejects certificate issued to another agent",
+			tlsState: verifiedStateFor("agt_other"),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "allows certificate issued to the agent",
+			tlsState: verifiedStateFor("agt_test123"),
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := createSignedHTTPRequest(testRequest{}, privateKey)
+			req.TLS = tt.tlsState
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			handler := middleware(func(c echo.Context) error {
+				return c.String(http.StatusOK, "success")
+			})
+
+			err := handler(c)
+			if tt.wantCode == http.StatusOK {
+				if err != nil {
+					t.Errorf("Expected no error, got: %v", err)
+				}
+				return
+			}
+			he, ok := err.(*echo.HTTPError)
+			if !ok {
+				t.Fatalf("Expected echo.HTTPError, got: %v", err)
+			}
+			if he.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got: %d", tt.wantCode, he.Code)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithConfig_Nonces(t *testing.T) {
+	privateKey, publicKeyBase64 := generateTestKeys(t)
+	repo := &mockAgentRepository{
+		getPublicKeyByAgentID: func(ctx context.Context, agentID string) (string, error) {
+			return publicKeyBase64, nil
+		},
+	}
+	middleware := MiddlewareWithConfig(repo, Config{Nonces: memory.NewNonceStore(100)})
+	handler := middleware(func(c echo.Context) error {
+		return c.String(http.StatusOK, "success")
+	})
+	req := createSignedHTTPRequest(testRequest{}, privateKey)
+
+	e := echo.New()
+	if err := handler(e.NewContext(req, httptest.NewRecorder())); err != nil {
+		t.Fatalf("Expected first use to pass, got: %v", err)
+	}
+
+	err := handler(e.NewContext(req, httptest.NewRecorder()))
+	he, ok := err.(*echo.HTTPError)
+	if !ok || he.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for replayed request, got: %v", err)
+	}
+}
+
+func TestMiddlewareWithConfig_MinSignatureVersion(t *testing.T) {
+	privateKey, publicKeyBase64 := generateTestKeys(t)
+	repo := &mockAgentRepository{
+		getPublicKeyByAgentID: func(ctx context.Context, agentID string) (string, error) {
+			return publicKeyBase64, nil
+		},
+	}
+	middleware := MiddlewareWithConfig(repo, Config{MinSignatureVersion: reqauth.Version2})
+	handler := middleware(func(c echo.Context) error {
+		return c.String(http.StatusOK, "success")
+	})
+	req := createSignedHTTPRequest(testRequest{}, privateKey)
+
+	err := handler(echo.New().NewContext(req, httptest.NewRecorder()))
+	he, ok := err.(*echo.HTTPError)
+	if !ok || he.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for version 1 request, got: %v", err)
+	}
+}
+
+func TestMiddleware_PreviousKeyDuringRotation(t *testing.T) {
+	currentKey, publicKeyBase64 := generateTestKeys(t)
+	previousKey, previousKeyBase64 := generateTestKeys(t)
+	repo := &mockAgentRepository{
+		getPublicKeyByAgentID: func(ctx context.Context, agentID string) (string, error) {
+			return publicKeyBase64, nil
+		},
+		previousPublicKey: previousKeyBase64,
+	}
+	var previous bool
+	handler := Middleware(repo)(func(c echo.Context) error {
+		previous = SignedWithPreviousKey(c)
+		return c.String(http.StatusOK, "success")
+	})
+
+	req := createSignedHTTPRequest(testRequest{}, currentKey)
+	if err := handler(echo.New().NewContext(req, httptest.NewRecorder())); err != nil || previous {
+		t.Errorf("Expected the current key to authenticate as current, got: %v, previous %v", err, previous)
+	}
+
+	req = createSignedHTTPRequest(testRequest{}, previousKey)
+	if err := handler(echo.New().NewContext(req, httptest.NewRecorder())); err != nil {
+		t.Errorf("Expected previous key to authenticate during overlap, got: %v", err)
+	}
+	if !previous {
+		t.Error("Expected the request to be recorded as signed with the previous key")
+	}
+
+	repo.previousPublicKey = ""
+	req = createSignedHTTPRequest(testRequest{}, previousKey)
+	err := handler(echo.New().NewContext(req, httptest.NewRecorder()))
+	he, ok := err.(*echo.HTTPError)
+	if !ok || he.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 once the previous key expired, got: %v", err)
+	}
+}
+
+func TestMiddleware_Access(t *testing.T) {
+	privateKey, publicKeyBase64 := generateTestKeys(t)
+	repo := &mockAgentRepository{
+		getPublicKeyByAgentID: func(ctx context.Context, agentID string) (string, error) {
+			return publicKeyBase64, nil
+		},
+	}
+	var quarantined bool
+	handler := Middleware(repo)(func(c echo.Context) error {
+		quarantined = IsQuarantined(c)
+		return c.String(http.StatusOK, "success")
+	})
+
+	t.Run("lets a quarantined agent through, marked as such", func(t *testing.T) {
+		repo.access = agent.AccessQuarantined
+
+		err := handler(echo.New().NewContext(createSignedHTTPRequest(testRequest{}, privateKey), httptest.NewRecorder()))
+
+		if err != nil {
+			t.Fatalf("Expected quarantined agent to authenticate, got: %v", err)
+		}
+		if !quarantined {
+			t.Errorf("Expected the request to be marked quarantined")
+		}
+	})
+
+	t.Run("rejects a quarantined agent when configured to", func(t *testing.T) {
+		repo.access = agent.AccessQuarantined
+		reject := MiddlewareWithConfig(repo, Config{RejectQuarantined: true})(func(c echo.Context) error {
+			t.Error("the handler must not run")
+			return nil
+		})
+
+		err := reject(echo.New().NewContext(createSignedHTTPRequest(testRequest{}, privateKey), httptest.NewRecorder()))
+
+		he, ok := err.(*echo.HTTPError)
+		if !ok || he.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for a quarantined agent, got: %v", err)
+		}
+	})
+
+	t.Run("rejects a revoked agent", func(t *testing.T) {
+		repo.access = agent.AccessRevoked
+
+		err := handler(echo.New().NewContext(createSignedHTTPRequest(testRequest{}, privateKey), httptest.NewRecorder()))
+
+		he, ok := err.(*echo.HTTPError)
+		if !ok || he.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for a revoked agent, got: %v", err)
+		}
+	})
+
+	t.Run("does not mark an active agent", func(t *testing.T) {
+		repo.access = agent.AccessActive
+
+		err := handler(echo.New().NewContext(createSignedHTTPRequest(testRequest{}, privateKey), httptest.NewRecorder()))
+
+		if err != nil || quarantined {
+			t.Errorf("Expected an active agent through unmarked, got err %v, quarantined %v", err, quarantined)
+		}
+	})
+}
+
+func TestMiddleware_KeyTypes(t *testing.T) {
+	for _, keyType := range []string{hlcrypto.KeyTypeEd25519, hlcrypto.KeyTypeECDSA} {
+		t.Run(keyType, func(t *testing.T) {
+			privateKey, err := hlcrypto.GenerateKey(keyType)
+			if err != nil {
+				t.Fatalf("Failed to generate key: %v", err)
+			}
+			publicKeyBase64, err := hlcrypto.PublicKeyBase64(privateKey)
+			if err != nil {
+				t.Fatalf("Failed to encode public key: %v", err)
+			}
+			repo := &mockAgentRepository{
+				getPublicKeyByAgentID: func(ctx context.Context, agentID string) (string, error) {
+					return publicKeyBase64, nil
+				},
+			}
+			handler := Middleware(repo)(func(c echo.Context) error {
+				return c.String(http.StatusOK, "success")
+			})
+
+			timestamp := time.Now().Unix()
+			signature, err := hlcrypto.SignMessage(reqauth.MessageV1("agt_test123", strconv.FormatInt(timestamp, 10), "test-nonce-123"), privateKey)
+			if err != nil {
+				t.Fatalf("Failed to sign: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Agent-ID", "agt_test123")
+			req.Header.Set("X-Timestamp", strconv.FormatInt(timestamp, 10))
+			req.Header.Set("X-Nonce", "test-nonce-123")
+			req.Header.Set("X-Signature", signature)
+
+			if err := handler(echo.New().NewContext(req, httptest.NewRecorder())); err != nil {
+				t.Errorf("Expected %s key to authenticate, got: %v", keyType, err)
+			}
+		})
+	}
+}
+
+func verifiedStateFor(commonName string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
 type testRequest struct {
 	agentID   string
 	timestamp int64
@@ -218,13 +477,29 @@ type testRequest struct {
 
 type mockAgentRepository struct {
 	getPublicKeyByAgentID func(ctx context.Context, agentID string) (string, error)
+	previousPublicKey     string
+	access                string
+}
+
+func (m *mockAgentRepository) GetAccessByAgentID(ctx context.Context, agentID string) (string, error) {
+	if m.access == "" {
+		return agent.AccessActive, nil
+	}
+	return m.access, nil
 }
 
-func (m *mockAgentRepository) GetPublicKeyByAgentID(ctx context.Context, agentID string) (string, error) {
-	if m.getPublicKeyByAgentID != nil {
-		return m.getPublicKeyByAgentID(ctx, agentID)
+func (m *mockAgentRepository) GetPublicKeysByAgentID(ctx context.Context, agentID string, at time.Time) ([]string, error) {
+	if m.getPublicKeyByAgentID == nil {
+		return []string{""}, nil
+	}
+	publicKey, err := m.getPublicKeyByAgentID(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if m.previousPublicKey != "" {
+		return []string{publicKey, m.previousPublicKey}, nil
 	}
-	return "", nil
+	return []string{publicKey}, nil
 }
 
 func generateTestKeys(t *testing.T) (*rsa.PrivateKey, string) {
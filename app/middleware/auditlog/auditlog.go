@@ -0,0 +1,161 @@
+// Package auditlog records control plane requests in the audit log.
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hostlink/app/middleware/agentauth"
+	"hostlink/app/middleware/operatorauth"
+	"hostlink/domain/audit"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contextKey is where the entry being recorded for a request is stored on
+// the echo context.
+const contextKey = "audit_entry"
+
+// MaxBodyBytes bounds the request body the middleware reads to digest it.
+// Larger requests are rejected with 413 before they reach the handler.
+const MaxBodyBytes = 32 << 20
+
+type Recorder interface {
+	Append(ctx context.Context, entry *audit.Entry) error
+}
+
+// Actions names the audited routes, keyed by method and route path.
+// Requests to other routes are only recorded when they are denied.
+var Actions = map[string]string{
+	"POST /api/v1/agents/register":                      "agent.register",
+	"POST /api/v1/agents/:id/certificate":               "agent.certificate.renew",
+	"POST /api/v1/agents/:id/rotate-key":                "agent.key.rotate",
+	"POST /api/v2/agents/:id/quarantine":                "agent.quarantine",
+	"POST /api/v2/agents/:id/release":                   "agent.release",
+	"POST /api/v2/agents/:id/revoke":                    "agent.revoke",
+	"PUT /api/v2/agents/:id/tags/:key":                  "agent.tag.set",
+	"DELETE /api/v2/agents/:id/tags/:key":               "agent.tag.unset",
+	"POST /api/v2/tasks":                                "task.create",
+	"POST /api/v2/tasks/:id/cancel":                     "task.cancel",
+	"POST /api/v2/agents/:id/credentials":               "credential.create",
+	"PUT /api/v2/agents/:id/credentials/:credential_id": "credential.update",
+	"PUT /api/v2/agents/:id/secrets/:name":              "secret.set",
+	"DELETE /api/v2/agents/:id/secrets/:name":           "secret.delete",
+	"POST /api/v2/webhooks":                             "webhook.create",
+	"PUT /api/v2/webhooks/:id":                          "webhook.update",
+	"DELETE /api/v2/webhooks/:id":                       "webhook.delete",
+	"POST /api/v2/operators":                            "operator.create",
+	"PUT /api/v2/operators/:id":                         "operator.update",
+	"POST /api/v2/operators/:id/tokens":                 "operator.token.create",
+	"DELETE /api/v2/operators/:id/tokens/:token_id":     "operator.token.revoke",
+	"POST /api/v2/enrollment-tokens":                    "enrollment_token.create",
+	"DELETE /api/v2/enrollment-tokens/:id":              "enrollment_token.revoke",
+	"POST /api/v2/registrations/:id/approve":            "registration.approve",
+}
+
+func New(recorder Recorder) echo.MiddlewareFunc {
+	return Middleware(recorder)
+}
+
+// Middleware records audited requests and every request that is denied.
+// It goes before the auth middleware so rejected credentials are recorded
+// too. Recording happens after the handler and never fails the request.
+func Middleware(recorder Recorder) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			body, readErr := readBody(c)
+
+			entry := &audit.Entry{
+				Method:        req.Method,
+				Path:          req.URL.Path,
+				SourceIP:      c.RealIP(),
+				RequestDigest: audit.DigestRequest(req.Method, req.URL.RequestURI(), body),
+				Target:        c.Param("id"),
+			}
+			c.Set(contextKey, entry)
+
+			// Write errors now so the response status is known
+			if readErr != nil {
+				c.Error(readErr)
+			} else if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			action, audited := Actions[req.Method+" "+c.Path()]
+			outcome := audit.OutcomeOf(status)
+			if !audited && outcome != audit.OutcomeDenied {
+				return nil
+			}
+			if !audited {
+				action = req.Method + " " + c.Path()
+			}
+
+			entry.Action = action
+			entry.StatusCode = status
+			entry.Outcome = outcome
+			entry.CreatedAt = time.Now()
+			setActor(c, entry)
+
+			if err := recorder.Append(context.WithoutCancel(req.Context()), entry); err != nil {
+				c.Logger().Errorf("failed to record audit entry for %s %s: %v", req.Method, req.URL.Path, err)
+			}
+			return nil
+		}
+	}
+}
+
+// readBody reads the request body, up to MaxBodyBytes, and puts it back for
+// the handler.
+func readBody(c echo.Context) ([]byte, error) {
+	req := c.Request()
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Response(), req.Body, MaxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request body too large")
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "failed to read request body")
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// EntryFrom returns the entry being recorded for the request so the
+// handler can name its target and describe what it did. Without the
+// middleware it returns an entry that is discarded.
+func EntryFrom(c echo.Context) *audit.Entry {
+	if entry, ok := c.Get(contextKey).(*audit.Entry); ok {
+		return entry
+	}
+	return &audit.Entry{}
+}
+
+// setActor fills in who made the request, unless the handler already did.
+func setActor(c echo.Context, entry *audit.Entry) {
+	if entry.ActorType != "" {
+		return
+	}
+	if o := operatorauth.FromContext(c); o != nil {
+		entry.ActorType = audit.ActorOperator
+		entry.ActorID = o.ID
+		entry.ActorName = o.Name
+		if t := operatorauth.TokenFromContext(c); t != nil {
+			entry.TokenID = t.ID
+		}
+		return
+	}
+	if agentID := agentauth.AgentIDFromContext(c); agentID != "" {
+		entry.ActorType = audit.ActorAgent
+		entry.ActorID = agentID
+		return
+	}
+	entry.ActorType = audit.ActorAnonymous
+}
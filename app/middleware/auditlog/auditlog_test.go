@@ -0,0 +1,185 @@
+package auditlog
+
+import (
+	"context"
+	"errors"
+	"hostlink/app/middleware/operatorauth"
+	"hostlink/domain/audit"
+	"hostlink/domain/operator"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type mockRecorder struct {
+	entries []*audit.Entry
+	err     error
+}
+
+func (m *mockRecorder) Append(ctx context.Context, entry *audit.Entry) error {
+	m.entries = append(m.entries, entry)
+	return m.err
+}
+
+type mockAuthenticator struct{}
+
+func (mockAuthenticator) Authenticate(ctx context.Context, token string) (*operator.Operator, *operator.Token, error) {
+	if token == "hlo_admin" {
+		return &operator.Operator{ID: "opr_admin", Name: "alice", Role: operator.RoleAdmin},
+			&operator.Token{ID: "otk_laptop"}, nil
+	}
+	return nil, nil, errors.New("invalid token")
+}
+
+// setup serves the audited routes POST /api/v2/tasks and PUT
+// /api/v2/webhooks/:id, and the unaudited GET /api/v2/tasks, behind the
+// audit and operator auth middleware.
+func setup(recorder *mockRecorder, handler echo.HandlerFunc) *echo.Echo {
+	e := echo.New()
+	g := e.Group("/api/v2", New(recorder), operatorauth.New(mockAuthenticator{}))
+	g.POST("/tasks", handler)
+	g.GET("/tasks", handler)
+	g.PUT("/webhooks/:id", handler)
+	return e
+}
+
+func request(e *echo.Echo, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.10:1234"
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("records audited requests with their actor and the handler's annotations", func(t *testing.T) {
+		recorder := &mockRecorder{}
+		var body string
+		e := setup(recorder, func(c echo.Context) error {
+			data, _ := io.ReadAll(c.Request().Body)
+			body = string(data)
+			entry := EntryFrom(c)
+			entry.Target = "tsk_1"
+			entry.SetDetail(map[string]string{"command": "uptime"})
+			return c.NoContent(http.StatusCreated)
+		})
+
+		request(e, http.MethodPost, "/api/v2/tasks", "hlo_admin", `{"command":"uptime"}`)
+
+		if body != `{"command":"uptime"}` {
+			t.Errorf("handler read body %q", body)
+		}
+		if len(recorder.entries) != 1 {
+			t.Fatalf("recorded %d entries, want 1", len(recorder.entries))
+		}
+		entry := recorder.entries[0]
+		want := audit.Entry{
+			ActorType: audit.ActorOperator, ActorID: "opr_admin", ActorName: "alice", TokenID: "otk_laptop",
+			Action: "task.create", Target: "tsk_1", Method: http.MethodPost, Path: "/api/v2/tasks",
+			SourceIP: "192.0.2.10", Outcome: audit.OutcomeSuccess, StatusCode: http.StatusCreated,
+			Detail:        `{"command":"uptime"}`,
+			RequestDigest: audit.DigestRequest(http.MethodPost, "/api/v2/tasks", []byte(`{"command":"uptime"}`)),
+		}
+		entry.CreatedAt = want.CreatedAt
+		if *entry != want {
+			t.Errorf("entry = %+v\nwant %+v", *entry, want)
+		}
+	})
+
+	t.Run("targets the route's id by default", func(t *testing.T) {
+		recorder := &mockRecorder{}
+		e := setup(recorder, func(c echo.Context) error {
+			return c.NoContent(http.StatusBadRequest)
+		})
+
+		request(e, http.MethodPut, "/api/v2/webhooks/whk_1", "hlo_admin", `{}`)
+
+		if len(recorder.entries) != 1 {
+			t.Fatalf("recorded %d entries, want 1", len(recorder.entries))
+		}
+		entry := recorder.entries[0]
+		if entry.Action != "webhook.update" || entry.Target != "whk_1" || entry.Outcome != audit.OutcomeFailure {
+			t.Errorf("entry = %+v", *entry)
+		}
+	})
+
+	t.Run("records rejected credentials as denied", func(t *testing.T) {
+		recorder := &mockRecorder{}
+		e := setup(recorder, func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+
+		rec := request(e, http.MethodGet, "/api/v2/tasks", "hlo_stolen", "")
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", rec.Code)
+		}
+		if len(recorder.entries) != 1 {
+			t.Fatalf("recorded %d entries, want 1", len(recorder.entries))
+		}
+		entry := recorder.entries[0]
+		if entry.Action != "GET /api/v2/tasks" || entry.ActorType != audit.ActorAnonymous || entry.Outcome != audit.OutcomeDenied {
+			t.Errorf("entry = %+v", *entry)
+		}
+	})
+
+	t.Run("skips permitted requests to unaudited routes", func(t *testing.T) {
+		recorder := &mockRecorder{}
+		e := setup(recorder, func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+
+		request(e, http.MethodGet, "/api/v2/tasks", "hlo_admin", "")
+
+		if len(recorder.entries) != 0 {
+			t.Errorf("recorded %d entries, want 0", len(recorder.entries))
+		}
+	})
+
+	t.Run("does not fail the request when recording fails", func(t *testing.T) {
+		recorder := &mockRecorder{err: errors.New("disk full")}
+		e := setup(recorder, func(c echo.Context) error {
+			return c.NoContent(http.StatusCreated)
+		})
+
+		rec := request(e, http.MethodPost, "/api/v2/tasks", "hlo_admin", `{}`)
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("status = %d, want 201", rec.Code)
+		}
+	})
+}
+
+func TestMiddleware_RejectsOversizedBodies(t *testing.T) {
+	recorder := &mockRecorder{}
+	e := setup(recorder, func(c echo.Context) error {
+		t.Error("the handler must not run")
+		return nil
+	})
+
+	rec := request(e, http.MethodPost, "/api/v2/tasks", "hlo_admin", strings.Repeat("x", MaxBodyBytes+1))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+	if len(recorder.entries) != 1 || recorder.entries[0].StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("entries = %+v, want the rejected request", recorder.entries)
+	}
+}
+
+func TestEntryFrom_WithoutMiddleware(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	EntryFrom(c).Target = "tsk_1"
+
+	if c.Get(contextKey) != nil {
+		t.Error("EntryFrom stored an entry without the middleware")
+	}
+}
@@ -0,0 +1,135 @@
+// Package operatorauth authenticates operators by their API token and
+// enforces their role on the routes they call.
+package operatorauth
+
+import (
+	"context"
+	"hostlink/domain/agent"
+	"hostlink/domain/operator"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contextKey is where the authenticated operator is stored on the echo
+// context, and tokenContextKey the token it presented.
+const (
+	contextKey      = "operator"
+	tokenContextKey = "operator_token"
+)
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*operator.Operator, *operator.Token, error)
+}
+
+// AgentFinder loads the agent a scoped operator's request is about.
+type AgentFinder interface {
+	FindByID(ctx context.Context, id string) (*agent.Agent, error)
+}
+
+type Config struct {
+	// Required rejects requests without a token. Otherwise they pass as
+	// anonymous, while a presented token must still be valid.
+	Required bool
+}
+
+func New(auth Authenticator) echo.MiddlewareFunc {
+	return Middleware(auth)
+}
+
+func NewWithConfig(auth Authenticator, cfg Config) echo.MiddlewareFunc {
+	return MiddlewareWithConfig(auth, cfg)
+}
+
+func Middleware(auth Authenticator) echo.MiddlewareFunc {
+	return MiddlewareWithConfig(auth, Config{Required: true})
+}
+
+func MiddlewareWithConfig(auth Authenticator, cfg Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			if header == "" {
+				if cfg.Required {
+					return echo.NewHTTPError(http.StatusUnauthorized, "missing operator token")
+				}
+				return next(c)
+			}
+
+			scheme, token, ok := strings.Cut(header, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid authorization header")
+			}
+
+			o, t, err := auth.Authenticate(c.Request().Context(), strings.TrimSpace(token))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "authentication failed")
+			}
+
+			c.Set(contextKey, o)
+			if t != nil {
+				c.Set(tokenContextKey, t)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireRole lets GET and HEAD requests through for operators holding
+// readRole and other requests for those holding writeRole. Anonymous
+// requests the auth middleware let through pass as well.
+func RequireRole(readRole, writeRole string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			o := FromContext(c)
+			if o == nil {
+				return next(c)
+			}
+
+			role := writeRole
+			if method := c.Request().Method; method == http.MethodGet || method == http.MethodHead {
+				role = readRole
+			}
+			if !o.Can(role) {
+				return echo.NewHTTPError(http.StatusForbidden, "requires the "+role+" role")
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireAgentInScope lets a scoped operator through only when the agent in
+// the :id path parameter is within its scope. An agent out of scope is
+// reported as not found, so its existence is not disclosed. Unscoped and
+// anonymous requests pass.
+func RequireAgentInScope(agents AgentFinder) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			o := FromContext(c)
+			if o == nil || !o.Scoped() {
+				return next(c)
+			}
+
+			a, err := agents.FindByID(c.Request().Context(), c.Param("id"))
+			if err != nil || a == nil || !o.InScope(a.Tags) {
+				return echo.NewHTTPError(http.StatusNotFound, "agent not found")
+			}
+			return next(c)
+		}
+	}
+}
+
+// FromContext returns the operator that authenticated the request, or nil
+// for anonymous requests.
+func FromContext(c echo.Context) *operator.Operator {
+	o, _ := c.Get(contextKey).(*operator.Operator)
+	return o
+}
+
+// TokenFromContext returns the token the request authenticated with, or nil
+// for anonymous requests.
+func TokenFromContext(c echo.Context) *operator.Token {
+	t, _ := c.Get(tokenContextKey).(*operator.Token)
+	return t
+}
@@ -0,0 +1,198 @@
+package operatorauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hostlink/domain/agent"
+	"hostlink/domain/operator"
+
+	"github.com/labstack/echo/v4"
+)
+
+type mockAuthenticator struct {
+	operators map[string]*operator.Operator
+}
+
+func (m *mockAuthenticator) Authenticate(ctx context.Context, token string) (*operator.Operator, *operator.Token, error) {
+	if o, ok := m.operators[token]; ok {
+		return o, &operator.Token{ID: "otk_" + o.ID, OperatorID: o.ID}, nil
+	}
+	return nil, nil, errors.New("invalid token")
+}
+
+func newAuthenticator() *mockAuthenticator {
+	return &mockAuthenticator{operators: map[string]*operator.Operator{
+		"hlo_viewer":   {ID: "opr_viewer", Role: operator.RoleViewer},
+		"hlo_operator": {ID: "opr_operator", Role: operator.RoleOperator},
+		"hlo_admin":    {ID: "opr_admin", Role: operator.RoleAdmin},
+	}}
+}
+
+// serve runs a request through the middleware chain and returns its status.
+func serve(t *testing.T, method, authorization string, middleware ...echo.MiddlewareFunc) (int, *operator.Operator) {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(method, "/api/v2/tasks", nil)
+	if authorization != "" {
+		req.Header.Set(echo.HeaderAuthorization, authorization)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var seen *operator.Operator
+	handler := func(c echo.Context) error {
+		seen = FromContext(c)
+		return c.NoContent(http.StatusOK)
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	if err := handler(c); err != nil {
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return httpErr.Code, nil
+	}
+	return rec.Code, seen
+}
+
+func TestMiddleware(t *testing.T) {
+	auth := newAuthenticator()
+
+	t.Run("stores the operator of a valid token", func(t *testing.T) {
+		code, o := serve(t, http.MethodGet, "Bearer hlo_viewer", Middleware(auth))
+		if code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+		if o == nil || o.ID != "opr_viewer" {
+			t.Errorf("operator = %+v, want opr_viewer", o)
+		}
+	})
+
+	t.Run("stores the token the operator presented", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/tasks", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer hlo_admin")
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		var token *operator.Token
+		err := Middleware(auth)(func(c echo.Context) error {
+			token = TokenFromContext(c)
+			return nil
+		})(c)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if token == nil || token.ID != "otk_opr_admin" {
+			t.Errorf("token = %+v, want otk_opr_admin", token)
+		}
+	})
+
+	t.Run("rejects missing, malformed and invalid tokens", func(t *testing.T) {
+		for _, authorization := range []string{"", "hlo_viewer", "Basic hlo_viewer", "Bearer hlo_unknown"} {
+			if code, _ := serve(t, http.MethodGet, authorization, Middleware(auth)); code != http.StatusUnauthorized {
+				t.Errorf("Authorization %q: status = %d, want 401", authorization, code)
+			}
+		}
+	})
+
+	t.Run("lets anonymous requests through when tokens are optional", func(t *testing.T) {
+		optional := MiddlewareWithConfig(auth, Config{})
+
+		code, o := serve(t, http.MethodPost, "", optional, RequireRole(operator.RoleViewer, operator.RoleAdmin))
+		if code != http.StatusOK || o != nil {
+			t.Errorf("anonymous: status = %d, operator = %+v", code, o)
+		}
+		if code, _ := serve(t, http.MethodGet, "Bearer hlo_unknown", optional); code != http.StatusUnauthorized {
+			t.Errorf("invalid token: status = %d, want 401", code)
+		}
+	})
+}
+
+func TestRequireRole(t *testing.T) {
+	auth := Middleware(newAuthenticator())
+	require := RequireRole(operator.RoleViewer, operator.RoleOperator)
+
+	tests := []struct {
+		method string
+		token  string
+		want   int
+	}{
+		{http.MethodGet, "hlo_viewer", http.StatusOK},
+		{http.MethodPost, "hlo_viewer", http.StatusForbidden},
+		{http.MethodPost, "hlo_operator", http.StatusOK},
+		{http.MethodPut, "hlo_admin", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code, _ := serve(t, tt.method, "Bearer "+tt.token, auth, require); code != tt.want {
+			t.Errorf("%s as %s: status = %d, want %d", tt.method, tt.token, code, tt.want)
+		}
+	}
+
+	t.Run("rejects disabled operators", func(t *testing.T) {
+		disabled := Middleware(&mockAuthenticator{operators: map[string]*operator.Operator{
+			"hlo_disabled": {ID: "opr_disabled", Role: operator.RoleAdmin, Disabled: true},
+		}})
+		if code, _ := serve(t, http.MethodGet, "Bearer hlo_disabled", disabled, require); code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", code)
+		}
+	})
+}
+
+type mockAgentFinder map[string]*agent.Agent
+
+func (m mockAgentFinder) FindByID(ctx context.Context, id string) (*agent.Agent, error) {
+	if a, ok := m[id]; ok {
+		return a, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func TestRequireAgentInScope(t *testing.T) {
+	auth := Middleware(&mockAuthenticator{operators: map[string]*operator.Operator{
+		"hlo_scoped": {ID: "opr_scoped", Role: operator.RoleViewer, Scope: []string{"env=staging"}},
+		"hlo_viewer": {ID: "opr_viewer", Role: operator.RoleViewer},
+	}})
+	scope := RequireAgentInScope(mockAgentFinder{
+		"agt_staging":    {ID: "agt_staging", Tags: []agent.AgentTag{{Key: "env", Value: "staging"}}},
+		"agt_production": {ID: "agt_production", Tags: []agent.AgentTag{{Key: "env", Value: "production"}}},
+	})
+
+	tests := []struct {
+		token   string
+		agentID string
+		want    int
+	}{
+		{"hlo_scoped", "agt_staging", http.StatusOK},
+		{"hlo_scoped", "agt_production", http.StatusNotFound},
+		{"hlo_scoped", "agt_missing", http.StatusNotFound},
+		{"hlo_viewer", "agt_production", http.StatusOK},
+	}
+	for _, tt := range tests {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/agents/"+tt.agentID+"/metrics", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(tt.agentID)
+
+		code := http.StatusOK
+		err := auth(scope(func(c echo.Context) error { return nil }))(c)
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			code = httpErr.Code
+		} else if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != tt.want {
+			t.Errorf("%s on %s: status = %d, want %d", tt.token, tt.agentID, code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hostlink/domain/agent"
+	"hostlink/internal/sysinfo"
+)
+
+// ErrPendingApproval is returned when a registration is held until an
+// operator approves it. The error is a *PendingApprovalError.
+var ErrPendingApproval = errors.New("registration pending approval")
+
+// PendingApprovalError carries the registration held for approval.
+type PendingApprovalError struct {
+	Registration *agent.PendingRegistration
+}
+
+func (e *PendingApprovalError) Error() string {
+	return ErrPendingApproval.Error()
+}
+
+func (e *PendingApprovalError) Is(target error) bool {
+	return target == ErrPendingApproval
+}
+
+// Approver resolves the registrations held for approval
+type Approver interface {
+	ListPending(ctx context.Context, status string) ([]agent.PendingRegistration, error)
+	// ApproveReplacement moves the candidate agent, with its ID, tags and
+	// history, to the registering host.
+	ApproveReplacement(ctx context.Context, id string) (*agent.Agent, error)
+	// ApproveNew registers the host as an agent of its own.
+	ApproveNew(ctx context.Context, id string) (*agent.Agent, error)
+}
+
+// holdForApproval holds a registration with an unknown fingerprint that
+// resembles an existing agent: one whose fingerprint the agent had before
+// its hardware drifted, or one with the same machine ID. It returns nil when
+// the registration resembles no agent, and a *PendingApprovalError when it
+// is held, also on later attempts until it is approved.
+func (s *RegistrationService) holdForApproval(ctx context.Context, req RegistrationRequest) error {
+	pending, err := s.agentRepo.FindPendingRegistrationByFingerprint(ctx, req.Fingerprint)
+	if err == nil {
+		return &PendingApprovalError{Registration: pending}
+	}
+	if !errors.Is(err, agent.ErrPendingRegistrationNotFound) {
+		return err
+	}
+
+	candidate, reason, err := s.findCandidate(ctx, req)
+	if err != nil || candidate == nil {
+		return err
+	}
+	snapshot, err := s.agentRepo.FindHardwareSnapshot(ctx, candidate.ID)
+	if err != nil {
+		return err
+	}
+
+	tags := make([]agent.AgentTag, 0, len(req.Tags))
+	for _, tag := range req.Tags {
+		tags = append(tags, agent.AgentTag{Key: tag.Key, Value: tag.Value, Source: tagSource(tag.Source)})
+	}
+	pending = &agent.PendingRegistration{
+		Fingerprint:      req.Fingerprint,
+		PublicKey:        req.PublicKey,
+		PublicKeyType:    req.PublicKeyType,
+		TokenID:          req.TokenID,
+		Hostname:         req.Hostname,
+		IPAddress:        req.IPAddress,
+		MACAddress:       req.MACAddress,
+		MachineID:        req.MachineID,
+		HardwareSnapshot: req.HardwareInfo,
+		Tags:             tags,
+		CandidateAgentID: candidate.ID,
+		SimilarityScore:  similarity(snapshot, req.HardwareInfo),
+		Reason:           reason,
+	}
+	err = s.agentRepo.Transaction(ctx, func(txRepo agent.Repository) error {
+		if err := txRepo.CreatePendingRegistration(ctx, pending); err != nil {
+			return err
+		}
+		return txRepo.AddRegistration(ctx, &agent.AgentRegistration{
+			AgentID:          candidate.ID,
+			Fingerprint:      req.Fingerprint,
+			TokenID:          req.TokenID,
+			Event:            agent.EventPendingApproval,
+			Error:            ErrPendingApproval.Error(),
+			HardwareSnapshot: req.HardwareInfo,
+			SimilarityScore:  pending.SimilarityScore,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return &PendingApprovalError{Registration: pending}
+}
+
+// findCandidate returns the agent a registration resembles, and why.
+func (s *RegistrationService) findCandidate(ctx context.Context, req RegistrationRequest) (*agent.Agent, string, error) {
+	if req.PreviousFingerprint != "" {
+		previous, err := s.agentRepo.FindByFingerprint(ctx, req.PreviousFingerprint)
+		if err == nil && previous != nil {
+			return previous, agent.DriftReplacement, nil
+		}
+	}
+	if req.MachineID != "" {
+		agents, err := s.agentRepo.FindAll(ctx, agent.AgentFilters{MachineID: &req.MachineID})
+		if err != nil {
+			return nil, "", err
+		}
+		if len(agents) > 0 {
+			return &agents[0], agent.DriftClone, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// similarity compares two hardware snapshots the way agents decide their
+// fingerprint drifted, in percent. Snapshots that are missing or unreadable
+// compare as 0.
+func similarity(previous, current string) int {
+	if previous == "" || current == "" {
+		return 0
+	}
+	var a, b sysinfo.HardwareInfo
+	if json.Unmarshal([]byte(previous), &a) != nil || json.Unmarshal([]byte(current), &b) != nil {
+		return 0
+	}
+	return sysinfo.CalculateSimilarity(&a, &b)
+}
+
+// ListPending lists held registrations in the given status, or in any when
+// status is empty, newest first.
+func (s *RegistrationService) ListPending(ctx context.Context, status string) ([]agent.PendingRegistration, error) {
+	return s.agentRepo.FindPendingRegistrations(ctx, status)
+}
+
+// ApproveReplacement gives the candidate agent the held registration's
+// fingerprint, key and host, keeping its ID, tags and history. The agent's
+// previous key stops authenticating it at once. A revoked candidate cannot
+// be replaced. Approving uses the registration's enrollment token once.
+func (s *RegistrationService) ApproveReplacement(ctx context.Context, id string) (*agent.Agent, error) {
+	pending, err := s.pending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var replaced *agent.Agent
+	err = s.agentRepo.Transaction(ctx, func(txRepo agent.Repository) error {
+		existing, err := txRepo.FindByID(ctx, pending.CandidateAgentID)
+		if err != nil {
+			return err
+		}
+		if existing.Access == agent.AccessRevoked {
+			return ErrAgentRevoked
+		}
+		if err := s.consumeToken(ctx, txRepo, pending.TokenID); err != nil {
+			return err
+		}
+
+		existing.Fingerprint = pending.Fingerprint
+		existing.PublicKey = pending.PublicKey
+		existing.PublicKeyType = pending.PublicKeyType
+		existing.PreviousPublicKey = ""
+		existing.PreviousPublicKeyExpiresAt = nil
+		existing.TokenID = pending.TokenID
+		existing.Hostname = pending.Hostname
+		existing.IPAddress = pending.IPAddress
+		existing.MACAddress = pending.MACAddress
+		existing.MachineID = pending.MachineID
+		if err := txRepo.Update(ctx, existing); err != nil {
+			return err
+		}
+
+		if err := s.resolve(ctx, txRepo, pending, agent.ApprovalReplacement, existing.ID); err != nil {
+			return err
+		}
+		replaced = existing
+		return txRepo.AddRegistration(ctx, &agent.AgentRegistration{
+			AgentID:          existing.ID,
+			Fingerprint:      pending.Fingerprint,
+			TokenID:          pending.TokenID,
+			Event:            agent.EventReplacement,
+			Success:          true,
+			HardwareSnapshot: pending.HardwareSnapshot,
+			SimilarityScore:  pending.SimilarityScore,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return replaced, nil
+}
+
+// ApproveNew registers the held registration as a new agent with the tags
+// it declared. Approving uses the registration's enrollment token once.
+func (s *RegistrationService) ApproveNew(ctx context.Context, id string) (*agent.Agent, error) {
+	pending, err := s.pending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	req := RegistrationRequest{
+		Fingerprint:   pending.Fingerprint,
+		TokenID:       pending.TokenID,
+		PublicKey:     pending.PublicKey,
+		PublicKeyType: pending.PublicKeyType,
+		Hostname:      pending.Hostname,
+		IPAddress:     pending.IPAddress,
+		MACAddress:    pending.MACAddress,
+		MachineID:     pending.MachineID,
+		HardwareInfo:  pending.HardwareSnapshot,
+	}
+	for _, tag := range pending.Tags {
+		req.Tags = append(req.Tags, TagPair{Key: tag.Key, Value: tag.Value, Source: tag.Source})
+	}
+
+	var created *agent.Agent
+	err = s.agentRepo.Transaction(ctx, func(txRepo agent.Repository) error {
+		if err := s.consumeToken(ctx, txRepo, pending.TokenID); err != nil {
+			return err
+		}
+		var err error
+		created, err = createAgent(ctx, txRepo, req, "register", pending.SimilarityScore)
+		if err != nil {
+			return err
+		}
+		return s.resolve(ctx, txRepo, pending, agent.ApprovalNew, created.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// pending returns the held registration with the ID, as long as it still
+// awaits approval.
+func (s *RegistrationService) pending(ctx context.Context, id string) (*agent.PendingRegistration, error) {
+	pending, err := s.agentRepo.FindPendingRegistration(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if pending.Status != agent.ApprovalPending {
+		return nil, agent.ErrRegistrationResolved
+	}
+	return pending, nil
+}
+
+func (s *RegistrationService) resolve(ctx context.Context, txRepo agent.Repository, pending *agent.PendingRegistration, status, agentID string) error {
+	now := s.now()
+	pending.Status = status
+	pending.AgentID = agentID
+	pending.ResolvedAt = &now
+	return txRepo.ResolvePendingRegistration(ctx, pending)
+}
@@ -0,0 +1,342 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	enrollmentService "hostlink/app/service/enrollment"
+	"hostlink/domain/agent"
+	"hostlink/domain/enrollment"
+	gormRepo "hostlink/internal/repository/gorm"
+	"hostlink/internal/sysinfo"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupApproval(t *testing.T) (*RegistrationService, agent.Repository) {
+	t.Helper()
+	repo := gormRepo.NewAgentRepository(setupApprovalDB(t))
+	return NewRegistrationService(repo), repo
+}
+
+// setupApprovalWithTokens also stores enrollment tokens, which the
+// registrations are not yet checked against.
+func setupApprovalWithTokens(t *testing.T) (*RegistrationService, *enrollmentService.Service, *gorm.DB) {
+	t.Helper()
+	db := setupApprovalDB(t)
+	return NewRegistrationService(gormRepo.NewAgentRepository(db)), enrollmentService.NewService(gormRepo.NewEnrollmentRepository(db)), db
+}
+
+func setupApprovalDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	require.NoError(t, db.AutoMigrate(&agent.Agent{}, &agent.AgentTag{}, &agent.AgentRegistration{}, &agent.PendingRegistration{}, &enrollment.Token{}))
+	return db
+}
+
+func snapshot(t *testing.T, info sysinfo.HardwareInfo) string {
+	t.Helper()
+	data, err := json.Marshal(info)
+	require.NoError(t, err)
+	return string(data)
+}
+
+var hostHardware = sysinfo.HardwareInfo{
+	BiosHash:      "bios",
+	DiskInfo:      "disk",
+	HostnameInfo:  "web-1",
+	IPAddressInfo: "10.0.0.1",
+	MACAddrInfo:   "aa:bb",
+	MachineID:     "machine-1",
+	MemoryHash:    "memory",
+	ProcessorHash: "cpu",
+	SystemHash:    "system",
+}
+
+// registerHost registers the original agent of hostHardware.
+func registerHost(t *testing.T, svc *RegistrationService) *agent.Agent {
+	t.Helper()
+	registered, err := svc.RegisterAgent(context.Background(), RegistrationRequest{
+		Fingerprint:  "fp-original",
+		TokenID:      "token",
+		TokenKey:     "key",
+		PublicKey:    "original-key",
+		MachineID:    hostHardware.MachineID,
+		HardwareInfo: snapshot(t, hostHardware),
+		Tags:         []TagPair{{Key: "env", Value: "prod"}},
+	})
+	require.NoError(t, err)
+	return registered
+}
+
+func TestHoldForApproval(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("holds a drifted host claiming its previous fingerprint as a replacement", func(t *testing.T) {
+		svc, repo := setupApproval(t)
+		original := registerHost(t, svc)
+		drifted := hostHardware
+		drifted.DiskInfo, drifted.MACAddrInfo, drifted.MachineID = "new-disk", "cc:dd", "machine-2"
+
+		_, err := svc.RegisterAgent(ctx, RegistrationRequest{
+			Fingerprint:         "fp-drifted",
+			PreviousFingerprint: "fp-original",
+			TokenID:             "token",
+			TokenKey:            "key",
+			PublicKey:           "new-key",
+			MachineID:           drifted.MachineID,
+			HardwareInfo:        snapshot(t, drifted),
+		})
+
+		var held *PendingApprovalError
+		require.ErrorAs(t, err, &held)
+		assert.ErrorIs(t, err, ErrPendingApproval)
+		assert.Equal(t, agent.ApprovalPending, held.Registration.Status)
+		assert.Equal(t, original.ID, held.Registration.CandidateAgentID)
+		assert.Equal(t, agent.DriftReplacement, held.Registration.Reason)
+		assert.Equal(t, 66, held.Registration.SimilarityScore)
+		_, err = repo.FindByFingerprint(ctx, "fp-drifted")
+		assert.Error(t, err, "no agent is created while the registration is held")
+	})
+
+	t.Run("holds an unknown fingerprint with a known machine ID as a clone", func(t *testing.T) {
+		svc, _ := setupApproval(t)
+		original := registerHost(t, svc)
+		clone := hostHardware
+		clone.HostnameInfo, clone.IPAddressInfo, clone.MACAddrInfo = "web-2", "10.0.0.2", "ee:ff"
+
+		_, err := svc.RegisterAgent(ctx, RegistrationRequest{
+			Fingerprint: "fp-clone", TokenID: "token", TokenKey: "key", PublicKey: "clone-key",
+			MachineID: clone.MachineID, HardwareInfo: snapshot(t, clone),
+		})
+
+		var held *PendingApprovalError
+		require.ErrorAs(t, err, &held)
+		assert.Equal(t, original.ID, held.Registration.CandidateAgentID)
+		assert.Equal(t, agent.DriftClone, held.Registration.Reason)
+	})
+
+	t.Run("keeps a held registration on later attempts", func(t *testing.T) {
+		svc, repo := setupApproval(t)
+		registerHost(t, svc)
+		req := RegistrationRequest{Fingerprint: "fp-clone", TokenID: "token", TokenKey: "key", PublicKey: "clone-key", MachineID: hostHardware.MachineID}
+
+		_, first := svc.RegisterAgent(ctx, req)
+		_, second := svc.RegisterAgent(ctx, req)
+
+		var held1, held2 *PendingApprovalError
+		require.ErrorAs(t, first, &held1)
+		require.ErrorAs(t, second, &held2)
+		assert.Equal(t, held1.Registration.ID, held2.Registration.ID)
+		pending, err := repo.FindPendingRegistrations(ctx, agent.ApprovalPending)
+		require.NoError(t, err)
+		assert.Len(t, pending, 1)
+	})
+
+	t.Run("registers a host resembling no agent", func(t *testing.T) {
+		svc, _ := setupApproval(t)
+		registerHost(t, svc)
+
+		registered, err := svc.RegisterAgent(ctx, RegistrationRequest{
+			Fingerprint: "fp-other", TokenID: "token", TokenKey: "key", PublicKey: "other-key", MachineID: "machine-9",
+		})
+
+		require.NoError(t, err)
+		assert.NotEmpty(t, registered.ID)
+	})
+
+	t.Run("registers without holding when approval is disabled", func(t *testing.T) {
+		svc, _ := setupApproval(t)
+		registerHost(t, svc)
+
+		registered, err := svc.WithApproval(false).RegisterAgent(ctx, RegistrationRequest{
+			Fingerprint: "fp-clone", TokenID: "token", TokenKey: "key", PublicKey: "clone-key", MachineID: hostHardware.MachineID,
+		})
+
+		require.NoError(t, err)
+		assert.NotEmpty(t, registered.ID)
+	})
+}
+
+func TestApprovalTokenUses(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("uses the token once, when the held registration is approved", func(t *testing.T) {
+		svc, tokens, _ := setupApprovalWithTokens(t)
+		registerHost(t, svc)
+		key, token, err := tokens.Create(ctx, "clones", nil, 1, 0, "")
+		require.NoError(t, err)
+		svc.WithEnrollment(tokens, true)
+		req := RegistrationRequest{Fingerprint: "fp-clone", TokenID: token.ID, TokenKey: key, PublicKey: "clone-key", MachineID: hostHardware.MachineID}
+		uses := func() int {
+			found, err := tokens.Find(ctx, token.ID)
+			require.NoError(t, err)
+			return found.Uses
+		}
+
+		var held *PendingApprovalError
+		for range 3 {
+			_, err := svc.RegisterAgent(ctx, req)
+			require.ErrorAs(t, err, &held)
+		}
+		assert.Equal(t, 0, uses(), "held attempts do not use the token")
+
+		created, err := svc.ApproveNew(ctx, held.Registration.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, uses())
+
+		again, err := svc.RegisterAgent(ctx, req)
+		require.NoError(t, err, "the approved agent re-registers with its used-up token")
+		assert.Equal(t, created.ID, again.ID)
+		assert.Equal(t, 1, uses(), "re-registering does not use the token")
+	})
+
+	t.Run("leaves the token unused when the agent cannot be created", func(t *testing.T) {
+		svc, tokens, db := setupApprovalWithTokens(t)
+		registerHost(t, svc)
+		key, token, err := tokens.Create(ctx, "clones", nil, 1, 0, "")
+		require.NoError(t, err)
+		svc.WithEnrollment(tokens, true)
+		pending := holdCloneWithToken(t, svc, token.ID, key)
+		require.NoError(t, db.Migrator().DropTable(&agent.AgentTag{}))
+
+		_, err = svc.ApproveNew(ctx, pending.ID)
+
+		require.Error(t, err)
+		found, err := tokens.Find(ctx, token.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 0, found.Uses)
+	})
+}
+
+// holdClone holds a registration resembling the original agent.
+func holdClone(t *testing.T, svc *RegistrationService) *agent.PendingRegistration {
+	t.Helper()
+	return holdCloneWithToken(t, svc, "token", "key")
+}
+
+func holdCloneWithToken(t *testing.T, svc *RegistrationService, tokenID, tokenKey string) *agent.PendingRegistration {
+	t.Helper()
+	_, err := svc.RegisterAgent(context.Background(), RegistrationRequest{
+		Fingerprint: "fp-clone", TokenID: tokenID, TokenKey: tokenKey, PublicKey: "clone-key", PublicKeyType: "ed25519",
+		Hostname: "web-2", MachineID: hostHardware.MachineID, Tags: []TagPair{{Key: "os", Value: "linux"}},
+	})
+	var held *PendingApprovalError
+	require.ErrorAs(t, err, &held)
+	return held.Registration
+}
+
+func TestApproveReplacement(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("moves the agent to the new host and keeps its ID and tags", func(t *testing.T) {
+		svc, repo := setupApproval(t)
+		original := registerHost(t, svc)
+		pending := holdClone(t, svc)
+
+		replaced, err := svc.ApproveReplacement(ctx, pending.ID)
+
+		require.NoError(t, err)
+		assert.Equal(t, original.ID, replaced.ID)
+		stored, err := repo.FindByFingerprint(ctx, "fp-clone")
+		require.NoError(t, err)
+		assert.Equal(t, original.ID, stored.ID)
+		assert.Equal(t, "clone-key", stored.PublicKey)
+		assert.Equal(t, "web-2", stored.Hostname)
+		require.Len(t, stored.Tags, 1)
+		assert.Equal(t, "env", stored.Tags[0].Key)
+		resolved, err := repo.FindPendingRegistration(ctx, pending.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent.ApprovalReplacement, resolved.Status)
+		assert.Equal(t, original.ID, resolved.AgentID)
+		assert.NotNil(t, resolved.ResolvedAt)
+
+		again, err := svc.RegisterAgent(ctx, RegistrationRequest{Fingerprint: "fp-clone", TokenID: "token", TokenKey: "key", PublicKey: "clone-key"})
+		require.NoError(t, err, "the approved host re-registers as the agent")
+		assert.Equal(t, original.ID, again.ID)
+	})
+
+	t.Run("refuses a revoked candidate", func(t *testing.T) {
+		svc, repo := setupApproval(t)
+		original := registerHost(t, svc)
+		pending := holdClone(t, svc)
+		require.NoError(t, repo.SetAccess(ctx, agent.AccessChange{AgentID: original.ID, Access: agent.AccessRevoked}))
+
+		_, err := svc.ApproveReplacement(ctx, pending.ID)
+
+		assert.ErrorIs(t, err, ErrAgentRevoked)
+	})
+
+	t.Run("refuses a registration whose token can no longer be used", func(t *testing.T) {
+		svc, tokens, _ := setupApprovalWithTokens(t)
+		original := registerHost(t, svc)
+		key, token, err := tokens.Create(ctx, "clones", nil, 0, 0, "")
+		require.NoError(t, err)
+		svc.WithEnrollment(tokens, true)
+		pending := holdCloneWithToken(t, svc, token.ID, key)
+		require.NoError(t, tokens.Revoke(ctx, token.ID))
+
+		_, err = svc.ApproveReplacement(ctx, pending.ID)
+
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		kept, err := svc.agentRepo.FindByID(ctx, original.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "original-key", kept.PublicKey)
+	})
+
+	t.Run("refuses a resolved registration", func(t *testing.T) {
+		svc, _ := setupApproval(t)
+		registerHost(t, svc)
+		pending := holdClone(t, svc)
+		_, err := svc.ApproveNew(ctx, pending.ID)
+		require.NoError(t, err)
+
+		_, err = svc.ApproveReplacement(ctx, pending.ID)
+
+		assert.ErrorIs(t, err, agent.ErrRegistrationResolved)
+	})
+
+	t.Run("returns not found for an unknown registration", func(t *testing.T) {
+		svc, _ := setupApproval(t)
+
+		_, err := svc.ApproveReplacement(ctx, "reg_missing")
+
+		assert.ErrorIs(t, err, agent.ErrPendingRegistrationNotFound)
+	})
+}
+
+func TestApproveNew(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := setupApproval(t)
+	original := registerHost(t, svc)
+	pending := holdClone(t, svc)
+
+	created, err := svc.ApproveNew(ctx, pending.ID)
+
+	require.NoError(t, err)
+	assert.NotEqual(t, original.ID, created.ID)
+	stored, err := repo.FindByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "fp-clone", stored.Fingerprint)
+	assert.Equal(t, "clone-key", stored.PublicKey)
+	require.Len(t, stored.Tags, 1)
+	assert.Equal(t, "os", stored.Tags[0].Key)
+	kept, err := repo.FindByID(ctx, original.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "original-key", kept.PublicKey, "the original agent is untouched")
+	resolved, err := repo.FindPendingRegistration(ctx, pending.ID)
+	require.NoError(t, err)
+	assert.Equal(t, agent.ApprovalNew, resolved.Status)
+	assert.Equal(t, created.ID, resolved.AgentID)
+}
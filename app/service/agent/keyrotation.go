@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hostlink/domain/agent"
+	"hostlink/internal/crypto"
+	"time"
+)
+
+var (
+	ErrInvalidPublicKey = errors.New("invalid public key")
+	ErrInvalidKeyProof  = errors.New("invalid proof of key possession")
+)
+
+// DefaultKeyRotationOverlap is how long the previous key keeps
+// authenticating an agent after it rotates, so requests signed just before
+// the rotation still go through.
+const DefaultKeyRotationOverlap = time.Hour
+
+// KeyRotator defines the interface for agent key rotation
+type KeyRotator interface {
+	RotateKey(ctx context.Context, agentID string, req KeyRotationRequest) (*agent.Agent, error)
+}
+
+// KeyRotationRequest is sent by an agent, authenticated with its current
+// key, to switch to PublicKey. Proof is the signature of
+// agent.KeyProofMessage made with the new key.
+type KeyRotationRequest struct {
+	PublicKey     string              `json:"public_key"`
+	PublicKeyType string              `json:"public_key_type"`
+	Proof         string              `json:"proof"`
+	Credentials   []RotatedCredential `json:"credentials"`
+	Secrets       []RotatedSecret     `json:"secrets"`
+}
+
+// RotatedCredential is a stored credential password the agent decrypted
+// with its current key and encrypted again with the new one.
+type RotatedCredential struct {
+	ID                string `json:"id"`
+	PreviousPasswdEnc string `json:"previous_passwd_enc"`
+	PasswdEnc         string `json:"passwd_enc"`
+}
+
+// RotatedSecret is a secret value the agent opened with its current key
+// and sealed again for the new one.
+type RotatedSecret struct {
+	ID               string `json:"id"`
+	PreviousValueEnc string `json:"previous_value_enc"`
+	ValueEnc         string `json:"value_enc"`
+}
+
+type KeyRotationService struct {
+	agentRepo agent.Repository
+	overlap   time.Duration
+	now       func() time.Time
+}
+
+func NewKeyRotationService(repo agent.Repository, overlap time.Duration) *KeyRotationService {
+	if overlap <= 0 {
+		overlap = DefaultKeyRotationOverlap
+	}
+	return &KeyRotationService{agentRepo: repo, overlap: overlap, now: time.Now}
+}
+
+// RotateKey replaces the agent's key once the agent proved it holds the new
+// one. Rotating to the key the agent already has returns the agent
+// unchanged, so an agent that lost the response can safely retry.
+func (s *KeyRotationService) RotateKey(ctx context.Context, agentID string, req KeyRotationRequest) (*agent.Agent, error) {
+	existing, err := s.agentRepo.FindByID(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if req.PublicKey == existing.PublicKey {
+		return existing, nil
+	}
+
+	publicKey, err := crypto.ParsePublicKeyBase64(req.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+	if err := crypto.VerifyMessage(agent.KeyProofMessage(agentID, req.PublicKey), req.Proof, publicKey); err != nil {
+		return nil, ErrInvalidKeyProof
+	}
+
+	now := s.now()
+	rotation := &agent.KeyRotation{
+		AgentID:            agentID,
+		OldPublicKey:       existing.PublicKey,
+		PublicKey:          req.PublicKey,
+		PublicKeyType:      crypto.KeyType(publicKey),
+		RotatedAt:          now,
+		PreviousValidUntil: now.Add(s.overlap),
+	}
+	for _, cred := range req.Credentials {
+		rotation.Credentials = append(rotation.Credentials, agent.CredentialKey{
+			ID:                cred.ID,
+			PreviousPasswdEnc: cred.PreviousPasswdEnc,
+			PasswdEnc:         cred.PasswdEnc,
+		})
+	}
+	for _, secret := range req.Secrets {
+		rotation.Secrets = append(rotation.Secrets, agent.SecretKey{
+			ID:               secret.ID,
+			PreviousValueEnc: secret.PreviousValueEnc,
+			ValueEnc:         secret.ValueEnc,
+		})
+	}
+	if err := s.agentRepo.RotateKey(ctx, rotation); err != nil {
+		return nil, err
+	}
+
+	existing.PreviousPublicKey = existing.PublicKey
+	existing.PreviousPublicKeyExpiresAt = &rotation.PreviousValidUntil
+	existing.PublicKey = req.PublicKey
+	existing.PublicKeyType = rotation.PublicKeyType
+	existing.KeyRotatedAt = &rotation.RotatedAt
+	return existing, nil
+}
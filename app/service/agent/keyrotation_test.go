@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"hostlink/domain/agent"
+	"hostlink/internal/crypto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRotationService(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newKeyPair := func(t *testing.T) (*rsa.PrivateKey, string) {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		publicKey, err := crypto.GetPublicKeyBase64(privateKey)
+		require.NoError(t, err)
+		return privateKey, publicKey
+	}
+	proof := func(t *testing.T, privateKey *rsa.PrivateKey, agentID, publicKey string) string {
+		signature, err := crypto.SignMessage(agent.KeyProofMessage(agentID, publicKey), privateKey)
+		require.NoError(t, err)
+		return signature
+	}
+	newService := func(repo agent.Repository) *KeyRotationService {
+		svc := NewKeyRotationService(repo, 30*time.Minute)
+		svc.now = func() time.Time { return now }
+		return svc
+	}
+	existingAgent := func() *agent.Agent {
+		return &agent.Agent{ID: "agt_1", PublicKey: "old-key", PublicKeyType: "rsa"}
+	}
+
+	t.Run("rotates to a proven key", func(t *testing.T) {
+		privateKey, publicKey := newKeyPair(t)
+		var rotation *agent.KeyRotation
+		repo := &mockAgentRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*agent.Agent, error) {
+				return existingAgent(), nil
+			},
+			rotateKeyFunc: func(ctx context.Context, r *agent.KeyRotation) error {
+				rotation = r
+				return nil
+			},
+		}
+
+		updated, err := newService(repo).RotateKey(context.Background(), "agt_1", KeyRotationRequest{
+			PublicKey:     publicKey,
+			PublicKeyType: "rsa",
+			Proof:         proof(t, privateKey, "agt_1", publicKey),
+			Credentials:   []RotatedCredential{{ID: "crd_1", PreviousPasswdEnc: "a", PasswdEnc: "b"}},
+			Secrets:       []RotatedSecret{{ID: "sec_1", PreviousValueEnc: "c", ValueEnc: "d"}},
+		})
+		require.NoError(t, err)
+
+		require.NotNil(t, rotation)
+		assert.Equal(t, "old-key", rotation.OldPublicKey)
+		assert.Equal(t, publicKey, rotation.PublicKey)
+		assert.Equal(t, now.Add(30*time.Minute), rotation.PreviousValidUntil)
+		assert.Equal(t, []agent.CredentialKey{{ID: "crd_1", PreviousPasswdEnc: "a", PasswdEnc: "b"}}, rotation.Credentials)
+		assert.Equal(t, []agent.SecretKey{{ID: "sec_1", PreviousValueEnc: "c", ValueEnc: "d"}}, rotation.Secrets)
+		assert.Equal(t, publicKey, updated.PublicKey)
+		assert.Equal(t, "old-key", updated.PreviousPublicKey)
+		assert.Equal(t, now.Add(30*time.Minute), *updated.PreviousPublicKeyExpiresAt)
+	})
+
+	t.Run("rotates to a key of another type", func(t *testing.T) {
+		privateKey, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+		require.NoError(t, err)
+		publicKey, err := crypto.PublicKeyBase64(privateKey)
+		require.NoError(t, err)
+		signature, err := crypto.SignMessage(agent.KeyProofMessage("agt_1", publicKey), privateKey)
+		require.NoError(t, err)
+		var rotation *agent.KeyRotation
+		repo := &mockAgentRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*agent.Agent, error) {
+				return existingAgent(), nil
+			},
+			rotateKeyFunc: func(ctx context.Context, r *agent.KeyRotation) error {
+				rotation = r
+				return nil
+			},
+		}
+
+		updated, err := newService(repo).RotateKey(context.Background(), "agt_1", KeyRotationRequest{
+			PublicKey:     publicKey,
+			PublicKeyType: "rsa",
+			Proof:         signature,
+		})
+		require.NoError(t, err)
+
+		require.NotNil(t, rotation)
+		assert.Equal(t, crypto.KeyTypeEd25519, rotation.PublicKeyType, "the type is read from the key")
+		assert.Equal(t, crypto.KeyTypeEd25519, updated.PublicKeyType)
+	})
+
+	t.Run("rejects a proof not made with the new key", func(t *testing.T) {
+		_, publicKey := newKeyPair(t)
+		otherKey, _ := newKeyPair(t)
+		repo := &mockAgentRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*agent.Agent, error) {
+				return existingAgent(), nil
+			},
+			rotateKeyFunc: func(ctx context.Context, r *agent.KeyRotation) error {
+				t.Fatal("rotation must not be stored")
+				return nil
+			},
+		}
+
+		_, err := newService(repo).RotateKey(context.Background(), "agt_1", KeyRotationRequest{
+			PublicKey: publicKey,
+			Proof:     proof(t, otherKey, "agt_1", publicKey),
+		})
+		assert.ErrorIs(t, err, ErrInvalidKeyProof)
+	})
+
+	t.Run("rejects a proof made for another agent", func(t *testing.T) {
+		privateKey, publicKey := newKeyPair(t)
+		repo := &mockAgentRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*agent.Agent, error) {
+				return existingAgent(), nil
+			},
+		}
+
+		_, err := newService(repo).RotateKey(context.Background(), "agt_1", KeyRotationRequest{
+			PublicKey: publicKey,
+			Proof:     proof(t, privateKey, "agt_2", publicKey),
+		})
+		assert.ErrorIs(t, err, ErrInvalidKeyProof)
+	})
+
+	t.Run("rejects an invalid public key", func(t *testing.T) {
+		repo := &mockAgentRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*agent.Agent, error) {
+				return existingAgent(), nil
+			},
+		}
+
+		_, err := newService(repo).RotateKey(context.Background(), "agt_1", KeyRotationRequest{
+			PublicKey: "not-a-key",
+		})
+		assert.ErrorIs(t, err, ErrInvalidPublicKey)
+	})
+
+	t.Run("retrying a completed rotation returns the agent", func(t *testing.T) {
+		repo := &mockAgentRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*agent.Agent, error) {
+				return existingAgent(), nil
+			},
+			rotateKeyFunc: func(ctx context.Context, r *agent.KeyRotation) error {
+				t.Fatal("rotation must not be stored again")
+				return nil
+			},
+		}
+
+		updated, err := newService(repo).RotateKey(context.Background(), "agt_1", KeyRotationRequest{
+			PublicKey: "old-key",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "old-key", updated.PublicKey)
+	})
+
+	t.Run("returns repository conflicts", func(t *testing.T) {
+		privateKey, publicKey := newKeyPair(t)
+		repo := &mockAgentRepository{
+			findByIDFunc: func(ctx context.Context, id string) (*agent.Agent, error) {
+				return existingAgent(), nil
+			},
+			rotateKeyFunc: func(ctx context.Context, r *agent.KeyRotation) error {
+				return agent.ErrCredentialsChanged
+			},
+		}
+
+		_, err := newService(repo).RotateKey(context.Background(), "agt_1", KeyRotationRequest{
+			PublicKey: publicKey,
+			Proof:     proof(t, privateKey, "agt_1", publicKey),
+		})
+		assert.ErrorIs(t, err, agent.ErrCredentialsChanged)
+	})
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	webhookService "hostlink/app/service/webhook"
+	"hostlink/domain/agent"
+	"hostlink/domain/webhook"
+)
+
+// LivenessThresholds are how long an agent may stay silent before it is
+// considered stale and offline.
+type LivenessThresholds struct {
+	StaleAfter   time.Duration
+	OfflineAfter time.Duration
+}
+
+// DefaultLivenessThresholds tolerates a few missed heartbeats before an
+// agent turns stale.
+func DefaultLivenessThresholds() LivenessThresholds {
+	return LivenessThresholds{
+		StaleAfter:   time.Minute,
+		OfflineAfter: 5 * time.Minute,
+	}
+}
+
+// LivenessService derives agent status from when agents were last seen.
+type LivenessService struct {
+	agentRepo  agent.Repository
+	thresholds LivenessThresholds
+	started    time.Time
+	now        func() time.Time
+	publisher  webhookService.Publisher
+}
+
+func NewLivenessService(repo agent.Repository, thresholds LivenessThresholds) *LivenessService {
+	if thresholds.OfflineAfter < thresholds.StaleAfter {
+		thresholds.OfflineAfter = thresholds.StaleAfter
+	}
+	return &LivenessService{agentRepo: repo, thresholds: thresholds, started: time.Now(), now: time.Now}
+}
+
+// WithPublisher publishes an agent.offline webhook event for every agent
+// the sweep marks offline.
+func (s *LivenessService) WithPublisher(publisher webhookService.Publisher) *LivenessService {
+	s.publisher = publisher
+	return s
+}
+
+// Sweep marks silent agents offline, then marks the remaining silent ones
+// stale, and returns the transitions it recorded. Agents come back online
+// through their next heartbeat. Silence only counts while the service runs,
+// so a server restart does not flag every agent at once.
+func (s *LivenessService) Sweep(ctx context.Context) ([]agent.StatusEvent, error) {
+	now := s.now()
+
+	offline, err := s.mark(ctx, now, s.thresholds.OfflineAfter, agent.StatusOffline,
+		agent.StatusActive, agent.StatusOnline, agent.StatusStale)
+	if err != nil {
+		return nil, fmt.Errorf("mark offline: %w", err)
+	}
+	if err := s.publishOffline(ctx, offline); err != nil {
+		return offline, err
+	}
+
+	stale, err := s.mark(ctx, now, s.thresholds.StaleAfter, agent.StatusStale,
+		agent.StatusActive, agent.StatusOnline)
+	if err != nil {
+		return offline, fmt.Errorf("mark stale: %w", err)
+	}
+
+	return append(offline, stale...), nil
+}
+
+func (s *LivenessService) mark(ctx context.Context, now time.Time, after time.Duration, to string, from ...string) ([]agent.StatusEvent, error) {
+	seenBefore := now.Add(-after)
+	if !s.started.Before(seenBefore) {
+		return nil, nil
+	}
+	return s.agentRepo.MarkStatus(ctx, from, to, seenBefore, fmt.Sprintf("not seen for %s", after))
+}
+
+func (s *LivenessService) publishOffline(ctx context.Context, events []agent.StatusEvent) error {
+	if s.publisher == nil {
+		return nil
+	}
+	for _, event := range events {
+		err := s.publisher.Publish(ctx, webhook.EventAgentOffline, webhook.AgentData{
+			ID:       event.AgentID,
+			Status:   event.To,
+			LastSeen: event.LastSeen,
+			Reason:   event.Reason,
+		})
+		if err != nil {
+			return fmt.Errorf("publish %s for %s: %w", webhook.EventAgentOffline, event.AgentID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"hostlink/domain/agent"
+	"hostlink/domain/webhook"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLivenessService(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("marks silent agents offline before stale", func(t *testing.T) {
+		type call struct {
+			from       []string
+			to         string
+			seenBefore time.Time
+		}
+		var calls []call
+		repo := &mockAgentRepository{
+			markStatusFunc: func(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error) {
+				calls = append(calls, call{from, to, seenBefore})
+				return []agent.StatusEvent{{AgentID: "agt_" + to, To: to}}, nil
+			},
+		}
+		svc := NewLivenessService(repo, LivenessThresholds{StaleAfter: time.Minute, OfflineAfter: 10 * time.Minute})
+		svc.started = now.Add(-time.Hour)
+		svc.now = func() time.Time { return now }
+
+		events, err := svc.Sweep(context.Background())
+
+		require.NoError(t, err)
+		require.Len(t, calls, 2)
+		assert.Equal(t, agent.StatusOffline, calls[0].to)
+		assert.Equal(t, now.Add(-10*time.Minute), calls[0].seenBefore)
+		assert.ElementsMatch(t, []string{agent.StatusActive, agent.StatusOnline, agent.StatusStale}, calls[0].from)
+		assert.Equal(t, agent.StatusStale, calls[1].to)
+		assert.Equal(t, now.Add(-time.Minute), calls[1].seenBefore)
+		assert.ElementsMatch(t, []string{agent.StatusActive, agent.StatusOnline}, calls[1].from)
+		require.Len(t, events, 2)
+	})
+
+	t.Run("never goes offline before stale", func(t *testing.T) {
+		var offlineBefore time.Time
+		repo := &mockAgentRepository{
+			markStatusFunc: func(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error) {
+				if to == agent.StatusOffline {
+					offlineBefore = seenBefore
+				}
+				return nil, nil
+			},
+		}
+		svc := NewLivenessService(repo, LivenessThresholds{StaleAfter: 5 * time.Minute, OfflineAfter: time.Minute})
+		svc.started = now.Add(-time.Hour)
+		svc.now = func() time.Time { return now }
+
+		_, err := svc.Sweep(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(-5*time.Minute), offlineBefore)
+	})
+
+	t.Run("ignores silence from before the service started", func(t *testing.T) {
+		var marked []string
+		repo := &mockAgentRepository{
+			markStatusFunc: func(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error) {
+				marked = append(marked, to)
+				return nil, nil
+			},
+		}
+		svc := NewLivenessService(repo, LivenessThresholds{StaleAfter: time.Minute, OfflineAfter: 10 * time.Minute})
+		svc.started = now.Add(-2 * time.Minute)
+		svc.now = func() time.Time { return now }
+
+		_, err := svc.Sweep(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{agent.StatusStale}, marked)
+	})
+
+	t.Run("returns repository errors", func(t *testing.T) {
+		repo := &mockAgentRepository{
+			markStatusFunc: func(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error) {
+				return nil, errors.New("db down")
+			},
+		}
+		svc := NewLivenessService(repo, DefaultLivenessThresholds())
+		svc.started = now.Add(-time.Hour)
+		svc.now = func() time.Time { return now }
+
+		_, err := svc.Sweep(context.Background())
+
+		assert.ErrorContains(t, err, "db down")
+	})
+}
+
+type mockPublisher struct {
+	events []string
+	data   []any
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, eventType string, data any) error {
+	m.events = append(m.events, eventType)
+	m.data = append(m.data, data)
+	return nil
+}
+
+func TestLivenessServicePublishesOffline(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := &mockAgentRepository{
+		markStatusFunc: func(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error) {
+			return []agent.StatusEvent{{AgentID: "agt_1", From: agent.StatusOnline, To: to, Reason: reason}}, nil
+		},
+	}
+	publisher := &mockPublisher{}
+	svc := NewLivenessService(repo, DefaultLivenessThresholds()).WithPublisher(publisher)
+	svc.started = now.Add(-time.Hour)
+	svc.now = func() time.Time { return now }
+
+	_, err := svc.Sweep(context.Background())
+
+	require.NoError(t, err)
+	require.Equal(t, []string{webhook.EventAgentOffline}, publisher.events)
+	data := publisher.data[0].(webhook.AgentData)
+	assert.Equal(t, "agt_1", data.ID)
+	assert.Equal(t, agent.StatusOffline, data.Status)
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"hostlink/domain/agent"
+	"hostlink/domain/enrollment"
 	"time"
 )
 
 var (
 	ErrInvalidToken   = errors.New("invalid token")
 	ErrDuplicateAgent = errors.New("agent already exists")
+	// ErrAgentRevoked is returned when a revoked agent registers again
+	ErrAgentRevoked = agent.ErrAgentRevoked
 )
 
 // Registrar defines the interface for agent registration operations
@@ -31,82 +34,110 @@ type RegistrationRequest struct {
 	MACAddress   string `json:"mac_address,omitempty"`
 	MachineID    string `json:"machine_id,omitempty"`
 	HardwareInfo string `json:"hardware_info,omitempty"`
+	// PreviousFingerprint is the fingerprint the agent had before its
+	// hardware drifted, if it did
+	PreviousFingerprint string `json:"previous_fingerprint,omitempty"`
 }
 
 type TagPair struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
+	// Source is agent.TagSourceServer or agent.TagSourceAgent; an empty
+	// source is a server tag
+	Source string `json:"-"`
+}
+
+// Enroller checks the enrollment token an agent registers with. Its uses
+// are counted through the agent repository, with the agent they enroll.
+type Enroller interface {
+	// Verify checks the token's key without counting a use, and returns
+	// the token whether or not it can still enroll an agent
+	Verify(ctx context.Context, tokenID, tokenKey string) (*enrollment.Token, error)
 }
 
 type RegistrationService struct {
-	agentRepo agent.Repository
+	agentRepo     agent.Repository
+	enroller      Enroller
+	tokenRequired bool
+	// approval holds registrations that look like a clone or a replacement
+	// of an existing agent until an operator approves them
+	approval bool
+	now      func() time.Time
 }
 
 func NewRegistrationService(repo agent.Repository) *RegistrationService {
-	return &RegistrationService{agentRepo: repo}
+	return &RegistrationService{agentRepo: repo, approval: true, now: time.Now}
+}
+
+// WithEnrollment checks registrations against enrollment tokens. Unless
+// required, a token ID that is not an enrollment token is still accepted,
+// so agents installed before enrollment tokens existed keep registering.
+func (s *RegistrationService) WithEnrollment(enroller Enroller, required bool) *RegistrationService {
+	s.enroller = enroller
+	s.tokenRequired = required
+	return s
+}
+
+// WithApproval sets whether registrations that look like a clone or a
+// replacement of an existing agent are held for approval (default: true).
+func (s *RegistrationService) WithApproval(enabled bool) *RegistrationService {
+	s.approval = enabled
+	return s
 }
 
 func (s *RegistrationService) RegisterAgent(ctx context.Context, req RegistrationRequest) (*agent.Agent, error) {
-	// TODO: Implement proper token validation
-	if !s.isValidToken(req.TokenID, req.TokenKey) {
-		return nil, ErrInvalidToken
+	token, err := s.verifyToken(ctx, req.TokenID, req.TokenKey)
+	if err != nil {
+		return nil, err
+	}
+	var tokenTags []agent.AgentTag
+	if token != nil {
+		tokenTags = token.AgentTags()
 	}
+	req.Tags = mergeTags(req.Tags, tokenTags)
 
 	// Check for existing agent
 	existing, err := s.agentRepo.FindByFingerprint(ctx, req.Fingerprint)
 	if err == nil && existing != nil {
+		if existing.Access == agent.AccessRevoked {
+			return nil, ErrAgentRevoked
+		}
+		// Re-registering enrolls no new agent, so it does not use the
+		// token, and a token used up since still serves the agent
+		if err := s.tokenUsable(token, true); err != nil {
+			return nil, err
+		}
 		return s.handleReregistration(ctx, existing, req)
 	}
 
-	// Create new agent with transaction
-	var newAgent *agent.Agent
-	err = s.agentRepo.Transaction(ctx, func(txRepo agent.Repository) error {
-		// Create agent
-		newAgent = &agent.Agent{
-			Fingerprint:   req.Fingerprint,
-			PublicKey:     req.PublicKey,
-			PublicKeyType: req.PublicKeyType,
-			TokenID:       req.TokenID,
-			Hostname:      req.Hostname,
-			IPAddress:     req.IPAddress,
-			MACAddress:    req.MACAddress,
-			MachineID:     req.MachineID,
+	if err := s.tokenUsable(token, false); err != nil {
+		return nil, err
+	}
+	// A held registration uses its token once, when it is approved, however
+	// often the agent retries meanwhile
+	if s.approval {
+		if err := s.holdForApproval(ctx, req); err != nil {
+			return nil, err
 		}
+	}
 
-		if err := txRepo.Create(ctx, newAgent); err != nil {
+	// Create new agent with transaction, which also uses the token, so a
+	// failed creation leaves the token's uses as they were
+	var newAgent *agent.Agent
+	err = s.agentRepo.Transaction(ctx, func(txRepo agent.Repository) error {
+		if err := s.consumeToken(ctx, txRepo, req.TokenID); err != nil {
 			return err
 		}
-
-		// Add tags
-		if len(req.Tags) > 0 {
-			var tags []agent.AgentTag
-			for _, tag := range req.Tags {
-				tags = append(tags, agent.AgentTag{
-					Key:   tag.Key,
-					Value: tag.Value,
-				})
-			}
-			if err := txRepo.AddTags(ctx, newAgent.ID, tags); err != nil {
-				return err
-			}
-		}
-
-		// Add registration record
-		registration := &agent.AgentRegistration{
-			AgentID:          newAgent.ID,
-			Fingerprint:      req.Fingerprint,
-			Event:            "register",
-			Success:          true,
-			HardwareSnapshot: req.HardwareInfo,
-		}
-
-		return txRepo.AddRegistration(ctx, registration)
+		var err error
+		newAgent, err = createAgent(ctx, txRepo, req, "register", 0)
+		return err
 	})
 
 	if err != nil {
 		// Log failed registration attempt
 		failedReg := &agent.AgentRegistration{
 			Fingerprint: req.Fingerprint,
+			TokenID:     req.TokenID,
 			Event:       "register",
 			Success:     false,
 			Error:       err.Error(),
@@ -118,6 +149,57 @@ func (s *RegistrationService) RegisterAgent(ctx context.Context, req Registratio
 	return newAgent, nil
 }
 
+// createAgent creates the agent req registers, with its tags, and records
+// the registration as event.
+func createAgent(ctx context.Context, txRepo agent.Repository, req RegistrationRequest, event string, similarity int) (*agent.Agent, error) {
+	// Create agent
+	newAgent := &agent.Agent{
+		Fingerprint:   req.Fingerprint,
+		PublicKey:     req.PublicKey,
+		PublicKeyType: req.PublicKeyType,
+		TokenID:       req.TokenID,
+		Hostname:      req.Hostname,
+		IPAddress:     req.IPAddress,
+		MACAddress:    req.MACAddress,
+		MachineID:     req.MachineID,
+	}
+
+	if err := txRepo.Create(ctx, newAgent); err != nil {
+		return nil, err
+	}
+
+	// Add tags
+	if len(req.Tags) > 0 {
+		var tags []agent.AgentTag
+		for _, tag := range req.Tags {
+			tags = append(tags, agent.AgentTag{
+				Key:    tag.Key,
+				Value:  tag.Value,
+				Source: tagSource(tag.Source),
+			})
+		}
+		if err := txRepo.AddTags(ctx, newAgent.ID, tags); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add registration record
+	registration := &agent.AgentRegistration{
+		AgentID:          newAgent.ID,
+		Fingerprint:      req.Fingerprint,
+		TokenID:          req.TokenID,
+		Event:            event,
+		Success:          true,
+		HardwareSnapshot: req.HardwareInfo,
+		SimilarityScore:  similarity,
+	}
+
+	if err := txRepo.AddRegistration(ctx, registration); err != nil {
+		return nil, err
+	}
+	return newAgent, nil
+}
+
 func (s *RegistrationService) handleReregistration(ctx context.Context, existing *agent.Agent, req RegistrationRequest) (*agent.Agent, error) {
 	// Update existing agent
 	existing.PublicKey = req.PublicKey
@@ -134,16 +216,20 @@ func (s *RegistrationService) handleReregistration(ctx context.Context, existing
 			return err
 		}
 
-		// Update tags
+		// Update tags: the agent's declared tags are replaced, and the
+		// token's tags are set without removing tags operators added
 		if len(req.Tags) > 0 {
-			var tags []agent.AgentTag
+			var declared []agent.AgentTag
 			for _, tag := range req.Tags {
-				tags = append(tags, agent.AgentTag{
-					Key:   tag.Key,
-					Value: tag.Value,
-				})
+				if tagSource(tag.Source) == agent.TagSourceAgent {
+					declared = append(declared, agent.AgentTag{Key: tag.Key, Value: tag.Value})
+					continue
+				}
+				if _, err := txRepo.SetTag(ctx, existing.ID, tag.Key, tag.Value); err != nil {
+					return err
+				}
 			}
-			if err := txRepo.UpdateTags(ctx, existing.ID, tags); err != nil {
+			if err := txRepo.SetDeclaredTags(ctx, existing.ID, declared); err != nil {
 				return err
 			}
 		}
@@ -152,6 +238,7 @@ func (s *RegistrationService) handleReregistration(ctx context.Context, existing
 		registration := &agent.AgentRegistration{
 			AgentID:          existing.ID,
 			Fingerprint:      req.Fingerprint,
+			TokenID:          req.TokenID,
 			Event:            "re-register",
 			Success:          true,
 			HardwareSnapshot: req.HardwareInfo,
@@ -163,8 +250,95 @@ func (s *RegistrationService) handleReregistration(ctx context.Context, existing
 	return existing, err
 }
 
-func (s *RegistrationService) isValidToken(tokenID, tokenKey string) bool {
-	// TODO: Implement actual token validation against configuration
-	// For now, accept any non-empty values
-	return tokenID != "" && tokenKey != ""
+// verifyToken checks the key of the token an agent registers with and
+// returns the token, or nil when registrations are not checked against
+// enrollment tokens or the token is an unknown one that is accepted
+func (s *RegistrationService) verifyToken(ctx context.Context, tokenID, tokenKey string) (*enrollment.Token, error) {
+	if tokenID == "" || tokenKey == "" {
+		return nil, ErrInvalidToken
+	}
+	if s.enroller == nil {
+		return nil, nil
+	}
+
+	token, err := s.enroller.Verify(ctx, tokenID, tokenKey)
+	if err := s.enrollmentError(err); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// tokenUsable returns ErrInvalidToken when the token can no longer be
+// registered with. An agent that re-registers may use a token that has
+// since been used up.
+func (s *RegistrationService) tokenUsable(token *enrollment.Token, reregistering bool) error {
+	if token == nil {
+		return nil
+	}
+	err := token.Usable(s.now().UTC())
+	if reregistering && errors.Is(err, enrollment.ErrTokenExhausted) {
+		return nil
+	}
+	if err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// consumeToken counts a use of the token an agent registered with in the
+// transaction of txRepo
+func (s *RegistrationService) consumeToken(ctx context.Context, txRepo agent.Repository, tokenID string) error {
+	if s.enroller == nil {
+		return nil
+	}
+	return s.enrollmentError(txRepo.ConsumeEnrollmentToken(ctx, tokenID, s.now().UTC()))
+}
+
+// enrollmentError maps a token the agent cannot register with to
+// ErrInvalidToken. An unknown token is accepted unless tokens are required.
+func (s *RegistrationService) enrollmentError(err error) error {
+	if errors.Is(err, enrollment.ErrTokenNotFound) && !s.tokenRequired {
+		return nil
+	}
+	if err != nil && isEnrollmentError(err) {
+		return ErrInvalidToken
+	}
+	return err
+}
+
+func isEnrollmentError(err error) bool {
+	for _, target := range []error{
+		enrollment.ErrTokenNotFound,
+		enrollment.ErrInvalidKey,
+		enrollment.ErrTokenRevoked,
+		enrollment.ErrTokenExpired,
+		enrollment.ErrTokenExhausted,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeTags marks the declared tags as agent tags and adds the token's
+// tags as server tags; a token tag shadows a declared tag with the same key
+func mergeTags(declared []TagPair, tokenTags []agent.AgentTag) []TagPair {
+	merged := make([]TagPair, 0, len(declared)+len(tokenTags))
+	for _, tag := range declared {
+		merged = append(merged, TagPair{Key: tag.Key, Value: tag.Value, Source: agent.TagSourceAgent})
+	}
+	for _, tag := range tokenTags {
+		merged = append(merged, TagPair{Key: tag.Key, Value: tag.Value, Source: agent.TagSourceServer})
+	}
+	return merged
+}
+
+// tagSource returns the source of a tag, which is the server when none
+// was recorded
+func tagSource(source string) string {
+	if source == "" {
+		return agent.TagSourceServer
+	}
+	return source
 }
\ No newline at end of file
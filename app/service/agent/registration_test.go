@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"hostlink/domain/agent"
+	"hostlink/domain/enrollment"
 	"testing"
 	"time"
 
@@ -18,10 +19,16 @@ type mockAgentRepository struct {
 	findByIDFunc          func(ctx context.Context, id string) (*agent.Agent, error)
 	findAllFunc           func(ctx context.Context, filters agent.AgentFilters) ([]agent.Agent, error)
 	getPublicKeyByAgentID func(ctx context.Context, agentID string) (string, error)
+	rotateKeyFunc         func(ctx context.Context, rotation *agent.KeyRotation) error
 	addTagsFunc           func(ctx context.Context, agentID string, tags []agent.AgentTag) error
-	updateTagsFunc        func(ctx context.Context, agentID string, tags []agent.AgentTag) error
+	setTagFunc            func(ctx context.Context, agentID, key, value string) (*agent.AgentTag, error)
+	setDeclaredTagsFunc   func(ctx context.Context, agentID string, tags []agent.AgentTag) error
 	addRegistrationFunc   func(ctx context.Context, registration *agent.AgentRegistration) error
+	recordHeartbeatFunc   func(ctx context.Context, agentID string, seenAt time.Time) error
+	markStatusFunc        func(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error)
+	findStatusEventsFunc  func(ctx context.Context, agentID string, limit int) ([]agent.StatusEvent, error)
 	transactionFunc       func(ctx context.Context, fn func(agent.Repository) error) error
+	consumeTokenFunc      func(ctx context.Context, tokenID string) error
 }
 
 func (m *mockAgentRepository) Create(ctx context.Context, a *agent.Agent) error {
@@ -67,6 +74,25 @@ func (m *mockAgentRepository) GetPublicKeyByAgentID(ctx context.Context, agentID
 	return "", nil
 }
 
+func (m *mockAgentRepository) GetPublicKeysByAgentID(ctx context.Context, agentID string, at time.Time) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockAgentRepository) GetAccessByAgentID(ctx context.Context, agentID string) (string, error) {
+	return agent.AccessActive, nil
+}
+
+func (m *mockAgentRepository) SetAccess(ctx context.Context, change agent.AccessChange) error {
+	return nil
+}
+
+func (m *mockAgentRepository) RotateKey(ctx context.Context, rotation *agent.KeyRotation) error {
+	if m.rotateKeyFunc != nil {
+		return m.rotateKeyFunc(ctx, rotation)
+	}
+	return nil
+}
+
 func (m *mockAgentRepository) AddTags(ctx context.Context, agentID string, tags []agent.AgentTag) error {
 	if m.addTagsFunc != nil {
 		return m.addTagsFunc(ctx, agentID, tags)
@@ -74,9 +100,24 @@ func (m *mockAgentRepository) AddTags(ctx context.Context, agentID string, tags
 	return nil
 }
 
-func (m *mockAgentRepository) UpdateTags(ctx context.Context, agentID string, tags []agent.AgentTag) error {
-	if m.updateTagsFunc != nil {
-		return m.updateTagsFunc(ctx, agentID, tags)
+func (m *mockAgentRepository) FindTags(ctx context.Context, agentID string) ([]agent.AgentTag, error) {
+	return nil, nil
+}
+
+func (m *mockAgentRepository) SetTag(ctx context.Context, agentID, key, value string) (*agent.AgentTag, error) {
+	if m.setTagFunc != nil {
+		return m.setTagFunc(ctx, agentID, key, value)
+	}
+	return &agent.AgentTag{AgentID: agentID, Key: key, Value: value, Source: agent.TagSourceServer}, nil
+}
+
+func (m *mockAgentRepository) DeleteTag(ctx context.Context, agentID, key string) error {
+	return nil
+}
+
+func (m *mockAgentRepository) SetDeclaredTags(ctx context.Context, agentID string, tags []agent.AgentTag) error {
+	if m.setDeclaredTagsFunc != nil {
+		return m.setDeclaredTagsFunc(ctx, agentID, tags)
 	}
 	return nil
 }
@@ -88,6 +129,58 @@ func (m *mockAgentRepository) AddRegistration(ctx context.Context, registration
 	return nil
 }
 
+func (m *mockAgentRepository) FindHardwareSnapshot(ctx context.Context, agentID string) (string, error) {
+	return "", nil
+}
+
+func (m *mockAgentRepository) CreatePendingRegistration(ctx context.Context, pending *agent.PendingRegistration) error {
+	return nil
+}
+
+func (m *mockAgentRepository) FindPendingRegistration(ctx context.Context, id string) (*agent.PendingRegistration, error) {
+	return nil, agent.ErrPendingRegistrationNotFound
+}
+
+func (m *mockAgentRepository) FindPendingRegistrationByFingerprint(ctx context.Context, fingerprint string) (*agent.PendingRegistration, error) {
+	return nil, agent.ErrPendingRegistrationNotFound
+}
+
+func (m *mockAgentRepository) FindPendingRegistrations(ctx context.Context, status string) ([]agent.PendingRegistration, error) {
+	return []agent.PendingRegistration{}, nil
+}
+
+func (m *mockAgentRepository) ResolvePendingRegistration(ctx context.Context, pending *agent.PendingRegistration) error {
+	return nil
+}
+
+func (m *mockAgentRepository) RecordHeartbeat(ctx context.Context, agentID string, seenAt time.Time) error {
+	if m.recordHeartbeatFunc != nil {
+		return m.recordHeartbeatFunc(ctx, agentID, seenAt)
+	}
+	return nil
+}
+
+func (m *mockAgentRepository) MarkStatus(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error) {
+	if m.markStatusFunc != nil {
+		return m.markStatusFunc(ctx, from, to, seenBefore, reason)
+	}
+	return nil, nil
+}
+
+func (m *mockAgentRepository) FindStatusEvents(ctx context.Context, agentID string, limit int) ([]agent.StatusEvent, error) {
+	if m.findStatusEventsFunc != nil {
+		return m.findStatusEventsFunc(ctx, agentID, limit)
+	}
+	return nil, nil
+}
+
+func (m *mockAgentRepository) ConsumeEnrollmentToken(ctx context.Context, tokenID string, now time.Time) error {
+	if m.consumeTokenFunc != nil {
+		return m.consumeTokenFunc(ctx, tokenID)
+	}
+	return nil
+}
+
 func (m *mockAgentRepository) Transaction(ctx context.Context, fn func(agent.Repository) error) error {
 	if m.transactionFunc != nil {
 		return m.transactionFunc(ctx, fn)
@@ -227,7 +320,11 @@ func TestRegistrationService(t *testing.T) {
 			updateFunc: func(ctx context.Context, a *agent.Agent) error {
 				return nil
 			},
-			updateTagsFunc: func(ctx context.Context, agentID string, tags []agent.AgentTag) error {
+			setTagFunc: func(ctx context.Context, agentID, key, value string) (*agent.AgentTag, error) {
+				t.Errorf("declared tags must not be set as server tags: %s=%s", key, value)
+				return nil, nil
+			},
+			setDeclaredTagsFunc: func(ctx context.Context, agentID string, tags []agent.AgentTag) error {
 				assert.Equal(t, "agt_existing", agentID)
 				updatedTags = tags
 				return nil
@@ -286,6 +383,28 @@ func TestRegistrationService(t *testing.T) {
 		assert.Equal(t, "CPU: AMD Ryzen", registrationRecord.HardwareSnapshot)
 	})
 
+	t.Run("should reject re-registration of a revoked agent", func(t *testing.T) {
+		mockRepo := &mockAgentRepository{
+			findByFingerprintFunc: func(ctx context.Context, fp string) (*agent.Agent, error) {
+				return &agent.Agent{ID: "agt_revoked", Fingerprint: fp, PublicKey: "old-key", Access: agent.AccessRevoked}, nil
+			},
+			updateFunc: func(ctx context.Context, a *agent.Agent) error {
+				t.Fatal("a revoked agent must not be updated")
+				return nil
+			},
+		}
+		service := NewRegistrationService(mockRepo)
+
+		_, err := service.RegisterAgent(context.Background(), RegistrationRequest{
+			Fingerprint: "revoked-fingerprint",
+			TokenID:     "token",
+			TokenKey:    "key",
+			PublicKey:   "new-key",
+		})
+
+		assert.ErrorIs(t, err, ErrAgentRevoked)
+	})
+
 	t.Run("should record failed registration attempts in registration table", func(t *testing.T) {
 		ctx := context.Background()
 
@@ -332,3 +451,132 @@ func TestRegistrationService(t *testing.T) {
 		assert.Equal(t, "", failedRegistration.AgentID) // No agent ID since creation failed
 	})
 }
+
+type mockEnroller struct {
+	token *enrollment.Token
+	err   error
+}
+
+func (m *mockEnroller) Verify(ctx context.Context, tokenID, tokenKey string) (*enrollment.Token, error) {
+	return m.token, m.err
+}
+
+func TestRegistrationServiceEnrollment(t *testing.T) {
+	ctx := context.Background()
+	req := RegistrationRequest{
+		Fingerprint: "new-fingerprint",
+		TokenID:     "enr_123",
+		TokenKey:    "hle_key",
+		Tags: []TagPair{
+			{Key: "env", Value: "dev"},
+			{Key: "role", Value: "web"},
+		},
+	}
+
+	t.Run("should add the token's tags as server tags and record the token", func(t *testing.T) {
+		var addedTags []agent.AgentTag
+		var registrationRecord *agent.AgentRegistration
+		var consumed []string
+		mockRepo := &mockAgentRepository{
+			findByFingerprintFunc: func(ctx context.Context, fp string) (*agent.Agent, error) {
+				return nil, errors.New("not found")
+			},
+			consumeTokenFunc: func(ctx context.Context, tokenID string) error {
+				consumed = append(consumed, tokenID)
+				return nil
+			},
+			addTagsFunc: func(ctx context.Context, agentID string, tags []agent.AgentTag) error {
+				addedTags = tags
+				return nil
+			},
+			addRegistrationFunc: func(ctx context.Context, reg *agent.AgentRegistration) error {
+				registrationRecord = reg
+				return nil
+			},
+		}
+		enroller := &mockEnroller{token: &enrollment.Token{ID: "enr_123", Tags: []string{"env=staging", "team=ops"}}}
+		service := NewRegistrationService(mockRepo).WithEnrollment(enroller, true)
+
+		result, err := service.RegisterAgent(ctx, req)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"enr_123"}, consumed)
+		assert.Equal(t, "enr_123", result.TokenID)
+		assert.Equal(t, []agent.AgentTag{
+			{Key: "env", Value: "dev", Source: agent.TagSourceAgent},
+			{Key: "role", Value: "web", Source: agent.TagSourceAgent},
+			{Key: "env", Value: "staging", Source: agent.TagSourceServer},
+			{Key: "team", Value: "ops", Source: agent.TagSourceServer},
+		}, addedTags)
+		require.NotNil(t, registrationRecord)
+		assert.Equal(t, "enr_123", registrationRecord.TokenID)
+	})
+
+	t.Run("should reject unusable tokens", func(t *testing.T) {
+		for _, enrollErr := range []error{
+			enrollment.ErrInvalidKey,
+			enrollment.ErrTokenRevoked,
+			enrollment.ErrTokenExpired,
+			enrollment.ErrTokenExhausted,
+			enrollment.ErrTokenNotFound,
+		} {
+			service := NewRegistrationService(&mockAgentRepository{}).WithEnrollment(&mockEnroller{err: enrollErr}, true)
+
+			result, err := service.RegisterAgent(ctx, req)
+			assert.Equal(t, ErrInvalidToken, err, enrollErr.Error())
+			assert.Nil(t, result)
+		}
+	})
+
+	t.Run("should accept unknown tokens when enrollment is not required", func(t *testing.T) {
+		mockRepo := &mockAgentRepository{
+			findByFingerprintFunc: func(ctx context.Context, fp string) (*agent.Agent, error) {
+				return nil, errors.New("not found")
+			},
+		}
+		service := NewRegistrationService(mockRepo).WithEnrollment(&mockEnroller{err: enrollment.ErrTokenNotFound}, false)
+
+		result, err := service.RegisterAgent(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, "enr_123", result.TokenID)
+
+		service.WithEnrollment(&mockEnroller{err: enrollment.ErrTokenRevoked}, false)
+		_, err = service.RegisterAgent(ctx, req)
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+
+	t.Run("should re-register with a used-up token without using it", func(t *testing.T) {
+		uses := 0
+		mockRepo := &mockAgentRepository{
+			findByFingerprintFunc: func(ctx context.Context, fp string) (*agent.Agent, error) {
+				return &agent.Agent{ID: "agt_123", Fingerprint: fp}, nil
+			},
+			consumeTokenFunc: func(ctx context.Context, tokenID string) error {
+				uses++
+				return nil
+			},
+		}
+		revokedAt := time.Now()
+		for _, tc := range []struct {
+			token *enrollment.Token
+			err   error
+		}{
+			{token: &enrollment.Token{ID: "enr_123", MaxUses: 1, Uses: 1}},
+			{token: &enrollment.Token{ID: "enr_123", RevokedAt: &revokedAt}, err: ErrInvalidToken},
+		} {
+			enroller := &mockEnroller{token: tc.token}
+			service := NewRegistrationService(mockRepo).WithEnrollment(enroller, true)
+
+			_, err := service.RegisterAgent(ctx, req)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, 0, uses)
+		}
+	})
+
+	t.Run("should pass through enrollment failures", func(t *testing.T) {
+		service := NewRegistrationService(&mockAgentRepository{}).WithEnrollment(&mockEnroller{err: errors.New("database is locked")}, true)
+
+		_, err := service.RegisterAgent(ctx, req)
+		assert.EqualError(t, err, "database is locked")
+	})
+}
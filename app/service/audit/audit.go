@@ -0,0 +1,68 @@
+// Package audit verifies the hash chain of the audit log.
+package audit
+
+import (
+	"context"
+	"errors"
+
+	"hostlink/domain/audit"
+)
+
+// verifyBatchSize is how many entries Verify reads at a time.
+const verifyBatchSize = 500
+
+// VerifyResult reports whether the audit log is intact. Entries counts the
+// entries that checked out; for a broken chain BrokenAt is the sequence of
+// the first one that does not.
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	Head     string `json:"head,omitempty"`
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Service struct {
+	repo      audit.Repository
+	batchSize int
+}
+
+func NewService(repo audit.Repository) *Service {
+	return &Service{repo: repo, batchSize: verifyBatchSize}
+}
+
+// Verify walks the whole log from its first entry and checks every link.
+func (s *Service) Verify(ctx context.Context) (*VerifyResult, error) {
+	result := &VerifyResult{}
+	var sequence int64
+	head := ""
+	for {
+		entries, err := s.repo.Find(ctx, audit.Filters{AfterSequence: sequence, Ascending: true, Limit: s.batchSize})
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		next, brokenAt, err := audit.Verify(sequence, head, entries)
+		if errors.Is(err, audit.ErrChainBroken) {
+			for _, e := range entries {
+				if e.Sequence == brokenAt {
+					break
+				}
+				result.Entries++
+			}
+			result.BrokenAt = brokenAt
+			result.Error = err.Error()
+			return result, nil
+		}
+		last := entries[len(entries)-1]
+		result.Entries += int64(len(entries))
+		sequence, head = last.Sequence, next
+	}
+
+	result.Valid = true
+	result.Head = head
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hostlink/domain/audit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryRepository struct {
+	entries []audit.Entry
+}
+
+func (m *memoryRepository) Append(ctx context.Context, e *audit.Entry) error {
+	e.Sequence = int64(len(m.entries) + 1)
+	if len(m.entries) > 0 {
+		e.PrevHash = m.entries[len(m.entries)-1].Hash
+	}
+	e.CreatedAt = time.Now().UTC()
+	e.Hash = e.ComputeHash()
+	m.entries = append(m.entries, *e)
+	return nil
+}
+
+func (m *memoryRepository) Find(ctx context.Context, filters audit.Filters) ([]audit.Entry, error) {
+	var found []audit.Entry
+	for _, e := range m.entries {
+		if e.Sequence > filters.AfterSequence && len(found) < filters.Limit {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+func setupService(t *testing.T, n int) (*Service, *memoryRepository) {
+	t.Helper()
+	repo := &memoryRepository{}
+	for i := 0; i < n; i++ {
+		require.NoError(t, repo.Append(context.Background(), &audit.Entry{Action: "task.create"}))
+	}
+	svc := NewService(repo)
+	svc.batchSize = 2
+	return svc, repo
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("walks an intact log across batches", func(t *testing.T) {
+		svc, repo := setupService(t, 5)
+
+		result, err := svc.Verify(ctx)
+
+		require.NoError(t, err)
+		assert.Equal(t, &VerifyResult{Valid: true, Entries: 5, Head: repo.entries[4].Hash}, result)
+	})
+
+	t.Run("accepts an empty log", func(t *testing.T) {
+		svc, _ := setupService(t, 0)
+
+		result, err := svc.Verify(ctx)
+
+		require.NoError(t, err)
+		assert.True(t, result.Valid)
+		assert.Zero(t, result.Entries)
+	})
+
+	t.Run("reports the first tampered entry", func(t *testing.T) {
+		svc, repo := setupService(t, 5)
+		repo.entries[3].ActorID = "opr_someone_else"
+
+		result, err := svc.Verify(ctx)
+
+		require.NoError(t, err)
+		assert.False(t, result.Valid)
+		assert.Equal(t, int64(4), result.BrokenAt)
+		assert.Equal(t, int64(3), result.Entries)
+		assert.Contains(t, result.Error, "entry 4 does not match its hash")
+	})
+}
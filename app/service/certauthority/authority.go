@@ -0,0 +1,152 @@
+// Package certauthority issues mTLS client certificates to registered agents
+package certauthority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	hlcrypto "hostlink/internal/crypto"
+)
+
+var (
+	ErrPublicKeyMismatch = errors.New("certificate request key does not match agent public key")
+	ErrInvalidRequest    = errors.New("invalid certificate request")
+)
+
+// Issuer signs agent certificate requests
+type Issuer interface {
+	Issue(csrPEM, agentID, agentPublicKey string) (string, error)
+}
+
+type Authority struct {
+	cert     *x509.Certificate
+	key      crypto.Signer
+	validity time.Duration
+	now      func() time.Time
+}
+
+func New(cert *x509.Certificate, key crypto.Signer, validity time.Duration) *Authority {
+	return &Authority{
+		cert:     cert,
+		key:      key,
+		validity: validity,
+		now:      time.Now,
+	}
+}
+
+// Load reads the CA certificate and key from PEM files
+func Load(certPath, keyPath string, validity time.Duration) (*Authority, error) {
+	cert, err := hlcrypto.LoadCertificate(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("load CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %s is not a CA", certPath)
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read CA key: %w", err)
+	}
+	key, err := parseSigner(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse CA key: %w", err)
+	}
+
+	return New(cert, key, validity), nil
+}
+
+// CertPool returns a pool containing the CA certificate, suitable for
+// tls.Config.ClientCAs
+func (a *Authority) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.cert)
+	return pool
+}
+
+// Issue signs csrPEM for agentID. The request must be for the agent's
+// registered public key so a certificate can never be bound to a key the
+// agent has not proven possession of.
+func (a *Authority) Issue(csrPEM, agentID, agentPublicKey string) (string, error) {
+	csr, err := hlcrypto.ParseCertificateRequestPEM(csrPEM)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if err := MatchesPublicKey(csr, agentPublicKey); err != nil {
+		return "", err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", fmt.Errorf("generate serial number: %w", err)
+	}
+
+	now := a.now()
+	notAfter := now.Add(a.validity)
+	if notAfter.After(a.cert.NotAfter) {
+		notAfter = a.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: agentID},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, csr.PublicKey, a.key)
+	if err != nil {
+		return "", fmt.Errorf("sign certificate: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), nil
+}
+
+// MatchesPublicKey checks that the request's key equals the base64 PKIX
+// public key stored for the agent
+func MatchesPublicKey(csr *x509.CertificateRequest, agentPublicKey string) error {
+	expected, err := base64.StdEncoding.DecodeString(agentPublicKey)
+	if err != nil {
+		return ErrPublicKeyMismatch
+	}
+	actual, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if !bytes.Equal(expected, actual) {
+		return ErrPublicKeyMismatch
+	}
+	return nil
+}
+
+func parseSigner(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse PEM block")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", key)
+	}
+	return signer, nil
+}
@@ -0,0 +1,117 @@
+package certauthority
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hlcrypto "hostlink/internal/crypto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCA(t *testing.T, notAfter time.Time) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "hostlink test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func newAgentCSR(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	csr, err := hlcrypto.CreateCertificateRequestPEM(key, "fingerprint")
+	require.NoError(t, err)
+	publicKey, err := hlcrypto.GetPublicKeyBase64(key)
+	require.NoError(t, err)
+	return csr, publicKey
+}
+
+func TestIssue(t *testing.T) {
+	caCert, caKey := newTestCA(t, time.Now().Add(365*24*time.Hour))
+	ca := New(caCert, caKey, 24*time.Hour)
+
+	t.Run("issues client certificate for agent", func(t *testing.T) {
+		csr, publicKey := newAgentCSR(t)
+
+		certPEM, err := ca.Issue(csr, "agt_123", publicKey)
+		require.NoError(t, err)
+
+		cert, err := hlcrypto.ParseCertificatePEM(certPEM)
+		require.NoError(t, err)
+		assert.Equal(t, "agt_123", cert.Subject.CommonName)
+		assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+
+		_, err = cert.Verify(x509.VerifyOptions{
+			Roots:     ca.CertPool(),
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects request for a different key", func(t *testing.T) {
+		csr, _ := newAgentCSR(t)
+		_, otherPublicKey := newAgentCSR(t)
+
+		_, err := ca.Issue(csr, "agt_123", otherPublicKey)
+		assert.ErrorIs(t, err, ErrPublicKeyMismatch)
+	})
+
+	t.Run("rejects malformed request", func(t *testing.T) {
+		_, publicKey := newAgentCSR(t)
+
+		_, err := ca.Issue("not a csr", "agt_123", publicKey)
+		assert.ErrorIs(t, err, ErrInvalidRequest)
+	})
+
+	t.Run("caps validity at CA expiry", func(t *testing.T) {
+		caNotAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+		shortCert, shortKey := newTestCA(t, caNotAfter)
+		shortCA := New(shortCert, shortKey, 24*time.Hour)
+		csr, publicKey := newAgentCSR(t)
+
+		certPEM, err := shortCA.Issue(csr, "agt_123", publicKey)
+		require.NoError(t, err)
+		cert, err := hlcrypto.ParseCertificatePEM(certPEM)
+		require.NoError(t, err)
+		assert.True(t, cert.NotAfter.Equal(caNotAfter.UTC()))
+	})
+}
+
+func TestLoad(t *testing.T) {
+	caCert, caKey := newTestCA(t, time.Now().Add(24*time.Hour))
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "ca.crt")
+	keyPath := filepath.Join(dir, "ca.key")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(caKey)}), 0600))
+
+	ca, err := Load(certPath, keyPath, time.Hour)
+	require.NoError(t, err)
+
+	csr, publicKey := newAgentCSR(t)
+	_, err = ca.Issue(csr, "agt_123", publicKey)
+	assert.NoError(t, err)
+}
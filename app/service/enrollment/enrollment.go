@@ -0,0 +1,94 @@
+// Package enrollment creates and revokes the tokens agents register with,
+// and checks the tokens agents present.
+package enrollment
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"hostlink/domain/enrollment"
+)
+
+type Service struct {
+	repo enrollment.Repository
+	now  func() time.Time
+}
+
+func NewService(repo enrollment.Repository) *Service {
+	return &Service{repo: repo, now: time.Now}
+}
+
+// Create adds a token and returns it with its key, which is not stored. A
+// zero maxUses is unlimited and a zero ttl never expires.
+func (s *Service) Create(ctx context.Context, name string, tags []string, maxUses int, ttl time.Duration, createdBy string) (string, *enrollment.Token, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("token name is required")
+	}
+	if maxUses < 0 {
+		return "", nil, fmt.Errorf("max uses must not be negative")
+	}
+	if ttl < 0 {
+		return "", nil, fmt.Errorf("expiry must not be negative")
+	}
+	if err := enrollment.ValidateTags(tags); err != nil {
+		return "", nil, err
+	}
+
+	key, err := enrollment.GenerateKey()
+	if err != nil {
+		return "", nil, fmt.Errorf("generate key: %w", err)
+	}
+	token := &enrollment.Token{
+		Name:      name,
+		KeyHash:   enrollment.HashKey(key),
+		Prefix:    key[:len(enrollment.KeyPrefix)+6],
+		Tags:      tags,
+		MaxUses:   maxUses,
+		CreatedBy: createdBy,
+	}
+	if token.Tags == nil {
+		token.Tags = []string{}
+	}
+	if ttl > 0 {
+		expiresAt := s.now().UTC().Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.Create(ctx, token); err != nil {
+		return "", nil, err
+	}
+	return key, token, nil
+}
+
+// Verify checks the key presented with a token ID by a registering agent
+// and returns the token, whose tags the agent gets, whether or not it can
+// still enroll an agent. It does not count a use.
+func (s *Service) Verify(ctx context.Context, tokenID, tokenKey string) (*enrollment.Token, error) {
+	token, err := s.repo.FindByID(ctx, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(token.KeyHash), []byte(enrollment.HashKey(tokenKey))) != 1 {
+		return nil, enrollment.ErrInvalidKey
+	}
+	return token, nil
+}
+
+// Find returns a token by ID.
+func (s *Service) Find(ctx context.Context, id string) (*enrollment.Token, error) {
+	return s.repo.FindByID(ctx, id)
+}
+
+// List returns every token, newest first.
+func (s *Service) List(ctx context.Context) ([]enrollment.Token, error) {
+	return s.repo.FindAll(ctx)
+}
+
+// Revoke stops a token from enrolling further agents. Agents that already
+// registered with it are unaffected.
+func (s *Service) Revoke(ctx context.Context, id string) error {
+	return s.repo.Revoke(ctx, id, s.now().UTC())
+}
@@ -0,0 +1,109 @@
+package enrollment
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"hostlink/domain/enrollment"
+	gormRepo "hostlink/internal/repository/gorm"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupService(t *testing.T) (*Service, enrollment.Repository) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&enrollment.Token{}))
+
+	repo := gormRepo.NewEnrollmentRepository(db)
+	return NewService(repo), repo
+}
+
+func TestCreate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("stores only the hash of the key", func(t *testing.T) {
+		svc, repo := setupService(t)
+
+		key, token, err := svc.Create(ctx, " staging ", []string{"env=staging"}, 3, time.Hour, "alice")
+
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(key, enrollment.KeyPrefix))
+		found, err := repo.FindByID(ctx, token.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "staging", found.Name)
+		assert.Equal(t, enrollment.HashKey(key), found.KeyHash)
+		assert.Equal(t, key[:len(enrollment.KeyPrefix)+6], found.Prefix)
+		assert.Equal(t, []string{"env=staging"}, found.Tags)
+		assert.Equal(t, 3, found.MaxUses)
+		assert.Equal(t, "alice", found.CreatedBy)
+		require.NotNil(t, found.ExpiresAt)
+	})
+
+	t.Run("rejects bad input", func(t *testing.T) {
+		svc, _ := setupService(t)
+
+		_, _, err := svc.Create(ctx, " ", nil, 0, 0, "")
+		assert.Error(t, err)
+		_, _, err = svc.Create(ctx, "staging", []string{"staging"}, 0, 0, "")
+		assert.ErrorIs(t, err, enrollment.ErrInvalidTag)
+		_, _, err = svc.Create(ctx, "staging", nil, -1, 0, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("does not count a use", func(t *testing.T) {
+		svc, repo := setupService(t)
+		key, token, err := svc.Create(ctx, "staging", []string{"env=staging"}, 1, 0, "")
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			verified, err := svc.Verify(ctx, token.ID, key)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"env=staging"}, verified.Tags)
+		}
+
+		found, _ := repo.FindByID(ctx, token.ID)
+		assert.Equal(t, 0, found.Uses)
+	})
+
+	t.Run("rejects wrong keys and unknown tokens", func(t *testing.T) {
+		svc, _ := setupService(t)
+		key, token, err := svc.Create(ctx, "staging", nil, 0, 0, "")
+		require.NoError(t, err)
+
+		_, err = svc.Verify(ctx, token.ID, key+"x")
+		assert.ErrorIs(t, err, enrollment.ErrInvalidKey)
+		_, err = svc.Verify(ctx, "enr_missing", key)
+		assert.ErrorIs(t, err, enrollment.ErrTokenNotFound)
+	})
+
+	t.Run("returns expired and revoked tokens", func(t *testing.T) {
+		svc, _ := setupService(t)
+		key, token, err := svc.Create(ctx, "staging", nil, 0, time.Hour, "")
+		require.NoError(t, err)
+		require.NoError(t, svc.Revoke(ctx, token.ID))
+
+		verified, err := svc.Verify(ctx, token.ID, key)
+		require.NoError(t, err)
+		assert.ErrorIs(t, verified.Usable(time.Now().Add(2*time.Hour)), enrollment.ErrTokenRevoked)
+	})
+}
+
+func TestRevoke(t *testing.T) {
+	svc, _ := setupService(t)
+
+	err := svc.Revoke(context.Background(), "enr_missing")
+
+	assert.ErrorIs(t, err, enrollment.ErrTokenNotFound)
+}
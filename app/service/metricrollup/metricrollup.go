@@ -0,0 +1,174 @@
+// Package metricrollup downsamples stored agent metrics into per-resolution
+// rollups, enforces their retention and answers series queries from them.
+package metricrollup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"hostlink/domain/metrics"
+)
+
+// rollupWindow bounds how much raw data is loaded per agent at once.
+const rollupWindow = time.Hour
+
+// Retention is how long raw samples and each rollup resolution are kept.
+// Zero keeps data forever.
+type Retention struct {
+	Raw      time.Duration
+	Rollup1m time.Duration
+	Rollup5m time.Duration
+	Rollup1h time.Duration
+}
+
+// DefaultRetention keeps raw samples for two days and coarser rollups for
+// progressively longer.
+func DefaultRetention() Retention {
+	return Retention{
+		Raw:      48 * time.Hour,
+		Rollup1m: 7 * 24 * time.Hour,
+		Rollup5m: 30 * 24 * time.Hour,
+		Rollup1h: 365 * 24 * time.Hour,
+	}
+}
+
+// For returns the retention of a rollup resolution.
+func (r Retention) For(resolution metrics.Resolution) time.Duration {
+	switch resolution {
+	case metrics.Resolution1m:
+		return r.Rollup1m
+	case metrics.Resolution5m:
+		return r.Rollup5m
+	case metrics.Resolution1h:
+		return r.Rollup1h
+	default:
+		return 0
+	}
+}
+
+// Result describes one RollUp run.
+type Result struct {
+	Rollups       int
+	SamplesPruned int64
+	RollupsPruned int64
+}
+
+type Service struct {
+	repo      metrics.Repository
+	retention Retention
+	now       func() time.Time
+}
+
+func NewService(repo metrics.Repository, retention Retention) *Service {
+	return &Service{repo: repo, retention: retention, now: time.Now}
+}
+
+// RollUp aggregates raw samples into every resolution and then prunes data
+// past its retention. Each run recomputes every agent's newest bucket of a
+// resolution, so a bucket that was still open last time is completed. Agents
+// are rolled up from their own newest bucket, so samples an agent pushes
+// late are not skipped because another agent's buckets are newer.
+func (s *Service) RollUp(ctx context.Context) (Result, error) {
+	var result Result
+	now := s.now().UTC()
+
+	for _, resolution := range metrics.Resolutions {
+		written, err := s.rollUp(ctx, resolution, now)
+		if err != nil {
+			return result, fmt.Errorf("roll up %s: %w", resolution.Name, err)
+		}
+		result.Rollups += written
+	}
+
+	if s.retention.Raw > 0 {
+		pruned, err := s.repo.DeleteSamplesBefore(ctx, now.Add(-s.retention.Raw))
+		if err != nil {
+			return result, fmt.Errorf("prune samples: %w", err)
+		}
+		result.SamplesPruned = pruned
+	}
+	for _, resolution := range metrics.Resolutions {
+		retention := s.retention.For(resolution)
+		if retention <= 0 {
+			continue
+		}
+		pruned, err := s.repo.DeleteRollupsBefore(ctx, resolution, now.Add(-retention))
+		if err != nil {
+			return result, fmt.Errorf("prune %s rollups: %w", resolution.Name, err)
+		}
+		result.RollupsPruned += pruned
+	}
+
+	return result, nil
+}
+
+func (s *Service) rollUp(ctx context.Context, resolution metrics.Resolution, now time.Time) (int, error) {
+	var oldest time.Time
+	if s.retention.Raw > 0 {
+		oldest = now.Add(-s.retention.Raw).Truncate(resolution.Step)
+	}
+	end := now.Truncate(resolution.Step).Add(resolution.Step)
+
+	agentIDs, err := s.repo.FindSampleAgents(ctx, oldest, end)
+	if err != nil {
+		return 0, err
+	}
+	written := 0
+	for _, agentID := range agentIDs {
+		n, err := s.rollUpAgent(ctx, resolution, agentID, oldest, end)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// rollUpAgent aggregates an agent's samples from its newest bucket of the
+// resolution, or its oldest sample, up to its newest sample before end.
+func (s *Service) rollUpAgent(ctx context.Context, resolution metrics.Resolution, agentID string, oldest, end time.Time) (int, error) {
+	from, ok, err := s.repo.LatestRollup(ctx, resolution, agentID)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		if from, ok, err = s.repo.EarliestSample(ctx, agentID); err != nil || !ok {
+			return 0, err
+		}
+	}
+	from = from.UTC().Truncate(resolution.Step)
+	if from.Before(oldest) {
+		from = oldest
+	}
+	last, ok, err := s.repo.LatestSample(ctx, agentID)
+	if err != nil || !ok {
+		return 0, err
+	}
+	if stop := last.UTC().Truncate(resolution.Step).Add(resolution.Step); stop.Before(end) {
+		end = stop
+	}
+
+	window := rollupWindow
+	if resolution.Step > window {
+		window = resolution.Step
+	}
+
+	written := 0
+	for start := from; start.Before(end); start = start.Add(window) {
+		stop := start.Add(window)
+		if stop.After(end) {
+			stop = end
+		}
+		samples, err := s.repo.FindSamples(ctx, metrics.SampleFilters{AgentID: agentID, Since: &start, Until: &stop})
+		if err != nil {
+			return written, err
+		}
+		rollups := metrics.Aggregate(samples, resolution.Step)
+		if err := s.repo.UpsertRollups(ctx, resolution, rollups); err != nil {
+			return written, err
+		}
+		written += len(rollups)
+	}
+	return written, nil
+}
@@ -0,0 +1,188 @@
+package metricrollup
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"hostlink/domain/metrics"
+	gormRepo "hostlink/internal/repository/gorm"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupService(t *testing.T, now time.Time, retention Retention) (*Service, metrics.Repository) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&metrics.Sample{}))
+	require.NoError(t, gormRepo.MigrateMetricRollups(db))
+
+	repo := gormRepo.NewMetricsRepository(db)
+	svc := NewService(repo, retention)
+	svc.now = func() time.Time { return now }
+	return svc, repo
+}
+
+func storageSample(mountPoint string, at time.Time, used float64) metrics.Sample {
+	key, _ := metrics.SeriesKey(map[string]any{"mount_point": mountPoint})
+	return metrics.Sample{
+		AgentID:   "agt_1",
+		Type:      metrics.MetricTypeStorage,
+		SeriesKey: key,
+		Timestamp: at,
+		Metrics:   fmt.Sprintf(`{"disk_used_percent":%v}`, used),
+	}
+}
+
+func TestRollUp(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	t.Run("rolls up every resolution and completes the open bucket", func(t *testing.T) {
+		svc, repo := setupService(t, base.Add(10*time.Minute+30*time.Second), DefaultRetention())
+		var samples []metrics.Sample
+		for i := 0; i < 10; i++ {
+			samples = append(samples, storageSample("/", base.Add(time.Duration(i)*time.Minute), float64(i)))
+		}
+		require.NoError(t, repo.Append(ctx, samples))
+
+		result, err := svc.RollUp(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 10+2+1, result.Rollups)
+
+		hourly, err := repo.FindRollups(ctx, metrics.Resolution1h, metrics.RollupFilters{
+			AgentID: "agt_1", Type: metrics.MetricTypeStorage, From: base, To: base.Add(time.Hour),
+		})
+		require.NoError(t, err)
+		require.Len(t, hourly, 1)
+		assert.Equal(t, int64(10), hourly[0].Count)
+		assert.Equal(t, float64(9), hourly[0].Max)
+
+		// A sample arriving in the same hour is picked up by the next run.
+		require.NoError(t, repo.Append(ctx, []metrics.Sample{storageSample("/", base.Add(10*time.Minute), 90)}))
+		_, err = svc.RollUp(ctx)
+		require.NoError(t, err)
+
+		hourly, err = repo.FindRollups(ctx, metrics.Resolution1h, metrics.RollupFilters{
+			AgentID: "agt_1", Type: metrics.MetricTypeStorage, From: base, To: base.Add(time.Hour),
+		})
+		require.NoError(t, err)
+		require.Len(t, hourly, 1)
+		assert.Equal(t, int64(11), hourly[0].Count)
+		assert.Equal(t, float64(90), hourly[0].Max)
+	})
+
+	t.Run("rolls up samples arriving after another agent's newer buckets", func(t *testing.T) {
+		svc, repo := setupService(t, base.Add(10*time.Minute+30*time.Second), DefaultRetention())
+		require.NoError(t, repo.Append(ctx, []metrics.Sample{storageSample("/", base.Add(10*time.Minute), 1)}))
+		_, err := svc.RollUp(ctx)
+		require.NoError(t, err)
+
+		// agt_2 pushes late, into buckets older than agt_1's newest
+		late := storageSample("/", base.Add(2*time.Minute), 5)
+		late.AgentID = "agt_2"
+		require.NoError(t, repo.Append(ctx, []metrics.Sample{late}))
+		_, err = svc.RollUp(ctx)
+		require.NoError(t, err)
+
+		for _, resolution := range metrics.Resolutions {
+			rollups, err := repo.FindRollups(ctx, resolution, metrics.RollupFilters{
+				AgentID: "agt_2", Type: metrics.MetricTypeStorage, From: base, To: base.Add(time.Hour),
+			})
+			require.NoError(t, err)
+			require.Len(t, rollups, 1, resolution.Name)
+			assert.Equal(t, float64(5), rollups[0].Max, resolution.Name)
+		}
+	})
+
+	t.Run("prunes raw samples and rollups past retention", func(t *testing.T) {
+		now := base.Add(72 * time.Hour)
+		svc, repo := setupService(t, now, Retention{Raw: 48 * time.Hour, Rollup1m: 24 * time.Hour})
+		require.NoError(t, repo.Append(ctx, []metrics.Sample{
+			storageSample("/", base, 1),
+			storageSample("/", now.Add(-time.Hour), 2),
+		}))
+		require.NoError(t, repo.UpsertRollups(ctx, metrics.Resolution1m, []metrics.Rollup{{
+			AgentID: "agt_1", Type: metrics.MetricTypeStorage, Field: "disk_used_percent", BucketStart: base, Count: 1,
+		}}))
+
+		result, err := svc.RollUp(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), result.SamplesPruned)
+		assert.Equal(t, int64(1), result.RollupsPruned)
+
+		remaining, err := repo.FindSamples(ctx, metrics.SampleFilters{AgentID: "agt_1"})
+		require.NoError(t, err)
+		assert.Len(t, remaining, 1)
+	})
+}
+
+func TestQuery(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	svc, repo := setupService(t, base.Add(time.Hour), DefaultRetention())
+
+	var samples []metrics.Sample
+	for i := 0; i < 60; i++ {
+		at := base.Add(time.Duration(i) * time.Minute)
+		samples = append(samples, storageSample("/", at, float64(i)), storageSample("/data", at, 100))
+	}
+	require.NoError(t, repo.Append(ctx, samples))
+	_, err := svc.RollUp(ctx)
+	require.NoError(t, err)
+
+	t.Run("aggregates the rollups to the step", func(t *testing.T) {
+		result, err := svc.Query(ctx, Query{
+			AgentID:    "agt_1",
+			Type:       metrics.MetricTypeStorage,
+			Attributes: map[string]string{"mount_point": "/"},
+			From:       base,
+			To:         base.Add(time.Hour),
+			Step:       15 * time.Minute,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "5m", result.Resolution)
+		assert.Equal(t, "15m0s", result.Step)
+		require.Len(t, result.Series, 1)
+		series := result.Series[0]
+		assert.Equal(t, "disk_used_percent", series.Field)
+		assert.Equal(t, map[string]any{"mount_point": "/"}, series.Attributes)
+		require.Len(t, series.Points, 4)
+		assert.Equal(t, base, series.Points[0].Time)
+		assert.Equal(t, float64(7), series.Points[0].Avg)
+		assert.Equal(t, float64(14), series.Points[0].Max)
+		assert.Equal(t, float64(14), series.Points[0].P95)
+	})
+
+	t.Run("picks a step from the range", func(t *testing.T) {
+		result, err := svc.Query(ctx, Query{AgentID: "agt_1", Type: metrics.MetricTypeStorage, From: base, To: base.Add(time.Hour)})
+		require.NoError(t, err)
+
+		assert.Equal(t, "1m", result.Resolution)
+		assert.Len(t, result.Series, 2)
+		assert.Len(t, result.Series[0].Points, 60)
+	})
+
+	t.Run("falls back to a coarser resolution past retention", func(t *testing.T) {
+		svc.retention.Rollup1m = time.Minute
+		svc.retention.Rollup5m = time.Minute
+		defer func() { svc.retention = DefaultRetention() }()
+
+		result, err := svc.Query(ctx, Query{AgentID: "agt_1", Type: metrics.MetricTypeStorage, From: base, To: base.Add(time.Hour), Step: time.Minute})
+		require.NoError(t, err)
+
+		assert.Equal(t, "1h", result.Resolution)
+		assert.Equal(t, "1h0m0s", result.Step)
+	})
+
+	t.Run("rejects a query without type", func(t *testing.T) {
+		_, err := svc.Query(ctx, Query{AgentID: "agt_1", From: base, To: base.Add(time.Hour)})
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+	})
+}
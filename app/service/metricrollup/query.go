@@ -0,0 +1,218 @@
+package metricrollup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"hostlink/domain/metrics"
+)
+
+// maxPoints bounds the points per series of a query without an explicit
+// step.
+const maxPoints = 360
+
+// ErrInvalidQuery is returned for a query that cannot be answered.
+var ErrInvalidQuery = errors.New("invalid metrics query")
+
+// Query selects one agent's series of a metric type over [From, To).
+// Attributes keeps series whose attributes contain every given pair, and
+// Fields, when set, keeps only the named metrics. A zero Step picks one that
+// yields at most a few hundred points.
+type Query struct {
+	AgentID    string
+	Type       string
+	Attributes map[string]string
+	Fields     []string
+	From       time.Time
+	To         time.Time
+	Step       time.Duration
+}
+
+// QueryResult holds the series of a query and the resolution they were
+// read from.
+type QueryResult struct {
+	AgentID    string        `json:"agent_id"`
+	Type       string        `json:"type"`
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Step       string        `json:"step"`
+	Resolution string        `json:"resolution"`
+	Series     []SeriesField `json:"series"`
+}
+
+// SeriesField is one metric of one series.
+type SeriesField struct {
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Field      string         `json:"field"`
+	Points     []Point        `json:"points"`
+}
+
+// Point aggregates a field over one step. When a step spans several rollup
+// buckets, P95 is the highest bucket p95, an upper bound of the true value.
+type Point struct {
+	Time time.Time `json:"time"`
+	Avg  float64   `json:"avg"`
+	Max  float64   `json:"max"`
+	P95  float64   `json:"p95"`
+}
+
+// Query answers q from the coarsest resolution that is still retained at
+// q.From and no coarser than the step.
+func (s *Service) Query(ctx context.Context, q Query) (*QueryResult, error) {
+	if q.Type == "" {
+		return nil, fmt.Errorf("%w: type is required", ErrInvalidQuery)
+	}
+	if !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+	if q.Step < 0 {
+		return nil, fmt.Errorf("%w: step must be positive", ErrInvalidQuery)
+	}
+
+	resolution, step := s.plan(q)
+	from := q.From.UTC().Truncate(step)
+	to := q.To.UTC()
+
+	rollups, err := s.repo.FindRollups(ctx, resolution, metrics.RollupFilters{
+		AgentID: q.AgentID,
+		Type:    q.Type,
+		From:    from,
+		To:      to,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{
+		AgentID:    q.AgentID,
+		Type:       q.Type,
+		From:       from,
+		To:         to,
+		Step:       step.String(),
+		Resolution: resolution.Name,
+		Series:     []SeriesField{},
+	}
+
+	fields := map[string]bool{}
+	for _, field := range q.Fields {
+		fields[field] = true
+	}
+	attributes := map[string]map[string]any{}
+
+	var current *SeriesField
+	var currentKey string
+	var point *Point
+	var sum float64
+	var count int64
+	flush := func() {
+		if point != nil && count > 0 {
+			point.Avg = sum / float64(count)
+			current.Points = append(current.Points, *point)
+		}
+		point, sum, count = nil, 0, 0
+	}
+
+	for _, rollup := range rollups {
+		if len(fields) > 0 && !fields[rollup.Field] {
+			continue
+		}
+		attrs, ok := attributes[rollup.SeriesKey]
+		if !ok {
+			attrs = decodeAttributes(rollup.SeriesKey)
+			attributes[rollup.SeriesKey] = attrs
+		}
+		if !matches(attrs, q.Attributes) {
+			continue
+		}
+
+		key := rollup.SeriesKey + "\x00" + rollup.Field
+		if current == nil || key != currentKey {
+			flush()
+			result.Series = append(result.Series, SeriesField{Attributes: attrs, Field: rollup.Field, Points: []Point{}})
+			current = &result.Series[len(result.Series)-1]
+			currentKey = key
+		}
+
+		bucket := rollup.BucketStart.UTC().Truncate(step)
+		if point != nil && !point.Time.Equal(bucket) {
+			flush()
+		}
+		if point == nil {
+			point = &Point{Time: bucket, Max: rollup.Max, P95: rollup.P95}
+		}
+		if rollup.Max > point.Max {
+			point.Max = rollup.Max
+		}
+		if rollup.P95 > point.P95 {
+			point.P95 = rollup.P95
+		}
+		sum += rollup.Sum
+		count += rollup.Count
+	}
+	flush()
+
+	return result, nil
+}
+
+// plan picks the resolution to read and the step, a multiple of the
+// resolution's, to aggregate it to.
+func (s *Service) plan(q Query) (metrics.Resolution, time.Duration) {
+	now := s.now().UTC()
+
+	// Resolutions still holding data at q.From, finest first.
+	var retained []metrics.Resolution
+	for _, resolution := range metrics.Resolutions {
+		retention := s.retention.For(resolution)
+		if retention <= 0 || !q.From.Before(now.Add(-retention)) {
+			retained = append(retained, resolution)
+		}
+	}
+	if len(retained) == 0 {
+		retained = metrics.Resolutions[len(metrics.Resolutions)-1:]
+	}
+
+	step := q.Step
+	if step == 0 {
+		step = q.To.Sub(q.From) / maxPoints
+	}
+
+	resolution := retained[0]
+	for _, candidate := range retained {
+		if candidate.Step <= step {
+			resolution = candidate
+		}
+	}
+	if step < resolution.Step {
+		step = resolution.Step
+	}
+	if remainder := step % resolution.Step; remainder != 0 {
+		step += resolution.Step - remainder
+	}
+	return resolution, step
+}
+
+func decodeAttributes(seriesKey string) map[string]any {
+	if seriesKey == "" {
+		return nil
+	}
+	var attributes map[string]any
+	if err := json.Unmarshal([]byte(seriesKey), &attributes); err != nil {
+		return nil
+	}
+	return attributes
+}
+
+// matches reports whether attributes contain every wanted pair. Values are
+// compared in their string form, so is_read_only=false matches a boolean.
+func matches(attributes map[string]any, wanted map[string]string) bool {
+	for key, value := range wanted {
+		actual, ok := attributes[key]
+		if !ok || fmt.Sprint(actual) != value {
+			return false
+		}
+	}
+	return true
+}
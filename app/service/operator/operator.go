@@ -0,0 +1,123 @@
+// Package operator creates operators, issues their API tokens and
+// authenticates the tokens presented to the API.
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"hostlink/domain/operator"
+)
+
+// ErrInvalidToken is returned for a token that is unknown, expired or
+// revoked, or whose operator is disabled.
+var ErrInvalidToken = errors.New("invalid operator token")
+
+// touchInterval bounds how often a token's last use is written, so a busy
+// client does not write on every request.
+const touchInterval = time.Minute
+
+type Service struct {
+	repo operator.Repository
+	now  func() time.Time
+}
+
+func NewService(repo operator.Repository) *Service {
+	return &Service{repo: repo, now: time.Now}
+}
+
+// Create adds an operator with role, limited to agents carrying every scope
+// tag.
+func (s *Service) Create(ctx context.Context, name, role string, scope []string) (*operator.Operator, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("operator name is required")
+	}
+	if err := Validate(role, scope); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.FindOperatorByName(ctx, name); err == nil {
+		return nil, fmt.Errorf("%w: %q", operator.ErrOperatorExists, name)
+	} else if !errors.Is(err, operator.ErrOperatorNotFound) {
+		return nil, err
+	}
+
+	o := &operator.Operator{Name: name, Role: role, Scope: scope}
+	if o.Scope == nil {
+		o.Scope = []string{}
+	}
+	if err := s.repo.CreateOperator(ctx, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Validate checks a role and scope before they are stored.
+func Validate(role string, scope []string) error {
+	if !operator.ValidRole(role) {
+		return fmt.Errorf("%w: %q", operator.ErrUnknownRole, role)
+	}
+	return operator.ValidateScope(scope)
+}
+
+// IssueToken creates a token for the operator and returns it with its
+// plaintext, which is not stored. A zero ttl never expires.
+func (s *Service) IssueToken(ctx context.Context, operatorID, name string, ttl time.Duration) (string, *operator.Token, error) {
+	if _, err := s.repo.FindOperator(ctx, operatorID); err != nil {
+		return "", nil, err
+	}
+
+	plaintext, err := operator.GenerateToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("generate token: %w", err)
+	}
+	token := &operator.Token{
+		OperatorID: operatorID,
+		Name:       name,
+		Hash:       operator.HashToken(plaintext),
+		Prefix:     plaintext[:len(operator.TokenPrefix)+6],
+	}
+	if ttl > 0 {
+		expiresAt := s.now().UTC().Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.CreateToken(ctx, token); err != nil {
+		return "", nil, err
+	}
+	return plaintext, token, nil
+}
+
+// Authenticate returns the operator a token belongs to, and the token.
+func (s *Service) Authenticate(ctx context.Context, plaintext string) (*operator.Operator, *operator.Token, error) {
+	token, err := s.repo.FindTokenByHash(ctx, operator.HashToken(plaintext))
+	if errors.Is(err, operator.ErrTokenNotFound) {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := s.now().UTC()
+	if !token.Active(now) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	o, err := s.repo.FindOperator(ctx, token.OperatorID)
+	if errors.Is(err, operator.ErrOperatorNotFound) {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if o.Disabled {
+		return nil, nil, ErrInvalidToken
+	}
+
+	// Recording the last use is bookkeeping; it never fails a request.
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= touchInterval {
+		_ = s.repo.TouchToken(ctx, token.ID, now)
+	}
+	return o, token, nil
+}
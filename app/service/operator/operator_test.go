@@ -0,0 +1,118 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"hostlink/domain/operator"
+	gormRepo "hostlink/internal/repository/gorm"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupService(t *testing.T) (*Service, operator.Repository) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&operator.Operator{}, &operator.Token{}))
+
+	repo := gormRepo.NewOperatorRepository(db)
+	return NewService(repo), repo
+}
+
+func TestCreate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("stores the role and scope", func(t *testing.T) {
+		svc, repo := setupService(t)
+
+		o, err := svc.Create(ctx, " alice ", operator.RoleOperator, []string{"env=staging"})
+
+		require.NoError(t, err)
+		found, err := repo.FindOperator(ctx, o.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", found.Name)
+		assert.Equal(t, []string{"env=staging"}, found.Scope)
+	})
+
+	t.Run("rejects unknown roles, bad scopes and duplicate names", func(t *testing.T) {
+		svc, _ := setupService(t)
+		_, err := svc.Create(ctx, "alice", operator.RoleViewer, nil)
+		require.NoError(t, err)
+
+		_, err = svc.Create(ctx, "bob", "root", nil)
+		assert.ErrorIs(t, err, operator.ErrUnknownRole)
+		_, err = svc.Create(ctx, "bob", operator.RoleViewer, []string{"staging"})
+		assert.ErrorIs(t, err, operator.ErrInvalidScope)
+		_, err = svc.Create(ctx, "alice", operator.RoleViewer, nil)
+		assert.ErrorIs(t, err, operator.ErrOperatorExists)
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns the token's operator and records its use", func(t *testing.T) {
+		svc, repo := setupService(t)
+		o, err := svc.Create(ctx, "alice", operator.RoleAdmin, nil)
+		require.NoError(t, err)
+		plaintext, token, err := svc.IssueToken(ctx, o.ID, "laptop", 0)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(plaintext, operator.TokenPrefix))
+		assert.True(t, strings.HasPrefix(plaintext, token.Prefix))
+		assert.NotContains(t, token.Hash, plaintext)
+
+		authenticated, used, err := svc.Authenticate(ctx, plaintext)
+
+		require.NoError(t, err)
+		assert.Equal(t, o.ID, authenticated.ID)
+		assert.Equal(t, token.ID, used.ID)
+		tokens, err := repo.FindTokens(ctx, o.ID)
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+		assert.NotNil(t, tokens[0].LastUsedAt)
+	})
+
+	t.Run("rejects unknown, expired and revoked tokens and disabled operators", func(t *testing.T) {
+		svc, repo := setupService(t)
+		o, err := svc.Create(ctx, "alice", operator.RoleAdmin, nil)
+		require.NoError(t, err)
+
+		_, _, err = svc.Authenticate(ctx, "hlo_unknown")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		expiring, _, err := svc.IssueToken(ctx, o.ID, "short", time.Minute)
+		require.NoError(t, err)
+		svc.now = func() time.Time { return time.Now().Add(time.Hour) }
+		_, _, err = svc.Authenticate(ctx, expiring)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		svc.now = time.Now
+
+		revoked, token, err := svc.IssueToken(ctx, o.ID, "revoked", 0)
+		require.NoError(t, err)
+		require.NoError(t, repo.RevokeToken(ctx, o.ID, token.ID, time.Now()))
+		_, _, err = svc.Authenticate(ctx, revoked)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		active, _, err := svc.IssueToken(ctx, o.ID, "active", 0)
+		require.NoError(t, err)
+		o.Disabled = true
+		require.NoError(t, repo.UpdateOperator(ctx, o))
+		_, _, err = svc.Authenticate(ctx, active)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("does not issue tokens for unknown operators", func(t *testing.T) {
+		svc, _ := setupService(t)
+
+		_, _, err := svc.IssueToken(ctx, "opr_missing", "laptop", 0)
+
+		assert.ErrorIs(t, err, operator.ErrOperatorNotFound)
+	})
+}
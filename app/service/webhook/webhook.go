@@ -0,0 +1,240 @@
+// Package webhook fans events out to webhook subscriptions and delivers them
+// with signed, retried HTTP requests.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hostlink/domain/webhook"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Headers sent with every delivery. The signature is an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the subscription secret.
+const (
+	HeaderEvent     = "X-Hostlink-Event"
+	HeaderDelivery  = "X-Hostlink-Delivery"
+	HeaderTimestamp = "X-Hostlink-Timestamp"
+	HeaderSignature = "X-Hostlink-Signature"
+)
+
+// Publisher queues an event for every subscription that wants it.
+type Publisher interface {
+	Publish(ctx context.Context, eventType string, data any) error
+}
+
+// Config tunes delivery. A failed attempt is retried after BaseBackoff,
+// doubling up to MaxBackoff, until MaxAttempts attempts were made.
+type Config struct {
+	MaxAttempts int
+	Timeout     time.Duration
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// BatchSize bounds the deliveries attempted per Deliver call.
+	BatchSize int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts: 8,
+		Timeout:     10 * time.Second,
+		BaseBackoff: 10 * time.Second,
+		MaxBackoff:  time.Hour,
+		BatchSize:   50,
+	}
+}
+
+type Service struct {
+	repo   webhook.Repository
+	client *http.Client
+	config Config
+	now    func() time.Time
+}
+
+func NewService(repo webhook.Repository, config Config) *Service {
+	defaults := DefaultConfig()
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = defaults.BaseBackoff
+	}
+	if config.MaxBackoff < config.BaseBackoff {
+		config.MaxBackoff = config.BaseBackoff
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	return &Service{
+		repo:   repo,
+		client: &http.Client{Timeout: config.Timeout},
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// Publish queues one delivery of the event per matching subscription. The
+// deliveries are sent by Deliver, so publishing never waits on subscribers.
+func (s *Service) Publish(ctx context.Context, eventType string, data any) error {
+	if !webhook.ValidEvent(eventType) {
+		return fmt.Errorf("%w: %s", webhook.ErrUnknownEvent, eventType)
+	}
+
+	subscriptions, err := s.repo.FindSubscriptions(ctx)
+	if err != nil {
+		return fmt.Errorf("find subscriptions: %w", err)
+	}
+
+	now := s.now().UTC()
+	event := webhook.Event{
+		ID:         "evt_" + ulid.Make().String(),
+		Type:       eventType,
+		OccurredAt: now,
+		Data:       data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", eventType, err)
+	}
+
+	var deliveries []webhook.Delivery
+	for _, subscription := range subscriptions {
+		if !subscription.Matches(eventType) {
+			continue
+		}
+		deliveries = append(deliveries, webhook.Delivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      eventType,
+			Payload:        string(payload),
+			Status:         webhook.DeliveryPending,
+			NextAttemptAt:  now,
+		})
+	}
+	return s.repo.CreateDeliveries(ctx, deliveries)
+}
+
+// Deliver attempts every due delivery once and returns how many succeeded.
+// Failures are rescheduled with exponential backoff and recorded on the
+// delivery, which serves as the delivery log.
+func (s *Service) Deliver(ctx context.Context) (int, error) {
+	due, err := s.repo.FindDueDeliveries(ctx, s.now().UTC(), s.config.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("find due deliveries: %w", err)
+	}
+
+	subscriptions := map[string]*webhook.Subscription{}
+	delivered := 0
+	for i := range due {
+		delivery := &due[i]
+		subscription, ok := subscriptions[delivery.SubscriptionID]
+		if !ok {
+			subscription, err = s.repo.FindSubscription(ctx, delivery.SubscriptionID)
+			if err != nil && !errors.Is(err, webhook.ErrSubscriptionNotFound) {
+				return delivered, err
+			}
+			subscriptions[delivery.SubscriptionID] = subscription
+		}
+
+		if subscription == nil || !subscription.Active {
+			delivery.Status = webhook.DeliveryFailed
+			delivery.LastError = "subscription deleted or disabled"
+		} else {
+			s.attempt(ctx, subscription, delivery)
+		}
+		if delivery.Status == webhook.DeliveryDelivered {
+			delivered++
+		}
+		if err := s.repo.UpdateDelivery(ctx, delivery); err != nil {
+			return delivered, fmt.Errorf("update delivery %s: %w", delivery.ID, err)
+		}
+	}
+	return delivered, nil
+}
+
+// attempt POSTs the delivery once and moves it to its next state.
+func (s *Service) attempt(ctx context.Context, subscription *webhook.Subscription, delivery *webhook.Delivery) {
+	now := s.now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = 0
+	delivery.LastError = ""
+
+	status, err := s.post(ctx, subscription, delivery, now)
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status = webhook.DeliveryDelivered
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= s.config.MaxAttempts {
+		delivery.Status = webhook.DeliveryFailed
+		return
+	}
+	delivery.NextAttemptAt = now.Add(s.backoff(delivery.Attempts))
+}
+
+func (s *Service) post(ctx context.Context, subscription *webhook.Subscription, delivery *webhook.Delivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hostlink-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (s *Service) backoff(attempts int) time.Duration {
+	wait := s.config.BaseBackoff
+	for i := 1; i < attempts && wait < s.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > s.config.MaxBackoff {
+		wait = s.config.MaxBackoff
+	}
+	return wait
+}
+
+// Sign returns the signature header value of body sent at timestamp.
+// Receivers recompute it with their copy of the secret and should reject
+// stale timestamps.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
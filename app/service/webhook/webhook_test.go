@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hostlink/domain/webhook"
+	gormRepo "hostlink/internal/repository/gorm"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupService(t *testing.T, config Config) (*Service, webhook.Repository) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&webhook.Subscription{}, &webhook.Delivery{}))
+
+	repo := gormRepo.NewWebhookRepository(db)
+	return NewService(repo, config), repo
+}
+
+func subscribe(t *testing.T, repo webhook.Repository, url string, events ...string) *webhook.Subscription {
+	t.Helper()
+	subscription := &webhook.Subscription{URL: url, Secret: "s3cret", Events: events, Active: true}
+	require.NoError(t, repo.CreateSubscription(context.Background(), subscription))
+	return subscription
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("queues a delivery per matching subscription", func(t *testing.T) {
+		svc, repo := setupService(t, DefaultConfig())
+		failed := subscribe(t, repo, "https://a.example.com", webhook.EventTaskFailed)
+		other := subscribe(t, repo, "https://b.example.com", webhook.EventAgentOffline)
+
+		require.NoError(t, svc.Publish(ctx, webhook.EventTaskFailed, webhook.TaskData{ID: "tsk_1", Status: "failed"}))
+
+		deliveries, err := repo.FindDeliveries(ctx, failed.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, webhook.DeliveryPending, deliveries[0].Status)
+
+		var event webhook.Event
+		require.NoError(t, json.Unmarshal([]byte(deliveries[0].Payload), &event))
+		assert.Equal(t, webhook.EventTaskFailed, event.Type)
+		assert.Equal(t, deliveries[0].EventID, event.ID)
+
+		deliveries, err = repo.FindDeliveries(ctx, other.ID, 0)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+	})
+
+	t.Run("rejects unknown events", func(t *testing.T) {
+		svc, _ := setupService(t, DefaultConfig())
+
+		err := svc.Publish(ctx, "task.exploded", nil)
+
+		assert.ErrorIs(t, err, webhook.ErrUnknownEvent)
+	})
+}
+
+func TestDeliver(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("posts a signed payload", func(t *testing.T) {
+		var received atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received.Add(1)
+			body, _ := io.ReadAll(r.Body)
+			timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+			assert.NoError(t, err)
+			assert.Equal(t, Sign("s3cret", timestamp, body), r.Header.Get(HeaderSignature))
+			assert.Equal(t, webhook.EventAgentOffline, r.Header.Get(HeaderEvent))
+			assert.NotEmpty(t, r.Header.Get(HeaderDelivery))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		svc, repo := setupService(t, DefaultConfig())
+		subscription := subscribe(t, repo, server.URL, webhook.EventAgentOffline)
+		require.NoError(t, svc.Publish(ctx, webhook.EventAgentOffline, webhook.AgentData{ID: "agt_1"}))
+
+		delivered, err := svc.Deliver(ctx)
+
+		require.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, int32(1), received.Load())
+		deliveries, err := repo.FindDeliveries(ctx, subscription.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, webhook.DeliveryDelivered, deliveries[0].Status)
+		assert.Equal(t, 1, deliveries[0].Attempts)
+		assert.Equal(t, http.StatusNoContent, deliveries[0].ResponseStatus)
+	})
+
+	t.Run("retries with backoff and gives up after max attempts", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		svc, repo := setupService(t, Config{MaxAttempts: 3, BaseBackoff: time.Minute, MaxBackoff: time.Hour})
+		now := time.Now().UTC()
+		svc.now = func() time.Time { return now }
+		subscription := subscribe(t, repo, server.URL, webhook.EventTaskCompleted)
+		require.NoError(t, svc.Publish(ctx, webhook.EventTaskCompleted, webhook.TaskData{ID: "tsk_1"}))
+
+		for attempt, wait := range []time.Duration{time.Minute, 2 * time.Minute} {
+			delivered, err := svc.Deliver(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 0, delivered)
+
+			deliveries, err := repo.FindDeliveries(ctx, subscription.ID, 0)
+			require.NoError(t, err)
+			require.Len(t, deliveries, 1)
+			assert.Equal(t, webhook.DeliveryPending, deliveries[0].Status)
+			assert.Equal(t, attempt+1, deliveries[0].Attempts)
+			assert.Equal(t, http.StatusInternalServerError, deliveries[0].ResponseStatus)
+			assert.Equal(t, "unexpected status 500", deliveries[0].LastError)
+			assert.WithinDuration(t, now.Add(wait), deliveries[0].NextAttemptAt, time.Second)
+
+			// Not due yet.
+			delivered, err = svc.Deliver(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 0, delivered)
+
+			now = now.Add(wait)
+		}
+
+		_, err := svc.Deliver(ctx)
+		require.NoError(t, err)
+		deliveries, err := repo.FindDeliveries(ctx, subscription.ID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, webhook.DeliveryFailed, deliveries[0].Status)
+		assert.Equal(t, 3, deliveries[0].Attempts)
+	})
+
+	t.Run("fails deliveries of disabled subscriptions", func(t *testing.T) {
+		svc, repo := setupService(t, DefaultConfig())
+		subscription := subscribe(t, repo, "http://127.0.0.1:0", webhook.EventTaskFailed)
+		require.NoError(t, svc.Publish(ctx, webhook.EventTaskFailed, webhook.TaskData{ID: "tsk_1"}))
+		subscription.Active = false
+		require.NoError(t, repo.UpdateSubscription(ctx, subscription))
+
+		_, err := svc.Deliver(ctx)
+
+		require.NoError(t, err)
+		deliveries, err := repo.FindDeliveries(ctx, subscription.ID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, webhook.DeliveryFailed, deliveries[0].Status)
+		assert.Equal(t, 0, deliveries[0].Attempts)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	svc := NewService(nil, Config{BaseBackoff: 10 * time.Second, MaxBackoff: time.Minute})
+
+	assert.Equal(t, 10*time.Second, svc.backoff(1))
+	assert.Equal(t, 20*time.Second, svc.backoff(2))
+	assert.Equal(t, 40*time.Second, svc.backoff(3))
+	assert.Equal(t, time.Minute, svc.backoff(4))
+	assert.Equal(t, time.Minute, svc.backoff(20))
+}
+
+func TestSign(t *testing.T) {
+	signature := Sign("s3cret", 1700000000, []byte(`{"id":"evt_1"}`))
+
+	assert.Equal(t, "sha256=8e6f5c9e12ccd802130a0cf337c2d90395d59605481627c32bb6c530172adf23", signature)
+	assert.NotEqual(t, signature, Sign("other", 1700000000, []byte(`{"id":"evt_1"}`)))
+	assert.NotEqual(t, signature, Sign("s3cret", 1700000001, []byte(`{"id":"evt_1"}`)))
+}
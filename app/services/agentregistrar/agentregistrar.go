@@ -2,21 +2,35 @@ package agentregistrar
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hostlink/app/services/agenttags"
 	"hostlink/config/appconf"
 	"hostlink/internal/crypto"
+	"hostlink/internal/httpclient"
+	"hostlink/internal/sysinfo"
 	"net/http"
-	"os"
 	"time"
+
+	"github.com/labstack/gommon/log"
 )
 
+// ErrPendingApproval is returned when the control plane holds the
+// registration until an operator approves it. Registering again after the
+// approval succeeds.
+var ErrPendingApproval = errors.New("registration pending approval")
+
 type Registrar struct {
 	client          *http.Client
 	controlPlaneURL string
 	tokenID         string
 	tokenKey        string
 	privateKeyPath  string
+	keyType         string
+	clientCertPath  string
+	tags            *agenttags.Collector
 }
 
 type Config struct {
@@ -24,7 +38,16 @@ type Config struct {
 	TokenID         string
 	TokenKey        string
 	PrivateKeyPath  string
-	Timeout         time.Duration
+	// KeyType is the algorithm of a key generated when none exists at
+	// PrivateKeyPath (default: ed25519).
+	KeyType string
+	// ClientCertPath enables requesting an mTLS client certificate during
+	// registration; the issued certificate is written to this path.
+	ClientCertPath string
+	// Tags collects the tags the agent declares; without it the agent
+	// declares its hostname and OS.
+	Tags    *agenttags.Collector
+	Timeout time.Duration
 }
 
 type RegistrationRequest struct {
@@ -34,6 +57,23 @@ type RegistrationRequest struct {
 	PublicKey     string    `json:"public_key"`
 	PublicKeyType string    `json:"public_key_type"`
 	Tags          []TagPair `json:"tags"`
+	CSR           string    `json:"csr,omitempty"`
+
+	Hostname            string                `json:"hostname,omitempty"`
+	IPAddress           string                `json:"ip_address,omitempty"`
+	MACAddress          string                `json:"mac_address,omitempty"`
+	MachineID           string                `json:"machine_id,omitempty"`
+	HardwareInfo        *sysinfo.HardwareInfo `json:"hardware_info,omitempty"`
+	PreviousFingerprint string                `json:"previous_fingerprint,omitempty"`
+}
+
+// Hardware describes the host a fingerprint was generated on. The control
+// plane compares it with the agent it resembles when the fingerprint is new.
+type Hardware struct {
+	Info *sysinfo.HardwareInfo
+	// PreviousFingerprint is the fingerprint the host had before its
+	// hardware drifted, if it did
+	PreviousFingerprint string
 }
 
 type TagPair struct {
@@ -47,35 +87,62 @@ type RegistrationResponse struct {
 	Status       string    `json:"status"`
 	Message      string    `json:"message"`
 	RegisteredAt time.Time `json:"registered_at"`
+
+	ClientCertificate string `json:"client_certificate,omitempty"`
+	// RegistrationID identifies a registration held for approval
+	RegistrationID string `json:"registration_id,omitempty"`
 }
 
 func New() *Registrar {
-	return NewWithConfig(&Config{
+	cfg := &Config{
 		ControlPlaneURL: appconf.ControlPlaneURL(),
 		TokenID:         appconf.AgentTokenID(),
 		TokenKey:        appconf.AgentTokenKey(),
 		PrivateKeyPath:  appconf.AgentPrivateKeyPath(),
+		KeyType:         appconf.AgentKeyType(),
+		Tags:            agenttags.New(),
 		Timeout:         30 * time.Second,
-	})
+	}
+	if appconf.MTLSEnabled() {
+		cfg.ClientCertPath = appconf.AgentClientCertPath()
+	}
+	return NewWithConfig(cfg)
 }
 
 func NewWithConfig(cfg *Config) *Registrar {
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 30 * time.Second
 	}
+	if cfg.KeyType == "" {
+		cfg.KeyType = crypto.KeyTypeEd25519
+	}
+
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+	}
+	if opts := httpclient.DefaultTLSOptions(); !opts.IsZero() {
+		client.Transport = httpclient.NewTransport(opts)
+	}
 
 	return &Registrar{
-		client: &http.Client{
-			Timeout: cfg.Timeout,
-		},
+		client:          client,
 		controlPlaneURL: cfg.ControlPlaneURL,
 		tokenID:         cfg.TokenID,
 		tokenKey:        cfg.TokenKey,
 		privateKeyPath:  cfg.PrivateKeyPath,
+		keyType:         cfg.KeyType,
+		clientCertPath:  cfg.ClientCertPath,
+		tags:            cfg.Tags,
 	}
 }
 
 func (r *Registrar) Register(fingerprint string, publicKeyBase64 string, tags []TagPair) (*RegistrationResponse, error) {
+	return r.RegisterWithHardware(fingerprint, publicKeyBase64, tags, Hardware{})
+}
+
+// RegisterWithHardware registers like Register and also reports the host's
+// hardware. It returns ErrPendingApproval when the registration is held.
+func (r *Registrar) RegisterWithHardware(fingerprint string, publicKeyBase64 string, tags []TagPair, hw Hardware) (*RegistrationResponse, error) {
 	if r.tokenID == "" || r.tokenKey == "" {
 		return nil, fmt.Errorf("token credentials not configured")
 	}
@@ -85,8 +152,25 @@ func (r *Registrar) Register(fingerprint string, publicKeyBase64 string, tags []
 		TokenID:       r.tokenID,
 		TokenKey:      r.tokenKey,
 		PublicKey:     publicKeyBase64,
-		PublicKeyType: "RSA",
+		PublicKeyType: publicKeyType(publicKeyBase64),
 		Tags:          tags,
+
+		HardwareInfo:        hw.Info,
+		PreviousFingerprint: hw.PreviousFingerprint,
+	}
+	if hw.Info != nil {
+		request.Hostname = hw.Info.HostnameInfo
+		request.IPAddress = hw.Info.IPAddressInfo
+		request.MACAddress = hw.Info.MACAddrInfo
+		request.MachineID = hw.Info.MachineID
+	}
+
+	if r.clientCertPath != "" {
+		csr, err := r.prepareCSR(fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		request.CSR = csr
 	}
 
 	jsonData, err := json.Marshal(request)
@@ -108,6 +192,12 @@ func (r *Registrar) Register(fingerprint string, publicKeyBase64 string, tags []
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusAccepted {
+		var held RegistrationResponse
+		json.NewDecoder(resp.Body).Decode(&held)
+		return nil, fmt.Errorf("%w: %s", ErrPendingApproval, held.RegistrationID)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		var errorResp map[string]string
 		json.NewDecoder(resp.Body).Decode(&errorResp)
@@ -122,16 +212,30 @@ func (r *Registrar) Register(fingerprint string, publicKeyBase64 string, tags []
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	if r.clientCertPath != "" && response.ClientCertificate != "" {
+		if err := crypto.SaveCertificatePEM(response.ClientCertificate, r.clientCertPath); err != nil {
+			return nil, fmt.Errorf("failed to save client certificate: %w", err)
+		}
+	}
+
 	return &response, nil
 }
 
+func (r *Registrar) prepareCSR(commonName string) (string, error) {
+	privateKey, err := crypto.LoadKey(r.privateKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load private key: %w", err)
+	}
+	return crypto.CreateCertificateRequestPEM(privateKey, commonName)
+}
+
 func (r *Registrar) PreparePublicKey() (string, error) {
-	privateKey, err := crypto.LoadOrGenerateKeypair(r.privateKeyPath, 2048)
+	privateKey, err := crypto.LoadOrGenerateKey(r.privateKeyPath, r.keyType)
 	if err != nil {
 		return "", fmt.Errorf("failed to load/generate keypair: %w", err)
 	}
 
-	publicKeyBase64, err := crypto.GetPublicKeyBase64(privateKey)
+	publicKeyBase64, err := crypto.PublicKeyBase64(privateKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to get public key: %w", err)
 	}
@@ -139,11 +243,35 @@ func (r *Registrar) PreparePublicKey() (string, error) {
 	return publicKeyBase64, nil
 }
 
+// publicKeyType names the algorithm of a base64 public key for the control
+// plane. RSA keys keep the "RSA" agents have always sent.
+func publicKeyType(publicKeyBase64 string) string {
+	publicKey, err := crypto.ParsePublicKeyBase64(publicKeyBase64)
+	if err != nil {
+		return "RSA"
+	}
+	if keyType := crypto.KeyType(publicKey); keyType != crypto.KeyTypeRSA {
+		return keyType
+	}
+	return "RSA"
+}
+
+// GetDefaultTags returns the tags the agent declares at registration. When
+// its tags file or script cannot be read it declares its hostname and OS.
 func (r *Registrar) GetDefaultTags() []TagPair {
-	hostname, _ := os.Hostname()
+	tags := agenttags.Defaults()
+	if r.tags != nil {
+		collected, err := r.tags.Collect(context.Background())
+		if err != nil {
+			log.Warnf("declaring default tags only: %v", err)
+		} else {
+			tags = collected
+		}
+	}
 
-	return []TagPair{
-		{Key: "hostname", Value: hostname},
-		{Key: "os", Value: "linux"},
+	pairs := make([]TagPair, len(tags))
+	for i, tag := range tags {
+		pairs[i] = TagPair{Key: tag.Key, Value: tag.Value}
 	}
+	return pairs
 }
\ No newline at end of file
@@ -1,13 +1,23 @@
 package agentregistrar
 
 import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"hostlink/app/services/agenttags"
+	"hostlink/internal/crypto"
+	"hostlink/internal/sysinfo"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -975,6 +985,101 @@ func TestPreparePublicKey(t *testing.T) {
 	})
 }
 
+func TestPreparePublicKeyType(t *testing.T) {
+	t.Run("should generate a key of the configured type", func(t *testing.T) {
+		keyPath := t.TempDir() + "/agent.key"
+		registrar := NewWithConfig(&Config{PrivateKeyPath: keyPath, KeyType: crypto.KeyTypeECDSA})
+
+		if _, err := registrar.PreparePublicKey(); err != nil {
+			t.Fatalf("PreparePublicKey failed: %v", err)
+		}
+
+		key, err := crypto.LoadKey(keyPath)
+		if err != nil {
+			t.Fatalf("Failed to load key: %v", err)
+		}
+		if keyType := crypto.KeyType(key); keyType != crypto.KeyTypeECDSA {
+			t.Errorf("Expected an ecdsa key, got %q", keyType)
+		}
+	})
+
+	t.Run("should default to Ed25519", func(t *testing.T) {
+		keyPath := t.TempDir() + "/agent.key"
+		registrar := NewWithConfig(&Config{PrivateKeyPath: keyPath})
+
+		if _, err := registrar.PreparePublicKey(); err != nil {
+			t.Fatalf("PreparePublicKey failed: %v", err)
+		}
+
+		key, err := crypto.LoadKey(keyPath)
+		if err != nil {
+			t.Fatalf("Failed to load key: %v", err)
+		}
+		if keyType := crypto.KeyType(key); keyType != crypto.KeyTypeEd25519 {
+			t.Errorf("Expected an ed25519 key, got %q", keyType)
+		}
+	})
+
+	t.Run("should keep an existing RSA key", func(t *testing.T) {
+		keyPath := t.TempDir() + "/agent.key"
+		rsaKey, err := crypto.LoadOrGenerateKeypair(keyPath, 2048)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		expected, err := crypto.GetPublicKeyBase64(rsaKey)
+		if err != nil {
+			t.Fatalf("Failed to encode public key: %v", err)
+		}
+		registrar := NewWithConfig(&Config{PrivateKeyPath: keyPath, KeyType: crypto.KeyTypeEd25519})
+
+		publicKey, err := registrar.PreparePublicKey()
+		if err != nil {
+			t.Fatalf("PreparePublicKey failed: %v", err)
+		}
+		if publicKey != expected {
+			t.Error("Expected the existing RSA public key")
+		}
+	})
+}
+
+func TestRegisterPublicKeyType(t *testing.T) {
+	for keyType, expected := range map[string]string{
+		crypto.KeyTypeRSA:     "RSA",
+		crypto.KeyTypeEd25519: "ed25519",
+		crypto.KeyTypeECDSA:   "ecdsa",
+	} {
+		t.Run(keyType, func(t *testing.T) {
+			var captured RegistrationRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+					t.Errorf("Failed to decode request: %v", err)
+				}
+				json.NewEncoder(w).Encode(RegistrationResponse{ID: "agt_test123"})
+			}))
+			defer server.Close()
+
+			registrar := NewWithConfig(&Config{
+				ControlPlaneURL: server.URL,
+				TokenID:         "test-id",
+				TokenKey:        "test-key",
+				PrivateKeyPath:  t.TempDir() + "/agent.key",
+				KeyType:         keyType,
+			})
+			publicKey, err := registrar.PreparePublicKey()
+			if err != nil {
+				t.Fatalf("PreparePublicKey failed: %v", err)
+			}
+
+			if _, err := registrar.Register("fp", publicKey, nil); err != nil {
+				t.Fatalf("Register failed: %v", err)
+			}
+			if captured.PublicKeyType != expected {
+				t.Errorf("Expected public key type %q, got %q", expected, captured.PublicKeyType)
+			}
+		})
+	}
+}
+
 func TestGetDefaultTags(t *testing.T) {
 	t.Run("should include hostname tag", func(t *testing.T) {
 		registrar := New()
@@ -1068,6 +1173,34 @@ func TestGetDefaultTags(t *testing.T) {
 			t.Error("Hostname tag was not found in default tags")
 		}
 	})
+
+	t.Run("should declare the tags of the tags file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tags.yml")
+		if err := os.WriteFile(path, []byte("role: web\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		registrar := NewWithConfig(&Config{Tags: agenttags.NewWithConfig(agenttags.Config{Path: path})})
+
+		tags := registrar.GetDefaultTags()
+
+		if len(tags) != 3 || tags[2] != (TagPair{Key: "role", Value: "web"}) {
+			t.Errorf("Expected hostname, os and role tags, got %v", tags)
+		}
+	})
+
+	t.Run("should declare hostname and os when the tags file is invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tags.yml")
+		if err := os.WriteFile(path, []byte("role: a,b\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		registrar := NewWithConfig(&Config{Tags: agenttags.NewWithConfig(agenttags.Config{Path: path})})
+
+		tags := registrar.GetDefaultTags()
+
+		if len(tags) != 2 || tags[0].Key != "hostname" || tags[1].Key != "os" {
+			t.Errorf("Expected hostname and os tags, got %v", tags)
+		}
+	})
 }
 
 func TestRegistrationRequestSerialization(t *testing.T) {
@@ -1371,3 +1504,122 @@ func TestHTTPTimeout(t *testing.T) {
 		}
 	})
 }
+
+func TestRegisterWithClientCertificate(t *testing.T) {
+	tempDir := t.TempDir()
+	keyPath := tempDir + "/agent.key"
+	certPath := tempDir + "/agent.crt"
+
+	key, err := crypto.LoadOrGenerateKeypair(keyPath, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "agt_cert"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	issued := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	var receivedCSR string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req RegistrationRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		receivedCSR = req.CSR
+		json.NewEncoder(w).Encode(RegistrationResponse{
+			ID:                "agt_cert",
+			ClientCertificate: issued,
+		})
+	}))
+	defer server.Close()
+
+	registrar := NewWithConfig(&Config{
+		ControlPlaneURL: server.URL,
+		TokenID:         "test-id",
+		TokenKey:        "test-key",
+		PrivateKeyPath:  keyPath,
+		ClientCertPath:  certPath,
+	})
+
+	if _, err := registrar.Register("test-fp", "test-key", []TagPair{}); err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+
+	csr, err := crypto.ParseCertificateRequestPEM(receivedCSR)
+	if err != nil {
+		t.Fatalf("Expected a valid CSR, got: %v", err)
+	}
+	if csr.Subject.CommonName != "test-fp" {
+		t.Errorf("Expected CSR common name test-fp, got %s", csr.Subject.CommonName)
+	}
+
+	saved, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatalf("Expected certificate to be saved: %v", err)
+	}
+	if string(saved) != issued {
+		t.Error("Saved certificate does not match issued certificate")
+	}
+}
+
+func TestRegisterWithHardware(t *testing.T) {
+	hw := Hardware{
+		Info: &sysinfo.HardwareInfo{
+			HostnameInfo:  "web-1",
+			IPAddressInfo: "10.0.0.1",
+			MACAddrInfo:   "aa:bb",
+			MachineID:     "machine-1",
+			DiskInfo:      "disk",
+		},
+		PreviousFingerprint: "fp-old",
+	}
+
+	t.Run("should report the hardware", func(t *testing.T) {
+		var captured RegistrationRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&captured)
+			json.NewEncoder(w).Encode(RegistrationResponse{ID: "agt_test123"})
+		}))
+		defer server.Close()
+		registrar := NewWithConfig(&Config{ControlPlaneURL: server.URL, TokenID: "test-id", TokenKey: "test-key"})
+
+		if _, err := registrar.RegisterWithHardware("fp-new", "test-key", nil, hw); err != nil {
+			t.Fatalf("RegisterWithHardware failed: %v", err)
+		}
+		if captured.Hostname != "web-1" || captured.IPAddress != "10.0.0.1" || captured.MACAddress != "aa:bb" || captured.MachineID != "machine-1" {
+			t.Errorf("Expected host fields from the hardware, got %+v", captured)
+		}
+		if captured.PreviousFingerprint != "fp-old" {
+			t.Errorf("Expected previous fingerprint fp-old, got %q", captured.PreviousFingerprint)
+		}
+		if captured.HardwareInfo == nil || captured.HardwareInfo.DiskInfo != "disk" {
+			t.Errorf("Expected the hardware info to be sent, got %+v", captured.HardwareInfo)
+		}
+	})
+
+	t.Run("should return ErrPendingApproval when the registration is held", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(RegistrationResponse{Status: "pending_approval", RegistrationID: "reg_123"})
+		}))
+		defer server.Close()
+		registrar := NewWithConfig(&Config{ControlPlaneURL: server.URL, TokenID: "test-id", TokenKey: "test-key"})
+
+		response, err := registrar.RegisterWithHardware("fp-new", "test-key", nil, hw)
+
+		if !errors.Is(err, ErrPendingApproval) {
+			t.Fatalf("Expected ErrPendingApproval, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "reg_123") {
+			t.Errorf("Expected the error to name the registration, got %v", err)
+		}
+		if response != nil {
+			t.Errorf("Expected no response, got %+v", response)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+// Package agenttags collects the tags an agent declares about itself: its
+// hostname and OS, the tags its discovery script prints and the tags in its
+// tags file, which win over the other two.
+package agenttags
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hostlink/config/appconf"
+	"hostlink/domain/agent"
+
+	"github.com/goccy/go-yaml"
+)
+
+// DefaultScriptTimeout bounds a run of the discovery script.
+const DefaultScriptTimeout = 30 * time.Second
+
+type Tag struct {
+	Key   string
+	Value string
+}
+
+type Config struct {
+	// Path is a YAML file mapping tag keys to values. A missing file
+	// declares no tags.
+	Path string
+	// Script is run for tags, one key=value per output line. Blank lines
+	// and lines starting with # are skipped.
+	Script string
+	// ScriptInterval is how long the script's tags are reused before it
+	// runs again.
+	ScriptInterval time.Duration
+	ScriptTimeout  time.Duration
+}
+
+type Collector struct {
+	config Config
+	now    func() time.Time
+
+	mu         sync.Mutex
+	scriptTags map[string]string
+	scriptRun  time.Time
+}
+
+func New() *Collector {
+	return NewWithConfig(Config{
+		Path:           appconf.AgentTagsPath(),
+		Script:         appconf.AgentTagsScript(),
+		ScriptInterval: appconf.AgentTagsScriptInterval(),
+	})
+}
+
+func NewWithConfig(cfg Config) *Collector {
+	if cfg.ScriptTimeout == 0 {
+		cfg.ScriptTimeout = DefaultScriptTimeout
+	}
+	return &Collector{config: cfg, now: time.Now}
+}
+
+// Defaults returns the tags every agent declares: its hostname and OS.
+func Defaults() []Tag {
+	hostname, _ := os.Hostname()
+	return []Tag{
+		{Key: "hostname", Value: hostname},
+		{Key: "os", Value: "linux"},
+	}
+}
+
+// Collect returns the agent's declared tags sorted by key. It fails when the
+// script fails or the tags file or script output holds a tag that is not
+// key=value, so a mistake never drops the tags declared before. After a
+// failed run the script's previous tags are used until it runs again.
+func (c *Collector) Collect(ctx context.Context) ([]Tag, error) {
+	tags := make(map[string]string)
+	for _, tag := range Defaults() {
+		tags[tag.Key] = tag.Value
+	}
+
+	scriptTags, err := c.runScript(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range scriptTags {
+		tags[key] = value
+	}
+
+	fileTags, err := c.readFile()
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range fileTags {
+		tags[key] = value
+	}
+
+	collected := make([]Tag, 0, len(tags))
+	for key, value := range tags {
+		collected = append(collected, Tag{Key: key, Value: value})
+	}
+	sort.Slice(collected, func(i, j int) bool { return collected[i].Key < collected[j].Key })
+	return collected, nil
+}
+
+func (c *Collector) readFile() (map[string]string, error) {
+	if c.config.Path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(c.config.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags file: %w", err)
+	}
+
+	var file map[string]any
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tags file %s: %w", c.config.Path, err)
+	}
+	tags := make(map[string]string, len(file))
+	for key, value := range file {
+		switch value.(type) {
+		case nil, map[string]any, []any:
+			return nil, fmt.Errorf("tags file %s: %w: %s must have a single value", c.config.Path, agent.ErrInvalidTag, key)
+		}
+		tags[key] = fmt.Sprint(value)
+		if err := agent.ValidateTag(key, tags[key]); err != nil {
+			return nil, fmt.Errorf("tags file %s: %w", c.config.Path, err)
+		}
+	}
+	return tags, nil
+}
+
+// runScript returns the script's tags, running it when its last run is
+// older than the script interval.
+func (c *Collector) runScript(ctx context.Context) (map[string]string, error) {
+	if c.config.Script == "" {
+		return nil, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.scriptRun.IsZero() && c.now().Sub(c.scriptRun) < c.config.ScriptInterval {
+		return c.scriptTags, nil
+	}
+	c.scriptRun = c.now()
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.ScriptTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, c.config.Script).Output()
+	if err != nil {
+		return nil, fmt.Errorf("tags script %s failed: %w", c.config.Script, err)
+	}
+	tags, err := parseScriptOutput(output)
+	if err != nil {
+		return nil, fmt.Errorf("tags script %s: %w", c.config.Script, err)
+	}
+	c.scriptTags = tags
+	return tags, nil
+}
+
+func parseScriptOutput(output []byte) (map[string]string, error) {
+	tags := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if err := agent.ValidateTag(key, value); err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+	return tags, scanner.Err()
+}
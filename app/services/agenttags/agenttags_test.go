@@ -0,0 +1,111 @@
+package agenttags
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hostlink/domain/agent"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), mode))
+	return path
+}
+
+func tagMap(tags []Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[tag.Key] = tag.Value
+	}
+	return m
+}
+
+func TestCollect(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	t.Run("declares the hostname and OS without a file or script", func(t *testing.T) {
+		c := NewWithConfig(Config{Path: filepath.Join(t.TempDir(), "missing.yml")})
+
+		tags, err := c.Collect(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, []Tag{{Key: "hostname", Value: hostname}, {Key: "os", Value: "linux"}}, tags)
+	})
+
+	t.Run("adds the file's tags over the script's", func(t *testing.T) {
+		path := writeFile(t, "tags.yml", "role: web\nrack: 12\nos: linux-lts\n", 0o644)
+		script := writeFile(t, "discover", "#!/bin/sh\necho '# discovered'\necho role=db\necho\necho zone=eu-1\n", 0o755)
+		c := NewWithConfig(Config{Path: path, Script: script})
+
+		tags, err := c.Collect(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"hostname": hostname,
+			"os":       "linux-lts",
+			"rack":     "12",
+			"role":     "web",
+			"zone":     "eu-1",
+		}, tagMap(tags))
+		assert.Equal(t, "hostname", tags[0].Key, "tags are sorted by key")
+	})
+
+	t.Run("rejects a tag that is not key=value", func(t *testing.T) {
+		for name, cfg := range map[string]Config{
+			"nested file value": {Path: writeFile(t, "tags.yml", "role:\n  a: b\n", 0o644)},
+			"comma in value":    {Path: writeFile(t, "tags.yml", "role: a,b\n", 0o644)},
+			"script line":       {Script: writeFile(t, "discover", "#!/bin/sh\necho role\n", 0o755)},
+		} {
+			_, err := NewWithConfig(cfg).Collect(context.Background())
+			assert.ErrorIs(t, err, agent.ErrInvalidTag, name)
+		}
+	})
+
+	t.Run("reuses the script's tags within the interval", func(t *testing.T) {
+		dir := t.TempDir()
+		counter := filepath.Join(dir, "runs")
+		script := writeFile(t, "discover", "#!/bin/sh\necho x >> "+counter+"\necho zone=eu-1\n", 0o755)
+		now := time.Now()
+		c := NewWithConfig(Config{Script: script, ScriptInterval: time.Minute})
+		c.now = func() time.Time { return now }
+
+		for range 3 {
+			_, err := c.Collect(context.Background())
+			require.NoError(t, err)
+		}
+		now = now.Add(time.Minute)
+		tags, err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		runs, err := os.ReadFile(counter)
+		require.NoError(t, err)
+		assert.Equal(t, "x\nx\n", string(runs))
+		assert.Equal(t, "eu-1", tagMap(tags)["zone"])
+	})
+
+	t.Run("keeps the script's previous tags after it fails", func(t *testing.T) {
+		script := writeFile(t, "discover", "#!/bin/sh\necho zone=eu-1\n", 0o755)
+		now := time.Now()
+		c := NewWithConfig(Config{Script: script, ScriptInterval: time.Minute})
+		c.now = func() time.Time { return now }
+		_, err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nexit 1\n"), 0o755))
+		now = now.Add(time.Minute)
+		_, err = c.Collect(context.Background())
+		require.Error(t, err)
+
+		tags, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "eu-1", tagMap(tags)["zone"])
+	})
+}
@@ -0,0 +1,94 @@
+// Package certrenewal keeps the agent's mTLS client certificate from expiring.
+package certrenewal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"hostlink/app/services/agentstate"
+	"hostlink/config/appconf"
+	"hostlink/internal/apiserver"
+	"hostlink/internal/crypto"
+)
+
+type Service interface {
+	RenewIfNeeded() error
+}
+
+// Config holds the certificate location and renewal policy.
+type Config struct {
+	PrivateKeyPath string
+	CertPath       string
+	// RenewBefore is how long before expiry a new certificate is requested.
+	RenewBefore time.Duration
+	Now         func() time.Time
+}
+
+type certRenewalService struct {
+	apiserver  apiserver.CertificateOperations
+	agentstate agentstate.Operations
+	config     Config
+}
+
+func New() (*certRenewalService, error) {
+	state := agentstate.New(appconf.AgentStatePath())
+	if err := state.Load(); err != nil {
+		return nil, err
+	}
+
+	client, err := apiserver.NewDefaultClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api client: %w", err)
+	}
+
+	return NewWithDependencies(client, state, Config{
+		PrivateKeyPath: appconf.AgentPrivateKeyPath(),
+		CertPath:       appconf.AgentClientCertPath(),
+		RenewBefore:    appconf.ClientCertRenewBefore(),
+	}), nil
+}
+
+func NewWithDependencies(
+	apiserver apiserver.CertificateOperations,
+	agentstate agentstate.Operations,
+	cfg Config,
+) *certRenewalService {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &certRenewalService{
+		apiserver:  apiserver,
+		agentstate: agentstate,
+		config:     cfg,
+	}
+}
+
+// RenewIfNeeded requests a new certificate when the current one is missing,
+// unreadable or within RenewBefore of expiring.
+func (s *certRenewalService) RenewIfNeeded() error {
+	agentID := s.agentstate.GetAgentID()
+	if agentID == "" {
+		return fmt.Errorf("agent not registered: missing agent ID")
+	}
+
+	cert, err := crypto.LoadCertificate(s.config.CertPath)
+	if err == nil && s.config.Now().Add(s.config.RenewBefore).Before(cert.NotAfter) {
+		return nil
+	}
+
+	privateKey, err := crypto.LoadKey(s.config.PrivateKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load private key: %w", err)
+	}
+	csr, err := crypto.CreateCertificateRequestPEM(privateKey, agentID)
+	if err != nil {
+		return err
+	}
+
+	certPEM, err := s.apiserver.RenewCertificate(context.Background(), agentID, csr)
+	if err != nil {
+		return fmt.Errorf("failed to renew client certificate: %w", err)
+	}
+	return crypto.SaveCertificatePEM(certPEM, s.config.CertPath)
+}
@@ -0,0 +1,144 @@
+package certrenewal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hostlink/internal/crypto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockAPIServer struct {
+	mock.Mock
+}
+
+func (m *MockAPIServer) RenewCertificate(ctx context.Context, agentID string, csrPEM string) (string, error) {
+	args := m.Called(ctx, agentID, csrPEM)
+	return args.String(0), args.Error(1)
+}
+
+type MockAgentState struct {
+	mock.Mock
+}
+
+func (m *MockAgentState) Save() error             { return nil }
+func (m *MockAgentState) Load() error             { return nil }
+func (m *MockAgentState) SetAgentID(string) error { return nil }
+func (m *MockAgentState) Clear() error            { return nil }
+
+func (m *MockAgentState) GetAgentID() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func setupTestService(t *testing.T) (*certRenewalService, *MockAPIServer, *MockAgentState, string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "agent.key")
+	_, err := crypto.LoadOrGenerateKeypair(keyPath, 2048)
+	require.NoError(t, err)
+
+	api := new(MockAPIServer)
+	state := new(MockAgentState)
+	svc := NewWithDependencies(api, state, Config{
+		PrivateKeyPath: keyPath,
+		CertPath:       filepath.Join(dir, "agent.crt"),
+		RenewBefore:    24 * time.Hour,
+	})
+	return svc, api, state, keyPath
+}
+
+func certificatePEM(t *testing.T, keyPath string, notAfter time.Time) string {
+	t.Helper()
+	key, err := crypto.LoadPrivateKey(keyPath)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "agt_123"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestRenewIfNeeded(t *testing.T) {
+	t.Run("requests certificate when none exists", func(t *testing.T) {
+		svc, api, state, keyPath := setupTestService(t)
+		issued := certificatePEM(t, keyPath, time.Now().Add(30*24*time.Hour))
+		state.On("GetAgentID").Return("agt_123")
+		api.On("RenewCertificate", mock.Anything, "agt_123", mock.MatchedBy(func(csr string) bool {
+			parsed, err := crypto.ParseCertificateRequestPEM(csr)
+			return err == nil && parsed.Subject.CommonName == "agt_123"
+		})).Return(issued, nil)
+
+		err := svc.RenewIfNeeded()
+
+		require.NoError(t, err)
+		saved, err := os.ReadFile(svc.config.CertPath)
+		require.NoError(t, err)
+		assert.Equal(t, issued, string(saved))
+		api.AssertExpectations(t)
+	})
+
+	t.Run("skips renewal while certificate is fresh", func(t *testing.T) {
+		svc, api, state, keyPath := setupTestService(t)
+		require.NoError(t, crypto.SaveCertificatePEM(certificatePEM(t, keyPath, time.Now().Add(30*24*time.Hour)), svc.config.CertPath))
+		state.On("GetAgentID").Return("agt_123")
+
+		err := svc.RenewIfNeeded()
+
+		require.NoError(t, err)
+		api.AssertNotCalled(t, "RenewCertificate", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("renews certificate close to expiry", func(t *testing.T) {
+		svc, api, state, keyPath := setupTestService(t)
+		require.NoError(t, crypto.SaveCertificatePEM(certificatePEM(t, keyPath, time.Now().Add(time.Hour)), svc.config.CertPath))
+		state.On("GetAgentID").Return("agt_123")
+		api.On("RenewCertificate", mock.Anything, "agt_123", mock.Anything).
+			Return(certificatePEM(t, keyPath, time.Now().Add(30*24*time.Hour)), nil)
+
+		err := svc.RenewIfNeeded()
+
+		require.NoError(t, err)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("keeps existing certificate when renewal fails", func(t *testing.T) {
+		svc, api, state, keyPath := setupTestService(t)
+		current := certificatePEM(t, keyPath, time.Now().Add(time.Hour))
+		require.NoError(t, crypto.SaveCertificatePEM(current, svc.config.CertPath))
+		state.On("GetAgentID").Return("agt_123")
+		api.On("RenewCertificate", mock.Anything, "agt_123", mock.Anything).Return("", errors.New("unavailable"))
+
+		err := svc.RenewIfNeeded()
+
+		assert.Error(t, err)
+		saved, readErr := os.ReadFile(svc.config.CertPath)
+		require.NoError(t, readErr)
+		assert.Equal(t, current, string(saved))
+	})
+
+	t.Run("returns error when agent is not registered", func(t *testing.T) {
+		svc, _, state, _ := setupTestService(t)
+		state.On("GetAgentID").Return("")
+
+		err := svc.RenewIfNeeded()
+
+		assert.Error(t, err)
+	})
+}
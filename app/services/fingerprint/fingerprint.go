@@ -16,6 +16,10 @@ type FingerprintData struct {
 	Fingerprint         string                `json:"fingerprint"`
 	HardwareHash        *sysinfo.HardwareInfo `json:"hardwareHash"`
 	SimilarityThreshold int                   `json:"similarityThreshold"`
+	// PreviousFingerprint is the fingerprint replaced when the machine ID
+	// changed or the hardware drifted, so the control plane can match the
+	// new fingerprint to the agent that had it
+	PreviousFingerprint string `json:"previousFingerprint,omitempty"`
 }
 
 var fingerprintMutex sync.Mutex
@@ -69,6 +73,7 @@ func (m *Manager) LoadOrGenerate() (*FingerprintData, bool, error) {
 			Fingerprint:         uuid.New().String(),
 			HardwareHash:        currentHardware,
 			SimilarityThreshold: m.threshold,
+			PreviousFingerprint: existingData.Fingerprint,
 		}
 		if err := m.save(newData); err != nil {
 			return nil, false, err
@@ -82,6 +87,7 @@ func (m *Manager) LoadOrGenerate() (*FingerprintData, bool, error) {
 			Fingerprint:         uuid.New().String(),
 			HardwareHash:        currentHardware,
 			SimilarityThreshold: m.threshold,
+			PreviousFingerprint: existingData.Fingerprint,
 		}
 		if err := m.save(newData); err != nil {
 			return nil, false, err
@@ -81,6 +81,10 @@ func TestLoadOrGenerate(t *testing.T) {
 			t.Errorf("Expected SimilarityThreshold 40, got %d", data.SimilarityThreshold)
 		}
 
+		if data.PreviousFingerprint != "" {
+			t.Errorf("Expected no previous fingerprint, got %s", data.PreviousFingerprint)
+		}
+
 		// Verify file was created
 		if _, err := os.Stat(fingerprintPath); os.IsNotExist(err) {
 			t.Error("Fingerprint file was not created")
@@ -179,6 +183,10 @@ func TestLoadOrGenerate(t *testing.T) {
 			t.Error("Expected new fingerprint to be generated when machine ID changes")
 		}
 
+		if loadedData.PreviousFingerprint != initialData.Fingerprint {
+			t.Errorf("Expected previous fingerprint %s, got %s", initialData.Fingerprint, loadedData.PreviousFingerprint)
+		}
+
 		// Verify it's still a valid UUID
 		if _, err := uuid.Parse(loadedData.Fingerprint); err != nil {
 			t.Errorf("New fingerprint is not a valid UUID: %v", err)
@@ -246,6 +254,10 @@ func TestLoadOrGenerate(t *testing.T) {
 			t.Error("Expected new fingerprint to be generated when similarity is below threshold")
 		}
 
+		if loadedData.PreviousFingerprint != initialData.Fingerprint {
+			t.Errorf("Expected previous fingerprint %s, got %s", initialData.Fingerprint, loadedData.PreviousFingerprint)
+		}
+
 		// Verify it's still a valid UUID
 		if _, err := uuid.Parse(loadedData.Fingerprint); err != nil {
 			t.Errorf("New fingerprint is not a valid UUID: %v", err)
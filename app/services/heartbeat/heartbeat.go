@@ -3,20 +3,32 @@ package heartbeat
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	"hostlink/app/services/agentstate"
+	"hostlink/app/services/agenttags"
 	"hostlink/config/appconf"
 	"hostlink/domain/task"
 	"hostlink/internal/apiserver"
+
+	"github.com/labstack/gommon/log"
 )
 
 type Service interface {
 	Send() ([]task.Task, error)
 }
 
+// TagCollector collects the tags the agent declares
+type TagCollector interface {
+	Collect(ctx context.Context) ([]agenttags.Tag, error)
+}
+
 type heartbeatService struct {
 	apiserver  apiserver.HeartbeatOperations
 	agentstate agentstate.Operations
+	tags       TagCollector
+	// declared are the tags the control plane last accepted
+	declared []agenttags.Tag
 }
 
 func New() (*heartbeatService, error) {
@@ -37,16 +49,21 @@ func NewWithConf() (*heartbeatService, error) {
 	return &heartbeatService{
 		apiserver:  client,
 		agentstate: state,
+		tags:       agenttags.New(),
 	}, nil
 }
 
+// NewWithDependencies builds the service; a nil tags collector declares no
+// tags.
 func NewWithDependencies(
 	apiserver apiserver.HeartbeatOperations,
 	agentstate agentstate.Operations,
+	tags TagCollector,
 ) *heartbeatService {
 	return &heartbeatService{
 		apiserver:  apiserver,
 		agentstate: agentstate,
+		tags:       tags,
 	}
 }
 
@@ -56,9 +73,36 @@ func (s *heartbeatService) Send() ([]task.Task, error) {
 		return nil, fmt.Errorf("agent not registered: missing agent ID")
 	}
 
-	resp, err := s.apiserver.Heartbeat(context.Background(), agentID)
+	ctx := context.Background()
+	tags := s.changedTags(ctx)
+	req := apiserver.HeartbeatRequest{}
+	for _, tag := range tags {
+		req.DeclaredTags = append(req.DeclaredTags, apiserver.TagPair{Key: tag.Key, Value: tag.Value})
+	}
+
+	resp, err := s.apiserver.Heartbeat(ctx, agentID, req)
 	if err != nil {
 		return nil, err
 	}
+	if tags != nil {
+		s.declared = tags
+	}
 	return resp.PendingTasks, nil
 }
+
+// changedTags returns the agent's tags when they differ from the tags last
+// declared, and nil when they do not or cannot be collected.
+func (s *heartbeatService) changedTags(ctx context.Context) []agenttags.Tag {
+	if s.tags == nil {
+		return nil
+	}
+	tags, err := s.tags.Collect(ctx)
+	if err != nil {
+		log.Warnf("keeping declared tags: %v", err)
+		return nil
+	}
+	if s.declared != nil && slices.Equal(tags, s.declared) {
+		return nil
+	}
+	return tags
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"hostlink/app/services/agenttags"
 	"hostlink/domain/task"
 	"hostlink/internal/apiserver"
 )
@@ -15,8 +16,8 @@ type MockAPIServer struct {
 	mock.Mock
 }
 
-func (m *MockAPIServer) Heartbeat(ctx context.Context, agentID string) (*apiserver.HeartbeatResponse, error) {
-	args := m.Called(ctx, agentID)
+func (m *MockAPIServer) Heartbeat(ctx context.Context, agentID string, req apiserver.HeartbeatRequest) (*apiserver.HeartbeatResponse, error) {
+	args := m.Called(ctx, agentID, req)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -52,10 +53,19 @@ func (m *MockAgentState) Clear() error {
 	return args.Error(0)
 }
 
+type mockTagCollector struct {
+	tags []agenttags.Tag
+	err  error
+}
+
+func (m *mockTagCollector) Collect(ctx context.Context) ([]agenttags.Tag, error) {
+	return m.tags, m.err
+}
+
 func setupTestService() (*heartbeatService, *MockAPIServer, *MockAgentState) {
 	mockSvr := new(MockAPIServer)
 	agentstate := new(MockAgentState)
-	service := NewWithDependencies(mockSvr, agentstate)
+	service := NewWithDependencies(mockSvr, agentstate, nil)
 	return service, mockSvr, agentstate
 }
 
@@ -76,7 +86,7 @@ func TestSend_Success(t *testing.T) {
 	service, mockSvr, agentstate := setupTestService()
 
 	agentstate.On("GetAgentID").Return("agent-123")
-	mockSvr.On("Heartbeat", mock.Anything, "agent-123").Return(&apiserver.HeartbeatResponse{}, nil)
+	mockSvr.On("Heartbeat", mock.Anything, "agent-123", apiserver.HeartbeatRequest{}).Return(&apiserver.HeartbeatResponse{}, nil)
 
 	tasks, err := service.Send()
 
@@ -92,7 +102,7 @@ func TestSend_APIError(t *testing.T) {
 	expectedErr := errors.New("connection refused")
 
 	agentstate.On("GetAgentID").Return("agent-123")
-	mockSvr.On("Heartbeat", mock.Anything, "agent-123").Return(nil, expectedErr)
+	mockSvr.On("Heartbeat", mock.Anything, "agent-123", apiserver.HeartbeatRequest{}).Return(nil, expectedErr)
 
 	tasks, err := service.Send()
 
@@ -110,7 +120,7 @@ func TestSend_UsesBackgroundContext(t *testing.T) {
 	mockSvr.On("Heartbeat", mock.MatchedBy(func(ctx context.Context) bool {
 		_, hasDeadline := ctx.Deadline()
 		return !hasDeadline && ctx.Err() == nil
-	}), "agent-123").Return(&apiserver.HeartbeatResponse{}, nil)
+	}), "agent-123", apiserver.HeartbeatRequest{}).Return(&apiserver.HeartbeatResponse{}, nil)
 
 	tasks, err := service.Send()
 
@@ -130,7 +140,7 @@ func TestSend_WithPendingTasks(t *testing.T) {
 			{ID: "tsk_test", Command: "echo hello", Status: "pending"},
 		},
 	}
-	mockSvr.On("Heartbeat", mock.Anything, "agent-123").Return(resp, nil)
+	mockSvr.On("Heartbeat", mock.Anything, "agent-123", apiserver.HeartbeatRequest{}).Return(resp, nil)
 
 	pendingTasks, err := service.Send()
 
@@ -139,3 +149,34 @@ func TestSend_WithPendingTasks(t *testing.T) {
 	assert.Equal(t, "tsk_test", pendingTasks[0].ID)
 	assert.Equal(t, "echo hello", pendingTasks[0].Command)
 }
+
+// TestSend_DeclaresChangedTags - sends declared tags only when they change
+func TestSend_DeclaresChangedTags(t *testing.T) {
+	mockSvr := new(MockAPIServer)
+	agentstate := new(MockAgentState)
+	tags := &mockTagCollector{tags: []agenttags.Tag{{Key: "role", Value: "web"}}}
+	service := NewWithDependencies(mockSvr, agentstate, tags)
+	agentstate.On("GetAgentID").Return("agent-123")
+	web := apiserver.HeartbeatRequest{DeclaredTags: []apiserver.TagPair{{Key: "role", Value: "web"}}}
+	db := apiserver.HeartbeatRequest{DeclaredTags: []apiserver.TagPair{{Key: "role", Value: "db"}}}
+	mockSvr.On("Heartbeat", mock.Anything, "agent-123", web).Return(&apiserver.HeartbeatResponse{}, nil).Once()
+	mockSvr.On("Heartbeat", mock.Anything, "agent-123", apiserver.HeartbeatRequest{}).Return(&apiserver.HeartbeatResponse{}, nil).Twice()
+	mockSvr.On("Heartbeat", mock.Anything, "agent-123", db).Return(nil, errors.New("connection refused")).Once()
+	mockSvr.On("Heartbeat", mock.Anything, "agent-123", db).Return(&apiserver.HeartbeatResponse{}, nil).Once()
+
+	_, err := service.Send()
+	assert.NoError(t, err)
+	_, err = service.Send()
+	assert.NoError(t, err, "unchanged tags are not sent again")
+
+	tags.tags = []agenttags.Tag{{Key: "role", Value: "db"}}
+	_, err = service.Send()
+	assert.Error(t, err)
+	_, err = service.Send()
+	assert.NoError(t, err, "tags are sent again until the control plane accepts them")
+
+	tags.err = errors.New("invalid tags file")
+	_, err = service.Send()
+	assert.NoError(t, err, "tags that cannot be collected are not sent")
+	mockSvr.AssertExpectations(t)
+}
@@ -0,0 +1,325 @@
+// Package keyrotation replaces the agent's key without re-registering it.
+package keyrotation
+
+import (
+	"context"
+	gocrypto "crypto"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"hostlink/app/services/agentstate"
+	"hostlink/config/appconf"
+	"hostlink/domain/agent"
+	"hostlink/domain/credential"
+	"hostlink/domain/secret"
+	"hostlink/internal/apiserver"
+	"hostlink/internal/crypto"
+	"hostlink/internal/update"
+)
+
+// lockExpiration bounds how long a crashed rotation keeps others out.
+const lockExpiration = 5 * time.Minute
+
+type Service interface {
+	RotateIfDue() error
+	Rotate() (*Result, error)
+}
+
+// Result reports a completed rotation.
+type Result struct {
+	RotatedAt time.Time
+	// PreviousKeyValidUntil is when the server stops accepting the old key
+	PreviousKeyValidUntil time.Time
+}
+
+// Config holds the key location and rotation policy.
+type Config struct {
+	PrivateKeyPath string
+	// KeyType is the algorithm of the new key. Empty keeps the type of the
+	// current key; a different type moves the agent to it, e.g. an RSA
+	// agent to Ed25519.
+	KeyType string
+	// CertPath, when set, also replaces the mTLS client certificate, which
+	// is bound to the key.
+	CertPath string
+	// Interval is how old the key may get before RotateIfDue rotates it.
+	Interval time.Duration
+	Now      func() time.Time
+	// AfterRotate moves data still encrypted with the previous key to the
+	// current one. RotateIfDue runs it once a new key is in place, rotated
+	// by this service or by another process such as `hostlink rotate-key`,
+	// and deletes the previous key after it succeeds.
+	AfterRotate func() error
+}
+
+type keyRotationService struct {
+	apiserver  apiserver.KeyOperations
+	agentstate agentstate.Operations
+	config     Config
+	lock       *update.LockManager
+	// keyModTime is the key file's modification time when last seen, to
+	// notice keys rotated by another process
+	keyModTime time.Time
+}
+
+func New() (*keyRotationService, error) {
+	state := agentstate.New(appconf.AgentStatePath())
+	if err := state.Load(); err != nil {
+		return nil, err
+	}
+
+	client, err := apiserver.NewDefaultClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api client: %w", err)
+	}
+
+	cfg := Config{
+		PrivateKeyPath: appconf.AgentPrivateKeyPath(),
+		KeyType:        appconf.AgentKeyType(),
+		Interval:       appconf.KeyRotationInterval(),
+	}
+	if appconf.MTLSEnabled() {
+		cfg.CertPath = appconf.AgentClientCertPath()
+	}
+	return NewWithDependencies(client, state, cfg), nil
+}
+
+func NewWithDependencies(
+	apiserver apiserver.KeyOperations,
+	agentstate agentstate.Operations,
+	cfg Config,
+) *keyRotationService {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &keyRotationService{
+		apiserver:  apiserver,
+		agentstate: agentstate,
+		config:     cfg,
+		lock:       update.NewLockManager(update.LockConfig{LockPath: cfg.PrivateKeyPath + ".lock"}),
+	}
+}
+
+// WithAfterRotate sets Config.AfterRotate.
+func (s *keyRotationService) WithAfterRotate(fn func() error) *keyRotationService {
+	s.config.AfterRotate = fn
+	return s
+}
+
+// RotateIfDue rotates the key once it is older than Interval, judged by the
+// key file's modification time, and settles any rotation that left a
+// previous key behind.
+func (s *keyRotationService) RotateIfDue() error {
+	info, err := os.Stat(s.config.PrivateKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat private key: %w", err)
+	}
+	if s.keyModTime.IsZero() || !info.ModTime().Equal(s.keyModTime) {
+		if err := s.settle(); err != nil {
+			return err
+		}
+	}
+	s.keyModTime = info.ModTime()
+
+	if s.config.Now().Sub(info.ModTime()) < s.config.Interval {
+		return nil
+	}
+	if _, err := s.Rotate(); err != nil {
+		return err
+	}
+	return s.settle()
+}
+
+// Rotate switches the agent to a new key. The new key is kept next to the
+// current one until the server accepted it, so a rotation interrupted
+// after the server switched is completed by the next attempt.
+func (s *keyRotationService) Rotate() (*Result, error) {
+	agentID := s.agentstate.GetAgentID()
+	if agentID == "" {
+		return nil, fmt.Errorf("agent not registered: missing agent ID")
+	}
+
+	if err := s.lock.TryLock(lockExpiration); err != nil {
+		if errors.Is(err, update.ErrLockBusy) {
+			return nil, fmt.Errorf("key rotation already in progress")
+		}
+		return nil, fmt.Errorf("failed to lock key rotation: %w", err)
+	}
+	defer s.lock.Unlock()
+
+	oldKey, err := crypto.LoadKey(s.config.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %w", err)
+	}
+	keyType := s.config.KeyType
+	if keyType == "" {
+		keyType = crypto.KeyType(oldKey)
+	}
+	pendingPath := s.config.PrivateKeyPath + ".new"
+	newKey, err := crypto.LoadOrGenerateKey(pendingPath, keyType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate new key: %w", err)
+	}
+	publicKey, err := crypto.PublicKeyBase64(newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	credentials, err := s.reencryptCredentials(ctx, agentID, oldKey, newKey)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := s.resealSecrets(ctx, agentID, oldKey, newKey)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := crypto.SignMessage(agent.KeyProofMessage(agentID, publicKey), newKey)
+	if err != nil {
+		return nil, err
+	}
+	req := apiserver.KeyRotationRequest{
+		PublicKey:     publicKey,
+		PublicKeyType: crypto.KeyType(newKey),
+		Proof:         proof,
+		Credentials:   credentials,
+		Secrets:       secrets,
+	}
+	if s.config.CertPath != "" {
+		if req.CSR, err = crypto.CreateCertificateRequestPEM(newKey, agentID); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := s.apiserver.RotateKey(ctx, agentID, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate key: %w", err)
+	}
+
+	if err := s.install(oldKey, pendingPath); err != nil {
+		return nil, err
+	}
+	if resp.Certificate != "" {
+		if err := crypto.SaveCertificatePEM(resp.Certificate, s.config.CertPath); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{RotatedAt: s.config.Now()}
+	if resp.RotatedAt != nil {
+		result.RotatedAt = *resp.RotatedAt
+	}
+	if resp.PreviousKeyValidUntil != nil {
+		result.PreviousKeyValidUntil = *resp.PreviousKeyValidUntil
+	}
+	return result, nil
+}
+
+// reencryptCredentials decrypts the agent's stored credential passwords
+// with the current key and seals them in envelopes for the new one, which
+// also moves passwords encrypted before envelopes were used. Passwords the
+// new key already opens were re-encrypted by an earlier, interrupted attempt.
+func (s *keyRotationService) reencryptCredentials(ctx context.Context, agentID string, oldKey, newKey gocrypto.Signer) ([]apiserver.RotatedCredential, error) {
+	creds, err := s.apiserver.GetMetricsCreds(ctx, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+
+	var rotated []apiserver.RotatedCredential
+	for _, cred := range creds {
+		if cred.PasswdEnc == "" {
+			continue
+		}
+		envelopeContext := credential.EnvelopeContext(agentID, cred.ID)
+		password, err := crypto.OpenSecret(cred.PasswdEnc, oldKey, envelopeContext...)
+		if err != nil {
+			if _, newErr := crypto.OpenSecret(cred.PasswdEnc, newKey, envelopeContext...); newErr == nil {
+				continue
+			}
+			return nil, fmt.Errorf("failed to decrypt password for credential %s: %w", cred.ID, err)
+		}
+		passwdEnc, err := crypto.SealEnvelope([]byte(password), newKey.Public(), envelopeContext...)
+		if err != nil {
+			return nil, err
+		}
+		rotated = append(rotated, apiserver.RotatedCredential{
+			ID:                cred.ID,
+			PreviousPasswdEnc: cred.PasswdEnc,
+			PasswdEnc:         passwdEnc,
+		})
+	}
+	return rotated, nil
+}
+
+// resealSecrets opens the agent's task secrets with the current key and
+// seals them for the new one, skipping those an earlier, interrupted
+// attempt already sealed for it.
+func (s *keyRotationService) resealSecrets(ctx context.Context, agentID string, oldKey, newKey gocrypto.Signer) ([]apiserver.RotatedSecret, error) {
+	secrets, err := s.apiserver.GetSecrets(ctx, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch secrets: %w", err)
+	}
+
+	var rotated []apiserver.RotatedSecret
+	for _, sec := range secrets {
+		envelopeContext := secret.EnvelopeContext(agentID, sec.ID, sec.Name)
+		value, err := crypto.OpenEnvelope(sec.ValueEnc, oldKey, envelopeContext...)
+		if err != nil {
+			if _, newErr := crypto.OpenEnvelope(sec.ValueEnc, newKey, envelopeContext...); newErr == nil {
+				continue
+			}
+			return nil, fmt.Errorf("failed to open secret %s: %w", sec.Name, err)
+		}
+		valueEnc, err := crypto.SealEnvelope(value, newKey.Public(), envelopeContext...)
+		if err != nil {
+			return nil, err
+		}
+		rotated = append(rotated, apiserver.RotatedSecret{
+			ID:               sec.ID,
+			PreviousValueEnc: sec.ValueEnc,
+			ValueEnc:         valueEnc,
+		})
+	}
+	return rotated, nil
+}
+
+// install keeps the old key for data still encrypted with it and moves the
+// new key into place.
+func (s *keyRotationService) install(oldKey gocrypto.Signer, pendingPath string) error {
+	if err := crypto.SaveKey(oldKey, crypto.PreviousKeyPath(s.config.PrivateKeyPath)); err != nil {
+		return fmt.Errorf("failed to keep previous key: %w", err)
+	}
+	if err := os.Rename(pendingPath, s.config.PrivateKeyPath); err != nil {
+		return fmt.Errorf("failed to install new key: %w", err)
+	}
+	// The key age is read from the modification time, which the rename
+	// carries over from when the pending key was generated
+	now := s.config.Now()
+	if err := os.Chtimes(s.config.PrivateKeyPath, now, now); err != nil {
+		return fmt.Errorf("failed to touch new key: %w", err)
+	}
+	if info, err := os.Stat(s.config.PrivateKeyPath); err == nil {
+		s.keyModTime = info.ModTime()
+	}
+	return nil
+}
+
+// settle runs AfterRotate when a previous key is left from a rotation and
+// then deletes it, so a retired private key does not stay on disk.
+func (s *keyRotationService) settle() error {
+	previousPath := crypto.PreviousKeyPath(s.config.PrivateKeyPath)
+	if _, err := os.Stat(previousPath); err != nil {
+		return nil
+	}
+	if s.config.AfterRotate != nil {
+		if err := s.config.AfterRotate(); err != nil {
+			return fmt.Errorf("failed to apply rotated key: %w", err)
+		}
+	}
+	if err := os.Remove(previousPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove previous key: %w", err)
+	}
+	return nil
+}
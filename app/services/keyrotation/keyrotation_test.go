@@ -0,0 +1,329 @@
+package keyrotation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hostlink/domain/agent"
+	"hostlink/domain/credential"
+	"hostlink/domain/secret"
+	"hostlink/internal/apiserver"
+	"hostlink/internal/crypto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockAPIServer struct {
+	mock.Mock
+	// secrets are returned by GetSecrets, so tests without any need no
+	// expectation for it.
+	secrets []secret.Secret
+}
+
+func (m *MockAPIServer) GetMetricsCreds(ctx context.Context, agentID string) ([]credential.Credential, error) {
+	args := m.Called(ctx, agentID)
+	creds, _ := args.Get(0).([]credential.Credential)
+	return creds, args.Error(1)
+}
+
+func (m *MockAPIServer) GetSecrets(ctx context.Context, agentID string) ([]secret.Secret, error) {
+	return m.secrets, nil
+}
+
+func (m *MockAPIServer) RotateKey(ctx context.Context, agentID string, req apiserver.KeyRotationRequest) (*apiserver.KeyRotationResponse, error) {
+	args := m.Called(ctx, agentID, req)
+	resp, _ := args.Get(0).(*apiserver.KeyRotationResponse)
+	return resp, args.Error(1)
+}
+
+type MockAgentState struct {
+	mock.Mock
+}
+
+func (m *MockAgentState) Save() error             { return nil }
+func (m *MockAgentState) Load() error             { return nil }
+func (m *MockAgentState) SetAgentID(string) error { return nil }
+func (m *MockAgentState) Clear() error            { return nil }
+
+func (m *MockAgentState) GetAgentID() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func setupTestService(t *testing.T, cfg Config) (*keyRotationService, *MockAPIServer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "agent.key")
+	_, err := crypto.LoadOrGenerateKeypair(keyPath, 2048)
+	require.NoError(t, err)
+
+	api := new(MockAPIServer)
+	state := new(MockAgentState)
+	state.On("GetAgentID").Return("agt_123")
+	cfg.PrivateKeyPath = keyPath
+	return NewWithDependencies(api, state, cfg), api, keyPath
+}
+
+// certificatePEM returns a self-signed certificate standing in for the one
+// the server issues.
+func certificatePEM(t *testing.T) string {
+	t.Helper()
+	key, err := crypto.GenerateRSAKeypair(2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "agt_123"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestRotate(t *testing.T) {
+	t.Run("switches to a proven key and re-encrypts credentials", func(t *testing.T) {
+		svc, api, keyPath := setupTestService(t, Config{})
+		oldKey, err := crypto.LoadPrivateKey(keyPath)
+		require.NoError(t, err)
+		passwdEnc, err := crypto.EncryptWithPublicKey("s3cret", &oldKey.PublicKey)
+		require.NoError(t, err)
+		validUntil := time.Now().Add(time.Hour)
+
+		api.On("GetMetricsCreds", mock.Anything, "agt_123").
+			Return([]credential.Credential{{ID: "crd_1", PasswdEnc: passwdEnc}, {ID: "crd_2"}}, nil)
+		var sent apiserver.KeyRotationRequest
+		api.On("RotateKey", mock.Anything, "agt_123", mock.Anything).
+			Run(func(args mock.Arguments) { sent = args.Get(2).(apiserver.KeyRotationRequest) }).
+			Return(&apiserver.KeyRotationResponse{PreviousKeyValidUntil: &validUntil}, nil)
+
+		result, err := svc.Rotate()
+		require.NoError(t, err)
+		assert.True(t, validUntil.Equal(result.PreviousKeyValidUntil))
+
+		newKey, err := crypto.LoadPrivateKey(keyPath)
+		require.NoError(t, err)
+		publicKey, err := crypto.GetPublicKeyBase64(newKey)
+		require.NoError(t, err)
+		assert.Equal(t, publicKey, sent.PublicKey)
+		assert.NoError(t, crypto.VerifyMessage(agent.KeyProofMessage("agt_123", publicKey), sent.Proof, &newKey.PublicKey))
+		assert.Empty(t, sent.CSR)
+
+		require.Len(t, sent.Credentials, 1)
+		assert.Equal(t, "crd_1", sent.Credentials[0].ID)
+		assert.Equal(t, passwdEnc, sent.Credentials[0].PreviousPasswdEnc)
+		password, err := crypto.OpenEnvelope(sent.Credentials[0].PasswdEnc, newKey, credential.EnvelopeContext("agt_123", "crd_1")...)
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", string(password))
+
+		previousKey, err := crypto.LoadPrivateKey(crypto.PreviousKeyPath(keyPath))
+		require.NoError(t, err)
+		assert.Equal(t, oldKey, previousKey)
+		assert.NoFileExists(t, keyPath+".new")
+	})
+
+	t.Run("re-seals task secrets for the new key", func(t *testing.T) {
+		svc, api, keyPath := setupTestService(t, Config{})
+		oldKey, err := crypto.LoadPrivateKey(keyPath)
+		require.NoError(t, err)
+		valueEnc, err := crypto.SealEnvelope([]byte("token-value"), &oldKey.PublicKey, secret.EnvelopeContext("agt_123", "sec_1", "token")...)
+		require.NoError(t, err)
+
+		api.secrets = []secret.Secret{{ID: "sec_1", AgentID: "agt_123", Name: "token", ValueEnc: valueEnc}}
+		api.On("GetMetricsCreds", mock.Anything, "agt_123").Return([]credential.Credential{}, nil)
+		var sent apiserver.KeyRotationRequest
+		api.On("RotateKey", mock.Anything, "agt_123", mock.Anything).
+			Run(func(args mock.Arguments) { sent = args.Get(2).(apiserver.KeyRotationRequest) }).
+			Return(&apiserver.KeyRotationResponse{}, nil)
+
+		_, err = svc.Rotate()
+		require.NoError(t, err)
+
+		newKey, err := crypto.LoadKey(keyPath)
+		require.NoError(t, err)
+		require.Len(t, sent.Secrets, 1)
+		assert.Equal(t, "sec_1", sent.Secrets[0].ID)
+		assert.Equal(t, valueEnc, sent.Secrets[0].PreviousValueEnc)
+		value, err := crypto.OpenEnvelope(sent.Secrets[0].ValueEnc, newKey, secret.EnvelopeContext("agt_123", "sec_1", "token")...)
+		require.NoError(t, err)
+		assert.Equal(t, "token-value", string(value))
+	})
+
+	t.Run("moves an RSA key to the configured key type", func(t *testing.T) {
+		svc, api, keyPath := setupTestService(t, Config{KeyType: crypto.KeyTypeEd25519})
+		oldKey, err := crypto.LoadPrivateKey(keyPath)
+		require.NoError(t, err)
+		passwdEnc, err := crypto.EncryptWithPublicKey("s3cret", &oldKey.PublicKey)
+		require.NoError(t, err)
+
+		api.On("GetMetricsCreds", mock.Anything, "agt_123").
+			Return([]credential.Credential{{ID: "crd_1", PasswdEnc: passwdEnc}}, nil)
+		var sent apiserver.KeyRotationRequest
+		api.On("RotateKey", mock.Anything, "agt_123", mock.Anything).
+			Run(func(args mock.Arguments) { sent = args.Get(2).(apiserver.KeyRotationRequest) }).
+			Return(&apiserver.KeyRotationResponse{}, nil)
+
+		_, err = svc.Rotate()
+		require.NoError(t, err)
+
+		newKey, err := crypto.LoadKey(keyPath)
+		require.NoError(t, err)
+		assert.Equal(t, crypto.KeyTypeEd25519, crypto.KeyType(newKey))
+		assert.Equal(t, crypto.KeyTypeEd25519, sent.PublicKeyType)
+		assert.NoError(t, crypto.VerifyMessage(agent.KeyProofMessage("agt_123", sent.PublicKey), sent.Proof, newKey.Public()))
+
+		require.Len(t, sent.Credentials, 1)
+		password, err := crypto.OpenEnvelope(sent.Credentials[0].PasswdEnc, newKey, credential.EnvelopeContext("agt_123", "crd_1")...)
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", string(password))
+
+		previousKey, err := crypto.LoadPrivateKey(crypto.PreviousKeyPath(keyPath))
+		require.NoError(t, err)
+		assert.Equal(t, oldKey, previousKey, "the previous RSA key is kept for data encrypted with it")
+	})
+
+	t.Run("requests a certificate for the new key when mTLS is enabled", func(t *testing.T) {
+		certPath := filepath.Join(t.TempDir(), "agent.crt")
+		certPEM := certificatePEM(t)
+		svc, api, _ := setupTestService(t, Config{CertPath: certPath})
+		api.On("GetMetricsCreds", mock.Anything, "agt_123").Return([]credential.Credential{}, nil)
+		api.On("RotateKey", mock.Anything, "agt_123", mock.MatchedBy(func(req apiserver.KeyRotationRequest) bool {
+			return req.CSR != ""
+		})).Return(&apiserver.KeyRotationResponse{Certificate: certPEM}, nil)
+
+		_, err := svc.Rotate()
+		require.NoError(t, err)
+
+		cert, err := os.ReadFile(certPath)
+		require.NoError(t, err)
+		assert.Equal(t, certPEM, string(cert))
+	})
+
+	t.Run("keeps the current key when the server rejects the rotation", func(t *testing.T) {
+		svc, api, keyPath := setupTestService(t, Config{})
+		oldKey, err := crypto.LoadPrivateKey(keyPath)
+		require.NoError(t, err)
+		api.On("GetMetricsCreds", mock.Anything, "agt_123").Return([]credential.Credential{}, nil)
+		api.On("RotateKey", mock.Anything, "agt_123", mock.Anything).Return(nil, errors.New("conflict"))
+
+		_, err = svc.Rotate()
+		require.Error(t, err)
+
+		current, err := crypto.LoadPrivateKey(keyPath)
+		require.NoError(t, err)
+		assert.Equal(t, oldKey, current)
+		assert.FileExists(t, keyPath+".new", "the pending key is reused by the next attempt")
+	})
+
+	t.Run("retries with the pending key", func(t *testing.T) {
+		svc, api, keyPath := setupTestService(t, Config{})
+		api.On("GetMetricsCreds", mock.Anything, "agt_123").Return([]credential.Credential{}, nil)
+		var keys []string
+		api.On("RotateKey", mock.Anything, "agt_123", mock.Anything).
+			Run(func(args mock.Arguments) { keys = append(keys, args.Get(2).(apiserver.KeyRotationRequest).PublicKey) }).
+			Return(nil, errors.New("unavailable")).Once()
+		api.On("RotateKey", mock.Anything, "agt_123", mock.Anything).
+			Run(func(args mock.Arguments) { keys = append(keys, args.Get(2).(apiserver.KeyRotationRequest).PublicKey) }).
+			Return(&apiserver.KeyRotationResponse{}, nil).Once()
+
+		_, err := svc.Rotate()
+		require.Error(t, err)
+		_, err = svc.Rotate()
+		require.NoError(t, err)
+
+		require.Len(t, keys, 2)
+		assert.Equal(t, keys[0], keys[1])
+		newKey, err := crypto.LoadPrivateKey(keyPath)
+		require.NoError(t, err)
+		publicKey, err := crypto.GetPublicKeyBase64(newKey)
+		require.NoError(t, err)
+		assert.Equal(t, keys[1], publicKey)
+	})
+
+	t.Run("fails when the agent is not registered", func(t *testing.T) {
+		svc := NewWithDependencies(new(MockAPIServer), func() *MockAgentState {
+			state := new(MockAgentState)
+			state.On("GetAgentID").Return("")
+			return state
+		}(), Config{PrivateKeyPath: filepath.Join(t.TempDir(), "agent.key")})
+
+		_, err := svc.Rotate()
+		assert.ErrorContains(t, err, "agent not registered")
+	})
+}
+
+func TestRotateIfDue(t *testing.T) {
+	t.Run("does nothing while the key is younger than the interval", func(t *testing.T) {
+		svc, api, _ := setupTestService(t, Config{Interval: 24 * time.Hour})
+
+		require.NoError(t, svc.RotateIfDue())
+
+		api.AssertNotCalled(t, "RotateKey", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("rotates an old key and settles the previous key", func(t *testing.T) {
+		var settled int
+		now := time.Now()
+		svc, api, keyPath := setupTestService(t, Config{
+			Interval:    24 * time.Hour,
+			Now:         func() time.Time { return now },
+			AfterRotate: func() error { settled++; return nil },
+		})
+		old := now.Add(-48 * time.Hour)
+		require.NoError(t, os.Chtimes(keyPath, old, old))
+		api.On("GetMetricsCreds", mock.Anything, "agt_123").Return([]credential.Credential{}, nil)
+		api.On("RotateKey", mock.Anything, "agt_123", mock.Anything).Return(&apiserver.KeyRotationResponse{}, nil).Once()
+
+		require.NoError(t, svc.RotateIfDue())
+		assert.Equal(t, 1, settled)
+		assert.NoFileExists(t, crypto.PreviousKeyPath(keyPath))
+
+		require.NoError(t, svc.RotateIfDue())
+		assert.Equal(t, 1, settled, "the fresh key is not rotated again")
+		api.AssertNumberOfCalls(t, "RotateKey", 1)
+	})
+
+	t.Run("settles a key rotated by another process", func(t *testing.T) {
+		var settled int
+		svc, _, keyPath := setupTestService(t, Config{
+			Interval:    24 * time.Hour,
+			AfterRotate: func() error { settled++; return nil },
+		})
+		require.NoError(t, svc.RotateIfDue())
+		assert.Equal(t, 0, settled)
+
+		oldKey, err := crypto.LoadPrivateKey(keyPath)
+		require.NoError(t, err)
+		require.NoError(t, crypto.SavePrivateKey(oldKey, crypto.PreviousKeyPath(keyPath)))
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(keyPath, later, later))
+
+		require.NoError(t, svc.RotateIfDue())
+		assert.Equal(t, 1, settled)
+		assert.NoFileExists(t, crypto.PreviousKeyPath(keyPath))
+	})
+
+	t.Run("keeps the previous key when it cannot be settled", func(t *testing.T) {
+		svc, _, keyPath := setupTestService(t, Config{
+			Interval:    24 * time.Hour,
+			AfterRotate: func() error { return errors.New("store busy") },
+		})
+		oldKey, err := crypto.LoadPrivateKey(keyPath)
+		require.NoError(t, err)
+		require.NoError(t, crypto.SavePrivateKey(oldKey, crypto.PreviousKeyPath(keyPath)))
+
+		assert.Error(t, svc.RotateIfDue())
+		assert.FileExists(t, crypto.PreviousKeyPath(keyPath))
+	})
+}
@@ -0,0 +1,162 @@
+package localtaskstore
+
+import (
+	"fmt"
+	"time"
+
+	"hostlink/internal/telemetry"
+
+	"gorm.io/gorm"
+)
+
+// sqliteAutoVacuumIncremental is the PRAGMA auto_vacuum value of a database
+// that frees pages with PRAGMA incremental_vacuum.
+const sqliteAutoVacuumIncremental = 2
+
+// CompactionResult describes one Compact run.
+type CompactionResult struct {
+	ExecutionsPruned int64
+	MessagesPruned   int64
+	Vacuum           string
+	SizeBytes        int64
+	FreePages        int64
+}
+
+// Compact enforces the configured retention and returns freed pages to the
+// file system. Executions are only pruned once they are finished and nothing
+// of theirs is waiting for an ack, so reconnect replay never loses a result.
+func (s *Store) Compact() (CompactionResult, error) {
+	started := time.Now()
+	var result CompactionResult
+
+	swept, err := s.SweepAcked()
+	if err != nil {
+		return result, err
+	}
+	result.MessagesPruned += swept
+
+	pruned, err := s.pruneAckedByCount()
+	if err != nil {
+		return result, err
+	}
+	result.MessagesPruned += pruned
+
+	executions, messages, err := s.pruneFinishedExecutions(time.Now().UTC())
+	if err != nil {
+		return result, err
+	}
+	result.ExecutionsPruned = executions
+	result.MessagesPruned += messages
+
+	if result.Vacuum, err = s.vacuum(); err != nil {
+		return result, err
+	}
+	if result.SizeBytes, result.FreePages, err = s.fileStats(); err != nil {
+		return result, err
+	}
+
+	fields := map[string]any{"vacuum": result.Vacuum}
+	telemetry.Metric("hostlink.local_store.compaction.executions_pruned", result.ExecutionsPruned, fields)
+	telemetry.Metric("hostlink.local_store.compaction.messages_pruned", result.MessagesPruned, fields)
+	telemetry.Metric("hostlink.local_store.compaction.duration_ms", time.Since(started).Milliseconds(), fields)
+	telemetry.Metric("hostlink.local_store.file.size_bytes", result.SizeBytes, map[string]any{})
+	telemetry.Metric("hostlink.local_store.file.free_pages", result.FreePages, map[string]any{})
+	return result, nil
+}
+
+// pruneAckedByCount keeps the MaxAckedMessages most recently acknowledged
+// messages.
+func (s *Store) pruneAckedByCount() (int64, error) {
+	if s.maxAckedMessages <= 0 {
+		return 0, nil
+	}
+	keep := s.db.Model(&outboxMessageRecord{}).Select("id").
+		Where("acked_at IS NOT NULL").Order("acked_at DESC, id DESC").Limit(s.maxAckedMessages)
+	result := s.db.Where("acked_at IS NOT NULL AND id NOT IN (?)", keep).Delete(&outboxMessageRecord{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("prune acked messages: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// pruneFinishedExecutions removes finished executions older than the
+// execution retention or beyond the newest MaxFinishedExecutions, together
+// with their acknowledged messages.
+func (s *Store) pruneFinishedExecutions(now time.Time) (int64, int64, error) {
+	if s.executionRetention <= 0 && s.maxFinishedExecutions <= 0 {
+		return 0, 0, nil
+	}
+	var candidates []taskExecutionRecord
+	err := s.db.Where("status IN ?", []string{TaskStatusFinal, TaskStatusInterrupted}).
+		Where("NOT EXISTS (SELECT 1 FROM local_task_outbox_messages m WHERE m.task_id = local_task_executions.task_id AND m.execution_attempt_id = local_task_executions.execution_attempt_id AND m.acked_at IS NULL)").
+		Order("updated_at DESC, id DESC").Find(&candidates).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("load finished executions: %w", err)
+	}
+
+	var expired []taskExecutionRecord
+	for i, record := range candidates {
+		tooOld := s.executionRetention > 0 && now.Sub(record.UpdatedAt) > s.executionRetention
+		tooMany := s.maxFinishedExecutions > 0 && i >= s.maxFinishedExecutions
+		if tooOld || tooMany {
+			expired = append(expired, record)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, 0, nil
+	}
+
+	var executions, messages int64
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, record := range expired {
+			result := tx.Where("task_id = ? AND execution_attempt_id = ?", record.TaskID, record.ExecutionAttemptID).Delete(&outboxMessageRecord{})
+			if result.Error != nil {
+				return result.Error
+			}
+			messages += result.RowsAffected
+			if err := tx.Delete(&taskExecutionRecord{}, record.ID).Error; err != nil {
+				return err
+			}
+			executions++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("prune finished executions: %w", err)
+	}
+	return executions, messages, nil
+}
+
+// vacuum frees unused pages. Stores created with incremental auto-vacuum are
+// trimmed in place; older stores get one full VACUUM, which also switches
+// them to incremental mode since every connection requests it.
+func (s *Store) vacuum() (string, error) {
+	var mode int
+	if err := s.db.Raw("PRAGMA auto_vacuum").Scan(&mode).Error; err != nil {
+		return "", fmt.Errorf("read auto_vacuum mode: %w", err)
+	}
+	if mode == sqliteAutoVacuumIncremental {
+		if err := s.db.Exec("PRAGMA incremental_vacuum").Error; err != nil {
+			return "", fmt.Errorf("incremental vacuum: %w", err)
+		}
+		return "incremental", nil
+	}
+	if err := s.db.Exec("VACUUM").Error; err != nil {
+		return "", fmt.Errorf("vacuum: %w", err)
+	}
+	return "full", nil
+}
+
+func (s *Store) fileStats() (int64, int64, error) {
+	var pageCount, pageSize, freePages int64
+	if err := s.db.Raw("PRAGMA page_count").Scan(&pageCount).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := s.db.Raw("PRAGMA page_size").Scan(&pageSize).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := s.db.Raw("PRAGMA freelist_count").Scan(&freePages).Error; err != nil {
+		return 0, 0, err
+	}
+	return pageCount * pageSize, freePages, nil
+}
@@ -0,0 +1,116 @@
+package localtaskstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactPrunesFinishedExecutionsByAgeAndCount(t *testing.T) {
+	store, err := New(Config{
+		Path:                  filepath.Join(t.TempDir(), "task_store.db"),
+		SpoolCapBytes:         1024 * 1024,
+		TerminalReserveBytes:  1024,
+		ExecutionRetention:    time.Hour,
+		MaxFinishedExecutions: 2,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	for i := 1; i <= 4; i++ {
+		recordAckedFinal(t, store, fmt.Sprintf("task-%d", i))
+	}
+	require.NoError(t, store.RecordFinal(FinalResult{
+		MessageID: "msg-final-pending", TaskID: "task-pending", ExecutionAttemptID: "attempt-1",
+		Status: "completed", Payload: `{"status":"completed"}`,
+	}))
+	_, err = store.RecordReceived(TaskReceipt{TaskID: "task-running", ExecutionAttemptID: "attempt-1"})
+	require.NoError(t, err)
+	require.NoError(t, store.RecordStarted("task-running", "attempt-1"))
+
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	require.NoError(t, store.db.Model(&taskExecutionRecord{}).
+		Where("task_id IN ?", []string{"task-1", "task-pending", "task-running"}).UpdateColumn("updated_at", old).Error)
+
+	result, err := store.Compact()
+	require.NoError(t, err)
+	require.EqualValues(t, 2, result.ExecutionsPruned)
+	require.EqualValues(t, 2, result.MessagesPruned)
+
+	var remaining []string
+	require.NoError(t, store.db.Model(&taskExecutionRecord{}).Order("task_id ASC").Pluck("task_id", &remaining).Error)
+	require.Equal(t, []string{"task-3", "task-4", "task-pending", "task-running"}, remaining)
+
+	messages, err := store.UnackedMessages()
+	require.NoError(t, err)
+	require.Equal(t, []string{"msg-final-pending"}, messageIDs(messages))
+}
+
+func TestCompactKeepsNewestAckedMessages(t *testing.T) {
+	store, err := New(Config{
+		Path:                 filepath.Join(t.TempDir(), "task_store.db"),
+		SpoolCapBytes:        1024 * 1024,
+		TerminalReserveBytes: 1024,
+		MaxAckedMessages:     2,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	for i := 1; i <= 4; i++ {
+		messageID := fmt.Sprintf("msg-%d", i)
+		appendChunk(t, store, messageID, "task-1", int64(i), "out")
+		require.NoError(t, store.AckMessage(messageID))
+		require.NoError(t, store.db.Model(&outboxMessageRecord{}).Where("message_id = ?", messageID).
+			Update("acked_at", time.Now().UTC().Add(time.Duration(i)*time.Second)).Error)
+	}
+	appendChunk(t, store, "msg-unacked", "task-1", 5, "pending")
+
+	result, err := store.Compact()
+	require.NoError(t, err)
+	require.EqualValues(t, 2, result.MessagesPruned)
+
+	messages, err := store.StoredMessages("")
+	require.NoError(t, err)
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.MessageID)
+	}
+	require.Equal(t, []string{"msg-3", "msg-4", "msg-unacked"}, ids)
+}
+
+func TestCompactVacuumsAndEmitsTelemetry(t *testing.T) {
+	telemetryPath := filepath.Join(t.TempDir(), "hostlink-store-telemetry.jsonl")
+	t.Setenv("HOSTLINK_WS_TELEMETRY_PATH", telemetryPath)
+	store := newTestStore(t, 1024*1024, 1024)
+
+	var mode int
+	require.NoError(t, store.db.Raw("PRAGMA auto_vacuum").Scan(&mode).Error)
+	require.Equal(t, sqliteAutoVacuumIncremental, mode)
+
+	result, err := store.Compact()
+	require.NoError(t, err)
+	require.Equal(t, "incremental", result.Vacuum)
+	require.Positive(t, result.SizeBytes)
+
+	entries := readTelemetryEntries(t, telemetryPath)
+	require.NotNil(t, findTelemetryEntry(entries, func(entry map[string]any) bool {
+		return entry["metric_name"] == "hostlink.local_store.compaction.executions_pruned"
+	}))
+	require.NotNil(t, findTelemetryEntry(entries, func(entry map[string]any) bool {
+		return entry["metric_name"] == "hostlink.local_store.file.size_bytes"
+	}))
+}
+
+func recordAckedFinal(t *testing.T, store *Store, taskID string) {
+	t.Helper()
+
+	messageID := "msg-final-" + taskID
+	require.NoError(t, store.RecordFinal(FinalResult{
+		MessageID: messageID, TaskID: taskID, ExecutionAttemptID: "attempt-1",
+		Status: "completed", Payload: `{"status":"completed"}`,
+	}))
+	require.NoError(t, store.AckMessage(messageID))
+}
@@ -0,0 +1,370 @@
+package localtaskstore
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"hostlink/config/appconf"
+	"hostlink/internal/crypto"
+	"hostlink/internal/telemetry"
+
+	"gorm.io/gorm"
+)
+
+// ErrStoreEncrypted is returned when an encrypted store is opened without a
+// key wrapper.
+var ErrStoreEncrypted = errors.New("local task store is encrypted but no key is configured")
+
+const (
+	encryptedPayloadPrefix = "enc:v1:"
+	reencryptBatchSize     = 500
+)
+
+// KeyWrapper protects the data key that encrypts payloads at rest. The
+// wrapped form is stored next to the data it protects.
+type KeyWrapper interface {
+	Wrap(dataKey []byte) (string, error)
+	Unwrap(wrapped string) ([]byte, error)
+}
+
+type agentKeyWrapper struct {
+	privateKeyPath string
+}
+
+// NewAgentKeyWrapper wraps data keys under the agent's key: RSA-OAEP for RSA
+// keys, a sealed box for Ed25519 and ECDSA keys. The key is read on every
+// call, so a rotated agent key is used as soon as it is in place; keys
+// wrapped before the rotation unwrap with the previous key until
+// RotateDataKey wraps a new one.
+func NewAgentKeyWrapper(privateKeyPath string) (KeyWrapper, error) {
+	if _, err := crypto.LoadKey(privateKeyPath); err != nil {
+		return nil, fmt.Errorf("load store wrapping key: %w", err)
+	}
+	return agentKeyWrapper{privateKeyPath: privateKeyPath}, nil
+}
+
+func (w agentKeyWrapper) Wrap(dataKey []byte) (string, error) {
+	privateKey, err := crypto.LoadKey(w.privateKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("load store wrapping key: %w", err)
+	}
+	return crypto.EncryptForKey(string(dataKey), privateKey.Public())
+}
+
+func (w agentKeyWrapper) Unwrap(wrapped string) ([]byte, error) {
+	privateKey, err := crypto.LoadKey(w.privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load store wrapping key: %w", err)
+	}
+	dataKey, err := crypto.DecryptWithKey(wrapped, privateKey)
+	if err != nil {
+		previousKey, loadErr := crypto.LoadKey(crypto.PreviousKeyPath(w.privateKeyPath))
+		if loadErr != nil {
+			return nil, err
+		}
+		if dataKey, err = crypto.DecryptWithKey(wrapped, previousKey); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(dataKey), nil
+}
+
+type fileKeyWrapper struct {
+	key []byte
+}
+
+// NewFileKeyWrapper wraps data keys with AES-GCM under a 256-bit key read
+// from keyPath.
+func NewFileKeyWrapper(keyPath string) (KeyWrapper, error) {
+	key, err := crypto.LoadSymmetricKey(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load store wrapping key: %w", err)
+	}
+	return fileKeyWrapper{key: key}, nil
+}
+
+func (w fileKeyWrapper) Wrap(dataKey []byte) (string, error) {
+	sealed, err := crypto.SealAESGCM(w.key, dataKey, []byte(dataKeyRecord{}.TableName()))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (w fileKeyWrapper) Unwrap(wrapped string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("decode wrapped key: %w", err)
+	}
+	return crypto.OpenAESGCM(w.key, sealed, []byte(dataKeyRecord{}.TableName()))
+}
+
+// DefaultKeyWrapper returns the wrapper selected by appconf, or nil when
+// encryption at rest is off.
+func DefaultKeyWrapper() (KeyWrapper, error) {
+	switch appconf.LocalTaskStoreEncryption() {
+	case "agent-key":
+		return NewAgentKeyWrapper(appconf.AgentPrivateKeyPath())
+	case "key-file":
+		return NewFileKeyWrapper(appconf.LocalTaskStoreKeyFile())
+	default:
+		return nil, nil
+	}
+}
+
+type dataKeyRecord struct {
+	ID         uint   `gorm:"primaryKey"`
+	KeyID      string `gorm:"uniqueIndex"`
+	WrappedKey string
+	Active     bool
+	CreatedAt  time.Time
+}
+
+func (dataKeyRecord) TableName() string {
+	return "local_task_store_keys"
+}
+
+// keyring caches unwrapped data keys by ID. activeID names the key new
+// payloads are sealed with.
+type keyring struct {
+	mu       sync.Mutex
+	wrapper  KeyWrapper
+	activeID string
+	keys     map[string][]byte
+}
+
+// initEncryption loads or creates the active data key, rotates it when it is
+// older than rotateAfter and encrypts any payloads still stored in cleartext.
+func (s *Store) initEncryption(wrapper KeyWrapper, rotateAfter time.Duration) error {
+	if wrapper == nil {
+		return s.requirePlaintextStore()
+	}
+	s.keys = &keyring{wrapper: wrapper, keys: make(map[string][]byte)}
+
+	var active []dataKeyRecord
+	if err := s.db.Where("active = ?", true).Order("id DESC").Limit(1).Find(&active).Error; err != nil {
+		return fmt.Errorf("load store data key: %w", err)
+	}
+	if len(active) == 0 {
+		return s.RotateDataKey()
+	}
+	if _, err := s.dataKey(active[0].KeyID); err != nil {
+		return err
+	}
+	s.keys.activeID = active[0].KeyID
+	if rotateAfter > 0 && time.Since(active[0].CreatedAt) >= rotateAfter {
+		return s.RotateDataKey()
+	}
+	return s.reencryptPayloads(func(payload string) bool {
+		return !strings.HasPrefix(payload, encryptedPayloadPrefix)
+	})
+}
+
+// initReadOnlyEncryption prepares a store opened for inspection to decrypt
+// payloads without writing anything.
+func (s *Store) initReadOnlyEncryption(wrapper KeyWrapper) error {
+	if wrapper == nil {
+		return s.requirePlaintextStore()
+	}
+	s.keys = &keyring{wrapper: wrapper, keys: make(map[string][]byte)}
+	return nil
+}
+
+func (s *Store) requirePlaintextStore() error {
+	if !s.db.Migrator().HasTable(&dataKeyRecord{}) {
+		return nil
+	}
+	var count int64
+	if err := s.db.Model(&dataKeyRecord{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("check store encryption: %w", err)
+	}
+	if count > 0 {
+		return ErrStoreEncrypted
+	}
+	return nil
+}
+
+// RotateDataKey replaces the active data key, re-encrypts every payload with
+// it and deletes the keys it supersedes.
+func (s *Store) RotateDataKey() error {
+	if s.keys == nil {
+		return fmt.Errorf("local task store encryption is not configured")
+	}
+	dataKey, err := crypto.GenerateDataKey()
+	if err != nil {
+		return err
+	}
+	wrapped, err := s.keys.wrapper.Wrap(dataKey)
+	if err != nil {
+		return fmt.Errorf("wrap store data key: %w", err)
+	}
+	keyID := fmt.Sprintf("k%d", time.Now().UnixNano())
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&dataKeyRecord{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Create(&dataKeyRecord{KeyID: keyID, WrappedKey: wrapped, Active: true}).Error
+	}); err != nil {
+		return fmt.Errorf("store data key: %w", err)
+	}
+
+	s.keys.mu.Lock()
+	s.keys.keys[keyID] = dataKey
+	s.keys.activeID = keyID
+	s.keys.mu.Unlock()
+
+	prefix := encryptedPayloadPrefix + keyID + ":"
+	if err := s.reencryptPayloads(func(payload string) bool {
+		return !strings.HasPrefix(payload, prefix)
+	}); err != nil {
+		return err
+	}
+	if err := s.db.Where("key_id <> ?", keyID).Delete(&dataKeyRecord{}).Error; err != nil {
+		return fmt.Errorf("delete superseded data keys: %w", err)
+	}
+	telemetry.Event("hostlink.local_store.data_key.rotated", map[string]any{"key_id": keyID})
+	return nil
+}
+
+// reencryptPayloads seals, under the active key, every payload for which
+// needsSealing reports true, in batches so large spools do not hold one long
+// write transaction.
+func (s *Store) reencryptPayloads(needsSealing func(payload string) bool) error {
+	var lastID uint
+	for {
+		var records []outboxMessageRecord
+		if err := s.db.Where("id > ?", lastID).Order("id ASC").Limit(reencryptBatchSize).Find(&records).Error; err != nil {
+			return fmt.Errorf("load payloads to encrypt: %w", err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			for _, record := range records {
+				if !needsSealing(record.Payload) {
+					continue
+				}
+				plaintext, err := s.openPayload(record.MessageID, record.Payload)
+				if err != nil {
+					return err
+				}
+				sealed, err := s.sealPayload(record.MessageID, plaintext)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(&outboxMessageRecord{}).Where("id = ?", record.ID).Update("payload", sealed).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("encrypt stored payloads: %w", err)
+		}
+		lastID = records[len(records)-1].ID
+	}
+}
+
+// sealPayload encrypts a payload for storage, bound to its message ID so
+// ciphertexts cannot be swapped between rows.
+func (s *Store) sealPayload(messageID, plaintext string) (string, error) {
+	if s.keys == nil {
+		return plaintext, nil
+	}
+	s.keys.mu.Lock()
+	keyID := s.keys.activeID
+	s.keys.mu.Unlock()
+	dataKey, err := s.dataKey(keyID)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := crypto.SealAESGCM(dataKey, []byte(plaintext), []byte(messageID))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPayloadPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openPayload returns the cleartext of a stored payload. Payloads written
+// before encryption was enabled are returned as they are.
+func (s *Store) openPayload(messageID, stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPayloadPrefix) {
+		return stored, nil
+	}
+	if s.keys == nil {
+		return "", ErrStoreEncrypted
+	}
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(stored, encryptedPayloadPrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted payload for message %s", messageID)
+	}
+	dataKey, err := s.dataKey(keyID)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decode payload for message %s: %w", messageID, err)
+	}
+	plaintext, err := crypto.OpenAESGCM(dataKey, sealed, []byte(messageID))
+	if err != nil {
+		return "", fmt.Errorf("decrypt payload for message %s: %w", messageID, err)
+	}
+	return string(plaintext), nil
+}
+
+// openRecords decrypts the payloads of records in place.
+func (s *Store) openRecords(records []outboxMessageRecord) error {
+	for i := range records {
+		plaintext, err := s.openPayload(records[i].MessageID, records[i].Payload)
+		if err != nil {
+			return err
+		}
+		records[i].Payload = plaintext
+	}
+	return nil
+}
+
+func (s *Store) dataKey(keyID string) ([]byte, error) {
+	s.keys.mu.Lock()
+	defer s.keys.mu.Unlock()
+	if key, ok := s.keys.keys[keyID]; ok {
+		return key, nil
+	}
+	var records []dataKeyRecord
+	if err := s.db.Where("key_id = ?", keyID).Limit(1).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("load data key %s: %w", keyID, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("data key %s not found", keyID)
+	}
+	key, err := s.keys.wrapper.Unwrap(records[0].WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key %s: %w", keyID, err)
+	}
+	s.keys.keys[keyID] = key
+	return key, nil
+}
+
+// SweepAcked deletes messages acknowledged longer ago than the configured
+// retention. The connection runs with secure_delete, so SQLite overwrites the
+// freed content instead of leaving it in free pages.
+func (s *Store) SweepAcked() (int64, error) {
+	if s.ackedRetention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().Add(-s.ackedRetention)
+	result := s.db.Where("acked_at IS NOT NULL AND acked_at < ?", cutoff).Delete(&outboxMessageRecord{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("sweep acked messages: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		telemetry.Metric("hostlink.local_store.outbox.swept_messages", result.RowsAffected, map[string]any{})
+	}
+	return result.RowsAffected, nil
+}
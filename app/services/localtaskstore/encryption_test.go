@@ -0,0 +1,191 @@
+package localtaskstore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hostlink/internal/crypto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedStoreKeepsPayloadsOutOfCleartext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task_store.db")
+	store := openEncryptedTestStore(t, path, newTestKeyWrapper(t), 0)
+
+	appendChunk(t, store, "msg-1", "task-1", 1, "password=hunter2")
+
+	raw := rawPayloads(t, store)
+	require.Len(t, raw, 1)
+	require.True(t, strings.HasPrefix(raw[0], encryptedPayloadPrefix))
+	require.NotContains(t, raw[0], "hunter2")
+
+	messages, err := store.UnackedMessages()
+	require.NoError(t, err)
+	require.Equal(t, "password=hunter2", messages[0].Payload)
+}
+
+func TestEncryptionMigratesExistingCleartextStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task_store.db")
+	plain := openTestStore(t, path, 1024*1024, 1024)
+	appendChunk(t, plain, "msg-1", "task-1", 1, "before")
+	require.NoError(t, plain.Close())
+
+	store := openEncryptedTestStore(t, path, newTestKeyWrapper(t), 0)
+
+	raw := rawPayloads(t, store)
+	require.True(t, strings.HasPrefix(raw[0], encryptedPayloadPrefix))
+	message, found, err := store.UnackedMessage("msg-1")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "before", message.Payload)
+}
+
+func TestEncryptedStoreRequiresKeyToOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task_store.db")
+	store := openEncryptedTestStore(t, path, newTestKeyWrapper(t), 0)
+	appendChunk(t, store, "msg-1", "task-1", 1, "secret")
+	require.NoError(t, store.Close())
+
+	_, err := New(Config{Path: path, SpoolCapBytes: 1024 * 1024, TerminalReserveBytes: 1024})
+	require.ErrorIs(t, err, ErrStoreEncrypted)
+
+	_, err = New(Config{Path: path, SpoolCapBytes: 1024 * 1024, TerminalReserveBytes: 1024, KeyWrapper: newTestKeyWrapper(t)})
+	require.Error(t, err)
+}
+
+func TestDataKeyRotatesWhenOlderThanInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task_store.db")
+	wrapper := newTestKeyWrapper(t)
+	store := openEncryptedTestStore(t, path, wrapper, time.Hour)
+	appendChunk(t, store, "msg-1", "task-1", 1, "rotate me")
+	firstKeyID := store.keys.activeID
+	require.NoError(t, store.db.Model(&dataKeyRecord{}).Where("key_id = ?", firstKeyID).
+		Update("created_at", time.Now().Add(-2*time.Hour)).Error)
+	require.NoError(t, store.Close())
+
+	reopened := openEncryptedTestStore(t, path, wrapper, time.Hour)
+
+	require.NotEqual(t, firstKeyID, reopened.keys.activeID)
+	var keys []dataKeyRecord
+	require.NoError(t, reopened.db.Find(&keys).Error)
+	require.Len(t, keys, 1)
+	require.True(t, strings.HasPrefix(rawPayloads(t, reopened)[0], encryptedPayloadPrefix+reopened.keys.activeID+":"))
+	messages, err := reopened.UnackedMessages()
+	require.NoError(t, err)
+	require.Equal(t, "rotate me", messages[0].Payload)
+}
+
+func TestAgentKeyWrapperRoundTrip(t *testing.T) {
+	for _, keyType := range []string{crypto.KeyTypeRSA, crypto.KeyTypeEd25519, crypto.KeyTypeECDSA} {
+		t.Run(keyType, func(t *testing.T) {
+			keyPath := filepath.Join(t.TempDir(), "agent.key")
+			_, err := crypto.LoadOrGenerateKey(keyPath, keyType)
+			require.NoError(t, err)
+			wrapper, err := NewAgentKeyWrapper(keyPath)
+			require.NoError(t, err)
+
+			dataKey, err := crypto.GenerateDataKey()
+			require.NoError(t, err)
+			wrapped, err := wrapper.Wrap(dataKey)
+			require.NoError(t, err)
+			unwrapped, err := wrapper.Unwrap(wrapped)
+			require.NoError(t, err)
+			require.Equal(t, dataKey, unwrapped)
+		})
+	}
+}
+
+func TestAgentKeyWrapperUnwrapsWithPreviousKeyAfterRotation(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	oldKey, err := crypto.LoadOrGenerateKeypair(keyPath, 2048)
+	require.NoError(t, err)
+	wrapper, err := NewAgentKeyWrapper(keyPath)
+	require.NoError(t, err)
+	dataKey, err := crypto.GenerateDataKey()
+	require.NoError(t, err)
+	wrapped, err := wrapper.Wrap(dataKey)
+	require.NoError(t, err)
+
+	// The rotation also moves the agent from RSA to Ed25519
+	require.NoError(t, crypto.SavePrivateKey(oldKey, crypto.PreviousKeyPath(keyPath)))
+	newKey, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+	require.NoError(t, err)
+	require.NoError(t, crypto.SaveKey(newKey, keyPath))
+
+	unwrapped, err := wrapper.Unwrap(wrapped)
+	require.NoError(t, err)
+	require.Equal(t, dataKey, unwrapped)
+
+	rewrapped, err := wrapper.Wrap(dataKey)
+	require.NoError(t, err)
+	plaintext, err := crypto.DecryptWithKey(rewrapped, newKey)
+	require.NoError(t, err)
+	require.Equal(t, string(dataKey), plaintext)
+}
+
+func TestSweepAckedDeletesOnlyExpiredAckedMessages(t *testing.T) {
+	store, err := New(Config{
+		Path:                 filepath.Join(t.TempDir(), "task_store.db"),
+		SpoolCapBytes:        1024 * 1024,
+		TerminalReserveBytes: 1024,
+		AckedRetention:       time.Hour,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	appendChunk(t, store, "msg-expired", "task-1", 1, "old")
+	appendChunk(t, store, "msg-recent", "task-1", 2, "new")
+	appendChunk(t, store, "msg-unacked", "task-1", 3, "pending")
+	require.NoError(t, store.AckMessage("msg-expired"))
+	require.NoError(t, store.AckMessage("msg-recent"))
+	require.NoError(t, store.db.Model(&outboxMessageRecord{}).Where("message_id = ?", "msg-expired").
+		Update("acked_at", time.Now().UTC().Add(-2*time.Hour)).Error)
+
+	swept, err := store.SweepAcked()
+	require.NoError(t, err)
+	require.EqualValues(t, 1, swept)
+
+	messages, err := store.StoredMessages("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"msg-recent", "msg-unacked"}, []string{messages[0].MessageID, messages[1].MessageID})
+
+	var secureDelete int
+	require.NoError(t, store.db.Raw("PRAGMA secure_delete").Scan(&secureDelete).Error)
+	require.Equal(t, 1, secureDelete)
+}
+
+func openEncryptedTestStore(t *testing.T, path string, wrapper KeyWrapper, rotateAfter time.Duration) *Store {
+	t.Helper()
+	store, err := New(Config{
+		Path:                 path,
+		SpoolCapBytes:        1024 * 1024,
+		TerminalReserveBytes: 1024,
+		KeyWrapper:           wrapper,
+		KeyRotationInterval:  rotateAfter,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func newTestKeyWrapper(t *testing.T) KeyWrapper {
+	t.Helper()
+	key, err := crypto.GenerateDataKey()
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "task_store.key")
+	require.NoError(t, os.WriteFile(keyPath, key, 0600))
+	wrapper, err := NewFileKeyWrapper(keyPath)
+	require.NoError(t, err)
+	return wrapper
+}
+
+func rawPayloads(t *testing.T, store *Store) []string {
+	t.Helper()
+	var payloads []string
+	require.NoError(t, store.db.Model(&outboxMessageRecord{}).Order("id ASC").Pluck("payload", &payloads).Error)
+	return payloads
+}
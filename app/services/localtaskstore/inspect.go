@@ -0,0 +1,114 @@
+package localtaskstore
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// StoredMessage is an outbox row as kept on disk, acknowledged or not. Output
+// rotated out of the spool is kept and reported as acknowledged.
+type StoredMessage struct {
+	MessageID          string     `json:"message_id"`
+	TaskID             string     `json:"task_id"`
+	ExecutionAttemptID string     `json:"execution_attempt_id"`
+	Type               string     `json:"type"`
+	Stream             string     `json:"stream,omitempty"`
+	Sequence           int64      `json:"sequence,omitempty"`
+	Payload            string     `json:"payload"`
+	ByteCount          int64      `json:"byte_count"`
+	CreatedAt          time.Time  `json:"created_at"`
+	AckedAt            *time.Time `json:"acked_at,omitempty"`
+}
+
+// OpenReadOnly opens an existing store without migrating it, so it can be
+// inspected while the agent holds the same file open.
+func OpenReadOnly(cfg Config) (*Store, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("local task store path is required")
+	}
+	if _, err := os.Stat(cfg.Path); err != nil {
+		return nil, fmt.Errorf("open local task store: %w", err)
+	}
+	return openInspector(cfg, "ro")
+}
+
+// OpenForMaintenance opens an existing store for writes that are safe to make
+// alongside a running agent, waiting out the agent's locks.
+func OpenForMaintenance(cfg Config) (*Store, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("local task store path is required")
+	}
+	if _, err := os.Stat(cfg.Path); err != nil {
+		return nil, fmt.Errorf("open local task store: %w", err)
+	}
+	return openInspector(cfg, "rw")
+}
+
+func openInspector(cfg Config, mode string) (*Store, error) {
+	dsn := (&url.URL{
+		Scheme:   "file",
+		Opaque:   cfg.Path,
+		RawQuery: "mode=" + mode + "&_pragma=busy_timeout(5000)&_pragma=secure_delete(1)",
+	}).String()
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("open local task store: %w", err)
+	}
+	store := &Store{
+		db:                   db,
+		spoolCapBytes:        cfg.SpoolCapBytes,
+		terminalReserveBytes: cfg.TerminalReserveBytes,
+	}
+	if err := store.initReadOnlyEncryption(cfg.KeyWrapper); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// StoredMessages returns the outbox rows of taskID, or of every task when
+// taskID is empty, in the order they were written.
+func (s *Store) StoredMessages(taskID string) ([]StoredMessage, error) {
+	query := s.db.Order("created_at ASC, id ASC")
+	if taskID != "" {
+		query = query.Where("task_id = ?", taskID)
+	}
+	var records []outboxMessageRecord
+	if err := query.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("load stored messages: %w", err)
+	}
+	if err := s.openRecords(records); err != nil {
+		return nil, err
+	}
+	messages := make([]StoredMessage, 0, len(records))
+	for _, record := range records {
+		messages = append(messages, StoredMessage{
+			MessageID:          record.MessageID,
+			TaskID:             record.TaskID,
+			ExecutionAttemptID: record.ExecutionAttemptID,
+			Type:               record.Type,
+			Stream:             record.Stream,
+			Sequence:           record.Sequence,
+			Payload:            record.Payload,
+			ByteCount:          record.ByteCount,
+			CreatedAt:          record.CreatedAt,
+			AckedAt:            record.AckedAt,
+		})
+	}
+	return messages, nil
+}
+
+// PurgeAcked deletes acknowledged outbox rows and returns how many were
+// removed. Unacknowledged output and finals are never touched.
+func (s *Store) PurgeAcked() (int64, error) {
+	result := s.db.Where("acked_at IS NOT NULL").Delete(&outboxMessageRecord{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("purge acked messages: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
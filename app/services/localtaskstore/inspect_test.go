@@ -0,0 +1,54 @@
+package localtaskstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenReadOnlyReadsWhileWriterIsOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task_store.db")
+	writer := openTestStore(t, path, 1024*1024, 1024)
+	appendChunk(t, writer, "msg-1", "task-1", 1, "hello")
+
+	reader, err := OpenReadOnly(Config{Path: path, SpoolCapBytes: 1024 * 1024})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, reader.Close()) })
+
+	appendChunk(t, writer, "msg-2", "task-1", 2, "world")
+
+	messages, err := reader.StoredMessages("task-1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"msg-1", "msg-2"}, []string{messages[0].MessageID, messages[1].MessageID})
+
+	_, err = reader.PurgeAcked()
+	require.Error(t, err)
+}
+
+func TestOpenReadOnlyRequiresExistingStore(t *testing.T) {
+	_, err := OpenReadOnly(Config{Path: filepath.Join(t.TempDir(), "missing.db")})
+	require.Error(t, err)
+}
+
+func TestPurgeAckedKeepsUnackedMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task_store.db")
+	writer := openTestStore(t, path, 1024*1024, 1024)
+	appendChunk(t, writer, "msg-1", "task-1", 1, "hello")
+	appendChunk(t, writer, "msg-2", "task-1", 2, "world")
+	require.NoError(t, writer.AckMessage("msg-1"))
+
+	maintenance, err := OpenForMaintenance(Config{Path: path})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, maintenance.Close()) })
+
+	purged, err := maintenance.PurgeAcked()
+	require.NoError(t, err)
+	require.EqualValues(t, 1, purged)
+
+	messages, err := writer.StoredMessages("")
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, "msg-2", messages[0].MessageID)
+	require.Nil(t, messages[0].AckedAt)
+}
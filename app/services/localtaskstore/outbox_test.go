@@ -1,6 +1,7 @@
 package localtaskstore
 
 import (
+	"fmt"
 	"hostlink/internal/telemetry/telemetrytest"
 	"path/filepath"
 	"testing"
@@ -125,3 +126,66 @@ func TestOutboxMetricsTrackPendingMessagesBytesAndFinals(t *testing.T) {
 	require.Equal(t, "task-1", pendingBytes["task_id"])
 	require.Equal(t, "task-1", pendingFinals["task_id"])
 }
+
+func TestAckOutputRangesAcksOnlyCoveredChunks(t *testing.T) {
+	store := newTestStore(t, 1024*1024, 1024)
+
+	for _, stream := range []string{"stdout", "stderr"} {
+		for seq := int64(1); seq <= 4; seq++ {
+			require.NoError(t, store.AppendOutputChunk(OutputChunk{
+				MessageID:          fmt.Sprintf("msg-%s-%d", stream, seq),
+				TaskID:             "task-1",
+				ExecutionAttemptID: "attempt-1",
+				Stream:             stream,
+				Sequence:           seq,
+				Payload:            "x",
+				ByteCount:          1,
+			}))
+		}
+	}
+
+	acked, err := store.AckOutputRanges([]OutputRange{
+		{TaskID: "task-1", ExecutionAttemptID: "attempt-1", Stream: "stdout", FirstSequence: 1, LastSequence: 3},
+		{TaskID: "task-1", ExecutionAttemptID: "attempt-1", Stream: "stderr", FirstSequence: 2, LastSequence: 2},
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 4, acked)
+
+	messages, err := store.UnackedMessages()
+	require.NoError(t, err)
+	ids := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.MessageID)
+	}
+	require.ElementsMatch(t, []string{"msg-stdout-4", "msg-stderr-1", "msg-stderr-3", "msg-stderr-4"}, ids)
+
+	acked, err = store.AckOutputRanges([]OutputRange{
+		{TaskID: "task-1", ExecutionAttemptID: "attempt-1", Stream: "stdout", FirstSequence: 1, LastSequence: 3},
+	})
+	require.NoError(t, err)
+	require.Zero(t, acked)
+}
+
+func TestAckOutputRangesRejectsInvalidRangeWithoutAcking(t *testing.T) {
+	store := newTestStore(t, 1024*1024, 1024)
+
+	require.NoError(t, store.AppendOutputChunk(OutputChunk{
+		MessageID:          "msg-output-1",
+		TaskID:             "task-1",
+		ExecutionAttemptID: "attempt-1",
+		Stream:             "stdout",
+		Sequence:           1,
+		Payload:            "x",
+		ByteCount:          1,
+	}))
+
+	_, err := store.AckOutputRanges([]OutputRange{
+		{TaskID: "task-1", ExecutionAttemptID: "attempt-1", Stream: "stdout", FirstSequence: 1, LastSequence: 1},
+		{TaskID: "task-1", ExecutionAttemptID: "attempt-1", Stream: "stdout", FirstSequence: 3, LastSequence: 2},
+	})
+	require.Error(t, err)
+
+	messages, err := store.UnackedMessages()
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hostlink/internal/crypto"
 	"hostlink/internal/telemetry"
 	"os"
 	"path/filepath"
@@ -111,6 +112,16 @@ type UnackedOutputRange struct {
 	TruncatedLocally   bool
 }
 
+// OutputRange names the output sequences FirstSequence..LastSequence,
+// inclusive, on one stream of an execution attempt.
+type OutputRange struct {
+	TaskID             string
+	ExecutionAttemptID string
+	Stream             string
+	FirstSequence      int64
+	LastSequence       int64
+}
+
 type SpoolStatus struct {
 	BytesUsed        int64
 	ByteCap          int64
@@ -130,6 +141,19 @@ type Config struct {
 	Path                 string
 	SpoolCapBytes        int64
 	TerminalReserveBytes int64
+	// KeyWrapper, when set, encrypts payloads at rest under a data key it
+	// wraps. The data key is replaced once it is KeyRotationInterval old.
+	KeyWrapper          KeyWrapper
+	KeyRotationInterval time.Duration
+	// AckedRetention is how long acknowledged messages are kept before they
+	// are securely deleted. Zero keeps them until purged.
+	AckedRetention time.Duration
+	// ExecutionRetention and MaxFinishedExecutions bound the history of
+	// finished executions; MaxAckedMessages bounds acknowledged messages.
+	// Zero disables a limit. Limits are enforced by Compact.
+	ExecutionRetention    time.Duration
+	MaxFinishedExecutions int
+	MaxAckedMessages      int
 }
 
 type ReceiptStore interface {
@@ -146,6 +170,7 @@ type ResultOutbox interface {
 	UnackedMessages() ([]OutboxMessage, error)
 	UnackedMessage(messageID string) (OutboxMessage, bool, error)
 	AckMessage(messageID string) error
+	AckOutputRanges(ranges []OutputRange) (int64, error)
 	UnackedMessagesFrom(taskID, executionAttemptID, stream string, nextSequence int64) ([]OutboxMessage, error)
 }
 
@@ -155,9 +180,14 @@ type RecoveryStore interface {
 }
 
 type Store struct {
-	db                   *gorm.DB
-	spoolCapBytes        int64
-	terminalReserveBytes int64
+	db                    *gorm.DB
+	spoolCapBytes         int64
+	terminalReserveBytes  int64
+	keys                  *keyring
+	ackedRetention        time.Duration
+	executionRetention    time.Duration
+	maxFinishedExecutions int
+	maxAckedMessages      int
 }
 
 type taskExecutionRecord struct {
@@ -214,30 +244,62 @@ func New(cfg Config) (*Store, error) {
 		return nil, fmt.Errorf("create local task store directory: %w", err)
 	}
 
-	db, err := gorm.Open(sqlite.Open(cfg.Path), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(cfg.Path+"?_pragma=busy_timeout(5000)&_pragma=secure_delete(1)&_pragma=auto_vacuum(2)"), &gorm.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("open local task store: %w", err)
 	}
 
 	store := &Store{
-		db:                   db,
-		spoolCapBytes:        cfg.SpoolCapBytes,
-		terminalReserveBytes: cfg.TerminalReserveBytes,
+		db:                    db,
+		spoolCapBytes:         cfg.SpoolCapBytes,
+		terminalReserveBytes:  cfg.TerminalReserveBytes,
+		ackedRetention:        cfg.AckedRetention,
+		executionRetention:    cfg.ExecutionRetention,
+		maxFinishedExecutions: cfg.MaxFinishedExecutions,
+		maxAckedMessages:      cfg.MaxAckedMessages,
 	}
 	if err := store.migrate(); err != nil {
 		_ = store.Close()
 		return nil, err
 	}
-
+	if err := store.initEncryption(cfg.KeyWrapper, cfg.KeyRotationInterval); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
 	return store, nil
 }
 
 func NewDefault() (*Store, error) {
-	return New(Config{
-		Path:                 appconf.LocalTaskStorePath(),
-		SpoolCapBytes:        appconf.LocalTaskStoreSpoolCapBytes(),
-		TerminalReserveBytes: appconf.LocalTaskStoreTerminalReserveBytes(),
-	})
+	if appconf.LocalTaskStoreEncryption() == "agent-key" {
+		// The store opens before registration, which would otherwise create the key.
+		if _, err := crypto.LoadOrGenerateKey(appconf.AgentPrivateKeyPath(), appconf.AgentKeyType()); err != nil {
+			return nil, fmt.Errorf("load store wrapping key: %w", err)
+		}
+	}
+	cfg, err := DefaultConfig()
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// DefaultConfig returns the store configuration selected by appconf.
+func DefaultConfig() (Config, error) {
+	wrapper, err := DefaultKeyWrapper()
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{
+		Path:                  appconf.LocalTaskStorePath(),
+		SpoolCapBytes:         appconf.LocalTaskStoreSpoolCapBytes(),
+		TerminalReserveBytes:  appconf.LocalTaskStoreTerminalReserveBytes(),
+		KeyWrapper:            wrapper,
+		KeyRotationInterval:   appconf.LocalTaskStoreKeyRotationInterval(),
+		AckedRetention:        appconf.LocalTaskStoreAckedRetention(),
+		ExecutionRetention:    appconf.LocalTaskStoreExecutionRetention(),
+		MaxFinishedExecutions: appconf.LocalTaskStoreMaxFinishedExecutions(),
+		MaxAckedMessages:      appconf.LocalTaskStoreMaxAckedMessages(),
+	}, nil
 }
 
 func (s *Store) Close() error {
@@ -252,7 +314,7 @@ func (s *Store) Close() error {
 }
 
 func (s *Store) migrate() error {
-	if err := s.db.AutoMigrate(&taskExecutionRecord{}, &outboxMessageRecord{}); err != nil {
+	if err := s.db.AutoMigrate(&taskExecutionRecord{}, &outboxMessageRecord{}, &dataKeyRecord{}); err != nil {
 		return fmt.Errorf("migrate local task store: %w", err)
 	}
 	if err := s.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_local_task_executions_attempt ON local_task_executions(task_id, execution_attempt_id)").Error; err != nil {
@@ -343,8 +405,12 @@ func (s *Store) AppendOutputChunk(chunk OutputChunk) error {
 	if err := validateOutputChunk(chunk); err != nil {
 		return err
 	}
+	payload, err := s.sealPayload(chunk.MessageID, chunk.Payload)
+	if err != nil {
+		return err
+	}
 
-	err := s.db.Transaction(func(tx *gorm.DB) error {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
 		if err := s.upsertExecutionState(tx, taskExecutionRecord{
 			TaskID:             chunk.TaskID,
 			ExecutionAttemptID: chunk.ExecutionAttemptID,
@@ -360,7 +426,7 @@ func (s *Store) AppendOutputChunk(chunk OutputChunk) error {
 			Type:               OutboxMessageTypeOutput,
 			Stream:             chunk.Stream,
 			Sequence:           chunk.Sequence,
-			Payload:            chunk.Payload,
+			Payload:            payload,
 			ByteCount:          chunk.ByteCount,
 		}
 		if err := tx.Create(&record).Error; err != nil {
@@ -378,8 +444,12 @@ func (s *Store) RecordFinal(result FinalResult) error {
 	if err := validateFinalResult(result); err != nil {
 		return err
 	}
+	payload, err := s.sealPayload(result.MessageID, result.Payload)
+	if err != nil {
+		return err
+	}
 
-	err := s.db.Transaction(func(tx *gorm.DB) error {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
 		if err := s.rotateChunksForTerminal(tx, int64(len(result.Payload))); err != nil {
 			return err
 		}
@@ -400,7 +470,7 @@ func (s *Store) RecordFinal(result FinalResult) error {
 			TaskID:             result.TaskID,
 			ExecutionAttemptID: result.ExecutionAttemptID,
 			Type:               OutboxMessageTypeFinal,
-			Payload:            result.Payload,
+			Payload:            payload,
 			ByteCount:          int64(len(result.Payload)),
 		}
 		return tx.Create(&record).Error
@@ -528,6 +598,9 @@ func (s *Store) UnackedMessages() ([]OutboxMessage, error) {
 	if err := s.db.Where("acked_at IS NULL").Order("created_at ASC, id ASC").Find(&records).Error; err != nil {
 		return nil, fmt.Errorf("load unacked messages: %w", err)
 	}
+	if err := s.openRecords(records); err != nil {
+		return nil, err
+	}
 
 	messages := make([]OutboxMessage, 0, len(records))
 	for _, record := range records {
@@ -545,6 +618,9 @@ func (s *Store) UnackedMessage(messageID string) (OutboxMessage, bool, error) {
 	if len(records) == 0 {
 		return OutboxMessage{}, false, nil
 	}
+	if err := s.openRecords(records); err != nil {
+		return OutboxMessage{}, false, err
+	}
 	return outboxMessageFromRecord(records[0]), true, nil
 }
 
@@ -560,6 +636,43 @@ func (s *Store) AckMessage(messageID string) error {
 	return nil
 }
 
+// AckOutputRanges acknowledges every unacked output chunk covered by ranges in
+// a single transaction and returns the number of chunks acknowledged.
+func (s *Store) AckOutputRanges(ranges []OutputRange) (int64, error) {
+	if len(ranges) == 0 {
+		return 0, nil
+	}
+	for _, r := range ranges {
+		if r.TaskID == "" || r.ExecutionAttemptID == "" || r.Stream == "" {
+			return 0, fmt.Errorf("task ID, execution attempt ID and stream are required")
+		}
+		if r.FirstSequence < 1 || r.LastSequence < r.FirstSequence {
+			return 0, fmt.Errorf("invalid output range %d-%d", r.FirstSequence, r.LastSequence)
+		}
+	}
+
+	now := time.Now().UTC()
+	var acked int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, r := range ranges {
+			result := tx.Model(&outboxMessageRecord{}).
+				Where("type = ? AND task_id = ? AND execution_attempt_id = ? AND stream = ? AND sequence BETWEEN ? AND ? AND acked_at IS NULL",
+					OutboxMessageTypeOutput, r.TaskID, r.ExecutionAttemptID, r.Stream, r.FirstSequence, r.LastSequence).
+				Update("acked_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			acked += result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ack output ranges: %w", err)
+	}
+	s.emitOutboxMetrics("", "")
+	return acked, nil
+}
+
 func (s *Store) DiscardReceived(taskID, executionAttemptID string) error {
 	return s.db.Where("task_id = ? AND execution_attempt_id = ?", taskID, executionAttemptID).
 		Delete(&taskExecutionRecord{}).Error
@@ -571,6 +684,9 @@ func (s *Store) UnackedMessagesFrom(taskID, executionAttemptID, stream string, n
 		taskID, executionAttemptID, stream, nextSequence).Find(&records).Error; err != nil {
 		return nil, err
 	}
+	if err := s.openRecords(records); err != nil {
+		return nil, err
+	}
 	messages := make([]OutboxMessage, len(records))
 	for i, r := range records {
 		messages[i] = outboxMessageFromRecord(r)
@@ -588,6 +704,9 @@ func (s *Store) Snapshot() (Snapshot, error) {
 	if err := s.db.Where("acked_at IS NULL").Find(&outboxRecords).Error; err != nil {
 		return Snapshot{}, fmt.Errorf("load unacked outbox: %w", err)
 	}
+	if err := s.openRecords(outboxRecords); err != nil {
+		return Snapshot{}, err
+	}
 
 	snapshot := Snapshot{
 		Tasks:              make([]TaskState, 0, len(records)),
@@ -703,12 +822,16 @@ func (s *Store) MarkInterruptedRunningTasks() error {
 			}
 
 			payload := fmt.Sprintf(`{"status":"interrupted","exit_code":-1,"output_truncated":%t,"error_truncated":%t}`, record.OutputTruncated, record.ErrorTruncated)
+			sealed, err := s.sealPayload(messageID, payload)
+			if err != nil {
+				return err
+			}
 			outbox := outboxMessageRecord{
 				MessageID:          messageID,
 				TaskID:             record.TaskID,
 				ExecutionAttemptID: record.ExecutionAttemptID,
 				Type:               OutboxMessageTypeFinal,
-				Payload:            payload,
+				Payload:            sealed,
 				ByteCount:          int64(len(payload)),
 			}
 			if err := tx.Create(&outbox).Error; err != nil {
@@ -138,7 +138,7 @@ func (mp *metricspusher) GetCreds() ([]credential.Credential, error) {
 		return creds, nil
 	}
 
-	privateKey, err := mp.crypto.LoadPrivateKey(mp.privateKeyPath)
+	privateKey, err := mp.crypto.LoadKey(mp.privateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
@@ -149,7 +149,7 @@ func (mp *metricspusher) GetCreds() ([]credential.Credential, error) {
 			continue
 		}
 
-		decPasswd, err := mp.crypto.DecryptWithPrivateKey(encPasswd, privateKey)
+		decPasswd, err := mp.crypto.OpenSecret(encPasswd, privateKey, credential.EnvelopeContext(agentID, creds[i].ID)...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decrypt password for credential %d: %w", i, err)
 		}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"errors"
@@ -183,6 +184,24 @@ func (m *MockCrypto) DecryptWithPrivateKey(ciphertextBase64 string, privateKey *
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockCrypto) LoadKey(keyPath string) (crypto.Signer, error) {
+	args := m.Called(keyPath)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(crypto.Signer), args.Error(1)
+}
+
+func (m *MockCrypto) DecryptWithKey(ciphertextBase64 string, key crypto.Signer) (string, error) {
+	args := m.Called(ciphertextBase64, key)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockCrypto) OpenSecret(ciphertext string, key crypto.Signer, associatedData ...string) (string, error) {
+	args := m.Called(ciphertext, key, associatedData)
+	return args.String(0), args.Error(1)
+}
+
 type MockPgBouncerCollector struct {
 	mock.Mock
 }
@@ -384,8 +403,8 @@ func TestGetCreds_EmptyCredentials(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Empty(t, creds)
-	mocks.crypto.AssertNotCalled(t, "LoadPrivateKey")
-	mocks.crypto.AssertNotCalled(t, "DecryptWithPrivateKey")
+	mocks.crypto.AssertNotCalled(t, "LoadKey")
+	mocks.crypto.AssertNotCalled(t, "OpenSecret")
 }
 
 // GetCreds Tests - Decryption Flow
@@ -398,7 +417,7 @@ func TestGetCreds_PrivateKeyLoadFailure(t *testing.T) {
 		Return([]credential.Credential{
 			{PasswdEnc: "encrypted-password"},
 		}, nil)
-	mocks.crypto.On("LoadPrivateKey", "/test/key/path").
+	mocks.crypto.On("LoadKey", "/test/key/path").
 		Return(nil, expectedErr)
 
 	creds, err := mp.GetCreds()
@@ -418,9 +437,9 @@ func TestGetCreds_DecryptionFailure(t *testing.T) {
 		Return([]credential.Credential{
 			{PasswdEnc: "encrypted-password"},
 		}, nil)
-	mocks.crypto.On("LoadPrivateKey", "/test/key/path").
+	mocks.crypto.On("LoadKey", "/test/key/path").
 		Return(testPrivateKey, nil)
-	mocks.crypto.On("DecryptWithPrivateKey", "encrypted-password", testPrivateKey).
+	mocks.crypto.On("OpenSecret", "encrypted-password", testPrivateKey, mock.Anything).
 		Return("", decryptErr)
 
 	creds, err := mp.GetCreds()
@@ -442,9 +461,9 @@ func TestGetCreds_SkipEmptyPasswdEnc(t *testing.T) {
 			{PasswdEnc: "encrypted-password-2"},
 			{PasswdEnc: ""},
 		}, nil)
-	mocks.crypto.On("LoadPrivateKey", "/test/key/path").
+	mocks.crypto.On("LoadKey", "/test/key/path").
 		Return(testPrivateKey, nil)
-	mocks.crypto.On("DecryptWithPrivateKey", "encrypted-password-2", testPrivateKey).
+	mocks.crypto.On("OpenSecret", "encrypted-password-2", testPrivateKey, mock.Anything).
 		Return(password2, nil)
 
 	creds, err := mp.GetCreds()
@@ -457,7 +476,7 @@ func TestGetCreds_SkipEmptyPasswdEnc(t *testing.T) {
 	assert.Nil(t, creds[2].Password)
 
 	// Verify decryption only called once
-	mocks.crypto.AssertNumberOfCalls(t, "DecryptWithPrivateKey", 1)
+	mocks.crypto.AssertNumberOfCalls(t, "OpenSecret", 1)
 }
 
 func TestGetCreds_Success(t *testing.T) {
@@ -467,11 +486,11 @@ func TestGetCreds_Success(t *testing.T) {
 	mocks.agentstate.On("GetAgentID").Return("agent-123")
 	mocks.apiserver.On("GetMetricsCreds", mock.Anything, "agent-123").
 		Return([]credential.Credential{
-			{PasswdEnc: "encrypted-password"},
+			{ID: "crd_1", PasswdEnc: "encrypted-password"},
 		}, nil)
-	mocks.crypto.On("LoadPrivateKey", "/test/key/path").
+	mocks.crypto.On("LoadKey", "/test/key/path").
 		Return(testPrivateKey, nil)
-	mocks.crypto.On("DecryptWithPrivateKey", "encrypted-password", testPrivateKey).
+	mocks.crypto.On("OpenSecret", "encrypted-password", testPrivateKey, credential.EnvelopeContext("agent-123", "crd_1")).
 		Return(decryptedPassword, nil)
 
 	creds, err := mp.GetCreds()
@@ -498,13 +517,13 @@ func TestGetCreds_MultipleCredentials(t *testing.T) {
 			{PasswdEnc: "enc-pass-2"},
 			{PasswdEnc: "enc-pass-3"},
 		}, nil)
-	mocks.crypto.On("LoadPrivateKey", "/test/key/path").
+	mocks.crypto.On("LoadKey", "/test/key/path").
 		Return(testPrivateKey, nil)
-	mocks.crypto.On("DecryptWithPrivateKey", "enc-pass-1", testPrivateKey).
+	mocks.crypto.On("OpenSecret", "enc-pass-1", testPrivateKey, mock.Anything).
 		Return(password1, nil)
-	mocks.crypto.On("DecryptWithPrivateKey", "enc-pass-2", testPrivateKey).
+	mocks.crypto.On("OpenSecret", "enc-pass-2", testPrivateKey, mock.Anything).
 		Return(password2, nil)
-	mocks.crypto.On("DecryptWithPrivateKey", "enc-pass-3", testPrivateKey).
+	mocks.crypto.On("OpenSecret", "enc-pass-3", testPrivateKey, mock.Anything).
 		Return(password3, nil)
 
 	creds, err := mp.GetCreds()
@@ -515,7 +534,7 @@ func TestGetCreds_MultipleCredentials(t *testing.T) {
 	assert.Equal(t, password2, *creds[1].Password)
 	assert.Equal(t, password3, *creds[2].Password)
 
-	mocks.crypto.AssertNumberOfCalls(t, "DecryptWithPrivateKey", 3)
+	mocks.crypto.AssertNumberOfCalls(t, "OpenSecret", 3)
 }
 
 func TestGetCreds_DecryptionFailureAtSecondCredential(t *testing.T) {
@@ -530,11 +549,11 @@ func TestGetCreds_DecryptionFailureAtSecondCredential(t *testing.T) {
 			{PasswdEnc: "enc-pass-2"},
 			{PasswdEnc: "enc-pass-3"},
 		}, nil)
-	mocks.crypto.On("LoadPrivateKey", "/test/key/path").
+	mocks.crypto.On("LoadKey", "/test/key/path").
 		Return(testPrivateKey, nil)
-	mocks.crypto.On("DecryptWithPrivateKey", "enc-pass-1", testPrivateKey).
+	mocks.crypto.On("OpenSecret", "enc-pass-1", testPrivateKey, mock.Anything).
 		Return(password1, nil)
-	mocks.crypto.On("DecryptWithPrivateKey", "enc-pass-2", testPrivateKey).
+	mocks.crypto.On("OpenSecret", "enc-pass-2", testPrivateKey, mock.Anything).
 		Return("", decryptErr)
 
 	creds, err := mp.GetCreds()
@@ -1,70 +1,186 @@
 package reqauth
 
 import (
+	"bytes"
 	"crypto"
-	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"hostlink/domain/nonce"
+	hlcrypto "hostlink/internal/crypto"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
 )
 
+// Window is how far a request's timestamp may be from the server's clock.
+const Window = 300 * time.Second
+
+// ErrReplayed is returned for a request whose nonce the agent already used.
+var ErrReplayed = errors.New("nonce already used")
+
 type Authenticator struct {
-	publicKey *rsa.PublicKey
+	publicKeys []crypto.PublicKey
+	nonces     nonce.Store
+	minVersion int
 }
 
-func New(publicKey *rsa.PublicKey) *Authenticator {
+// New verifies requests against publicKeys; a request signed with any of
+// them is accepted, so an agent's previous key keeps working while a key
+// rotation overlaps. Keys may be RSA, Ed25519 or ECDSA, as produced by
+// crypto.ParsePublicKeyBase64.
+func New(publicKeys ...crypto.PublicKey) *Authenticator {
 	return &Authenticator{
-		publicKey: publicKey,
+		publicKeys: publicKeys,
+		minVersion: Version1,
 	}
 }
 
+// WithMinVersion rejects requests signed with a version older than version,
+// once every agent signs with it.
+func (a *Authenticator) WithMinVersion(version int) *Authenticator {
+	a.minVersion = version
+	return a
+}
+
+// WithNonceStore rejects requests reusing a nonce the agent already used.
+// Without a store, a signed request can be replayed until its timestamp
+// leaves the window.
+func (a *Authenticator) WithNonceStore(store nonce.Store) *Authenticator {
+	a.nonces = store
+	return a
+}
+
 func (a *Authenticator) Authenticate(r *http.Request) error {
+	_, err := a.AuthenticateKey(r)
+	return err
+}
+
+// AuthenticateKey authenticates r like Authenticate and returns the index,
+// among the keys the authenticator was created with, of the key that
+// verified it.
+func (a *Authenticator) AuthenticateKey(r *http.Request) (int, error) {
 	agentID := r.Header.Get("X-Agent-ID")
 	if agentID == "" {
-		return fmt.Errorf("missing X-Agent-ID header")
+		return 0, fmt.Errorf("missing X-Agent-ID header")
 	}
 
 	timestampStr := r.Header.Get("X-Timestamp")
 	if timestampStr == "" {
-		return fmt.Errorf("missing X-Timestamp header")
+		return 0, fmt.Errorf("missing X-Timestamp header")
 	}
 
 	nonce := r.Header.Get("X-Nonce")
 	if nonce == "" {
-		return fmt.Errorf("missing X-Nonce header")
+		return 0, fmt.Errorf("missing X-Nonce header")
 	}
 
 	signatureStr := r.Header.Get("X-Signature")
 	if signatureStr == "" {
-		return fmt.Errorf("missing X-Signature header")
+		return 0, fmt.Errorf("missing X-Signature header")
 	}
 
 	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
 	if err != nil {
-		return fmt.Errorf("invalid timestamp: %w", err)
+		return 0, fmt.Errorf("invalid timestamp: %w", err)
 	}
 
 	now := time.Now().Unix()
 	diff := now - timestamp
-	if diff > 300 || diff < -300 {
-		return fmt.Errorf("timestamp outside valid window")
+	window := int64(Window / time.Second)
+	if diff > window || diff < -window {
+		return 0, fmt.Errorf("timestamp outside valid window")
 	}
 
 	signature, err := base64.StdEncoding.DecodeString(signatureStr)
 	if err != nil {
-		return fmt.Errorf("invalid signature encoding: %w", err)
+		return 0, fmt.Errorf("invalid signature encoding: %w", err)
 	}
 
-	message := fmt.Sprintf("%s|%d|%s", agentID, timestamp, nonce)
-	hashed := sha256.Sum256([]byte(message))
+	version, err := signatureVersion(r)
+	if err != nil {
+		return 0, err
+	}
+	if version < a.minVersion {
+		return 0, fmt.Errorf("signature version %d is no longer accepted", version)
+	}
 
-	err = rsa.VerifyPSS(a.publicKey, crypto.SHA256, hashed[:], signature, nil)
+	var message string
+	switch version {
+	case Version1:
+		message = MessageV1(agentID, strconv.FormatInt(timestamp, 10), nonce)
+	case Version2:
+		digest, err := bodyDigest(r)
+		if err != nil {
+			return 0, err
+		}
+		message = MessageV2(agentID, strconv.FormatInt(timestamp, 10), nonce, r.Method, r.URL, digest)
+	}
+	key, err := a.verify([]byte(message), signature)
 	if err != nil {
-		return fmt.Errorf("signature verification failed: %w", err)
+		return 0, fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	// Only verified nonces are recorded, so forged requests cannot fill
+	// the store
+	if a.nonces != nil {
+		fresh, err := a.nonces.Remember(r.Context(), agentID, nonce, time.Unix(timestamp, 0))
+		if err != nil {
+			return 0, fmt.Errorf("failed to record nonce: %w", err)
+		}
+		if !fresh {
+			return 0, ErrReplayed
+		}
 	}
 
-	return nil
+	return key, nil
+}
+
+// verify returns the index of the key the signature verifies with.
+func (a *Authenticator) verify(message, signature []byte) (int, error) {
+	err := hlcrypto.ErrVerification
+	for i, publicKey := range a.publicKeys {
+		if err = hlcrypto.Verify(publicKey, message, signature); err == nil {
+			return i, nil
+		}
+	}
+	return 0, err
+}
+
+func signatureVersion(r *http.Request) (int, error) {
+	switch v := r.Header.Get(HeaderSignatureVersion); v {
+	case "", "1":
+		return Version1, nil
+	case "2":
+		return Version2, nil
+	default:
+		return 0, fmt.Errorf("unsupported signature version %q", v)
+	}
+}
+
+// bodyDigest reads the request body, leaving it in place for the handler,
+// and checks it against the X-Content-SHA256 header.
+func bodyDigest(r *http.Request) (string, error) {
+	claimed := r.Header.Get(HeaderContentSHA256)
+	if claimed == "" {
+		return "", fmt.Errorf("missing %s header", HeaderContentSHA256)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to read body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	digest := BodyDigest(body)
+	if claimed != digest {
+		return "", fmt.Errorf("body digest mismatch")
+	}
+	return digest, nil
 }
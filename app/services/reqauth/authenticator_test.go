@@ -6,10 +6,15 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"hostlink/internal/repository/memory"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -130,6 +135,196 @@ func TestAuthenticate(t *testing.T) {
 	})
 }
 
+func TestAuthenticateKey_ReportsVerifyingKey(t *testing.T) {
+	current, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	previous, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	auth := New(&current.PublicKey, &previous.PublicKey)
+
+	for want, privateKey := range []*rsa.PrivateKey{current, previous} {
+		req, err := createSignedRequest(testRequest{}, privateKey)
+		if err != nil {
+			t.Fatalf("Failed to create signed request: %v", err)
+		}
+		key, err := auth.AuthenticateKey(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if key != want {
+			t.Errorf("key = %d, want %d", key, want)
+		}
+	}
+}
+
+func TestAuthenticate_NonceTracking(t *testing.T) {
+	t.Run("rejects a replayed request", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+		auth.WithNonceStore(memory.NewNonceStore(100))
+
+		req, err := createSignedRequest(testRequest{}, privateKey)
+		if err != nil {
+			t.Fatalf("Failed to create signed request: %v", err)
+		}
+		if err := auth.Authenticate(req); err != nil {
+			t.Fatalf("Expected first use to pass, got: %v", err)
+		}
+
+		if err := auth.Authenticate(req); !errors.Is(err, ErrReplayed) {
+			t.Errorf("Expected ErrReplayed for replay, got: %v", err)
+		}
+	})
+
+	t.Run("accepts the same nonce from another agent", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+		auth.WithNonceStore(memory.NewNonceStore(100))
+
+		for _, agentID := range []string{"agt_one", "agt_two"} {
+			req, err := createSignedRequest(testRequest{agentID: agentID, nonce: "shared"}, privateKey)
+			if err != nil {
+				t.Fatalf("Failed to create signed request: %v", err)
+			}
+			if err := auth.Authenticate(req); err != nil {
+				t.Errorf("Expected %s to pass, got: %v", agentID, err)
+			}
+		}
+	})
+
+	t.Run("does not record nonces of forged requests", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+		store := memory.NewNonceStore(100)
+		auth.WithNonceStore(store)
+
+		req, err := createSignedRequest(testRequest{signature: "invalid-signature-base64"}, privateKey)
+		if err != nil {
+			t.Fatalf("Failed to create signed request: %v", err)
+		}
+		auth.Authenticate(req)
+
+		if store.Len() != 0 {
+			t.Errorf("Expected no recorded nonces, got %d", store.Len())
+		}
+	})
+}
+
+func TestAuthenticate_SignatureVersion(t *testing.T) {
+	t.Run("authenticates a version 2 request", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+
+		req := createSignedV2Request(t, privateKey, http.MethodPost, "/api/v1/tasks?b=2&a=1", `{"id":1}`)
+
+		if err := auth.Authenticate(req); err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+		body, _ := io.ReadAll(req.Body)
+		if string(body) != `{"id":1}` {
+			t.Errorf("Expected body to remain readable, got %q", body)
+		}
+	})
+
+	t.Run("rejects a version 2 request moved to another target", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+
+		signed := createSignedV2Request(t, privateKey, http.MethodPost, "/api/v1/tasks", `{"id":1}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/agents", strings.NewReader(`{"id":1}`))
+		req.Header = signed.Header
+
+		if err := auth.Authenticate(req); err == nil {
+			t.Error("Expected error for moved headers, got nil")
+		}
+	})
+
+	t.Run("rejects a body that does not match its digest", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+
+		req := createSignedV2Request(t, privateKey, http.MethodPost, "/api/v1/tasks", `{"id":1}`)
+		req.Body = io.NopCloser(strings.NewReader(`{"id":2}`))
+
+		err := auth.Authenticate(req)
+		if err == nil || !strings.Contains(err.Error(), "body digest mismatch") {
+			t.Errorf("Expected body digest mismatch, got: %v", err)
+		}
+	})
+
+	t.Run("rejects a version 2 request without a digest", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+
+		req := createSignedV2Request(t, privateKey, http.MethodGet, "/api/v1/tasks", "")
+		req.Header.Del(HeaderContentSHA256)
+
+		err := auth.Authenticate(req)
+		if err == nil || !strings.Contains(err.Error(), "missing X-Content-SHA256 header") {
+			t.Errorf("Expected missing digest error, got: %v", err)
+		}
+	})
+
+	t.Run("rejects a version 2 signature presented as version 1", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+
+		req := createSignedV2Request(t, privateKey, http.MethodGet, "/api/v1/tasks", "")
+		req.Header.Del(HeaderSignatureVersion)
+
+		if err := auth.Authenticate(req); err == nil {
+			t.Error("Expected error for downgraded request, got nil")
+		}
+	})
+
+	t.Run("rejects an unsupported version", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+
+		req := createSignedV2Request(t, privateKey, http.MethodGet, "/api/v1/tasks", "")
+		req.Header.Set(HeaderSignatureVersion, "3")
+
+		err := auth.Authenticate(req)
+		if err == nil || !strings.Contains(err.Error(), "unsupported signature version") {
+			t.Errorf("Expected unsupported version error, got: %v", err)
+		}
+	})
+
+	t.Run("rejects version 1 below the minimum version", func(t *testing.T) {
+		auth, privateKey := setupTestAuthenticator(t)
+		auth.WithMinVersion(Version2)
+
+		req, err := createSignedRequest(testRequest{}, privateKey)
+		if err != nil {
+			t.Fatalf("Failed to create signed request: %v", err)
+		}
+		if err := auth.Authenticate(req); err == nil {
+			t.Error("Expected error for version 1 request, got nil")
+		}
+
+		req = createSignedV2Request(t, privateKey, http.MethodGet, "/api/v1/tasks", "")
+		if err := auth.Authenticate(req); err != nil {
+			t.Errorf("Expected version 2 request to pass, got: %v", err)
+		}
+	})
+}
+
+func TestCanonicalTarget(t *testing.T) {
+	for _, tc := range []struct {
+		rawURL string
+		want   string
+	}{
+		{"https://example.com", "/"},
+		{"https://example.com/api/v1/tasks", "/api/v1/tasks"},
+		{"https://example.com/api/v1/tasks?b=2&a=1&a=0", "/api/v1/tasks?a=1&a=0&b=2"},
+		{"https://example.com/a%20b?q=x+y", "/a%20b?q=x+y"},
+		{"https://example.com/a%20b?q=x%20y", "/a%20b?q=x+y"},
+	} {
+		u, err := url.Parse(tc.rawURL)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", tc.rawURL, err)
+		}
+		if got := CanonicalTarget(u); got != tc.want {
+			t.Errorf("CanonicalTarget(%s) = %q, want %q", tc.rawURL, got, tc.want)
+		}
+	}
+}
+
 type testRequest struct {
 	agentID   string
 	timestamp int64
@@ -176,3 +371,25 @@ func createSignedRequest(tr testRequest, privateKey *rsa.PrivateKey) (*http.Requ
 
 	return req, nil
 }
+
+func createSignedV2Request(t *testing.T, privateKey *rsa.PrivateKey, method, target, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	digest := BodyDigest([]byte(body))
+
+	message := MessageV2("agt_test123", timestamp, "test-nonce-v2", method, req.URL, digest)
+	hashed := sha256.Sum256([]byte(message))
+	signature, err := rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, hashed[:], nil)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	req.Header.Set("X-Agent-ID", "agt_test123")
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set("X-Nonce", "test-nonce-v2")
+	req.Header.Set("X-Signature", base64.StdEncoding.EncodeToString(signature))
+	req.Header.Set(HeaderSignatureVersion, "2")
+	req.Header.Set(HeaderContentSHA256, digest)
+	return req
+}
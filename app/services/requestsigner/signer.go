@@ -1,16 +1,19 @@
 package requestsigner
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"hostlink/app/services/agentstate"
+	"hostlink/app/services/reqauth"
 	"hostlink/config/appconf"
-	rsautil "hostlink/internal/crypto"
+	hlcrypto "hostlink/internal/crypto"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
 	"sync"
 	"time"
@@ -19,8 +22,14 @@ import (
 var mu sync.RWMutex
 
 type RequestSigner struct {
-	privateKey *rsa.PrivateKey
+	privateKey crypto.Signer
 	agentID    string
+	version    int
+
+	// keyPath is watched so a rotated key is picked up without a restart
+	keyPath    string
+	keyMu      sync.Mutex
+	keyModTime time.Time
 }
 
 func New(privateKeyPath, agentID string) (*RequestSigner, error) {
@@ -30,15 +39,21 @@ func New(privateKeyPath, agentID string) (*RequestSigner, error) {
 		return nil, fmt.Errorf("agent ID is required")
 	}
 
-	privateKey, err := rsautil.LoadPrivateKey(privateKeyPath)
+	privateKey, err := hlcrypto.LoadKey(privateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
 
-	return &RequestSigner{
+	signer := &RequestSigner{
 		privateKey: privateKey,
 		agentID:    agentID,
-	}, nil
+		version:    appconf.SignatureVersion(),
+		keyPath:    privateKeyPath,
+	}
+	if info, err := os.Stat(privateKeyPath); err == nil {
+		signer.keyModTime = info.ModTime()
+	}
+	return signer, nil
 }
 
 func New2(privateKeyPath, agentStatePath string) (*RequestSigner, error) {
@@ -53,19 +68,38 @@ func New2(privateKeyPath, agentStatePath string) (*RequestSigner, error) {
 		return nil, fmt.Errorf("agent ID is required")
 	}
 
-	privateKey, err := rsautil.LoadPrivateKey(privateKeyPath)
+	privateKey, err := hlcrypto.LoadKey(privateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
 
-	return &RequestSigner{
+	signer := &RequestSigner{
 		privateKey: privateKey,
 		agentID:    agentID,
-	}, nil
+		version:    appconf.SignatureVersion(),
+		keyPath:    privateKeyPath,
+	}
+	if info, err := os.Stat(privateKeyPath); err == nil {
+		signer.keyModTime = info.ModTime()
+	}
+	return signer, nil
+}
+
+// WithVersion signs with the given signature version instead of
+// HOSTLINK_SIGNATURE_VERSION.
+func (s *RequestSigner) WithVersion(version int) *RequestSigner {
+	s.version = version
+	return s
 }
 
+// SignRequest signs req, which must already carry its body.
 func (s *RequestSigner) SignRequest(req *http.Request) error {
-	headers, err := s.SignHeaders()
+	body, err := readBody(req)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	headers, err := s.SignHeaders(req.Method, req.URL, body)
 	if err != nil {
 		return err
 	}
@@ -78,19 +112,29 @@ func (s *RequestSigner) SignRequest(req *http.Request) error {
 	return nil
 }
 
-func (s *RequestSigner) SignHeaders() (http.Header, error) {
+// SignHeaders returns the authentication headers of a request, for callers
+// such as the WebSocket dialer that do not build the *http.Request.
+func (s *RequestSigner) SignHeaders(method string, u *url.URL, body []byte) (http.Header, error) {
 	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
 	nonceValue, err := s.generateNonce()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	signature, err := s.generateSignature(s.agentID, timestamp, nonceValue)
+	headers := http.Header{}
+	var signature string
+	if s.version == reqauth.Version1 {
+		signature, err = s.generateSignature(s.agentID, timestamp, nonceValue)
+	} else {
+		digest := reqauth.BodyDigest(body)
+		headers.Set(reqauth.HeaderSignatureVersion, strconv.Itoa(reqauth.Version2))
+		headers.Set(reqauth.HeaderContentSHA256, digest)
+		signature, err = s.sign(reqauth.MessageV2(s.agentID, timestamp, nonceValue, method, u, digest))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate signature: %w", err)
 	}
 
-	headers := http.Header{}
 	headers.Set("X-Agent-ID", s.agentID)
 	headers.Set("X-Timestamp", timestamp)
 	headers.Set("X-Nonce", nonceValue)
@@ -99,16 +143,58 @@ func (s *RequestSigner) SignHeaders() (http.Header, error) {
 	return headers, nil
 }
 
-func (s *RequestSigner) generateSignature(agentID, timestamp, nonce string) (string, error) {
-	message := fmt.Sprintf("%s|%s|%s", agentID, timestamp, nonce)
-	hashed := sha256.Sum256([]byte(message))
+// readBody returns the body of req without consuming it.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
 
-	signature, err := rsa.SignPSS(rand.Reader, s.privateKey, crypto.SHA256, hashed[:], nil)
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
 	if err != nil {
-		return "", fmt.Errorf("failed to sign message: %w", err)
+		return nil, err
 	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func (s *RequestSigner) generateSignature(agentID, timestamp, nonce string) (string, error) {
+	return s.sign(reqauth.MessageV1(agentID, timestamp, nonce))
+}
 
-	return base64.StdEncoding.EncodeToString(signature), nil
+func (s *RequestSigner) sign(message string) (string, error) {
+	return hlcrypto.SignMessage(message, s.key())
+}
+
+// key returns the private key, reloading it when the key file was replaced
+// since it was loaded, as a key rotation does. A file that cannot be read
+// leaves the loaded key in use.
+func (s *RequestSigner) key() crypto.Signer {
+	s.keyMu.Lock()
+	defer s.keyMu.Unlock()
+
+	if s.keyPath == "" {
+		return s.privateKey
+	}
+	info, err := os.Stat(s.keyPath)
+	if err != nil || info.ModTime().Equal(s.keyModTime) {
+		return s.privateKey
+	}
+	privateKey, err := hlcrypto.LoadKey(s.keyPath)
+	if err != nil {
+		return s.privateKey
+	}
+	s.privateKey = privateKey
+	s.keyModTime = info.ModTime()
+	return privateKey
 }
 
 func (s *RequestSigner) generateNonce() (string, error) {
@@ -9,10 +9,15 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
+	"hostlink/app/services/reqauth"
+	hlcrypto "hostlink/internal/crypto"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -213,13 +218,13 @@ func TestRequestSigner_SignHeaders(t *testing.T) {
 	t.Run("should return required headers for websocket upgrade", func(t *testing.T) {
 		signer := setupTestSigner(t)
 
-		headers, err := signer.SignHeaders()
+		headers, err := signer.SignHeaders(http.MethodGet, mustParseURL(t, "wss://example.com/api/v1/agents/ws"), nil)
 
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
 
-		requiredHeaders := []string{"X-Agent-ID", "X-Timestamp", "X-Nonce", "X-Signature"}
+		requiredHeaders := []string{"X-Agent-ID", "X-Timestamp", "X-Nonce", "X-Signature", "X-Signature-Version", "X-Content-SHA256"}
 		for _, header := range requiredHeaders {
 			if headers.Get(header) == "" {
 				t.Errorf("expected header %s to be set", header)
@@ -232,8 +237,9 @@ func TestRequestSigner_SignHeaders(t *testing.T) {
 
 	t.Run("should produce signature verifiable from returned headers", func(t *testing.T) {
 		signer := setupTestSigner(t)
+		target := mustParseURL(t, "wss://example.com/api/v1/agents/ws")
 
-		headers, err := signer.SignHeaders()
+		headers, err := signer.SignHeaders(http.MethodGet, target, nil)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -243,14 +249,161 @@ func TestRequestSigner_SignHeaders(t *testing.T) {
 			t.Fatalf("expected base64 signature, got %v", err)
 		}
 
+		message := fmt.Sprintf("2\n%s\n%s\n%s\nGET\n/api/v1/agents/ws\n%s",
+			headers.Get("X-Agent-ID"), headers.Get("X-Timestamp"), headers.Get("X-Nonce"), reqauth.BodyDigest(nil))
+		hashed := sha256.Sum256([]byte(message))
+		if err := rsa.VerifyPSS(signer.privateKey.Public().(*rsa.PublicKey), crypto.SHA256, hashed[:], signatureBytes, nil); err != nil {
+			t.Errorf("signature verification failed: %v", err)
+		}
+	})
+
+	t.Run("should sign version 1 when configured", func(t *testing.T) {
+		signer := setupTestSigner(t).WithVersion(reqauth.Version1)
+
+		headers, err := signer.SignHeaders(http.MethodGet, mustParseURL(t, "wss://example.com/api/v1/agents/ws"), nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if headers.Get("X-Signature-Version") != "" || headers.Get("X-Content-SHA256") != "" {
+			t.Errorf("expected no version 2 headers, got %v", headers)
+		}
+		signatureBytes, _ := base64.StdEncoding.DecodeString(headers.Get("X-Signature"))
 		message := fmt.Sprintf("%s|%s|%s", headers.Get("X-Agent-ID"), headers.Get("X-Timestamp"), headers.Get("X-Nonce"))
 		hashed := sha256.Sum256([]byte(message))
-		if err := rsa.VerifyPSS(&signer.privateKey.PublicKey, crypto.SHA256, hashed[:], signatureBytes, nil); err != nil {
+		if err := rsa.VerifyPSS(signer.privateKey.Public().(*rsa.PublicKey), crypto.SHA256, hashed[:], signatureBytes, nil); err != nil {
 			t.Errorf("signature verification failed: %v", err)
 		}
 	})
 }
 
+func TestRequestSigner_SignRequestVerifies(t *testing.T) {
+	t.Run("should be accepted by the server authenticator", func(t *testing.T) {
+		signer := setupTestSigner(t)
+		auth := reqauth.New(signer.privateKey.Public())
+
+		req, err := http.NewRequest(http.MethodPut, "https://example.com/api/v1/tasks/tsk_1?b=2&a=1", strings.NewReader(`{"status":"done"}`))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		if err := signer.SignRequest(req); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if err := auth.Authenticate(req); err != nil {
+			t.Errorf("expected request to authenticate, got %v", err)
+		}
+		body, _ := io.ReadAll(req.Body)
+		if string(body) != `{"status":"done"}` {
+			t.Errorf("expected body to remain readable, got %q", body)
+		}
+	})
+
+	t.Run("should bind the signature to the method, path and body", func(t *testing.T) {
+		signer := setupTestSigner(t)
+		auth := reqauth.New(signer.privateKey.Public())
+
+		tamper := map[string]func(req *http.Request) *http.Request{
+			"method": func(req *http.Request) *http.Request {
+				req.Method = http.MethodDelete
+				return req
+			},
+			"path": func(req *http.Request) *http.Request {
+				req.URL.Path = "/api/v1/tasks/tsk_2"
+				return req
+			},
+			"query": func(req *http.Request) *http.Request {
+				req.URL.RawQuery = "a=2"
+				return req
+			},
+			"body": func(req *http.Request) *http.Request {
+				req.Body = io.NopCloser(strings.NewReader(`{"status":"failed"}`))
+				return req
+			},
+		}
+		for name, apply := range tamper {
+			req, err := http.NewRequest(http.MethodPut, "https://example.com/api/v1/tasks/tsk_1?a=1", strings.NewReader(`{"status":"done"}`))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if err := signer.SignRequest(req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if err := auth.Authenticate(apply(req)); err == nil {
+				t.Errorf("expected tampered %s to be rejected", name)
+			}
+		}
+	})
+
+	t.Run("should read a body without GetBody and restore it", func(t *testing.T) {
+		signer := setupTestSigner(t)
+		auth := reqauth.New(signer.privateKey.Public())
+
+		req, err := http.NewRequest(http.MethodPost, "https://example.com/api/v1/tasks", io.NopCloser(strings.NewReader("payload")))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		if err := signer.SignRequest(req); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if err := auth.Authenticate(req); err != nil {
+			t.Errorf("expected request to authenticate, got %v", err)
+		}
+	})
+}
+
+func TestRequestSigner_ReloadsRotatedKey(t *testing.T) {
+	tempDir := t.TempDir()
+	keyPath := saveTestPrivateKey(t, tempDir, generateTestPrivateKey(t))
+	signer, err := New(keyPath, "test-agent-123")
+	if err != nil {
+		t.Fatalf("failed to create test signer: %v", err)
+	}
+
+	rotatedKey := generateTestPrivateKey(t)
+	saveTestPrivateKey(t, tempDir, rotatedKey)
+	if err := os.Chtimes(keyPath, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("failed to touch key file: %v", err)
+	}
+
+	req := createTestRequest(t, http.MethodGet, "https://example.com/api/v1/tasks")
+	if err := signer.SignRequest(req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := reqauth.New(&rotatedKey.PublicKey).Authenticate(req); err != nil {
+		t.Errorf("expected request signed with the rotated key, got %v", err)
+	}
+}
+
+func TestRequestSigner_KeyTypes(t *testing.T) {
+	for _, keyType := range []string{hlcrypto.KeyTypeEd25519, hlcrypto.KeyTypeECDSA} {
+		t.Run(keyType, func(t *testing.T) {
+			keyPath := filepath.Join(t.TempDir(), "agent.key")
+			privateKey, err := hlcrypto.LoadOrGenerateKey(keyPath, keyType)
+			if err != nil {
+				t.Fatalf("failed to generate key: %v", err)
+			}
+			signer, err := New(keyPath, "test-agent-123")
+			if err != nil {
+				t.Fatalf("failed to create test signer: %v", err)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, "https://example.com/api/v1/tasks", strings.NewReader("payload"))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if err := signer.SignRequest(req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := reqauth.New(privateKey.Public()).Authenticate(req); err != nil {
+				t.Errorf("expected request to authenticate, got %v", err)
+			}
+		})
+	}
+}
+
 func TestRequestSigner_GenerateSignature(t *testing.T) {
 	t.Run("should generate valid RSA-PSS signature", func(t *testing.T) {
 		signer := setupTestSigner(t)
@@ -286,7 +439,7 @@ func TestRequestSigner_GenerateSignature(t *testing.T) {
 		message := fmt.Sprintf("%s|%s|%s", agentID, timestamp, nonce)
 		hashed := sha256.Sum256([]byte(message))
 
-		err = rsa.VerifyPSS(&signer.privateKey.PublicKey, crypto.SHA256, hashed[:], signatureBytes, nil)
+		err = rsa.VerifyPSS(signer.privateKey.Public().(*rsa.PublicKey), crypto.SHA256, hashed[:], signatureBytes, nil)
 		if err != nil {
 			t.Errorf("signature verification with SHA-256 failed: %v", err)
 		}
@@ -308,7 +461,7 @@ func TestRequestSigner_GenerateSignature(t *testing.T) {
 		expectedMessage := "agent-456|9876543210|unique-nonce"
 		hashed := sha256.Sum256([]byte(expectedMessage))
 
-		err = rsa.VerifyPSS(&signer.privateKey.PublicKey, crypto.SHA256, hashed[:], signatureBytes, nil)
+		err = rsa.VerifyPSS(signer.privateKey.Public().(*rsa.PublicKey), crypto.SHA256, hashed[:], signatureBytes, nil)
 		if err != nil {
 			t.Errorf("signature verification failed, message format may be incorrect: %v", err)
 		}
@@ -334,7 +487,7 @@ func TestRequestSigner_GenerateSignature(t *testing.T) {
 		message := fmt.Sprintf("%s|%s|%s", agentID, timestamp, nonce)
 		hashed := sha256.Sum256([]byte(message))
 
-		err = rsa.VerifyPSS(&signer.privateKey.PublicKey, crypto.SHA256, hashed[:], signatureBytes, nil)
+		err = rsa.VerifyPSS(signer.privateKey.Public().(*rsa.PublicKey), crypto.SHA256, hashed[:], signatureBytes, nil)
 		if err != nil {
 			t.Errorf("signature verification failed: %v", err)
 		}
@@ -445,6 +598,17 @@ func generateTestPrivateKey(t *testing.T) *rsa.PrivateKey {
 	return privateKey
 }
 
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+
+	return u
+}
+
 func createTestRequest(t *testing.T, method, url string) *http.Request {
 	t.Helper()
 
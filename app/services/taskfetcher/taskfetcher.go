@@ -8,6 +8,7 @@ import (
 	"hostlink/app/services/requestsigner"
 	"hostlink/config/appconf"
 	"hostlink/domain/task"
+	"hostlink/internal/httpclient"
 	"net/http"
 	"time"
 )
@@ -45,9 +46,7 @@ func New(cfg *Config) (*taskfetcher, error) {
 	}
 
 	return &taskfetcher{
-		client: &http.Client{
-			Timeout: cfg.Timeout,
-		},
+		client:          httpclient.NewClient(cfg.Timeout),
 		signer:          signer,
 		controlPlaneURL: cfg.ControlPlaneURL,
 	}, nil
@@ -8,6 +8,7 @@ import (
 	"hostlink/app/services/agentstate"
 	"hostlink/app/services/requestsigner"
 	"hostlink/config/appconf"
+	"hostlink/internal/httpclient"
 	"net/http"
 	"time"
 )
@@ -16,11 +17,27 @@ type TaskReporter interface {
 	Report(taskID string, result *TaskResult) error
 }
 
+// OutputReporter streams task output to the control plane while the task
+// runs. Streaming is best effort: the final report carries the full output.
+type OutputReporter interface {
+	ReportOutput(taskID string, chunk *OutputChunk) error
+}
+
+// OutputChunk is a piece of one stream of a running task. Sequence counts
+// the chunks of the stream from 1, so the control plane can drop retries.
+type OutputChunk struct {
+	ExecutionAttemptID string `json:"execution_attempt_id,omitempty"`
+	Stream             string `json:"stream"`
+	Sequence           int64  `json:"sequence"`
+	Data               string `json:"data"`
+}
+
 type TaskResult struct {
-	Status   string `json:"status"`
-	Output   string `json:"output"`
-	Error    string `json:"error"`
-	ExitCode int    `json:"exit_code"`
+	Status             string `json:"status"`
+	ExecutionAttemptID string `json:"execution_attempt_id,omitempty"`
+	Output             string `json:"output"`
+	Error              string `json:"error"`
+	ExitCode           int    `json:"exit_code"`
 }
 
 type RetryConfig struct {
@@ -80,9 +97,7 @@ func New(cfg *Config) (*taskreporter, error) {
 	}
 
 	return &taskreporter{
-		client: &http.Client{
-			Timeout: cfg.Timeout,
-		},
+		client:          httpclient.NewClient(cfg.Timeout),
 		signer:          signer,
 		controlPlaneURL: cfg.ControlPlaneURL,
 		retryConfig:     retryConfig,
@@ -153,6 +168,39 @@ func (tr *taskreporter) Report(taskID string, result *TaskResult) error {
 	return lastErr
 }
 
+// ReportOutput sends one output chunk without retrying; a live chunk that
+// is late is worth less than the running task it would hold up.
+func (tr *taskreporter) ReportOutput(taskID string, chunk *OutputChunk) error {
+	jsonData, err := json.Marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("failed to marshal output chunk: %w", err)
+	}
+
+	url := tr.controlPlaneURL + "/api/v1/tasks/" + taskID + "/output"
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if err := tr.signer.SignRequest(req); err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	resp, err := tr.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func min(a, b time.Duration) time.Duration {
 	if a < b {
 		return a
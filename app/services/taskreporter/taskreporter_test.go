@@ -666,3 +666,58 @@ func setupTestReporterWithRetry(t *testing.T, serverURL string, keys *testKeys,
 
 	return reporter
 }
+
+func TestTaskReporter_ReportOutput(t *testing.T) {
+	t.Run("should POST the chunk to the task's output endpoint", func(t *testing.T) {
+		keys := setupTestKeys(t)
+		var capturedRequest *http.Request
+		var captured OutputChunk
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			capturedRequest = r
+			json.NewDecoder(r.Body).Decode(&captured)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		reporter := setupTestReporter(t, server.URL, keys)
+		chunk := &OutputChunk{ExecutionAttemptID: "att_1", Stream: "stdout", Sequence: 2, Data: "hello\n"}
+
+		if err := reporter.ReportOutput("task-123", chunk); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if capturedRequest.Method != "POST" {
+			t.Errorf("expected POST method, got %s", capturedRequest.Method)
+		}
+		if capturedRequest.URL.Path != "/api/v1/tasks/task-123/output" {
+			t.Errorf("unexpected path %s", capturedRequest.URL.Path)
+		}
+		if capturedRequest.Header.Get("X-Signature") == "" {
+			t.Error("expected the request to be signed")
+		}
+		if captured != *chunk {
+			t.Errorf("expected chunk %+v, got %+v", *chunk, captured)
+		}
+	})
+
+	t.Run("should not retry a failed chunk", func(t *testing.T) {
+		keys := setupTestKeys(t)
+		var requests int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		reporter := setupTestReporter(t, server.URL, keys)
+
+		err := reporter.ReportOutput("task-123", &OutputChunk{Stream: "stdout", Sequence: 1, Data: "x"})
+		if err == nil || !strings.Contains(err.Error(), "503") {
+			t.Errorf("expected status error, got %v", err)
+		}
+		if got := atomic.LoadInt32(&requests); got != 1 {
+			t.Errorf("expected 1 request, got %d", got)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+// Package tasksecrets opens the secrets delivered with a task. Values are
+// only ever held in memory, for the task to run with.
+package tasksecrets
+
+import (
+	"fmt"
+
+	"hostlink/app/services/agentstate"
+	"hostlink/config/appconf"
+	"hostlink/domain/secret"
+	"hostlink/domain/task"
+	"hostlink/internal/crypto"
+)
+
+type opener struct {
+	agentstate     agentstate.Operations
+	privateKeyPath string
+}
+
+func New() (*opener, error) {
+	state := agentstate.New(appconf.AgentStatePath())
+	if err := state.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load agent state: %w", err)
+	}
+	return NewWithDependencies(state, appconf.AgentPrivateKeyPath()), nil
+}
+
+func NewWithDependencies(state agentstate.Operations, privateKeyPath string) *opener {
+	return &opener{agentstate: state, privateKeyPath: privateKeyPath}
+}
+
+// Open returns the values of the secrets t uses, by name. Every secret the
+// task references must have been delivered with it. Values sealed before
+// the last key rotation open with the previous key.
+func (o *opener) Open(t task.Task) (map[string]string, error) {
+	names, err := secret.References(t.Command, t.EnvSecrets)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	agentID := o.agentstate.GetAgentID()
+	if agentID == "" {
+		return nil, fmt.Errorf("agent not registered: missing agent ID")
+	}
+
+	delivered := make(map[string]task.Secret, len(t.Secrets))
+	for _, s := range t.Secrets {
+		delivered[s.Name] = s
+	}
+	privateKey, err := crypto.LoadKey(o.privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %w", err)
+	}
+
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		s, ok := delivered[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", secret.ErrSecretNotFound, name)
+		}
+		envelopeContext := secret.EnvelopeContext(agentID, s.ID, s.Name)
+		value, err := crypto.OpenEnvelope(s.ValueEnc, privateKey, envelopeContext...)
+		if err != nil {
+			previousKey, loadErr := crypto.LoadKey(crypto.PreviousKeyPath(o.privateKeyPath))
+			if loadErr != nil {
+				return nil, fmt.Errorf("failed to open secret %s: %w", name, err)
+			}
+			if value, err = crypto.OpenEnvelope(s.ValueEnc, previousKey, envelopeContext...); err != nil {
+				return nil, fmt.Errorf("failed to open secret %s: %w", name, err)
+			}
+		}
+		values[name] = string(value)
+	}
+	return values, nil
+}
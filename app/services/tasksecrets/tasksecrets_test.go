@@ -0,0 +1,97 @@
+package tasksecrets
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"hostlink/domain/secret"
+	"hostlink/domain/task"
+	"hostlink/internal/crypto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAgentState struct{}
+
+func (fakeAgentState) Save() error             { return nil }
+func (fakeAgentState) Load() error             { return nil }
+func (fakeAgentState) SetAgentID(string) error { return nil }
+func (fakeAgentState) Clear() error            { return nil }
+func (fakeAgentState) GetAgentID() string      { return "agt_123" }
+
+func setup(t *testing.T) (*opener, string) {
+	t.Helper()
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	_, err := crypto.LoadOrGenerateKey(keyPath, crypto.KeyTypeEd25519)
+	require.NoError(t, err)
+	return NewWithDependencies(fakeAgentState{}, keyPath), keyPath
+}
+
+func seal(t *testing.T, keyPath, id, name, value string) task.Secret {
+	t.Helper()
+	key, err := crypto.LoadKey(keyPath)
+	require.NoError(t, err)
+	valueEnc, err := crypto.SealEnvelope([]byte(value), key.Public(), secret.EnvelopeContext("agt_123", id, name)...)
+	require.NoError(t, err)
+	return task.Secret{ID: id, Name: name, ValueEnc: valueEnc}
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("opens the secrets the task uses", func(t *testing.T) {
+		o, keyPath := setup(t)
+
+		values, err := o.Open(task.Task{
+			Command:    "psql {{secret:db_password}}",
+			EnvSecrets: []string{"token"},
+			Secrets:    []task.Secret{seal(t, keyPath, "sec_1", "db_password", "hunter2"), seal(t, keyPath, "sec_2", "token", "tok")},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"db_password": "hunter2", "token": "tok"}, values)
+	})
+
+	t.Run("returns nothing for a task without secrets", func(t *testing.T) {
+		o, _ := setup(t)
+
+		values, err := o.Open(task.Task{Command: "echo hello"})
+
+		require.NoError(t, err)
+		assert.Empty(t, values)
+	})
+
+	t.Run("fails when a secret was not delivered", func(t *testing.T) {
+		o, _ := setup(t)
+
+		_, err := o.Open(task.Task{Command: "echo {{secret:token}}"})
+
+		assert.True(t, errors.Is(err, secret.ErrSecretNotFound))
+	})
+
+	t.Run("fails for a value sealed as another secret", func(t *testing.T) {
+		o, keyPath := setup(t)
+		s := seal(t, keyPath, "sec_1", "other", "value")
+		s.Name = "token"
+
+		_, err := o.Open(task.Task{Command: "echo {{secret:token}}", Secrets: []task.Secret{s}})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("opens values sealed for the previous key", func(t *testing.T) {
+		o, keyPath := setup(t)
+		s := seal(t, keyPath, "sec_1", "token", "tok")
+		previous, err := crypto.LoadKey(keyPath)
+		require.NoError(t, err)
+		require.NoError(t, crypto.SaveKey(previous, crypto.PreviousKeyPath(keyPath)))
+		newKey, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+		require.NoError(t, err)
+		require.NoError(t, crypto.SaveKey(newKey, keyPath))
+
+		values, err := o.Open(task.Task{Command: "echo {{secret:token}}", Secrets: []task.Secret{s}})
+
+		require.NoError(t, err)
+		assert.Equal(t, "tok", values["token"])
+	})
+}
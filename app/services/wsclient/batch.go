@@ -0,0 +1,142 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"hostlink/app/services/localtaskstore"
+	"hostlink/internal/telemetry"
+	"hostlink/internal/wsprotocol"
+)
+
+const (
+	defaultOutputBatchMaxMessages = 64
+	defaultOutputBatchMaxBytes    = 64 * 1024
+	defaultOutputBatchInterval    = 50 * time.Millisecond
+)
+
+// sendOutputMessage sends a spooled output chunk, either on its own or, when
+// the session negotiated batching, as part of the next output.batch frame.
+// A batch is flushed once it is full or the batch interval elapses.
+func (c *Client) sendOutputMessage(ctx context.Context, message localtaskstore.OutboxMessage) error {
+	if !c.outputBatchingActive() {
+		return c.sendIfActive(ctx, envelopeFromOutboxMessage(c.agentID, message))
+	}
+
+	c.batchMu.Lock()
+	c.batch = append(c.batch, message)
+	c.batchBytes += message.ByteCount
+	full := len(c.batch) >= c.batchMaxMessages || c.batchBytes >= c.batchMaxBytes
+	if !full && c.batchTimer == nil {
+		c.batchTimer = time.AfterFunc(c.batchInterval, func() {
+			if err := c.flushOutputBatch(context.Background()); err != nil {
+				telemetry.Event("hostlink.agent_ws.output.batch_flush_failed", map[string]any{
+					"agent_id": c.agentID,
+					"error":    err.Error(),
+				})
+			}
+		})
+	}
+	c.batchMu.Unlock()
+
+	if full {
+		return c.flushOutputBatch(ctx)
+	}
+	return nil
+}
+
+// flushOutputBatch writes any pending output as one output.batch frame. It
+// holds batchMu across the write so batches reach the server in order.
+func (c *Client) flushOutputBatch(ctx context.Context) error {
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+	if c.batchTimer != nil {
+		c.batchTimer.Stop()
+		c.batchTimer = nil
+	}
+	if len(c.batch) == 0 {
+		return nil
+	}
+	messages := c.batch
+	bytes := c.batchBytes
+	c.batch, c.batchBytes = nil, 0
+
+	telemetry.Metric("hostlink.agent_ws.output.batch_messages", len(messages), map[string]any{
+		"agent_id": c.agentID,
+		"bytes":    bytes,
+	})
+	return c.sendIfActive(ctx, outputBatchEnvelope(c.agentID, messages))
+}
+
+// resetOutputBatch drops pending output at the start of a session; it is
+// still in the outbox and is replayed by the hello reconciliation.
+func (c *Client) resetOutputBatch() {
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+	if c.batchTimer != nil {
+		c.batchTimer.Stop()
+		c.batchTimer = nil
+	}
+	c.batch, c.batchBytes = nil, 0
+}
+
+func (c *Client) setOutputBatching(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outputBatching = enabled
+}
+
+func (c *Client) outputBatchingActive() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.outputBatching
+}
+
+// ackOutputRanges applies a cumulative range ack to the outbox.
+func (c *Client) ackOutputRanges(ack wsprotocol.AckPayload) error {
+	ranges := make([]localtaskstore.OutputRange, 0, len(ack.AckedRanges))
+	for _, r := range ack.AckedRanges {
+		ranges = append(ranges, localtaskstore.OutputRange{
+			TaskID:             r.TaskID,
+			ExecutionAttemptID: r.ExecutionAttemptID,
+			Stream:             string(r.Stream),
+			FirstSequence:      int64(r.FirstSequence),
+			LastSequence:       int64(r.LastSequence),
+		})
+	}
+	acked, err := c.outbox.AckOutputRanges(ranges)
+	if err != nil {
+		return err
+	}
+	telemetry.Event("hostlink.agent_ws.outbox.ranges_acknowledged", map[string]any{
+		"agent_id":         c.agentID,
+		"acked_message_id": ack.AckedMessageID,
+		"ranges":           len(ranges),
+		"messages":         acked,
+	})
+	return nil
+}
+
+func outputBatchEnvelope(agentID string, messages []localtaskstore.OutboxMessage) wsprotocol.Envelope {
+	payload := wsprotocol.OutputBatchPayload{Chunks: make([]wsprotocol.OutputBatchChunk, 0, len(messages))}
+	for _, message := range messages {
+		payload.Chunks = append(payload.Chunks, wsprotocol.OutputBatchChunk{
+			MessageID:          message.MessageID,
+			TaskID:             message.TaskID,
+			ExecutionAttemptID: message.ExecutionAttemptID,
+			Stream:             wsprotocol.Stream(message.Stream),
+			Sequence:           int(message.Sequence),
+			Data:               message.Payload,
+			ByteCount:          int(message.ByteCount),
+		})
+	}
+	return wsprotocol.Envelope{
+		ProtocolVersion: wsprotocol.ProtocolVersion,
+		MessageID:       fmt.Sprintf("msg_batch_%d", time.Now().UnixNano()),
+		Type:            wsprotocol.TypeOutputBatch,
+		AgentID:         agentID,
+		SentAt:          time.Now().UTC().Format(time.RFC3339),
+		Payload:         payloadFromValue(payload),
+	}
+}
@@ -0,0 +1,125 @@
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hostlink/app/services/localtaskstore"
+	"hostlink/internal/wsprotocol"
+)
+
+func TestClientBatchesOutputWhenSessionNegotiatesBatching(t *testing.T) {
+	client, conn, store := startBatchTestClient(t, true, WithOutputBatching(3, time.Hour))
+	ctx := context.Background()
+
+	for i := int64(1); i <= 3; i++ {
+		requireNoError(t, client.SendOutput(ctx, creditTestChunk(i)))
+	}
+	env := conn.waitForWrite(t)
+	if env.Type != wsprotocol.TypeOutputBatch {
+		t.Fatalf("type = %s, want %s", env.Type, wsprotocol.TypeOutputBatch)
+	}
+	payload, err := wsprotocol.DecodePayload[wsprotocol.OutputBatchPayload](env)
+	requireNoError(t, err)
+	requireNoError(t, payload.Validate())
+	if len(payload.Chunks) != 3 || payload.Chunks[0].MessageID != "msg-output-1" || payload.Chunks[2].Sequence != 3 {
+		t.Fatalf("chunks = %#v", payload.Chunks)
+	}
+
+	conn.readCh <- rangeAckEnvelope(env.MessageID, wsprotocol.BuildOutputAckRanges(payload.Chunks))
+	waitFor(t, func() bool {
+		messages, err := store.UnackedMessages()
+		return err == nil && len(messages) == 0
+	}, "range ack to clear the outbox")
+}
+
+func TestClientFlushesPartialBatchAfterInterval(t *testing.T) {
+	client, conn, _ := startBatchTestClient(t, true, WithOutputBatching(64, 10*time.Millisecond))
+
+	requireNoError(t, client.SendOutput(context.Background(), creditTestChunk(1)))
+	env := conn.waitForWrite(t)
+	payload, err := wsprotocol.DecodePayload[wsprotocol.OutputBatchPayload](env)
+	requireNoError(t, err)
+	if env.Type != wsprotocol.TypeOutputBatch || len(payload.Chunks) != 1 {
+		t.Fatalf("flushed %s with %d chunks", env.Type, len(payload.Chunks))
+	}
+}
+
+func TestClientFlushesBatchBeforeFinal(t *testing.T) {
+	client, conn, _ := startBatchTestClient(t, true, WithOutputBatching(64, time.Hour))
+	ctx := context.Background()
+
+	requireNoError(t, client.SendOutput(ctx, creditTestChunk(1)))
+	requireNoError(t, client.SendFinal(ctx, localtaskstore.FinalResult{
+		MessageID:          "msg-final-1",
+		TaskID:             "task-1",
+		ExecutionAttemptID: "attempt-1",
+		Status:             "completed",
+		Payload:            `{"status":"completed","exit_code":0}`,
+	}))
+	if got := conn.waitForWrite(t); got.Type != wsprotocol.TypeOutputBatch {
+		t.Fatalf("first write = %s, want batch", got.Type)
+	}
+	if got := conn.waitForWrite(t); got.MessageID != "msg-final-1" {
+		t.Fatalf("second write = %#v", got)
+	}
+}
+
+func TestClientSendsIndividualOutputWhenServerDeclinesBatching(t *testing.T) {
+	client, conn, _ := startBatchTestClient(t, false, WithOutputBatching(1, time.Hour))
+
+	requireNoError(t, client.SendOutput(context.Background(), creditTestChunk(1)))
+	if got := conn.waitForWrite(t); got.Type != wsprotocol.TypeTaskOutput {
+		t.Fatalf("type = %s, want %s", got.Type, wsprotocol.TypeTaskOutput)
+	}
+}
+
+func startBatchTestClient(t *testing.T, serverBatching bool, opts ...clientOption) (*Client, *fakeConn, *localtaskstore.Store) {
+	t.Helper()
+	store := newClientTestStore(t)
+	conn := newFakeConn()
+	opts = append([]clientOption{WithResultOutbox(store), WithResultsEnabled(true)}, opts...)
+	client := newTestClient(t, &fakeDialer{conn: conn}, opts...)
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Start(runCtx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	hello := conn.waitForWrite(t)
+	helloPayload, err := wsprotocol.DecodePayload[wsprotocol.HelloPayload](hello)
+	requireNoError(t, err)
+	if !helloPayload.Capabilities.OutputBatching {
+		t.Fatal("hello did not advertise output batching")
+	}
+	conn.readCh <- helloAckEnvelopeWithDirectives(hello.MessageID, wsprotocol.HelloAckPayload{OutputBatchingEnabled: serverBatching})
+	waitFor(t, client.IsActive, "session to become active")
+	return client, conn, store
+}
+
+func WithOutputBatching(maxMessages int, interval time.Duration) clientOption {
+	return func(cfg *Config) {
+		cfg.OutputBatchEnabled = true
+		cfg.OutputBatchMaxMessages = maxMessages
+		cfg.OutputBatchInterval = interval
+	}
+}
+
+func rangeAckEnvelope(ackedMessageID string, ranges []wsprotocol.OutputAckRange) wsprotocol.Envelope {
+	return wsprotocol.Envelope{
+		ProtocolVersion: wsprotocol.ProtocolVersion,
+		MessageID:       "msg_range_ack",
+		Type:            wsprotocol.TypeAck,
+		AgentID:         "agent_ws_test",
+		SentAt:          time.Now().UTC().Format(time.RFC3339),
+		Payload: payloadMapForTest(wsprotocol.BuildAck(wsprotocol.AckOptions{
+			AckedMessageID: ackedMessageID,
+			AckedType:      wsprotocol.TypeOutputBatch,
+			AckedRanges:    ranges,
+		})),
+	}
+}
@@ -2,6 +2,7 @@ package wsclient
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"hostlink/internal/telemetry"
 	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -51,6 +53,7 @@ type Config struct {
 	AgentState          *agentstate.AgentState
 	PrivateKeyPath      string
 	Dialer              Dialer
+	TLSConfig           *tls.Config
 	ReconnectMin        time.Duration
 	ReconnectMax        time.Duration
 	PingInterval        time.Duration
@@ -62,6 +65,13 @@ type Config struct {
 	ResultsEnabled      bool
 	DeliveryEnabled     bool
 	DeliveryCoordinator DeliveryCoordinator
+	// OutputBatchEnabled offers output.batch frames to the server. Batches
+	// are flushed at OutputBatchMaxMessages, OutputBatchMaxBytes or after
+	// OutputBatchInterval, whichever comes first.
+	OutputBatchEnabled     bool
+	OutputBatchMaxMessages int
+	OutputBatchMaxBytes    int64
+	OutputBatchInterval    time.Duration
 }
 
 type Client struct {
@@ -86,6 +96,29 @@ type Client struct {
 	resultsEnabled      bool
 	deliveryEnabled     bool
 	deliveryCoordinator DeliveryCoordinator
+	credit              *outputCredit
+	outputBatchEnabled  bool
+	outputBatching      bool
+	batchMaxMessages    int
+	batchMaxBytes       int64
+	batchInterval       time.Duration
+
+	deferredMu sync.Mutex
+	deferred   []deferredMessage
+
+	batchMu    sync.Mutex
+	batch      []localtaskstore.OutboxMessage
+	batchBytes int64
+	batchTimer *time.Timer
+}
+
+// deferredMessage is an outbox message held back because the output window
+// was exhausted. Only the identifiers are kept; the payload stays in the
+// outbox, where the spool may rotate it away.
+type deferredMessage struct {
+	messageID          string
+	taskID             string
+	executionAttemptID string
 }
 
 func New(cfg Config) (*Client, error) {
@@ -101,7 +134,7 @@ func New(cfg Config) (*Client, error) {
 		return nil, fmt.Errorf("create request signer: %w", err)
 	}
 	if cfg.Dialer == nil {
-		cfg.Dialer = DefaultDialer{}
+		cfg.Dialer = DefaultDialer{TLSConfig: cfg.TLSConfig}
 	}
 	if cfg.ReconnectMin == 0 {
 		cfg.ReconnectMin = time.Second
@@ -115,6 +148,15 @@ func New(cfg Config) (*Client, error) {
 	if cfg.SleepFunc == nil {
 		cfg.SleepFunc = sleepContext
 	}
+	if cfg.OutputBatchMaxMessages <= 0 {
+		cfg.OutputBatchMaxMessages = defaultOutputBatchMaxMessages
+	}
+	if cfg.OutputBatchMaxBytes <= 0 {
+		cfg.OutputBatchMaxBytes = defaultOutputBatchMaxBytes
+	}
+	if cfg.OutputBatchInterval <= 0 {
+		cfg.OutputBatchInterval = defaultOutputBatchInterval
+	}
 
 	return &Client{
 		url:                 cfg.URL,
@@ -132,6 +174,11 @@ func New(cfg Config) (*Client, error) {
 		resultsEnabled:      cfg.ResultsEnabled,
 		deliveryEnabled:     cfg.DeliveryEnabled,
 		deliveryCoordinator: cfg.DeliveryCoordinator,
+		credit:              newOutputCredit(),
+		outputBatchEnabled:  cfg.OutputBatchEnabled,
+		batchMaxMessages:    cfg.OutputBatchMaxMessages,
+		batchMaxBytes:       cfg.OutputBatchMaxBytes,
+		batchInterval:       cfg.OutputBatchInterval,
 	}, nil
 }
 
@@ -185,7 +232,11 @@ func (c *Client) LastAck() *wsprotocol.AckPayload {
 }
 
 func (c *Client) runOnce(ctx context.Context) error {
-	headers, err := c.signer.SignHeaders()
+	target, err := url.Parse(c.url)
+	if err != nil {
+		return fmt.Errorf("parse websocket URL: %w", err)
+	}
+	headers, err := c.signer.SignHeaders(http.MethodGet, target, nil)
 	if err != nil {
 		return err
 	}
@@ -249,10 +300,15 @@ func (c *Client) readLoop(ctx context.Context, conn Conn, helloMessageID string)
 				if err := c.applyHelloAckLocalState(helloAck); err != nil {
 					return err
 				}
+				c.credit.reset(helloAck.OutputCredit)
+				c.clearDeferred()
+				c.resetOutputBatch()
+				c.setOutputBatching(c.outputBatchEnabled && helloAck.OutputBatchingEnabled)
 				c.setActive(true)
 				telemetry.Event("hostlink.agent_ws.session.activated", map[string]any{
 					"agent_id":         c.agentID,
 					"delivery_enabled": c.deliveryEnabled && helloAck.DeliveryEnabled,
+					"output_batching":  c.outputBatchEnabled && helloAck.OutputBatchingEnabled,
 					"acked_message_id": helloAck.AckedMessageID,
 				})
 				telemetry.Metric("hostlink.agent_ws.connections.opened", 1, map[string]any{"agent_id": c.agentID})
@@ -295,7 +351,18 @@ func (c *Client) readLoop(ctx context.Context, conn Conn, helloMessageID string)
 					})
 				}
 			}
+			if c.outbox != nil && len(ack.AckedRanges) > 0 {
+				if err := c.ackOutputRanges(ack); err != nil {
+					return err
+				}
+			}
 			c.setLastAck(&ack)
+			if ack.OutputCredit != nil {
+				c.credit.add(*ack.OutputCredit)
+				if err := c.drainDeferred(ctx); err != nil {
+					return err
+				}
+			}
 		case wsprotocol.TypeError:
 			payload, err := wsprotocol.DecodePayload[wsprotocol.ErrorPayload](env)
 			if err != nil {
@@ -363,12 +430,19 @@ func (c *Client) receiveTaskDeliver(ctx context.Context, conn Conn, env wsprotoc
 		return err
 	}
 	if !previous.Exists && state.Status == localtaskstore.TaskStatusReceived && c.enqueuer != nil {
+		var secrets []task.Secret
+		for _, s := range payload.Secrets {
+			secrets = append(secrets, task.Secret{ID: s.ID, Name: s.Name, ValueEnc: s.ValueEnc})
+		}
 		return c.enqueuer.Enqueue(ctx, task.Task{
 			ID:                 env.TaskID,
 			ExecutionAttemptID: env.ExecutionAttemptID,
 			Command:            payload.Command,
 			Status:             "pending",
 			Priority:           payload.Priority,
+			OutputPolicy:       task.OutputPolicy(payload.OutputPolicy),
+			EnvSecrets:         payload.EnvSecrets,
+			Secrets:            secrets,
 		})
 	}
 	return nil
@@ -405,12 +479,25 @@ func (c *Client) replayTaskFinal(ctx context.Context, conn Conn, taskID, executi
 }
 
 func (c *Client) SendOutput(ctx context.Context, chunk localtaskstore.OutputChunk) error {
+	return c.SendOutputWithPolicy(ctx, chunk, task.OutputPolicyBlock)
+}
+
+// SendOutputWithPolicy sends an output chunk within the server-granted output
+// window. With the block policy it waits for credit before accepting the
+// chunk, which stalls the caller's reads from the process. With drop-oldest
+// the chunk is spooled immediately and held back until credit arrives.
+func (c *Client) SendOutputWithPolicy(ctx context.Context, chunk localtaskstore.OutputChunk, policy task.OutputPolicy) error {
 	if !c.resultsEnabled {
 		return fmt.Errorf("websocket result channel is disabled")
 	}
 	if c.outbox == nil {
 		return fmt.Errorf("result outbox is not configured")
 	}
+	if policy != task.OutputPolicyDropOldest {
+		if err := c.waitForOutputCredit(ctx, chunk); err != nil {
+			return err
+		}
+	}
 	if err := c.outbox.AppendOutputChunk(chunk); err != nil {
 		return err
 	}
@@ -434,7 +521,10 @@ func (c *Client) SendOutput(ctx context.Context, chunk localtaskstore.OutputChun
 		})
 		return nil
 	}
-	if err := c.sendIfActive(ctx, envelopeFromOutboxMessage(c.agentID, message)); err != nil {
+	if policy == task.OutputPolicyDropOldest {
+		return c.sendOrDefer(ctx, message)
+	}
+	if err := c.sendOutputMessage(ctx, message); err != nil {
 		return err
 	}
 	if chaosEnabled("HOSTLINK_WS_CHAOS_DUPLICATE_OUTPUT") {
@@ -453,16 +543,21 @@ func (c *Client) SendFinal(ctx context.Context, result localtaskstore.FinalResul
 	if err := c.outbox.RecordFinal(result); err != nil {
 		return err
 	}
-	err := c.sendIfActive(ctx, envelopeFromOutboxMessage(c.agentID, localtaskstore.OutboxMessage{
+	message := localtaskstore.OutboxMessage{
 		MessageID:          result.MessageID,
 		TaskID:             result.TaskID,
 		ExecutionAttemptID: result.ExecutionAttemptID,
 		Type:               localtaskstore.OutboxMessageTypeFinal,
 		Payload:            result.Payload,
 		ByteCount:          int64(len(result.Payload)),
-	}))
-	if err != nil {
-		return err
+	}
+	if !c.deferBehindOutput(message) {
+		if err := c.flushOutputBatch(ctx); err != nil {
+			return err
+		}
+		if err := c.sendIfActive(ctx, envelopeFromOutboxMessage(c.agentID, message)); err != nil {
+			return err
+		}
 	}
 	if !c.IsActive() {
 		return fmt.Errorf("websocket result channel is inactive")
@@ -533,6 +628,7 @@ func (c *Client) buildHelloPayload() wsprotocol.HelloPayload {
 		Capabilities: wsprotocol.HelloCapabilities{
 			ResultsEnabled:  c.resultsEnabled,
 			DeliveryEnabled: c.deliveryEnabled,
+			OutputBatching:  c.outputBatchEnabled,
 		},
 	}
 	if c.receipts == nil {
@@ -658,6 +754,9 @@ func (c *Client) setActive(active bool) {
 	defer c.mu.Unlock()
 	wasActive := c.active
 	c.active = active
+	if !active {
+		c.credit.suspend()
+	}
 	if wasActive && !active && c.deliveryCoordinator != nil {
 		c.deliveryCoordinator.MarkSessionInactive()
 	}
@@ -827,3 +926,101 @@ func jitter(d time.Duration) time.Duration {
 	}
 	return d - delta + time.Duration(rand.Int64N(int64(delta*2)))
 }
+
+func (c *Client) waitForOutputCredit(ctx context.Context, chunk localtaskstore.OutputChunk) error {
+	if c.credit.tryAcquire(chunk.ByteCount) {
+		return nil
+	}
+	fields := map[string]any{
+		"agent_id":             c.agentID,
+		"task_id":              chunk.TaskID,
+		"execution_attempt_id": chunk.ExecutionAttemptID,
+		"stream":               chunk.Stream,
+	}
+	telemetry.Event("hostlink.agent_ws.output.credit_exhausted", fields)
+	started := time.Now()
+	if err := c.credit.acquire(ctx, chunk.ByteCount); err != nil {
+		return err
+	}
+	telemetry.Metric("hostlink.agent_ws.output.credit_wait_ms", time.Since(started).Milliseconds(), fields)
+	return nil
+}
+
+// sendOrDefer sends an already spooled message if credit allows and nothing
+// is queued ahead of it; otherwise it queues the message for drainDeferred.
+func (c *Client) sendOrDefer(ctx context.Context, message localtaskstore.OutboxMessage) error {
+	c.deferredMu.Lock()
+	defer c.deferredMu.Unlock()
+	if len(c.deferred) == 0 && c.credit.tryAcquire(message.ByteCount) {
+		return c.sendOutputMessage(ctx, message)
+	}
+	c.deferred = append(c.deferred, deferredMessage{
+		messageID:          message.MessageID,
+		taskID:             message.TaskID,
+		executionAttemptID: message.ExecutionAttemptID,
+	})
+	telemetry.Metric("hostlink.agent_ws.output.deferred", len(c.deferred), map[string]any{
+		"agent_id":             c.agentID,
+		"task_id":              message.TaskID,
+		"execution_attempt_id": message.ExecutionAttemptID,
+	})
+	return nil
+}
+
+// deferBehindOutput queues a final result behind output of the same attempt
+// that is still waiting for credit, so the server never sees the final first.
+func (c *Client) deferBehindOutput(message localtaskstore.OutboxMessage) bool {
+	c.deferredMu.Lock()
+	defer c.deferredMu.Unlock()
+	for _, queued := range c.deferred {
+		if queued.taskID == message.TaskID && queued.executionAttemptID == message.ExecutionAttemptID {
+			c.deferred = append(c.deferred, deferredMessage{
+				messageID:          message.MessageID,
+				taskID:             message.TaskID,
+				executionAttemptID: message.ExecutionAttemptID,
+			})
+			return true
+		}
+	}
+	return false
+}
+
+// drainDeferred sends queued messages in order while credit lasts. Output
+// rotated out of the spool in the meantime is skipped; finals need no credit.
+func (c *Client) drainDeferred(ctx context.Context) error {
+	c.deferredMu.Lock()
+	defer c.deferredMu.Unlock()
+	for len(c.deferred) > 0 {
+		message, found, err := c.outbox.UnackedMessage(c.deferred[0].messageID)
+		if err != nil {
+			return err
+		}
+		if found {
+			if message.Type == localtaskstore.OutboxMessageTypeOutput {
+				if !c.credit.tryAcquire(message.ByteCount) {
+					return nil
+				}
+				if err := c.sendOutputMessage(ctx, message); err != nil {
+					return err
+				}
+			} else {
+				if err := c.flushOutputBatch(ctx); err != nil {
+					return err
+				}
+				if err := c.sendIfActive(ctx, envelopeFromOutboxMessage(c.agentID, message)); err != nil {
+					return err
+				}
+			}
+		}
+		c.deferred = c.deferred[1:]
+	}
+	return nil
+}
+
+// clearDeferred drops the queue when a new session starts; the hello
+// reconciliation decides what gets replayed from the outbox.
+func (c *Client) clearDeferred() {
+	c.deferredMu.Lock()
+	defer c.deferredMu.Unlock()
+	c.deferred = nil
+}
@@ -325,6 +325,42 @@ func TestClientReceivesTaskDeliverStoresAcksAndQueues(t *testing.T) {
 	}
 }
 
+func TestClientQueuesDeliveredTaskWithSecrets(t *testing.T) {
+	store := newClientTestStore(t)
+	enqueuer := &fakeTaskEnqueuer{}
+	conn := newFakeConn()
+	dialer := &fakeDialer{conn: conn}
+	client := newTestClient(t, dialer, WithReceiptStore(store), WithTaskEnqueuer(enqueuer))
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- client.Start(runCtx) }()
+
+	hello := conn.waitForWrite(t)
+	conn.readCh <- helloAckEnvelope(hello.MessageID)
+	deliver := deliverEnvelope("msg_deliver", "task-1", "attempt-1", "psql {{secret:db_password}}", 0)
+	deliver.Payload = payloadMapForTest(wsprotocol.TaskDeliverPayload{
+		Command:    "psql {{secret:db_password}}",
+		EnvSecrets: []string{"token"},
+		Secrets:    []wsprotocol.TaskSecret{{ID: "sec_1", Name: "db_password", ValueEnc: "env:v1:sealed"}},
+	})
+	conn.readCh <- deliver
+
+	waitFor(t, func() bool { return len(enqueuer.tasks()) == 1 }, "task to be queued")
+	queued := enqueuer.tasks()[0]
+	if len(queued.EnvSecrets) != 1 || queued.EnvSecrets[0] != "token" {
+		t.Fatalf("queued env secrets = %v, want [token]", queued.EnvSecrets)
+	}
+	if want := (task.Secret{ID: "sec_1", Name: "db_password", ValueEnc: "env:v1:sealed"}); len(queued.Secrets) != 1 || queued.Secrets[0] != want {
+		t.Fatalf("queued secrets = %#v, want %#v", queued.Secrets, want)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+}
+
 func TestClientSendStartedPersistsRunningStateAndSendsStarted(t *testing.T) {
 	store := newClientTestStore(t)
 	conn := newFakeConn()
@@ -0,0 +1,124 @@
+package wsclient
+
+import (
+	"context"
+	"sync"
+
+	"hostlink/internal/wsprotocol"
+)
+
+// outputCredit tracks the output window granted by the control plane. Flow
+// control stays off, and output unlimited, until the server grants credit.
+type outputCredit struct {
+	mu            sync.Mutex
+	enabled       bool
+	limitBytes    bool
+	limitMessages bool
+	bytes         int64
+	messages      int
+	changed       chan struct{}
+}
+
+func newOutputCredit() *outputCredit {
+	return &outputCredit{changed: make(chan struct{})}
+}
+
+// reset replaces the window with the one granted at the start of a session.
+// A nil grant means the server does not flow-control output.
+func (o *outputCredit) reset(grant *wsprotocol.OutputCredit) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.enabled = grant != nil
+	o.limitBytes, o.limitMessages = false, false
+	o.bytes, o.messages = 0, 0
+	if grant != nil {
+		o.addLocked(*grant)
+	}
+	o.notifyLocked()
+}
+
+// add extends the window with credit carried on an ack.
+func (o *outputCredit) add(grant wsprotocol.OutputCredit) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.enabled = true
+	o.addLocked(grant)
+	o.notifyLocked()
+}
+
+// suspend withdraws the remaining credit when the session ends so output
+// does not pile up in the spool while nothing can be delivered.
+func (o *outputCredit) suspend() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.enabled {
+		return
+	}
+	o.bytes, o.messages = 0, 0
+	o.limitBytes = true
+}
+
+// tryAcquire consumes credit for one message of byteCount bytes. A message is
+// allowed whenever some credit remains, so a chunk larger than the window
+// cannot stall forever; the overdraft is paid back by later grants.
+func (o *outputCredit) tryAcquire(byteCount int64) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.availableLocked() {
+		return false
+	}
+	if o.enabled {
+		o.bytes -= byteCount
+		o.messages--
+	}
+	return true
+}
+
+// acquire blocks until credit for one message is available or ctx is done.
+func (o *outputCredit) acquire(ctx context.Context, byteCount int64) error {
+	for {
+		o.mu.Lock()
+		changed := o.changed
+		o.mu.Unlock()
+		if o.tryAcquire(byteCount) {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (o *outputCredit) addLocked(grant wsprotocol.OutputCredit) {
+	if grant.Bytes > 0 {
+		if !o.limitBytes {
+			o.bytes = 0
+		}
+		o.limitBytes = true
+		o.bytes += grant.Bytes
+	}
+	if grant.Messages > 0 {
+		if !o.limitMessages {
+			o.messages = 0
+		}
+		o.limitMessages = true
+		o.messages += grant.Messages
+	}
+}
+
+func (o *outputCredit) availableLocked() bool {
+	if !o.enabled {
+		return true
+	}
+	if !o.limitBytes && !o.limitMessages {
+		return false
+	}
+	return (!o.limitBytes || o.bytes > 0) && (!o.limitMessages || o.messages > 0)
+}
+
+func (o *outputCredit) notifyLocked() {
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
@@ -0,0 +1,137 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"hostlink/app/services/localtaskstore"
+	"hostlink/domain/task"
+	"hostlink/internal/wsprotocol"
+)
+
+func TestClientBlockPolicyWaitsForOutputCredit(t *testing.T) {
+	client, conn, cancel := startCreditTestClient(t, &wsprotocol.OutputCredit{Messages: 1})
+	defer cancel()
+	ctx := context.Background()
+
+	requireNoError(t, client.SendOutput(ctx, creditTestChunk(1)))
+	if got := conn.waitForWrite(t); got.MessageID != "msg-output-1" {
+		t.Fatalf("first output = %#v", got)
+	}
+
+	sent := make(chan error, 1)
+	go func() { sent <- client.SendOutput(ctx, creditTestChunk(2)) }()
+	select {
+	case err := <-sent:
+		t.Fatalf("SendOutput returned %v without credit; want it to block", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.readCh <- creditAckEnvelope(wsprotocol.OutputCredit{Messages: 1})
+	requireNoError(t, <-sent)
+	if got := conn.waitForWrite(t); got.MessageID != "msg-output-2" {
+		t.Fatalf("second output = %#v", got)
+	}
+}
+
+func TestClientBlockPolicyHonoursContextWhileWaiting(t *testing.T) {
+	client, conn, cancel := startCreditTestClient(t, &wsprotocol.OutputCredit{Bytes: 1})
+	defer cancel()
+
+	requireNoError(t, client.SendOutput(context.Background(), creditTestChunk(1)))
+	conn.waitForWrite(t)
+
+	ctx, stop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stop()
+	if err := client.SendOutput(ctx, creditTestChunk(2)); err != context.DeadlineExceeded {
+		t.Fatalf("SendOutput error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestClientDropOldestPolicyDefersOutputAndFinalUntilCredit(t *testing.T) {
+	client, conn, cancel := startCreditTestClient(t, &wsprotocol.OutputCredit{Messages: 1})
+	defer cancel()
+	ctx := context.Background()
+
+	requireNoError(t, client.SendOutputWithPolicy(ctx, creditTestChunk(1), task.OutputPolicyDropOldest))
+	conn.waitForWrite(t)
+	requireNoError(t, client.SendOutputWithPolicy(ctx, creditTestChunk(2), task.OutputPolicyDropOldest))
+	requireNoError(t, client.SendFinal(ctx, localtaskstore.FinalResult{
+		MessageID:          "msg-final-1",
+		TaskID:             "task-1",
+		ExecutionAttemptID: "attempt-1",
+		Status:             "completed",
+		Payload:            `{"status":"completed","exit_code":0}`,
+	}))
+	select {
+	case env := <-conn.writeCh:
+		t.Fatalf("sent %s before credit was granted", env.MessageID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.readCh <- creditAckEnvelope(wsprotocol.OutputCredit{Messages: 1})
+	if got := conn.waitForWrite(t); got.MessageID != "msg-output-2" {
+		t.Fatalf("deferred output = %#v", got)
+	}
+	if got := conn.waitForWrite(t); got.MessageID != "msg-final-1" {
+		t.Fatalf("deferred final = %#v", got)
+	}
+}
+
+func TestClientWithoutOutputCreditDoesNotFlowControl(t *testing.T) {
+	client, conn, cancel := startCreditTestClient(t, nil)
+	defer cancel()
+
+	for i := int64(1); i <= 3; i++ {
+		requireNoError(t, client.SendOutput(context.Background(), creditTestChunk(i)))
+		if got := conn.waitForWrite(t); got.MessageID != fmt.Sprintf("msg-output-%d", i) {
+			t.Fatalf("output %d = %#v", i, got)
+		}
+	}
+}
+
+func startCreditTestClient(t *testing.T, credit *wsprotocol.OutputCredit) (*Client, *fakeConn, context.CancelFunc) {
+	t.Helper()
+	store := newClientTestStore(t)
+	conn := newFakeConn()
+	client := newTestClient(t, &fakeDialer{conn: conn}, WithResultOutbox(store), WithResultsEnabled(true))
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Start(runCtx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	hello := conn.waitForWrite(t)
+	conn.readCh <- helloAckEnvelopeWithDirectives(hello.MessageID, wsprotocol.HelloAckPayload{OutputCredit: credit})
+	waitFor(t, client.IsActive, "session to become active")
+	return client, conn, cancel
+}
+
+func creditTestChunk(sequence int64) localtaskstore.OutputChunk {
+	payload := fmt.Sprintf("line %d\n", sequence)
+	return localtaskstore.OutputChunk{
+		MessageID:          fmt.Sprintf("msg-output-%d", sequence),
+		TaskID:             "task-1",
+		ExecutionAttemptID: "attempt-1",
+		Stream:             "stdout",
+		Sequence:           sequence,
+		Payload:            payload,
+		ByteCount:          int64(len(payload)),
+	}
+}
+
+func creditAckEnvelope(credit wsprotocol.OutputCredit) wsprotocol.Envelope {
+	return wsprotocol.Envelope{
+		ProtocolVersion: wsprotocol.ProtocolVersion,
+		MessageID:       fmt.Sprintf("msg_credit_%d", time.Now().UnixNano()),
+		Type:            wsprotocol.TypeAck,
+		AgentID:         "agent_ws_test",
+		SentAt:          time.Now().UTC().Format(time.RFC3339),
+		Payload:         payloadMapForTest(wsprotocol.AckPayload{OutputCredit: &credit}),
+	}
+}
@@ -2,6 +2,7 @@ package wsclient
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 	"time"
 
@@ -10,10 +11,18 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-type DefaultDialer struct{}
+// DefaultDialer dials with gorilla/websocket. TLSConfig, when set, is used
+// for wss:// connections so pinning and client certificates apply.
+type DefaultDialer struct {
+	TLSConfig *tls.Config
+}
 
-func (DefaultDialer) Dial(ctx context.Context, url string, headers http.Header) (Conn, error) {
-	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, headers)
+func (d DefaultDialer) Dial(ctx context.Context, url string, headers http.Header) (Conn, error) {
+	dialer := *websocket.DefaultDialer
+	if d.TLSConfig != nil {
+		dialer.TLSClientConfig = d.TLSConfig
+	}
+	conn, _, err := dialer.DialContext(ctx, url, headers)
 	if err != nil {
 		return nil, err
 	}
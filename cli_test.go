@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"slices"
 	"testing"
 
 	"github.com/urfave/cli/v3"
@@ -46,6 +47,31 @@ func TestCLIApp_HasUpgradeCommand(t *testing.T) {
 	}
 }
 
+func TestCLIApp_HasStoreCommand(t *testing.T) {
+	app := newApp()
+
+	var storeCmd *cli.Command
+	for _, cmd := range app.Commands {
+		if cmd.Name == "store" {
+			storeCmd = cmd
+			break
+		}
+	}
+	if storeCmd == nil {
+		t.Fatal("expected 'store' subcommand to exist")
+	}
+
+	var names []string
+	for _, sub := range storeCmd.Commands {
+		names = append(names, sub.Name)
+	}
+	for _, want := range []string{"status", "list", "show", "export", "purge"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("expected 'store %s' subcommand to exist", want)
+		}
+	}
+}
+
 func TestCLIApp_UpgradeHasInstallPathFlag(t *testing.T) {
 	app := newApp()
 
@@ -1,12 +1,16 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,13 +20,41 @@ type Client interface {
 	ListAgents(tags []string) ([]Agent, error)
 	ListTasks(filters *ListTasksRequest) ([]Task, error)
 	GetTask(taskID string) (*TaskDetails, error)
+	GetTaskOutput(taskID string, since int64) ([]TaskOutputChunk, error)
+	CancelTask(taskID string) (*TaskDetails, error)
+	StreamTask(ctx context.Context, taskID string, since int64, handle func(TaskEvent) error) error
 	GetAgent(agentID string) (*Agent, error)
+	GetAgentEvents(agentID string, limit int) ([]AgentEvent, error)
+	GetMetrics(agentID string, req *MetricsRequest) (*MetricsResponse, error)
+	CreateWebhook(req *WebhookRequest) (*Webhook, error)
+	ListWebhooks() ([]Webhook, error)
+	GetWebhook(webhookID string) (*Webhook, error)
+	UpdateWebhook(webhookID string, req *WebhookUpdateRequest) (*Webhook, error)
+	DeleteWebhook(webhookID string) error
+	ListWebhookDeliveries(webhookID string, limit int) ([]WebhookDelivery, error)
+	GetCurrentOperator() (*Operator, error)
+	ListAuditEntries(filters *AuditFilters) ([]AuditEntry, error)
+	ExportAuditLog(filters *AuditFilters, w io.Writer) error
+	VerifyAuditLog() (*AuditVerification, error)
+	CreateEnrollmentToken(req *EnrollmentTokenRequest) (*EnrollmentToken, error)
+	ListEnrollmentTokens() ([]EnrollmentToken, error)
+	RevokeEnrollmentToken(tokenID string) error
+	QuarantineAgent(agentID, reason string) (*AgentAccess, error)
+	ReleaseAgent(agentID, reason string) (*AgentAccess, error)
+	RevokeAgent(agentID, reason string) (*AgentAccess, error)
+	ListAgentTags(agentID string) ([]Tag, error)
+	SetAgentTag(agentID, key, value string) (*Tag, error)
+	DeleteAgentTag(agentID, key string) error
+	ListRegistrations(status string) ([]Registration, error)
+	ApproveRegistration(registrationID, as string) (*RegistrationApproval, error)
 }
 
 // HTTPClient implements the Client interface
 type HTTPClient struct {
 	baseURL string
 	client  *http.Client
+	// stream has no timeout, since a task stream lasts as long as the task
+	stream *http.Client
 }
 
 // NewHTTPClient creates a new HTTP client
@@ -30,36 +62,87 @@ func NewHTTPClient(baseURL string) *HTTPClient {
 	return &HTTPClient{
 		baseURL: baseURL,
 		client:  &http.Client{Timeout: 30 * time.Second},
+		stream:  &http.Client{},
 	}
 }
 
+// WithToken authenticates every request with an operator API token. An
+// empty token sends none.
+func (c *HTTPClient) WithToken(token string) *HTTPClient {
+	if token == "" {
+		return c
+	}
+	c.client.Transport = &tokenTransport{token: token, base: http.DefaultTransport}
+	c.stream.Transport = &tokenTransport{token: token, base: http.DefaultTransport}
+	return c
+}
+
+// tokenTransport adds the operator token to every request
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
 // CreateTaskRequest represents the request payload for creating a task
 type CreateTaskRequest struct {
-	Command  string   `json:"command"`
-	Priority int      `json:"priority"`
-	AgentIDs []string `json:"agent_ids,omitempty"`
+	Command    string   `json:"command"`
+	Priority   int      `json:"priority"`
+	AgentIDs   []string `json:"agent_ids,omitempty"`
+	EnvSecrets []string `json:"env_secrets,omitempty"`
 }
 
 // CreateTaskResponse represents the response from creating a task
 type CreateTaskResponse struct {
-	ID        string    `json:"id"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string       `json:"id"`
+	Status    string       `json:"status"`
+	AgentIDs  []string     `json:"agent_ids,omitempty"`
+	Summary   *TaskSummary `json:"summary,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// TaskSummary counts the executions of a task targeted at agents
+type TaskSummary struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
 }
 
 // Agent represents an agent from the API
 type Agent struct {
 	ID           string    `json:"id"`
 	Status       string    `json:"status"`
+	Access       string    `json:"access"`
+	AccessReason string    `json:"access_reason,omitempty"`
 	LastSeen     time.Time `json:"last_seen"`
 	Tags         []Tag     `json:"tags"`
 	RegisteredAt time.Time `json:"registered_at"`
 }
 
+// AgentEvent is a status transition of an agent
+type AgentEvent struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason"`
+	LastSeen  time.Time `json:"last_seen"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // Tag represents a tag key-value pair
 type Tag struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
+	// Source is "server" for tags set by operators and enrollment tokens,
+	// "agent" for tags the agent declares
+	Source string `json:"source,omitempty"`
+	// Shadowed marks an agent tag hidden by a server tag with the same key
+	Shadowed bool `json:"shadowed,omitempty"`
 }
 
 // ListTasksRequest represents filters for listing tasks
@@ -68,27 +151,152 @@ type ListTasksRequest struct {
 	AgentID string
 }
 
+// MetricsRequest selects the metric series to query. From and To are RFC
+// 3339 timestamps and Step a duration such as 5m; empty values use the
+// server defaults.
+type MetricsRequest struct {
+	Type       string
+	From       string
+	To         string
+	Step       string
+	Attributes []string
+	Fields     []string
+}
+
+// MetricsResponse represents aggregated metric series from the API
+type MetricsResponse struct {
+	AgentID    string         `json:"agent_id"`
+	Type       string         `json:"type"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Step       string         `json:"step"`
+	Resolution string         `json:"resolution"`
+	Series     []MetricSeries `json:"series"`
+}
+
+// MetricSeries is one field of one series
+type MetricSeries struct {
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Field      string         `json:"field"`
+	Points     []MetricPoint  `json:"points"`
+}
+
+// MetricPoint aggregates a field over one step
+type MetricPoint struct {
+	Time time.Time `json:"time"`
+	Avg  float64   `json:"avg"`
+	Max  float64   `json:"max"`
+	P95  float64   `json:"p95"`
+}
+
+// TaskOutputChunk is a piece of a task's stdout or stderr
+type TaskOutputChunk struct {
+	Sequence  int64     `json:"sequence"`
+	AgentID   string    `json:"agent_id"`
+	Stream    string    `json:"stream"`
+	Data      string    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIError is an error response from the API
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error: status %d, body: %s", e.StatusCode, e.Body)
+}
+
+// Task stream event types
+const (
+	TaskEventOutput = "output"
+	TaskEventStatus = "status"
+	TaskEventDone   = "done"
+)
+
+// TaskEvent is an event of a task stream. Output events carry Sequence,
+// Stream and Data; status and done events carry Status and ExitCode. Done
+// is the last event of a stream.
+type TaskEvent struct {
+	Type     string `json:"-"`
+	Sequence int64  `json:"sequence,omitempty"`
+	AgentID  string `json:"agent_id,omitempty"`
+	Stream   string `json:"stream,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Status   string `json:"status,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// WebhookRequest represents the request payload for creating a webhook.
+// An empty secret is generated by the server.
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Secret      string   `json:"secret,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+// WebhookUpdateRequest changes the webhook fields that are set
+type WebhookUpdateRequest struct {
+	URL         *string  `json:"url,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+// Webhook represents a webhook subscription from the API. Secret is only
+// returned when the webhook is created.
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery represents one event sent, or to be sent, to a webhook
+type WebhookDelivery struct {
+	ID             string     `json:"id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
 // Task represents a task from the API
 type Task struct {
-	ID        string    `json:"id"`
-	Command   string    `json:"command"`
-	Status    string    `json:"status"`
-	Priority  int       `json:"priority"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string       `json:"id"`
+	Command   string       `json:"command"`
+	Status    string       `json:"status"`
+	Priority  int          `json:"priority"`
+	Summary   *TaskSummary `json:"summary,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
 }
 
 // TaskDetails represents full task details from the API
 type TaskDetails struct {
-	ID          string     `json:"id"`
-	Command     string     `json:"command"`
-	Status      string     `json:"status"`
-	Priority    int        `json:"priority"`
-	AgentID     *string    `json:"agent_id"`
-	Output      *string    `json:"output"`
-	ExitCode    *int       `json:"exit_code"`
-	CreatedAt   time.Time  `json:"created_at"`
-	StartedAt   *time.Time `json:"started_at"`
-	CompletedAt *time.Time `json:"completed_at"`
+	ID          string       `json:"id"`
+	Command     string       `json:"command"`
+	Status      string       `json:"status"`
+	Priority    int          `json:"priority"`
+	AgentID     *string      `json:"agent_id"`
+	Output      *string      `json:"output"`
+	ExitCode    *int         `json:"exit_code"`
+	CreatedAt   time.Time    `json:"created_at"`
+	StartedAt   *time.Time   `json:"started_at"`
+	CompletedAt *time.Time   `json:"completed_at"`
+	AgentIDs    []string     `json:"agent_ids,omitempty"`
+	Summary     *TaskSummary `json:"summary,omitempty"`
 }
 
 // CreateTask creates a new task via the API
@@ -216,6 +424,93 @@ func (c *HTTPClient) GetTask(taskID string) (*TaskDetails, error) {
 	return &task, nil
 }
 
+// GetTaskOutput lists a task's output chunks after the since sequence
+func (c *HTTPClient) GetTaskOutput(taskID string, since int64) ([]TaskOutputChunk, error) {
+	path := "/api/v2/tasks/" + url.PathEscape(taskID) + "/output"
+	if since > 0 {
+		path += "?since=" + strconv.FormatInt(since, 10)
+	}
+
+	var chunks []TaskOutputChunk
+	if err := c.doJSON(http.MethodGet, path, nil, http.StatusOK, &chunks); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// CancelTask cancels a task that has not finished. A targeted task has each
+// of its unfinished executions cancelled.
+func (c *HTTPClient) CancelTask(taskID string) (*TaskDetails, error) {
+	var task TaskDetails
+	if err := c.doJSON(http.MethodPost, "/api/v2/tasks/"+url.PathEscape(taskID)+"/cancel", nil, http.StatusOK, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// StreamTask follows a task's server-sent events after the since output
+// sequence, calling handle for each one. It returns when the stream ends,
+// the context is done or handle returns an error; a stream that ends
+// before a done event was cut off and can be resumed from the last
+// sequence handled.
+func (c *HTTPClient) StreamTask(ctx context.Context, taskID string, since int64, handle func(TaskEvent) error) error {
+	u := fmt.Sprintf("%s/api/v2/tasks/%s/stream", c.baseURL, url.PathEscape(taskID))
+	if since > 0 {
+		u += "?since=" + strconv.FormatInt(since, 10)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var eventType string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if eventType != "" && data.Len() > 0 {
+				event := TaskEvent{}
+				if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+					return fmt.Errorf("failed to decode %s event: %w", eventType, err)
+				}
+				event.Type = eventType
+				if err := handle(event); err != nil {
+					return err
+				}
+			}
+			eventType = ""
+			data.Reset()
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("stream failed: %w", err)
+	}
+	return nil
+}
+
 // GetAgent gets agent details by ID
 func (c *HTTPClient) GetAgent(agentID string) (*Agent, error) {
 	url := fmt.Sprintf("%s/api/v1/agents/%s", c.baseURL, agentID)
@@ -238,3 +533,475 @@ func (c *HTTPClient) GetAgent(agentID string) (*Agent, error) {
 
 	return &agent, nil
 }
+
+// GetAgentEvents lists an agent's status transitions, newest first. A zero
+// limit uses the server default.
+func (c *HTTPClient) GetAgentEvents(agentID string, limit int) ([]AgentEvent, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/api/v1/agents/%s/events", c.baseURL, agentID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	if limit > 0 {
+		q := u.Query()
+		q.Set("limit", strconv.Itoa(limit))
+		u.RawQuery = q.Encode()
+	}
+
+	resp, err := c.client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var events []AgentEvent
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return events, nil
+}
+
+// GetMetrics queries an agent's aggregated metric series
+func (c *HTTPClient) GetMetrics(agentID string, req *MetricsRequest) (*MetricsResponse, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/api/v1/agents/%s/metrics", c.baseURL, agentID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("type", req.Type)
+	if req.From != "" {
+		q.Set("from", req.From)
+	}
+	if req.To != "" {
+		q.Set("to", req.To)
+	}
+	if req.Step != "" {
+		q.Set("step", req.Step)
+	}
+	for _, attribute := range req.Attributes {
+		q.Add("attribute", attribute)
+	}
+	for _, field := range req.Fields {
+		q.Add("field", field)
+	}
+	u.RawQuery = q.Encode()
+
+	resp, err := c.client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var metrics MetricsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &metrics, nil
+}
+
+// CreateWebhook creates a webhook subscription via the API
+func (c *HTTPClient) CreateWebhook(req *WebhookRequest) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.doJSON(http.MethodPost, "/api/v2/webhooks", req, http.StatusCreated, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// ListWebhooks lists webhook subscriptions
+func (c *HTTPClient) ListWebhooks() ([]Webhook, error) {
+	var webhooks []Webhook
+	if err := c.doJSON(http.MethodGet, "/api/v2/webhooks", nil, http.StatusOK, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetWebhook gets a webhook subscription by ID
+func (c *HTTPClient) GetWebhook(webhookID string) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.doJSON(http.MethodGet, "/api/v2/webhooks/"+url.PathEscape(webhookID), nil, http.StatusOK, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// UpdateWebhook changes a webhook subscription
+func (c *HTTPClient) UpdateWebhook(webhookID string, req *WebhookUpdateRequest) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.doJSON(http.MethodPut, "/api/v2/webhooks/"+url.PathEscape(webhookID), req, http.StatusOK, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// DeleteWebhook deletes a webhook subscription. Its pending deliveries are
+// dropped.
+func (c *HTTPClient) DeleteWebhook(webhookID string) error {
+	return c.doJSON(http.MethodDelete, "/api/v2/webhooks/"+url.PathEscape(webhookID), nil, http.StatusNoContent, nil)
+}
+
+// ListWebhookDeliveries lists a webhook's deliveries, newest first. A zero
+// limit uses the server default.
+func (c *HTTPClient) ListWebhookDeliveries(webhookID string, limit int) ([]WebhookDelivery, error) {
+	path := "/api/v2/webhooks/" + url.PathEscape(webhookID) + "/deliveries"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+
+	var deliveries []WebhookDelivery
+	if err := c.doJSON(http.MethodGet, path, nil, http.StatusOK, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Operator is the identity an API token belongs to
+type Operator struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Role  string   `json:"role"`
+	Scope []string `json:"scope"`
+}
+
+// GetCurrentOperator returns the operator the client's token belongs to
+func (c *HTTPClient) GetCurrentOperator() (*Operator, error) {
+	var operator Operator
+	if err := c.doJSON(http.MethodGet, "/api/v2/operators/me", nil, http.StatusOK, &operator); err != nil {
+		return nil, err
+	}
+	return &operator, nil
+}
+
+// AuditFilters narrows the audit log. Since and Until are RFC 3339
+// timestamps; Before pages back from an entry's sequence. Limit and Before
+// only apply to listing.
+type AuditFilters struct {
+	Actor   string
+	Action  string
+	Target  string
+	Outcome string
+	Since   string
+	Until   string
+	Before  int64
+	Limit   int
+}
+
+// query encodes the filters as query parameters
+func (f *AuditFilters) query() string {
+	if f == nil {
+		return ""
+	}
+	q := url.Values{}
+	for key, value := range map[string]string{
+		"actor": f.Actor, "action": f.Action, "target": f.Target,
+		"outcome": f.Outcome, "since": f.Since, "until": f.Until,
+	} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	if f.Before > 0 {
+		q.Set("before", strconv.FormatInt(f.Before, 10))
+	}
+	if f.Limit > 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// AuditEntry is a recorded control plane action
+type AuditEntry struct {
+	Sequence      int64     `json:"sequence"`
+	ID            string    `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	ActorType     string    `json:"actor_type"`
+	ActorID       string    `json:"actor_id,omitempty"`
+	ActorName     string    `json:"actor_name,omitempty"`
+	TokenID       string    `json:"token_id,omitempty"`
+	Action        string    `json:"action"`
+	Target        string    `json:"target,omitempty"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	SourceIP      string    `json:"source_ip"`
+	RequestDigest string    `json:"request_digest"`
+	Outcome       string    `json:"outcome"`
+	StatusCode    int       `json:"status_code"`
+	Detail        string    `json:"detail,omitempty"`
+	PrevHash      string    `json:"prev_hash"`
+	Hash          string    `json:"hash"`
+}
+
+// AuditVerification reports whether the audit log's hash chain is intact
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	Head     string `json:"head,omitempty"`
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ListAuditEntries lists audit log entries, newest first
+func (c *HTTPClient) ListAuditEntries(filters *AuditFilters) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	if err := c.doJSON(http.MethodGet, "/api/v2/audit"+filters.query(), nil, http.StatusOK, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ExportAuditLog copies the matching audit log entries to w as JSON lines,
+// oldest first
+func (c *HTTPClient) ExportAuditLog(filters *AuditFilters, w io.Writer) error {
+	var query string
+	if filters != nil {
+		exported := *filters
+		exported.Before, exported.Limit = 0, 0
+		query = exported.query()
+	}
+
+	// An export can outlast the client timeout, like a task stream
+	resp, err := c.stream.Get(c.baseURL + "/api/v2/audit/export" + query)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error: status %d, body: %s", resp.StatusCode, string(body))
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to read export: %w", err)
+	}
+	return nil
+}
+
+// VerifyAuditLog asks the server to check the audit log's hash chain
+func (c *HTTPClient) VerifyAuditLog() (*AuditVerification, error) {
+	var result AuditVerification
+	if err := c.doJSON(http.MethodGet, "/api/v2/audit/verify", nil, http.StatusOK, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// EnrollmentTokenRequest represents the request payload for creating an
+// enrollment token. ExpiresIn is a duration such as 72h; empty never
+// expires. A zero MaxUses is unlimited.
+type EnrollmentTokenRequest struct {
+	Name      string   `json:"name"`
+	Tags      []string `json:"tags,omitempty"`
+	MaxUses   int      `json:"max_uses,omitempty"`
+	ExpiresIn string   `json:"expires_in,omitempty"`
+}
+
+// EnrollmentToken is a token agents register with. Key is only returned
+// when the token is created.
+type EnrollmentToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Tags       []string   `json:"tags"`
+	MaxUses    int        `json:"max_uses"`
+	Uses       int        `json:"uses"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateEnrollmentToken creates an enrollment token via the API
+func (c *HTTPClient) CreateEnrollmentToken(req *EnrollmentTokenRequest) (*EnrollmentToken, error) {
+	var token EnrollmentToken
+	if err := c.doJSON(http.MethodPost, "/api/v2/enrollment-tokens", req, http.StatusCreated, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ListEnrollmentTokens lists enrollment tokens, newest first
+func (c *HTTPClient) ListEnrollmentTokens() ([]EnrollmentToken, error) {
+	var tokens []EnrollmentToken
+	if err := c.doJSON(http.MethodGet, "/api/v2/enrollment-tokens", nil, http.StatusOK, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeEnrollmentToken stops an enrollment token from registering further
+// agents
+func (c *HTTPClient) RevokeEnrollmentToken(tokenID string) error {
+	return c.doJSON(http.MethodDelete, "/api/v2/enrollment-tokens/"+url.PathEscape(tokenID), nil, http.StatusNoContent, nil)
+}
+
+// AgentAccess is an agent's access state after a change
+type AgentAccess struct {
+	ID              string     `json:"id"`
+	Access          string     `json:"access"`
+	AccessReason    string     `json:"access_reason,omitempty"`
+	AccessChangedAt *time.Time `json:"access_changed_at,omitempty"`
+}
+
+// QuarantineAgent stops handing an agent tasks; it keeps heartbeating and
+// pushing metrics
+func (c *HTTPClient) QuarantineAgent(agentID, reason string) (*AgentAccess, error) {
+	return c.setAgentAccess(agentID, "quarantine", reason)
+}
+
+// ReleaseAgent lifts an agent's quarantine
+func (c *HTTPClient) ReleaseAgent(agentID, reason string) (*AgentAccess, error) {
+	return c.setAgentAccess(agentID, "release", reason)
+}
+
+// RevokeAgent rejects every further request of an agent, for good
+func (c *HTTPClient) RevokeAgent(agentID, reason string) (*AgentAccess, error) {
+	return c.setAgentAccess(agentID, "revoke", reason)
+}
+
+func (c *HTTPClient) setAgentAccess(agentID, action, reason string) (*AgentAccess, error) {
+	var access AgentAccess
+	body := map[string]string{"reason": reason}
+	if err := c.doJSON(http.MethodPost, "/api/v2/agents/"+url.PathEscape(agentID)+"/"+action, body, http.StatusOK, &access); err != nil {
+		return nil, err
+	}
+	return &access, nil
+}
+
+// ListAgentTags lists every tag of an agent, agent tags a server tag
+// shadows included
+func (c *HTTPClient) ListAgentTags(agentID string) ([]Tag, error) {
+	var tags []Tag
+	if err := c.doJSON(http.MethodGet, agentTagsPath(agentID), nil, http.StatusOK, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// SetAgentTag sets a server tag of an agent, which shadows the agent's own
+// tag with the key
+func (c *HTTPClient) SetAgentTag(agentID, key, value string) (*Tag, error) {
+	var tag Tag
+	body := map[string]string{"value": value}
+	if err := c.doJSON(http.MethodPut, agentTagsPath(agentID)+"/"+url.PathEscape(key), body, http.StatusOK, &tag); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// DeleteAgentTag removes a server tag of an agent
+func (c *HTTPClient) DeleteAgentTag(agentID, key string) error {
+	return c.doJSON(http.MethodDelete, agentTagsPath(agentID)+"/"+url.PathEscape(key), nil, http.StatusNoContent, nil)
+}
+
+func agentTagsPath(agentID string) string {
+	return "/api/v2/agents/" + url.PathEscape(agentID) + "/tags"
+}
+
+// Registration is a registration held because it looks like a clone or a
+// replacement of an existing agent, the candidate
+type Registration struct {
+	ID               string     `json:"id"`
+	Fingerprint      string     `json:"fingerprint"`
+	Hostname         string     `json:"hostname"`
+	IPAddress        string     `json:"ip_address"`
+	MachineID        string     `json:"machine_id"`
+	CandidateAgentID string     `json:"candidate_agent_id"`
+	SimilarityScore  int        `json:"similarity_score"`
+	Reason           string     `json:"reason"`
+	Status           string     `json:"status"`
+	AgentID          string     `json:"agent_id,omitempty"`
+	ResolvedAt       *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// RegistrationApproval reports the agent a registration was approved as
+type RegistrationApproval struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	AgentID string `json:"agent_id"`
+}
+
+// ListRegistrations lists held registrations in a status, newest first. An
+// empty status lists those pending approval; "all" lists every status.
+func (c *HTTPClient) ListRegistrations(status string) ([]Registration, error) {
+	path := "/api/v2/registrations"
+	if status != "" {
+		path += "?" + url.Values{"status": {status}}.Encode()
+	}
+	var registrations []Registration
+	if err := c.doJSON(http.MethodGet, path, nil, http.StatusOK, &registrations); err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+// ApproveRegistration approves a held registration as "replacement" of its
+// candidate agent, which keeps the agent's ID, tags and history, or as a
+// "new" agent
+func (c *HTTPClient) ApproveRegistration(registrationID, as string) (*RegistrationApproval, error) {
+	var approval RegistrationApproval
+	body := map[string]string{"as": as}
+	if err := c.doJSON(http.MethodPost, "/api/v2/registrations/"+url.PathEscape(registrationID)+"/approve", body, http.StatusOK, &approval); err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// doJSON sends body, if any, as JSON and decodes the response into out, if
+// any. A status other than wantStatus is an API error.
+func (c *HTTPClient) doJSON(method, path string, body any, wantStatus int, out any) error {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	httpReq, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error: status %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -36,8 +38,9 @@ func TestCreateTask_SendsCorrectRequest(t *testing.T) {
 
 	client := NewHTTPClient(server.URL)
 	req := &CreateTaskRequest{
-		Command:  "ls -la",
-		Priority: 2,
+		Command:    "ls -la",
+		Priority:   2,
+		EnvSecrets: []string{"db_password"},
 	}
 
 	_, err := client.CreateTask(req)
@@ -45,6 +48,7 @@ func TestCreateTask_SendsCorrectRequest(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "ls -la", capturedRequest.Command)
 	assert.Equal(t, 2, capturedRequest.Priority)
+	assert.Equal(t, []string{"db_password"}, capturedRequest.EnvSecrets)
 }
 
 func TestCreateTask_ParsesSuccessResponse(t *testing.T) {
@@ -448,3 +452,458 @@ func TestGetTask_HandlesAPIError(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "500")
 }
+
+func TestGetMetrics_SendsQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/agents/agt_123/metrics", r.URL.Path)
+		q := r.URL.Query()
+		assert.Equal(t, "storage", q.Get("type"))
+		assert.Equal(t, "5m", q.Get("step"))
+		assert.Equal(t, "2024-01-01T00:00:00Z", q.Get("from"))
+		assert.Empty(t, q.Get("to"))
+		assert.Equal(t, []string{"mount_point=/", "device=sda1"}, q["attribute"])
+		assert.Equal(t, []string{"disk_used_percent"}, q["field"])
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"agent_id":   "agt_123",
+			"type":       "storage",
+			"resolution": "5m",
+			"series": []map[string]any{{
+				"attributes": map[string]any{"mount_point": "/"},
+				"field":      "disk_used_percent",
+				"points":     []map[string]any{{"time": "2024-01-01T00:00:00Z", "avg": 40, "max": 42, "p95": 41}},
+			}},
+		})
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	resp, err := client.GetMetrics("agt_123", &MetricsRequest{
+		Type:       "storage",
+		From:       "2024-01-01T00:00:00Z",
+		Step:       "5m",
+		Attributes: []string{"mount_point=/", "device=sda1"},
+		Fields:     []string{"disk_used_percent"},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "5m", resp.Resolution)
+	require.Len(t, resp.Series, 1)
+	require.Len(t, resp.Series[0].Points, 1)
+	assert.Equal(t, float64(42), resp.Series[0].Points[0].Max)
+}
+
+func TestGetMetrics_HandlesAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid metrics query: type is required"}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	_, err := client.GetMetrics("agt_123", &MetricsRequest{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 400")
+}
+
+func TestGetAgentEvents_SendsLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/agents/agt_123/events", r.URL.Path)
+		assert.Equal(t, "5", r.URL.Query().Get("limit"))
+
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"from": "online", "to": "stale", "reason": "not seen for 1m0s", "created_at": "2024-01-01T00:00:00Z"},
+		})
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	events, err := client.GetAgentEvents("agt_123", 5)
+
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "online", events[0].From)
+	assert.Equal(t, "stale", events[0].To)
+}
+
+func TestGetAgentEvents_HandlesAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.URL.RawQuery)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Agent not found"}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	_, err := client.GetAgentEvents("agt_missing", 0)
+
+	assert.ErrorContains(t, err, "status 404")
+}
+
+func TestCreateWebhook_SendsRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v2/webhooks", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var req map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "https://hooks.example.com/x", req["url"])
+		assert.Equal(t, []any{"task.failed"}, req["events"])
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":     "whk_123",
+			"url":    "https://hooks.example.com/x",
+			"secret": "whsec_abc",
+			"events": []string{"task.failed"},
+			"active": true,
+		})
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	webhook, err := client.CreateWebhook(&WebhookRequest{
+		URL:    "https://hooks.example.com/x",
+		Events: []string{"task.failed"},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "whk_123", webhook.ID)
+	assert.Equal(t, "whsec_abc", webhook.Secret)
+	assert.True(t, webhook.Active)
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, "/api/v2/webhooks/whk_123", r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+
+	assert.NoError(t, client.DeleteWebhook("whk_123"))
+}
+
+func TestListWebhookDeliveries_SendsLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/webhooks/whk_123/deliveries", r.URL.Path)
+		assert.Equal(t, "10", r.URL.Query().Get("limit"))
+
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"id": "whd_1", "event_type": "agent.offline", "status": "failed", "attempts": 8},
+		})
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	deliveries, err := client.ListWebhookDeliveries("whk_123", 10)
+
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "agent.offline", deliveries[0].EventType)
+	assert.Equal(t, 8, deliveries[0].Attempts)
+}
+
+func TestGetWebhook_HandlesAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Webhook not found"}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	_, err := client.GetWebhook("whk_missing")
+
+	assert.ErrorContains(t, err, "status 404")
+}
+
+func TestStreamTask_ParsesEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/tasks/tsk_123/stream", r.URL.Path)
+		assert.Equal(t, "4", r.URL.Query().Get("since"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: status\ndata: {\"status\":\"running\",\"exit_code\":0}\n\n" +
+			": keepalive\n\n" +
+			"id: 5\nevent: output\ndata: {\"sequence\":5,\"stream\":\"stderr\",\"data\":\"oops\\n\"}\n\n" +
+			"event: done\ndata: {\"status\":\"failed\",\"exit_code\":2}\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	var events []TaskEvent
+	err := client.StreamTask(context.Background(), "tsk_123", 4, func(event TaskEvent) error {
+		events = append(events, event)
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, TaskEvent{Type: TaskEventStatus, Status: "running"}, events[0])
+	assert.Equal(t, TaskEvent{Type: TaskEventOutput, Sequence: 5, Stream: "stderr", Data: "oops\n"}, events[1])
+	assert.Equal(t, TaskEvent{Type: TaskEventDone, Status: "failed", ExitCode: 2}, events[2])
+}
+
+func TestStreamTask_HandlesAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Task not found"}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	err := client.StreamTask(context.Background(), "tsk_missing", 0, func(TaskEvent) error { return nil })
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.ErrorContains(t, err, "status 404")
+}
+
+func TestGetTaskOutput_SendsSince(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/tasks/tsk_123/output", r.URL.Path)
+		assert.Equal(t, "2", r.URL.Query().Get("since"))
+		w.Write([]byte(`[{"sequence":3,"stream":"stdout","data":"hi\n"}]`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	chunks, err := client.GetTaskOutput("tsk_123", 2)
+
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, int64(3), chunks[0].Sequence)
+	assert.Equal(t, "hi\n", chunks[0].Data)
+}
+
+func TestWithToken_SendsBearerToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/operators/me", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer hlo_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":"opr_1","name":"alice","role":"operator","scope":["env=staging"]}`))
+	}))
+	defer server.Close()
+
+	operator, err := NewHTTPClient(server.URL).WithToken("hlo_secret").GetCurrentOperator()
+
+	require.NoError(t, err)
+	assert.Equal(t, "alice", operator.Name)
+	assert.Equal(t, []string{"env=staging"}, operator.Scope)
+
+	_, err = NewHTTPClient(server.URL).WithToken("").GetCurrentOperator()
+	assert.ErrorContains(t, err, "status 401")
+}
+
+func TestWithToken_AuthenticatesStreams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer hlo_secret", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: done\ndata: {\"status\":\"completed\",\"exit_code\":0}\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL).WithToken("hlo_secret")
+	err := client.StreamTask(context.Background(), "tsk_123", 0, func(TaskEvent) error { return nil })
+
+	require.NoError(t, err)
+}
+
+func TestListAuditEntries_SendsFilters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/audit", r.URL.Path)
+		assert.Equal(t, "opr_1", r.URL.Query().Get("actor"))
+		assert.Equal(t, "task.create", r.URL.Query().Get("action"))
+		assert.Equal(t, "2026-01-01T00:00:00Z", r.URL.Query().Get("since"))
+		assert.Equal(t, "10", r.URL.Query().Get("limit"))
+		assert.Equal(t, "42", r.URL.Query().Get("before"))
+		w.Write([]byte(`[{"sequence":41,"action":"task.create","actor_id":"opr_1","outcome":"success"}]`))
+	}))
+	defer server.Close()
+
+	entries, err := NewHTTPClient(server.URL).ListAuditEntries(&AuditFilters{
+		Actor: "opr_1", Action: "task.create", Since: "2026-01-01T00:00:00Z", Limit: 10, Before: 42,
+	})
+
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(41), entries[0].Sequence)
+}
+
+func TestExportAuditLog_CopiesLines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/audit/export", r.URL.Path)
+		assert.Equal(t, "task.create", r.URL.Query().Get("action"))
+		assert.Empty(t, r.URL.Query().Get("limit"))
+		w.Write([]byte("{\"sequence\":1}\n{\"sequence\":2}\n"))
+	}))
+	defer server.Close()
+
+	var out strings.Builder
+	err := NewHTTPClient(server.URL).ExportAuditLog(&AuditFilters{Action: "task.create", Limit: 5}, &out)
+
+	require.NoError(t, err)
+	assert.Equal(t, "{\"sequence\":1}\n{\"sequence\":2}\n", out.String())
+}
+
+func TestVerifyAuditLog_ReturnsResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/audit/verify", r.URL.Path)
+		w.Write([]byte(`{"valid":false,"entries":3,"broken_at":4,"error":"audit chain broken"}`))
+	}))
+	defer server.Close()
+
+	result, err := NewHTTPClient(server.URL).VerifyAuditLog()
+
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(4), result.BrokenAt)
+}
+
+func TestCreateEnrollmentToken_ReturnsKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v2/enrollment-tokens", r.URL.Path)
+		var req EnrollmentTokenRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, EnrollmentTokenRequest{Name: "staging", Tags: []string{"env=staging"}, MaxUses: 5, ExpiresIn: "72h"}, req)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"enr_1","name":"staging","key":"hle_secret","tags":["env=staging"],"max_uses":5}`))
+	}))
+	defer server.Close()
+
+	token, err := NewHTTPClient(server.URL).CreateEnrollmentToken(&EnrollmentTokenRequest{
+		Name: "staging", Tags: []string{"env=staging"}, MaxUses: 5, ExpiresIn: "72h",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "enr_1", token.ID)
+	assert.Equal(t, "hle_secret", token.Key)
+}
+
+func TestListEnrollmentTokens_DecodesTokens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/enrollment-tokens", r.URL.Path)
+		w.Write([]byte(`[{"id":"enr_2","name":"prod","uses":3},{"id":"enr_1","name":"staging"}]`))
+	}))
+	defer server.Close()
+
+	tokens, err := NewHTTPClient(server.URL).ListEnrollmentTokens()
+
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, 3, tokens[0].Uses)
+}
+
+func TestRevokeEnrollmentToken_ReportsMissingTokens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		if r.URL.Path == "/api/v2/enrollment-tokens/enr_1" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Token not found"}`))
+	}))
+	defer server.Close()
+	c := NewHTTPClient(server.URL)
+
+	assert.NoError(t, c.RevokeEnrollmentToken("enr_1"))
+	assert.ErrorContains(t, c.RevokeEnrollmentToken("enr_missing"), "Token not found")
+}
+
+func TestAgentAccess_PostsReasonToTheAction(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "leaked key", body["reason"])
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/api/v2/agents/agt_1/release" {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error":"Agent revoked"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"agt_1","access":"revoked","access_reason":"leaked key"}`))
+	}))
+	defer server.Close()
+	c := NewHTTPClient(server.URL)
+
+	_, err := c.QuarantineAgent("agt_1", "leaked key")
+	require.NoError(t, err)
+	access, err := c.RevokeAgent("agt_1", "leaked key")
+	require.NoError(t, err)
+	assert.Equal(t, "revoked", access.Access)
+	_, err = c.ReleaseAgent("agt_1", "leaked key")
+	assert.ErrorContains(t, err, "Agent revoked")
+	assert.Equal(t, []string{"/api/v2/agents/agt_1/quarantine", "/api/v2/agents/agt_1/revoke", "/api/v2/agents/agt_1/release"}, paths)
+}
+
+func TestRegistrations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v2/registrations":
+			assert.Equal(t, "all", r.URL.Query().Get("status"))
+			w.Write([]byte(`[{"id":"reg_1","candidate_agent_id":"agt_1","reason":"clone","similarity_score":88,"status":"pending_approval"}]`))
+		case "POST /api/v2/registrations/reg_1/approve":
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "replacement", body["as"])
+			w.Write([]byte(`{"id":"reg_1","status":"approved_replacement","agent_id":"agt_1"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	c := NewHTTPClient(server.URL)
+
+	registrations, err := c.ListRegistrations("all")
+	require.NoError(t, err)
+	require.Len(t, registrations, 1)
+	assert.Equal(t, "agt_1", registrations[0].CandidateAgentID)
+	assert.Equal(t, 88, registrations[0].SimilarityScore)
+
+	approval, err := c.ApproveRegistration("reg_1", "replacement")
+	require.NoError(t, err)
+	assert.Equal(t, &RegistrationApproval{ID: "reg_1", Status: "approved_replacement", AgentID: "agt_1"}, approval)
+}
+
+func TestAgentTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v2/agents/agt_1/tags":
+			w.Write([]byte(`[{"key":"env","value":"prod","source":"server"},{"key":"env","value":"dev","source":"agent","shadowed":true}]`))
+		case "PUT /api/v2/agents/agt_1/tags/env":
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "prod", body["value"])
+			w.Write([]byte(`{"key":"env","value":"prod","source":"server"}`))
+		case "DELETE /api/v2/agents/agt_1/tags/env":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	c := NewHTTPClient(server.URL)
+
+	tags, err := c.ListAgentTags("agt_1")
+	require.NoError(t, err)
+	assert.Equal(t, []Tag{
+		{Key: "env", Value: "prod", Source: "server"},
+		{Key: "env", Value: "dev", Source: "agent", Shadowed: true},
+	}, tags)
+
+	tag, err := c.SetAgentTag("agt_1", "env", "prod")
+	require.NoError(t, err)
+	assert.Equal(t, &Tag{Key: "env", Value: "prod", Source: "server"}, tag)
+
+	require.NoError(t, c.DeleteAgentTag("agt_1", "env"))
+}
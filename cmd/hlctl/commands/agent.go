@@ -3,6 +3,7 @@ package commands
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"hostlink/cmd/hlctl/client"
 	"hostlink/cmd/hlctl/config"
@@ -18,14 +19,25 @@ func AgentCommand() *cli.Command {
 		Commands: []*cli.Command{
 			listAgentCommand(),
 			getAgentCommand(),
+			agentEventsCommand(),
+			agentAccessCommand("quarantine", "Stop handing an agent tasks; it keeps heartbeating and pushing metrics", (*client.HTTPClient).QuarantineAgent),
+			agentAccessCommand("release", "Lift an agent's quarantine", (*client.HTTPClient).ReleaseAgent),
+			agentAccessCommand("revoke", "Reject every further request of an agent, for good", (*client.HTTPClient).RevokeAgent),
+			agentTagCommand(),
 		},
 	}
 }
 
 func listAgentCommand() *cli.Command {
 	return &cli.Command{
-		Name:   "list",
-		Usage:  "List all agents",
+		Name:  "list",
+		Usage: "List all agents",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "status",
+				Usage: "Only list agents with this status (online, stale, offline)",
+			},
+		},
 		Action: listAgentAction,
 	}
 }
@@ -41,13 +53,17 @@ func listAgentAction(ctx context.Context, c *cli.Command) error {
 		serverURL = c.String("server")
 	}
 
-	httpClient := client.NewHTTPClient(serverURL)
+	httpClient := client.NewHTTPClient(serverURL).WithToken(cfg.GetToken())
 
 	agents, err := httpClient.ListAgents(nil)
 	if err != nil {
 		return fmt.Errorf("failed to list agents: %w", err)
 	}
 
+	if status := c.String("status"); status != "" {
+		agents = filterAgentsByStatus(agents, status)
+	}
+
 	formatter := output.NewJSONFormatter()
 	jsonOutput, err := formatter.Format(agents)
 	if err != nil {
@@ -84,7 +100,7 @@ func getAgentAction(ctx context.Context, c *cli.Command) error {
 		serverURL = c.String("server")
 	}
 
-	httpClient := client.NewHTTPClient(serverURL)
+	httpClient := client.NewHTTPClient(serverURL).WithToken(cfg.GetToken())
 
 	agent, err := httpClient.GetAgent(agentID)
 	if err != nil {
@@ -100,3 +116,213 @@ func getAgentAction(ctx context.Context, c *cli.Command) error {
 	fmt.Println(jsonOutput)
 	return nil
 }
+
+func filterAgentsByStatus(agents []client.Agent, status string) []client.Agent {
+	filtered := []client.Agent{}
+	for _, agent := range agents {
+		if agent.Status == status {
+			filtered = append(filtered, agent)
+		}
+	}
+	return filtered
+}
+
+func agentEventsCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "events",
+		Usage:     "List agent status transitions",
+		ArgsUsage: "<agent-id>",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "Maximum number of events to show",
+			},
+		},
+		Action: agentEventsAction,
+	}
+}
+
+func agentEventsAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("agent ID is required")
+	}
+
+	agentID := c.Args().Get(0)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	serverURL := cfg.GetServerURL()
+	if c.IsSet("server") {
+		serverURL = c.String("server")
+	}
+
+	httpClient := client.NewHTTPClient(serverURL).WithToken(cfg.GetToken())
+
+	events, err := httpClient.GetAgentEvents(agentID, c.Int("limit"))
+	if err != nil {
+		return fmt.Errorf("failed to get agent events: %w", err)
+	}
+
+	formatter := output.NewJSONFormatter()
+	jsonOutput, err := formatter.Format(events)
+	if err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+
+	fmt.Println(jsonOutput)
+	return nil
+}
+
+// agentAccessSetter changes an agent's access state, giving a reason.
+type agentAccessSetter func(c *client.HTTPClient, agentID, reason string) (*client.AgentAccess, error)
+
+// agentAccessCommand builds the command changing an agent's access state
+// with set.
+func agentAccessCommand(action, usage string, set agentAccessSetter) *cli.Command {
+	return &cli.Command{
+		Name:      action,
+		Usage:     usage,
+		ArgsUsage: "<agent-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "reason",
+				Usage: "Why the access changes, kept with the agent and in the audit log",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			return agentAccessAction(c, action, set)
+		},
+	}
+}
+
+func agentAccessAction(c *cli.Command, action string, set agentAccessSetter) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("agent ID is required")
+	}
+
+	httpClient, err := agentClient(c)
+	if err != nil {
+		return err
+	}
+
+	access, err := set(httpClient, c.Args().Get(0), c.String("reason"))
+	if err != nil {
+		return fmt.Errorf("failed to %s agent: %w", action, err)
+	}
+
+	return printJSON(access)
+}
+
+func agentTagCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "tag",
+		Usage: "Manage an agent's server tags",
+		Commands: []*cli.Command{
+			{
+				Name:      "list",
+				Usage:     "List an agent's tags, with their source",
+				ArgsUsage: "<agent-id>",
+				Action:    listAgentTagsAction,
+			},
+			{
+				Name:      "set",
+				Usage:     "Set server tags, which shadow the agent's own tags with the same key",
+				ArgsUsage: "<agent-id> <key=value>...",
+				Action:    setAgentTagsAction,
+			},
+			{
+				Name:      "unset",
+				Usage:     "Remove server tags",
+				ArgsUsage: "<agent-id> <key>...",
+				Action:    unsetAgentTagsAction,
+			},
+		},
+	}
+}
+
+func listAgentTagsAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("agent ID is required")
+	}
+
+	httpClient, err := agentClient(c)
+	if err != nil {
+		return err
+	}
+
+	tags, err := httpClient.ListAgentTags(c.Args().Get(0))
+	if err != nil {
+		return fmt.Errorf("failed to list agent tags: %w", err)
+	}
+
+	return printJSON(tags)
+}
+
+func setAgentTagsAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() < 2 {
+		return fmt.Errorf("agent ID and at least one key=value tag are required")
+	}
+	agentID := c.Args().Get(0)
+	pairs := c.Args().Slice()[1:]
+	for _, pair := range pairs {
+		if key, value, ok := strings.Cut(pair, "="); !ok || key == "" || value == "" {
+			return fmt.Errorf("invalid tag %q: must be key=value", pair)
+		}
+	}
+
+	httpClient, err := agentClient(c)
+	if err != nil {
+		return err
+	}
+
+	tags := make([]client.Tag, 0, len(pairs))
+	for _, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		tag, err := httpClient.SetAgentTag(agentID, key, value)
+		if err != nil {
+			return fmt.Errorf("failed to set tag %s: %w", key, err)
+		}
+		tags = append(tags, *tag)
+	}
+
+	return printJSON(tags)
+}
+
+func unsetAgentTagsAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() < 2 {
+		return fmt.Errorf("agent ID and at least one tag key are required")
+	}
+	agentID := c.Args().Get(0)
+
+	httpClient, err := agentClient(c)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range c.Args().Slice()[1:] {
+		if err := httpClient.DeleteAgentTag(agentID, key); err != nil {
+			return fmt.Errorf("failed to unset tag %s: %w", key, err)
+		}
+		fmt.Fprintf(c.Root().Writer, "Tag %s removed from agent %s\n", key, agentID)
+	}
+	return nil
+}
+
+// agentClient builds a client for the configured server, which --server
+// overrides, authenticated with the configured token.
+func agentClient(c *cli.Command) (*client.HTTPClient, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	serverURL := cfg.GetServerURL()
+	if c.IsSet("server") {
+		serverURL = c.String("server")
+	}
+
+	return client.NewHTTPClient(serverURL).WithToken(cfg.GetToken()), nil
+}
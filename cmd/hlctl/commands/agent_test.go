@@ -1,9 +1,18 @@
 package commands
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"hostlink/cmd/hlctl/client"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestListAgentCommand(t *testing.T) {
@@ -11,17 +20,42 @@ func TestListAgentCommand(t *testing.T) {
 
 	assert.Equal(t, "agent", cmd.Name)
 	assert.Equal(t, "Manage agents", cmd.Usage)
-	assert.Len(t, cmd.Commands, 2)
+	assert.Len(t, cmd.Commands, 7)
 
 	listCmd := cmd.Commands[0]
 	assert.Equal(t, "list", listCmd.Name)
 	assert.Equal(t, "List all agents", listCmd.Usage)
 }
 
+func TestListAgentCommand_HasStatusFlag(t *testing.T) {
+	listCmd := AgentCommand().Commands[0]
+
+	var names []string
+	for _, flag := range listCmd.Flags {
+		names = append(names, flag.Names()...)
+	}
+	assert.Contains(t, names, "status")
+}
+
+func TestFilterAgentsByStatus(t *testing.T) {
+	agents := []client.Agent{
+		{ID: "agt_1", Status: "online"},
+		{ID: "agt_2", Status: "offline"},
+		{ID: "agt_3", Status: "online"},
+	}
+
+	filtered := filterAgentsByStatus(agents, "online")
+
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, "agt_1", filtered[0].ID)
+	assert.Equal(t, "agt_3", filtered[1].ID)
+	assert.Empty(t, filterAgentsByStatus(agents, "stale"))
+}
+
 func TestGetAgentCommand(t *testing.T) {
 	cmd := AgentCommand()
 
-	assert.Len(t, cmd.Commands, 2)
+	assert.Len(t, cmd.Commands, 7)
 
 	getCmd := cmd.Commands[1]
 	assert.Equal(t, "get", getCmd.Name)
@@ -29,7 +63,99 @@ func TestGetAgentCommand(t *testing.T) {
 	assert.Equal(t, "<agent-id>", getCmd.ArgsUsage)
 }
 
+func TestAgentEventsCommand(t *testing.T) {
+	cmd := AgentCommand()
+
+	eventsCmd := cmd.Commands[2]
+	assert.Equal(t, "events", eventsCmd.Name)
+	assert.Equal(t, "<agent-id>", eventsCmd.ArgsUsage)
+}
+
 func TestGetAgentAction_ValidatesAgentID(t *testing.T) {
 	// This test is intentionally minimal as the validation happens at runtime
 	// Integration tests will cover the full validation flow
 }
+
+func TestAgentAccessActions(t *testing.T) {
+	for _, action := range []string{"quarantine", "release", "revoke"} {
+		t.Run(action, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			var body map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/api/v2/agents/agt_123/"+action, r.URL.Path)
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				w.Write([]byte(`{"id":"agt_123","access":"quarantined"}`))
+			}))
+			defer server.Close()
+
+			err := NewApp().Run(context.Background(), []string{
+				"hlctl", "--server", server.URL, "agent", action, "--reason", "incident 42", "agt_123",
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"reason": "incident 42"}, body)
+		})
+	}
+
+	t.Run("requires an agent ID", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+
+		err := NewApp().Run(context.Background(), []string{"hlctl", "agent", "revoke"})
+
+		assert.EqualError(t, err, "agent ID is required")
+	})
+}
+
+func TestAgentTagActions(t *testing.T) {
+	t.Run("sets each tag", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+		set := map[string]string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPut, r.Method)
+			key := strings.TrimPrefix(r.URL.Path, "/api/v2/agents/agt_123/tags/")
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			set[key] = body["value"]
+			json.NewEncoder(w).Encode(client.Tag{Key: key, Value: body["value"], Source: "server"})
+		}))
+		defer server.Close()
+
+		err := NewApp().Run(context.Background(), []string{
+			"hlctl", "--server", server.URL, "agent", "tag", "set", "agt_123", "env=prod", "team=ops=core",
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"env": "prod", "team": "ops=core"}, set)
+	})
+
+	t.Run("unsets each tag", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+		var deleted []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodDelete, r.Method)
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/api/v2/agents/agt_123/tags/"))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		var out bytes.Buffer
+		app := NewApp()
+		app.Writer = &out
+
+		err := app.Run(context.Background(), []string{
+			"hlctl", "--server", server.URL, "agent", "tag", "unset", "agt_123", "env", "team",
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"env", "team"}, deleted)
+		assert.Equal(t, "Tag env removed from agent agt_123\nTag team removed from agent agt_123\n", out.String())
+	})
+
+	t.Run("rejects a tag that is not key=value", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+
+		err := NewApp().Run(context.Background(), []string{"hlctl", "agent", "tag", "set", "agt_123", "env"})
+
+		assert.EqualError(t, err, `invalid tag "env": must be key=value`)
+	})
+}
@@ -0,0 +1,185 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"hostlink/cmd/hlctl/client"
+	"hostlink/cmd/hlctl/config"
+
+	"github.com/urfave/cli/v3"
+)
+
+// AuditCommand returns the audit command with subcommands
+func AuditCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "audit",
+		Usage: "Query, export and verify the audit log",
+		Commands: []*cli.Command{
+			listAuditCommand(),
+			exportAuditCommand(),
+			verifyAuditCommand(),
+		},
+	}
+}
+
+// auditFilterFlags are the filters list and export share
+func auditFilterFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "actor",
+			Usage: "Only entries by this operator or agent ID",
+		},
+		&cli.StringFlag{
+			Name:  "action",
+			Usage: "Only entries of this action (e.g. task.create)",
+		},
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "Only entries acting on this ID",
+		},
+		&cli.StringFlag{
+			Name:  "outcome",
+			Usage: "Only entries with this outcome (success, failure, denied)",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "Only entries at or after this time (RFC 3339)",
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: "Only entries before this time (RFC 3339)",
+		},
+	}
+}
+
+func auditFilters(c *cli.Command) *client.AuditFilters {
+	return &client.AuditFilters{
+		Actor:   c.String("actor"),
+		Action:  c.String("action"),
+		Target:  c.String("target"),
+		Outcome: c.String("outcome"),
+		Since:   c.String("since"),
+		Until:   c.String("until"),
+	}
+}
+
+func listAuditCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "List audit log entries, newest first",
+		Flags: append(auditFilterFlags(),
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "Maximum number of entries to show (default: 100)",
+			},
+			&cli.Int64Flag{
+				Name:  "before",
+				Usage: "Only entries before this sequence, to page back",
+			},
+		),
+		Action: listAuditAction,
+	}
+}
+
+func listAuditAction(ctx context.Context, c *cli.Command) error {
+	httpClient, err := auditClient(c)
+	if err != nil {
+		return err
+	}
+
+	filters := auditFilters(c)
+	filters.Limit = c.Int("limit")
+	filters.Before = c.Int64("before")
+	entries, err := httpClient.ListAuditEntries(filters)
+	if err != nil {
+		return fmt.Errorf("failed to list audit log: %w", err)
+	}
+
+	return printJSON(entries)
+}
+
+func exportAuditCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "export",
+		Usage: "Export audit log entries as JSON lines, oldest first",
+		Flags: append(auditFilterFlags(),
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "File to write the export to (default: stdout)",
+			},
+		),
+		Action: exportAuditAction,
+	}
+}
+
+func exportAuditAction(ctx context.Context, c *cli.Command) error {
+	httpClient, err := auditClient(c)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = c.Root().Writer
+	if path := c.String("output"); path != "" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := httpClient.ExportAuditLog(auditFilters(c), w); err != nil {
+		return fmt.Errorf("failed to export audit log: %w", err)
+	}
+	return nil
+}
+
+func verifyAuditCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "verify",
+		Usage:  "Check the audit log's hash chain for tampering",
+		Action: verifyAuditAction,
+	}
+}
+
+func verifyAuditAction(ctx context.Context, c *cli.Command) error {
+	httpClient, err := auditClient(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := httpClient.VerifyAuditLog()
+	if err != nil {
+		return fmt.Errorf("failed to verify audit log: %w", err)
+	}
+
+	if !result.Valid {
+		return fmt.Errorf("audit log is broken at entry %d: %s", result.BrokenAt, result.Error)
+	}
+	if result.Entries == 0 {
+		fmt.Fprintln(c.Root().Writer, "Audit log is empty")
+		return nil
+	}
+	fmt.Fprintf(c.Root().Writer, "Audit log intact: %d entries, head %s\n", result.Entries, result.Head)
+	return nil
+}
+
+// auditClient builds a client for the configured server, which --server
+// overrides, authenticated with the configured token.
+func auditClient(c *cli.Command) (*client.HTTPClient, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	serverURL := cfg.GetServerURL()
+	if c.IsSet("server") {
+		serverURL = c.String("server")
+	}
+
+	return client.NewHTTPClient(serverURL).WithToken(cfg.GetToken()), nil
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditCommand(t *testing.T) {
+	cmd := AuditCommand()
+
+	assert.Equal(t, "audit", cmd.Name)
+
+	var names []string
+	for _, sub := range cmd.Commands {
+		names = append(names, sub.Name)
+	}
+	assert.Equal(t, []string{"list", "export", "verify"}, names)
+}
+
+func TestListAuditAction_SendsFilters(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/audit", r.URL.Path)
+		assert.Equal(t, "opr_1", r.URL.Query().Get("actor"))
+		assert.Equal(t, "denied", r.URL.Query().Get("outcome"))
+		assert.Equal(t, "20", r.URL.Query().Get("limit"))
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	err := NewApp().Run(context.Background(), []string{
+		"hlctl", "--server", server.URL, "audit", "list", "--actor", "opr_1", "--outcome", "denied", "--limit", "20",
+	})
+
+	require.NoError(t, err)
+}
+
+func TestExportAuditAction_WritesFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/audit/export", r.URL.Path)
+		assert.Equal(t, "2026-01-01T00:00:00Z", r.URL.Query().Get("since"))
+		w.Write([]byte("{\"sequence\":1}\n"))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	err := NewApp().Run(context.Background(), []string{
+		"hlctl", "--server", server.URL, "audit", "export", "--since", "2026-01-01T00:00:00Z", "--output", path,
+	})
+
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "{\"sequence\":1}\n", string(data))
+}
+
+func TestVerifyAuditAction(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	t.Run("reports an intact log", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"valid":true,"entries":12,"head":"abc123"}`))
+		}))
+		defer server.Close()
+
+		var out bytes.Buffer
+		app := NewApp()
+		app.Writer = &out
+		err := app.Run(context.Background(), []string{"hlctl", "--server", server.URL, "audit", "verify"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "Audit log intact: 12 entries, head abc123\n", out.String())
+	})
+
+	t.Run("fails on a broken chain", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"valid":false,"entries":3,"broken_at":4,"error":"audit chain broken: entry 4 does not match its hash"}`))
+		}))
+		defer server.Close()
+
+		err := NewApp().Run(context.Background(), []string{"hlctl", "--server", server.URL, "audit", "verify"})
+
+		assert.EqualError(t, err, "audit log is broken at entry 4: audit chain broken: entry 4 does not match its hash")
+	})
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"hostlink/cmd/hlctl/client"
+	"hostlink/cmd/hlctl/config"
+
+	"github.com/urfave/cli/v3"
+)
+
+// LoginCommand returns the login command
+func LoginCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "login",
+		Usage: "Save an operator API token to ~/.hostlink/config.yml",
+		Description: "The token is read from --token, or from standard input when the flag is omitted. " +
+			"It is checked against the server before it is saved, and --server is saved along with it.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "token",
+				Usage: "Operator API token",
+			},
+		},
+		Action: loginAction,
+	}
+}
+
+func loginAction(ctx context.Context, c *cli.Command) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	serverURL := cfg.GetServerURL()
+	if c.IsSet("server") {
+		serverURL = c.String("server")
+	}
+
+	token := c.String("token")
+	if token == "" {
+		fmt.Fprint(c.Root().ErrWriter, "Token: ")
+		line, err := bufio.NewReader(c.Root().Reader).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read token: %w", err)
+		}
+		token = strings.TrimSpace(line)
+	}
+	if token == "" {
+		return fmt.Errorf("token is required")
+	}
+
+	operator, err := client.NewHTTPClient(serverURL).WithToken(token).GetCurrentOperator()
+	if err != nil {
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+
+	cfg.Token = token
+	if c.IsSet("server") {
+		cfg.ServerURL = serverURL
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	scope := ""
+	if len(operator.Scope) > 0 {
+		scope = ", scope " + strings.Join(operator.Scope, ",")
+	}
+	fmt.Fprintf(c.Root().Writer, "Logged in to %s as %s (%s%s)\n", serverURL, operator.Name, operator.Role, scope)
+	return nil
+}
+
+// LogoutCommand returns the logout command
+func LogoutCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "logout",
+		Usage:  "Remove the saved operator API token",
+		Action: logoutAction,
+	}
+}
+
+func logoutAction(ctx context.Context, c *cli.Command) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	cfg.Token = ""
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Fprintln(c.Root().Writer, "Logged out")
+	return nil
+}
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hostlink/cmd/hlctl/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOperatorServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/operators/me", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"authentication failed"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"opr_1","name":"alice","role":"operator","scope":["env=staging"]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLoginAction_SavesTokenAndServer(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("HOSTLINK_SERVER_URL", "")
+	t.Setenv("HOSTLINK_API_TOKEN", "")
+	server := newOperatorServer(t, "hlo_secret")
+
+	var out bytes.Buffer
+	app := NewApp()
+	app.Writer = &out
+	err := app.Run(context.Background(), []string{"hlctl", "--server", server.URL, "login", "--token", "hlo_secret"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Logged in to "+server.URL+" as alice (operator, scope env=staging)\n", out.String())
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.Equal(t, server.URL, cfg.GetServerURL())
+	assert.Equal(t, "hlo_secret", cfg.GetToken())
+}
+
+func TestLoginAction_ReadsTokenFromStdin(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("HOSTLINK_API_TOKEN", "")
+	server := newOperatorServer(t, "hlo_secret")
+
+	app := NewApp()
+	app.Reader = strings.NewReader("hlo_secret\n")
+	app.Writer = &bytes.Buffer{}
+	app.ErrWriter = &bytes.Buffer{}
+	err := app.Run(context.Background(), []string{"hlctl", "--server", server.URL, "login"})
+
+	require.NoError(t, err)
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "hlo_secret", cfg.GetToken())
+}
+
+func TestLoginAction_RejectsInvalidToken(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	server := newOperatorServer(t, "hlo_secret")
+
+	err := NewApp().Run(context.Background(), []string{"hlctl", "--server", server.URL, "login", "--token", "hlo_wrong"})
+
+	assert.ErrorContains(t, err, "status 401")
+	_, statErr := os.Stat(filepath.Join(home, ".hostlink", "config.yml"))
+	assert.True(t, os.IsNotExist(statErr), "config should not be written")
+}
+
+func TestLogoutAction_RemovesToken(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("HOSTLINK_SERVER_URL", "")
+	t.Setenv("HOSTLINK_API_TOKEN", "")
+	require.NoError(t, (&config.Config{ServerURL: "http://saved.example.com", Token: "hlo_secret"}).Save())
+
+	app := NewApp()
+	app.Writer = &bytes.Buffer{}
+	require.NoError(t, app.Run(context.Background(), []string{"hlctl", "logout"}))
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.GetToken())
+	assert.Equal(t, "http://saved.example.com", cfg.GetServerURL())
+}
+
+func TestCommands_SendSavedToken(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("HOSTLINK_API_TOKEN", "")
+	require.NoError(t, (&config.Config{Token: "hlo_saved"}).Save())
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	app := NewApp()
+	app.Writer = &bytes.Buffer{}
+	err := app.Run(context.Background(), []string{"hlctl", "--server", server.URL, "webhook", "list"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer hlo_saved", authorization)
+}
@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"hostlink/cmd/hlctl/client"
+	"hostlink/cmd/hlctl/config"
+	"hostlink/cmd/hlctl/output"
+
+	"github.com/urfave/cli/v3"
+)
+
+// MetricsCommand returns the metrics command
+func MetricsCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "metrics",
+		Usage:     "Query aggregated agent metrics",
+		ArgsUsage: "<agent-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "type",
+				Usage:    "Metric set type (e.g. system, storage, container)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "from",
+				Usage: "Start of the range (RFC 3339, default: one hour before --to)",
+			},
+			&cli.StringFlag{
+				Name:  "to",
+				Usage: "End of the range (RFC 3339, default: now)",
+			},
+			&cli.StringFlag{
+				Name:  "step",
+				Usage: "Aggregation step (e.g. 1m, 5m, 1h, default: chosen from the range)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "attribute",
+				Usage: "Filter series by attribute (repeatable, format: key=value)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "field",
+				Usage: "Only return these metric fields (repeatable)",
+			},
+		},
+		Action: metricsAction,
+	}
+}
+
+func metricsAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("agent ID is required")
+	}
+
+	agentID := c.Args().Get(0)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	serverURL := cfg.GetServerURL()
+	if c.IsSet("server") {
+		serverURL = c.String("server")
+	}
+
+	httpClient := client.NewHTTPClient(serverURL).WithToken(cfg.GetToken())
+
+	metrics, err := httpClient.GetMetrics(agentID, &client.MetricsRequest{
+		Type:       c.String("type"),
+		From:       c.String("from"),
+		To:         c.String("to"),
+		Step:       c.String("step"),
+		Attributes: c.StringSlice("attribute"),
+		Fields:     c.StringSlice("field"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get metrics: %w", err)
+	}
+
+	formatter := output.NewJSONFormatter()
+	jsonOutput, err := formatter.Format(metrics)
+	if err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+
+	fmt.Println(jsonOutput)
+	return nil
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsCommand(t *testing.T) {
+	cmd := MetricsCommand()
+
+	assert.Equal(t, "metrics", cmd.Name)
+	assert.Equal(t, "Query aggregated agent metrics", cmd.Usage)
+	assert.Equal(t, "<agent-id>", cmd.ArgsUsage)
+}
+
+func TestMetricsAction_QueriesServer(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/agents/agt_123/metrics", r.URL.Path)
+		query = r.URL.Query()
+		w.Write([]byte(`{"agent_id":"agt_123","type":"system","resolution":"1m","series":[]}`))
+	}))
+	defer server.Close()
+
+	err := NewApp().Run(context.Background(), []string{
+		"hlctl", "--server", server.URL, "metrics", "--type", "system", "--step", "1m", "--attribute", "mount_point=/", "agt_123",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"system"}, query["type"])
+	assert.Equal(t, []string{"1m"}, query["step"])
+	assert.Equal(t, []string{"mount_point=/"}, query["attribute"])
+}
+
+func TestMetricsAction_RequiresAgentID(t *testing.T) {
+	err := NewApp().Run(context.Background(), []string{"hlctl", "metrics", "--type", "system"})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "agent ID is required")
+}
@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"hostlink/cmd/hlctl/client"
+	"hostlink/cmd/hlctl/config"
+
+	"github.com/urfave/cli/v3"
+)
+
+// RegistrationCommand returns the registration command with subcommands
+func RegistrationCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "registration",
+		Usage: "Approve agent registrations held because they look like a clone or a replacement of an agent",
+		Commands: []*cli.Command{
+			listRegistrationCommand(),
+			approveRegistrationCommand(),
+		},
+	}
+}
+
+func listRegistrationCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "List held registrations",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "status",
+				Usage: "Only list registrations with this status (pending_approval, approved_replacement, approved_new, all)",
+			},
+		},
+		Action: listRegistrationAction,
+	}
+}
+
+func listRegistrationAction(ctx context.Context, c *cli.Command) error {
+	httpClient, err := registrationClient(c)
+	if err != nil {
+		return err
+	}
+
+	registrations, err := httpClient.ListRegistrations(c.String("status"))
+	if err != nil {
+		return fmt.Errorf("failed to list registrations: %w", err)
+	}
+
+	return printJSON(registrations)
+}
+
+func approveRegistrationCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "approve",
+		Usage:     "Approve a held registration; the agent registers on its next attempt",
+		ArgsUsage: "<registration-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "as",
+				Usage:    "replacement (the host takes over the candidate agent's ID, tags and history) or new",
+				Required: true,
+			},
+		},
+		Action: approveRegistrationAction,
+	}
+}
+
+func approveRegistrationAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("registration ID is required")
+	}
+	as := c.String("as")
+	if as != "replacement" && as != "new" {
+		return fmt.Errorf(`--as must be "replacement" or "new"`)
+	}
+
+	httpClient, err := registrationClient(c)
+	if err != nil {
+		return err
+	}
+
+	approval, err := httpClient.ApproveRegistration(c.Args().Get(0), as)
+	if err != nil {
+		return fmt.Errorf("failed to approve registration: %w", err)
+	}
+
+	return printJSON(approval)
+}
+
+// registrationClient builds a client for the configured server, which
+// --server overrides, authenticated with the configured token.
+func registrationClient(c *cli.Command) (*client.HTTPClient, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	serverURL := cfg.GetServerURL()
+	if c.IsSet("server") {
+		serverURL = c.String("server")
+	}
+
+	return client.NewHTTPClient(serverURL).WithToken(cfg.GetToken()), nil
+}
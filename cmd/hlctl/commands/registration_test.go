@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrationCommand(t *testing.T) {
+	cmd := RegistrationCommand()
+
+	assert.Equal(t, "registration", cmd.Name)
+
+	var names []string
+	for _, sub := range cmd.Commands {
+		names = append(names, sub.Name)
+	}
+	assert.Equal(t, []string{"list", "approve"}, names)
+}
+
+func TestListRegistrationAction_PassesStatus(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/registrations", r.URL.Path)
+		assert.Equal(t, "all", r.URL.Query().Get("status"))
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	err := NewApp().Run(context.Background(), []string{"hlctl", "--server", server.URL, "registration", "list", "--status", "all"})
+
+	require.NoError(t, err)
+}
+
+func TestApproveRegistrationAction(t *testing.T) {
+	t.Run("approves the registration", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+		var body map[string]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "/api/v2/registrations/reg_123/approve", r.URL.Path)
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			w.Write([]byte(`{"id":"reg_123","status":"approved_new","agent_id":"agt_456"}`))
+		}))
+		defer server.Close()
+
+		err := NewApp().Run(context.Background(), []string{"hlctl", "--server", server.URL, "registration", "approve", "reg_123", "--as", "new"})
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"as": "new"}, body)
+	})
+
+	t.Run("requires a registration ID", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+
+		err := NewApp().Run(context.Background(), []string{"hlctl", "registration", "approve", "--as", "new"})
+
+		assert.EqualError(t, err, "registration ID is required")
+	})
+
+	t.Run("rejects an unknown choice", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+
+		err := NewApp().Run(context.Background(), []string{"hlctl", "registration", "approve", "reg_123", "--as", "clone"})
+
+		assert.EqualError(t, err, `--as must be "replacement" or "new"`)
+	})
+}
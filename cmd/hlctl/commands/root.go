@@ -21,6 +21,13 @@ func NewApp() *cli.Command {
 		Commands: []*cli.Command{
 			TaskCommand(),
 			AgentCommand(),
+			MetricsCommand(),
+			WebhookCommand(),
+			AuditCommand(),
+			TokenCommand(),
+			RegistrationCommand(),
+			LoginCommand(),
+			LogoutCommand(),
 		},
 	}
 }
@@ -2,8 +2,11 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"hostlink/cmd/hlctl/client"
 	"hostlink/cmd/hlctl/config"
@@ -21,10 +24,32 @@ func TaskCommand() *cli.Command {
 			createTaskCommand(),
 			listTaskCommand(),
 			getTaskCommand(),
+			logsTaskCommand(),
+			cancelTaskCommand(),
 		},
 	}
 }
 
+// followRetries is how many times in a row following a task may fail to
+// receive anything before giving up.
+const followRetries = 5
+
+// followRetryDelay is how long to wait before reconnecting a cut-off task
+// stream.
+var followRetryDelay = time.Second
+
+// TaskExitError reports that a waited-for task did not complete
+// successfully. hlctl exits with Code.
+type TaskExitError struct {
+	TaskID string
+	Status string
+	Code   int
+}
+
+func (e *TaskExitError) Error() string {
+	return fmt.Sprintf("task %s %s with exit code %d", e.TaskID, e.Status, e.Code)
+}
+
 // createTaskCommand returns the create subcommand
 func createTaskCommand() *cli.Command {
 	return &cli.Command{
@@ -48,6 +73,18 @@ func createTaskCommand() *cli.Command {
 				Usage: "Task priority",
 				Value: 1,
 			},
+			&cli.StringSliceFlag{
+				Name:  "env-secret",
+				Usage: "Inject the agent's named secret as an upper-case environment variable (repeatable)",
+			},
+			&cli.BoolFlag{
+				Name:  "wait",
+				Usage: "Wait for the task to finish, print its details and exit with its exit code",
+			},
+			&cli.BoolFlag{
+				Name:  "follow",
+				Usage: "Print the task's output live until it finishes and exit with its exit code",
+			},
 		},
 		Action: createTaskAction,
 	}
@@ -69,7 +106,7 @@ func createTaskAction(ctx context.Context, c *cli.Command) error {
 		serverURL = c.String("server")
 	}
 
-	httpClient := client.NewHTTPClient(serverURL)
+	httpClient := client.NewHTTPClient(serverURL).WithToken(cfg.GetToken())
 
 	command := c.String("command")
 	if c.IsSet("file") {
@@ -96,9 +133,10 @@ func createTaskAction(ctx context.Context, c *cli.Command) error {
 	}
 
 	req := &client.CreateTaskRequest{
-		Command:  command,
-		Priority: priority,
-		AgentIDs: agentIDs,
+		Command:    command,
+		Priority:   priority,
+		AgentIDs:   agentIDs,
+		EnvSecrets: c.StringSlice("env-secret"),
 	}
 
 	resp, err := httpClient.CreateTask(req)
@@ -106,6 +144,14 @@ func createTaskAction(ctx context.Context, c *cli.Command) error {
 		return fmt.Errorf("failed to create task: %w", err)
 	}
 
+	if c.Bool("follow") {
+		fmt.Fprintf(os.Stderr, "Task %s created\n", resp.ID)
+		return followTask(ctx, httpClient, resp.ID, 0, os.Stdout, os.Stderr)
+	}
+	if c.Bool("wait") {
+		return waitForTask(ctx, httpClient, resp.ID)
+	}
+
 	formatter := output.NewJSONFormatter()
 	jsonOutput, err := formatter.Format(resp)
 	if err != nil {
@@ -172,7 +218,7 @@ func listTaskAction(ctx context.Context, c *cli.Command) error {
 		serverURL = c.String("server")
 	}
 
-	httpClient := client.NewHTTPClient(serverURL)
+	httpClient := client.NewHTTPClient(serverURL).WithToken(cfg.GetToken())
 
 	filters := &client.ListTasksRequest{}
 	if c.IsSet("status") {
@@ -225,7 +271,7 @@ func getTaskAction(ctx context.Context, c *cli.Command) error {
 		serverURL = c.String("server")
 	}
 
-	httpClient := client.NewHTTPClient(serverURL)
+	httpClient := client.NewHTTPClient(serverURL).WithToken(cfg.GetToken())
 
 	task, err := httpClient.GetTask(taskID)
 	if err != nil {
@@ -241,3 +287,182 @@ func getTaskAction(ctx context.Context, c *cli.Command) error {
 	fmt.Println(jsonOutput)
 	return nil
 }
+
+func cancelTaskCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "cancel",
+		Usage:     "Cancel a task that has not finished",
+		ArgsUsage: "<task-id>",
+		Action:    cancelTaskAction,
+	}
+}
+
+// cancelTaskAction handles the cancel task command
+func cancelTaskAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("task ID is required")
+	}
+
+	httpClient, err := agentClient(c)
+	if err != nil {
+		return err
+	}
+
+	task, err := httpClient.CancelTask(c.Args().Get(0))
+	if err != nil {
+		return fmt.Errorf("failed to cancel task: %w", err)
+	}
+
+	return printJSON(task)
+}
+
+// logsTaskCommand returns the logs subcommand
+func logsTaskCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "logs",
+		Usage:     "Print task output",
+		ArgsUsage: "<task-id>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "follow",
+				Aliases: []string{"f"},
+				Usage:   "Keep printing output until the task finishes and exit with its exit code",
+			},
+			&cli.Int64Flag{
+				Name:  "since",
+				Usage: "Only print output after this sequence number",
+			},
+		},
+		Action: logsTaskAction,
+	}
+}
+
+// logsTaskAction handles the logs task command
+func logsTaskAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("task ID is required")
+	}
+
+	taskID := c.Args().Get(0)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	serverURL := cfg.GetServerURL()
+	if c.IsSet("server") {
+		serverURL = c.String("server")
+	}
+
+	httpClient := client.NewHTTPClient(serverURL).WithToken(cfg.GetToken())
+
+	if c.Bool("follow") {
+		return followTask(ctx, httpClient, taskID, c.Int64("since"), os.Stdout, os.Stderr)
+	}
+
+	chunks, err := httpClient.GetTaskOutput(taskID, c.Int64("since"))
+	if err != nil {
+		return fmt.Errorf("failed to get task output: %w", err)
+	}
+	for _, chunk := range chunks {
+		writeOutput(os.Stdout, os.Stderr, chunk.Stream, chunk.Data)
+	}
+	return nil
+}
+
+// followTask prints a task's output as it streams in until the task
+// finishes, resuming after the last chunk printed when the stream is cut
+// off. It returns a *TaskExitError unless the task completed with exit
+// code 0.
+func followTask(ctx context.Context, httpClient client.Client, taskID string, since int64, stdout, stderr io.Writer) error {
+	var done *client.TaskEvent
+	failures := 0
+	for {
+		received := false
+		err := httpClient.StreamTask(ctx, taskID, since, func(event client.TaskEvent) error {
+			received = true
+			switch event.Type {
+			case client.TaskEventOutput:
+				writeOutput(stdout, stderr, event.Stream, event.Data)
+				since = event.Sequence
+			case client.TaskEventDone:
+				done = &event
+			}
+			return nil
+		})
+		if done != nil {
+			return taskExitError(taskID, done.Status, done.ExitCode)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+			return fmt.Errorf("failed to follow task: %w", err)
+		}
+		if received {
+			failures = 0
+		} else {
+			failures++
+		}
+		if failures >= followRetries {
+			if err == nil {
+				err = fmt.Errorf("stream ended before the task finished")
+			}
+			return fmt.Errorf("failed to follow task: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(followRetryDelay):
+		}
+	}
+}
+
+// waitForTask waits for a task to finish without printing its output, then
+// prints its details.
+func waitForTask(ctx context.Context, httpClient client.Client, taskID string) error {
+	err := followTask(ctx, httpClient, taskID, 0, io.Discard, io.Discard)
+	var exitErr *TaskExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+
+	details, getErr := httpClient.GetTask(taskID)
+	if getErr != nil {
+		return fmt.Errorf("failed to get task: %w", getErr)
+	}
+
+	formatter := output.NewJSONFormatter()
+	jsonOutput, formatErr := formatter.Format(details)
+	if formatErr != nil {
+		return fmt.Errorf("failed to format output: %w", formatErr)
+	}
+
+	fmt.Println(jsonOutput)
+	return err
+}
+
+// taskExitError returns nil for a task that completed with exit code 0.
+// Any other finished task is an error whose code is at least 1.
+func taskExitError(taskID, status string, exitCode int) error {
+	if status == "completed" && exitCode == 0 {
+		return nil
+	}
+	if exitCode == 0 {
+		exitCode = 1
+	}
+	return &TaskExitError{TaskID: taskID, Status: status, Code: exitCode}
+}
+
+// writeOutput writes a chunk of task output to the matching stream.
+func writeOutput(stdout, stderr io.Writer, stream, data string) {
+	if stream == "stderr" {
+		io.WriteString(stderr, data)
+		return
+	}
+	io.WriteString(stdout, data)
+}
@@ -1,9 +1,17 @@
 package commands
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"hostlink/cmd/hlctl/client"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -68,3 +76,90 @@ func createTempScriptFile(t *testing.T, content string) string {
 
 	return filePath
 }
+
+func TestFollowTask_ResumesAfterLastChunk(t *testing.T) {
+	followRetryDelay = time.Millisecond
+	t.Cleanup(func() { followRetryDelay = time.Second })
+
+	var sinces []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sinces = append(sinces, r.URL.Query().Get("since"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		if len(sinces) == 1 {
+			// Cut off before the task finishes.
+			w.Write([]byte("id: 1\nevent: output\ndata: {\"sequence\":1,\"stream\":\"stdout\",\"data\":\"one\\n\"}\n\n"))
+			return
+		}
+		w.Write([]byte("id: 2\nevent: output\ndata: {\"sequence\":2,\"stream\":\"stderr\",\"data\":\"two\\n\"}\n\n" +
+			"event: done\ndata: {\"status\":\"completed\",\"exit_code\":3}\n\n"))
+	}))
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	err := followTask(context.Background(), client.NewHTTPClient(server.URL), "tsk_123", 0, &stdout, &stderr)
+
+	var exitErr *TaskExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.Code)
+	assert.Equal(t, []string{"", "1"}, sinces)
+	assert.Equal(t, "one\n", stdout.String())
+	assert.Equal(t, "two\n", stderr.String())
+}
+
+func TestFollowTask_DoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	err := followTask(context.Background(), client.NewHTTPClient(server.URL), "tsk_missing", 0, io.Discard, io.Discard)
+
+	assert.ErrorContains(t, err, "status 404")
+	assert.Equal(t, 1, requests)
+}
+
+func TestTaskExitError(t *testing.T) {
+	assert.NoError(t, taskExitError("tsk_1", "completed", 0))
+
+	var exitErr *TaskExitError
+	require.ErrorAs(t, taskExitError("tsk_1", "completed", 2), &exitErr)
+	assert.Equal(t, 2, exitErr.Code)
+	require.ErrorAs(t, taskExitError("tsk_1", "timed_out", 0), &exitErr)
+	assert.Equal(t, 1, exitErr.Code)
+}
+
+func TestLogsTaskAction_PrintsOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/tasks/tsk_123/output", r.URL.Path)
+		assert.Equal(t, "7", r.URL.Query().Get("since"))
+		w.Write([]byte(`[{"sequence":8,"stream":"stdout","data":"hi\n"}]`))
+	}))
+	defer server.Close()
+
+	err := NewApp().Run(context.Background(), []string{
+		"hlctl", "--server", server.URL, "task", "logs", "--since", "7", "tsk_123",
+	})
+
+	require.NoError(t, err)
+}
+
+func TestCancelTaskAction(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v2/tasks/tsk_123/cancel", r.URL.Path)
+		w.Write([]byte(`{"id":"tsk_123","status":"cancelled"}`))
+	}))
+	defer server.Close()
+
+	err := NewApp().Run(context.Background(), []string{
+		"hlctl", "--server", server.URL, "task", "cancel", "tsk_123",
+	})
+	require.NoError(t, err)
+
+	err = NewApp().Run(context.Background(), []string{"hlctl", "task", "cancel"})
+	assert.EqualError(t, err, "task ID is required")
+}
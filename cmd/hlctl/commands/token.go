@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"hostlink/cmd/hlctl/client"
+	"hostlink/cmd/hlctl/config"
+
+	"github.com/urfave/cli/v3"
+)
+
+// TokenCommand returns the token command with subcommands
+func TokenCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "token",
+		Usage: "Manage the enrollment tokens agents register with",
+		Commands: []*cli.Command{
+			createTokenCommand(),
+			listTokenCommand(),
+			revokeTokenCommand(),
+		},
+	}
+}
+
+func createTokenCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "create",
+		Usage: "Create an enrollment token and print its key, which is not shown again",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "Name of the token",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "tag",
+				Usage: "Tag applied to agents registering with the token (repeatable, key=value)",
+			},
+			&cli.IntFlag{
+				Name:  "max-uses",
+				Usage: "Number of agents the token may register (0 for unlimited)",
+			},
+			&cli.StringFlag{
+				Name:  "expires-in",
+				Usage: "Duration until the token expires, e.g. 72h (never when omitted)",
+			},
+		},
+		Action: createTokenAction,
+	}
+}
+
+func createTokenAction(ctx context.Context, c *cli.Command) error {
+	httpClient, err := tokenClient(c)
+	if err != nil {
+		return err
+	}
+
+	token, err := httpClient.CreateEnrollmentToken(&client.EnrollmentTokenRequest{
+		Name:      c.String("name"),
+		Tags:      c.StringSlice("tag"),
+		MaxUses:   c.Int("max-uses"),
+		ExpiresIn: c.String("expires-in"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return printJSON(token)
+}
+
+func listTokenCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "list",
+		Usage:  "List enrollment tokens",
+		Action: listTokenAction,
+	}
+}
+
+func listTokenAction(ctx context.Context, c *cli.Command) error {
+	httpClient, err := tokenClient(c)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := httpClient.ListEnrollmentTokens()
+	if err != nil {
+		return fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	return printJSON(tokens)
+}
+
+func revokeTokenCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "revoke",
+		Usage:     "Stop a token from registering further agents",
+		ArgsUsage: "<token-id>",
+		Action:    revokeTokenAction,
+	}
+}
+
+func revokeTokenAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("token ID is required")
+	}
+
+	httpClient, err := tokenClient(c)
+	if err != nil {
+		return err
+	}
+
+	tokenID := c.Args().Get(0)
+	if err := httpClient.RevokeEnrollmentToken(tokenID); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	fmt.Fprintf(c.Root().Writer, "Token %s revoked\n", tokenID)
+	return nil
+}
+
+// tokenClient builds a client for the configured server, which --server
+// overrides, authenticated with the configured token.
+func tokenClient(c *cli.Command) (*client.HTTPClient, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	serverURL := cfg.GetServerURL()
+	if c.IsSet("server") {
+		serverURL = c.String("server")
+	}
+
+	return client.NewHTTPClient(serverURL).WithToken(cfg.GetToken()), nil
+}
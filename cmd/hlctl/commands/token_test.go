@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenCommand(t *testing.T) {
+	cmd := TokenCommand()
+
+	assert.Equal(t, "token", cmd.Name)
+
+	var names []string
+	for _, sub := range cmd.Commands {
+		names = append(names, sub.Name)
+	}
+	assert.Equal(t, []string{"create", "list", "revoke"}, names)
+}
+
+func TestCreateTokenAction_SendsTagsAndLimits(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v2/enrollment-tokens", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"enr_123","name":"staging","key":"hle_secret"}`))
+	}))
+	defer server.Close()
+
+	err := NewApp().Run(context.Background(), []string{
+		"hlctl", "--server", server.URL, "token", "create",
+		"--name", "staging", "--tag", "env=staging", "--tag", "team=web", "--max-uses", "10", "--expires-in", "72h",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"name":       "staging",
+		"tags":       []any{"env=staging", "team=web"},
+		"max_uses":   float64(10),
+		"expires_in": "72h",
+	}, body)
+}
+
+func TestRevokeTokenAction(t *testing.T) {
+	t.Run("revokes the token", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodDelete, r.Method)
+			assert.Equal(t, "/api/v2/enrollment-tokens/enr_123", r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		var out bytes.Buffer
+		app := NewApp()
+		app.Writer = &out
+
+		err := app.Run(context.Background(), []string{"hlctl", "--server", server.URL, "token", "revoke", "enr_123"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "Token enr_123 revoked\n", out.String())
+	})
+
+	t.Run("requires a token ID", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+
+		err := NewApp().Run(context.Background(), []string{"hlctl", "token", "revoke"})
+
+		assert.EqualError(t, err, "token ID is required")
+	})
+}
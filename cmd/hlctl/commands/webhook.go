@@ -0,0 +1,302 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"hostlink/cmd/hlctl/client"
+	"hostlink/cmd/hlctl/config"
+	"hostlink/cmd/hlctl/output"
+
+	"github.com/urfave/cli/v3"
+)
+
+// WebhookCommand returns the webhook command with subcommands
+func WebhookCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "webhook",
+		Usage: "Manage webhook subscriptions",
+		Commands: []*cli.Command{
+			createWebhookCommand(),
+			listWebhookCommand(),
+			getWebhookCommand(),
+			updateWebhookCommand(),
+			deleteWebhookCommand(),
+			webhookDeliveriesCommand(),
+		},
+	}
+}
+
+func createWebhookCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "create",
+		Usage: "Subscribe a URL to events",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "url",
+				Usage:    "URL the events are posted to",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "event",
+				Usage:    "Event to subscribe to (repeatable, e.g. task.failed)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "secret",
+				Usage: "Signing secret (generated when omitted)",
+			},
+			&cli.StringFlag{
+				Name:  "description",
+				Usage: "Description of the webhook",
+			},
+			&cli.BoolFlag{
+				Name:  "disabled",
+				Usage: "Create the webhook without activating it",
+			},
+		},
+		Action: createWebhookAction,
+	}
+}
+
+func createWebhookAction(ctx context.Context, c *cli.Command) error {
+	httpClient, err := webhookClient(c)
+	if err != nil {
+		return err
+	}
+
+	req := &client.WebhookRequest{
+		URL:         c.String("url"),
+		Events:      c.StringSlice("event"),
+		Secret:      c.String("secret"),
+		Description: c.String("description"),
+	}
+	if c.Bool("disabled") {
+		active := false
+		req.Active = &active
+	}
+
+	webhook, err := httpClient.CreateWebhook(req)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return printJSON(webhook)
+}
+
+func listWebhookCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "list",
+		Usage:  "List webhooks",
+		Action: listWebhookAction,
+	}
+}
+
+func listWebhookAction(ctx context.Context, c *cli.Command) error {
+	httpClient, err := webhookClient(c)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := httpClient.ListWebhooks()
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	return printJSON(webhooks)
+}
+
+func getWebhookCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "get",
+		Usage:     "Get webhook details",
+		ArgsUsage: "<webhook-id>",
+		Action:    getWebhookAction,
+	}
+}
+
+func getWebhookAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("webhook ID is required")
+	}
+
+	httpClient, err := webhookClient(c)
+	if err != nil {
+		return err
+	}
+
+	webhook, err := httpClient.GetWebhook(c.Args().Get(0))
+	if err != nil {
+		return fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return printJSON(webhook)
+}
+
+func updateWebhookCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "update",
+		Usage:     "Change a webhook",
+		ArgsUsage: "<webhook-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "url",
+				Usage: "URL the events are posted to",
+			},
+			&cli.StringSliceFlag{
+				Name:  "event",
+				Usage: "Replace the subscribed events (repeatable)",
+			},
+			&cli.StringFlag{
+				Name:  "description",
+				Usage: "Description of the webhook",
+			},
+			&cli.BoolFlag{
+				Name:  "active",
+				Usage: "Enable (--active) or disable (--active=false) the webhook",
+			},
+		},
+		Action: updateWebhookAction,
+	}
+}
+
+func updateWebhookAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("webhook ID is required")
+	}
+
+	req := buildWebhookUpdate(c)
+	if req == nil {
+		return fmt.Errorf("one of --url, --event, --description or --active is required")
+	}
+
+	httpClient, err := webhookClient(c)
+	if err != nil {
+		return err
+	}
+
+	webhook, err := httpClient.UpdateWebhook(c.Args().Get(0), req)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	return printJSON(webhook)
+}
+
+// buildWebhookUpdate sends only the flags that were set, or returns nil when
+// there is nothing to change.
+func buildWebhookUpdate(c *cli.Command) *client.WebhookUpdateRequest {
+	req := &client.WebhookUpdateRequest{}
+	changed := false
+	if c.IsSet("url") {
+		url := c.String("url")
+		req.URL = &url
+		changed = true
+	}
+	if c.IsSet("event") {
+		req.Events = c.StringSlice("event")
+		changed = true
+	}
+	if c.IsSet("description") {
+		description := c.String("description")
+		req.Description = &description
+		changed = true
+	}
+	if c.IsSet("active") {
+		active := c.Bool("active")
+		req.Active = &active
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return req
+}
+
+func deleteWebhookCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "delete",
+		Usage:     "Delete a webhook and drop its pending deliveries",
+		ArgsUsage: "<webhook-id>",
+		Action:    deleteWebhookAction,
+	}
+}
+
+func deleteWebhookAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("webhook ID is required")
+	}
+
+	httpClient, err := webhookClient(c)
+	if err != nil {
+		return err
+	}
+
+	webhookID := c.Args().Get(0)
+	if err := httpClient.DeleteWebhook(webhookID); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	fmt.Printf("Webhook %s deleted\n", webhookID)
+	return nil
+}
+
+func webhookDeliveriesCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "deliveries",
+		Usage:     "List a webhook's delivery log",
+		ArgsUsage: "<webhook-id>",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "Maximum number of deliveries to show",
+			},
+		},
+		Action: webhookDeliveriesAction,
+	}
+}
+
+func webhookDeliveriesAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("webhook ID is required")
+	}
+
+	httpClient, err := webhookClient(c)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := httpClient.ListWebhookDeliveries(c.Args().Get(0), c.Int("limit"))
+	if err != nil {
+		return fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	return printJSON(deliveries)
+}
+
+// webhookClient builds a client for the configured server, which --server
+// overrides, authenticated with the configured token.
+func webhookClient(c *cli.Command) (*client.HTTPClient, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	serverURL := cfg.GetServerURL()
+	if c.IsSet("server") {
+		serverURL = c.String("server")
+	}
+
+	return client.NewHTTPClient(serverURL).WithToken(cfg.GetToken()), nil
+}
+
+func printJSON(v any) error {
+	formatter := output.NewJSONFormatter()
+	jsonOutput, err := formatter.Format(v)
+	if err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+
+	fmt.Println(jsonOutput)
+	return nil
+}
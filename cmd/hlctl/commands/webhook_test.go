@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookCommand(t *testing.T) {
+	cmd := WebhookCommand()
+
+	assert.Equal(t, "webhook", cmd.Name)
+	assert.Equal(t, "Manage webhook subscriptions", cmd.Usage)
+
+	var names []string
+	for _, sub := range cmd.Commands {
+		names = append(names, sub.Name)
+	}
+	assert.Equal(t, []string{"create", "list", "get", "update", "delete", "deliveries"}, names)
+}
+
+func TestCreateWebhookAction_SendsEvents(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v2/webhooks", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"whk_123","url":"https://hooks.example.com/x","events":["task.failed","agent.offline"],"active":false}`))
+	}))
+	defer server.Close()
+
+	err := NewApp().Run(context.Background(), []string{
+		"hlctl", "--server", server.URL, "webhook", "create",
+		"--url", "https://hooks.example.com/x", "--event", "task.failed", "--event", "agent.offline", "--disabled",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/x", body["url"])
+	assert.Equal(t, []any{"task.failed", "agent.offline"}, body["events"])
+	assert.Equal(t, false, body["active"])
+	assert.NotContains(t, body, "secret")
+}
+
+func TestUpdateWebhookAction_SendsOnlySetFlags(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/api/v2/webhooks/whk_123", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"id":"whk_123","active":false}`))
+	}))
+	defer server.Close()
+
+	err := NewApp().Run(context.Background(), []string{
+		"hlctl", "--server", server.URL, "webhook", "update", "--active=false", "whk_123",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"active": false}, body)
+}
+
+func TestUpdateWebhookAction_RequiresChange(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	err := NewApp().Run(context.Background(), []string{
+		"hlctl", "webhook", "update", "whk_123",
+	})
+
+	assert.ErrorContains(t, err, "is required")
+}
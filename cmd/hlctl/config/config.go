@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -10,12 +11,15 @@ import (
 const (
 	defaultServerURL = "http://localhost:8080"
 	envVarServerURL  = "HOSTLINK_SERVER_URL"
+	envVarToken      = "HOSTLINK_API_TOKEN"
 	configFileName   = ".hostlink/config.yml"
 )
 
 // Config holds the hlctl configuration
 type Config struct {
 	ServerURL string `yaml:"server"`
+	// Token is the operator API token saved by hlctl login
+	Token string `yaml:"token,omitempty"`
 }
 
 // Load loads configuration from file and environment
@@ -46,14 +50,51 @@ func (c *Config) GetServerURL() string {
 	return defaultServerURL
 }
 
+// GetToken returns the operator API token with priority: env var > config file
+func (c *Config) GetToken() string {
+	if token := os.Getenv(envVarToken); token != "" {
+		return token
+	}
+	return c.Token
+}
+
+// Save writes the configuration to ~/.hostlink/config.yml. The file holds
+// the API token, so only the user may read it.
+func (c *Config) Save() error {
+	configPath, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(configPath, 0600)
+}
+
+func configFilePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, configFileName), nil
+}
+
 // loadFromFile loads configuration from ~/.hostlink/config.yml
 func loadFromFile(cfg *Config) error {
-	homeDir, err := os.UserHomeDir()
+	configPath, err := configFilePath()
 	if err != nil {
 		return err
 	}
 
-	configPath := filepath.Join(homeDir, configFileName)
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return err
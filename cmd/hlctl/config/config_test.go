@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -61,3 +62,31 @@ func TestGetServerURL_Priority(t *testing.T) {
 		assert.Equal(t, "http://localhost:8080", cfg.GetServerURL())
 	})
 }
+
+func TestGetToken_Priority(t *testing.T) {
+	t.Setenv("HOSTLINK_API_TOKEN", "hlo_env")
+	cfg := &Config{Token: "hlo_file"}
+	assert.Equal(t, "hlo_env", cfg.GetToken())
+
+	t.Setenv("HOSTLINK_API_TOKEN", "")
+	assert.Equal(t, "hlo_file", cfg.GetToken())
+}
+
+func TestSave(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("HOSTLINK_SERVER_URL", "")
+	t.Setenv("HOSTLINK_API_TOKEN", "")
+
+	cfg := &Config{ServerURL: "http://saved.example.com", Token: "hlo_saved"}
+	require.NoError(t, cfg.Save())
+
+	info, err := os.Stat(filepath.Join(home, ".hostlink", "config.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "http://saved.example.com", loaded.GetServerURL())
+	assert.Equal(t, "hlo_saved", loaded.GetToken())
+}
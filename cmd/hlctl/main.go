@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
@@ -11,6 +12,12 @@ import (
 func main() {
 	app := commands.NewApp()
 	if err := app.Run(context.Background(), os.Args); err != nil {
+		// A waited-for task that failed already showed its result, so only
+		// its exit code is passed on.
+		var exitErr *commands.TaskExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,46 @@
+// Package keycli implements `hostlink rotate-key`, which replaces the
+// agent's key without re-registering it. A running agent picks the new key
+// up on its own.
+package keycli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"hostlink/app/services/keyrotation"
+
+	"github.com/urfave/cli/v3"
+)
+
+// newService is replaced in tests.
+var newService = func() (keyrotation.Service, error) {
+	return keyrotation.New()
+}
+
+// RotateKeyCommand returns the `rotate-key` command.
+func RotateKeyCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "rotate-key",
+		Usage:  "Replace the agent key; the previous key stays valid for a short overlap",
+		Action: rotateAction,
+	}
+}
+
+func rotateAction(ctx context.Context, c *cli.Command) error {
+	svc, err := newService()
+	if err != nil {
+		return fmt.Errorf("failed to initialize key rotation: %w", err)
+	}
+	result, err := svc.Rotate()
+	if err != nil {
+		return err
+	}
+
+	w := c.Root().Writer
+	fmt.Fprintf(w, "Key rotated at %s\n", result.RotatedAt.UTC().Format(time.RFC3339))
+	if !result.PreviousKeyValidUntil.IsZero() {
+		fmt.Fprintf(w, "Previous key accepted until %s\n", result.PreviousKeyValidUntil.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package keycli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"hostlink/app/services/keyrotation"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeService struct {
+	result *keyrotation.Result
+	err    error
+}
+
+func (f *fakeService) RotateIfDue() error { return nil }
+
+func (f *fakeService) Rotate() (*keyrotation.Result, error) { return f.result, f.err }
+
+func runRotateKey(t *testing.T, svc keyrotation.Service) (string, error) {
+	t.Helper()
+	original := newService
+	newService = func() (keyrotation.Service, error) { return svc, nil }
+	t.Cleanup(func() { newService = original })
+
+	var out bytes.Buffer
+	cmd := RotateKeyCommand()
+	cmd.Writer = &out
+	err := cmd.Run(context.Background(), []string{"rotate-key"})
+	return out.String(), err
+}
+
+func TestRotateKeyPrintsTheOverlap(t *testing.T) {
+	rotatedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	out, err := runRotateKey(t, &fakeService{result: &keyrotation.Result{
+		RotatedAt:             rotatedAt,
+		PreviousKeyValidUntil: rotatedAt.Add(time.Hour),
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "Key rotated at 2026-01-01T12:00:00Z\nPrevious key accepted until 2026-01-01T13:00:00Z\n", out)
+}
+
+func TestRotateKeyReturnsFailures(t *testing.T) {
+	_, err := runRotateKey(t, &fakeService{err: errors.New("key rotation already in progress")})
+	assert.ErrorContains(t, err, "already in progress")
+}
@@ -0,0 +1,163 @@
+// Package operatorcli implements `hostlink operator`, which manages operators
+// and their API tokens directly in the server database. It bootstraps the
+// first admin, and recovers access when every admin token is lost.
+package operatorcli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"hostlink/app"
+	operatorService "hostlink/app/service/operator"
+	"hostlink/config/appconf"
+	"hostlink/domain/operator"
+	"hostlink/internal/dbconn"
+
+	"github.com/urfave/cli/v3"
+)
+
+// OperatorCommand returns the `operator` command tree.
+func OperatorCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "operator",
+		Usage: "Manage operators of the task API",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "db",
+				Usage: "Server database URL",
+				Value: appconf.DBURL(),
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "create",
+				Usage: "Create an operator and print its first API token",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "name",
+						Usage:    "Operator name",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "role",
+						Usage: "Role (" + strings.Join(operator.Roles, ", ") + ")",
+						Value: operator.RoleAdmin,
+					},
+					&cli.StringSliceFlag{
+						Name:  "scope",
+						Usage: "Only allow agents carrying this key=value tag (repeatable)",
+					},
+					&cli.DurationFlag{
+						Name:  "expires-in",
+						Usage: "Token lifetime (default: never expires)",
+					},
+				},
+				Action: createAction,
+			},
+			{
+				Name:      "token",
+				Usage:     "Issue a new API token for an operator",
+				ArgsUsage: "<name>",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "expires-in",
+						Usage: "Token lifetime (default: never expires)",
+					},
+				},
+				Action: tokenAction,
+			},
+			{
+				Name:   "list",
+				Usage:  "List operators",
+				Action: listAction,
+			},
+		},
+	}
+}
+
+// open connects to the --db database and makes sure the operator tables
+// exist.
+func open(c *cli.Command) (*app.Container, error) {
+	db, err := dbconn.GetConn(dbconn.WithURL(c.String("db")))
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	if err := db.AutoMigrate(&operator.Operator{}, &operator.Token{}); err != nil {
+		return nil, fmt.Errorf("migrate operators: %w", err)
+	}
+	return app.NewContainer(db), nil
+}
+
+func createAction(ctx context.Context, c *cli.Command) error {
+	container, err := open(c)
+	if err != nil {
+		return err
+	}
+	defer dbconn.Close()
+
+	o, err := container.Operators.Create(ctx, c.String("name"), c.String("role"), c.StringSlice("scope"))
+	if err != nil {
+		return err
+	}
+	return issue(ctx, c, container.Operators, o)
+}
+
+func tokenAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("operator name is required")
+	}
+
+	container, err := open(c)
+	if err != nil {
+		return err
+	}
+	defer dbconn.Close()
+
+	o, err := container.OperatorRepository.FindOperatorByName(ctx, c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	return issue(ctx, c, container.Operators, o)
+}
+
+// issue prints a new token for o. The token is only ever shown here.
+func issue(ctx context.Context, c *cli.Command, service *operatorService.Service, o *operator.Operator) error {
+	plaintext, token, err := service.IssueToken(ctx, o.ID, "cli", c.Duration("expires-in"))
+	if err != nil {
+		return err
+	}
+
+	w := c.Root().Writer
+	fmt.Fprintf(w, "Operator:  %s (%s, %s)\n", o.Name, o.ID, o.Role)
+	if o.Scoped() {
+		fmt.Fprintf(w, "Scope:     %s\n", strings.Join(o.Scope, ", "))
+	}
+	if token.ExpiresAt != nil {
+		fmt.Fprintf(w, "Expires:   %s\n", token.ExpiresAt.Format("2006-01-02 15:04:05 MST"))
+	}
+	fmt.Fprintf(w, "Token:     %s\n", plaintext)
+	fmt.Fprintln(w, "Store the token now; it cannot be shown again.")
+	return nil
+}
+
+func listAction(ctx context.Context, c *cli.Command) error {
+	container, err := open(c)
+	if err != nil {
+		return err
+	}
+	defer dbconn.Close()
+
+	operators, err := container.OperatorRepository.FindOperators(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.Root().Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tROLE\tSCOPE\tDISABLED")
+	for _, o := range operators {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\n", o.ID, o.Name, o.Role, strings.Join(o.Scope, ","), o.Disabled)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,59 @@
+package operatorcli
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runOperator(t *testing.T, db string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd := OperatorCommand()
+	cmd.Writer = &out
+	err := cmd.Run(context.Background(), append([]string{"operator", "--db", db}, args...))
+	return out.String(), err
+}
+
+func TestCreatePrintsAToken(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "hostlink.db")
+
+	out, err := runOperator(t, db, "create", "--name", "alice", "--role", "operator", "--scope", "env=staging")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Operator:  alice (opr_")
+	assert.Contains(t, out, "Scope:     env=staging\n")
+	assert.Regexp(t, regexp.MustCompile(`Token:     hlo_\S+\n`), out)
+
+	out, err = runOperator(t, db, "list")
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`alice\s+operator\s+env=staging\s+false`), out)
+}
+
+func TestCreateRejectsUnknownRoles(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "hostlink.db")
+
+	_, err := runOperator(t, db, "create", "--name", "alice", "--role", "root")
+	require.ErrorContains(t, err, "unknown operator role")
+}
+
+func TestTokenIssuesAnotherToken(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "hostlink.db")
+	first, err := runOperator(t, db, "create", "--name", "alice")
+	require.NoError(t, err)
+
+	second, err := runOperator(t, db, "token", "alice", "--expires-in", "24h")
+	require.NoError(t, err)
+	assert.Contains(t, second, "(opr_")
+	assert.Contains(t, second, "Expires:")
+
+	tokenPattern := regexp.MustCompile(`Token:     (\S+)`)
+	assert.NotEqual(t, tokenPattern.FindStringSubmatch(first)[1], tokenPattern.FindStringSubmatch(second)[1])
+
+	_, err = runOperator(t, db, "token", "bob")
+	require.ErrorContains(t, err, "operator not found")
+}
@@ -0,0 +1,382 @@
+// Package storecli implements `hostlink store`, which inspects the agent's
+// local task store. Every subcommand except purge opens the store read-only,
+// so it is safe to run next to a live agent.
+package storecli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"hostlink/app/services/localtaskstore"
+	"hostlink/config/appconf"
+
+	"github.com/urfave/cli/v3"
+)
+
+// StoreCommand returns the `store` command tree.
+func StoreCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "store",
+		Usage: "Inspect the local task store",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "path",
+				Usage: "Path to the local task store",
+				Value: appconf.LocalTaskStorePath(),
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:   "status",
+				Usage:  "Show spool usage and rotation",
+				Action: statusAction,
+			},
+			{
+				Name:  "list",
+				Usage: "List task executions by state",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "state",
+						Usage: "Only list executions in this state (received, running, final, interrupted)",
+					},
+				},
+				Action: listAction,
+			},
+			{
+				Name:      "show",
+				Usage:     "Reassemble a task's output and report sequence gaps",
+				ArgsUsage: "<task-id>",
+				Action:    showAction,
+			},
+			{
+				Name:  "export",
+				Usage: "Export outbox messages as JSONL",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "task",
+						Usage: "Only export messages of this task",
+					},
+				},
+				Action: exportAction,
+			},
+			{
+				Name:  "purge",
+				Usage: "Delete messages from the store",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "acked",
+						Usage: "Delete acknowledged and rotated messages",
+					},
+				},
+				Action: purgeAction,
+			},
+		},
+	}
+}
+
+// storeConfig returns the agent's store configuration, including its
+// encryption key, pointed at the --path store.
+func storeConfig(c *cli.Command) (localtaskstore.Config, error) {
+	cfg, err := localtaskstore.DefaultConfig()
+	if err != nil {
+		return localtaskstore.Config{}, err
+	}
+	cfg.Path = c.String("path")
+	return cfg, nil
+}
+
+func openReadOnly(c *cli.Command) (*localtaskstore.Store, error) {
+	cfg, err := storeConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return localtaskstore.OpenReadOnly(cfg)
+}
+
+func statusAction(ctx context.Context, c *cli.Command) error {
+	store, err := openReadOnly(c)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	snapshot, err := store.Snapshot()
+	if err != nil {
+		return err
+	}
+	w := c.Root().Writer
+	status := snapshot.SpoolStatus
+	fmt.Fprintf(w, "Spool bytes:     %d\n", status.BytesUsed)
+	fmt.Fprintf(w, "Spool cap:       %d\n", status.ByteCap)
+	if status.ByteCap > 0 {
+		fmt.Fprintf(w, "Spool used:      %.1f%%\n", float64(status.BytesUsed)*100/float64(status.ByteCap))
+	}
+	fmt.Fprintf(w, "Rotated chunks:  %s\n", yesNo(hasRotatedChunks(snapshot.Tasks)))
+	fmt.Fprintf(w, "Unacked output:  %d\n", len(snapshot.UnackedOutput))
+	fmt.Fprintf(w, "Unacked finals:  %d\n", len(snapshot.UnackedFinals))
+	fmt.Fprintf(w, "Executions:      %d\n", len(snapshot.Tasks))
+	return nil
+}
+
+// hasRotatedChunks reports whether any execution lost output to spool
+// rotation.
+func hasRotatedChunks(tasks []localtaskstore.TaskState) bool {
+	for _, task := range tasks {
+		if task.LocalOutputTruncated {
+			return true
+		}
+	}
+	return false
+}
+
+func listAction(ctx context.Context, c *cli.Command) error {
+	store, err := openReadOnly(c)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	snapshot, err := store.Snapshot()
+	if err != nil {
+		return err
+	}
+	state := c.String("state")
+	tasks := make([]localtaskstore.TaskState, 0, len(snapshot.Tasks))
+	for _, task := range snapshot.Tasks {
+		if state == "" || task.Status == state {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return statusRank(tasks[i].Status) < statusRank(tasks[j].Status)
+	})
+
+	tw := tabwriter.NewWriter(c.Root().Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tTASK ID\tATTEMPT\tEXIT CODE\tLOCALLY TRUNCATED")
+	for _, task := range tasks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", task.Status, task.TaskID, task.ExecutionAttemptID, task.ExitCode, yesNo(task.LocalOutputTruncated))
+	}
+	return tw.Flush()
+}
+
+func showAction(ctx context.Context, c *cli.Command) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("task ID is required")
+	}
+	taskID := c.Args().Get(0)
+
+	store, err := openReadOnly(c)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	snapshot, err := store.Snapshot()
+	if err != nil {
+		return err
+	}
+	messages, err := store.StoredMessages(taskID)
+	if err != nil {
+		return err
+	}
+
+	var attempts []localtaskstore.TaskState
+	for _, task := range snapshot.Tasks {
+		if task.TaskID == taskID {
+			attempts = append(attempts, task)
+		}
+	}
+	if len(attempts) == 0 && len(messages) == 0 {
+		return fmt.Errorf("task %s not found in local store", taskID)
+	}
+	for _, message := range messages {
+		if !hasAttempt(attempts, message.ExecutionAttemptID) {
+			attempts = append(attempts, localtaskstore.TaskState{TaskID: taskID, ExecutionAttemptID: message.ExecutionAttemptID})
+		}
+	}
+
+	w := c.Root().Writer
+	for _, attempt := range attempts {
+		writeAttempt(w, attempt, messages)
+	}
+	return nil
+}
+
+func writeAttempt(w io.Writer, attempt localtaskstore.TaskState, messages []localtaskstore.StoredMessage) {
+	status := attempt.Status
+	if status == "" {
+		status = "unknown"
+	}
+	fmt.Fprintf(w, "== %s attempt %s (%s)\n", attempt.TaskID, attempt.ExecutionAttemptID, status)
+	if attempt.LocalOutputTruncated {
+		fmt.Fprintln(w, "note: output was rotated out of the local spool")
+	}
+
+	streams := map[string][]localtaskstore.StoredMessage{}
+	var final *localtaskstore.StoredMessage
+	for i, message := range messages {
+		if message.ExecutionAttemptID != attempt.ExecutionAttemptID {
+			continue
+		}
+		if message.Type == localtaskstore.OutboxMessageTypeFinal {
+			final = &messages[i]
+			continue
+		}
+		streams[message.Stream] = append(streams[message.Stream], message)
+	}
+
+	for _, stream := range sortedKeys(streams) {
+		chunks := streams[stream]
+		sort.Slice(chunks, func(i, j int) bool { return chunks[i].Sequence < chunks[j].Sequence })
+		sequences := make([]int64, 0, len(chunks))
+		var output strings.Builder
+		for _, chunk := range chunks {
+			sequences = append(sequences, chunk.Sequence)
+			output.WriteString(chunk.Payload)
+		}
+		fmt.Fprintf(w, "-- %s: %d chunks, sequences %s\n", stream, len(chunks), formatRanges(sequenceRanges(sequences)))
+		if missing := missingRanges(sequences); len(missing) > 0 {
+			fmt.Fprintf(w, "-- %s: GAPS, missing sequences %s\n", stream, formatRanges(missing))
+		}
+		fmt.Fprint(w, output.String())
+		if output.Len() > 0 && !strings.HasSuffix(output.String(), "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+
+	if final != nil {
+		fmt.Fprintf(w, "-- final (acked: %s): %s\n", yesNo(final.AckedAt != nil), final.Payload)
+	} else {
+		fmt.Fprintln(w, "-- final: none")
+	}
+}
+
+func exportAction(ctx context.Context, c *cli.Command) error {
+	store, err := openReadOnly(c)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	messages, err := store.StoredMessages(c.String("task"))
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(c.Root().Writer)
+	for _, message := range messages {
+		if err := encoder.Encode(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func purgeAction(ctx context.Context, c *cli.Command) error {
+	if !c.Bool("acked") {
+		return fmt.Errorf("nothing to purge: pass --acked to delete acknowledged messages")
+	}
+	cfg, err := storeConfig(c)
+	if err != nil {
+		return err
+	}
+	store, err := localtaskstore.OpenForMaintenance(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	purged, err := store.PurgeAcked()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Root().Writer, "Purged %d acknowledged messages\n", purged)
+	return nil
+}
+
+// sequenceRanges collapses sorted sequences into inclusive [first, last] ranges.
+func sequenceRanges(sequences []int64) [][2]int64 {
+	var ranges [][2]int64
+	for _, seq := range sequences {
+		if n := len(ranges); n > 0 && seq <= ranges[n-1][1]+1 {
+			if seq > ranges[n-1][1] {
+				ranges[n-1][1] = seq
+			}
+			continue
+		}
+		ranges = append(ranges, [2]int64{seq, seq})
+	}
+	return ranges
+}
+
+// missingRanges reports the sequences absent between 1 and the highest one seen.
+func missingRanges(sequences []int64) [][2]int64 {
+	var missing [][2]int64
+	next := int64(1)
+	for _, r := range sequenceRanges(sequences) {
+		if r[0] > next {
+			missing = append(missing, [2]int64{next, r[0] - 1})
+		}
+		next = r[1] + 1
+	}
+	return missing
+}
+
+func formatRanges(ranges [][2]int64) string {
+	if len(ranges) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r[0] == r[1] {
+			parts = append(parts, fmt.Sprintf("%d", r[0]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r[0], r[1]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func statusRank(status string) int {
+	switch status {
+	case localtaskstore.TaskStatusRunning:
+		return 0
+	case localtaskstore.TaskStatusReceived:
+		return 1
+	case localtaskstore.TaskStatusInterrupted:
+		return 2
+	case localtaskstore.TaskStatusFinal:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func hasAttempt(attempts []localtaskstore.TaskState, executionAttemptID string) bool {
+	for _, attempt := range attempts {
+		if attempt.ExecutionAttemptID == executionAttemptID {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string][]localtaskstore.StoredMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,146 @@
+package storecli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hostlink/app/services/localtaskstore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusReportsSpoolUsageAndRotation(t *testing.T) {
+	path := newSeededStore(t, func(store *localtaskstore.Store) {
+		appendOutput(t, store, "task-1", "stdout", 1, "hello\n")
+	})
+
+	out, err := runStore(t, path, "status")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Spool bytes:     6\n")
+	assert.Contains(t, out, "Rotated chunks:  no\n")
+	assert.Contains(t, out, "Unacked output:  1\n")
+}
+
+func TestListFiltersByState(t *testing.T) {
+	path := newSeededStore(t, func(store *localtaskstore.Store) {
+		_, err := store.RecordReceived(localtaskstore.TaskReceipt{TaskID: "task-received", ExecutionAttemptID: "attempt-1"})
+		require.NoError(t, err)
+		_, err = store.RecordReceived(localtaskstore.TaskReceipt{TaskID: "task-running", ExecutionAttemptID: "attempt-1"})
+		require.NoError(t, err)
+		require.NoError(t, store.RecordStarted("task-running", "attempt-1"))
+	})
+
+	out, err := runStore(t, path, "list", "--state", "running")
+	require.NoError(t, err)
+	assert.Contains(t, out, "task-running")
+	assert.NotContains(t, out, "task-received")
+}
+
+func TestShowReassemblesOutputAndReportsGaps(t *testing.T) {
+	path := newSeededStore(t, func(store *localtaskstore.Store) {
+		appendOutput(t, store, "task-1", "stdout", 1, "one\n")
+		appendOutput(t, store, "task-1", "stdout", 2, "two\n")
+		appendOutput(t, store, "task-1", "stdout", 5, "five\n")
+	})
+
+	out, err := runStore(t, path, "show", "task-1")
+	require.NoError(t, err)
+	assert.Contains(t, out, "-- stdout: 3 chunks, sequences 1-2, 5\n")
+	assert.Contains(t, out, "-- stdout: GAPS, missing sequences 3-4\n")
+	assert.Contains(t, out, "one\ntwo\nfive\n")
+	assert.Contains(t, out, "-- final: none\n")
+}
+
+func TestShowFailsForUnknownTask(t *testing.T) {
+	path := newSeededStore(t, func(store *localtaskstore.Store) {})
+
+	_, err := runStore(t, path, "show", "missing")
+	require.Error(t, err)
+}
+
+func TestExportWritesJSONLines(t *testing.T) {
+	path := newSeededStore(t, func(store *localtaskstore.Store) {
+		appendOutput(t, store, "task-1", "stdout", 1, "a")
+		appendOutput(t, store, "task-2", "stderr", 1, "b")
+	})
+
+	out, err := runStore(t, path, "export", "--task", "task-2")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 1)
+	var message localtaskstore.StoredMessage
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &message))
+	assert.Equal(t, "task-2", message.TaskID)
+	assert.Equal(t, "stderr", message.Stream)
+}
+
+func TestPurgeRequiresAckedFlagAndKeepsUnacked(t *testing.T) {
+	path := newSeededStore(t, func(store *localtaskstore.Store) {
+		appendOutput(t, store, "task-1", "stdout", 1, "a")
+		appendOutput(t, store, "task-1", "stdout", 2, "b")
+		require.NoError(t, store.AckMessage("task-1-stdout-1"))
+	})
+
+	_, err := runStore(t, path, "purge")
+	require.Error(t, err)
+
+	out, err := runStore(t, path, "purge", "--acked")
+	require.NoError(t, err)
+	assert.Equal(t, "Purged 1 acknowledged messages\n", out)
+
+	out, err = runStore(t, path, "export")
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(out, "\n"))
+}
+
+func TestMissingStoreIsAnError(t *testing.T) {
+	_, err := runStore(t, filepath.Join(t.TempDir(), "missing.db"), "status")
+	require.Error(t, err)
+}
+
+func TestMissingRanges(t *testing.T) {
+	assert.Equal(t, [][2]int64{{1, 2}, {4, 4}}, missingRanges([]int64{3, 5, 5, 6}))
+	assert.Empty(t, missingRanges([]int64{1, 2, 3}))
+}
+
+func runStore(t *testing.T, path string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd := StoreCommand()
+	cmd.Writer = &out
+	err := cmd.Run(context.Background(), append([]string{"store", "--path", path}, args...))
+	return out.String(), err
+}
+
+func newSeededStore(t *testing.T, seed func(*localtaskstore.Store)) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "task_store.db")
+	store, err := localtaskstore.New(localtaskstore.Config{
+		Path:                 path,
+		SpoolCapBytes:        1024 * 1024,
+		TerminalReserveBytes: 1024,
+	})
+	require.NoError(t, err)
+	seed(store)
+	require.NoError(t, store.Close())
+	return path
+}
+
+func appendOutput(t *testing.T, store *localtaskstore.Store, taskID, stream string, sequence int64, payload string) {
+	t.Helper()
+	require.NoError(t, store.AppendOutputChunk(localtaskstore.OutputChunk{
+		MessageID:          fmt.Sprintf("%s-%s-%d", taskID, stream, sequence),
+		TaskID:             taskID,
+		ExecutionAttemptID: "attempt-1",
+		Stream:             stream,
+		Sequence:           sequence,
+		Payload:            payload,
+		ByteCount:          int64(len(payload)),
+	}))
+}
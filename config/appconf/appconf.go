@@ -38,6 +38,22 @@ func AgentPrivateKeyPath() string {
 	return "/var/lib/hostlink/agent.key"
 }
 
+// AgentKeyType returns the algorithm of agent keys generated at registration
+// and by key rotation: "ed25519", "ecdsa" (P-256) or "rsa". An existing key
+// keeps its type until it is rotated.
+// Controlled by HOSTLINK_AGENT_KEY_TYPE (default: ed25519).
+func AgentKeyType() string {
+	switch keyType := strings.ToLower(strings.TrimSpace(os.Getenv("HOSTLINK_AGENT_KEY_TYPE"))); keyType {
+	case "":
+		return "ed25519"
+	case "ed25519", "ecdsa", "rsa":
+		return keyType
+	default:
+		log.Warnf("invalid HOSTLINK_AGENT_KEY_TYPE value %q, using default ed25519", keyType)
+		return "ed25519"
+	}
+}
+
 func AgentFingerprintPath() string {
 	if path := os.Getenv("HOSTLINK_FINGERPRINT_PATH"); path != "" {
 		return path
@@ -75,6 +91,66 @@ func LocalTaskStoreTerminalReserveBytes() int64 {
 	return parseInt64Positive("HOSTLINK_LOCAL_STORE_TERMINAL_RESERVE_BYTES", 1024*1024)
 }
 
+// LocalTaskStoreEncryption returns how local task store payloads are encrypted at rest:
+// "agent-key" wraps the data key with the agent's key, "key-file" with the key in
+// LocalTaskStoreKeyFile. Controlled by HOSTLINK_LOCAL_STORE_ENCRYPTION (default: off).
+func LocalTaskStoreEncryption() string {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("HOSTLINK_LOCAL_STORE_ENCRYPTION"))); mode {
+	case "agent-key", "key-file":
+		return mode
+	default:
+		return ""
+	}
+}
+
+// LocalTaskStoreKeyFile returns the key-wrapping key used with "key-file" encryption.
+// Controlled by HOSTLINK_LOCAL_STORE_KEY_FILE (default: <state path>/task_store.key).
+func LocalTaskStoreKeyFile() string {
+	if path := strings.TrimSpace(os.Getenv("HOSTLINK_LOCAL_STORE_KEY_FILE")); path != "" {
+		return path
+	}
+	return filepath.Join(AgentStatePath(), "task_store.key")
+}
+
+// LocalTaskStoreKeyRotationInterval returns the age at which the store's data key is replaced.
+// Controlled by HOSTLINK_LOCAL_STORE_KEY_ROTATION_INTERVAL (default: 720h, clamped to [1h, 8760h]).
+func LocalTaskStoreKeyRotationInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_LOCAL_STORE_KEY_ROTATION_INTERVAL", 720*time.Hour, time.Hour, 8760*time.Hour)
+}
+
+// LocalTaskStoreAckedRetention returns how long acknowledged messages are kept before they
+// are securely deleted. Controlled by HOSTLINK_LOCAL_STORE_ACKED_RETENTION
+// (default: 24h, clamped to [1m, 720h]).
+func LocalTaskStoreAckedRetention() time.Duration {
+	return parseDurationClamped("HOSTLINK_LOCAL_STORE_ACKED_RETENTION", 24*time.Hour, time.Minute, 720*time.Hour)
+}
+
+// LocalTaskStoreExecutionRetention returns how long finished executions are kept once
+// nothing of theirs awaits an ack. Controlled by HOSTLINK_LOCAL_STORE_EXECUTION_RETENTION
+// (default: 168h, clamped to [1h, 8760h]).
+func LocalTaskStoreExecutionRetention() time.Duration {
+	return parseDurationClamped("HOSTLINK_LOCAL_STORE_EXECUTION_RETENTION", 168*time.Hour, time.Hour, 8760*time.Hour)
+}
+
+// LocalTaskStoreMaxFinishedExecutions returns how many finished executions are kept.
+// Controlled by HOSTLINK_LOCAL_STORE_MAX_FINISHED_EXECUTIONS (default: 1000).
+func LocalTaskStoreMaxFinishedExecutions() int {
+	return int(parseInt64Positive("HOSTLINK_LOCAL_STORE_MAX_FINISHED_EXECUTIONS", 1000))
+}
+
+// LocalTaskStoreMaxAckedMessages returns how many acknowledged messages are kept.
+// Controlled by HOSTLINK_LOCAL_STORE_MAX_ACKED_MESSAGES (default: 10000).
+func LocalTaskStoreMaxAckedMessages() int {
+	return int(parseInt64Positive("HOSTLINK_LOCAL_STORE_MAX_ACKED_MESSAGES", 10000))
+}
+
+// LocalTaskStoreCompactionInterval returns how often the local task store is pruned and
+// vacuumed. Controlled by HOSTLINK_LOCAL_STORE_COMPACTION_INTERVAL
+// (default: 1h, clamped to [1m, 24h]).
+func LocalTaskStoreCompactionInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_LOCAL_STORE_COMPACTION_INTERVAL", time.Hour, time.Minute, 24*time.Hour)
+}
+
 // InstallPath returns the target install path for the hostlink binary.
 // Controlled by HOSTLINK_INSTALL_PATH (default: /usr/bin/hostlink).
 func InstallPath() string {
@@ -164,6 +240,31 @@ func WebSocketPingInterval() time.Duration {
 	return parseDurationClamped("HOSTLINK_WS_PING_INTERVAL", 30*time.Second, 5*time.Second, 5*time.Minute)
 }
 
+// WebSocketOutputBatchEnabled returns whether task output may be packed into
+// output.batch frames when the server accepts them.
+// Controlled by HOSTLINK_WS_OUTPUT_BATCH_ENABLED (default: false).
+func WebSocketOutputBatchEnabled() bool {
+	return parseBoolEnabled("HOSTLINK_WS_OUTPUT_BATCH_ENABLED", false)
+}
+
+// WebSocketOutputBatchMaxMessages returns how many output chunks fill a batch.
+// Controlled by HOSTLINK_WS_OUTPUT_BATCH_MAX_MESSAGES (default: 64).
+func WebSocketOutputBatchMaxMessages() int {
+	return int(parseInt64Positive("HOSTLINK_WS_OUTPUT_BATCH_MAX_MESSAGES", 64))
+}
+
+// WebSocketOutputBatchMaxBytes returns how many output bytes fill a batch.
+// Controlled by HOSTLINK_WS_OUTPUT_BATCH_MAX_BYTES (default: 64 KiB).
+func WebSocketOutputBatchMaxBytes() int64 {
+	return parseInt64Positive("HOSTLINK_WS_OUTPUT_BATCH_MAX_BYTES", 64*1024)
+}
+
+// WebSocketOutputBatchInterval returns how long a partial batch waits before it is sent.
+// Controlled by HOSTLINK_WS_OUTPUT_BATCH_INTERVAL (default: 50ms, clamped to [1ms, 5s]).
+func WebSocketOutputBatchInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_WS_OUTPUT_BATCH_INTERVAL", 50*time.Millisecond, time.Millisecond, 5*time.Second)
+}
+
 // RegistrationRetryInitialDelay returns the first retry delay for agent registration.
 // Controlled by HOSTLINK_REGISTRATION_RETRY_INITIAL_DELAY (default: 10s, clamped to [10ms, 5m]).
 func RegistrationRetryInitialDelay() time.Duration {
@@ -176,6 +277,95 @@ func TaskPollInterval() time.Duration {
 	return parseDurationClamped("HOSTLINK_TASK_POLL_INTERVAL", 10*time.Second, 10*time.Millisecond, 5*time.Minute)
 }
 
+// TaskClaimLease returns how long an agent may hold a claimed task before starting it,
+// after which the task is requeued. Controlled by HOSTLINK_TASK_CLAIM_LEASE
+// (default: 5m, clamped to [10s, 1h]).
+func TaskClaimLease() time.Duration {
+	return parseDurationClamped("HOSTLINK_TASK_CLAIM_LEASE", 5*time.Minute, 10*time.Second, time.Hour)
+}
+
+// TaskRunLease returns how long a running task may go without a report before it is
+// timed out. Controlled by HOSTLINK_TASK_RUN_LEASE (default: 1h, clamped to [1m, 168h]).
+func TaskRunLease() time.Duration {
+	return parseDurationClamped("HOSTLINK_TASK_RUN_LEASE", time.Hour, time.Minute, 168*time.Hour)
+}
+
+// MetricsRawRetention returns how long raw metric samples are kept on the server. It
+// must cover the coarsest rollup bucket. Controlled by HOSTLINK_METRICS_RAW_RETENTION
+// (default: 48h, clamped to [2h, 720h]).
+func MetricsRawRetention() time.Duration {
+	return parseDurationClamped("HOSTLINK_METRICS_RAW_RETENTION", 48*time.Hour, 2*time.Hour, 720*time.Hour)
+}
+
+// MetricsRollup1mRetention returns how long 1-minute metric rollups are kept.
+// Controlled by HOSTLINK_METRICS_ROLLUP_1M_RETENTION (default: 168h, clamped to [1h, 2160h]).
+func MetricsRollup1mRetention() time.Duration {
+	return parseDurationClamped("HOSTLINK_METRICS_ROLLUP_1M_RETENTION", 168*time.Hour, time.Hour, 2160*time.Hour)
+}
+
+// MetricsRollup5mRetention returns how long 5-minute metric rollups are kept.
+// Controlled by HOSTLINK_METRICS_ROLLUP_5M_RETENTION (default: 720h, clamped to [1h, 8760h]).
+func MetricsRollup5mRetention() time.Duration {
+	return parseDurationClamped("HOSTLINK_METRICS_ROLLUP_5M_RETENTION", 720*time.Hour, time.Hour, 8760*time.Hour)
+}
+
+// MetricsRollup1hRetention returns how long 1-hour metric rollups are kept.
+// Controlled by HOSTLINK_METRICS_ROLLUP_1H_RETENTION (default: 8760h, clamped to [24h, 87600h]).
+func MetricsRollup1hRetention() time.Duration {
+	return parseDurationClamped("HOSTLINK_METRICS_ROLLUP_1H_RETENTION", 8760*time.Hour, 24*time.Hour, 87600*time.Hour)
+}
+
+// MetricsRollupInterval returns how often stored metrics are rolled up and pruned.
+// Controlled by HOSTLINK_METRICS_ROLLUP_INTERVAL (default: 1m, clamped to [10s, 1h]).
+func MetricsRollupInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_METRICS_ROLLUP_INTERVAL", time.Minute, 10*time.Second, time.Hour)
+}
+
+// AgentStaleAfter returns how long an agent may go unseen before it is
+// marked stale.
+// Controlled by HOSTLINK_AGENT_STALE_AFTER (default: 1m, clamped to [10s, 1h]).
+func AgentStaleAfter() time.Duration {
+	return parseDurationClamped("HOSTLINK_AGENT_STALE_AFTER", time.Minute, 10*time.Second, time.Hour)
+}
+
+// AgentOfflineAfter returns how long an agent may go unseen before it is
+// marked offline.
+// Controlled by HOSTLINK_AGENT_OFFLINE_AFTER (default: 5m, clamped to [30s, 24h]).
+func AgentOfflineAfter() time.Duration {
+	return parseDurationClamped("HOSTLINK_AGENT_OFFLINE_AFTER", 5*time.Minute, 30*time.Second, 24*time.Hour)
+}
+
+// AgentLivenessInterval returns how often agent statuses are re-evaluated.
+// Controlled by HOSTLINK_AGENT_LIVENESS_INTERVAL (default: 15s, clamped to [1s, 5m]).
+func AgentLivenessInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_AGENT_LIVENESS_INTERVAL", 15*time.Second, time.Second, 5*time.Minute)
+}
+
+// WebhookDeliveryInterval returns how often queued webhook deliveries are sent.
+// Controlled by HOSTLINK_WEBHOOK_DELIVERY_INTERVAL (default: 5s, clamped to [1s, 1m]).
+func WebhookDeliveryInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_WEBHOOK_DELIVERY_INTERVAL", 5*time.Second, time.Second, time.Minute)
+}
+
+// WebhookTimeout returns how long a webhook delivery attempt may take.
+// Controlled by HOSTLINK_WEBHOOK_TIMEOUT (default: 10s, clamped to [1s, 1m]).
+func WebhookTimeout() time.Duration {
+	return parseDurationClamped("HOSTLINK_WEBHOOK_TIMEOUT", 10*time.Second, time.Second, time.Minute)
+}
+
+// WebhookMaxBackoff returns the longest wait between webhook delivery retries.
+// Controlled by HOSTLINK_WEBHOOK_MAX_BACKOFF (default: 1h, clamped to [1m, 24h]).
+func WebhookMaxBackoff() time.Duration {
+	return parseDurationClamped("HOSTLINK_WEBHOOK_MAX_BACKOFF", time.Hour, time.Minute, 24*time.Hour)
+}
+
+// WebhookMaxAttempts returns how many times a webhook delivery is attempted
+// before it is marked failed.
+// Controlled by HOSTLINK_WEBHOOK_MAX_ATTEMPTS (default: 8).
+func WebhookMaxAttempts() int {
+	return int(parseInt64Positive("HOSTLINK_WEBHOOK_MAX_ATTEMPTS", 8))
+}
+
 // TaskOutputFlushInterval returns how often buffered task output is flushed.
 // Controlled by HOSTLINK_TASK_OUTPUT_FLUSH_INTERVAL (default: 100ms, clamped to [1ms, 5s]).
 func TaskOutputFlushInterval() time.Duration {
@@ -200,6 +390,30 @@ func HeartbeatInterval() time.Duration {
 	return parseDurationClamped("HOSTLINK_HEARTBEAT_INTERVAL", 5*time.Second, 10*time.Millisecond, 5*time.Minute)
 }
 
+// AgentTagsPath returns the YAML file of key: value tags the agent declares.
+// A missing file declares none.
+// Controlled by HOSTLINK_TAGS_PATH (default: /etc/hostlink/tags.yml).
+func AgentTagsPath() string {
+	if path := os.Getenv("HOSTLINK_TAGS_PATH"); path != "" {
+		return path
+	}
+	return "/etc/hostlink/tags.yml"
+}
+
+// AgentTagsScript returns the discovery script whose key=value output lines
+// the agent declares as tags. Controlled by HOSTLINK_TAGS_SCRIPT (default:
+// none).
+func AgentTagsScript() string {
+	return strings.TrimSpace(os.Getenv("HOSTLINK_TAGS_SCRIPT"))
+}
+
+// AgentTagsScriptInterval returns how long the discovery script's tags are
+// reused before it runs again.
+// Controlled by HOSTLINK_TAGS_SCRIPT_INTERVAL (default: 5m, clamped to [10s, 24h]).
+func AgentTagsScriptInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_TAGS_SCRIPT_INTERVAL", 5*time.Minute, 10*time.Second, 24*time.Hour)
+}
+
 // TraefikEndpoint returns the Traefik metrics endpoint.
 // Controlled by HOSTLINK_TRAEFIK_ENDPOINT (default: http://localhost:8080/metrics).
 func TraefikEndpoint() string {
@@ -232,6 +446,165 @@ func UpdateLockTimeout() time.Duration {
 	return parseDurationClamped("HOSTLINK_UPDATE_LOCK_TIMEOUT", defaultTimeout, minTimeout, maxTimeout)
 }
 
+// TLSPinnedSPKIHashes returns the base64 SHA-256 SPKI pins for the control plane certificate.
+// Controlled by HOSTLINK_TLS_PINNED_SPKI (comma-separated, default: no pinning).
+func TLSPinnedSPKIHashes() []string {
+	return parseList("HOSTLINK_TLS_PINNED_SPKI")
+}
+
+// MTLSEnabled returns whether the agent requests and presents a client certificate.
+// Controlled by HOSTLINK_MTLS_ENABLED (default: false).
+func MTLSEnabled() bool {
+	return parseBoolEnabled("HOSTLINK_MTLS_ENABLED", false)
+}
+
+// AgentClientCertPath returns where the agent's mTLS client certificate is stored.
+// Controlled by HOSTLINK_CLIENT_CERT_PATH (default: <state dir>/agent.crt).
+func AgentClientCertPath() string {
+	if path := strings.TrimSpace(os.Getenv("HOSTLINK_CLIENT_CERT_PATH")); path != "" {
+		return path
+	}
+	return filepath.Join(AgentStatePath(), "agent.crt")
+}
+
+// ClientCertRenewBefore returns how long before expiry the client certificate is renewed.
+// Controlled by HOSTLINK_MTLS_RENEW_BEFORE (default: 168h, clamped to [1h, 1440h]).
+func ClientCertRenewBefore() time.Duration {
+	return parseDurationClamped("HOSTLINK_MTLS_RENEW_BEFORE", 7*24*time.Hour, time.Hour, 60*24*time.Hour)
+}
+
+// ClientCertRenewCheckInterval returns how often the client certificate expiry is checked.
+// Controlled by HOSTLINK_MTLS_RENEW_CHECK_INTERVAL (default: 1h, clamped to [1m, 24h]).
+func ClientCertRenewCheckInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_MTLS_RENEW_CHECK_INTERVAL", time.Hour, time.Minute, 24*time.Hour)
+}
+
+// ServerTLSCertPath returns the certificate the server listens with.
+// Controlled by HOSTLINK_TLS_CERT_PATH (default: plain HTTP).
+func ServerTLSCertPath() string {
+	return strings.TrimSpace(os.Getenv("HOSTLINK_TLS_CERT_PATH"))
+}
+
+// ServerTLSKeyPath returns the private key for ServerTLSCertPath.
+// Controlled by HOSTLINK_TLS_KEY_PATH.
+func ServerTLSKeyPath() string {
+	return strings.TrimSpace(os.Getenv("HOSTLINK_TLS_KEY_PATH"))
+}
+
+// MTLSCACertPath returns the CA certificate used to issue and verify agent client certificates.
+// Controlled by HOSTLINK_MTLS_CA_CERT_PATH (default: client certificates disabled).
+func MTLSCACertPath() string {
+	return strings.TrimSpace(os.Getenv("HOSTLINK_MTLS_CA_CERT_PATH"))
+}
+
+// MTLSCAKeyPath returns the private key for MTLSCACertPath.
+// Controlled by HOSTLINK_MTLS_CA_KEY_PATH.
+func MTLSCAKeyPath() string {
+	return strings.TrimSpace(os.Getenv("HOSTLINK_MTLS_CA_KEY_PATH"))
+}
+
+// MTLSClientCertValidity returns the lifetime of issued agent client certificates.
+// Controlled by HOSTLINK_MTLS_CERT_VALIDITY (default: 720h, clamped to [1h, 8760h]).
+func MTLSClientCertValidity() time.Duration {
+	return parseDurationClamped("HOSTLINK_MTLS_CERT_VALIDITY", 30*24*time.Hour, time.Hour, 365*24*time.Hour)
+}
+
+// MTLSRequired returns whether authenticated agent routes require a client certificate.
+// Controlled by HOSTLINK_MTLS_REQUIRED (default: false).
+func MTLSRequired() bool {
+	return parseBoolEnabled("HOSTLINK_MTLS_REQUIRED", false)
+}
+
+// OperatorAuthRequired returns whether the operator API rejects requests without an API token.
+// Controlled by HOSTLINK_OPERATOR_AUTH_REQUIRED (default: true).
+func OperatorAuthRequired() bool {
+	return parseBoolEnabled("HOSTLINK_OPERATOR_AUTH_REQUIRED", true)
+}
+
+// NonceStore returns where agent request nonces are tracked to reject replays:
+// "sql" in the server database, shared by every server, or "memory" in a
+// bounded in-process cache. Controlled by HOSTLINK_NONCE_STORE (default: off).
+func NonceStore() string {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("HOSTLINK_NONCE_STORE"))); mode {
+	case "sql", "memory":
+		return mode
+	default:
+		return ""
+	}
+}
+
+// NonceCacheSize returns how many nonces the "memory" nonce store holds.
+// Controlled by HOSTLINK_NONCE_CACHE_SIZE (default: 100000).
+func NonceCacheSize() int {
+	return int(parseInt64Positive("HOSTLINK_NONCE_CACHE_SIZE", 100000))
+}
+
+// NonceCleanupInterval returns how often expired nonces are deleted.
+// Controlled by HOSTLINK_NONCE_CLEANUP_INTERVAL (default: 1m, clamped to [1s, 1h]).
+func NonceCleanupInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_NONCE_CLEANUP_INTERVAL", time.Minute, time.Second, time.Hour)
+}
+
+// EnrollmentTokenRequired returns whether agents must register with an enrollment token.
+// Controlled by HOSTLINK_ENROLLMENT_TOKEN_REQUIRED (default: true).
+func EnrollmentTokenRequired() bool {
+	return parseBoolEnabled("HOSTLINK_ENROLLMENT_TOKEN_REQUIRED", true)
+}
+
+// RegistrationApprovalEnabled returns whether registrations that look like a
+// clone or a replacement of an existing agent are held for operator approval.
+// Controlled by HOSTLINK_REGISTRATION_APPROVAL_ENABLED (default: true).
+func RegistrationApprovalEnabled() bool {
+	return parseBoolEnabled("HOSTLINK_REGISTRATION_APPROVAL_ENABLED", true)
+}
+
+// RegistrationPendingInterval returns how often the agent retries a
+// registration held for approval.
+// Controlled by HOSTLINK_REGISTRATION_PENDING_INTERVAL (default: 1m, clamped to [5s, 1h]).
+func RegistrationPendingInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_REGISTRATION_PENDING_INTERVAL", time.Minute, 5*time.Second, time.Hour)
+}
+
+// SignatureVersion returns the scheme agents sign requests with: 2 also
+// covers the method, path, query and body, 1 only the agent ID, timestamp and
+// nonce, for servers that do not verify version 2.
+// Controlled by HOSTLINK_SIGNATURE_VERSION (default: 2).
+func SignatureVersion() int {
+	return parseSignatureVersion("HOSTLINK_SIGNATURE_VERSION", 2)
+}
+
+// MinSignatureVersion returns the oldest signature scheme the server accepts
+// from agents; 2 rejects agents still signing with version 1.
+// Controlled by HOSTLINK_MIN_SIGNATURE_VERSION (default: 1).
+func MinSignatureVersion() int {
+	return parseSignatureVersion("HOSTLINK_MIN_SIGNATURE_VERSION", 1)
+}
+
+// KeyRotationEnabled returns whether the agent rotates its key on schedule.
+// Controlled by HOSTLINK_KEY_ROTATION_ENABLED (default: true).
+func KeyRotationEnabled() bool {
+	return parseBoolEnabled("HOSTLINK_KEY_ROTATION_ENABLED", true)
+}
+
+// KeyRotationInterval returns how old the agent key may get before it is rotated.
+// Controlled by HOSTLINK_KEY_ROTATION_INTERVAL (default: 2160h, clamped to [1h, 8760h]).
+func KeyRotationInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_KEY_ROTATION_INTERVAL", 90*24*time.Hour, time.Hour, 365*24*time.Hour)
+}
+
+// KeyRotationCheckInterval returns how often the agent key age is checked.
+// Controlled by HOSTLINK_KEY_ROTATION_CHECK_INTERVAL (default: 1h, clamped to [1m, 24h]).
+func KeyRotationCheckInterval() time.Duration {
+	return parseDurationClamped("HOSTLINK_KEY_ROTATION_CHECK_INTERVAL", time.Hour, time.Minute, 24*time.Hour)
+}
+
+// KeyRotationOverlap returns how long an agent's previous key keeps
+// authenticating it after a rotation.
+// Controlled by HOSTLINK_KEY_ROTATION_OVERLAP (default: 1h, clamped to [1m, 24h]).
+func KeyRotationOverlap() time.Duration {
+	return parseDurationClamped("HOSTLINK_KEY_ROTATION_OVERLAP", time.Hour, time.Minute, 24*time.Hour)
+}
+
 // parseDurationClamped reads a duration from an environment variable, clamping
 // it to [min, max]. Returns defaultVal if the env var is empty or unparseable.
 func parseDurationClamped(envVar string, defaultVal, min, max time.Duration) time.Duration {
@@ -281,6 +654,30 @@ func parseBoolEnabled(envVar string, defaultVal bool) bool {
 	}
 }
 
+func parseSignatureVersion(envVar string, defaultVal int) int {
+	switch v := strings.TrimSpace(os.Getenv(envVar)); v {
+	case "":
+		return defaultVal
+	case "1":
+		return 1
+	case "2":
+		return 2
+	default:
+		log.Warnf("invalid %s value %q, using default %d", envVar, v, defaultVal)
+		return defaultVal
+	}
+}
+
+func parseList(envVar string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(envVar), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func init() {
 	env := os.Getenv("APP_ENV")
 
@@ -266,3 +266,277 @@ func TestLocalTaskStoreTerminalReserveBytes_InvalidFallsToDefault(t *testing.T)
 
 	assert.Equal(t, int64(1024*1024), LocalTaskStoreTerminalReserveBytes())
 }
+
+func TestWebSocketOutputBatchConfig_Defaults(t *testing.T) {
+	t.Setenv("HOSTLINK_WS_OUTPUT_BATCH_ENABLED", "")
+	t.Setenv("HOSTLINK_WS_OUTPUT_BATCH_MAX_MESSAGES", "")
+	t.Setenv("HOSTLINK_WS_OUTPUT_BATCH_MAX_BYTES", "")
+	t.Setenv("HOSTLINK_WS_OUTPUT_BATCH_INTERVAL", "")
+
+	assert.False(t, WebSocketOutputBatchEnabled())
+	assert.Equal(t, 64, WebSocketOutputBatchMaxMessages())
+	assert.Equal(t, int64(64*1024), WebSocketOutputBatchMaxBytes())
+	assert.Equal(t, 50*time.Millisecond, WebSocketOutputBatchInterval())
+}
+
+func TestWebSocketOutputBatchConfig_CustomValues(t *testing.T) {
+	t.Setenv("HOSTLINK_WS_OUTPUT_BATCH_ENABLED", "true")
+	t.Setenv("HOSTLINK_WS_OUTPUT_BATCH_MAX_MESSAGES", "16")
+	t.Setenv("HOSTLINK_WS_OUTPUT_BATCH_MAX_BYTES", "8192")
+	t.Setenv("HOSTLINK_WS_OUTPUT_BATCH_INTERVAL", "10s")
+
+	assert.True(t, WebSocketOutputBatchEnabled())
+	assert.Equal(t, 16, WebSocketOutputBatchMaxMessages())
+	assert.Equal(t, int64(8192), WebSocketOutputBatchMaxBytes())
+	assert.Equal(t, 5*time.Second, WebSocketOutputBatchInterval())
+}
+
+func TestLocalTaskStoreEncryptionConfig_Defaults(t *testing.T) {
+	t.Setenv("HOSTLINK_LOCAL_STORE_ENCRYPTION", "")
+	t.Setenv("HOSTLINK_LOCAL_STORE_KEY_FILE", "")
+	t.Setenv("HOSTLINK_STATE_PATH", "/tmp/hostlink-state")
+	t.Setenv("HOSTLINK_LOCAL_STORE_KEY_ROTATION_INTERVAL", "")
+	t.Setenv("HOSTLINK_LOCAL_STORE_ACKED_RETENTION", "")
+
+	assert.Equal(t, "", LocalTaskStoreEncryption())
+	assert.Equal(t, "/tmp/hostlink-state/task_store.key", LocalTaskStoreKeyFile())
+	assert.Equal(t, 720*time.Hour, LocalTaskStoreKeyRotationInterval())
+	assert.Equal(t, 24*time.Hour, LocalTaskStoreAckedRetention())
+}
+
+func TestLocalTaskStoreEncryptionConfig_CustomValues(t *testing.T) {
+	t.Setenv("HOSTLINK_LOCAL_STORE_ENCRYPTION", "Key-File")
+	t.Setenv("HOSTLINK_LOCAL_STORE_KEY_FILE", "/etc/hostlink/store.key")
+	t.Setenv("HOSTLINK_LOCAL_STORE_KEY_ROTATION_INTERVAL", "1m")
+	t.Setenv("HOSTLINK_LOCAL_STORE_ACKED_RETENTION", "2h")
+
+	assert.Equal(t, "key-file", LocalTaskStoreEncryption())
+	assert.Equal(t, "/etc/hostlink/store.key", LocalTaskStoreKeyFile())
+	assert.Equal(t, time.Hour, LocalTaskStoreKeyRotationInterval())
+	assert.Equal(t, 2*time.Hour, LocalTaskStoreAckedRetention())
+
+	t.Setenv("HOSTLINK_LOCAL_STORE_ENCRYPTION", "rot13")
+	assert.Equal(t, "", LocalTaskStoreEncryption())
+}
+
+func TestLocalTaskStoreCompactionConfig_Defaults(t *testing.T) {
+	t.Setenv("HOSTLINK_LOCAL_STORE_EXECUTION_RETENTION", "")
+	t.Setenv("HOSTLINK_LOCAL_STORE_MAX_FINISHED_EXECUTIONS", "")
+	t.Setenv("HOSTLINK_LOCAL_STORE_MAX_ACKED_MESSAGES", "")
+	t.Setenv("HOSTLINK_LOCAL_STORE_COMPACTION_INTERVAL", "")
+
+	assert.Equal(t, 168*time.Hour, LocalTaskStoreExecutionRetention())
+	assert.Equal(t, 1000, LocalTaskStoreMaxFinishedExecutions())
+	assert.Equal(t, 10000, LocalTaskStoreMaxAckedMessages())
+	assert.Equal(t, time.Hour, LocalTaskStoreCompactionInterval())
+}
+
+func TestLocalTaskStoreCompactionConfig_CustomValues(t *testing.T) {
+	t.Setenv("HOSTLINK_LOCAL_STORE_EXECUTION_RETENTION", "30m")
+	t.Setenv("HOSTLINK_LOCAL_STORE_MAX_FINISHED_EXECUTIONS", "50")
+	t.Setenv("HOSTLINK_LOCAL_STORE_MAX_ACKED_MESSAGES", "-1")
+	t.Setenv("HOSTLINK_LOCAL_STORE_COMPACTION_INTERVAL", "48h")
+
+	assert.Equal(t, time.Hour, LocalTaskStoreExecutionRetention())
+	assert.Equal(t, 50, LocalTaskStoreMaxFinishedExecutions())
+	assert.Equal(t, 10000, LocalTaskStoreMaxAckedMessages())
+	assert.Equal(t, 24*time.Hour, LocalTaskStoreCompactionInterval())
+}
+
+func TestTaskLeases_DefaultsAndClamping(t *testing.T) {
+	t.Setenv("HOSTLINK_TASK_CLAIM_LEASE", "")
+	t.Setenv("HOSTLINK_TASK_RUN_LEASE", "")
+
+	assert.Equal(t, 5*time.Minute, TaskClaimLease())
+	assert.Equal(t, time.Hour, TaskRunLease())
+
+	t.Setenv("HOSTLINK_TASK_CLAIM_LEASE", "1s")
+	t.Setenv("HOSTLINK_TASK_RUN_LEASE", "2h")
+
+	assert.Equal(t, 10*time.Second, TaskClaimLease())
+	assert.Equal(t, 2*time.Hour, TaskRunLease())
+}
+
+func TestMetricsRetention_DefaultsAndClamping(t *testing.T) {
+	t.Setenv("HOSTLINK_METRICS_RAW_RETENTION", "")
+	t.Setenv("HOSTLINK_METRICS_ROLLUP_1M_RETENTION", "")
+	t.Setenv("HOSTLINK_METRICS_ROLLUP_5M_RETENTION", "")
+	t.Setenv("HOSTLINK_METRICS_ROLLUP_1H_RETENTION", "")
+	t.Setenv("HOSTLINK_METRICS_ROLLUP_INTERVAL", "")
+
+	assert.Equal(t, 48*time.Hour, MetricsRawRetention())
+	assert.Equal(t, 168*time.Hour, MetricsRollup1mRetention())
+	assert.Equal(t, 720*time.Hour, MetricsRollup5mRetention())
+	assert.Equal(t, 8760*time.Hour, MetricsRollup1hRetention())
+	assert.Equal(t, time.Minute, MetricsRollupInterval())
+
+	t.Setenv("HOSTLINK_METRICS_RAW_RETENTION", "30m")
+	t.Setenv("HOSTLINK_METRICS_ROLLUP_1M_RETENTION", "24h")
+	t.Setenv("HOSTLINK_METRICS_ROLLUP_1H_RETENTION", "1h")
+	t.Setenv("HOSTLINK_METRICS_ROLLUP_INTERVAL", "1s")
+
+	assert.Equal(t, 2*time.Hour, MetricsRawRetention())
+	assert.Equal(t, 24*time.Hour, MetricsRollup1mRetention())
+	assert.Equal(t, 24*time.Hour, MetricsRollup1hRetention())
+	assert.Equal(t, 10*time.Second, MetricsRollupInterval())
+}
+
+func TestAgentLiveness_DefaultsAndClamping(t *testing.T) {
+	t.Setenv("HOSTLINK_AGENT_STALE_AFTER", "")
+	t.Setenv("HOSTLINK_AGENT_OFFLINE_AFTER", "")
+	t.Setenv("HOSTLINK_AGENT_LIVENESS_INTERVAL", "")
+
+	assert.Equal(t, time.Minute, AgentStaleAfter())
+	assert.Equal(t, 5*time.Minute, AgentOfflineAfter())
+	assert.Equal(t, 15*time.Second, AgentLivenessInterval())
+
+	t.Setenv("HOSTLINK_AGENT_STALE_AFTER", "2m")
+	t.Setenv("HOSTLINK_AGENT_OFFLINE_AFTER", "1s")
+	t.Setenv("HOSTLINK_AGENT_LIVENESS_INTERVAL", "1h")
+
+	assert.Equal(t, 2*time.Minute, AgentStaleAfter())
+	assert.Equal(t, 30*time.Second, AgentOfflineAfter())
+	assert.Equal(t, 5*time.Minute, AgentLivenessInterval())
+}
+
+func TestWebhooks_DefaultsAndClamping(t *testing.T) {
+	t.Setenv("HOSTLINK_WEBHOOK_DELIVERY_INTERVAL", "")
+	t.Setenv("HOSTLINK_WEBHOOK_TIMEOUT", "")
+	t.Setenv("HOSTLINK_WEBHOOK_MAX_BACKOFF", "")
+	t.Setenv("HOSTLINK_WEBHOOK_MAX_ATTEMPTS", "")
+
+	assert.Equal(t, 5*time.Second, WebhookDeliveryInterval())
+	assert.Equal(t, 10*time.Second, WebhookTimeout())
+	assert.Equal(t, time.Hour, WebhookMaxBackoff())
+	assert.Equal(t, 8, WebhookMaxAttempts())
+
+	t.Setenv("HOSTLINK_WEBHOOK_DELIVERY_INTERVAL", "1ms")
+	t.Setenv("HOSTLINK_WEBHOOK_TIMEOUT", "5m")
+	t.Setenv("HOSTLINK_WEBHOOK_MAX_BACKOFF", "48h")
+	t.Setenv("HOSTLINK_WEBHOOK_MAX_ATTEMPTS", "3")
+
+	assert.Equal(t, time.Second, WebhookDeliveryInterval())
+	assert.Equal(t, time.Minute, WebhookTimeout())
+	assert.Equal(t, 24*time.Hour, WebhookMaxBackoff())
+	assert.Equal(t, 3, WebhookMaxAttempts())
+}
+
+func TestOperatorAuthRequired(t *testing.T) {
+	t.Setenv("HOSTLINK_OPERATOR_AUTH_REQUIRED", "")
+	assert.True(t, OperatorAuthRequired())
+
+	t.Setenv("HOSTLINK_OPERATOR_AUTH_REQUIRED", "false")
+	assert.False(t, OperatorAuthRequired())
+}
+
+func TestEnrollmentTokenRequired(t *testing.T) {
+	t.Setenv("HOSTLINK_ENROLLMENT_TOKEN_REQUIRED", "")
+	assert.True(t, EnrollmentTokenRequired())
+
+	t.Setenv("HOSTLINK_ENROLLMENT_TOKEN_REQUIRED", "false")
+	assert.False(t, EnrollmentTokenRequired())
+}
+
+func TestRegistrationApprovalConfig(t *testing.T) {
+	t.Setenv("HOSTLINK_REGISTRATION_APPROVAL_ENABLED", "")
+	t.Setenv("HOSTLINK_REGISTRATION_PENDING_INTERVAL", "")
+	assert.True(t, RegistrationApprovalEnabled())
+	assert.Equal(t, time.Minute, RegistrationPendingInterval())
+
+	t.Setenv("HOSTLINK_REGISTRATION_APPROVAL_ENABLED", "false")
+	t.Setenv("HOSTLINK_REGISTRATION_PENDING_INTERVAL", "30s")
+	assert.False(t, RegistrationApprovalEnabled())
+	assert.Equal(t, 30*time.Second, RegistrationPendingInterval())
+
+	t.Setenv("HOSTLINK_REGISTRATION_PENDING_INTERVAL", "1s")
+	assert.Equal(t, 5*time.Second, RegistrationPendingInterval())
+}
+
+func TestAgentTagsConfig(t *testing.T) {
+	t.Setenv("HOSTLINK_TAGS_PATH", "")
+	t.Setenv("HOSTLINK_TAGS_SCRIPT", "")
+	t.Setenv("HOSTLINK_TAGS_SCRIPT_INTERVAL", "")
+	assert.Equal(t, "/etc/hostlink/tags.yml", AgentTagsPath())
+	assert.Equal(t, "", AgentTagsScript())
+	assert.Equal(t, 5*time.Minute, AgentTagsScriptInterval())
+
+	t.Setenv("HOSTLINK_TAGS_PATH", "/opt/tags.yml")
+	t.Setenv("HOSTLINK_TAGS_SCRIPT", " /opt/discover-tags ")
+	t.Setenv("HOSTLINK_TAGS_SCRIPT_INTERVAL", "1s")
+	assert.Equal(t, "/opt/tags.yml", AgentTagsPath())
+	assert.Equal(t, "/opt/discover-tags", AgentTagsScript())
+	assert.Equal(t, 10*time.Second, AgentTagsScriptInterval())
+}
+
+func TestNonceConfig(t *testing.T) {
+	t.Setenv("HOSTLINK_NONCE_STORE", "")
+	t.Setenv("HOSTLINK_NONCE_CACHE_SIZE", "")
+	t.Setenv("HOSTLINK_NONCE_CLEANUP_INTERVAL", "")
+	assert.Equal(t, "", NonceStore())
+	assert.Equal(t, 100000, NonceCacheSize())
+	assert.Equal(t, time.Minute, NonceCleanupInterval())
+
+	t.Setenv("HOSTLINK_NONCE_STORE", "Memory")
+	t.Setenv("HOSTLINK_NONCE_CACHE_SIZE", "500")
+	t.Setenv("HOSTLINK_NONCE_CLEANUP_INTERVAL", "30s")
+	assert.Equal(t, "memory", NonceStore())
+	assert.Equal(t, 500, NonceCacheSize())
+	assert.Equal(t, 30*time.Second, NonceCleanupInterval())
+
+	t.Setenv("HOSTLINK_NONCE_STORE", "redis")
+	assert.Equal(t, "", NonceStore())
+}
+
+func TestSignatureVersionConfig(t *testing.T) {
+	t.Setenv("HOSTLINK_SIGNATURE_VERSION", "")
+	t.Setenv("HOSTLINK_MIN_SIGNATURE_VERSION", "")
+	assert.Equal(t, 2, SignatureVersion())
+	assert.Equal(t, 1, MinSignatureVersion())
+
+	t.Setenv("HOSTLINK_SIGNATURE_VERSION", "1")
+	t.Setenv("HOSTLINK_MIN_SIGNATURE_VERSION", "2")
+	assert.Equal(t, 1, SignatureVersion())
+	assert.Equal(t, 2, MinSignatureVersion())
+
+	t.Setenv("HOSTLINK_SIGNATURE_VERSION", "3")
+	t.Setenv("HOSTLINK_MIN_SIGNATURE_VERSION", "v2")
+	assert.Equal(t, 2, SignatureVersion())
+	assert.Equal(t, 1, MinSignatureVersion())
+}
+
+func TestKeyRotationConfig(t *testing.T) {
+	t.Setenv("HOSTLINK_KEY_ROTATION_ENABLED", "")
+	t.Setenv("HOSTLINK_KEY_ROTATION_INTERVAL", "")
+	t.Setenv("HOSTLINK_KEY_ROTATION_CHECK_INTERVAL", "")
+	t.Setenv("HOSTLINK_KEY_ROTATION_OVERLAP", "")
+	assert.True(t, KeyRotationEnabled())
+	assert.Equal(t, 90*24*time.Hour, KeyRotationInterval())
+	assert.Equal(t, time.Hour, KeyRotationCheckInterval())
+	assert.Equal(t, time.Hour, KeyRotationOverlap())
+
+	t.Setenv("HOSTLINK_KEY_ROTATION_ENABLED", "false")
+	t.Setenv("HOSTLINK_KEY_ROTATION_INTERVAL", "720h")
+	t.Setenv("HOSTLINK_KEY_ROTATION_OVERLAP", "30m")
+	assert.False(t, KeyRotationEnabled())
+	assert.Equal(t, 30*24*time.Hour, KeyRotationInterval())
+	assert.Equal(t, 30*time.Minute, KeyRotationOverlap())
+
+	t.Setenv("HOSTLINK_KEY_ROTATION_INTERVAL", "1m")
+	t.Setenv("HOSTLINK_KEY_ROTATION_OVERLAP", "72h")
+	assert.Equal(t, time.Hour, KeyRotationInterval())
+	assert.Equal(t, 24*time.Hour, KeyRotationOverlap())
+}
+
+func TestAgentKeyType(t *testing.T) {
+	t.Setenv("HOSTLINK_AGENT_KEY_TYPE", "")
+	assert.Equal(t, "ed25519", AgentKeyType())
+
+	t.Setenv("HOSTLINK_AGENT_KEY_TYPE", " RSA ")
+	assert.Equal(t, "rsa", AgentKeyType())
+
+	t.Setenv("HOSTLINK_AGENT_KEY_TYPE", "ecdsa")
+	assert.Equal(t, "ecdsa", AgentKeyType())
+
+	t.Setenv("HOSTLINK_AGENT_KEY_TYPE", "dsa")
+	assert.Equal(t, "ed25519", AgentKeyType())
+}
@@ -2,11 +2,22 @@ package config
 
 import (
 	"hostlink/app"
+	"hostlink/app/controller/agentmetrics"
 	"hostlink/app/controller/agents"
+	"hostlink/app/controller/audits"
+	"hostlink/app/controller/credentials"
+	"hostlink/app/controller/enrollmenttokens"
 	"hostlink/app/controller/health"
+	"hostlink/app/controller/operators"
+	"hostlink/app/controller/registrations"
+	"hostlink/app/controller/secrets"
 	"hostlink/app/controller/static"
 	"hostlink/app/controller/tasks"
+	"hostlink/app/controller/webhooks"
 	"hostlink/app/middleware/agentauth"
+	"hostlink/app/middleware/auditlog"
+	"hostlink/app/middleware/operatorauth"
+	"hostlink/domain/operator"
 
 	"github.com/labstack/echo/v4"
 )
@@ -17,20 +28,102 @@ func AddRoutesV2(e *echo.Echo, container *app.Container) {
 	static.Register(root)
 	health.Register(root)
 	// Initialize middleware
-	authMiddleware := agentauth.New(container.AgentRepository)
+	agentAuthConfig := agentauth.Config{
+		RequireClientCertificate: container.RequireClientCertificate,
+		Nonces:                   container.Nonces,
+		MinSignatureVersion:      container.MinSignatureVersion,
+	}
+	// A quarantined agent keeps heartbeating and pushing metrics, and is
+	// rejected on every other agent route
+	quarantineAuth := agentauth.NewWithConfig(container.AgentRepository, agentAuthConfig)
+	agentAuthConfig.RejectQuarantined = true
+	authMiddleware := agentauth.NewWithConfig(container.AgentRepository, agentAuthConfig)
+	// Certificate renewal is authenticated by the request signature alone,
+	// so an agent whose certificate expired is not locked out
+	renewalAuth := agentauth.NewWithConfig(container.AgentRepository, agentauth.Config{
+		Nonces:              container.Nonces,
+		MinSignatureVersion: container.MinSignatureVersion,
+		RejectQuarantined:   true,
+	})
+	operatorAuth := operatorauth.NewWithConfig(container.Operators, operatorauth.Config{
+		Required: container.RequireOperatorToken,
+	})
+	adminOnly := operatorauth.RequireRole(operator.RoleAdmin, operator.RoleAdmin)
+	viewers := operatorauth.RequireRole(operator.RoleViewer, operator.RoleAdmin)
+	agentInScope := operatorauth.RequireAgentInScope(container.AgentRepository)
+	// The audit middleware goes first so it also records rejected requests
+	audit := auditlog.New(container.AuditRepository)
 
 	// Initialize handlers with dependencies
 	agentsHandler := agents.NewHandlerWithRepo(container.RegistrationService, container.AgentRepository)
-	tasksHandler := tasks.NewHandler(container.TaskRepository)
+	if container.CertificateAuthority != nil {
+		agentsHandler.WithCertificateIssuer(container.CertificateAuthority)
+	}
+	if container.KeyRotation != nil {
+		agentsHandler.WithKeyRotation(container.KeyRotation)
+	}
+	tasksHandler := tasks.NewHandler(container.TaskRepository).
+		WithLeases(container.TaskClaimLease, container.TaskRunLease).
+		WithOutput(container.TaskOutputRepository).
+		WithAgents(container.AgentRepository).
+		WithSecrets(container.SecretRepository)
+	claimLease := container.TaskClaimLease
+	if claimLease <= 0 {
+		claimLease = tasks.DefaultClaimLease
+	}
+	agentsHandler.WithTaskClaimer(container.TaskRepository, claimLease)
+	registrationsHandler := registrations.NewHandler(container.RegistrationService)
+	if container.Webhooks != nil {
+		agentsHandler.WithPublisher(container.Webhooks)
+		tasksHandler.WithPublisher(container.Webhooks)
+		registrationsHandler.WithPublisher(container.Webhooks)
+	}
+	metricsHandler := agentmetrics.NewHandler(container.MetricsRepository, container.MetricRollup)
+	credentialsHandler := credentials.NewHandler(container.CredentialRepository, container.AgentRepository)
+	secretsHandler := secrets.NewHandler(container.SecretRepository, container.AgentRepository)
+	webhooksHandler := webhooks.NewHandler(container.WebhookRepository)
+	operatorsHandler := operators.NewHandler(container.Operators, container.OperatorRepository)
+	auditsHandler := audits.NewHandler(container.AuditRepository, container.Audit)
+	enrollmentTokensHandler := enrollmenttokens.NewHandler(container.Enrollment)
 
 	// Register routes using the new pattern
-	agentsHandler.RegisterRoutes(e.Group("/api/v1/agents"))
+	agentsGroup := e.Group("/api/v1/agents", audit)
+	agentsHandler.RegisterRoutes(agentsGroup)
 
-	// TODO: Remove v2 routes once proper auth is in place
-	tasksHandler.RegisterRoutes(e.Group("/api/v2/tasks"))
+	// Register the routes operators read agents with; a scoped operator
+	// only sees the agents in its scope
+	agentsHandler.RegisterListRoutes(e.Group("/api/v1/agents", audit, operatorAuth, viewers))
+	agentReadGroup := e.Group("/api/v1/agents/:id", audit, operatorAuth, viewers, agentInScope)
+	agentsHandler.RegisterReadRoutes(agentReadGroup)
+	metricsHandler.RegisterRoutes(agentReadGroup)
 
-	// Register authenticated task routes
+	// Register routes an authenticated agent calls on its own resource
+	agentGroup := e.Group("/api/v1/agents/:id")
+	agentGroup.Use(audit, authMiddleware)
+	agentsHandler.RegisterAgentRoutes(agentGroup)
+	credentialsHandler.RegisterAgentRoutes(agentGroup)
+	secretsHandler.RegisterAgentRoutes(agentGroup)
+	agentsHandler.RegisterRenewalRoutes(e.Group("/api/v1/agents/:id", audit, renewalAuth))
+	quarantineGroup := e.Group("/api/v1/agents/:id", audit, quarantineAuth)
+	agentsHandler.RegisterHeartbeatRoutes(quarantineGroup)
+	metricsHandler.RegisterAgentRoutes(quarantineGroup)
+
+	// Register operator routes: viewers read tasks, operators also run
+	// them, and admins manage everything else
+	tasksHandler.RegisterRoutes(e.Group("/api/v2/tasks", audit, operatorAuth,
+		operatorauth.RequireRole(operator.RoleViewer, operator.RoleOperator)))
+	agentsHandler.RegisterAdminRoutes(e.Group("/api/v2/agents/:id", audit, operatorAuth, adminOnly))
+	credentialsHandler.RegisterRoutes(e.Group("/api/v2/agents/:id", audit, operatorAuth, adminOnly))
+	secretsHandler.RegisterRoutes(e.Group("/api/v2/agents/:id", audit, operatorAuth, adminOnly))
+	webhooksHandler.RegisterRoutes(e.Group("/api/v2/webhooks", audit, operatorAuth, adminOnly))
+	operatorsHandler.RegisterRoutes(e.Group("/api/v2/operators", audit, operatorAuth, adminOnly))
+	operatorsHandler.RegisterSelfRoutes(e.Group("/api/v2/operators", audit, operatorAuth))
+	auditsHandler.RegisterRoutes(e.Group("/api/v2/audit", audit, operatorAuth, adminOnly))
+	enrollmentTokensHandler.RegisterRoutes(e.Group("/api/v2/enrollment-tokens", audit, operatorAuth, adminOnly))
+	registrationsHandler.RegisterRoutes(e.Group("/api/v2/registrations", audit, operatorAuth, adminOnly))
+
+	// Register the task routes agents poll and report on
 	tasksGroup := e.Group("/api/v1/tasks")
-	tasksGroup.Use(authMiddleware)
-	tasksHandler.RegisterRoutes(tasksGroup)
+	tasksGroup.Use(audit, authMiddleware)
+	tasksHandler.RegisterAgentRoutes(tasksGroup)
 }
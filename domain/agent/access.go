@@ -0,0 +1,27 @@
+package agent
+
+import (
+	"errors"
+	"time"
+)
+
+// Access states of an agent, independent of its liveness. An active agent
+// runs tasks; a quarantined one still heartbeats and pushes metrics but is
+// handed no tasks; a revoked one is rejected outright, for good.
+const (
+	AccessActive      = "active"
+	AccessQuarantined = "quarantined"
+	AccessRevoked     = "revoked"
+)
+
+// ErrAgentRevoked is returned for an agent whose access was revoked, which
+// can neither be restored nor re-registered.
+var ErrAgentRevoked = errors.New("agent revoked")
+
+// AccessChange moves an agent to another access state.
+type AccessChange struct {
+	AgentID string
+	Access  string
+	Reason  string
+	At      time.Time
+}
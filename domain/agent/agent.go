@@ -21,6 +21,12 @@ type Agent struct {
 	Status        string
 	LastSeen      time.Time
 
+	// Access is one of the Access states; agents stored before access
+	// states existed are active
+	Access          string `gorm:"default:active"`
+	AccessReason    string
+	AccessChangedAt *time.Time
+
 	// Hardware fingerprint components
 	HardwareHash string
 	MachineID    string
@@ -32,11 +38,28 @@ type Agent struct {
 	TokenID      string
 	RegisteredAt time.Time
 
+	// Key rotation: the previous key still authenticates the agent until
+	// PreviousPublicKeyExpiresAt, so requests signed just before a
+	// rotation are not rejected
+	PreviousPublicKey          string
+	PreviousPublicKeyExpiresAt *time.Time
+	KeyRotatedAt               *time.Time
+
 	// Relations
 	Tags          []AgentTag
 	Registrations []AgentRegistration
 }
 
+// PublicKeys returns the keys that authenticate the agent at the given
+// time: the current key, then the previous one during a rotation overlap.
+func (a *Agent) PublicKeys(at time.Time) []string {
+	keys := []string{a.PublicKey}
+	if a.PreviousPublicKey != "" && a.PreviousPublicKeyExpiresAt != nil && at.Before(*a.PreviousPublicKeyExpiresAt) {
+		keys = append(keys, a.PreviousPublicKey)
+	}
+	return keys
+}
+
 type AgentTag struct {
 	ID        uint
 	CreatedAt time.Time
@@ -45,6 +68,10 @@ type AgentTag struct {
 	AgentID   string
 	Key       string
 	Value     string
+	// Source is TagSourceServer or TagSourceAgent; a tag added without one
+	// is a server tag. Tags stored before sources were recorded were chosen
+	// by agents and are migrated as agent tags.
+	Source string `gorm:"default:server"`
 }
 
 type AgentRegistration struct {
@@ -54,6 +81,7 @@ type AgentRegistration struct {
 	DeletedAt        *time.Time
 	AgentID          string
 	Fingerprint      string
+	TokenID          string
 	Event            string
 	Success          bool
 	Response         string
@@ -65,4 +93,5 @@ type AgentRegistration struct {
 type AgentFilters struct {
 	Status      *string
 	Fingerprint *string
+	MachineID   *string
 }
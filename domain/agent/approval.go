@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"errors"
+	"time"
+)
+
+// States of a registration held for operator approval. A pending
+// registration is approved either as the replacement of the agent it
+// resembles, which keeps that agent's ID, tags and history, or as a new
+// agent.
+const (
+	ApprovalPending     = "pending_approval"
+	ApprovalReplacement = "approved_replacement"
+	ApprovalNew         = "approved_new"
+)
+
+// Why a registration is held. A replacement claims to be an existing agent
+// whose hardware drifted, such as a moved disk; a clone presents the
+// machine ID of an existing agent without being it, such as a cloned VM.
+const (
+	DriftReplacement = "replacement"
+	DriftClone       = "clone"
+)
+
+// Registration events recorded for held and approved registrations.
+const (
+	EventPendingApproval = "pending-approval"
+	EventReplacement     = "replacement"
+)
+
+var (
+	// ErrPendingRegistrationNotFound is returned when no held registration
+	// has the given ID.
+	ErrPendingRegistrationNotFound = errors.New("pending registration not found")
+	// ErrRegistrationResolved is returned when a held registration was
+	// already approved.
+	ErrRegistrationResolved = errors.New("registration already resolved")
+)
+
+// PendingRegistration is a registration held because its hardware matches
+// an existing agent, the candidate, closely enough to be a clone or a
+// replacement of it. It keeps what approving it needs to create or update
+// the agent.
+type PendingRegistration struct {
+	ID               string     `json:"id"`
+	Fingerprint      string     `json:"fingerprint" gorm:"index"`
+	PublicKey        string     `json:"-"`
+	PublicKeyType    string     `json:"public_key_type"`
+	TokenID          string     `json:"token_id"`
+	Hostname         string     `json:"hostname"`
+	IPAddress        string     `json:"ip_address"`
+	MACAddress       string     `json:"mac_address"`
+	MachineID        string     `json:"machine_id"`
+	HardwareSnapshot string     `json:"hardware_snapshot,omitempty"`
+	TagList          string     `json:"-" gorm:"column:tags"`
+	Tags             []AgentTag `json:"tags" gorm:"-"`
+	CandidateAgentID string     `json:"candidate_agent_id"`
+	// SimilarityScore is how much of the candidate's last hardware
+	// snapshot the registration matches, in percent
+	SimilarityScore int    `json:"similarity_score"`
+	Reason          string `json:"reason"`
+	Status          string `json:"status" gorm:"index"`
+	// AgentID is the agent the registration was approved as
+	AgentID    string     `json:"agent_id,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
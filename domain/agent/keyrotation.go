@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"errors"
+	"time"
+)
+
+// EventKeyRotation is the registration event recorded when an agent
+// replaces its key.
+const EventKeyRotation = "key-rotation"
+
+var (
+	// ErrKeyChanged is returned when the agent's key was replaced while a
+	// rotation from it was in progress.
+	ErrKeyChanged = errors.New("agent key changed during rotation")
+	// ErrCredentialsChanged is returned when a rotation does not re-encrypt
+	// exactly the agent's current credential passwords.
+	ErrCredentialsChanged = errors.New("agent credentials changed during rotation")
+	// ErrSecretsChanged is returned when a rotation does not re-seal
+	// exactly the agent's current secrets.
+	ErrSecretsChanged = errors.New("agent secrets changed during rotation")
+)
+
+// KeyRotation replaces an agent's public key. OldPublicKey keeps
+// authenticating the agent until PreviousValidUntil.
+type KeyRotation struct {
+	AgentID            string
+	OldPublicKey       string
+	PublicKey          string
+	PublicKeyType      string
+	RotatedAt          time.Time
+	PreviousValidUntil time.Time
+	// Credentials carry every stored credential password of the agent,
+	// re-encrypted with the new key
+	Credentials []CredentialKey
+	// Secrets carry every secret of the agent, sealed for the new key
+	Secrets []SecretKey
+}
+
+// CredentialKey is a credential password re-encrypted with a new agent
+// key. PreviousPasswdEnc is the ciphertext it replaces, so a password
+// changed meanwhile is not overwritten.
+type CredentialKey struct {
+	ID                string
+	PreviousPasswdEnc string
+	PasswdEnc         string
+}
+
+// SecretKey is a secret value sealed for a new agent key.
+// PreviousValueEnc is the envelope it replaces, so a value changed
+// meanwhile is not overwritten.
+type SecretKey struct {
+	ID               string
+	PreviousValueEnc string
+	ValueEnc         string
+}
+
+// KeyProofMessage is the message an agent signs with its new key to prove
+// it holds the key it rotates to.
+func KeyProofMessage(agentID, publicKey string) string {
+	return "rotate-key|" + agentID + "|" + publicKey
+}
@@ -1,6 +1,9 @@
 package agent
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Repository interface {
 	Create(ctx context.Context, agent *Agent) error
@@ -9,9 +12,56 @@ type Repository interface {
 	FindByID(ctx context.Context, id string) (*Agent, error)
 	FindAll(ctx context.Context, filters AgentFilters) ([]Agent, error)
 	GetPublicKeyByAgentID(ctx context.Context, agentID string) (string, error)
+	// GetPublicKeysByAgentID returns the keys that authenticate the agent
+	// at the given time, the current key first.
+	GetPublicKeysByAgentID(ctx context.Context, agentID string, at time.Time) ([]string, error)
+	// GetAccessByAgentID returns the agent's access state.
+	GetAccessByAgentID(ctx context.Context, agentID string) (string, error)
+	// SetAccess moves the agent to change.Access. A revoked agent stays
+	// revoked: any other change returns ErrAgentRevoked.
+	SetAccess(ctx context.Context, change AccessChange) error
+	// RotateKey replaces the agent's key and its credential passwords,
+	// and records the rotation in the registration history.
+	RotateKey(ctx context.Context, rotation *KeyRotation) error
 	AddTags(ctx context.Context, agentID string, tags []AgentTag) error
-	UpdateTags(ctx context.Context, agentID string, tags []AgentTag) error
+	// FindTags lists every tag of the agent, agent tags shadowed by a server
+	// tag included.
+	FindTags(ctx context.Context, agentID string) ([]AgentTag, error)
+	// SetTag sets the agent's server tag key to value.
+	SetTag(ctx context.Context, agentID, key, value string) (*AgentTag, error)
+	// DeleteTag removes the agent's server tag key, and returns
+	// ErrTagNotFound when it has none.
+	DeleteTag(ctx context.Context, agentID, key string) error
+	// SetDeclaredTags replaces the tags the agent declared, keeping its
+	// server tags.
+	SetDeclaredTags(ctx context.Context, agentID string, tags []AgentTag) error
 	AddRegistration(ctx context.Context, registration *AgentRegistration) error
+	// FindHardwareSnapshot returns the hardware snapshot of the agent's
+	// latest registration that recorded one, or "" when none did.
+	FindHardwareSnapshot(ctx context.Context, agentID string) (string, error)
+	CreatePendingRegistration(ctx context.Context, pending *PendingRegistration) error
+	FindPendingRegistration(ctx context.Context, id string) (*PendingRegistration, error)
+	// FindPendingRegistrationByFingerprint returns the registration held
+	// for fingerprint that still awaits approval.
+	FindPendingRegistrationByFingerprint(ctx context.Context, fingerprint string) (*PendingRegistration, error)
+	// FindPendingRegistrations lists held registrations in the given
+	// status, or in any when status is empty, newest first.
+	FindPendingRegistrations(ctx context.Context, status string) ([]PendingRegistration, error)
+	// ResolvePendingRegistration records the approval of a registration
+	// still awaiting it, and returns ErrRegistrationResolved otherwise.
+	ResolvePendingRegistration(ctx context.Context, pending *PendingRegistration) error
+	// ConsumeEnrollmentToken counts a use of the enrollment token at now,
+	// failing as enrollment.Repository.Consume does, so that a registration
+	// counts it in the transaction that writes the agent.
+	ConsumeEnrollmentToken(ctx context.Context, tokenID string, now time.Time) error
+	// RecordHeartbeat marks the agent online and seen at seenAt, recording
+	// a status event when it was not online before.
+	RecordHeartbeat(ctx context.Context, agentID string, seenAt time.Time) error
+	// MarkStatus moves agents whose status is one of from and that were last
+	// seen before seenBefore to status to, and returns the recorded events.
+	MarkStatus(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]StatusEvent, error)
+	// FindStatusEvents lists an agent's status events, newest first.
+	FindStatusEvents(ctx context.Context, agentID string, limit int) ([]StatusEvent, error)
 	Transaction(ctx context.Context, fn func(Repository) error) error
 }
 
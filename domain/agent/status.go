@@ -0,0 +1,32 @@
+package agent
+
+import "time"
+
+// Liveness states of an agent. An agent is online while it keeps sending
+// heartbeats, stale once it has missed a few and offline after a longer
+// silence.
+const (
+	StatusOnline  = "online"
+	StatusStale   = "stale"
+	StatusOffline = "offline"
+
+	// StatusActive is the status agents were registered with before
+	// liveness tracking. The next heartbeat or sweep replaces it.
+	StatusActive = "active"
+)
+
+// StatusEvent records one liveness transition of an agent.
+type StatusEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	AgentID   string    `gorm:"index" json:"agent_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason"`
+	LastSeen  time.Time `json:"last_seen"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName names the agent status transition table.
+func (StatusEvent) TableName() string {
+	return "agent_status_events"
+}
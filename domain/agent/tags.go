@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Where an agent tag comes from. Operators set server tags, as enrollment
+// tokens do at registration; agents declare their own tags at registration
+// and on heartbeat. Neither replaces the other's tags: a server tag shadows
+// an agent tag with the same key.
+const (
+	TagSourceServer = "server"
+	TagSourceAgent  = "agent"
+)
+
+var (
+	// ErrTagNotFound is returned when an agent has no server tag with the
+	// key.
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrInvalidTag is returned for a tag that cannot be written as
+	// key=value.
+	ErrInvalidTag = errors.New("tag must be key=value")
+)
+
+// ValidateTag checks that the tag has a key and a value and can be written
+// as key=value, the form enrollment tokens and operator scopes use.
+func ValidateTag(key, value string) error {
+	if key == "" || value == "" || strings.ContainsAny(key, "=,") || strings.Contains(value, ",") {
+		return fmt.Errorf("%w: %q", ErrInvalidTag, key+"="+value)
+	}
+	return nil
+}
+
+// EffectiveTags returns the tags an agent carries: its server tags and the
+// agent tags whose key no server tag has.
+func EffectiveTags(tags []AgentTag) []AgentTag {
+	fromServer := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag.Source != TagSourceAgent {
+			fromServer[tag.Key] = true
+		}
+	}
+	effective := make([]AgentTag, 0, len(tags))
+	for _, tag := range tags {
+		if tag.Source == TagSourceAgent && fromServer[tag.Key] {
+			continue
+		}
+		effective = append(effective, tag)
+	}
+	return effective
+}
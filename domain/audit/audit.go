@@ -0,0 +1,171 @@
+// Package audit contains the domain for the append-only log of control
+// plane actions
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Outcomes of an audited request.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// Actor types. An anonymous actor presented no credentials, or ones that
+// were rejected.
+const (
+	ActorOperator  = "operator"
+	ActorAgent     = "agent"
+	ActorAnonymous = "anonymous"
+)
+
+// ErrChainBroken is returned when an entry does not follow the entry
+// before it or its contents no longer match its hash.
+var ErrChainBroken = errors.New("audit chain broken")
+
+// Entry records one control plane action. Entries form a hash chain: each
+// stores the hash of the entry before it, and Hash covers every other
+// field, so editing, removing or reordering entries is detectable. TokenID
+// is the operator token presented, or the registration token an agent
+// registered with.
+type Entry struct {
+	Sequence      int64     `json:"sequence" gorm:"primaryKey;autoIncrement:false"`
+	ID            string    `json:"id" gorm:"uniqueIndex"`
+	CreatedAt     time.Time `json:"created_at" gorm:"index"`
+	ActorType     string    `json:"actor_type"`
+	ActorID       string    `json:"actor_id,omitempty" gorm:"index"`
+	ActorName     string    `json:"actor_name,omitempty"`
+	TokenID       string    `json:"token_id,omitempty"`
+	Action        string    `json:"action" gorm:"index"`
+	Target        string    `json:"target,omitempty" gorm:"index"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	SourceIP      string    `json:"source_ip"`
+	RequestDigest string    `json:"request_digest"`
+	Outcome       string    `json:"outcome"`
+	StatusCode    int       `json:"status_code"`
+	Detail        string    `json:"detail,omitempty"`
+	PrevHash      string    `json:"prev_hash"`
+	Hash          string    `json:"hash"`
+}
+
+// TableName names the audit log table.
+func (Entry) TableName() string {
+	return "audit_entries"
+}
+
+// SetDetail stores v as the entry's JSON detail. Detail describes what was
+// done, such as the command of a created task, and never holds secrets.
+func (e *Entry) SetDetail(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	e.Detail = string(data)
+}
+
+// ComputeHash returns the hash of the entry's fields other than Hash.
+func (e Entry) ComputeHash() string {
+	data, _ := json.Marshal(struct {
+		Sequence      int64  `json:"sequence"`
+		ID            string `json:"id"`
+		CreatedAt     string `json:"created_at"`
+		ActorType     string `json:"actor_type"`
+		ActorID       string `json:"actor_id"`
+		ActorName     string `json:"actor_name"`
+		TokenID       string `json:"token_id"`
+		Action        string `json:"action"`
+		Target        string `json:"target"`
+		Method        string `json:"method"`
+		Path          string `json:"path"`
+		SourceIP      string `json:"source_ip"`
+		RequestDigest string `json:"request_digest"`
+		Outcome       string `json:"outcome"`
+		StatusCode    int    `json:"status_code"`
+		Detail        string `json:"detail"`
+		PrevHash      string `json:"prev_hash"`
+	}{
+		Sequence:      e.Sequence,
+		ID:            e.ID,
+		CreatedAt:     e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ActorType:     e.ActorType,
+		ActorID:       e.ActorID,
+		ActorName:     e.ActorName,
+		TokenID:       e.TokenID,
+		Action:        e.Action,
+		Target:        e.Target,
+		Method:        e.Method,
+		Path:          e.Path,
+		SourceIP:      e.SourceIP,
+		RequestDigest: e.RequestDigest,
+		Outcome:       e.Outcome,
+		StatusCode:    e.StatusCode,
+		Detail:        e.Detail,
+		PrevHash:      e.PrevHash,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// OutcomeOf classifies a response status.
+func OutcomeOf(status int) string {
+	switch {
+	case status == 401 || status == 403:
+		return OutcomeDenied
+	case status >= 400:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// DigestRequest returns the SHA-256 of a request's method, URI and body,
+// which identifies the request without storing its body.
+func DigestRequest(method, uri string, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", method, uri)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks that entries continue the chain whose last entry had
+// sequence prevSequence and hash prevHash, and that every entry matches its
+// hash. It returns the hash of the last entry, or the sequence of the first
+// entry that breaks the chain with ErrChainBroken.
+func Verify(prevSequence int64, prevHash string, entries []Entry) (string, int64, error) {
+	for _, e := range entries {
+		if e.Sequence != prevSequence+1 {
+			return "", e.Sequence, fmt.Errorf("%w: entry %d follows entry %d", ErrChainBroken, e.Sequence, prevSequence)
+		}
+		if e.PrevHash != prevHash {
+			return "", e.Sequence, fmt.Errorf("%w: entry %d does not link to the entry before it", ErrChainBroken, e.Sequence)
+		}
+		if e.ComputeHash() != e.Hash {
+			return "", e.Sequence, fmt.Errorf("%w: entry %d does not match its hash", ErrChainBroken, e.Sequence)
+		}
+		prevSequence, prevHash = e.Sequence, e.Hash
+	}
+	return prevHash, 0, nil
+}
+
+// Filters narrows a query. Entries are returned newest first unless
+// Ascending is set; AfterSequence and BeforeSequence page through them.
+type Filters struct {
+	ActorID        string
+	Action         string
+	Target         string
+	Outcome        string
+	Since          *time.Time
+	Until          *time.Time
+	AfterSequence  int64
+	BeforeSequence int64
+	Ascending      bool
+	Limit          int
+}
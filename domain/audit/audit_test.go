@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// chain builds n linked entries the way the repository appends them.
+func chain(n int) []Entry {
+	entries := make([]Entry, n)
+	prev := ""
+	for i := range entries {
+		entries[i] = Entry{
+			Sequence:  int64(i + 1),
+			ID:        "aud_" + string(rune('a'+i)),
+			CreatedAt: time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC),
+			Action:    "task.create",
+			Outcome:   OutcomeSuccess,
+			PrevHash:  prev,
+		}
+		entries[i].Hash = entries[i].ComputeHash()
+		prev = entries[i].Hash
+	}
+	return entries
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("accepts an intact chain and returns its head", func(t *testing.T) {
+		entries := chain(3)
+
+		head, _, err := Verify(0, "", entries)
+
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if head != entries[2].Hash {
+			t.Errorf("head = %q, want %q", head, entries[2].Hash)
+		}
+	})
+
+	t.Run("continues from an earlier page", func(t *testing.T) {
+		entries := chain(3)
+
+		if _, _, err := Verify(1, entries[0].Hash, entries[1:]); err != nil {
+			t.Errorf("Verify: %v", err)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		tamper func([]Entry) []Entry
+		at     int64
+	}{
+		{"edited entry", func(e []Entry) []Entry { e[1].Target = "tsk_other"; return e }, 2},
+		{"removed entry", func(e []Entry) []Entry { return append(e[:1], e[2:]...) }, 3},
+		{"rehashed entry", func(e []Entry) []Entry {
+			e[1].Outcome = OutcomeDenied
+			e[1].Hash = e[1].ComputeHash()
+			return e
+		}, 3},
+	}
+	for _, tt := range tests {
+		t.Run("detects "+tt.name, func(t *testing.T) {
+			_, at, err := Verify(0, "", tt.tamper(chain(3)))
+
+			if !errors.Is(err, ErrChainBroken) {
+				t.Fatalf("err = %v, want ErrChainBroken", err)
+			}
+			if at != tt.at {
+				t.Errorf("broken at %d, want %d", at, tt.at)
+			}
+		})
+	}
+}
+
+func TestOutcomeOf(t *testing.T) {
+	tests := map[int]string{
+		200: OutcomeSuccess,
+		204: OutcomeSuccess,
+		400: OutcomeFailure,
+		401: OutcomeDenied,
+		403: OutcomeDenied,
+		500: OutcomeFailure,
+	}
+	for status, want := range tests {
+		if got := OutcomeOf(status); got != want {
+			t.Errorf("OutcomeOf(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package audit
+
+import "context"
+
+type Repository interface {
+	// Append chains entry onto the log: it assigns the next sequence, links
+	// the previous entry's hash and computes the entry's own.
+	Append(ctx context.Context, entry *Entry) error
+	Find(ctx context.Context, filters Filters) ([]Entry, error)
+}
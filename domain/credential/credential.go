@@ -1,7 +1,15 @@
 // Package credential contains the domain for the credentail
 package credential
 
-import "time"
+import (
+	"errors"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// ErrCredentialNotFound is returned when no credential has the given ID.
+var ErrCredentialNotFound = errors.New("credential not found")
 
 type Credential struct {
 	ID            string     `json:"id"`
@@ -11,14 +19,26 @@ type Credential struct {
 	Username      string     `json:"username"`
 	Database      string     `json:"database"`
 	PasswdEnc     string     `json:"passwd_enc"`
-	Password      *string    `json:"password"`
+	Password      *string    `json:"password" gorm:"-"`
 	DataDirectory string     `json:"data_directory"`
-	AgentID       string     `json:"agent_id"`
+	AgentID       string     `json:"agent_id" gorm:"index"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
 	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
 }
 
+// NewID returns an ID for a new credential. The password is sealed for the
+// credential's ID, so it is assigned before the credential is stored.
+func NewID() string {
+	return "crd_" + ulid.Make().String()
+}
+
+// EnvelopeContext is the associated data a credential's password is sealed
+// with, so the password only opens for that credential of that agent.
+func EnvelopeContext(agentID, credentialID string) []string {
+	return []string{"credential", agentID, credentialID}
+}
+
 type CredentialFilters struct {
 	AgentID *string
 }
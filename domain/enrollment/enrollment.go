@@ -0,0 +1,124 @@
+// Package enrollment contains the domain for the tokens agents register
+// with
+package enrollment
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hostlink/domain/agent"
+	"strings"
+	"time"
+)
+
+// KeyPrefix starts every enrollment token key, which makes a leaked key
+// easy to recognise.
+const KeyPrefix = "hle_"
+
+var (
+	// ErrTokenNotFound is returned when no enrollment token has the given
+	// ID.
+	ErrTokenNotFound = errors.New("enrollment token not found")
+	// ErrInvalidKey is returned when a key does not match its token.
+	ErrInvalidKey = errors.New("invalid enrollment token key")
+	// ErrTokenRevoked is returned for a revoked token.
+	ErrTokenRevoked = errors.New("enrollment token revoked")
+	// ErrTokenExpired is returned for a token past its expiry.
+	ErrTokenExpired = errors.New("enrollment token expired")
+	// ErrTokenExhausted is returned for a token that has been used its
+	// maximum number of times.
+	ErrTokenExhausted = errors.New("enrollment token used up")
+	// ErrInvalidTag is returned for a tag that is not key=value.
+	ErrInvalidTag = errors.New("invalid tag")
+)
+
+// Token lets agents register. Agents present its ID and key; only the
+// key's SHA-256 hash is stored, and Prefix keeps enough of it to tell keys
+// apart. Agents registering with the token get its Tags, which override
+// tags they declare with the same key. A zero MaxUses is unlimited.
+type Token struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	KeyHash    string     `json:"-"`
+	Prefix     string     `json:"prefix"`
+	TagList    string     `json:"-" gorm:"column:tags"`
+	Tags       []string   `json:"tags" gorm:"-"`
+	MaxUses    int        `json:"max_uses"`
+	Uses       int        `json:"uses"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName names the enrollment token table.
+func (Token) TableName() string {
+	return "enrollment_tokens"
+}
+
+// Usable returns why the token may not be used at now, or nil.
+func (t Token) Usable(now time.Time) error {
+	switch {
+	case t.RevokedAt != nil:
+		return ErrTokenRevoked
+	case t.ExpiresAt != nil && !now.Before(*t.ExpiresAt):
+		return ErrTokenExpired
+	case t.MaxUses > 0 && t.Uses >= t.MaxUses:
+		return ErrTokenExhausted
+	}
+	return nil
+}
+
+// AgentTags returns the token's tags as agent tags.
+func (t Token) AgentTags() []agent.AgentTag {
+	tags := make([]agent.AgentTag, 0, len(t.Tags))
+	for _, tag := range t.Tags {
+		key, value, _ := strings.Cut(tag, "=")
+		tags = append(tags, agent.AgentTag{Key: key, Value: value})
+	}
+	return tags
+}
+
+// ValidateTags checks that every tag is key=value.
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" || value == "" || strings.Contains(tag, ",") {
+			return fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+	}
+	return nil
+}
+
+// JoinTags encodes tags for storage.
+func JoinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+// SplitTags decodes stored tags.
+func SplitTags(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	return strings.Split(list, ",")
+}
+
+// GenerateKey returns a new random token key.
+func GenerateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashKey returns the hash a key is stored as.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,19 @@
+package enrollment
+
+import (
+	"context"
+	"time"
+)
+
+type Repository interface {
+	Create(ctx context.Context, token *Token) error
+	FindByID(ctx context.Context, id string) (*Token, error)
+	// FindAll lists tokens, newest first.
+	FindAll(ctx context.Context) ([]Token, error)
+	// Revoke revokes a token; revoking a revoked token keeps its first
+	// revocation time.
+	Revoke(ctx context.Context, id string, at time.Time) error
+	// Consume counts a use of the token at now, unless it is revoked,
+	// expired or used up by then, which it reports with the matching error.
+	Consume(ctx context.Context, id string, now time.Time) error
+}
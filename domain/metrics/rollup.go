@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+)
+
+// Resolution is a rollup granularity. Each resolution is stored in its own
+// table with its own retention.
+type Resolution struct {
+	Name string
+	Step time.Duration
+}
+
+var (
+	Resolution1m = Resolution{Name: "1m", Step: time.Minute}
+	Resolution5m = Resolution{Name: "5m", Step: 5 * time.Minute}
+	Resolution1h = Resolution{Name: "1h", Step: time.Hour}
+
+	// Resolutions lists the rollup resolutions from finest to coarsest.
+	Resolutions = []Resolution{Resolution1m, Resolution5m, Resolution1h}
+)
+
+// Table names the rollup table of the resolution.
+func (r Resolution) Table() string {
+	return "metric_rollups_" + r.Name
+}
+
+// Rollup aggregates one numeric field of a series over the bucket starting
+// at BucketStart. Booleans such as "up" are rolled up as 0 or 1.
+type Rollup struct {
+	ID          uint `gorm:"primaryKey"`
+	AgentID     string
+	Type        string
+	SeriesKey   string
+	Field       string
+	BucketStart time.Time
+	Count       int64
+	Sum         float64
+	Min         float64
+	Max         float64
+	P95         float64
+}
+
+// RollupFilters narrows a rollup query to one agent's metric type over
+// [From, To).
+type RollupFilters struct {
+	AgentID string
+	Type    string
+	From    time.Time
+	To      time.Time
+}
+
+type rollupKey struct {
+	agentID     string
+	metricType  string
+	seriesKey   string
+	field       string
+	bucketStart time.Time
+}
+
+// Aggregate rolls samples up into buckets of the given step. Only the
+// top-level numeric and boolean fields of a sample's metrics are rolled up.
+func Aggregate(samples []Sample, step time.Duration) []Rollup {
+	values := map[rollupKey][]float64{}
+	for _, sample := range samples {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(sample.Metrics), &fields); err != nil {
+			continue
+		}
+		bucketStart := sample.Timestamp.UTC().Truncate(step)
+		for field, raw := range fields {
+			value, ok := numericValue(raw)
+			if !ok {
+				continue
+			}
+			key := rollupKey{sample.AgentID, sample.Type, sample.SeriesKey, field, bucketStart}
+			values[key] = append(values[key], value)
+		}
+	}
+
+	rollups := make([]Rollup, 0, len(values))
+	for key, bucket := range values {
+		sort.Float64s(bucket)
+		rollup := Rollup{
+			AgentID:     key.agentID,
+			Type:        key.metricType,
+			SeriesKey:   key.seriesKey,
+			Field:       key.field,
+			BucketStart: key.bucketStart,
+			Count:       int64(len(bucket)),
+			Min:         bucket[0],
+			Max:         bucket[len(bucket)-1],
+			P95:         Percentile(bucket, 95),
+		}
+		for _, value := range bucket {
+			rollup.Sum += value
+		}
+		rollups = append(rollups, rollup)
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		a, b := rollups[i], rollups[j]
+		if !a.BucketStart.Equal(b.BucketStart) {
+			return a.BucketStart.Before(b.BucketStart)
+		}
+		if a.SeriesKey != b.SeriesKey {
+			return a.SeriesKey < b.SeriesKey
+		}
+		return a.Field < b.Field
+	})
+	return rollups
+}
+
+// Percentile returns the nearest-rank percentile p of sorted values.
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func numericValue(raw any) (float64, bool) {
+	switch v := raw.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSamplesFromPayload(t *testing.T) {
+	payload := MetricPayload{
+		TimestampMs: 1700000000000,
+		Resource:    Resource{AgentID: "agt_1"},
+		MetricSets: []MetricSet{
+			{Type: MetricTypeStorage, Attributes: map[string]any{"mount_point": "/", "device": "sda1"}, Metrics: StorageMetrics{}},
+		},
+	}
+
+	samples, err := SamplesFromPayload("agt_1", payload)
+	if err != nil {
+		t.Fatalf("SamplesFromPayload: %v", err)
+	}
+	if len(samples) != 1 || samples[0].SeriesKey != `{"device":"sda1","mount_point":"/"}` {
+		t.Errorf("Expected a sample keyed by sorted attributes, got %+v", samples)
+	}
+
+	if _, err := SamplesFromPayload("agt_2", payload); !errors.Is(err, ErrAgentMismatch) {
+		t.Errorf("Expected ErrAgentMismatch, got %v", err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var samples []Sample
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, Sample{
+			AgentID:   "agt_1",
+			Type:      MetricTypeSystem,
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			Metrics:   fmt.Sprintf(`{"cpu_percent":%d,"up":true,"role":"primary"}`, i),
+		})
+	}
+	samples = append(samples, Sample{AgentID: "agt_1", Type: MetricTypeSystem, Timestamp: base.Add(time.Minute), Metrics: `{"cpu_percent":50}`})
+
+	rollups := Aggregate(samples, time.Minute)
+
+	if len(rollups) != 3 {
+		t.Fatalf("Expected cpu_percent and up in the first minute and cpu_percent in the second, got %+v", rollups)
+	}
+	cpu := rollups[0]
+	if cpu.Field != "cpu_percent" || !cpu.BucketStart.Equal(base) {
+		t.Fatalf("Expected first rollup to be cpu_percent at %v, got %+v", base, cpu)
+	}
+	if cpu.Count != 20 || cpu.Sum != 210 || cpu.Min != 1 || cpu.Max != 20 || cpu.P95 != 19 {
+		t.Errorf("Unexpected cpu_percent aggregates: %+v", cpu)
+	}
+	if up := rollups[1]; up.Field != "up" || up.Max != 1 || up.Min != 1 {
+		t.Errorf("Expected booleans to roll up as 1, got %+v", up)
+	}
+	if next := rollups[2]; !next.BucketStart.Equal(base.Add(time.Minute)) || next.Count != 1 {
+		t.Errorf("Expected a second bucket with one value, got %+v", next)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	cases := []struct {
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 95, 0},
+		{[]float64{7}, 95, 7},
+		{[]float64{1, 2, 3, 4}, 50, 2},
+		{[]float64{1, 2, 3, 4}, 95, 4},
+	}
+	for _, c := range cases {
+		if got := Percentile(c.values, c.p); got != c.want {
+			t.Errorf("Percentile(%v, %v) = %v, want %v", c.values, c.p, got, c.want)
+		}
+	}
+}
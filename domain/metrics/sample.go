@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrAgentMismatch is returned when a payload names a different agent
+	// than the one that pushed it.
+	ErrAgentMismatch = errors.New("metric payload agent does not match")
+	// ErrInvalidPayload is returned for a payload that cannot be stored.
+	ErrInvalidPayload = errors.New("invalid metric payload")
+)
+
+// Sample is one stored metric set. A series is identified by AgentID, Type
+// and SeriesKey, the canonical JSON of the set's attributes, so every mount
+// point, container or router gets its own series. Metrics holds the set's
+// values as JSON.
+type Sample struct {
+	ID        uint      `gorm:"primaryKey"`
+	AgentID   string    `gorm:"index:idx_metric_samples_series,priority:1"`
+	Type      string    `gorm:"index:idx_metric_samples_series,priority:2"`
+	SeriesKey string    `gorm:"index:idx_metric_samples_series,priority:3"`
+	Timestamp time.Time `gorm:"index:idx_metric_samples_series,priority:4"`
+	HostName  string
+	Metrics   string
+	CreatedAt time.Time
+}
+
+// TableName names the metric time-series table.
+func (Sample) TableName() string {
+	return "metric_samples"
+}
+
+// SampleFilters narrows a sample query. Attributes matches a series exactly.
+type SampleFilters struct {
+	AgentID    string
+	Type       *string
+	Attributes map[string]any
+	Since      *time.Time
+	Until      *time.Time
+}
+
+type Repository interface {
+	Append(ctx context.Context, samples []Sample) error
+	FindSamples(ctx context.Context, filters SampleFilters) ([]Sample, error)
+	// FindSampleAgents lists the agents with samples in [from, to).
+	FindSampleAgents(ctx context.Context, from, to time.Time) ([]string, error)
+	// EarliestSample returns the timestamp of the agent's oldest sample.
+	EarliestSample(ctx context.Context, agentID string) (time.Time, bool, error)
+	// LatestSample returns the timestamp of the agent's newest sample.
+	LatestSample(ctx context.Context, agentID string) (time.Time, bool, error)
+	DeleteSamplesBefore(ctx context.Context, before time.Time) (int64, error)
+
+	UpsertRollups(ctx context.Context, resolution Resolution, rollups []Rollup) error
+	FindRollups(ctx context.Context, resolution Resolution, filters RollupFilters) ([]Rollup, error)
+	// LatestRollup returns the start of the agent's newest bucket of a
+	// resolution.
+	LatestRollup(ctx context.Context, resolution Resolution, agentID string) (time.Time, bool, error)
+	DeleteRollupsBefore(ctx context.Context, resolution Resolution, before time.Time) (int64, error)
+}
+
+// SamplesFromPayload flattens a payload pushed by agentID into samples. A
+// payload without a resource agent is attributed to agentID.
+func SamplesFromPayload(agentID string, payload MetricPayload) ([]Sample, error) {
+	if payload.Resource.AgentID != "" && payload.Resource.AgentID != agentID {
+		return nil, ErrAgentMismatch
+	}
+	timestamp := time.Now().UTC()
+	if payload.TimestampMs > 0 {
+		timestamp = time.UnixMilli(payload.TimestampMs).UTC()
+	}
+
+	samples := make([]Sample, 0, len(payload.MetricSets))
+	for _, set := range payload.MetricSets {
+		if set.Type == "" {
+			return nil, fmt.Errorf("%w: metric set without type", ErrInvalidPayload)
+		}
+		seriesKey, err := SeriesKey(set.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		values, err := json.Marshal(set.Metrics)
+		if err != nil {
+			return nil, fmt.Errorf("%w: encode %s metrics: %v", ErrInvalidPayload, set.Type, err)
+		}
+		samples = append(samples, Sample{
+			AgentID:   agentID,
+			Type:      set.Type,
+			SeriesKey: seriesKey,
+			Timestamp: timestamp,
+			HostName:  payload.Resource.HostName,
+			Metrics:   string(values),
+		})
+	}
+	return samples, nil
+}
+
+// SeriesKey returns the canonical encoding of a metric set's attributes.
+// Map keys are sorted, so equal attributes always give the same key.
+func SeriesKey(attributes map[string]any) (string, error) {
+	if len(attributes) == 0 {
+		return "", nil
+	}
+	key, err := json.Marshal(attributes)
+	if err != nil {
+		return "", fmt.Errorf("%w: encode attributes: %v", ErrInvalidPayload, err)
+	}
+	return string(key), nil
+}
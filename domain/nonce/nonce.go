@@ -7,7 +7,10 @@ import (
 	"time"
 )
 
+// Nonce is a request nonce an agent has used. CreatedAt is the timestamp
+// the request was signed with.
 type Nonce struct {
+	AgentID   string    `gorm:"primaryKey;size:64"`
 	Value     string    `gorm:"primaryKey;size:100"`
 	CreatedAt time.Time `gorm:"not null"`
 }
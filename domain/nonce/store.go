@@ -0,0 +1,16 @@
+package nonce
+
+import (
+	"context"
+	"time"
+)
+
+// Store remembers the nonces agents have used, so a signed request cannot
+// be replayed while its timestamp is still accepted.
+type Store interface {
+	// Remember records that agentID used value in a request signed at
+	// signedAt. It returns false when the agent already used value.
+	Remember(ctx context.Context, agentID, value string, signedAt time.Time) (bool, error)
+	// DeleteExpired forgets nonces signed more than olderThan ago.
+	DeleteExpired(ctx context.Context, olderThan time.Duration) (int64, error)
+}
@@ -0,0 +1,176 @@
+// Package operator contains the domain for the people and tools that use
+// the task API, their roles and their API tokens
+package operator
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hostlink/domain/agent"
+	"strings"
+	"time"
+)
+
+// Roles, from least to most privileged. A viewer reads tasks, an operator
+// also runs them, and an admin also manages webhooks, credentials and
+// operators.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Roles lists every role from least to most privileged.
+var Roles = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// TokenPrefix starts every operator API token, which makes a leaked token
+// easy to recognise.
+const TokenPrefix = "hlo_"
+
+var (
+	// ErrOperatorNotFound is returned when no operator has the given ID or
+	// name.
+	ErrOperatorNotFound = errors.New("operator not found")
+	// ErrOperatorExists is returned when an operator name is taken.
+	ErrOperatorExists = errors.New("operator already exists")
+	// ErrTokenNotFound is returned when no token has the given ID or hash.
+	ErrTokenNotFound = errors.New("operator token not found")
+	// ErrUnknownRole is returned for a role that is not in Roles.
+	ErrUnknownRole = errors.New("unknown operator role")
+	// ErrInvalidScope is returned for a scope tag that is not key=value.
+	ErrInvalidScope = errors.New("invalid scope tag")
+)
+
+// Operator is an identity that uses the task API. A scoped operator may
+// only see and target agents that carry every tag in Scope.
+type Operator struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name" gorm:"uniqueIndex"`
+	Role        string    `json:"role"`
+	ScopeFilter string    `json:"-" gorm:"column:scope"`
+	Scope       []string  `json:"scope" gorm:"-"`
+	Disabled    bool      `json:"disabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName names the operator table.
+func (Operator) TableName() string {
+	return "operators"
+}
+
+// Can reports whether the operator holds at least role.
+func (o Operator) Can(role string) bool {
+	return !o.Disabled && rank(o.Role) >= rank(role) && rank(role) > 0
+}
+
+// Scoped reports whether the operator is limited to tagged agents.
+func (o Operator) Scoped() bool {
+	return len(o.Scope) > 0
+}
+
+// InScope reports whether an agent with tags is within the operator's
+// scope, which it is when it carries every scope tag as a server tag. Tags
+// the agent declares itself never bring it into a scope.
+func (o Operator) InScope(tags []agent.AgentTag) bool {
+	for _, tag := range o.Scope {
+		key, value, _ := strings.Cut(tag, "=")
+		found := false
+		for _, t := range tags {
+			if t.Source != "" && t.Source != agent.TagSourceServer {
+				continue
+			}
+			if t.Key == key && t.Value == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Token is an API token of an operator. Only its SHA-256 hash is stored;
+// Prefix keeps enough of the token to tell tokens apart in listings.
+type Token struct {
+	ID         string     `json:"id"`
+	OperatorID string     `json:"operator_id" gorm:"index"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"-" gorm:"uniqueIndex"`
+	Prefix     string     `json:"prefix"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName names the operator token table.
+func (Token) TableName() string {
+	return "operator_tokens"
+}
+
+// Active reports whether the token may be used at now.
+func (t Token) Active(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role string) bool {
+	return rank(role) > 0
+}
+
+func rank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ValidateScope checks that every scope tag is key=value.
+func ValidateScope(scope []string) error {
+	for _, tag := range scope {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" || value == "" || strings.Contains(tag, ",") {
+			return fmt.Errorf("%w: %q", ErrInvalidScope, tag)
+		}
+	}
+	return nil
+}
+
+// JoinScope encodes a scope for storage.
+func JoinScope(scope []string) string {
+	return strings.Join(scope, ",")
+}
+
+// SplitScope decodes a stored scope.
+func SplitScope(filter string) []string {
+	if filter == "" {
+		return []string{}
+	}
+	return strings.Split(filter, ",")
+}
+
+// GenerateToken returns a new random API token.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hash a token is stored and looked up by.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
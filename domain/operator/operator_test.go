@@ -0,0 +1,68 @@
+package operator
+
+import (
+	"errors"
+	"testing"
+
+	"hostlink/domain/agent"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleOperator, RoleViewer, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleAdmin, RoleOperator, true},
+		{"root", RoleViewer, false},
+		{RoleAdmin, "root", false},
+	}
+	for _, tt := range tests {
+		if got := (Operator{Role: tt.role}).Can(tt.required); got != tt.want {
+			t.Errorf("Expected %s can %s = %v, got %v", tt.role, tt.required, tt.want, got)
+		}
+	}
+
+	if (Operator{Role: RoleAdmin, Disabled: true}).Can(RoleViewer) {
+		t.Error("Expected a disabled operator to hold no role")
+	}
+}
+
+func TestInScope(t *testing.T) {
+	tags := []agent.AgentTag{{Key: "env", Value: "staging"}, {Key: "team", Value: "web"}}
+
+	if !(Operator{}).InScope(nil) {
+		t.Error("Expected an unscoped operator to reach every agent")
+	}
+	if !(Operator{Scope: []string{"env=staging"}}).InScope(tags) {
+		t.Error("Expected env=staging to match")
+	}
+	if (Operator{Scope: []string{"env=staging", "team=db"}}).InScope(tags) {
+		t.Error("Expected every scope tag to be required")
+	}
+	if (Operator{Scope: []string{"env=production"}}).InScope(tags) {
+		t.Error("Expected env=production not to match")
+	}
+	declared := append(tags, agent.AgentTag{Key: "team", Value: "db", Source: agent.TagSourceAgent})
+	if (Operator{Scope: []string{"team=db"}}).InScope(declared) {
+		t.Error("Expected a tag the agent declared not to match")
+	}
+	if !(Operator{Scope: []string{"role=db"}}).InScope(append(declared, agent.AgentTag{Key: "role", Value: "db", Source: agent.TagSourceServer})) {
+		t.Error("Expected a server tag to match")
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	if err := ValidateScope([]string{"env=staging", "region=eu-west-1"}); err != nil {
+		t.Errorf("Expected valid scope, got: %v", err)
+	}
+	for _, tag := range []string{"staging", "=staging", "env=", "env=a,b"} {
+		if err := ValidateScope([]string{tag}); !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("Expected %q to be rejected, got: %v", tag, err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package operator
+
+import (
+	"context"
+	"time"
+)
+
+type Repository interface {
+	CreateOperator(ctx context.Context, operator *Operator) error
+	UpdateOperator(ctx context.Context, operator *Operator) error
+	FindOperator(ctx context.Context, id string) (*Operator, error)
+	FindOperatorByName(ctx context.Context, name string) (*Operator, error)
+	FindOperators(ctx context.Context) ([]Operator, error)
+
+	CreateToken(ctx context.Context, token *Token) error
+	FindTokenByHash(ctx context.Context, hash string) (*Token, error)
+	// FindTokens lists an operator's tokens, newest first.
+	FindTokens(ctx context.Context, operatorID string) ([]Token, error)
+	// RevokeToken revokes one of an operator's tokens at at. Revoking a
+	// revoked token keeps its first revocation time.
+	RevokeToken(ctx context.Context, operatorID, id string, at time.Time) error
+	TouchToken(ctx context.Context, id string, at time.Time) error
+}
@@ -0,0 +1,15 @@
+package secret
+
+import "context"
+
+type Repository interface {
+	// Save creates s, or updates it when it is already stored. The agent
+	// has one secret per name, so a new secret may not reuse a name.
+	Save(ctx context.Context, s *Secret) error
+	FindAll(ctx context.Context, agentID string) ([]Secret, error)
+	FindByName(ctx context.Context, agentID, name string) (*Secret, error)
+	// FindByNames returns the agent's secrets among names; names the agent
+	// has no secret for are left out.
+	FindByNames(ctx context.Context, agentID string, names []string) ([]Secret, error)
+	Delete(ctx context.Context, agentID, name string) error
+}
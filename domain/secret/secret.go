@@ -0,0 +1,111 @@
+// Package secret contains the domain for the named secrets tasks use.
+// Values are sealed for the agent they belong to and only ever opened in
+// the agent's memory, where they are injected into a task's environment.
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	// ErrSecretNotFound is returned when an agent has no secret with the
+	// given name.
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrInvalidName is returned for a secret name that cannot be an
+	// environment variable.
+	ErrInvalidName = errors.New("invalid secret name")
+)
+
+// maxNameLength bounds secret names.
+const maxNameLength = 64
+
+var (
+	namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// placeholderPattern matches {{secret:name}} in a task command.
+	placeholderPattern = regexp.MustCompile(`\{\{secret:([^{}]*)\}\}`)
+)
+
+// Secret is a named value of one agent, sealed in an envelope for the
+// agent's key and bound to the secret's ID and name.
+type Secret struct {
+	ID        string    `json:"id"`
+	AgentID   string    `json:"agent_id" gorm:"uniqueIndex:idx_secrets_agent_name,priority:1"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_secrets_agent_name,priority:2"`
+	ValueEnc  string    `json:"value_enc"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewID returns an ID for a new secret. The value is sealed for the
+// secret's ID, so it is assigned before the secret is stored.
+func NewID() string {
+	return "sec_" + ulid.Make().String()
+}
+
+// EnvelopeContext is the associated data a secret's value is sealed with,
+// so the value only opens as that secret of that agent.
+func EnvelopeContext(agentID, secretID, name string) []string {
+	return []string{"secret", agentID, secretID, name}
+}
+
+// ValidateName returns ErrInvalidName unless name is a letter or
+// underscore followed by letters, digits and underscores.
+func ValidateName(name string) error {
+	if len(name) > maxNameLength || !namePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// EnvName is the environment variable a secret is injected as: its name in
+// upper case, so db_password becomes DB_PASSWORD.
+func EnvName(name string) string {
+	return strings.ToUpper(name)
+}
+
+// References returns the sorted, distinct names of the secrets a task
+// uses: those referenced as {{secret:name}} in its command and those listed
+// in envSecrets.
+func References(command string, envSecrets []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) error {
+		if err := ValidateName(name); err != nil {
+			return err
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return nil
+	}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(command, -1) {
+		if err := add(match[1]); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range envSecrets {
+		if err := add(name); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ExpandPlaceholders replaces every {{secret:name}} in command with a
+// reference to the secret's environment variable, so the script the agent
+// writes to disk never holds the value.
+func ExpandPlaceholders(command string) string {
+	return placeholderPattern.ReplaceAllStringFunc(command, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		return "${" + EnvName(name) + "}"
+	})
+}
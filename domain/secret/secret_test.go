@@ -0,0 +1,48 @@
+package secret
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	names, err := References(`psql "postgres://app:{{secret:db_password}}@db/app" && curl -H "{{secret:api_token}}" {{secret:db_password}}`, []string{"pgpassword", "api_token"})
+	if err != nil {
+		t.Fatalf("References: %v", err)
+	}
+	want := []string{"api_token", "db_password", "pgpassword"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("References = %v, want %v", names, want)
+	}
+
+	names, err = References("echo hello", nil)
+	if err != nil || len(names) != 0 {
+		t.Errorf("References = %v, %v, want none", names, err)
+	}
+}
+
+func TestReferencesRejectsInvalidNames(t *testing.T) {
+	for _, tc := range []struct {
+		command    string
+		envSecrets []string
+	}{
+		{command: "echo {{secret:db-password}}"},
+		{command: "echo {{secret:}}"},
+		{command: "echo {{secret: spaced }}"},
+		{command: "echo", envSecrets: []string{"1password"}},
+		{command: "echo", envSecrets: []string{"a=b"}},
+	} {
+		if _, err := References(tc.command, tc.envSecrets); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("References(%q, %v): expected ErrInvalidName, got %v", tc.command, tc.envSecrets, err)
+		}
+	}
+}
+
+func TestExpandPlaceholders(t *testing.T) {
+	got := ExpandPlaceholders(`PGPASSWORD="{{secret:db_password}}" psql -c "select 1" # {{secret:db_password}}`)
+	want := `PGPASSWORD="${DB_PASSWORD}" psql -c "select 1" # ${DB_PASSWORD}`
+	if got != want {
+		t.Errorf("ExpandPlaceholders = %q, want %q", got, want)
+	}
+}
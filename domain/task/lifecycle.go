@@ -0,0 +1,66 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Task and execution statuses. A claim holds a lease; when it lapses a
+// claimed task is requeued, while a running one is timed out rather than
+// requeued, since it may already have run.
+const (
+	StatusPending   = "pending"
+	StatusClaimed   = "claimed"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusTimedOut  = "timed_out"
+)
+
+var (
+	// ErrInvalidTransition is returned for a status change the lifecycle
+	// does not allow.
+	ErrInvalidTransition = errors.New("invalid task status transition")
+	// ErrLeaseNotHeld is returned when a report comes from an agent or
+	// execution attempt that no longer holds the task's lease.
+	ErrLeaseNotHeld = errors.New("task lease not held")
+)
+
+var transitions = map[string][]string{
+	StatusPending: {StatusClaimed, StatusCancelled},
+	StatusClaimed: {StatusPending, StatusRunning, StatusCompleted, StatusFailed, StatusCancelled, StatusTimedOut},
+	StatusRunning: {StatusCompleted, StatusFailed, StatusCancelled, StatusTimedOut},
+}
+
+// ValidStatus reports whether status is part of the lifecycle.
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusClaimed, StatusRunning, StatusCompleted, StatusFailed, StatusCancelled, StatusTimedOut:
+		return true
+	}
+	return false
+}
+
+// IsTerminal reports whether no further transition leaves status.
+func IsTerminal(status string) bool {
+	return ValidStatus(status) && len(transitions[status]) == 0
+}
+
+// ValidateTransition returns ErrInvalidTransition unless from may move to
+// to. Repeating the current status is allowed so retried reports and lease
+// renewals are idempotent.
+func ValidateTransition(from, to string) error {
+	if !ValidStatus(to) {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidTransition, to)
+	}
+	if from == to {
+		return nil
+	}
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+}
@@ -0,0 +1,61 @@
+package task
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateTransition(t *testing.T) {
+	allowed := [][2]string{
+		{StatusPending, StatusClaimed},
+		{StatusClaimed, StatusPending},
+		{StatusClaimed, StatusRunning},
+		{StatusClaimed, StatusCompleted},
+		{StatusRunning, StatusRunning},
+		{StatusRunning, StatusTimedOut},
+		{StatusCompleted, StatusCompleted},
+	}
+	for _, pair := range allowed {
+		if err := ValidateTransition(pair[0], pair[1]); err != nil {
+			t.Errorf("Expected %s -> %s to be allowed, got: %v", pair[0], pair[1], err)
+		}
+	}
+
+	rejected := [][2]string{
+		{StatusPending, StatusRunning},
+		{StatusPending, StatusCompleted},
+		{StatusRunning, StatusPending},
+		{StatusCompleted, StatusFailed},
+		{StatusTimedOut, StatusRunning},
+		{StatusPending, "done"},
+	}
+	for _, pair := range rejected {
+		if err := ValidateTransition(pair[0], pair[1]); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Expected %s -> %s to be rejected, got: %v", pair[0], pair[1], err)
+		}
+	}
+}
+
+func TestSummarizeRollsUpParentStatus(t *testing.T) {
+	summary := Summarize([]Execution{
+		{Status: StatusCompleted},
+		{Status: StatusRunning},
+		{Status: StatusPending},
+	})
+	if summary.Running != 1 || summary.Pending != 1 || summary.Succeeded != 1 {
+		t.Fatalf("Unexpected summary: %+v", summary)
+	}
+	if summary.Status() != StatusRunning {
+		t.Errorf("Expected running, got: %s", summary.Status())
+	}
+
+	summary = Summarize([]Execution{{Status: StatusCompleted}, {Status: StatusTimedOut}})
+	if summary.Status() != StatusFailed {
+		t.Errorf("Expected failed, got: %s", summary.Status())
+	}
+
+	summary = Summarize([]Execution{{Status: StatusTimedOut}, {Status: StatusCancelled}})
+	if summary.Cancelled != 1 || summary.Failed != 1 || summary.Status() != StatusCancelled {
+		t.Errorf("Expected cancelled, got: %+v %s", summary, summary.Status())
+	}
+}
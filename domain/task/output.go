@@ -0,0 +1,47 @@
+package task
+
+import (
+	"context"
+	"time"
+)
+
+// Output streams.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputChunk is a piece of a task's stdout or stderr streamed by an agent
+// while the task runs. Sequence orders a task's chunks across streams and
+// agents, starting at 1. AgentSequence is the agent's own per-stream
+// counter, which makes a retried chunk a no-op.
+type OutputChunk struct {
+	ID                 uint      `json:"-" gorm:"primaryKey"`
+	TaskID             string    `json:"task_id" gorm:"uniqueIndex:idx_task_output_chunks_sequence,priority:1"`
+	Sequence           int64     `json:"sequence" gorm:"uniqueIndex:idx_task_output_chunks_sequence,priority:2"`
+	AgentID            string    `json:"agent_id"`
+	ExecutionAttemptID string    `json:"execution_attempt_id,omitempty"`
+	Stream             string    `json:"stream"`
+	AgentSequence      int64     `json:"-"`
+	Data               string    `json:"data"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// TableName keeps output chunks next to tasks.
+func (OutputChunk) TableName() string {
+	return "task_output_chunks"
+}
+
+// ValidStream reports whether stream is stdout or stderr.
+func ValidStream(stream string) bool {
+	return stream == StreamStdout || stream == StreamStderr
+}
+
+type OutputRepository interface {
+	// AppendOutput assigns chunk the task's next sequence and stores it. A
+	// chunk the agent already sent keeps its stored sequence.
+	AppendOutput(ctx context.Context, chunk *OutputChunk) error
+	// FindOutput returns up to limit of a task's chunks after afterSequence,
+	// in order. A zero limit returns them all.
+	FindOutput(ctx context.Context, taskID string, afterSequence int64, limit int) ([]OutputChunk, error)
+}
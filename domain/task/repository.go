@@ -1,6 +1,9 @@
 package task
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Repository interface {
 	Create(ctx context.Context, task *Task) error
@@ -8,4 +11,12 @@ type Repository interface {
 	FindByStatus(ctx context.Context, status string) ([]Task, error)
 	FindByID(ctx context.Context, id string) (*Task, error)
 	Update(ctx context.Context, task *Task) error
+	// Claim leases every pending task agentID may run, giving each claim a
+	// new execution attempt ID, after requeueing lapsed leases.
+	Claim(ctx context.Context, agentID string, lease time.Duration) ([]Task, error)
+	ExpireLeases(ctx context.Context, now time.Time) (int64, error)
+	FindExecutions(ctx context.Context, taskID string) ([]Execution, error)
+	// UpdateExecution moves agentID's execution of taskID along the lifecycle
+	// and rolls the parent task's status up from all of its executions.
+	UpdateExecution(ctx context.Context, taskID, agentID string, result Execution) (*Execution, error)
 }
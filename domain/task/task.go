@@ -1,24 +1,168 @@
 package task
 
 import (
+	"errors"
+	"strings"
 	"time"
 )
 
+// ErrExecutionNotFound is returned when an agent reports a result for a
+// targeted task that was not assigned to it.
+var ErrExecutionNotFound = errors.New("task execution not found")
+
 type Task struct {
-	ID                 string     `json:"id"`
-	ExecutionAttemptID string     `json:"execution_attempt_id"`
-	CreatedAt          time.Time  `json:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at"`
-	DeletedAt          *time.Time `json:"deleted_at,omitempty"`
-	Command            string     `json:"command"`
-	Status             string     `json:"status"`
-	Priority           int        `json:"priority"`
-	Output             string     `json:"output"`
-	Error              string     `json:"error"`
-	ExitCode           int        `json:"exit_code"`
+	ID                 string       `json:"id"`
+	ExecutionAttemptID string       `json:"execution_attempt_id"`
+	CreatedAt          time.Time    `json:"created_at"`
+	UpdatedAt          time.Time    `json:"updated_at"`
+	DeletedAt          *time.Time   `json:"deleted_at,omitempty"`
+	Command            string       `json:"command"`
+	Status             string       `json:"status"`
+	Priority           int          `json:"priority"`
+	Output             string       `json:"output"`
+	Error              string       `json:"error"`
+	ExitCode           int          `json:"exit_code"`
+	OutputPolicy       OutputPolicy `json:"output_policy,omitempty"`
+	ClaimedBy          string       `json:"claimed_by,omitempty"`
+	LeaseExpiresAt     *time.Time   `json:"lease_expires_at,omitempty"`
+
+	// EnvSecrets names secrets injected into the task's environment in
+	// addition to those its command references as {{secret:name}}.
+	EnvSecrets    []string `json:"env_secrets,omitempty" gorm:"-"`
+	EnvSecretList string   `json:"-"`
+
+	// AgentIDs targets the task at specific agents, creating one Execution
+	// per agent. A task without agents is claimed by the first agent to poll.
+	AgentIDs []string `json:"agent_ids,omitempty" gorm:"-"`
+	// Secrets are the referenced secrets of the claiming agent, sealed for
+	// its key. They are attached when the task is claimed and never stored
+	// with it.
+	Secrets []Secret `json:"secrets,omitempty" gorm:"-"`
+	// Summary aggregates the executions of a targeted task.
+	Summary *ExecutionSummary `json:"summary,omitempty" gorm:"-"`
+}
+
+// Secret is a named secret delivered with a claimed task. ValueEnc is an
+// envelope the agent opens with the secret's envelope context.
+type Secret struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ValueEnc string `json:"value_enc"`
+}
+
+// Execution is a targeted task's run on one agent. AttemptID changes with
+// every claim and is the execution attempt ID the agent reports under.
+type Execution struct {
+	ID             string     `json:"id"`
+	TaskID         string     `json:"task_id" gorm:"index"`
+	AgentID        string     `json:"agent_id" gorm:"index"`
+	AttemptID      string     `json:"attempt_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Status         string     `json:"status"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	Output         string     `json:"output"`
+	Error          string     `json:"error"`
+	ExitCode       int        `json:"exit_code"`
+}
+
+// TableName keeps executions next to tasks.
+func (Execution) TableName() string {
+	return "task_executions"
+}
+
+// Finished reports whether the execution reached a terminal status.
+func (e Execution) Finished() bool {
+	return IsTerminal(e.Status)
+}
+
+// Succeeded reports whether the execution completed with exit code zero.
+func (e Execution) Succeeded() bool {
+	return e.Status == StatusCompleted && e.ExitCode == 0 && e.Error == ""
+}
+
+// ExecutionSummary counts a targeted task's executions by outcome.
+type ExecutionSummary struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+// Summarize counts executions by outcome.
+func Summarize(executions []Execution) ExecutionSummary {
+	summary := ExecutionSummary{Total: len(executions)}
+	for _, execution := range executions {
+		switch {
+		case execution.Succeeded():
+			summary.Succeeded++
+		case execution.Status == StatusCancelled:
+			summary.Cancelled++
+		case execution.Finished():
+			summary.Failed++
+		case execution.Status == StatusPending:
+			summary.Pending++
+		default:
+			summary.Running++
+		}
+	}
+	return summary
+}
+
+// Status is the parent task status implied by the summary: pending until an
+// execution is claimed, running until every execution has finished, then
+// cancelled if an operator cancelled any, completed or, if any did not
+// succeed, failed.
+func (s ExecutionSummary) Status() string {
+	switch {
+	case s.Pending == s.Total:
+		return StatusPending
+	case s.Pending+s.Running > 0:
+		return StatusRunning
+	case s.Cancelled > 0:
+		return StatusCancelled
+	case s.Failed > 0:
+		return StatusFailed
+	default:
+		return StatusCompleted
+	}
+}
+
+// OutputPolicy decides what the agent does with task output once the control
+// plane's output credit is exhausted.
+type OutputPolicy string
+
+const (
+	// OutputPolicyBlock stops reading the process output until credit is
+	// granted, pushing back on the process instead of losing output.
+	OutputPolicyBlock OutputPolicy = "block"
+	// OutputPolicyDropOldest keeps the process running and lets the local
+	// spool discard the oldest unacknowledged output when it fills up.
+	OutputPolicyDropOldest OutputPolicy = "drop-oldest"
+)
+
+// Valid reports whether p is empty (the default, block) or a known policy.
+func (p OutputPolicy) Valid() bool {
+	return p == "" || p == OutputPolicyBlock || p == OutputPolicyDropOldest
+}
+
+// JoinSecrets encodes a task's env secrets for storage.
+func JoinSecrets(names []string) string {
+	return strings.Join(names, ",")
+}
+
+// SplitSecrets decodes stored env secrets.
+func SplitSecrets(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
 }
 
 type TaskFilters struct {
 	Status   *string
 	Priority *int
+	AgentID  *string
 }
@@ -0,0 +1,22 @@
+package webhook
+
+import (
+	"context"
+	"time"
+)
+
+type Repository interface {
+	CreateSubscription(ctx context.Context, subscription *Subscription) error
+	UpdateSubscription(ctx context.Context, subscription *Subscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+	FindSubscription(ctx context.Context, id string) (*Subscription, error)
+	FindSubscriptions(ctx context.Context) ([]Subscription, error)
+
+	CreateDeliveries(ctx context.Context, deliveries []Delivery) error
+	// FindDueDeliveries returns up to limit pending deliveries whose next
+	// attempt is at or before now, oldest first.
+	FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error)
+	UpdateDelivery(ctx context.Context, delivery *Delivery) error
+	// FindDeliveries lists a subscription's deliveries, newest first.
+	FindDeliveries(ctx context.Context, subscriptionID string, limit int) ([]Delivery, error)
+}
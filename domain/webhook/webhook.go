@@ -0,0 +1,159 @@
+// Package webhook contains the domain for outgoing event notifications
+package webhook
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Event types a subscription can filter on.
+const (
+	EventTaskCompleted    = "task.completed"
+	EventTaskFailed       = "task.failed"
+	EventAgentOffline     = "agent.offline"
+	EventAgentRegistered  = "agent.registered"
+	EventUpdateRolledBack = "update.rolled_back"
+)
+
+// Events lists every event type in the order they are documented.
+var Events = []string{
+	EventTaskCompleted,
+	EventTaskFailed,
+	EventAgentOffline,
+	EventAgentRegistered,
+	EventUpdateRolledBack,
+}
+
+// Delivery statuses. A pending delivery is retried until it succeeds or
+// runs out of attempts.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+var (
+	// ErrSubscriptionNotFound is returned when no subscription has the
+	// given ID.
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	// ErrUnknownEvent is returned for an event type that is not in Events.
+	ErrUnknownEvent = errors.New("unknown webhook event")
+)
+
+// Subscription delivers the events it filters on to URL. Secret signs every
+// payload and is only returned when the subscription is created.
+type Subscription struct {
+	ID          string     `json:"id"`
+	URL         string     `json:"url"`
+	Secret      string     `json:"secret,omitempty"`
+	EventFilter string     `json:"-" gorm:"column:events"`
+	Events      []string   `json:"events" gorm:"-"`
+	Description string     `json:"description"`
+	Active      bool       `json:"active"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// TableName names the webhook subscription table.
+func (Subscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// Matches reports whether the subscription wants events of eventType.
+func (s Subscription) Matches(eventType string) bool {
+	if !s.Active {
+		return false
+	}
+	for _, event := range s.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event queued for one subscription, and the log of its
+// attempts so far.
+type Delivery struct {
+	ID             string     `json:"id"`
+	SubscriptionID string     `json:"subscription_id" gorm:"index"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status" gorm:"index:idx_webhook_deliveries_due,priority:1"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_due,priority:2"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName names the webhook delivery log.
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// Event is the JSON body POSTed to subscribers.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// ValidEvent reports whether eventType is a known event.
+func ValidEvent(eventType string) bool {
+	for _, event := range Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinEvents encodes an event filter for storage.
+func JoinEvents(events []string) string {
+	return strings.Join(events, ",")
+}
+
+// SplitEvents decodes a stored event filter.
+func SplitEvents(filter string) []string {
+	if filter == "" {
+		return []string{}
+	}
+	return strings.Split(filter, ",")
+}
+
+// TaskData is the data of task.completed and task.failed events.
+type TaskData struct {
+	ID       string   `json:"id"`
+	Command  string   `json:"command"`
+	Status   string   `json:"status"`
+	ExitCode int      `json:"exit_code"`
+	Error    string   `json:"error,omitempty"`
+	AgentID  string   `json:"agent_id,omitempty"`
+	AgentIDs []string `json:"agent_ids,omitempty"`
+}
+
+// AgentData is the data of agent.offline and agent.registered events.
+type AgentData struct {
+	ID          string    `json:"id"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Hostname    string    `json:"hostname,omitempty"`
+	Status      string    `json:"status"`
+	LastSeen    time.Time `json:"last_seen"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// UpdateData is the data of update.rolled_back events.
+type UpdateData struct {
+	AgentID       string `json:"agent_id"`
+	UpdateID      string `json:"update_id"`
+	SourceVersion string `json:"source_version"`
+	TargetVersion string `json:"target_version"`
+	Error         string `json:"error,omitempty"`
+}
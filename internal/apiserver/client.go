@@ -9,6 +9,7 @@ import (
 	"hostlink/app/services/agentstate"
 	"hostlink/app/services/requestsigner"
 	"hostlink/config/appconf"
+	"hostlink/internal/httpclient"
 	"io"
 	"net/http"
 	"time"
@@ -33,9 +34,7 @@ func NewClient(cfg Config) (*client, error) {
 	}
 
 	return &client{
-		httpClient: &http.Client{
-			Timeout: cfg.timeout,
-		},
+		httpClient: httpclient.NewClient(cfg.timeout),
 		signer:     signer,
 		baseURL:    cfg.baseURL,
 		maxRetries: cfg.maxRetries,
@@ -52,30 +51,39 @@ func NewDefaultClient() (*client, error) {
 }
 
 func (c *client) do(ctx context.Context, method, path string, body any, result any) error {
-	var bodyReader io.Reader
+	var jsonData []byte
 	if body != nil {
-		jsonData, err := json.Marshal(body)
+		var err error
+		jsonData, err = json.Marshal(body)
 		if err != nil {
 			return fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		bodyReader = bytes.NewReader(jsonData)
 	}
 
-	url := c.baseURL + path
-	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
+	// Each attempt is signed afresh, since a server tracking nonces rejects
+	// a resent signature as a replay
+	newRequest := func() (*http.Request, error) {
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(jsonData)
+		}
 
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
 
-	if err := c.signer.SignRequest(req); err != nil {
-		return fmt.Errorf("failed to sign request: %w", err)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		if err := c.signer.SignRequest(req); err != nil {
+			return nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+		return req, nil
 	}
 
-	resp, err := c.executeWithRetry(req)
+	resp, err := c.executeWithRetry(newRequest)
 	if err != nil {
 		return err
 	}
@@ -94,13 +102,18 @@ func (c *client) do(ctx context.Context, method, path string, body any, result a
 	return nil
 }
 
-func (c *client) executeWithRetry(req *http.Request) (*http.Response, error) {
+func (c *client) executeWithRetry(newRequest func() (*http.Request, error)) (*http.Response, error) {
 	var lastErr error
 	for attempt := 0; attempt <= c.maxRetries; attempt++ {
 		if attempt > 0 {
 			time.Sleep(time.Duration(attempt) * time.Second)
 		}
 
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
 		resp, err := c.httpClient.Do(req)
 		if err == nil && resp.StatusCode < 500 {
 			return resp, nil
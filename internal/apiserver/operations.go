@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"hostlink/domain/credential"
 	"hostlink/domain/metrics"
+	"hostlink/domain/secret"
 	"hostlink/domain/task"
+	"time"
 )
 
 type MetricsOperations interface {
@@ -18,8 +20,19 @@ type HeartbeatResponse struct {
 	PendingTasks []task.Task `json:"pending_tasks"`
 }
 
+// HeartbeatRequest carries the tags the agent declares. Without them the
+// heartbeat has no body and the agent's declared tags stay as they are.
+type HeartbeatRequest struct {
+	DeclaredTags []TagPair `json:"declared_tags"`
+}
+
+type TagPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
 type HeartbeatOperations interface {
-	Heartbeat(ctx context.Context, agentID string) (*HeartbeatResponse, error)
+	Heartbeat(ctx context.Context, agentID string, req HeartbeatRequest) (*HeartbeatResponse, error)
 }
 
 func (c *client) GetMetricsCreds(ctx context.Context, agentID string) ([]credential.Credential, error) {
@@ -33,9 +46,86 @@ func (c *client) PushMetrics(ctx context.Context, payload metrics.MetricPayload)
 	return c.Post(ctx, fmt.Sprintf("/api/v1/agents/%s/metrics", agentID), payload, nil)
 }
 
-func (c *client) Heartbeat(ctx context.Context, agentID string) (*HeartbeatResponse, error) {
+func (c *client) Heartbeat(ctx context.Context, agentID string, req HeartbeatRequest) (*HeartbeatResponse, error) {
+	var body any
+	if req.DeclaredTags != nil {
+		body = req
+	}
 	var result HeartbeatResponse
-	err := c.Post(ctx, fmt.Sprintf("/api/v1/agents/%s/heartbeat", agentID), nil, &result)
+	err := c.Post(ctx, fmt.Sprintf("/api/v1/agents/%s/heartbeat", agentID), body, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type CertificateOperations interface {
+	RenewCertificate(ctx context.Context, agentID string, csrPEM string) (string, error)
+}
+
+type certificateRenewalRequest struct {
+	CSR string `json:"csr"`
+}
+
+type certificateResponse struct {
+	Certificate string `json:"certificate"`
+}
+
+func (c *client) RenewCertificate(ctx context.Context, agentID string, csrPEM string) (string, error) {
+	var result certificateResponse
+	err := c.Post(ctx, fmt.Sprintf("/api/v1/agents/%s/certificate", agentID), certificateRenewalRequest{CSR: csrPEM}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.Certificate, nil
+}
+
+// KeyRotationRequest switches the agent to PublicKey. Proof is
+// agent.KeyProofMessage signed with the new key.
+type KeyRotationRequest struct {
+	PublicKey     string              `json:"public_key"`
+	PublicKeyType string              `json:"public_key_type"`
+	Proof         string              `json:"proof"`
+	Credentials   []RotatedCredential `json:"credentials"`
+	Secrets       []RotatedSecret     `json:"secrets"`
+	CSR           string              `json:"csr,omitempty"`
+}
+
+// RotatedCredential is a credential password re-encrypted with the new key.
+type RotatedCredential struct {
+	ID                string `json:"id"`
+	PreviousPasswdEnc string `json:"previous_passwd_enc"`
+	PasswdEnc         string `json:"passwd_enc"`
+}
+
+// RotatedSecret is a secret value sealed for the new key.
+type RotatedSecret struct {
+	ID               string `json:"id"`
+	PreviousValueEnc string `json:"previous_value_enc"`
+	ValueEnc         string `json:"value_enc"`
+}
+
+type KeyRotationResponse struct {
+	RotatedAt             *time.Time `json:"rotated_at"`
+	PreviousKeyValidUntil *time.Time `json:"previous_key_valid_until"`
+	Certificate           string     `json:"certificate,omitempty"`
+}
+
+type KeyOperations interface {
+	GetMetricsCreds(ctx context.Context, agentID string) ([]credential.Credential, error)
+	GetSecrets(ctx context.Context, agentID string) ([]secret.Secret, error)
+	RotateKey(ctx context.Context, agentID string, req KeyRotationRequest) (*KeyRotationResponse, error)
+}
+
+func (c *client) GetSecrets(ctx context.Context, agentID string) ([]secret.Secret, error) {
+	var result []secret.Secret
+	err := c.Get(ctx, fmt.Sprintf("/api/v1/agents/%s/secrets", agentID), &result)
+	return result, err
+}
+
+func (c *client) RotateKey(ctx context.Context, agentID string, req KeyRotationRequest) (*KeyRotationResponse, error) {
+	var result KeyRotationResponse
+	err := c.Post(ctx, fmt.Sprintf("/api/v1/agents/%s/rotate-key", agentID), req, &result)
 	if err != nil {
 		return nil, err
 	}
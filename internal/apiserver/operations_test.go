@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
@@ -49,7 +50,7 @@ func TestHeartbeat_Success(t *testing.T) {
 	defer server.Close()
 
 	c := setupTestClient(t, server.URL)
-	resp, err := c.Heartbeat(context.Background(), "test-agent-123")
+	resp, err := c.Heartbeat(context.Background(), "test-agent-123", HeartbeatRequest{})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
@@ -68,7 +69,7 @@ func TestHeartbeat_SendsToCorrectEndpoint(t *testing.T) {
 	defer server.Close()
 
 	c := setupTestClient(t, server.URL)
-	resp, err := c.Heartbeat(context.Background(), "agent-xyz")
+	resp, err := c.Heartbeat(context.Background(), "agent-xyz", HeartbeatRequest{})
 
 	require.NoError(t, err)
 	assert.NotNil(t, resp)
@@ -87,13 +88,32 @@ func TestHeartbeat_SendsEmptyBody(t *testing.T) {
 	defer server.Close()
 
 	c := setupTestClient(t, server.URL)
-	resp, err := c.Heartbeat(context.Background(), "test-agent-123")
+	resp, err := c.Heartbeat(context.Background(), "test-agent-123", HeartbeatRequest{})
 
 	require.NoError(t, err)
 	assert.NotNil(t, resp)
 	assert.Equal(t, int64(0), bodySize)
 }
 
+// TestHeartbeat_SendsDeclaredTags - verifies declared tags are sent as the body
+func TestHeartbeat_SendsDeclaredTags(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	c := setupTestClient(t, server.URL)
+	_, err := c.Heartbeat(context.Background(), "test-agent-123", HeartbeatRequest{
+		DeclaredTags: []TagPair{{Key: "role", Value: "web"}},
+	})
+
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"declared_tags":[{"key":"role","value":"web"}]}`, string(body))
+}
+
 // TestHeartbeat_AuthenticationHeadersIncluded - verifies signed request headers are present
 func TestHeartbeat_AuthenticationHeadersIncluded(t *testing.T) {
 	var headers http.Header
@@ -105,7 +125,7 @@ func TestHeartbeat_AuthenticationHeadersIncluded(t *testing.T) {
 	defer server.Close()
 
 	c := setupTestClient(t, server.URL)
-	resp, err := c.Heartbeat(context.Background(), "test-agent-123")
+	resp, err := c.Heartbeat(context.Background(), "test-agent-123", HeartbeatRequest{})
 
 	require.NoError(t, err)
 	assert.NotNil(t, resp)
@@ -124,7 +144,7 @@ func TestHeartbeat_ServerError(t *testing.T) {
 	defer server.Close()
 
 	c := setupTestClient(t, server.URL)
-	resp, err := c.Heartbeat(context.Background(), "test-agent-123")
+	resp, err := c.Heartbeat(context.Background(), "test-agent-123", HeartbeatRequest{})
 
 	assert.Error(t, err)
 	assert.Nil(t, resp)
@@ -139,7 +159,7 @@ func TestHeartbeat_Unauthorized(t *testing.T) {
 	defer server.Close()
 
 	c := setupTestClient(t, server.URL)
-	resp, err := c.Heartbeat(context.Background(), "test-agent-123")
+	resp, err := c.Heartbeat(context.Background(), "test-agent-123", HeartbeatRequest{})
 
 	assert.Error(t, err)
 	assert.Nil(t, resp)
@@ -154,7 +174,7 @@ func TestHeartbeat_PendingTasks(t *testing.T) {
 	defer server.Close()
 
 	c := setupTestClient(t, server.URL)
-	resp, err := c.Heartbeat(context.Background(), "test-agent-123")
+	resp, err := c.Heartbeat(context.Background(), "test-agent-123", HeartbeatRequest{})
 
 	require.NoError(t, err)
 	require.NotNil(t, resp)
@@ -162,3 +182,26 @@ func TestHeartbeat_PendingTasks(t *testing.T) {
 	assert.Equal(t, "tsk_test", resp.PendingTasks[0].ID)
 	assert.Equal(t, "echo hello", resp.PendingTasks[0].Command)
 }
+
+// TestHeartbeat_RetrySignsAgain - a retried request carries a fresh nonce
+func TestHeartbeat_RetrySignsAgain(t *testing.T) {
+	var nonces []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, r.Header.Get("X-Nonce"))
+		if len(nonces) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	c := setupTestClient(t, server.URL)
+	c.maxRetries = 1
+	_, err := c.Heartbeat(context.Background(), "test-agent-123", HeartbeatRequest{})
+
+	require.NoError(t, err)
+	require.Len(t, nonces, 2)
+	assert.NotEqual(t, nonces[0], nonces[1])
+}
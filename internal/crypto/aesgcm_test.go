@@ -0,0 +1,54 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealAndOpenAESGCM(t *testing.T) {
+	key, err := GenerateDataKey()
+	if err != nil {
+		t.Fatalf("GenerateDataKey: %v", err)
+	}
+
+	sealed, err := SealAESGCM(key, []byte("secret"), []byte("msg-1"))
+	if err != nil {
+		t.Fatalf("SealAESGCM: %v", err)
+	}
+	plaintext, err := OpenAESGCM(key, sealed, []byte("msg-1"))
+	if err != nil {
+		t.Fatalf("OpenAESGCM: %v", err)
+	}
+	if string(plaintext) != "secret" {
+		t.Errorf("plaintext = %q, want secret", plaintext)
+	}
+	if _, err := OpenAESGCM(key, sealed, []byte("msg-2")); err == nil {
+		t.Error("expected additional data mismatch to fail")
+	}
+}
+
+func TestLoadSymmetricKeyAcceptsRawAndHex(t *testing.T) {
+	key, _ := GenerateDataKey()
+	dir := t.TempDir()
+	rawPath := filepath.Join(dir, "raw.key")
+	hexPath := filepath.Join(dir, "hex.key")
+	shortPath := filepath.Join(dir, "short.key")
+	_ = os.WriteFile(rawPath, key, 0600)
+	_ = os.WriteFile(hexPath, []byte(hex.EncodeToString(key)+"\n"), 0600)
+	_ = os.WriteFile(shortPath, []byte("too short"), 0600)
+
+	for _, path := range []string{rawPath, hexPath} {
+		loaded, err := LoadSymmetricKey(path)
+		if err != nil {
+			t.Fatalf("LoadSymmetricKey(%s): %v", path, err)
+		}
+		if string(loaded) != string(key) {
+			t.Errorf("LoadSymmetricKey(%s) returned a different key", path)
+		}
+	}
+	if _, err := LoadSymmetricKey(shortPath); err == nil {
+		t.Error("expected short key to be rejected")
+	}
+}
@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// CreateCertificateRequestPEM creates a PEM-encoded PKCS#10 certificate signing
+// request for the given key with commonName as the subject.
+func CreateCertificateRequestPEM(key crypto.Signer, commonName string) (string, error) {
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
+
+// ParseCertificateRequestPEM parses a PEM-encoded certificate signing request
+// and verifies its self-signature.
+func ParseCertificateRequestPEM(pemString string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(pemString))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("failed to parse certificate request PEM block")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+	return csr, nil
+}
+
+// ParseCertificatePEM parses the first certificate in a PEM string.
+func ParseCertificatePEM(pemString string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(pemString))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("failed to parse certificate PEM block")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// LoadCertificate loads the first certificate from a PEM file.
+func LoadCertificate(certPath string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+	return ParseCertificatePEM(string(data))
+}
+
+// SaveCertificatePEM writes a PEM certificate to certPath with owner-only permissions.
+func SaveCertificatePEM(certPEM, certPath string) error {
+	if _, err := ParseCertificatePEM(certPEM); err != nil {
+		return err
+	}
+	tmpPath := certPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(certPEM), 0600); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	if err := os.Rename(tmpPath, certPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace certificate: %w", err)
+	}
+	return nil
+}
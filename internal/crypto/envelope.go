@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// envelopePrefix marks a secret sealed by SealEnvelope
+const envelopePrefix = "env:v1:"
+
+// SealEnvelope encrypts a secret of any size for the holder of publicKey: a
+// random AES-256-GCM data key encrypts the secret and is itself encrypted
+// with EncryptForKey. associatedData, such as the IDs of the agent and of
+// the record holding the secret, is authenticated but not encrypted, so an
+// envelope only opens in the context it was sealed for.
+func SealEnvelope(secret []byte, publicKey crypto.PublicKey, associatedData ...string) (string, error) {
+	dataKey, err := GenerateDataKey()
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := EncryptForKey(string(dataKey), publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	sealed, err := SealAESGCM(dataKey, secret, envelopeAAD(associatedData))
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + wrappedKey + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenEnvelope decrypts an envelope made by SealEnvelope for key's public
+// half, with the same associatedData
+func OpenEnvelope(envelope string, key crypto.Signer, associatedData ...string) ([]byte, error) {
+	if !IsEnvelope(envelope) {
+		return nil, fmt.Errorf("not an envelope")
+	}
+	wrappedKey, encoded, ok := strings.Cut(strings.TrimPrefix(envelope, envelopePrefix), ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed envelope")
+	}
+	dataKey, err := DecryptWithKey(wrappedKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+	return OpenAESGCM([]byte(dataKey), sealed, envelopeAAD(associatedData))
+}
+
+// IsEnvelope reports whether ciphertext was made by SealEnvelope
+func IsEnvelope(ciphertext string) bool {
+	return strings.HasPrefix(ciphertext, envelopePrefix)
+}
+
+// OpenSecret decrypts a secret sent to the agent: an envelope, or a
+// ciphertext encrypted whole with EncryptForKey before envelopes were used,
+// which carries no associated data
+func OpenSecret(ciphertext string, key crypto.Signer, associatedData ...string) (string, error) {
+	if !IsEnvelope(ciphertext) {
+		return DecryptWithKey(ciphertext, key)
+	}
+	secret, err := OpenEnvelope(ciphertext, key, associatedData...)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// envelopeAAD length-prefixes each value, so values cannot be shifted from
+// one to the next
+func envelopeAAD(associatedData []string) []byte {
+	var aad []byte
+	for _, value := range associatedData {
+		aad = binary.BigEndian.AppendUint32(aad, uint32(len(value)))
+		aad = append(aad, value...)
+	}
+	return aad
+}
@@ -0,0 +1,146 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	for _, keyType := range keyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			key, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatalf("GenerateKey: %v", err)
+			}
+
+			envelope, err := SealEnvelope([]byte("s3cret"), key.Public(), "credential", "agt_1", "crd_1")
+			if err != nil {
+				t.Fatalf("SealEnvelope: %v", err)
+			}
+			if !IsEnvelope(envelope) {
+				t.Errorf("IsEnvelope(%q) = false", envelope)
+			}
+
+			secret, err := OpenEnvelope(envelope, key, "credential", "agt_1", "crd_1")
+			if err != nil {
+				t.Fatalf("OpenEnvelope: %v", err)
+			}
+			if string(secret) != "s3cret" {
+				t.Errorf("secret = %q, want %q", secret, "s3cret")
+			}
+		})
+	}
+}
+
+func TestEnvelopeSealsLargeSecrets(t *testing.T) {
+	key, err := GenerateKey(KeyTypeRSA)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	// Far beyond what RSA-OAEP can encrypt directly
+	secret := make([]byte, 64*1024)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+
+	envelope, err := SealEnvelope(secret, key.Public())
+	if err != nil {
+		t.Fatalf("SealEnvelope: %v", err)
+	}
+	opened, err := OpenEnvelope(envelope, key)
+	if err != nil {
+		t.Fatalf("OpenEnvelope: %v", err)
+	}
+	if !bytes.Equal(opened, secret) {
+		t.Error("opened secret does not match")
+	}
+}
+
+func TestEnvelopeBindsAssociatedData(t *testing.T) {
+	key, err := GenerateKey(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	envelope, err := SealEnvelope([]byte("s3cret"), key.Public(), "agt_1", "crd_1")
+	if err != nil {
+		t.Fatalf("SealEnvelope: %v", err)
+	}
+
+	tests := map[string][]string{
+		"other credential":  {"agt_1", "crd_2"},
+		"other agent":       {"agt_2", "crd_1"},
+		"shifted values":    {"agt_1c", "rd_1"},
+		"missing values":    nil,
+		"additional values": {"agt_1", "crd_1", "extra"},
+	}
+	for name, associatedData := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := OpenEnvelope(envelope, key, associatedData...); err == nil {
+				t.Error("expected the envelope not to open")
+			}
+		})
+	}
+
+	otherKey, err := GenerateKey(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if _, err := OpenEnvelope(envelope, otherKey, "agt_1", "crd_1"); err == nil {
+		t.Error("expected the envelope not to open with another key")
+	}
+}
+
+func TestOpenEnvelopeRejectsMalformedInput(t *testing.T) {
+	key, err := GenerateKey(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	for _, input := range []string{"", "plain", envelopePrefix, envelopePrefix + "no-separator"} {
+		if _, err := OpenEnvelope(input, key); err == nil {
+			t.Errorf("OpenEnvelope(%q): expected an error", input)
+		}
+	}
+}
+
+func TestOpenSecret(t *testing.T) {
+	key, err := GenerateKey(KeyTypeRSA)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	t.Run("opens an envelope", func(t *testing.T) {
+		envelope, err := SealEnvelope([]byte("s3cret"), key.Public(), "crd_1")
+		if err != nil {
+			t.Fatalf("SealEnvelope: %v", err)
+		}
+		secret, err := OpenSecret(envelope, key, "crd_1")
+		if err != nil {
+			t.Fatalf("OpenSecret: %v", err)
+		}
+		if secret != "s3cret" {
+			t.Errorf("secret = %q, want %q", secret, "s3cret")
+		}
+		if _, err := OpenSecret(envelope, key, "crd_2"); err == nil {
+			t.Error("expected the envelope not to open for another credential")
+		}
+	})
+
+	t.Run("decrypts a legacy ciphertext", func(t *testing.T) {
+		ciphertext, err := EncryptForKey("s3cret", key.Public())
+		if err != nil {
+			t.Fatalf("EncryptForKey: %v", err)
+		}
+		if strings.HasPrefix(ciphertext, envelopePrefix) {
+			t.Fatal("legacy ciphertext looks like an envelope")
+		}
+		secret, err := OpenSecret(ciphertext, key, "crd_1")
+		if err != nil {
+			t.Fatalf("OpenSecret: %v", err)
+		}
+		if secret != "s3cret" {
+			t.Errorf("secret = %q, want %q", secret, "s3cret")
+		}
+	})
+}
@@ -0,0 +1,289 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Key types an agent key can have
+const (
+	KeyTypeRSA     = "rsa"
+	KeyTypeEd25519 = "ed25519"
+	KeyTypeECDSA   = "ecdsa"
+)
+
+// ErrVerification is returned for a signature that does not match
+var ErrVerification = errors.New("verification error")
+
+// rsaKeyBits is the size of generated RSA keys
+const rsaKeyBits = 2048
+
+// GenerateKey generates a private key of keyType. ECDSA keys use P-256.
+func GenerateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyTypeRSA:
+		return GenerateRSAKeypair(rsaKeyBits)
+	case KeyTypeEd25519:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		return privateKey, nil
+	case KeyTypeECDSA:
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ECDSA key: %w", err)
+		}
+		return privateKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+// KeyType returns the type of a private or public key, or "" for a key of
+// an unsupported type
+func KeyType(key any) string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return KeyTypeRSA
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return KeyTypeEd25519
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P256() {
+			return KeyTypeECDSA
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return KeyTypeECDSA
+		}
+	}
+	return ""
+}
+
+// SaveKey saves a private key to a file in PEM format. RSA keys keep the
+// PKCS#1 encoding of SavePrivateKey; other keys are stored as PKCS#8.
+func SaveKey(key crypto.Signer, keyPath string) error {
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return SavePrivateKey(rsaKey, keyPath)
+	}
+	if KeyType(key) == "" {
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	file, err := os.OpenFile(keyPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create private key file: %w", err)
+	}
+	defer file.Close()
+
+	// Ensure correct permissions even if file already existed
+	if err := file.Chmod(0600); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	return nil
+}
+
+// LoadKey loads a private key of any supported type from a PEM file
+func LoadKey(keyPath string) (crypto.Signer, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse PEM block")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if ecKey, ecErr := x509.ParseECPrivateKey(block.Bytes); ecErr == nil {
+			key = ecKey
+		} else {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok || KeyType(signer) == "" {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// LoadOrGenerateKey loads an existing key of whatever type it has, or
+// generates and saves a new one of keyType
+func LoadOrGenerateKey(keyPath, keyType string) (crypto.Signer, error) {
+	if _, err := os.Stat(keyPath); err == nil {
+		key, err := LoadKey(keyPath)
+		if err == nil {
+			return key, nil
+		}
+		// If loading failed, generate new one
+	}
+
+	key, err := GenerateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := SaveKey(key, keyPath); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// PublicKeyBase64 returns the public half of key as base64 PKIX DER, the
+// form the control plane stores
+func PublicKeyBase64(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// ParsePublicKeyBase64 parses a base64 PKIX public key of any supported type
+func ParsePublicKeyBase64(base64String string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(base64String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode input: %w", err)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	if KeyType(publicKey) == "" {
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	return publicKey, nil
+}
+
+// Sign signs message with key: RSA-PSS and ECDSA sign its SHA-256 digest,
+// Ed25519 signs the message itself
+func Sign(key crypto.Signer, message []byte) ([]byte, error) {
+	var signature []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		hashed := sha256.Sum256(message)
+		signature, err = rsa.SignPSS(rand.Reader, k, crypto.SHA256, hashed[:], nil)
+	case *ecdsa.PrivateKey:
+		hashed := sha256.Sum256(message)
+		signature, err = ecdsa.SignASN1(rand.Reader, k, hashed[:])
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, message)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	return signature, nil
+}
+
+// Verify checks a signature made by Sign
+func Verify(publicKey crypto.PublicKey, message, signature []byte) error {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		hashed := sha256.Sum256(message)
+		return rsa.VerifyPSS(k, crypto.SHA256, hashed[:], signature, nil)
+	case *ecdsa.PublicKey:
+		hashed := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(k, hashed[:], signature) {
+			return ErrVerification
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, message, signature) {
+			return ErrVerification
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// SignMessage signs a message with Sign and returns the base64 signature
+func SignMessage(message string, key crypto.Signer) (string, error) {
+	signature, err := Sign(key, []byte(message))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// VerifyMessage checks a base64 signature made by SignMessage
+func VerifyMessage(message, signatureBase64 string, publicKey crypto.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(signatureBase64)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	return Verify(publicKey, []byte(message), signature)
+}
+
+// EncryptForKey encrypts a message for the holder of publicKey and returns
+// it base64 encoded: RSA keys use RSA-OAEP, Ed25519 and ECDSA keys a sealed
+// box
+func EncryptForKey(msg string, publicKey crypto.PublicKey) (string, error) {
+	if rsaKey, ok := publicKey.(*rsa.PublicKey); ok {
+		return EncryptWithPublicKey(msg, rsaKey)
+	}
+	recipient, err := ecdhPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealBox(recipient, []byte(msg))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptWithKey decrypts a base64 ciphertext made by EncryptForKey for
+// key's public half
+func DecryptWithKey(ciphertextBase64 string, key crypto.Signer) (string, error) {
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return DecryptWithPrivateKey(ciphertextBase64, rsaKey)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertextBase64)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+	privateKey, err := ecdhPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openBox(privateKey, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
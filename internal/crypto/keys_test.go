@@ -0,0 +1,176 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var keyTypes = []string{KeyTypeRSA, KeyTypeEd25519, KeyTypeECDSA}
+
+func TestSaveAndLoadKey(t *testing.T) {
+	for _, keyType := range keyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			keyPath := filepath.Join(t.TempDir(), "agent.key")
+			key, err := LoadOrGenerateKey(keyPath, keyType)
+			if err != nil {
+				t.Fatalf("LoadOrGenerateKey: %v", err)
+			}
+			if got := KeyType(key); got != keyType {
+				t.Errorf("KeyType = %q, want %q", got, keyType)
+			}
+
+			loaded, err := LoadOrGenerateKey(keyPath, KeyTypeEd25519)
+			if err != nil {
+				t.Fatalf("LoadOrGenerateKey: %v", err)
+			}
+			want, _ := PublicKeyBase64(key)
+			got, _ := PublicKeyBase64(loaded)
+			if got != want {
+				t.Error("expected the existing key to be loaded regardless of the requested type")
+			}
+
+			info, err := os.Stat(keyPath)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("permissions = %o, want 600", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestSaveKeyKeepsRSAKeysInPKCS1(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	key, err := GenerateKey(KeyTypeRSA)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if err := SaveKey(key, keyPath); err != nil {
+		t.Fatalf("SaveKey: %v", err)
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Fatalf("expected an RSA PRIVATE KEY block, got %v", block)
+	}
+	if _, err := LoadPrivateKey(keyPath); err != nil {
+		t.Errorf("LoadPrivateKey: %v", err)
+	}
+}
+
+func TestParsePublicKeyBase64(t *testing.T) {
+	for _, keyType := range keyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			key, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatalf("GenerateKey: %v", err)
+			}
+			encoded, err := PublicKeyBase64(key)
+			if err != nil {
+				t.Fatalf("PublicKeyBase64: %v", err)
+			}
+			publicKey, err := ParsePublicKeyBase64(encoded)
+			if err != nil {
+				t.Fatalf("ParsePublicKeyBase64: %v", err)
+			}
+			if got := KeyType(publicKey); got != keyType {
+				t.Errorf("KeyType = %q, want %q", got, keyType)
+			}
+		})
+	}
+
+	if _, err := ParsePublicKeyBase64(base64.StdEncoding.EncodeToString([]byte("not a key"))); err == nil {
+		t.Error("expected invalid key to fail")
+	}
+}
+
+func TestSignAndVerifyMessage(t *testing.T) {
+	for _, keyType := range keyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			key, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatalf("GenerateKey: %v", err)
+			}
+			other, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatalf("GenerateKey: %v", err)
+			}
+
+			signature, err := SignMessage("message", key)
+			if err != nil {
+				t.Fatalf("SignMessage: %v", err)
+			}
+			if err := VerifyMessage("message", signature, key.Public()); err != nil {
+				t.Errorf("VerifyMessage: %v", err)
+			}
+			if err := VerifyMessage("tampered", signature, key.Public()); err == nil {
+				t.Error("expected tampered message to fail")
+			}
+			if err := VerifyMessage("message", signature, other.Public()); err == nil {
+				t.Error("expected another key to fail")
+			}
+		})
+	}
+}
+
+func TestEncryptForKeyAndDecryptWithKey(t *testing.T) {
+	for _, keyType := range keyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			key, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatalf("GenerateKey: %v", err)
+			}
+			other, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatalf("GenerateKey: %v", err)
+			}
+
+			ciphertext, err := EncryptForKey("s3cret", key.Public())
+			if err != nil {
+				t.Fatalf("EncryptForKey: %v", err)
+			}
+			plaintext, err := DecryptWithKey(ciphertext, key)
+			if err != nil {
+				t.Fatalf("DecryptWithKey: %v", err)
+			}
+			if plaintext != "s3cret" {
+				t.Errorf("plaintext = %q, want s3cret", plaintext)
+			}
+			if _, err := DecryptWithKey(ciphertext, other); err == nil {
+				t.Error("expected another key to fail")
+			}
+
+			sealed, _ := base64.StdEncoding.DecodeString(ciphertext)
+			sealed[len(sealed)-1] ^= 1
+			if _, err := DecryptWithKey(base64.StdEncoding.EncodeToString(sealed), key); err == nil {
+				t.Error("expected tampered ciphertext to fail")
+			}
+		})
+	}
+}
+
+func TestEncryptForKeyMatchesRSAOAEP(t *testing.T) {
+	key, err := GenerateRSAKeypair(2048)
+	if err != nil {
+		t.Fatalf("GenerateRSAKeypair: %v", err)
+	}
+	ciphertext, err := EncryptForKey("s3cret", &key.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptForKey: %v", err)
+	}
+	plaintext, err := DecryptWithPrivateKey(ciphertext, key)
+	if err != nil {
+		t.Fatalf("DecryptWithPrivateKey: %v", err)
+	}
+	if plaintext != "s3cret" {
+		t.Errorf("plaintext = %q, want s3cret", plaintext)
+	}
+}
@@ -2,6 +2,7 @@
 package crypto
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -13,7 +14,9 @@ import (
 	"path/filepath"
 )
 
-// Service defines cryptographic operations for RSA key management and encryption
+// Service defines cryptographic operations for agent key management and
+// encryption. The methods taking or returning RSA keys work on RSA keys
+// only; LoadKey and DecryptWithKey handle every supported key type.
 type Service interface {
 	// Key Generation and Management
 	GenerateKeypair(bits int) (*rsa.PrivateKey, error)
@@ -35,6 +38,11 @@ type Service interface {
 	// Encryption/Decryption
 	EncryptWithPublicKey(msg string, pub *rsa.PublicKey) (string, error)
 	DecryptWithPrivateKey(ciphertextBase64 string, privateKey *rsa.PrivateKey) (string, error)
+
+	// Any Key Type
+	LoadKey(keyPath string) (crypto.Signer, error)
+	DecryptWithKey(ciphertextBase64 string, key crypto.Signer) (string, error)
+	OpenSecret(ciphertext string, key crypto.Signer, associatedData ...string) (string, error)
 }
 
 // DefaultCryptoService implements CryptoService using the existing functions
@@ -89,6 +97,18 @@ func (s *DefaultCryptoService) DecryptWithPrivateKey(ciphertextBase64 string, pr
 	return DecryptWithPrivateKey(ciphertextBase64, privateKey)
 }
 
+func (s *DefaultCryptoService) LoadKey(keyPath string) (crypto.Signer, error) {
+	return LoadKey(keyPath)
+}
+
+func (s *DefaultCryptoService) DecryptWithKey(ciphertextBase64 string, key crypto.Signer) (string, error) {
+	return DecryptWithKey(ciphertextBase64, key)
+}
+
+func (s *DefaultCryptoService) OpenSecret(ciphertext string, key crypto.Signer, associatedData ...string) (string, error) {
+	return OpenSecret(ciphertext, key, associatedData...)
+}
+
 // GenerateRSAKeypair generates a new RSA keypair
 func GenerateRSAKeypair(bits int) (*rsa.PrivateKey, error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
@@ -318,3 +338,9 @@ func EncryptWithPublicKey(msg string, pub *rsa.PublicKey) (string, error) {
 	}
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
+
+// PreviousKeyPath is where the key replaced by the last rotation of the key
+// at keyPath is kept, to read data encrypted for it
+func PreviousKeyPath(keyPath string) string {
+	return keyPath + ".previous"
+}
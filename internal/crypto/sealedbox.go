@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+
+	"filippo.io/edwards25519"
+)
+
+// sealedBoxInfo separates the keys derived for sealed boxes from any other
+// use of the same shared secret
+const sealedBoxInfo = "hostlink sealed box v1"
+
+// sealBox encrypts plaintext for recipient with an ephemeral ECDH key and
+// AES-256-GCM. The result is the ephemeral public key followed by the
+// SealAESGCM output; only the holder of the recipient's private key can
+// open it.
+func sealBox(recipient *ecdh.PublicKey, plaintext []byte) ([]byte, error) {
+	ephemeral, err := recipient.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	key, err := sealedBoxKey(ephemeral, recipient, ephemeral.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	ephemeralBytes := ephemeral.PublicKey().Bytes()
+	sealed, err := SealAESGCM(key, plaintext, ephemeralBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	return append(ephemeralBytes, sealed...), nil
+}
+
+// openBox decrypts a box made by sealBox for privateKey's public half.
+func openBox(privateKey *ecdh.PrivateKey, box []byte) ([]byte, error) {
+	size := len(privateKey.PublicKey().Bytes())
+	if len(box) < size {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	ephemeral, err := privateKey.Curve().NewPublicKey(box[:size])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	key, err := sealedBoxKey(privateKey, ephemeral, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	return OpenAESGCM(key, box[size:], box[:size])
+}
+
+// sealedBoxKey derives the AES key from the shared secret of local and
+// remote, bound to the ephemeral key of the box.
+func sealedBoxKey(local *ecdh.PrivateKey, remote, ephemeral *ecdh.PublicKey) ([]byte, error) {
+	shared, err := local.ECDH(remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on key: %w", err)
+	}
+	return hkdf.Key(sha256.New, shared, ephemeral.Bytes(), sealedBoxInfo, DataKeySize)
+}
+
+// ecdhPublicKey converts a signing public key to the ECDH key sealed boxes
+// are encrypted for: X25519 for Ed25519 keys, P-256 for ECDSA keys.
+func ecdhPublicKey(publicKey any) (*ecdh.PublicKey, error) {
+	switch k := publicKey.(type) {
+	case ed25519.PublicKey:
+		point, err := new(edwards25519.Point).SetBytes(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ed25519 public key: %w", err)
+		}
+		return ecdh.X25519().NewPublicKey(point.BytesMontgomery())
+	case *ecdsa.PublicKey:
+		return k.ECDH()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// ecdhPrivateKey converts a signing private key to the ECDH key matching
+// ecdhPublicKey of its public half.
+func ecdhPrivateKey(privateKey any) (*ecdh.PrivateKey, error) {
+	switch k := privateKey.(type) {
+	case ed25519.PrivateKey:
+		// The X25519 scalar is the clamped Ed25519 scalar, which X25519
+		// clamps itself
+		digest := sha512.Sum512(k.Seed())
+		return ecdh.X25519().NewPrivateKey(digest[:32])
+	case *ecdsa.PrivateKey:
+		return k.ECDH()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", privateKey)
+	}
+}
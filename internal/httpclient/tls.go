@@ -0,0 +1,157 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"hostlink/config/appconf"
+)
+
+// ErrPinMismatch is returned when none of the control plane's certificates
+// match a configured SPKI pin.
+var ErrPinMismatch = errors.New("control plane certificate does not match any pinned SPKI hash")
+
+// TLSOptions configures certificate pinning and client certificates for
+// control-plane connections. The zero value leaves Go's defaults untouched.
+type TLSOptions struct {
+	// PinnedSPKIHashes are base64-encoded SHA-256 digests of the
+	// SubjectPublicKeyInfo of the control plane certificate or one of its
+	// issuers. When non-empty, at least one certificate presented by the
+	// server must match.
+	PinnedSPKIHashes []string
+	// ClientCertPath is the PEM certificate presented for mutual TLS.
+	// It is reloaded whenever the file changes so renewals take effect
+	// without a restart.
+	ClientCertPath string
+	// ClientKeyPath is the PEM private key matching ClientCertPath.
+	ClientKeyPath string
+}
+
+// DefaultTLSOptions returns the TLS options derived from the agent configuration.
+func DefaultTLSOptions() TLSOptions {
+	opts := TLSOptions{
+		PinnedSPKIHashes: appconf.TLSPinnedSPKIHashes(),
+	}
+	if appconf.MTLSEnabled() {
+		opts.ClientCertPath = appconf.AgentClientCertPath()
+		opts.ClientKeyPath = appconf.AgentPrivateKeyPath()
+	}
+	return opts
+}
+
+// IsZero reports whether the options change nothing about the default TLS setup.
+func (o TLSOptions) IsZero() bool {
+	return len(o.PinnedSPKIHashes) == 0 && o.ClientCertPath == ""
+}
+
+// Config builds a *tls.Config for the options, or nil when the options are empty.
+func (o TLSOptions) Config() *tls.Config {
+	if o.IsZero() {
+		return nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(o.PinnedSPKIHashes) > 0 {
+		cfg.VerifyConnection = VerifyPinnedSPKI(o.PinnedSPKIHashes)
+	}
+	if o.ClientCertPath != "" {
+		reloader := &certReloader{certPath: o.ClientCertPath, keyPath: o.ClientKeyPath}
+		cfg.GetClientCertificate = reloader.GetClientCertificate
+	}
+	return cfg
+}
+
+// SPKIHash returns the base64-encoded SHA-256 digest of a certificate's
+// SubjectPublicKeyInfo, the format expected in PinnedSPKIHashes.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPinnedSPKI returns a tls.Config.VerifyConnection callback that accepts
+// the connection only if a certificate in the presented chain matches one of pins.
+// It runs after the normal chain verification, so pinning is additive.
+func VerifyPinnedSPKI(pins []string) func(tls.ConnectionState) error {
+	normalized := make([][]byte, 0, len(pins))
+	for _, pin := range pins {
+		pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+		if pin == "" {
+			continue
+		}
+		normalized = append(normalized, []byte(pin))
+	}
+	return func(cs tls.ConnectionState) error {
+		for _, cert := range cs.PeerCertificates {
+			hash := []byte(SPKIHash(cert))
+			for _, pin := range normalized {
+				if subtle.ConstantTimeCompare(hash, pin) == 1 {
+					return nil
+				}
+			}
+		}
+		return ErrPinMismatch
+	}
+}
+
+// NewTransport returns a clone of http.DefaultTransport using the TLS options.
+func NewTransport(opts TLSOptions) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg := opts.Config(); cfg != nil {
+		transport.TLSClientConfig = cfg
+	}
+	return transport
+}
+
+type certReloader struct {
+	certPath string
+	keyPath  string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	modTime time.Time
+	cert    *tls.Certificate
+}
+
+// GetClientCertificate loads the client certificate, reloading it when the
+// certificate file has been replaced. A missing or expired certificate is not
+// an error: the handshake proceeds without one and the server decides whether
+// that is acceptable. The server rejects an expired certificate outright,
+// which would also lock the agent out of renewing it.
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.certPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &tls.Certificate{}, nil
+		}
+		return nil, fmt.Errorf("stat client certificate: %w", err)
+	}
+	if r.cert == nil || !info.ModTime().Equal(r.modTime) {
+		cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		r.cert = &cert
+		r.modTime = info.ModTime()
+	}
+
+	now := time.Now
+	if r.now != nil {
+		now = r.now
+	}
+	if r.cert.Leaf != nil && now().After(r.cert.Leaf.NotAfter) {
+		return &tls.Certificate{}, nil
+	}
+	return r.cert, nil
+}
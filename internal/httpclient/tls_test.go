@@ -0,0 +1,158 @@
+package httpclient
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func pinnedClient(t *testing.T, server *httptest.Server, pins []string) *http.Client {
+	t.Helper()
+	cfg := TLSOptions{PinnedSPKIHashes: pins}.Config()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	cfg.RootCAs = pool
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return &http.Client{Transport: &AgentTransport{Base: transport}, Timeout: 5 * time.Second}
+}
+
+func TestPinnedSPKI_AcceptsMatchingPin(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := pinnedClient(t, server, []string{"sha256/" + SPKIHash(server.Certificate())})
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestPinnedSPKI_RejectsMismatchedPin(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := pinnedClient(t, server, []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="})
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("expected ErrPinMismatch, got %v", err)
+	}
+}
+
+func TestTLSOptions_ZeroValueHasNoConfig(t *testing.T) {
+	if cfg := (TLSOptions{}).Config(); cfg != nil {
+		t.Fatalf("expected nil config, got %+v", cfg)
+	}
+}
+
+func TestCertReloader_MissingCertificateSendsNone(t *testing.T) {
+	dir := t.TempDir()
+	r := &certReloader{certPath: filepath.Join(dir, "agent.crt"), keyPath: filepath.Join(dir, "agent.key")}
+
+	cert, err := r.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cert.Certificate) != 0 {
+		t.Fatalf("expected empty certificate, got %d entries", len(cert.Certificate))
+	}
+}
+
+func TestCertReloader_ReloadsReplacedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "agent.crt")
+	keyPath := filepath.Join(dir, "agent.key")
+	key := writeSelfSignedPair(t, certPath, keyPath, "first", nil)
+
+	r := &certReloader{certPath: certPath, keyPath: keyPath}
+	first, err := r.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeSelfSignedPair(t, certPath, keyPath, "second", key)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(certPath, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	second, err := r.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(first.Certificate[0]) == string(second.Certificate[0]) {
+		t.Fatal("expected reloaded certificate to differ")
+	}
+}
+
+func TestCertReloader_ExpiredCertificateSendsNone(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "agent.crt")
+	keyPath := filepath.Join(dir, "agent.key")
+	writeSelfSignedPair(t, certPath, keyPath, "agent", nil)
+
+	now := time.Now()
+	r := &certReloader{certPath: certPath, keyPath: keyPath, now: func() time.Time { return now }}
+	cert, err := r.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cert.Certificate) == 0 {
+		t.Fatal("expected the valid certificate to be presented")
+	}
+
+	now = now.Add(2 * time.Hour)
+	cert, err = r.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cert.Certificate) != 0 {
+		t.Fatalf("expected no certificate once expired, got %d entries", len(cert.Certificate))
+	}
+}
+
+func writeSelfSignedPair(t *testing.T, certPath, keyPath, cn string, key *rsa.PrivateKey) *rsa.PrivateKey {
+	t.Helper()
+	if key == nil {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	if _, err := tls.LoadX509KeyPair(certPath, keyPath); err != nil {
+		t.Fatalf("load pair: %v", err)
+	}
+	return key
+}
@@ -30,10 +30,21 @@ func (t *AgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return base.RoundTrip(clone)
 }
 
-// NewClient returns an *http.Client configured with AgentTransport and the specified timeout.
+// NewClient returns an *http.Client configured with AgentTransport, the agent's
+// default TLS options and the specified timeout.
 func NewClient(timeout time.Duration) *http.Client {
+	return NewClientWithTLS(timeout, DefaultTLSOptions())
+}
+
+// NewClientWithTLS returns an *http.Client configured with AgentTransport and
+// the given TLS options.
+func NewClientWithTLS(timeout time.Duration, opts TLSOptions) *http.Client {
+	transport := &AgentTransport{}
+	if !opts.IsZero() {
+		transport.Base = NewTransport(opts)
+	}
 	return &http.Client{
-		Transport: &AgentTransport{},
+		Transport: transport,
 		Timeout:   timeout,
 	}
 }
@@ -2,7 +2,11 @@ package gorm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"hostlink/domain/agent"
+	"hostlink/domain/credential"
+	"hostlink/domain/secret"
 	"time"
 
 	"github.com/oklog/ulid/v2"
@@ -19,7 +23,8 @@ func NewAgentRepository(db *gorm.DB) agent.Repository {
 
 func (r *AgentRepository) Create(ctx context.Context, a *agent.Agent) error {
 	a.ID = "agt_" + ulid.Make().String()
-	a.Status = "active"
+	a.Status = agent.StatusOnline
+	a.Access = agent.AccessActive
 	a.RegisteredAt = time.Now()
 	a.LastSeen = time.Now()
 	return r.db.WithContext(ctx).Create(a).Error
@@ -35,6 +40,7 @@ func (r *AgentRepository) FindByFingerprint(ctx context.Context, fingerprint str
 	if err != nil {
 		return nil, err
 	}
+	a.Tags = agent.EffectiveTags(a.Tags)
 	return &a, nil
 }
 
@@ -44,6 +50,7 @@ func (r *AgentRepository) FindByID(ctx context.Context, id string) (*agent.Agent
 	if err != nil {
 		return nil, err
 	}
+	a.Tags = agent.EffectiveTags(a.Tags)
 	return &a, nil
 }
 
@@ -59,6 +66,246 @@ func (r *AgentRepository) GetPublicKeyByAgentID(ctx context.Context, agentID str
 	return a.PublicKey, nil
 }
 
+func (r *AgentRepository) GetPublicKeysByAgentID(ctx context.Context, agentID string, at time.Time) ([]string, error) {
+	var a agent.Agent
+	err := r.db.WithContext(ctx).Select("public_key", "previous_public_key", "previous_public_key_expires_at").
+		Where("id = ?", agentID).First(&a).Error
+	if err != nil {
+		return nil, err
+	}
+	if a.PublicKey == "" {
+		return nil, agent.ErrPublicKeyNotFound
+	}
+	return a.PublicKeys(at), nil
+}
+
+func (r *AgentRepository) GetAccessByAgentID(ctx context.Context, agentID string) (string, error) {
+	var a agent.Agent
+	err := r.db.WithContext(ctx).Select("access").Where("id = ?", agentID).First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", agent.ErrAgentNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if a.Access == "" {
+		return agent.AccessActive, nil
+	}
+	return a.Access, nil
+}
+
+// SetAccess moves the agent to change.Access. It returns
+// agent.ErrAgentNotFound when no agent has the ID, and agent.ErrAgentRevoked
+// when the agent is revoked and the change would restore it.
+func (r *AgentRepository) SetAccess(ctx context.Context, change agent.AccessChange) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var a agent.Agent
+		err := tx.Select("id", "access").Where("id = ?", change.AgentID).First(&a).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return agent.ErrAgentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if a.Access == agent.AccessRevoked && change.Access != agent.AccessRevoked {
+			return agent.ErrAgentRevoked
+		}
+
+		return tx.Model(&agent.Agent{}).Where("id = ?", change.AgentID).
+			Updates(map[string]any{
+				"access":            change.Access,
+				"access_reason":     change.Reason,
+				"access_changed_at": change.At,
+			}).Error
+	})
+}
+
+// RotateKey replaces the agent's key, as long as it is still
+// rotation.OldPublicKey, together with the credential passwords encrypted
+// for it. It returns agent.ErrKeyChanged when the key was replaced
+// meanwhile, agent.ErrCredentialsChanged unless rotation.Credentials
+// re-encrypt exactly the agent's current passwords, and
+// agent.ErrSecretsChanged unless rotation.Secrets re-seal exactly its
+// current secrets.
+func (r *AgentRepository) RotateKey(ctx context.Context, rotation *agent.KeyRotation) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var a agent.Agent
+		err := tx.Select("id", "fingerprint").Where("id = ?", rotation.AgentID).First(&a).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return agent.ErrAgentNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&agent.Agent{}).
+			Where("id = ? AND public_key = ?", rotation.AgentID, rotation.OldPublicKey).
+			Updates(map[string]any{
+				"public_key":                     rotation.PublicKey,
+				"public_key_type":                rotation.PublicKeyType,
+				"previous_public_key":            rotation.OldPublicKey,
+				"previous_public_key_expires_at": rotation.PreviousValidUntil,
+				"key_rotated_at":                 rotation.RotatedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return agent.ErrKeyChanged
+		}
+
+		var stored int64
+		err = tx.Model(&credential.Credential{}).
+			Where("agent_id = ? AND deleted_at IS NULL AND passwd_enc <> ''", rotation.AgentID).
+			Count(&stored).Error
+		if err != nil {
+			return err
+		}
+		if stored != int64(len(rotation.Credentials)) {
+			return agent.ErrCredentialsChanged
+		}
+		for _, cred := range rotation.Credentials {
+			result := tx.Model(&credential.Credential{}).
+				Where("id = ? AND agent_id = ? AND deleted_at IS NULL AND passwd_enc = ?", cred.ID, rotation.AgentID, cred.PreviousPasswdEnc).
+				Update("passwd_enc", cred.PasswdEnc)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return agent.ErrCredentialsChanged
+			}
+		}
+
+		var secrets int64
+		if err := tx.Model(&secret.Secret{}).Where("agent_id = ?", rotation.AgentID).Count(&secrets).Error; err != nil {
+			return err
+		}
+		if secrets != int64(len(rotation.Secrets)) {
+			return agent.ErrSecretsChanged
+		}
+		for _, s := range rotation.Secrets {
+			result := tx.Model(&secret.Secret{}).
+				Where("id = ? AND agent_id = ? AND value_enc = ?", s.ID, rotation.AgentID, s.PreviousValueEnc).
+				Update("value_enc", s.ValueEnc)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return agent.ErrSecretsChanged
+			}
+		}
+
+		return tx.Create(&agent.AgentRegistration{
+			ID:          "agr_" + ulid.Make().String(),
+			AgentID:     rotation.AgentID,
+			Fingerprint: a.Fingerprint,
+			Event:       agent.EventKeyRotation,
+			Success:     true,
+		}).Error
+	})
+}
+
+// RecordHeartbeat marks the agent online and seen at seenAt. It returns
+// agent.ErrAgentNotFound when no agent has the given ID.
+func (r *AgentRepository) RecordHeartbeat(ctx context.Context, agentID string, seenAt time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var a agent.Agent
+		err := tx.Select("id", "status").Where("id = ?", agentID).First(&a).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return agent.ErrAgentNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&agent.Agent{}).Where("id = ?", agentID).
+			Updates(map[string]any{"last_seen": seenAt, "status": agent.StatusOnline}).Error
+		if err != nil {
+			return err
+		}
+		if a.Status == agent.StatusOnline {
+			return nil
+		}
+		return tx.Create(&agent.StatusEvent{
+			AgentID:  agentID,
+			From:     a.Status,
+			To:       agent.StatusOnline,
+			Reason:   "heartbeat",
+			LastSeen: seenAt,
+		}).Error
+	})
+}
+
+// MarkStatus moves every agent in one of the from states that has not been
+// seen since seenBefore to status to. The update re-checks both conditions,
+// so a heartbeat racing the sweep is never overwritten.
+func (r *AgentRepository) MarkStatus(ctx context.Context, from []string, to string, seenBefore time.Time, reason string) ([]agent.StatusEvent, error) {
+	var events []agent.StatusEvent
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var candidates []agent.Agent
+		err := tx.Select("id", "status", "last_seen").
+			Where("status IN ? AND last_seen < ?", from, seenBefore).Find(&candidates).Error
+		if err != nil {
+			return err
+		}
+
+		for _, a := range candidates {
+			result := tx.Model(&agent.Agent{}).
+				Where("id = ? AND status = ? AND last_seen < ?", a.ID, a.Status, seenBefore).
+				Update("status", to)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			event := agent.StatusEvent{
+				AgentID:  a.ID,
+				From:     a.Status,
+				To:       to,
+				Reason:   reason,
+				LastSeen: a.LastSeen,
+			}
+			if err := tx.Create(&event).Error; err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *AgentRepository) FindStatusEvents(ctx context.Context, agentID string, limit int) ([]agent.StatusEvent, error) {
+	events := []agent.StatusEvent{}
+	query := r.db.WithContext(ctx).Where("agent_id = ?", agentID).Order("created_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// MigrateAgentTags adds the source column to a tag table from before tag
+// sources were recorded. Agents chose every tag stored until then, so the
+// existing tags become agent tags; server tags have to be set again.
+func MigrateAgentTags(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&agent.AgentTag{}) || db.Migrator().HasColumn(&agent.AgentTag{}, "Source") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&agent.AgentTag{}, "Source"); err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE agent_tags SET source = ?", agent.TagSourceAgent).Error
+	})
+}
+
 func (r *AgentRepository) AddTags(ctx context.Context, agentID string, tags []agent.AgentTag) error {
 	for i := range tags {
 		tags[i].AgentID = agentID
@@ -66,13 +313,83 @@ func (r *AgentRepository) AddTags(ctx context.Context, agentID string, tags []ag
 	return r.db.WithContext(ctx).Create(&tags).Error
 }
 
-func (r *AgentRepository) UpdateTags(ctx context.Context, agentID string, tags []agent.AgentTag) error {
-	// Delete existing tags
-	if err := r.db.WithContext(ctx).Where("agent_id = ?", agentID).Delete(&agent.AgentTag{}).Error; err != nil {
+func (r *AgentRepository) FindTags(ctx context.Context, agentID string) ([]agent.AgentTag, error) {
+	if err := r.agentExists(r.db.WithContext(ctx), agentID); err != nil {
+		return nil, err
+	}
+	tags := []agent.AgentTag{}
+	err := r.db.WithContext(ctx).Where("agent_id = ?", agentID).Order("key, source DESC").Find(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (r *AgentRepository) SetTag(ctx context.Context, agentID, key, value string) (*agent.AgentTag, error) {
+	var tag agent.AgentTag
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := r.agentExists(tx, agentID); err != nil {
+			return err
+		}
+		err := tx.Where("agent_id = ? AND key = ? AND source = ?", agentID, key, agent.TagSourceServer).First(&tag).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			tag = agent.AgentTag{AgentID: agentID, Key: key, Value: value, Source: agent.TagSourceServer}
+			return tx.Create(&tag).Error
+		}
+		if err != nil {
+			return err
+		}
+		tag.Value = value
+		return tx.Save(&tag).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (r *AgentRepository) DeleteTag(ctx context.Context, agentID, key string) error {
+	result := r.db.WithContext(ctx).
+		Where("agent_id = ? AND key = ? AND source = ?", agentID, key, agent.TagSourceServer).
+		Delete(&agent.AgentTag{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return agent.ErrTagNotFound
+	}
+	return nil
+}
+
+func (r *AgentRepository) SetDeclaredTags(ctx context.Context, agentID string, tags []agent.AgentTag) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := r.agentExists(tx, agentID); err != nil {
+			return err
+		}
+		if err := tx.Where("agent_id = ? AND source = ?", agentID, agent.TagSourceAgent).Delete(&agent.AgentTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		declared := make([]agent.AgentTag, len(tags))
+		for i, tag := range tags {
+			declared[i] = agent.AgentTag{AgentID: agentID, Key: tag.Key, Value: tag.Value, Source: agent.TagSourceAgent}
+		}
+		return tx.Create(&declared).Error
+	})
+}
+
+// agentExists returns agent.ErrAgentNotFound unless the agent exists.
+func (r *AgentRepository) agentExists(db *gorm.DB, agentID string) error {
+	var count int64
+	if err := db.Model(&agent.Agent{}).Where("id = ?", agentID).Count(&count).Error; err != nil {
 		return err
 	}
-	// Add new tags
-	return r.AddTags(ctx, agentID, tags)
+	if count == 0 {
+		return agent.ErrAgentNotFound
+	}
+	return nil
 }
 
 func (r *AgentRepository) AddRegistration(ctx context.Context, reg *agent.AgentRegistration) error {
@@ -80,6 +397,127 @@ func (r *AgentRepository) AddRegistration(ctx context.Context, reg *agent.AgentR
 	return r.db.WithContext(ctx).Create(reg).Error
 }
 
+func (r *AgentRepository) FindHardwareSnapshot(ctx context.Context, agentID string) (string, error) {
+	var registrations []agent.AgentRegistration
+	err := r.db.WithContext(ctx).Select("hardware_snapshot").
+		Where("agent_id = ? AND success = ? AND hardware_snapshot <> ''", agentID, true).
+		Order("created_at DESC, id DESC").Limit(1).Find(&registrations).Error
+	if err != nil || len(registrations) == 0 {
+		return "", err
+	}
+	return registrations[0].HardwareSnapshot, nil
+}
+
+func (r *AgentRepository) CreatePendingRegistration(ctx context.Context, p *agent.PendingRegistration) error {
+	p.ID = "reg_" + ulid.Make().String()
+	p.Status = agent.ApprovalPending
+	tagList, err := encodeTags(p.Tags)
+	if err != nil {
+		return err
+	}
+	p.TagList = tagList
+	return r.db.WithContext(ctx).Create(p).Error
+}
+
+func (r *AgentRepository) FindPendingRegistration(ctx context.Context, id string) (*agent.PendingRegistration, error) {
+	return r.findPendingRegistration(ctx, "id = ?", id)
+}
+
+func (r *AgentRepository) FindPendingRegistrationByFingerprint(ctx context.Context, fingerprint string) (*agent.PendingRegistration, error) {
+	return r.findPendingRegistration(ctx, "fingerprint = ? AND status = ?", fingerprint, agent.ApprovalPending)
+}
+
+func (r *AgentRepository) findPendingRegistration(ctx context.Context, query string, args ...any) (*agent.PendingRegistration, error) {
+	var p agent.PendingRegistration
+	err := r.db.WithContext(ctx).Where(query, args...).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, agent.ErrPendingRegistrationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Tags, err = decodeTags(p.TagList); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *AgentRepository) FindPendingRegistrations(ctx context.Context, status string) ([]agent.PendingRegistration, error) {
+	pending := []agent.PendingRegistration{}
+	query := r.db.WithContext(ctx).Order("created_at DESC, id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&pending).Error; err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		tags, err := decodeTags(pending[i].TagList)
+		if err != nil {
+			return nil, err
+		}
+		pending[i].Tags = tags
+	}
+	return pending, nil
+}
+
+// ResolvePendingRegistration moves the registration to p.Status, approved
+// as p.AgentID, as long as it still awaits approval. It returns
+// agent.ErrPendingRegistrationNotFound when no registration has the ID.
+func (r *AgentRepository) ResolvePendingRegistration(ctx context.Context, p *agent.PendingRegistration) error {
+	result := r.db.WithContext(ctx).Model(&agent.PendingRegistration{}).
+		Where("id = ? AND status = ?", p.ID, agent.ApprovalPending).
+		Updates(map[string]any{
+			"status":      p.Status,
+			"agent_id":    p.AgentID,
+			"resolved_at": p.ResolvedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	if _, err := r.FindPendingRegistration(ctx, p.ID); err != nil {
+		return err
+	}
+	return agent.ErrRegistrationResolved
+}
+
+// tagPair is how a held registration stores its tags.
+type tagPair struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source,omitempty"`
+}
+
+func encodeTags(tags []agent.AgentTag) (string, error) {
+	pairs := make([]tagPair, len(tags))
+	for i, tag := range tags {
+		pairs[i] = tagPair{Key: tag.Key, Value: tag.Value, Source: tag.Source}
+	}
+	data, err := json.Marshal(pairs)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func decodeTags(list string) ([]agent.AgentTag, error) {
+	tags := []agent.AgentTag{}
+	if list == "" {
+		return tags, nil
+	}
+	var pairs []tagPair
+	if err := json.Unmarshal([]byte(list), &pairs); err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		tags = append(tags, agent.AgentTag{Key: pair.Key, Value: pair.Value, Source: pair.Source})
+	}
+	return tags, nil
+}
+
 func (r *AgentRepository) FindAll(ctx context.Context, filters agent.AgentFilters) ([]agent.Agent, error) {
 	var agents []agent.Agent
 
@@ -93,14 +531,25 @@ func (r *AgentRepository) FindAll(ctx context.Context, filters agent.AgentFilter
 		query = query.Where("fingerprint = ?", *filters.Fingerprint)
 	}
 
+	if filters.MachineID != nil {
+		query = query.Where("machine_id = ?", *filters.MachineID)
+	}
+
 	err := query.Order("last_seen DESC").Find(&agents).Error
 	if err != nil {
 		return nil, err
 	}
+	for i := range agents {
+		agents[i].Tags = agent.EffectiveTags(agents[i].Tags)
+	}
 
 	return agents, nil
 }
 
+func (r *AgentRepository) ConsumeEnrollmentToken(ctx context.Context, tokenID string, now time.Time) error {
+	return (&EnrollmentRepository{db: r.db}).Consume(ctx, tokenID, now)
+}
+
 func (r *AgentRepository) Transaction(ctx context.Context, fn func(agent.Repository) error) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		txRepo := &AgentRepository{db: tx}
@@ -3,6 +3,8 @@ package gorm
 import (
 	"context"
 	"hostlink/domain/agent"
+	"hostlink/domain/credential"
+	"hostlink/domain/secret"
 	"testing"
 	"time"
 
@@ -16,7 +18,7 @@ func setupAgentTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
-	err = db.AutoMigrate(&agent.Agent{}, &agent.AgentTag{}, &agent.AgentRegistration{})
+	err = db.AutoMigrate(&agent.Agent{}, &agent.AgentTag{}, &agent.AgentRegistration{}, &agent.StatusEvent{}, &agent.PendingRegistration{})
 	require.NoError(t, err)
 
 	return db
@@ -38,7 +40,7 @@ func TestAgentRepository(t *testing.T) {
 		err := repo.Create(ctx, a)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, a.ID)
-		assert.Equal(t, "active", a.Status)
+		assert.Equal(t, agent.StatusOnline, a.Status)
 		assert.NotZero(t, a.RegisteredAt)
 		assert.NotZero(t, a.LastSeen)
 	})
@@ -141,44 +143,84 @@ func TestAgentRepository(t *testing.T) {
 		assert.Len(t, found.Tags, 2)
 	})
 
-	t.Run("UpdateTags", func(t *testing.T) {
+	t.Run("SetTag", func(t *testing.T) {
 		db := setupAgentTestDB(t)
 		repo := NewAgentRepository(db)
 		ctx := context.Background()
 
-		a := &agent.Agent{
-			Fingerprint: "test-fingerprint",
-			Hostname:    "test-host",
-			IPAddress:   "192.168.1.100",
-			MACAddress:  "00:11:22:33:44:55",
-		}
-		err := repo.Create(ctx, a)
+		a := &agent.Agent{Fingerprint: "test-fingerprint"}
+		require.NoError(t, repo.Create(ctx, a))
+		require.NoError(t, repo.AddTags(ctx, a.ID, []agent.AgentTag{{Key: "env", Value: "dev"}}))
+
+		tag, err := repo.SetTag(ctx, a.ID, "env", "prod")
+		require.NoError(t, err)
+		assert.Equal(t, agent.TagSourceServer, tag.Source)
+		_, err = repo.SetTag(ctx, a.ID, "team", "platform")
 		require.NoError(t, err)
 
-		initialTags := []agent.AgentTag{
-			{Key: "env", Value: "dev"},
-			{Key: "region", Value: "us-west-1"},
-		}
-		err = repo.AddTags(ctx, a.ID, initialTags)
+		tags, err := repo.FindTags(ctx, a.ID)
 		require.NoError(t, err)
+		require.Len(t, tags, 2)
+		assert.Equal(t, "env", tags[0].Key)
+		assert.Equal(t, "prod", tags[0].Value)
+		assert.Equal(t, "team", tags[1].Key)
 
-		newTags := []agent.AgentTag{
-			{Key: "env", Value: "prod"},
-			{Key: "team", Value: "platform"},
-		}
-		err = repo.UpdateTags(ctx, a.ID, newTags)
-		assert.NoError(t, err)
+		_, err = repo.SetTag(ctx, "agt_missing", "env", "prod")
+		assert.ErrorIs(t, err, agent.ErrAgentNotFound)
+	})
 
-		found, err := repo.FindByID(ctx, a.ID)
-		assert.NoError(t, err)
-		assert.Len(t, found.Tags, 2)
+	t.Run("DeleteTag", func(t *testing.T) {
+		db := setupAgentTestDB(t)
+		repo := NewAgentRepository(db)
+		ctx := context.Background()
+
+		a := &agent.Agent{Fingerprint: "test-fingerprint"}
+		require.NoError(t, repo.Create(ctx, a))
+		_, err := repo.SetTag(ctx, a.ID, "env", "prod")
+		require.NoError(t, err)
+		require.NoError(t, repo.SetDeclaredTags(ctx, a.ID, []agent.AgentTag{{Key: "role", Value: "web"}}))
 
-		tagMap := make(map[string]string)
+		require.NoError(t, repo.DeleteTag(ctx, a.ID, "env"))
+		assert.ErrorIs(t, repo.DeleteTag(ctx, a.ID, "env"), agent.ErrTagNotFound)
+		assert.ErrorIs(t, repo.DeleteTag(ctx, a.ID, "role"), agent.ErrTagNotFound, "agent tags are not deleted")
+
+		tags, err := repo.FindTags(ctx, a.ID)
+		require.NoError(t, err)
+		require.Len(t, tags, 1)
+		assert.Equal(t, "role", tags[0].Key)
+	})
+
+	t.Run("SetDeclaredTags", func(t *testing.T) {
+		db := setupAgentTestDB(t)
+		repo := NewAgentRepository(db)
+		ctx := context.Background()
+
+		a := &agent.Agent{Fingerprint: "test-fingerprint"}
+		require.NoError(t, repo.Create(ctx, a))
+		_, err := repo.SetTag(ctx, a.ID, "env", "prod")
+		require.NoError(t, err)
+		require.NoError(t, repo.SetDeclaredTags(ctx, a.ID, []agent.AgentTag{
+			{Key: "env", Value: "dev"},
+			{Key: "role", Value: "web"},
+		}))
+		require.NoError(t, repo.SetDeclaredTags(ctx, a.ID, []agent.AgentTag{
+			{Key: "env", Value: "dev"},
+			{Key: "rack", Value: "r12"},
+		}))
+
+		tags, err := repo.FindTags(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Len(t, tags, 3, "declared tags are replaced, server tags kept")
+
+		found, err := repo.FindByID(ctx, a.ID)
+		require.NoError(t, err)
+		effective := make(map[string]string)
 		for _, tag := range found.Tags {
-			tagMap[tag.Key] = tag.Value
+			effective[tag.Key] = tag.Value
 		}
-		assert.Equal(t, "prod", tagMap["env"])
-		assert.Equal(t, "platform", tagMap["team"])
+		assert.Equal(t, map[string]string{"env": "prod", "rack": "r12"}, effective, "the server tag shadows the declared one")
+
+		assert.ErrorIs(t, repo.SetDeclaredTags(ctx, "agt_missing", nil), agent.ErrAgentNotFound)
 	})
 
 	t.Run("AddRegistration", func(t *testing.T) {
@@ -316,6 +358,267 @@ func TestGetPublicKeyByAgentID(t *testing.T) {
 	})
 }
 
+func TestGetPublicKeysByAgentID(t *testing.T) {
+	db := setupAgentTestDB(t)
+	repo := NewAgentRepository(db)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+	a := &agent.Agent{Fingerprint: "keys-fingerprint", PublicKey: "new-key"}
+	require.NoError(t, repo.Create(ctx, a))
+
+	keys, err := repo.GetPublicKeysByAgentID(ctx, a.ID, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-key"}, keys)
+
+	require.NoError(t, db.Model(&agent.Agent{}).Where("id = ?", a.ID).Updates(map[string]any{
+		"previous_public_key":            "old-key",
+		"previous_public_key_expires_at": expiresAt,
+	}).Error)
+
+	keys, err = repo.GetPublicKeysByAgentID(ctx, a.ID, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-key", "old-key"}, keys)
+
+	keys, err = repo.GetPublicKeysByAgentID(ctx, a.ID, expiresAt.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-key"}, keys, "the previous key expires")
+
+	_, err = repo.GetPublicKeysByAgentID(ctx, "agt_nonexistent", time.Now())
+	assert.Error(t, err)
+}
+
+func TestSetAccess(t *testing.T) {
+	t.Run("should quarantine and release an agent", func(t *testing.T) {
+		db := setupAgentTestDB(t)
+		repo := NewAgentRepository(db)
+		ctx := context.Background()
+		a := &agent.Agent{Fingerprint: "access-fingerprint"}
+		require.NoError(t, repo.Create(ctx, a))
+
+		access, err := repo.GetAccessByAgentID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent.AccessActive, access)
+
+		now := time.Now()
+		require.NoError(t, repo.SetAccess(ctx, agent.AccessChange{AgentID: a.ID, Access: agent.AccessQuarantined, Reason: "investigating", At: now}))
+		found, err := repo.FindByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent.AccessQuarantined, found.Access)
+		assert.Equal(t, "investigating", found.AccessReason)
+		require.NotNil(t, found.AccessChangedAt)
+		assert.WithinDuration(t, now, *found.AccessChangedAt, time.Second)
+
+		require.NoError(t, repo.SetAccess(ctx, agent.AccessChange{AgentID: a.ID, Access: agent.AccessActive, At: now}))
+		access, err = repo.GetAccessByAgentID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent.AccessActive, access)
+	})
+
+	t.Run("should keep a revoked agent revoked", func(t *testing.T) {
+		db := setupAgentTestDB(t)
+		repo := NewAgentRepository(db)
+		ctx := context.Background()
+		a := &agent.Agent{Fingerprint: "revoked-fingerprint"}
+		require.NoError(t, repo.Create(ctx, a))
+		require.NoError(t, repo.SetAccess(ctx, agent.AccessChange{AgentID: a.ID, Access: agent.AccessRevoked, At: time.Now()}))
+
+		err := repo.SetAccess(ctx, agent.AccessChange{AgentID: a.ID, Access: agent.AccessActive, At: time.Now()})
+		assert.ErrorIs(t, err, agent.ErrAgentRevoked)
+		err = repo.SetAccess(ctx, agent.AccessChange{AgentID: a.ID, Access: agent.AccessQuarantined, At: time.Now()})
+		assert.ErrorIs(t, err, agent.ErrAgentRevoked)
+
+		access, err := repo.GetAccessByAgentID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent.AccessRevoked, access)
+	})
+
+	t.Run("should return ErrAgentNotFound for unknown agents", func(t *testing.T) {
+		repo := NewAgentRepository(setupAgentTestDB(t))
+
+		err := repo.SetAccess(context.Background(), agent.AccessChange{AgentID: "agt_missing", Access: agent.AccessRevoked})
+		assert.ErrorIs(t, err, agent.ErrAgentNotFound)
+		_, err = repo.GetAccessByAgentID(context.Background(), "agt_missing")
+		assert.ErrorIs(t, err, agent.ErrAgentNotFound)
+	})
+}
+
+func TestPendingRegistrations(t *testing.T) {
+	t.Run("should store a held registration with its tags", func(t *testing.T) {
+		repo := NewAgentRepository(setupAgentTestDB(t))
+		ctx := context.Background()
+		p := &agent.PendingRegistration{
+			Fingerprint:      "held-fingerprint",
+			CandidateAgentID: "agt_candidate",
+			Tags:             []agent.AgentTag{{Key: "env", Value: "prod,eu"}},
+		}
+
+		require.NoError(t, repo.CreatePendingRegistration(ctx, p))
+
+		assert.Contains(t, p.ID, "reg_")
+		found, err := repo.FindPendingRegistrationByFingerprint(ctx, "held-fingerprint")
+		require.NoError(t, err)
+		assert.Equal(t, p.ID, found.ID)
+		assert.Equal(t, agent.ApprovalPending, found.Status)
+		require.Len(t, found.Tags, 1)
+		assert.Equal(t, "prod,eu", found.Tags[0].Value)
+		listed, err := repo.FindPendingRegistrations(ctx, agent.ApprovalPending)
+		require.NoError(t, err)
+		assert.Len(t, listed, 1)
+	})
+
+	t.Run("should resolve a registration once", func(t *testing.T) {
+		repo := NewAgentRepository(setupAgentTestDB(t))
+		ctx := context.Background()
+		p := &agent.PendingRegistration{Fingerprint: "held-fingerprint"}
+		require.NoError(t, repo.CreatePendingRegistration(ctx, p))
+		now := time.Now()
+
+		p.Status, p.AgentID, p.ResolvedAt = agent.ApprovalNew, "agt_new", &now
+		require.NoError(t, repo.ResolvePendingRegistration(ctx, p))
+
+		assert.ErrorIs(t, repo.ResolvePendingRegistration(ctx, p), agent.ErrRegistrationResolved)
+		_, err := repo.FindPendingRegistrationByFingerprint(ctx, "held-fingerprint")
+		assert.ErrorIs(t, err, agent.ErrPendingRegistrationNotFound, "a resolved registration no longer holds the fingerprint")
+		resolved, err := repo.FindPendingRegistration(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "agt_new", resolved.AgentID)
+		listed, err := repo.FindPendingRegistrations(ctx, agent.ApprovalPending)
+		require.NoError(t, err)
+		assert.Empty(t, listed)
+		p.ID = "reg_missing"
+		assert.ErrorIs(t, repo.ResolvePendingRegistration(ctx, p), agent.ErrPendingRegistrationNotFound)
+	})
+
+	t.Run("should find the latest recorded hardware snapshot", func(t *testing.T) {
+		repo := NewAgentRepository(setupAgentTestDB(t))
+		ctx := context.Background()
+
+		snapshot, err := repo.FindHardwareSnapshot(ctx, "agt_1")
+		require.NoError(t, err)
+		assert.Empty(t, snapshot)
+
+		require.NoError(t, repo.AddRegistration(ctx, &agent.AgentRegistration{AgentID: "agt_1", Success: true, HardwareSnapshot: "first"}))
+		require.NoError(t, repo.AddRegistration(ctx, &agent.AgentRegistration{AgentID: "agt_1", Success: true, HardwareSnapshot: "second"}))
+		require.NoError(t, repo.AddRegistration(ctx, &agent.AgentRegistration{AgentID: "agt_1", Success: false, HardwareSnapshot: "held"}))
+		require.NoError(t, repo.AddRegistration(ctx, &agent.AgentRegistration{AgentID: "agt_1", Success: true}))
+
+		snapshot, err = repo.FindHardwareSnapshot(ctx, "agt_1")
+		require.NoError(t, err)
+		assert.Equal(t, "second", snapshot)
+	})
+}
+
+func TestRotateKey(t *testing.T) {
+	setup := func(t *testing.T) (*gorm.DB, agent.Repository, *agent.Agent, *credential.Credential) {
+		db := setupAgentTestDB(t)
+		require.NoError(t, db.AutoMigrate(&credential.Credential{}, &secret.Secret{}))
+		repo := NewAgentRepository(db)
+		a := &agent.Agent{Fingerprint: "rotate-fingerprint", PublicKey: "old-key", PublicKeyType: "rsa"}
+		require.NoError(t, repo.Create(context.Background(), a))
+		credRepo := NewCredentialRepository(db)
+		cred := &credential.Credential{AgentID: a.ID, Dialect: "postgresql", PasswdEnc: "under-old-key"}
+		require.NoError(t, credRepo.Create(context.Background(), cred))
+		require.NoError(t, credRepo.Create(context.Background(), &credential.Credential{AgentID: a.ID, Dialect: "redis"}))
+		return db, repo, a, cred
+	}
+	rotation := func(a *agent.Agent, creds ...agent.CredentialKey) *agent.KeyRotation {
+		now := time.Now()
+		return &agent.KeyRotation{
+			AgentID:            a.ID,
+			OldPublicKey:       "old-key",
+			PublicKey:          "new-key",
+			PublicKeyType:      "rsa",
+			RotatedAt:          now,
+			PreviousValidUntil: now.Add(time.Hour),
+			Credentials:        creds,
+		}
+	}
+
+	t.Run("replaces the key and credential passwords", func(t *testing.T) {
+		db, repo, a, cred := setup(t)
+		ctx := context.Background()
+
+		err := repo.RotateKey(ctx, rotation(a, agent.CredentialKey{ID: cred.ID, PreviousPasswdEnc: "under-old-key", PasswdEnc: "under-new-key"}))
+
+		require.NoError(t, err)
+		found, err := repo.FindByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "new-key", found.PublicKey)
+		assert.Equal(t, "old-key", found.PreviousPublicKey)
+		require.NotNil(t, found.PreviousPublicKeyExpiresAt)
+		assert.NotNil(t, found.KeyRotatedAt)
+		var stored credential.Credential
+		require.NoError(t, db.Where("id = ?", cred.ID).First(&stored).Error)
+		assert.Equal(t, "under-new-key", stored.PasswdEnc)
+		var registrations []agent.AgentRegistration
+		require.NoError(t, db.Where("agent_id = ?", a.ID).Find(&registrations).Error)
+		require.Len(t, registrations, 1)
+		assert.Equal(t, agent.EventKeyRotation, registrations[0].Event)
+		assert.Equal(t, "rotate-fingerprint", registrations[0].Fingerprint)
+	})
+
+	t.Run("fails when the key changed meanwhile", func(t *testing.T) {
+		_, repo, a, cred := setup(t)
+		r := rotation(a, agent.CredentialKey{ID: cred.ID, PreviousPasswdEnc: "under-old-key", PasswdEnc: "under-new-key"})
+		r.OldPublicKey = "other-key"
+
+		err := repo.RotateKey(context.Background(), r)
+
+		assert.ErrorIs(t, err, agent.ErrKeyChanged)
+	})
+
+	t.Run("rolls back when a password is missing or changed", func(t *testing.T) {
+		db, repo, a, cred := setup(t)
+		ctx := context.Background()
+
+		err := repo.RotateKey(ctx, rotation(a))
+		assert.ErrorIs(t, err, agent.ErrCredentialsChanged)
+
+		err = repo.RotateKey(ctx, rotation(a, agent.CredentialKey{ID: cred.ID, PreviousPasswdEnc: "stale", PasswdEnc: "under-new-key"}))
+		assert.ErrorIs(t, err, agent.ErrCredentialsChanged)
+
+		found, err := repo.FindByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "old-key", found.PublicKey)
+		var registrations int64
+		require.NoError(t, db.Model(&agent.AgentRegistration{}).Count(&registrations).Error)
+		assert.Zero(t, registrations)
+	})
+
+	t.Run("re-seals secrets and rolls back when one is missing or changed", func(t *testing.T) {
+		db, repo, a, cred := setup(t)
+		ctx := context.Background()
+		s := &secret.Secret{AgentID: a.ID, Name: "token", ValueEnc: "secret-under-old-key"}
+		require.NoError(t, NewSecretRepository(db).Save(ctx, s))
+		credKey := agent.CredentialKey{ID: cred.ID, PreviousPasswdEnc: "under-old-key", PasswdEnc: "under-new-key"}
+
+		err := repo.RotateKey(ctx, rotation(a, credKey))
+		assert.ErrorIs(t, err, agent.ErrSecretsChanged)
+
+		r := rotation(a, credKey)
+		r.Secrets = []agent.SecretKey{{ID: s.ID, PreviousValueEnc: "stale", ValueEnc: "secret-under-new-key"}}
+		err = repo.RotateKey(ctx, r)
+		assert.ErrorIs(t, err, agent.ErrSecretsChanged)
+		var stored credential.Credential
+		require.NoError(t, db.Where("id = ?", cred.ID).First(&stored).Error)
+		assert.Equal(t, "under-old-key", stored.PasswdEnc)
+
+		r.Secrets[0].PreviousValueEnc = "secret-under-old-key"
+		require.NoError(t, repo.RotateKey(ctx, r))
+		found, err := NewSecretRepository(db).FindByName(ctx, a.ID, "token")
+		require.NoError(t, err)
+		assert.Equal(t, "secret-under-new-key", found.ValueEnc)
+	})
+
+	t.Run("returns ErrAgentNotFound for unknown agents", func(t *testing.T) {
+		_, repo, _, _ := setup(t)
+
+		err := repo.RotateKey(context.Background(), rotation(&agent.Agent{ID: "agt_missing"}))
+
+		assert.ErrorIs(t, err, agent.ErrAgentNotFound)
+	})
+}
+
 func TestFindAll(t *testing.T) {
 	t.Run("returns all agents without filters", func(t *testing.T) {
 		db := setupAgentTestDB(t)
@@ -366,11 +669,11 @@ func TestFindAll(t *testing.T) {
 		inactiveAgent.Status = "inactive"
 		require.NoError(t, repo.Update(ctx, inactiveAgent))
 
-		activeStatus := "active"
+		activeStatus := agent.StatusOnline
 		agents, err := repo.FindAll(ctx, agent.AgentFilters{Status: &activeStatus})
 		assert.NoError(t, err)
 		assert.Len(t, agents, 1)
-		assert.Equal(t, "active", agents[0].Status)
+		assert.Equal(t, agent.StatusOnline, agents[0].Status)
 	})
 
 	t.Run("filters agents by fingerprint", func(t *testing.T) {
@@ -424,7 +727,7 @@ func TestFindAll(t *testing.T) {
 		agent2.Status = "inactive"
 		require.NoError(t, repo.Update(ctx, agent2))
 
-		activeStatus := "active"
+		activeStatus := agent.StatusOnline
 		fingerprint := "fp-001"
 		agents, err := repo.FindAll(ctx, agent.AgentFilters{
 			Status:      &activeStatus,
@@ -433,7 +736,7 @@ func TestFindAll(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Len(t, agents, 1)
 		assert.Equal(t, "fp-001", agents[0].Fingerprint)
-		assert.Equal(t, "active", agents[0].Status)
+		assert.Equal(t, agent.StatusOnline, agents[0].Status)
 	})
 
 	t.Run("returns empty slice when no agents match filters", func(t *testing.T) {
@@ -525,3 +828,128 @@ func TestFindAll(t *testing.T) {
 		assert.Equal(t, "fp-001", agents[2].Fingerprint)
 	})
 }
+
+func TestRecordHeartbeat(t *testing.T) {
+	t.Run("should mark agent online and record the transition", func(t *testing.T) {
+		db := setupAgentTestDB(t)
+		repo := NewAgentRepository(db)
+		ctx := context.Background()
+
+		a := &agent.Agent{Fingerprint: "heartbeat-fingerprint"}
+		require.NoError(t, repo.Create(ctx, a))
+		a.Status = agent.StatusOffline
+		require.NoError(t, repo.Update(ctx, a))
+
+		seenAt := time.Now().Add(time.Hour)
+		require.NoError(t, repo.RecordHeartbeat(ctx, a.ID, seenAt))
+
+		found, err := repo.FindByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent.StatusOnline, found.Status)
+		assert.WithinDuration(t, seenAt, found.LastSeen, time.Second)
+
+		events, err := repo.FindStatusEvents(ctx, a.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, agent.StatusOffline, events[0].From)
+		assert.Equal(t, agent.StatusOnline, events[0].To)
+		assert.Equal(t, "heartbeat", events[0].Reason)
+	})
+
+	t.Run("should not record an event for an online agent", func(t *testing.T) {
+		db := setupAgentTestDB(t)
+		repo := NewAgentRepository(db)
+		ctx := context.Background()
+
+		a := &agent.Agent{Fingerprint: "online-fingerprint"}
+		require.NoError(t, repo.Create(ctx, a))
+		require.NoError(t, repo.RecordHeartbeat(ctx, a.ID, time.Now()))
+
+		events, err := repo.FindStatusEvents(ctx, a.ID, 0)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("should return ErrAgentNotFound for unknown agent", func(t *testing.T) {
+		db := setupAgentTestDB(t)
+		repo := NewAgentRepository(db)
+
+		err := repo.RecordHeartbeat(context.Background(), "agt_missing", time.Now())
+		assert.ErrorIs(t, err, agent.ErrAgentNotFound)
+	})
+}
+
+func TestMarkStatus(t *testing.T) {
+	t.Run("should move silent agents and record events", func(t *testing.T) {
+		db := setupAgentTestDB(t)
+		repo := NewAgentRepository(db)
+		ctx := context.Background()
+		now := time.Now()
+
+		silent := &agent.Agent{Fingerprint: "fp-silent"}
+		require.NoError(t, repo.Create(ctx, silent))
+		require.NoError(t, repo.RecordHeartbeat(ctx, silent.ID, now.Add(-5*time.Minute)))
+
+		fresh := &agent.Agent{Fingerprint: "fp-fresh"}
+		require.NoError(t, repo.Create(ctx, fresh))
+		require.NoError(t, repo.RecordHeartbeat(ctx, fresh.ID, now))
+
+		events, err := repo.MarkStatus(ctx, []string{agent.StatusOnline}, agent.StatusStale, now.Add(-time.Minute), "no heartbeat")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, silent.ID, events[0].AgentID)
+		assert.Equal(t, agent.StatusOnline, events[0].From)
+		assert.Equal(t, agent.StatusStale, events[0].To)
+		assert.Equal(t, "no heartbeat", events[0].Reason)
+
+		found, err := repo.FindByID(ctx, silent.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent.StatusStale, found.Status)
+
+		found, err = repo.FindByID(ctx, fresh.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent.StatusOnline, found.Status)
+	})
+
+	t.Run("should skip agents in other states", func(t *testing.T) {
+		db := setupAgentTestDB(t)
+		repo := NewAgentRepository(db)
+		ctx := context.Background()
+		now := time.Now()
+
+		a := &agent.Agent{Fingerprint: "fp-offline"}
+		require.NoError(t, repo.Create(ctx, a))
+		require.NoError(t, repo.RecordHeartbeat(ctx, a.ID, now.Add(-time.Hour)))
+		_, err := repo.MarkStatus(ctx, []string{agent.StatusOnline}, agent.StatusOffline, now, "no heartbeat")
+		require.NoError(t, err)
+
+		events, err := repo.MarkStatus(ctx, []string{agent.StatusOnline}, agent.StatusStale, now, "no heartbeat")
+		require.NoError(t, err)
+		assert.Empty(t, events)
+
+		history, err := repo.FindStatusEvents(ctx, a.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, agent.StatusOffline, history[0].To)
+	})
+}
+
+func TestMigrateAgentTags(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE agent_tags (id integer PRIMARY KEY, created_at datetime, updated_at datetime, deleted_at datetime, agent_id text, key text, value text)").Error)
+	require.NoError(t, db.Exec("INSERT INTO agent_tags (agent_id, key, value) VALUES ('agt_1', 'env', 'prod')").Error)
+
+	require.NoError(t, MigrateAgentTags(db))
+	require.NoError(t, db.AutoMigrate(&agent.AgentTag{}))
+	repo := NewAgentRepository(db)
+	ctx := context.Background()
+	require.NoError(t, repo.AddTags(ctx, "agt_1", []agent.AgentTag{{Key: "team", Value: "db", Source: agent.TagSourceServer}}))
+	require.NoError(t, MigrateAgentTags(db))
+
+	var tags []agent.AgentTag
+	require.NoError(t, db.Order("key").Find(&tags).Error)
+	require.Len(t, tags, 2)
+	assert.Equal(t, agent.TagSourceAgent, tags[0].Source, "tags from before sources were chosen by the agent")
+	assert.Equal(t, agent.TagSourceServer, tags[1].Source)
+}
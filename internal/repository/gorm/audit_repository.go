@@ -0,0 +1,101 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"hostlink/domain/audit"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+type AuditRepository struct {
+	db *gorm.DB
+	// mu serializes appends, which each read the head of the chain
+	mu sync.Mutex
+}
+
+func NewAuditRepository(db *gorm.DB) audit.Repository {
+	return &AuditRepository{db: db}
+}
+
+// MigrateAuditLog creates triggers that reject updates and deletes of
+// audit entries, so the log stays append-only even for direct SQL.
+func MigrateAuditLog(db *gorm.DB) error {
+	for _, op := range []string{"UPDATE", "DELETE"} {
+		trigger := "CREATE TRIGGER IF NOT EXISTS audit_entries_no_" + op +
+			" BEFORE " + op + " ON audit_entries BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END"
+		if err := db.Exec(trigger).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AuditRepository) Append(ctx context.Context, e *audit.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var head audit.Entry
+		err := tx.Select("sequence", "hash").Order("sequence desc").Take(&head).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		e.Sequence = head.Sequence + 1
+		e.PrevHash = head.Hash
+		e.ID = "aud_" + ulid.Make().String()
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = time.Now()
+		}
+		// Stored timestamps keep microseconds, so hash what is stored
+		e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+		e.Hash = e.ComputeHash()
+		return tx.Create(e).Error
+	})
+}
+
+func (r *AuditRepository) Find(ctx context.Context, filters audit.Filters) ([]audit.Entry, error) {
+	query := r.db.WithContext(ctx)
+	if filters.ActorID != "" {
+		query = query.Where("actor_id = ?", filters.ActorID)
+	}
+	if filters.Action != "" {
+		query = query.Where("action = ?", filters.Action)
+	}
+	if filters.Target != "" {
+		query = query.Where("target = ?", filters.Target)
+	}
+	if filters.Outcome != "" {
+		query = query.Where("outcome = ?", filters.Outcome)
+	}
+	if filters.Since != nil {
+		query = query.Where("created_at >= ?", filters.Since.UTC())
+	}
+	if filters.Until != nil {
+		query = query.Where("created_at < ?", filters.Until.UTC())
+	}
+	if filters.AfterSequence > 0 {
+		query = query.Where("sequence > ?", filters.AfterSequence)
+	}
+	if filters.BeforeSequence > 0 {
+		query = query.Where("sequence < ?", filters.BeforeSequence)
+	}
+	if filters.Ascending {
+		query = query.Order("sequence asc")
+	} else {
+		query = query.Order("sequence desc")
+	}
+	if filters.Limit > 0 {
+		query = query.Limit(filters.Limit)
+	}
+
+	entries := []audit.Entry{}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,119 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"hostlink/domain/audit"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAuditTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dbName := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&audit.Entry{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if err := MigrateAuditLog(db); err != nil {
+		t.Fatalf("Failed to migrate audit log: %v", err)
+	}
+
+	return db
+}
+
+func TestAuditRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Append chains entries", func(t *testing.T) {
+		repo := NewAuditRepository(setupAuditTestDB(t))
+		for _, action := range []string{"task.create", "webhook.create", "task.create"} {
+			if err := repo.Append(ctx, &audit.Entry{Action: action, ActorID: "opr_1", Outcome: audit.OutcomeSuccess}); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+		}
+
+		entries, err := repo.Find(ctx, audit.Filters{Ascending: true})
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if len(entries) != 3 {
+			t.Fatalf("found %d entries, want 3", len(entries))
+		}
+		if !strings.HasPrefix(entries[0].ID, "aud_") || entries[0].Sequence != 1 || entries[0].PrevHash != "" {
+			t.Errorf("first entry = %+v", entries[0])
+		}
+		if _, at, err := audit.Verify(0, "", entries); err != nil {
+			t.Errorf("stored chain does not verify at %d: %v", at, err)
+		}
+	})
+
+	t.Run("Find filters and pages entries", func(t *testing.T) {
+		repo := NewAuditRepository(setupAuditTestDB(t))
+		past := time.Now().Add(-time.Hour)
+		appended := []*audit.Entry{
+			{Action: "task.create", ActorID: "opr_1", Target: "tsk_1", Outcome: audit.OutcomeSuccess, CreatedAt: past},
+			{Action: "task.create", ActorID: "opr_2", Target: "tsk_2", Outcome: audit.OutcomeDenied},
+			{Action: "webhook.delete", ActorID: "opr_1", Target: "whk_1", Outcome: audit.OutcomeSuccess},
+		}
+		for _, e := range appended {
+			if err := repo.Append(ctx, e); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+		}
+
+		since := time.Now().Add(-time.Minute)
+		tests := []struct {
+			name    string
+			filters audit.Filters
+			want    []int64
+		}{
+			{"newest first", audit.Filters{}, []int64{3, 2, 1}},
+			{"actor", audit.Filters{ActorID: "opr_1"}, []int64{3, 1}},
+			{"action", audit.Filters{Action: "task.create"}, []int64{2, 1}},
+			{"target", audit.Filters{Target: "whk_1"}, []int64{3}},
+			{"outcome", audit.Filters{Outcome: audit.OutcomeDenied}, []int64{2}},
+			{"since", audit.Filters{Since: &since}, []int64{3, 2}},
+			{"until", audit.Filters{Until: &since}, []int64{1}},
+			{"after", audit.Filters{AfterSequence: 1, Ascending: true, Limit: 1}, []int64{2}},
+			{"before", audit.Filters{BeforeSequence: 3, Limit: 1}, []int64{2}},
+		}
+		for _, tt := range tests {
+			entries, err := repo.Find(ctx, tt.filters)
+			if err != nil {
+				t.Fatalf("%s: Find: %v", tt.name, err)
+			}
+			var got []int64
+			for _, e := range entries {
+				got = append(got, e.Sequence)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("%s: sequences = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("Entries cannot be updated or deleted", func(t *testing.T) {
+		db := setupAuditTestDB(t)
+		repo := NewAuditRepository(db)
+		if err := repo.Append(ctx, &audit.Entry{Action: "task.create"}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+
+		if err := db.Model(&audit.Entry{}).Where("sequence = 1").Update("action", "task.update").Error; err == nil {
+			t.Error("expected update to be rejected")
+		}
+		if err := db.Where("sequence = 1").Delete(&audit.Entry{}).Error; err == nil {
+			t.Error("expected delete to be rejected")
+		}
+	})
+}
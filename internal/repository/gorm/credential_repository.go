@@ -0,0 +1,51 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"hostlink/domain/credential"
+
+	"gorm.io/gorm"
+)
+
+type CredentialRepository struct {
+	db *gorm.DB
+}
+
+func NewCredentialRepository(db *gorm.DB) credential.Repository {
+	return &CredentialRepository{db: db}
+}
+
+func (r *CredentialRepository) Create(ctx context.Context, c *credential.Credential) error {
+	if c.ID == "" {
+		c.ID = credential.NewID()
+	}
+	return r.db.WithContext(ctx).Create(c).Error
+}
+
+func (r *CredentialRepository) FindAll(ctx context.Context, filters credential.CredentialFilters) ([]credential.Credential, error) {
+	query := r.db.WithContext(ctx).Where("deleted_at IS NULL")
+	if filters.AgentID != nil {
+		query = query.Where("agent_id = ?", *filters.AgentID)
+	}
+
+	var credentials []credential.Credential
+	err := query.Order("created_at asc").Find(&credentials).Error
+	return credentials, err
+}
+
+func (r *CredentialRepository) FindByID(ctx context.Context, id string) (*credential.Credential, error) {
+	var c credential.Credential
+	err := r.db.WithContext(ctx).Where("id = ? AND deleted_at IS NULL", id).First(&c).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, credential.ErrCredentialNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *CredentialRepository) Update(ctx context.Context, c *credential.Credential) error {
+	return r.db.WithContext(ctx).Save(c).Error
+}
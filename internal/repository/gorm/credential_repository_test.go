@@ -0,0 +1,91 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hostlink/domain/credential"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupCredentialTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dbName := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&credential.Credential{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	return db
+}
+
+func TestCredentialRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Create and FindAll by agent", func(t *testing.T) {
+		repo := NewCredentialRepository(setupCredentialTestDB(t))
+		password := "plaintext"
+		for _, agentID := range []string{"agt_1", "agt_1", "agt_2"} {
+			c := &credential.Credential{AgentID: agentID, Dialect: "postgresql", PasswdEnc: "enc", Password: &password}
+			if err := repo.Create(ctx, c); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if !strings.HasPrefix(c.ID, "crd_") {
+				t.Errorf("expected crd_ ID, got %q", c.ID)
+			}
+		}
+
+		agentID := "agt_1"
+		found, err := repo.FindAll(ctx, credential.CredentialFilters{AgentID: &agentID})
+		if err != nil {
+			t.Fatalf("FindAll: %v", err)
+		}
+		if len(found) != 2 {
+			t.Fatalf("expected 2 credentials, got %d", len(found))
+		}
+		for _, c := range found {
+			if c.Password != nil {
+				t.Errorf("plaintext password must not be stored, got %q", *c.Password)
+			}
+		}
+	})
+
+	t.Run("Update and FindByID", func(t *testing.T) {
+		repo := NewCredentialRepository(setupCredentialTestDB(t))
+		c := &credential.Credential{AgentID: "agt_1", Dialect: "mysql", Host: "old"}
+		if err := repo.Create(ctx, c); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		c.Host = "new"
+		if err := repo.Update(ctx, c); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		found, err := repo.FindByID(ctx, c.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if found.Host != "new" {
+			t.Errorf("expected host new, got %q", found.Host)
+		}
+	})
+
+	t.Run("FindByID returns ErrCredentialNotFound", func(t *testing.T) {
+		repo := NewCredentialRepository(setupCredentialTestDB(t))
+
+		_, err := repo.FindByID(ctx, "crd_missing")
+		if !errors.Is(err, credential.ErrCredentialNotFound) {
+			t.Errorf("expected ErrCredentialNotFound, got %v", err)
+		}
+	})
+}
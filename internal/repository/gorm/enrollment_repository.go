@@ -0,0 +1,85 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"hostlink/domain/enrollment"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+type EnrollmentRepository struct {
+	db *gorm.DB
+}
+
+func NewEnrollmentRepository(db *gorm.DB) enrollment.Repository {
+	return &EnrollmentRepository{db: db}
+}
+
+func (r *EnrollmentRepository) Create(ctx context.Context, t *enrollment.Token) error {
+	t.ID = "enr_" + ulid.Make().String()
+	t.TagList = enrollment.JoinTags(t.Tags)
+	return r.db.WithContext(ctx).Create(t).Error
+}
+
+func (r *EnrollmentRepository) FindByID(ctx context.Context, id string) (*enrollment.Token, error) {
+	var t enrollment.Token
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, enrollment.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Tags = enrollment.SplitTags(t.TagList)
+	return &t, nil
+}
+
+func (r *EnrollmentRepository) FindAll(ctx context.Context) ([]enrollment.Token, error) {
+	tokens := []enrollment.Token{}
+	if err := r.db.WithContext(ctx).Order("created_at DESC, id DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		tokens[i].Tags = enrollment.SplitTags(tokens[i].TagList)
+	}
+	return tokens, nil
+}
+
+func (r *EnrollmentRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	t, err := r.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if t.RevokedAt != nil {
+		return nil
+	}
+	return r.db.WithContext(ctx).Model(&enrollment.Token{}).Where("id = ?", id).Update("revoked_at", at).Error
+}
+
+func (r *EnrollmentRepository) Consume(ctx context.Context, id string, now time.Time) error {
+	// A single conditional update, so concurrent registrations cannot use
+	// a token more often than allowed
+	result := r.db.WithContext(ctx).Model(&enrollment.Token{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where("max_uses = 0 OR uses < max_uses").
+		Updates(map[string]any{"uses": gorm.Expr("uses + 1"), "last_used_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	t, err := r.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := t.Usable(now); err != nil {
+		return err
+	}
+	return enrollment.ErrTokenExhausted
+}
@@ -0,0 +1,164 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hostlink/domain/enrollment"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupEnrollmentTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dbName := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&enrollment.Token{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	return db
+}
+
+func TestEnrollmentRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Create and find tokens", func(t *testing.T) {
+		repo := NewEnrollmentRepository(setupEnrollmentTestDB(t))
+		token := &enrollment.Token{Name: "staging", KeyHash: "hash", Tags: []string{"env=staging", "team=web"}, MaxUses: 5}
+		if err := repo.Create(ctx, token); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if !strings.HasPrefix(token.ID, "enr_") {
+			t.Errorf("ID = %q, want enr_ prefix", token.ID)
+		}
+
+		found, err := repo.FindByID(ctx, token.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if found.Name != "staging" || len(found.Tags) != 2 || found.Tags[1] != "team=web" || found.MaxUses != 5 {
+			t.Errorf("found = %+v", found)
+		}
+
+		if _, err := repo.FindByID(ctx, "enr_missing"); !errors.Is(err, enrollment.ErrTokenNotFound) {
+			t.Errorf("FindByID(missing) error = %v, want ErrTokenNotFound", err)
+		}
+	})
+
+	t.Run("FindAll lists newest first", func(t *testing.T) {
+		repo := NewEnrollmentRepository(setupEnrollmentTestDB(t))
+		for _, name := range []string{"first", "second"} {
+			if err := repo.Create(ctx, &enrollment.Token{Name: name, KeyHash: name}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		tokens, err := repo.FindAll(ctx)
+		if err != nil {
+			t.Fatalf("FindAll: %v", err)
+		}
+		if len(tokens) != 2 || tokens[0].Name != "second" {
+			t.Errorf("tokens = %+v", tokens)
+		}
+	})
+
+	t.Run("Revoke keeps the first revocation", func(t *testing.T) {
+		repo := NewEnrollmentRepository(setupEnrollmentTestDB(t))
+		token := &enrollment.Token{Name: "staging", KeyHash: "hash"}
+		if err := repo.Create(ctx, token); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		first := time.Now().Add(-time.Hour).UTC()
+
+		if err := repo.Revoke(ctx, token.ID, first); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+		if err := repo.Revoke(ctx, token.ID, time.Now()); err != nil {
+			t.Fatalf("Revoke again: %v", err)
+		}
+
+		found, _ := repo.FindByID(ctx, token.ID)
+		if found.RevokedAt == nil || !found.RevokedAt.Equal(first) {
+			t.Errorf("RevokedAt = %v, want %v", found.RevokedAt, first)
+		}
+		if err := repo.Revoke(ctx, "enr_missing", time.Now()); !errors.Is(err, enrollment.ErrTokenNotFound) {
+			t.Errorf("Revoke(missing) error = %v, want ErrTokenNotFound", err)
+		}
+	})
+
+	t.Run("Consume counts uses and reports why a token is unusable", func(t *testing.T) {
+		repo := NewEnrollmentRepository(setupEnrollmentTestDB(t))
+		now := time.Now().UTC()
+		expired := now.Add(-time.Minute)
+		limited := &enrollment.Token{Name: "limited", KeyHash: "a", MaxUses: 1}
+		old := &enrollment.Token{Name: "old", KeyHash: "b", ExpiresAt: &expired}
+		revoked := &enrollment.Token{Name: "revoked", KeyHash: "c"}
+		for _, token := range []*enrollment.Token{limited, old, revoked} {
+			if err := repo.Create(ctx, token); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		if err := repo.Revoke(ctx, revoked.ID, now); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+
+		if err := repo.Consume(ctx, limited.ID, now); err != nil {
+			t.Fatalf("Consume: %v", err)
+		}
+		found, _ := repo.FindByID(ctx, limited.ID)
+		if found.Uses != 1 || found.LastUsedAt == nil {
+			t.Errorf("after use: %+v", found)
+		}
+
+		tests := map[string]error{
+			limited.ID:    enrollment.ErrTokenExhausted,
+			old.ID:        enrollment.ErrTokenExpired,
+			revoked.ID:    enrollment.ErrTokenRevoked,
+			"enr_missing": enrollment.ErrTokenNotFound,
+		}
+		for id, want := range tests {
+			if err := repo.Consume(ctx, id, now); !errors.Is(err, want) {
+				t.Errorf("Consume(%s) error = %v, want %v", id, err, want)
+			}
+		}
+	})
+
+	t.Run("Consume does not exceed the maximum under concurrency", func(t *testing.T) {
+		repo := NewEnrollmentRepository(setupEnrollmentTestDB(t))
+		token := &enrollment.Token{Name: "limited", KeyHash: "a", MaxUses: 3}
+		if err := repo.Create(ctx, token); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded := 0
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if repo.Consume(ctx, token.ID, time.Now()) == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if succeeded != 3 {
+			t.Errorf("%d uses succeeded, want 3", succeeded)
+		}
+	})
+}
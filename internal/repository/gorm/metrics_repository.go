@@ -0,0 +1,142 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"hostlink/domain/metrics"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// metricsBatchSize bounds the rows inserted per statement.
+const metricsBatchSize = 100
+
+type MetricsRepository struct {
+	db *gorm.DB
+}
+
+func NewMetricsRepository(db *gorm.DB) metrics.Repository {
+	return &MetricsRepository{db: db}
+}
+
+// MigrateMetricRollups creates one rollup table per resolution. The tables
+// share a model, so their unique bucket indexes are named per table.
+func MigrateMetricRollups(db *gorm.DB) error {
+	for _, resolution := range metrics.Resolutions {
+		table := resolution.Table()
+		if err := db.Table(table).AutoMigrate(&metrics.Rollup{}); err != nil {
+			return err
+		}
+		index := fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_bucket ON %s (agent_id, type, series_key, field, bucket_start)", table, table)
+		if err := db.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MetricsRepository) Append(ctx context.Context, samples []metrics.Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).CreateInBatches(samples, metricsBatchSize).Error
+}
+
+// FindSamples returns matching samples, oldest first.
+func (r *MetricsRepository) FindSamples(ctx context.Context, filters metrics.SampleFilters) ([]metrics.Sample, error) {
+	query := r.db.WithContext(ctx).Where("agent_id = ?", filters.AgentID)
+
+	if filters.Type != nil {
+		query = query.Where("type = ?", *filters.Type)
+	}
+	if filters.Attributes != nil {
+		seriesKey, err := metrics.SeriesKey(filters.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("series_key = ?", seriesKey)
+	}
+	if filters.Since != nil {
+		query = query.Where("timestamp >= ?", *filters.Since)
+	}
+	if filters.Until != nil {
+		query = query.Where("timestamp < ?", *filters.Until)
+	}
+
+	var samples []metrics.Sample
+	err := query.Order("timestamp asc, id asc").Find(&samples).Error
+	return samples, err
+}
+
+func (r *MetricsRepository) FindSampleAgents(ctx context.Context, from, to time.Time) ([]string, error) {
+	var agentIDs []string
+	err := r.db.WithContext(ctx).Model(&metrics.Sample{}).
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Distinct().Order("agent_id").Pluck("agent_id", &agentIDs).Error
+	return agentIDs, err
+}
+
+func (r *MetricsRepository) EarliestSample(ctx context.Context, agentID string) (time.Time, bool, error) {
+	return r.sampleTime(ctx, agentID, "timestamp asc")
+}
+
+func (r *MetricsRepository) LatestSample(ctx context.Context, agentID string) (time.Time, bool, error) {
+	return r.sampleTime(ctx, agentID, "timestamp desc")
+}
+
+// sampleTime returns the timestamp of the agent's first sample in order.
+func (r *MetricsRepository) sampleTime(ctx context.Context, agentID, order string) (time.Time, bool, error) {
+	var samples []metrics.Sample
+	err := r.db.WithContext(ctx).Select("timestamp").Where("agent_id = ?", agentID).Order(order).Limit(1).Find(&samples).Error
+	if err != nil || len(samples) == 0 {
+		return time.Time{}, false, err
+	}
+	return samples[0].Timestamp, true, nil
+}
+
+func (r *MetricsRepository) DeleteSamplesBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("timestamp < ?", before).Delete(&metrics.Sample{})
+	return result.RowsAffected, result.Error
+}
+
+// UpsertRollups writes rollups, replacing the aggregates of buckets that
+// were rolled up before.
+func (r *MetricsRepository) UpsertRollups(ctx context.Context, resolution metrics.Resolution, rollups []metrics.Rollup) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Table(resolution.Table()).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "agent_id"}, {Name: "type"}, {Name: "series_key"}, {Name: "field"}, {Name: "bucket_start"}},
+			DoUpdates: clause.AssignmentColumns([]string{"count", "sum", "min", "max", "p95"}),
+		}).
+		CreateInBatches(rollups, metricsBatchSize).Error
+}
+
+// FindRollups returns matching rollups ordered by series, field and bucket.
+func (r *MetricsRepository) FindRollups(ctx context.Context, resolution metrics.Resolution, filters metrics.RollupFilters) ([]metrics.Rollup, error) {
+	var rollups []metrics.Rollup
+	err := r.db.WithContext(ctx).Table(resolution.Table()).
+		Where("agent_id = ? AND type = ?", filters.AgentID, filters.Type).
+		Where("bucket_start >= ? AND bucket_start < ?", filters.From, filters.To).
+		Order("series_key asc, field asc, bucket_start asc").
+		Find(&rollups).Error
+	return rollups, err
+}
+
+func (r *MetricsRepository) LatestRollup(ctx context.Context, resolution metrics.Resolution, agentID string) (time.Time, bool, error) {
+	var rollups []metrics.Rollup
+	err := r.db.WithContext(ctx).Table(resolution.Table()).
+		Select("bucket_start").Where("agent_id = ?", agentID).Order("bucket_start desc").Limit(1).Find(&rollups).Error
+	if err != nil || len(rollups) == 0 {
+		return time.Time{}, false, err
+	}
+	return rollups[0].BucketStart, true, nil
+}
+
+func (r *MetricsRepository) DeleteRollupsBefore(ctx context.Context, resolution metrics.Resolution, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Table(resolution.Table()).Where("bucket_start < ?", before).Delete(&metrics.Rollup{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,124 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"hostlink/domain/metrics"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupMetricsTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dbName := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&metrics.Sample{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	return db
+}
+
+func TestMetricsRepository(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sample := func(agentID, metricType string, attributes map[string]any, offset time.Duration) metrics.Sample {
+		key, err := metrics.SeriesKey(attributes)
+		if err != nil {
+			t.Fatalf("SeriesKey: %v", err)
+		}
+		return metrics.Sample{AgentID: agentID, Type: metricType, SeriesKey: key, Timestamp: base.Add(offset), Metrics: `{}`}
+	}
+
+	t.Run("FindSamples filters by series and time", func(t *testing.T) {
+		repo := NewMetricsRepository(setupMetricsTestDB(t))
+		root := map[string]any{"mount_point": "/"}
+		data := map[string]any{"mount_point": "/data"}
+		err := repo.Append(ctx, []metrics.Sample{
+			sample("agt_1", metrics.MetricTypeStorage, root, 0),
+			sample("agt_1", metrics.MetricTypeStorage, data, 0),
+			sample("agt_1", metrics.MetricTypeStorage, root, time.Minute),
+			sample("agt_1", metrics.MetricTypeSystem, nil, time.Minute),
+			sample("agt_2", metrics.MetricTypeStorage, root, time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+
+		storage := metrics.MetricTypeStorage
+		found, err := repo.FindSamples(ctx, metrics.SampleFilters{AgentID: "agt_1", Type: &storage, Attributes: root})
+		if err != nil {
+			t.Fatalf("FindSamples: %v", err)
+		}
+		if len(found) != 2 || !found[0].Timestamp.Before(found[1].Timestamp) {
+			t.Fatalf("expected two root samples oldest first, got %+v", found)
+		}
+
+		since := base.Add(30 * time.Second)
+		found, err = repo.FindSamples(ctx, metrics.SampleFilters{AgentID: "agt_1", Since: &since})
+		if err != nil {
+			t.Fatalf("FindSamples: %v", err)
+		}
+		if len(found) != 2 {
+			t.Errorf("expected 2 samples since %v, got %d", since, len(found))
+		}
+	})
+
+	t.Run("UpsertRollups replaces a bucket", func(t *testing.T) {
+		db := setupMetricsTestDB(t)
+		if err := MigrateMetricRollups(db); err != nil {
+			t.Fatalf("MigrateMetricRollups: %v", err)
+		}
+		repo := NewMetricsRepository(db)
+		rollup := metrics.Rollup{AgentID: "agt_1", Type: metrics.MetricTypeSystem, Field: "cpu_percent", BucketStart: base, Count: 1, Sum: 10, Min: 10, Max: 10, P95: 10}
+		if err := repo.UpsertRollups(ctx, metrics.Resolution1m, []metrics.Rollup{rollup}); err != nil {
+			t.Fatalf("UpsertRollups: %v", err)
+		}
+		rollup.Count, rollup.Sum, rollup.Max, rollup.P95 = 2, 30, 20, 20
+		if err := repo.UpsertRollups(ctx, metrics.Resolution1m, []metrics.Rollup{rollup}); err != nil {
+			t.Fatalf("UpsertRollups: %v", err)
+		}
+
+		found, err := repo.FindRollups(ctx, metrics.Resolution1m, metrics.RollupFilters{
+			AgentID: "agt_1", Type: metrics.MetricTypeSystem, From: base, To: base.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("FindRollups: %v", err)
+		}
+		if len(found) != 1 || found[0].Count != 2 || found[0].Max != 20 {
+			t.Fatalf("expected one updated rollup, got %+v", found)
+		}
+
+		other, err := repo.FindRollups(ctx, metrics.Resolution5m, metrics.RollupFilters{
+			AgentID: "agt_1", Type: metrics.MetricTypeSystem, From: base, To: base.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("FindRollups: %v", err)
+		}
+		if len(other) != 0 {
+			t.Errorf("expected resolutions to be stored apart, got %d 5m rollups", len(other))
+		}
+
+		latest, ok, err := repo.LatestRollup(ctx, metrics.Resolution1m, "agt_1")
+		if err != nil || !ok || !latest.Equal(base) {
+			t.Errorf("expected latest bucket %v, got %v (ok=%v, err=%v)", base, latest, ok, err)
+		}
+		if _, ok, err := repo.LatestRollup(ctx, metrics.Resolution1m, "agt_2"); err != nil || ok {
+			t.Errorf("expected no bucket for another agent, got ok=%v (err=%v)", ok, err)
+		}
+
+		pruned, err := repo.DeleteRollupsBefore(ctx, metrics.Resolution1m, base.Add(time.Minute))
+		if err != nil || pruned != 1 {
+			t.Errorf("expected 1 pruned rollup, got %d (err=%v)", pruned, err)
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type NonceRepository struct {
@@ -16,6 +17,27 @@ func NewNonceRepository(db *gorm.DB) *NonceRepository {
 	return &NonceRepository{db: db}
 }
 
+// MigrateNonces drops a nonce table from before nonces were tracked per
+// agent, so it is recreated with the agent in its primary key. The table
+// only holds nonces for a few minutes, so nothing of value is lost.
+func MigrateNonces(db *gorm.DB) error {
+	if db.Migrator().HasTable(&nonce.Nonce{}) && !db.Migrator().HasColumn(&nonce.Nonce{}, "AgentID") {
+		return db.Migrator().DropTable(&nonce.Nonce{})
+	}
+	return nil
+}
+
+// Remember records the nonce unless the agent already used it. The insert
+// is a single statement, so concurrent replays cannot both succeed.
+func (r *NonceRepository) Remember(ctx context.Context, agentID, value string, signedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&nonce.Nonce{AgentID: agentID, Value: value, CreatedAt: signedAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func (r *NonceRepository) Save(ctx context.Context, n *nonce.Nonce) error {
 	return r.db.WithContext(ctx).Create(n).Error
 }
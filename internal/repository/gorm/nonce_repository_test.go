@@ -860,3 +860,54 @@ func generateTestNonces(count int) []*nonce.Nonce {
 	}
 	return nonces
 }
+
+func TestNonceRepository_Remember(t *testing.T) {
+	t.Run("should reject a nonce the agent already used", func(t *testing.T) {
+		repo, cleanup := setupNonceTestDB(t)
+		defer cleanup()
+		ctx := context.Background()
+		signedAt := time.Now()
+
+		fresh, err := repo.Remember(ctx, "agt_1", "nonce-1", signedAt)
+		if err != nil || !fresh {
+			t.Fatalf("first use: fresh = %v, err = %v", fresh, err)
+		}
+		fresh, err = repo.Remember(ctx, "agt_1", "nonce-1", signedAt)
+		if err != nil || fresh {
+			t.Errorf("replay: fresh = %v, err = %v, want false", fresh, err)
+		}
+		fresh, err = repo.Remember(ctx, "agt_2", "nonce-1", signedAt)
+		if err != nil || !fresh {
+			t.Errorf("other agent: fresh = %v, err = %v, want true", fresh, err)
+		}
+	})
+}
+
+func TestMigrateNonces(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.Exec("CREATE TABLE nonces (value varchar(100) PRIMARY KEY, created_at datetime NOT NULL)").Error; err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+
+	if err := MigrateNonces(db); err != nil {
+		t.Fatalf("MigrateNonces: %v", err)
+	}
+	if err := db.AutoMigrate(&nonce.Nonce{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	if err := MigrateNonces(db); err != nil {
+		t.Fatalf("MigrateNonces again: %v", err)
+	}
+
+	repo := NewNonceRepository(db)
+	ctx := context.Background()
+	if _, err := repo.Remember(ctx, "agt_1", "nonce-1", time.Now()); err != nil {
+		t.Fatalf("Remember: %v", err)
+	}
+	if fresh, _ := repo.Remember(ctx, "agt_2", "nonce-1", time.Now()); !fresh {
+		t.Error("nonce should be tracked per agent after migration")
+	}
+}
@@ -0,0 +1,108 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"hostlink/domain/operator"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+type OperatorRepository struct {
+	db *gorm.DB
+}
+
+func NewOperatorRepository(db *gorm.DB) operator.Repository {
+	return &OperatorRepository{db: db}
+}
+
+func (r *OperatorRepository) CreateOperator(ctx context.Context, o *operator.Operator) error {
+	o.ID = "opr_" + ulid.Make().String()
+	o.ScopeFilter = operator.JoinScope(o.Scope)
+	return r.db.WithContext(ctx).Create(o).Error
+}
+
+func (r *OperatorRepository) UpdateOperator(ctx context.Context, o *operator.Operator) error {
+	o.ScopeFilter = operator.JoinScope(o.Scope)
+	return r.db.WithContext(ctx).Save(o).Error
+}
+
+func (r *OperatorRepository) FindOperator(ctx context.Context, id string) (*operator.Operator, error) {
+	return r.findOperator(ctx, "id = ?", id)
+}
+
+func (r *OperatorRepository) FindOperatorByName(ctx context.Context, name string) (*operator.Operator, error) {
+	return r.findOperator(ctx, "name = ?", name)
+}
+
+func (r *OperatorRepository) findOperator(ctx context.Context, query string, arg string) (*operator.Operator, error) {
+	var o operator.Operator
+	err := r.db.WithContext(ctx).Where(query, arg).First(&o).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, operator.ErrOperatorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.Scope = operator.SplitScope(o.ScopeFilter)
+	return &o, nil
+}
+
+func (r *OperatorRepository) FindOperators(ctx context.Context) ([]operator.Operator, error) {
+	operators := []operator.Operator{}
+	if err := r.db.WithContext(ctx).Order("created_at asc").Find(&operators).Error; err != nil {
+		return nil, err
+	}
+	for i := range operators {
+		operators[i].Scope = operator.SplitScope(operators[i].ScopeFilter)
+	}
+	return operators, nil
+}
+
+func (r *OperatorRepository) CreateToken(ctx context.Context, t *operator.Token) error {
+	t.ID = "otk_" + ulid.Make().String()
+	return r.db.WithContext(ctx).Create(t).Error
+}
+
+func (r *OperatorRepository) FindTokenByHash(ctx context.Context, hash string) (*operator.Token, error) {
+	var t operator.Token
+	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, operator.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *OperatorRepository) FindTokens(ctx context.Context, operatorID string) ([]operator.Token, error) {
+	tokens := []operator.Token{}
+	err := r.db.WithContext(ctx).Where("operator_id = ?", operatorID).
+		Order("created_at DESC, id DESC").Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *OperatorRepository) RevokeToken(ctx context.Context, operatorID, id string, at time.Time) error {
+	var t operator.Token
+	err := r.db.WithContext(ctx).Where("id = ? AND operator_id = ?", id, operatorID).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return operator.ErrTokenNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if t.RevokedAt != nil {
+		return nil
+	}
+	return r.db.WithContext(ctx).Model(&operator.Token{}).Where("id = ?", id).Update("revoked_at", at).Error
+}
+
+func (r *OperatorRepository) TouchToken(ctx context.Context, id string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&operator.Token{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
@@ -0,0 +1,111 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hostlink/domain/operator"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupOperatorTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dbName := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&operator.Operator{}, &operator.Token{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	return db
+}
+
+func TestOperatorRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Create and find operators", func(t *testing.T) {
+		repo := NewOperatorRepository(setupOperatorTestDB(t))
+		o := &operator.Operator{Name: "alice", Role: operator.RoleOperator, Scope: []string{"env=staging", "team=web"}}
+		if err := repo.CreateOperator(ctx, o); err != nil {
+			t.Fatalf("CreateOperator: %v", err)
+		}
+		if !strings.HasPrefix(o.ID, "opr_") {
+			t.Errorf("ID = %q, want opr_ prefix", o.ID)
+		}
+
+		found, err := repo.FindOperatorByName(ctx, "alice")
+		if err != nil {
+			t.Fatalf("FindOperatorByName: %v", err)
+		}
+		if found.ID != o.ID || len(found.Scope) != 2 || found.Scope[1] != "team=web" {
+			t.Errorf("found = %+v", found)
+		}
+
+		found.Scope = nil
+		found.Role = operator.RoleAdmin
+		if err := repo.UpdateOperator(ctx, found); err != nil {
+			t.Fatalf("UpdateOperator: %v", err)
+		}
+		all, err := repo.FindOperators(ctx)
+		if err != nil {
+			t.Fatalf("FindOperators: %v", err)
+		}
+		if len(all) != 1 || all[0].Role != operator.RoleAdmin || all[0].Scoped() {
+			t.Errorf("FindOperators = %+v", all)
+		}
+
+		if _, err := repo.FindOperator(ctx, "opr_missing"); !errors.Is(err, operator.ErrOperatorNotFound) {
+			t.Errorf("FindOperator error = %v, want ErrOperatorNotFound", err)
+		}
+	})
+
+	t.Run("Tokens are found by hash and revoked once", func(t *testing.T) {
+		repo := NewOperatorRepository(setupOperatorTestDB(t))
+		token := &operator.Token{OperatorID: "opr_1", Name: "laptop", Hash: operator.HashToken("hlo_secret")}
+		if err := repo.CreateToken(ctx, token); err != nil {
+			t.Fatalf("CreateToken: %v", err)
+		}
+
+		found, err := repo.FindTokenByHash(ctx, operator.HashToken("hlo_secret"))
+		if err != nil {
+			t.Fatalf("FindTokenByHash: %v", err)
+		}
+		if found.ID != token.ID {
+			t.Errorf("FindTokenByHash = %+v", found)
+		}
+		if _, err := repo.FindTokenByHash(ctx, operator.HashToken("hlo_other")); !errors.Is(err, operator.ErrTokenNotFound) {
+			t.Errorf("FindTokenByHash error = %v, want ErrTokenNotFound", err)
+		}
+
+		if err := repo.RevokeToken(ctx, "opr_2", token.ID, time.Now()); !errors.Is(err, operator.ErrTokenNotFound) {
+			t.Errorf("RevokeToken of another operator error = %v, want ErrTokenNotFound", err)
+		}
+		first := time.Now().UTC().Add(-time.Hour)
+		if err := repo.RevokeToken(ctx, "opr_1", token.ID, first); err != nil {
+			t.Fatalf("RevokeToken: %v", err)
+		}
+		if err := repo.RevokeToken(ctx, "opr_1", token.ID, time.Now()); err != nil {
+			t.Fatalf("second RevokeToken: %v", err)
+		}
+
+		tokens, err := repo.FindTokens(ctx, "opr_1")
+		if err != nil {
+			t.Fatalf("FindTokens: %v", err)
+		}
+		if len(tokens) != 1 || tokens[0].RevokedAt == nil || !tokens[0].RevokedAt.Equal(first) {
+			t.Errorf("tokens = %+v, want one revoked at %v", tokens, first)
+		}
+		if tokens[0].Active(time.Now()) {
+			t.Error("revoked token is active")
+		}
+	})
+}
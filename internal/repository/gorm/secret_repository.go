@@ -0,0 +1,62 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"hostlink/domain/secret"
+
+	"gorm.io/gorm"
+)
+
+type SecretRepository struct {
+	db *gorm.DB
+}
+
+func NewSecretRepository(db *gorm.DB) secret.Repository {
+	return &SecretRepository{db: db}
+}
+
+func (r *SecretRepository) Save(ctx context.Context, s *secret.Secret) error {
+	if s.ID == "" {
+		s.ID = secret.NewID()
+	}
+	return r.db.WithContext(ctx).Save(s).Error
+}
+
+func (r *SecretRepository) FindAll(ctx context.Context, agentID string) ([]secret.Secret, error) {
+	var secrets []secret.Secret
+	err := r.db.WithContext(ctx).Where("agent_id = ?", agentID).Order("name asc").Find(&secrets).Error
+	return secrets, err
+}
+
+func (r *SecretRepository) FindByName(ctx context.Context, agentID, name string) (*secret.Secret, error) {
+	var s secret.Secret
+	err := r.db.WithContext(ctx).Where("agent_id = ? AND name = ?", agentID, name).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, secret.ErrSecretNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *SecretRepository) FindByNames(ctx context.Context, agentID string, names []string) ([]secret.Secret, error) {
+	var secrets []secret.Secret
+	if len(names) == 0 {
+		return secrets, nil
+	}
+	err := r.db.WithContext(ctx).Where("agent_id = ? AND name IN ?", agentID, names).Order("name asc").Find(&secrets).Error
+	return secrets, err
+}
+
+func (r *SecretRepository) Delete(ctx context.Context, agentID, name string) error {
+	result := r.db.WithContext(ctx).Where("agent_id = ? AND name = ?", agentID, name).Delete(&secret.Secret{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return secret.ErrSecretNotFound
+	}
+	return nil
+}
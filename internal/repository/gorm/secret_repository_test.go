@@ -0,0 +1,109 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hostlink/domain/secret"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupSecretTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dbName := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&secret.Secret{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	return db
+}
+
+func TestSecretRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Save, find and update", func(t *testing.T) {
+		repo := NewSecretRepository(setupSecretTestDB(t))
+		s := &secret.Secret{AgentID: "agt_1", Name: "db_password", ValueEnc: "enc-1"}
+		if err := repo.Save(ctx, s); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if !strings.HasPrefix(s.ID, "sec_") {
+			t.Errorf("ID = %q, want sec_ prefix", s.ID)
+		}
+
+		found, err := repo.FindByName(ctx, "agt_1", "db_password")
+		if err != nil {
+			t.Fatalf("FindByName: %v", err)
+		}
+		found.ValueEnc = "enc-2"
+		if err := repo.Save(ctx, found); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+
+		all, err := repo.FindAll(ctx, "agt_1")
+		if err != nil {
+			t.Fatalf("FindAll: %v", err)
+		}
+		if len(all) != 1 || all[0].ID != s.ID || all[0].ValueEnc != "enc-2" {
+			t.Errorf("FindAll = %+v, want the updated secret", all)
+		}
+		if !all[0].CreatedAt.Equal(s.CreatedAt) {
+			t.Errorf("CreatedAt changed from %v to %v", s.CreatedAt, all[0].CreatedAt)
+		}
+	})
+
+	t.Run("names are unique per agent", func(t *testing.T) {
+		repo := NewSecretRepository(setupSecretTestDB(t))
+		if err := repo.Save(ctx, &secret.Secret{AgentID: "agt_1", Name: "token"}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if err := repo.Save(ctx, &secret.Secret{AgentID: "agt_2", Name: "token"}); err != nil {
+			t.Fatalf("Save for another agent: %v", err)
+		}
+		if err := repo.Save(ctx, &secret.Secret{AgentID: "agt_1", Name: "token"}); err == nil {
+			t.Error("expected a second secret with the same name to be rejected")
+		}
+	})
+
+	t.Run("FindByNames leaves out missing names", func(t *testing.T) {
+		repo := NewSecretRepository(setupSecretTestDB(t))
+		for _, name := range []string{"a", "b"} {
+			if err := repo.Save(ctx, &secret.Secret{AgentID: "agt_1", Name: name}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+		}
+		found, err := repo.FindByNames(ctx, "agt_1", []string{"b", "c"})
+		if err != nil {
+			t.Fatalf("FindByNames: %v", err)
+		}
+		if len(found) != 1 || found[0].Name != "b" {
+			t.Errorf("FindByNames = %+v, want only b", found)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := NewSecretRepository(setupSecretTestDB(t))
+		if err := repo.Save(ctx, &secret.Secret{AgentID: "agt_1", Name: "token"}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if err := repo.Delete(ctx, "agt_2", "token"); !errors.Is(err, secret.ErrSecretNotFound) {
+			t.Errorf("Delete of another agent's secret: got %v, want ErrSecretNotFound", err)
+		}
+		if err := repo.Delete(ctx, "agt_1", "token"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := repo.FindByName(ctx, "agt_1", "token"); !errors.Is(err, secret.ErrSecretNotFound) {
+			t.Errorf("FindByName after Delete: got %v, want ErrSecretNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"hostlink/domain/task"
+
+	"gorm.io/gorm"
+)
+
+type TaskOutputRepository struct {
+	db *gorm.DB
+}
+
+func NewTaskOutputRepository(db *gorm.DB) task.OutputRepository {
+	return &TaskOutputRepository{db: db}
+}
+
+// AppendOutput stores chunk as the task's next chunk. A chunk with the same
+// agent, attempt, stream and agent sequence as a stored one is a retry and
+// is not stored again.
+func (r *TaskOutputRepository) AppendOutput(ctx context.Context, chunk *task.OutputChunk) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if chunk.AgentSequence > 0 {
+			var existing task.OutputChunk
+			err := tx.Where("task_id = ? AND agent_id = ? AND execution_attempt_id = ? AND stream = ? AND agent_sequence = ?",
+				chunk.TaskID, chunk.AgentID, chunk.ExecutionAttemptID, chunk.Stream, chunk.AgentSequence).
+				First(&existing).Error
+			if err == nil {
+				*chunk = existing
+				return nil
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		var last int64
+		err := tx.Model(&task.OutputChunk{}).Where("task_id = ?", chunk.TaskID).
+			Select("COALESCE(MAX(sequence), 0)").Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		chunk.ID = 0
+		chunk.Sequence = last + 1
+		return tx.Create(chunk).Error
+	})
+}
+
+func (r *TaskOutputRepository) FindOutput(ctx context.Context, taskID string, afterSequence int64, limit int) ([]task.OutputChunk, error) {
+	var chunks []task.OutputChunk
+	query := r.db.WithContext(ctx).Where("task_id = ? AND sequence > ?", taskID, afterSequence).Order("sequence asc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&chunks).Error
+	return chunks, err
+}
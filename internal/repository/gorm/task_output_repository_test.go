@@ -0,0 +1,102 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"hostlink/domain/task"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTaskOutputRepository_AppendOutput(t *testing.T) {
+	t.Run("numbers chunks per task across streams", func(t *testing.T) {
+		repo := NewTaskOutputRepository(setupTaskOutputTestDB(t))
+		ctx := context.Background()
+
+		chunks := []*task.OutputChunk{
+			{TaskID: "tsk_1", AgentID: "agt_1", Stream: task.StreamStdout, AgentSequence: 1, Data: "a"},
+			{TaskID: "tsk_1", AgentID: "agt_1", Stream: task.StreamStderr, AgentSequence: 1, Data: "b"},
+			{TaskID: "tsk_2", AgentID: "agt_1", Stream: task.StreamStdout, AgentSequence: 1, Data: "c"},
+			{TaskID: "tsk_1", AgentID: "agt_1", Stream: task.StreamStdout, AgentSequence: 2, Data: "d"},
+		}
+		for _, chunk := range chunks {
+			if err := repo.AppendOutput(ctx, chunk); err != nil {
+				t.Fatalf("AppendOutput() error = %v", err)
+			}
+		}
+
+		want := []int64{1, 2, 1, 3}
+		for i, chunk := range chunks {
+			if chunk.Sequence != want[i] {
+				t.Errorf("chunk %d sequence = %d, want %d", i, chunk.Sequence, want[i])
+			}
+		}
+	})
+
+	t.Run("ignores a retried chunk", func(t *testing.T) {
+		repo := NewTaskOutputRepository(setupTaskOutputTestDB(t))
+		ctx := context.Background()
+
+		first := &task.OutputChunk{TaskID: "tsk_1", AgentID: "agt_1", ExecutionAttemptID: "att_1", Stream: task.StreamStdout, AgentSequence: 1, Data: "a"}
+		if err := repo.AppendOutput(ctx, first); err != nil {
+			t.Fatalf("AppendOutput() error = %v", err)
+		}
+		retry := &task.OutputChunk{TaskID: "tsk_1", AgentID: "agt_1", ExecutionAttemptID: "att_1", Stream: task.StreamStdout, AgentSequence: 1, Data: "a"}
+		if err := repo.AppendOutput(ctx, retry); err != nil {
+			t.Fatalf("AppendOutput() retry error = %v", err)
+		}
+		if retry.Sequence != first.Sequence {
+			t.Errorf("retry sequence = %d, want %d", retry.Sequence, first.Sequence)
+		}
+
+		stored, err := repo.FindOutput(ctx, "tsk_1", 0, 0)
+		if err != nil {
+			t.Fatalf("FindOutput() error = %v", err)
+		}
+		if len(stored) != 1 {
+			t.Errorf("stored %d chunks, want 1", len(stored))
+		}
+	})
+}
+
+func TestTaskOutputRepository_FindOutput(t *testing.T) {
+	repo := NewTaskOutputRepository(setupTaskOutputTestDB(t))
+	ctx := context.Background()
+
+	for i := 1; i <= 5; i++ {
+		chunk := &task.OutputChunk{TaskID: "tsk_1", AgentID: "agt_1", Stream: task.StreamStdout, AgentSequence: int64(i), Data: fmt.Sprint(i)}
+		if err := repo.AppendOutput(ctx, chunk); err != nil {
+			t.Fatalf("AppendOutput() error = %v", err)
+		}
+	}
+
+	chunks, err := repo.FindOutput(ctx, "tsk_1", 2, 2)
+	if err != nil {
+		t.Fatalf("FindOutput() error = %v", err)
+	}
+	if len(chunks) != 2 || chunks[0].Sequence != 3 || chunks[1].Sequence != 4 {
+		t.Fatalf("FindOutput() = %+v, want sequences 3 and 4", chunks)
+	}
+	if chunks[0].Data != "3" {
+		t.Errorf("chunk data = %q, want %q", chunks[0].Data, "3")
+	}
+}
+
+func setupTaskOutputTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dbName := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&task.OutputChunk{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	return db
+}
@@ -2,8 +2,11 @@ package gorm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hostlink/domain/secret"
 	"hostlink/domain/task"
+	"time"
 
 	"github.com/oklog/ulid/v2"
 	"gorm.io/gorm"
@@ -19,8 +22,33 @@ func NewTaskRepository(db *gorm.DB) task.Repository {
 
 func (r *TaskRepository) Create(ctx context.Context, t *task.Task) error {
 	t.ID = "tsk_" + ulid.Make().String()
-	t.Status = "pending"
-	return r.db.WithContext(ctx).Create(t).Error
+	t.Status = task.StatusPending
+	t.AgentIDs = uniqueAgentIDs(t.AgentIDs)
+	t.EnvSecretList = task.JoinSecrets(t.EnvSecrets)
+	if len(t.AgentIDs) == 0 {
+		return r.db.WithContext(ctx).Create(t).Error
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		executions := make([]task.Execution, 0, len(t.AgentIDs))
+		for _, agentID := range t.AgentIDs {
+			executions = append(executions, task.Execution{
+				ID:      "exe_" + ulid.Make().String(),
+				TaskID:  t.ID,
+				AgentID: agentID,
+				Status:  task.StatusPending,
+			})
+		}
+		if err := tx.Create(&executions).Error; err != nil {
+			return err
+		}
+		summary := task.Summarize(executions)
+		t.Summary = &summary
+		return nil
+	})
 }
 
 func (r *TaskRepository) FindAll(ctx context.Context, filters task.TaskFilters) ([]task.Task, error) {
@@ -36,13 +64,24 @@ func (r *TaskRepository) FindAll(ctx context.Context, filters task.TaskFilters)
 		query = query.Where("priority = ?", *filters.Priority)
 	}
 
-	err := query.Order("created_at desc").Find(&tasks).Error
-	return tasks, err
+	if filters.AgentID != nil {
+		query = query.Where("id IN (?)", r.db.Model(&task.Execution{}).Select("task_id").Where("agent_id = ?", *filters.AgentID))
+	}
+
+	if err := query.Order("created_at desc").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	splitEnvSecrets(tasks)
+	if err := r.attachExecutions(ctx, tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
 }
 
 func (r *TaskRepository) FindByStatus(ctx context.Context, status string) ([]task.Task, error) {
 	var tasks []task.Task
 	err := r.db.WithContext(ctx).Where("status = ?", status).Find(&tasks).Error
+	splitEnvSecrets(tasks)
 	return tasks, err
 }
 
@@ -52,14 +91,318 @@ func (r *TaskRepository) FindByID(ctx context.Context, id string) (*task.Task, e
 	if err != nil {
 		return nil, err
 	}
-	return &t, nil
+	tasks := []task.Task{t}
+	splitEnvSecrets(tasks)
+	if err := r.attachExecutions(ctx, tasks); err != nil {
+		return nil, err
+	}
+	return &tasks[0], nil
 }
 
+// Update saves t if its status follows the lifecycle from the stored one.
+// The write only applies while the stored status and attempt are unchanged,
+// so a concurrent claim or expiry is never overwritten.
 func (r *TaskRepository) Update(ctx context.Context, t *task.Task) error {
 	var existing task.Task
 	if err := r.db.WithContext(ctx).First(&existing, "id = ?", t.ID).Error; err != nil {
 		return fmt.Errorf("task not found")
 	}
+	if t.ExecutionAttemptID != existing.ExecutionAttemptID || t.ClaimedBy != existing.ClaimedBy {
+		return fmt.Errorf("%w: task %s was claimed again", task.ErrLeaseNotHeld, t.ID)
+	}
+	if err := task.ValidateTransition(existing.Status, t.Status); err != nil {
+		return err
+	}
+	if task.IsTerminal(t.Status) {
+		t.LeaseExpiresAt = nil
+	}
+
+	result := r.db.WithContext(ctx).Model(&task.Task{}).
+		Where("id = ? AND status = ? AND execution_attempt_id = ?", existing.ID, existing.Status, existing.ExecutionAttemptID).
+		Select("*").Updates(t)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: task %s changed concurrently", task.ErrLeaseNotHeld, t.ID)
+	}
+	return nil
+}
+
+// Claim expires lapsed leases and then claims every pending task agentID
+// may run: its own executions and tasks targeting no agent. Each claim is a
+// compare-and-swap on the pending status, so concurrent pollers never claim
+// the same task, and gets a fresh execution attempt ID.
+func (r *TaskRepository) Claim(ctx context.Context, agentID string, lease time.Duration) ([]task.Task, error) {
+	now := time.Now().UTC()
+	if _, err := r.ExpireLeases(ctx, now); err != nil {
+		return nil, err
+	}
+	leaseExpiresAt := now.Add(lease)
+
+	var claimed []task.Task
+	var executions []task.Execution
+	err := r.db.WithContext(ctx).Where("agent_id = ? AND status = ?", agentID, task.StatusPending).
+		Order("created_at asc").Find(&executions).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, execution := range executions {
+		attemptID := newAttemptID()
+		var t task.Task
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&task.Execution{}).Where("id = ? AND status = ?", execution.ID, task.StatusPending).
+				Updates(map[string]any{"status": task.StatusClaimed, "attempt_id": attemptID, "lease_expires_at": leaseExpiresAt})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			if err := rollUpExecutions(tx, execution.TaskID); err != nil {
+				return err
+			}
+			return tx.First(&t, "id = ?", execution.TaskID).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		if t.ID == "" {
+			continue
+		}
+		t.ExecutionAttemptID = attemptID
+		t.Status = task.StatusClaimed
+		t.ClaimedBy = agentID
+		t.LeaseExpiresAt = &leaseExpiresAt
+		t.Output, t.Error, t.ExitCode = "", "", 0
+		claimed = append(claimed, t)
+	}
+
+	var candidates []task.Task
+	targeted := r.db.WithContext(ctx).Model(&task.Execution{}).Select("task_id")
+	err = r.db.WithContext(ctx).Where("status = ? AND id NOT IN (?)", task.StatusPending, targeted).
+		Order("priority desc, created_at asc").Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range candidates {
+		attemptID := newAttemptID()
+		result := r.db.WithContext(ctx).Model(&task.Task{}).Where("id = ? AND status = ?", t.ID, task.StatusPending).
+			Updates(map[string]any{
+				"status":               task.StatusClaimed,
+				"claimed_by":           agentID,
+				"execution_attempt_id": attemptID,
+				"lease_expires_at":     leaseExpiresAt,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		t.Status = task.StatusClaimed
+		t.ClaimedBy = agentID
+		t.ExecutionAttemptID = attemptID
+		t.LeaseExpiresAt = &leaseExpiresAt
+		claimed = append(claimed, t)
+	}
+	splitEnvSecrets(claimed)
+	if err := r.attachSecrets(ctx, agentID, claimed); err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// ExpireLeases requeues claimed tasks and executions whose lease lapsed
+// before now and times out running ones, which may already have run. It
+// returns how many were changed.
+func (r *TaskRepository) ExpireLeases(ctx context.Context, now time.Time) (int64, error) {
+	var changed int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&task.Task{}).Where("status = ? AND lease_expires_at < ?", task.StatusClaimed, now).
+			Updates(map[string]any{"status": task.StatusPending, "claimed_by": "", "execution_attempt_id": "", "lease_expires_at": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		changed += result.RowsAffected
+		result = tx.Model(&task.Task{}).Where("status = ? AND lease_expires_at < ?", task.StatusRunning, now).
+			Updates(map[string]any{"status": task.StatusTimedOut, "lease_expires_at": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		changed += result.RowsAffected
+
+		var expired []task.Execution
+		err := tx.Where("status IN ? AND lease_expires_at < ?", []string{task.StatusClaimed, task.StatusRunning}, now).
+			Find(&expired).Error
+		if err != nil {
+			return err
+		}
+		parents := map[string]bool{}
+		for _, execution := range expired {
+			updates := map[string]any{"status": task.StatusTimedOut, "lease_expires_at": nil}
+			if execution.Status == task.StatusClaimed {
+				updates = map[string]any{"status": task.StatusPending, "attempt_id": "", "lease_expires_at": nil}
+			}
+			if err := tx.Model(&task.Execution{}).Where("id = ?", execution.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			parents[execution.TaskID] = true
+			changed++
+		}
+		for taskID := range parents {
+			if err := rollUpExecutions(tx, taskID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return changed, err
+}
+
+func (r *TaskRepository) FindExecutions(ctx context.Context, taskID string) ([]task.Execution, error) {
+	var executions []task.Execution
+	err := r.db.WithContext(ctx).Where("task_id = ?", taskID).Order("agent_id asc").Find(&executions).Error
+	return executions, err
+}
+
+// UpdateExecution moves agentID's execution of taskID along the lifecycle.
+// A non-empty result.AttemptID must match the current claim.
+func (r *TaskRepository) UpdateExecution(ctx context.Context, taskID, agentID string, result task.Execution) (*task.Execution, error) {
+	var execution task.Execution
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&execution, "task_id = ? AND agent_id = ?", taskID, agentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return task.ErrExecutionNotFound
+			}
+			return err
+		}
+		if result.AttemptID != "" && result.AttemptID != execution.AttemptID {
+			return fmt.Errorf("%w: attempt %s is no longer current", task.ErrLeaseNotHeld, result.AttemptID)
+		}
+		if err := task.ValidateTransition(execution.Status, result.Status); err != nil {
+			return err
+		}
+
+		previousStatus := execution.Status
+		execution.Status = result.Status
+		execution.Output = result.Output
+		execution.Error = result.Error
+		execution.ExitCode = result.ExitCode
+		execution.LeaseExpiresAt = result.LeaseExpiresAt
+		if task.IsTerminal(execution.Status) {
+			execution.LeaseExpiresAt = nil
+		}
+		updated := tx.Model(&task.Execution{}).
+			Where("id = ? AND status = ? AND attempt_id = ?", execution.ID, previousStatus, execution.AttemptID).
+			Select("*").Updates(&execution)
+		if updated.Error != nil {
+			return updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return fmt.Errorf("%w: execution %s changed concurrently", task.ErrLeaseNotHeld, execution.ID)
+		}
+		return rollUpExecutions(tx, taskID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &execution, nil
+}
+
+// rollUpExecutions sets a targeted task's status from its executions.
+func rollUpExecutions(tx *gorm.DB, taskID string) error {
+	var executions []task.Execution
+	if err := tx.Where("task_id = ?", taskID).Find(&executions).Error; err != nil {
+		return err
+	}
+	return tx.Model(&task.Task{}).Where("id = ?", taskID).
+		Update("status", task.Summarize(executions).Status()).Error
+}
+
+// attachExecutions fills in the agent IDs and execution summary of every
+// targeted task in tasks.
+func (r *TaskRepository) attachExecutions(ctx context.Context, tasks []task.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.ID)
+	}
+	var executions []task.Execution
+	if err := r.db.WithContext(ctx).Where("task_id IN ?", ids).Order("agent_id asc").Find(&executions).Error; err != nil {
+		return err
+	}
+	byTask := make(map[string][]task.Execution)
+	for _, execution := range executions {
+		byTask[execution.TaskID] = append(byTask[execution.TaskID], execution)
+	}
+	for i := range tasks {
+		taskExecutions, ok := byTask[tasks[i].ID]
+		if !ok {
+			continue
+		}
+		summary := task.Summarize(taskExecutions)
+		tasks[i].Summary = &summary
+		tasks[i].AgentIDs = make([]string, 0, len(taskExecutions))
+		for _, execution := range taskExecutions {
+			tasks[i].AgentIDs = append(tasks[i].AgentIDs, execution.AgentID)
+		}
+	}
+	return nil
+}
+
+// attachSecrets attaches the secrets each claimed task references, as
+// sealed for agentID. A secret the agent does not have is left out; the
+// agent then fails the task.
+func (r *TaskRepository) attachSecrets(ctx context.Context, agentID string, tasks []task.Task) error {
+	references := make([][]string, len(tasks))
+	var names []string
+	for i, t := range tasks {
+		// A task with an invalid reference is failed by the agent too
+		references[i], _ = secret.References(t.Command, t.EnvSecrets)
+		names = append(names, references[i]...)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	var secrets []secret.Secret
+	if err := r.db.WithContext(ctx).Where("agent_id = ? AND name IN ?", agentID, names).Find(&secrets).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]secret.Secret, len(secrets))
+	for _, s := range secrets {
+		byName[s.Name] = s
+	}
+	for i := range tasks {
+		for _, name := range references[i] {
+			if s, ok := byName[name]; ok {
+				tasks[i].Secrets = append(tasks[i].Secrets, task.Secret{ID: s.ID, Name: s.Name, ValueEnc: s.ValueEnc})
+			}
+		}
+	}
+	return nil
+}
+
+// splitEnvSecrets decodes the stored env secrets of tasks.
+func splitEnvSecrets(tasks []task.Task) {
+	for i := range tasks {
+		tasks[i].EnvSecrets = task.SplitSecrets(tasks[i].EnvSecretList)
+	}
+}
+
+func uniqueAgentIDs(agentIDs []string) []string {
+	seen := make(map[string]bool, len(agentIDs))
+	unique := make([]string, 0, len(agentIDs))
+	for _, agentID := range agentIDs {
+		if agentID == "" || seen[agentID] {
+			continue
+		}
+		seen[agentID] = true
+		unique = append(unique, agentID)
+	}
+	return unique
+}
 
-	return r.db.WithContext(ctx).Save(t).Error
+func newAttemptID() string {
+	return "att_" + ulid.Make().String()
 }
@@ -2,9 +2,13 @@ package gorm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
+	"hostlink/domain/secret"
 	"hostlink/domain/task"
 
 	"github.com/glebarez/sqlite"
@@ -108,10 +112,8 @@ func TestTaskRepository_FindAll(t *testing.T) {
 		repo.Create(context.Background(), task2)
 		repo.Create(context.Background(), task3)
 
-		task1.Status = "completed"
-		repo.Update(context.Background(), task1)
-		task2.Status = "failed"
-		repo.Update(context.Background(), task2)
+		finishTask(t, repo, task1, "completed")
+		finishTask(t, repo, task2, "failed")
 
 		pendingStatus := "pending"
 		filters := task.TaskFilters{Status: &pendingStatus}
@@ -165,8 +167,7 @@ func TestTaskRepository_FindAll(t *testing.T) {
 		repo.Create(context.Background(), task2)
 		repo.Create(context.Background(), task3)
 
-		task2.Status = "completed"
-		repo.Update(context.Background(), task2)
+		finishTask(t, repo, task2, "completed")
 
 		pendingStatus := "pending"
 		priority := 2
@@ -216,8 +217,7 @@ func TestTaskRepository_FindByStatus(t *testing.T) {
 		repo.Create(context.Background(), task1)
 		repo.Create(context.Background(), task2)
 
-		task1.Status = "completed"
-		repo.Update(context.Background(), task1)
+		finishTask(t, repo, task1, "completed")
 
 		pendingTasks, err := repo.FindByStatus(context.Background(), "pending")
 		if err != nil {
@@ -284,6 +284,7 @@ func TestTaskRepository_Update(t *testing.T) {
 
 		newTask := &task.Task{Command: "original", Priority: 1}
 		repo.Create(context.Background(), newTask)
+		finishTask(t, repo, newTask, task.StatusClaimed)
 
 		newTask.Status = "completed"
 		newTask.Output = "success"
@@ -319,6 +320,267 @@ func TestTaskRepository_Update(t *testing.T) {
 	})
 }
 
+func TestTaskRepository_Executions(t *testing.T) {
+	t.Run("creates one execution per unique agent", func(t *testing.T) {
+		db := setupTaskTestDB(t)
+		repo := NewTaskRepository(db)
+
+		newTask := &task.Task{Command: "uptime", AgentIDs: []string{"agt_1", "agt_2", "agt_1", ""}}
+		if err := repo.Create(context.Background(), newTask); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		executions, err := repo.FindExecutions(context.Background(), newTask.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(executions) != 2 {
+			t.Fatalf("Expected 2 executions, got: %d", len(executions))
+		}
+		for _, execution := range executions {
+			if execution.Status != "pending" || execution.ID == "" {
+				t.Errorf("Expected pending execution with ID, got: %+v", execution)
+			}
+		}
+		if newTask.Summary == nil || newTask.Summary.Total != 2 {
+			t.Errorf("Expected summary of 2 executions, got: %+v", newTask.Summary)
+		}
+	})
+
+	t.Run("agents claim their own executions and untargeted tasks", func(t *testing.T) {
+		db := setupTaskTestDB(t)
+		repo := NewTaskRepository(db)
+		ctx := context.Background()
+
+		mine := &task.Task{Command: "mine", AgentIDs: []string{"agt_1"}}
+		theirs := &task.Task{Command: "theirs", AgentIDs: []string{"agt_2"}}
+		broadcast := &task.Task{Command: "everyone"}
+		for _, tsk := range []*task.Task{mine, theirs, broadcast} {
+			if err := repo.Create(ctx, tsk); err != nil {
+				t.Fatalf("Failed to create task: %v", err)
+			}
+		}
+
+		tasks, err := repo.Claim(ctx, "agt_1", time.Minute)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(tasks) != 2 {
+			t.Fatalf("Expected 2 tasks, got: %d", len(tasks))
+		}
+		for _, tsk := range tasks {
+			if tsk.ID != mine.ID && tsk.ID != broadcast.ID {
+				t.Errorf("Unexpected task %s for agent", tsk.Command)
+			}
+			if tsk.Status != task.StatusClaimed || tsk.ExecutionAttemptID == "" || tsk.LeaseExpiresAt == nil {
+				t.Errorf("Expected claimed task with attempt and lease, got: %+v", tsk)
+			}
+		}
+
+		again, err := repo.Claim(ctx, "agt_2", time.Minute)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(again) != 1 || again[0].ID != theirs.ID {
+			t.Errorf("Expected agt_2 to claim only its own task, got: %+v", again)
+		}
+	})
+
+	t.Run("filters tasks by targeted agent", func(t *testing.T) {
+		db := setupTaskTestDB(t)
+		repo := NewTaskRepository(db)
+		ctx := context.Background()
+
+		mine := &task.Task{Command: "mine", AgentIDs: []string{"agt_1", "agt_2"}}
+		if err := repo.Create(ctx, mine); err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+		if err := repo.Create(ctx, &task.Task{Command: "theirs", AgentIDs: []string{"agt_2"}}); err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+
+		agentID := "agt_1"
+		tasks, err := repo.FindAll(ctx, task.TaskFilters{AgentID: &agentID})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(tasks) != 1 || tasks[0].ID != mine.ID {
+			t.Fatalf("Expected only the task targeting agt_1, got: %+v", tasks)
+		}
+		if tasks[0].Summary == nil || tasks[0].Summary.Total != 2 {
+			t.Errorf("Expected summary of 2 executions, got: %+v", tasks[0].Summary)
+		}
+	})
+
+	t.Run("records results per agent and aggregates parent status", func(t *testing.T) {
+		db := setupTaskTestDB(t)
+		repo := NewTaskRepository(db)
+		ctx := context.Background()
+
+		newTask := &task.Task{Command: "uptime", AgentIDs: []string{"agt_1", "agt_2"}}
+		if err := repo.Create(ctx, newTask); err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+
+		if _, err := repo.Claim(ctx, "agt_1", time.Minute); err != nil {
+			t.Fatalf("Failed to claim: %v", err)
+		}
+		if _, err := repo.Claim(ctx, "agt_2", time.Minute); err != nil {
+			t.Fatalf("Failed to claim: %v", err)
+		}
+		if _, err := repo.UpdateExecution(ctx, newTask.ID, "agt_1", task.Execution{Status: "completed", Output: "ok"}); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		found, err := repo.FindByID(ctx, newTask.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if found.Status != task.StatusRunning || found.Summary.Succeeded != 1 || found.Summary.Running != 1 {
+			t.Errorf("Expected 1/2 succeeded and running, got status %s summary %+v", found.Status, found.Summary)
+		}
+
+		if _, err := repo.UpdateExecution(ctx, newTask.ID, "agt_2", task.Execution{Status: "completed", ExitCode: 1}); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		found, err = repo.FindByID(ctx, newTask.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if found.Status != "failed" || found.Summary.Succeeded != 1 || found.Summary.Failed != 1 {
+			t.Errorf("Expected failed with 1/2 succeeded, got status %s summary %+v", found.Status, found.Summary)
+		}
+		if len(found.AgentIDs) != 2 {
+			t.Errorf("Expected 2 agent IDs, got: %v", found.AgentIDs)
+		}
+
+		_, err = repo.UpdateExecution(ctx, newTask.ID, "agt_3", task.Execution{Status: "completed"})
+		if !errors.Is(err, task.ErrExecutionNotFound) {
+			t.Errorf("Expected ErrExecutionNotFound, got: %v", err)
+		}
+	})
+}
+
+func TestTaskRepository_Lifecycle(t *testing.T) {
+	t.Run("rejects transitions the lifecycle does not allow", func(t *testing.T) {
+		db := setupTaskTestDB(t)
+		repo := NewTaskRepository(db)
+
+		newTask := &task.Task{Command: "uptime"}
+		repo.Create(context.Background(), newTask)
+
+		newTask.Status = task.StatusCompleted
+		err := repo.Update(context.Background(), newTask)
+		if !errors.Is(err, task.ErrInvalidTransition) {
+			t.Fatalf("Expected ErrInvalidTransition, got: %v", err)
+		}
+	})
+
+	t.Run("concurrent pollers never claim the same task", func(t *testing.T) {
+		db := setupTaskTestDB(t)
+		repo := NewTaskRepository(db)
+		ctx := context.Background()
+
+		for i := 0; i < 5; i++ {
+			if err := repo.Create(ctx, &task.Task{Command: fmt.Sprintf("task%d", i)}); err != nil {
+				t.Fatalf("Failed to create task: %v", err)
+			}
+		}
+
+		var mu sync.Mutex
+		claims := map[string]int{}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(agentID string) {
+				defer wg.Done()
+				tasks, err := repo.Claim(ctx, agentID, time.Minute)
+				if err != nil {
+					t.Errorf("Claim failed: %v", err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				for _, tsk := range tasks {
+					claims[tsk.ID]++
+				}
+			}(fmt.Sprintf("agt_%d", i))
+		}
+		wg.Wait()
+
+		if len(claims) != 5 {
+			t.Errorf("Expected all 5 tasks claimed, got: %d", len(claims))
+		}
+		for id, count := range claims {
+			if count != 1 {
+				t.Errorf("Task %s claimed %d times", id, count)
+			}
+		}
+	})
+
+	t.Run("requeues lapsed claims with a new attempt and times out lapsed runs", func(t *testing.T) {
+		db := setupTaskTestDB(t)
+		repo := NewTaskRepository(db)
+		ctx := context.Background()
+
+		claimedTask := &task.Task{Command: "claimed", Priority: 2}
+		runningTask := &task.Task{Command: "running", Priority: 1}
+		repo.Create(ctx, claimedTask)
+		repo.Create(ctx, runningTask)
+
+		first, err := repo.Claim(ctx, "agt_1", time.Minute)
+		if err != nil || len(first) != 2 {
+			t.Fatalf("Expected 2 claimed tasks, got: %d (%v)", len(first), err)
+		}
+		running := first[1]
+		running.Status = task.StatusRunning
+		if err := repo.Update(ctx, &running); err != nil {
+			t.Fatalf("Failed to start task: %v", err)
+		}
+		db.Model(&task.Task{}).Where("1 = 1").Update("lease_expires_at", time.Now().Add(-time.Second))
+
+		second, err := repo.Claim(ctx, "agt_2", time.Minute)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(second) != 1 || second[0].ID != claimedTask.ID {
+			t.Fatalf("Expected the lapsed claim to be requeued to agt_2, got: %+v", second)
+		}
+		if second[0].ExecutionAttemptID == first[0].ExecutionAttemptID {
+			t.Error("Expected a new execution attempt ID for the new claim")
+		}
+
+		timedOut, _ := repo.FindByID(ctx, runningTask.ID)
+		if timedOut.Status != task.StatusTimedOut {
+			t.Errorf("Expected lapsed running task to time out, got: %s", timedOut.Status)
+		}
+
+		stale := first[0]
+		stale.Status = task.StatusCompleted
+		if err := repo.Update(ctx, &stale); !errors.Is(err, task.ErrLeaseNotHeld) {
+			t.Errorf("Expected ErrLeaseNotHeld for the stale attempt, got: %v", err)
+		}
+	})
+}
+
+// finishTask claims t and moves it to status.
+func finishTask(t *testing.T, repo task.Repository, tsk *task.Task, status string) {
+	t.Helper()
+
+	claimed := *tsk
+	claimed.Status = task.StatusClaimed
+	if err := repo.Update(context.Background(), &claimed); err != nil {
+		t.Fatalf("Failed to claim task: %v", err)
+	}
+	if status == task.StatusClaimed {
+		*tsk = claimed
+		return
+	}
+	tsk.Status = status
+	if err := repo.Update(context.Background(), tsk); err != nil {
+		t.Fatalf("Failed to move task to %s: %v", status, err)
+	}
+}
+
 func setupTaskTestDB(t *testing.T) *gorm.DB {
 	t.Helper()
 
@@ -328,10 +590,74 @@ func setupTaskTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	err = db.AutoMigrate(&task.Task{})
+	err = db.AutoMigrate(&task.Task{}, &task.Execution{})
 	if err != nil {
 		t.Fatalf("Failed to migrate: %v", err)
 	}
 
 	return db
 }
+
+func TestTaskRepository_ClaimAttachesSecrets(t *testing.T) {
+	db := setupTaskTestDB(t)
+	if err := db.AutoMigrate(&secret.Secret{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	repo := NewTaskRepository(db)
+	secrets := NewSecretRepository(db)
+	ctx := context.Background()
+
+	for _, s := range []*secret.Secret{
+		{AgentID: "agt_1", Name: "db_password", ValueEnc: "enc-db-1"},
+		{AgentID: "agt_1", Name: "api_token", ValueEnc: "enc-api-1"},
+		{AgentID: "agt_1", Name: "unused", ValueEnc: "enc-unused-1"},
+		{AgentID: "agt_2", Name: "db_password", ValueEnc: "enc-db-2"},
+	} {
+		if err := secrets.Save(ctx, s); err != nil {
+			t.Fatalf("Failed to save secret: %v", err)
+		}
+	}
+
+	newTask := &task.Task{
+		Command:    `psql "postgres://app:{{secret:db_password}}@db/app"`,
+		EnvSecrets: []string{"api_token"},
+		AgentIDs:   []string{"agt_1", "agt_2"},
+	}
+	if err := repo.Create(ctx, newTask); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	found, err := repo.FindByID(ctx, newTask.ID)
+	if err != nil {
+		t.Fatalf("Failed to find task: %v", err)
+	}
+	if len(found.EnvSecrets) != 1 || found.EnvSecrets[0] != "api_token" {
+		t.Errorf("Expected env secrets to be stored, got: %v", found.EnvSecrets)
+	}
+	if len(found.Secrets) != 0 {
+		t.Errorf("Expected no secrets outside a claim, got: %v", found.Secrets)
+	}
+
+	claimed, err := repo.Claim(ctx, "agt_1", time.Minute)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if len(claimed) != 1 {
+		t.Fatalf("Expected 1 claimed task, got: %d", len(claimed))
+	}
+	got := map[string]string{}
+	for _, s := range claimed[0].Secrets {
+		got[s.Name] = s.ValueEnc
+	}
+	if len(got) != 2 || got["db_password"] != "enc-db-1" || got["api_token"] != "enc-api-1" {
+		t.Errorf("Expected the referenced secrets of agt_1, got: %v", claimed[0].Secrets)
+	}
+
+	claimed, err = repo.Claim(ctx, "agt_2", time.Minute)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if len(claimed) != 1 || len(claimed[0].Secrets) != 1 || claimed[0].Secrets[0].ValueEnc != "enc-db-2" {
+		t.Errorf("Expected only agt_2's db_password, got: %+v", claimed)
+	}
+}
@@ -0,0 +1,107 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"hostlink/domain/webhook"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) webhook.Repository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, s *webhook.Subscription) error {
+	s.ID = "whk_" + ulid.Make().String()
+	s.EventFilter = webhook.JoinEvents(s.Events)
+	return r.db.WithContext(ctx).Create(s).Error
+}
+
+func (r *WebhookRepository) UpdateSubscription(ctx context.Context, s *webhook.Subscription) error {
+	s.EventFilter = webhook.JoinEvents(s.Events)
+	return r.db.WithContext(ctx).Save(s).Error
+}
+
+// DeleteSubscription soft-deletes a subscription. Its pending deliveries
+// are dropped, while the delivery log is kept.
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&webhook.Subscription{}).Where("id = ? AND deleted_at IS NULL", id).
+			Updates(map[string]any{"deleted_at": time.Now(), "active": false})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return webhook.ErrSubscriptionNotFound
+		}
+		return tx.Model(&webhook.Delivery{}).
+			Where("subscription_id = ? AND status = ?", id, webhook.DeliveryPending).
+			Updates(map[string]any{"status": webhook.DeliveryFailed, "last_error": "subscription deleted"}).Error
+	})
+}
+
+func (r *WebhookRepository) FindSubscription(ctx context.Context, id string) (*webhook.Subscription, error) {
+	var s webhook.Subscription
+	err := r.db.WithContext(ctx).Where("id = ? AND deleted_at IS NULL", id).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, webhook.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Events = webhook.SplitEvents(s.EventFilter)
+	return &s, nil
+}
+
+func (r *WebhookRepository) FindSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	subscriptions := []webhook.Subscription{}
+	err := r.db.WithContext(ctx).Where("deleted_at IS NULL").Order("created_at asc").Find(&subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		subscriptions[i].Events = webhook.SplitEvents(subscriptions[i].EventFilter)
+	}
+	return subscriptions, nil
+}
+
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, deliveries []webhook.Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	for i := range deliveries {
+		deliveries[i].ID = "whd_" + ulid.Make().String()
+	}
+	return r.db.WithContext(ctx).Create(&deliveries).Error
+}
+
+func (r *WebhookRepository) FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]webhook.Delivery, error) {
+	var deliveries []webhook.Delivery
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", webhook.DeliveryPending, now).
+		Order("next_attempt_at asc, id asc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, d *webhook.Delivery) error {
+	return r.db.WithContext(ctx).Save(d).Error
+}
+
+func (r *WebhookRepository) FindDeliveries(ctx context.Context, subscriptionID string, limit int) ([]webhook.Delivery, error) {
+	deliveries := []webhook.Delivery{}
+	query := r.db.WithContext(ctx).Where("subscription_id = ?", subscriptionID).Order("created_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
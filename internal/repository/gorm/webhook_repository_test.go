@@ -0,0 +1,130 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hostlink/domain/webhook"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupWebhookTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dbName := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&webhook.Subscription{}, &webhook.Delivery{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	return db
+}
+
+func TestWebhookRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Create and find subscriptions", func(t *testing.T) {
+		repo := NewWebhookRepository(setupWebhookTestDB(t))
+		s := &webhook.Subscription{
+			URL:    "https://hooks.example.com/a",
+			Secret: "secret",
+			Events: []string{webhook.EventTaskFailed, webhook.EventAgentOffline},
+			Active: true,
+		}
+		if err := repo.CreateSubscription(ctx, s); err != nil {
+			t.Fatalf("CreateSubscription: %v", err)
+		}
+		if !strings.HasPrefix(s.ID, "whk_") {
+			t.Errorf("ID = %q, want whk_ prefix", s.ID)
+		}
+
+		found, err := repo.FindSubscription(ctx, s.ID)
+		if err != nil {
+			t.Fatalf("FindSubscription: %v", err)
+		}
+		if len(found.Events) != 2 || found.Events[1] != webhook.EventAgentOffline {
+			t.Errorf("Events = %v", found.Events)
+		}
+
+		all, err := repo.FindSubscriptions(ctx)
+		if err != nil {
+			t.Fatalf("FindSubscriptions: %v", err)
+		}
+		if len(all) != 1 || !all[0].Matches(webhook.EventTaskFailed) {
+			t.Errorf("FindSubscriptions = %+v", all)
+		}
+	})
+
+	t.Run("Delete hides the subscription and fails its pending deliveries", func(t *testing.T) {
+		repo := NewWebhookRepository(setupWebhookTestDB(t))
+		s := &webhook.Subscription{URL: "https://hooks.example.com/b", Events: []string{webhook.EventTaskCompleted}, Active: true}
+		if err := repo.CreateSubscription(ctx, s); err != nil {
+			t.Fatalf("CreateSubscription: %v", err)
+		}
+		deliveries := []webhook.Delivery{{SubscriptionID: s.ID, EventType: webhook.EventTaskCompleted, Status: webhook.DeliveryPending, NextAttemptAt: time.Now()}}
+		if err := repo.CreateDeliveries(ctx, deliveries); err != nil {
+			t.Fatalf("CreateDeliveries: %v", err)
+		}
+
+		if err := repo.DeleteSubscription(ctx, s.ID); err != nil {
+			t.Fatalf("DeleteSubscription: %v", err)
+		}
+		if _, err := repo.FindSubscription(ctx, s.ID); !errors.Is(err, webhook.ErrSubscriptionNotFound) {
+			t.Errorf("FindSubscription error = %v, want ErrSubscriptionNotFound", err)
+		}
+		if err := repo.DeleteSubscription(ctx, s.ID); !errors.Is(err, webhook.ErrSubscriptionNotFound) {
+			t.Errorf("second DeleteSubscription error = %v, want ErrSubscriptionNotFound", err)
+		}
+
+		log, err := repo.FindDeliveries(ctx, s.ID, 0)
+		if err != nil {
+			t.Fatalf("FindDeliveries: %v", err)
+		}
+		if len(log) != 1 || log[0].Status != webhook.DeliveryFailed {
+			t.Errorf("deliveries = %+v, want one failed", log)
+		}
+	})
+
+	t.Run("FindDueDeliveries returns pending deliveries that are due", func(t *testing.T) {
+		repo := NewWebhookRepository(setupWebhookTestDB(t))
+		now := time.Now().UTC()
+		deliveries := []webhook.Delivery{
+			{SubscriptionID: "whk_1", EventID: "due", Status: webhook.DeliveryPending, NextAttemptAt: now.Add(-time.Minute)},
+			{SubscriptionID: "whk_1", EventID: "later", Status: webhook.DeliveryPending, NextAttemptAt: now.Add(time.Minute)},
+			{SubscriptionID: "whk_1", EventID: "done", Status: webhook.DeliveryDelivered, NextAttemptAt: now.Add(-time.Minute)},
+		}
+		if err := repo.CreateDeliveries(ctx, deliveries); err != nil {
+			t.Fatalf("CreateDeliveries: %v", err)
+		}
+
+		due, err := repo.FindDueDeliveries(ctx, now, 10)
+		if err != nil {
+			t.Fatalf("FindDueDeliveries: %v", err)
+		}
+		if len(due) != 1 || due[0].EventID != "due" {
+			t.Fatalf("due = %+v, want only the due delivery", due)
+		}
+
+		due[0].Status = webhook.DeliveryDelivered
+		due[0].Attempts = 1
+		if err := repo.UpdateDelivery(ctx, &due[0]); err != nil {
+			t.Fatalf("UpdateDelivery: %v", err)
+		}
+		due, err = repo.FindDueDeliveries(ctx, now, 10)
+		if err != nil {
+			t.Fatalf("FindDueDeliveries: %v", err)
+		}
+		if len(due) != 0 {
+			t.Errorf("due after delivery = %+v, want none", due)
+		}
+	})
+}
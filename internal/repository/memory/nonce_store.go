@@ -0,0 +1,89 @@
+// Package memory holds in-process implementations of domain repositories,
+// for single-server deployments that do not need them shared.
+package memory
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type nonceKey struct {
+	agentID string
+	value   string
+}
+
+type nonceEntry struct {
+	key      nonceKey
+	signedAt time.Time
+}
+
+// NonceStore remembers nonces in memory, up to a fixed number. When full,
+// it forgets the least recently used nonce first, so its capacity should
+// cover every request agents sign within the accepted timestamp window.
+type NonceStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[nonceKey]*list.Element
+	now      func() time.Time
+}
+
+func NewNonceStore(capacity int) *NonceStore {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &NonceStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[nonceKey]*list.Element),
+		now:      time.Now,
+	}
+}
+
+func (s *NonceStore) Remember(ctx context.Context, agentID, value string, signedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := nonceKey{agentID: agentID, value: value}
+	if elem, ok := s.entries[key]; ok {
+		s.order.MoveToFront(elem)
+		return false, nil
+	}
+
+	for s.order.Len() >= s.capacity {
+		s.remove(s.order.Back())
+	}
+	s.entries[key] = s.order.PushFront(&nonceEntry{key: key, signedAt: signedAt})
+	return true, nil
+}
+
+func (s *NonceStore) DeleteExpired(ctx context.Context, olderThan time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := s.now().Add(-olderThan)
+	var deleted int64
+	for elem := s.order.Back(); elem != nil; {
+		prev := elem.Prev()
+		if elem.Value.(*nonceEntry).signedAt.Before(cutoff) {
+			s.remove(elem)
+			deleted++
+		}
+		elem = prev
+	}
+	return deleted, nil
+}
+
+// Len returns how many nonces are remembered.
+func (s *NonceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+func (s *NonceStore) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.entries, elem.Value.(*nonceEntry).key)
+}
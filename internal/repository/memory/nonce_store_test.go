@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"hostlink/domain/nonce"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ nonce.Store = (*NonceStore)(nil)
+
+func TestNonceStore_Remember(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rejects a nonce the agent already used", func(t *testing.T) {
+		store := NewNonceStore(10)
+
+		fresh, err := store.Remember(ctx, "agt_1", "nonce-1", time.Now())
+		require.NoError(t, err)
+		assert.True(t, fresh)
+
+		fresh, _ = store.Remember(ctx, "agt_1", "nonce-1", time.Now())
+		assert.False(t, fresh)
+		fresh, _ = store.Remember(ctx, "agt_2", "nonce-1", time.Now())
+		assert.True(t, fresh, "nonces are tracked per agent")
+	})
+
+	t.Run("forgets the least recently used nonce when full", func(t *testing.T) {
+		store := NewNonceStore(2)
+		store.Remember(ctx, "agt_1", "a", time.Now())
+		store.Remember(ctx, "agt_1", "b", time.Now())
+		// A replay attempt counts as a use, so a stays
+		store.Remember(ctx, "agt_1", "a", time.Now())
+
+		store.Remember(ctx, "agt_1", "c", time.Now())
+
+		assert.Equal(t, 2, store.Len())
+		fresh, _ := store.Remember(ctx, "agt_1", "a", time.Now())
+		assert.False(t, fresh)
+		fresh, _ = store.Remember(ctx, "agt_1", "b", time.Now())
+		assert.True(t, fresh)
+	})
+
+	t.Run("lets only one concurrent use through", func(t *testing.T) {
+		store := NewNonceStore(100)
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		accepted := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if fresh, _ := store.Remember(ctx, "agt_1", "nonce-1", time.Now()); fresh {
+					mu.Lock()
+					accepted++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, accepted)
+	})
+}
+
+func TestNonceStore_DeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewNonceStore(10)
+	store.now = func() time.Time { return now }
+	for i, age := range []time.Duration{10 * time.Minute, time.Minute, 6 * time.Minute, 0} {
+		store.Remember(ctx, "agt_1", fmt.Sprint(i), now.Add(-age))
+	}
+
+	deleted, err := store.DeleteExpired(ctx, 5*time.Minute)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	assert.Equal(t, 2, store.Len())
+	fresh, _ := store.Remember(ctx, "agt_1", "1", now)
+	assert.False(t, fresh, "unexpired nonces are kept")
+}
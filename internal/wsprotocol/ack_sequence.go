@@ -6,6 +6,20 @@ type AckPayload struct {
 	TaskID                string      `json:"task_id,omitempty"`
 	ExecutionAttemptID    string      `json:"execution_attempt_id,omitempty"`
 	HighestOutputSequence *int        `json:"highest_output_sequence,omitempty"`
+	// OutputCredit, when present, adds to the agent's output window.
+	OutputCredit *OutputCredit `json:"output_credit,omitempty"`
+	// AckedRanges acknowledges output in bulk, typically a whole output.batch.
+	AckedRanges []OutputAckRange `json:"acked_ranges,omitempty"`
+}
+
+// OutputAckRange acknowledges every output sequence from FirstSequence to
+// LastSequence inclusive on one stream of an execution attempt.
+type OutputAckRange struct {
+	TaskID             string `json:"task_id"`
+	ExecutionAttemptID string `json:"execution_attempt_id"`
+	Stream             Stream `json:"stream"`
+	FirstSequence      int    `json:"first_sequence"`
+	LastSequence       int    `json:"last_sequence"`
 }
 
 type AckOptions struct {
@@ -14,6 +28,8 @@ type AckOptions struct {
 	TaskID                string
 	ExecutionAttemptID    string
 	HighestOutputSequence *int
+	OutputCredit          *OutputCredit
+	AckedRanges           []OutputAckRange
 }
 
 type ErrorPayload struct {
@@ -73,7 +89,32 @@ func BuildAck(opts AckOptions) AckPayload {
 		TaskID:                opts.TaskID,
 		ExecutionAttemptID:    opts.ExecutionAttemptID,
 		HighestOutputSequence: opts.HighestOutputSequence,
+		OutputCredit:          opts.OutputCredit,
+		AckedRanges:           opts.AckedRanges,
+	}
+}
+
+// BuildOutputAckRanges collapses the chunks of a batch into the fewest ranges
+// of consecutive sequences per stream, in first-seen order.
+func BuildOutputAckRanges(chunks []OutputBatchChunk) []OutputAckRange {
+	var ranges []OutputAckRange
+	open := make(map[sequenceKey]int)
+	for _, chunk := range chunks {
+		key := sequenceKey{executionAttemptID: chunk.ExecutionAttemptID, stream: chunk.Stream}
+		if i, ok := open[key]; ok && ranges[i].TaskID == chunk.TaskID && ranges[i].LastSequence+1 == chunk.Sequence {
+			ranges[i].LastSequence = chunk.Sequence
+			continue
+		}
+		open[key] = len(ranges)
+		ranges = append(ranges, OutputAckRange{
+			TaskID:             chunk.TaskID,
+			ExecutionAttemptID: chunk.ExecutionAttemptID,
+			Stream:             chunk.Stream,
+			FirstSequence:      chunk.Sequence,
+			LastSequence:       chunk.Sequence,
+		})
 	}
+	return ranges
 }
 
 func BuildError(opts ErrorOptions) ErrorPayload {
@@ -26,6 +26,27 @@ func TestAcknowledgementPayload(t *testing.T) {
 	}
 }
 
+func TestAckPayloadCarriesOutputCredit(t *testing.T) {
+	payload := BuildAck(AckOptions{
+		AckedMessageID: "msg_123",
+		AckedType:      TypeTaskOutput,
+		OutputCredit:   &OutputCredit{Bytes: 65536, Messages: 8},
+	})
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("marshal ack: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal ack: %v", err)
+	}
+	want := map[string]any{"bytes": float64(65536), "messages": float64(8)}
+	if !reflect.DeepEqual(decoded["output_credit"], want) {
+		t.Fatalf("output_credit = %#v, want %#v", decoded["output_credit"], want)
+	}
+}
+
 func TestSampleAckPayloadUsesCanonicalFieldNames(t *testing.T) {
 	payload := BuildAck(AckOptions{
 		AckedMessageID:        "msg_123",
@@ -143,3 +164,26 @@ func TestOutputSequenceTracker(t *testing.T) {
 		}
 	})
 }
+
+func TestBuildOutputAckRangesCollapsesContiguousSequences(t *testing.T) {
+	chunks := []OutputBatchChunk{
+		{TaskID: "tsk_1", ExecutionAttemptID: "attempt_1", Stream: StreamStdout, Sequence: 4},
+		{TaskID: "tsk_1", ExecutionAttemptID: "attempt_1", Stream: StreamStderr, Sequence: 1},
+		{TaskID: "tsk_1", ExecutionAttemptID: "attempt_1", Stream: StreamStdout, Sequence: 5},
+		{TaskID: "tsk_2", ExecutionAttemptID: "attempt_2", Stream: StreamStdout, Sequence: 1},
+		{TaskID: "tsk_1", ExecutionAttemptID: "attempt_1", Stream: StreamStdout, Sequence: 6},
+		{TaskID: "tsk_1", ExecutionAttemptID: "attempt_1", Stream: StreamStdout, Sequence: 9},
+	}
+
+	got := BuildOutputAckRanges(chunks)
+
+	want := []OutputAckRange{
+		{TaskID: "tsk_1", ExecutionAttemptID: "attempt_1", Stream: StreamStdout, FirstSequence: 4, LastSequence: 6},
+		{TaskID: "tsk_1", ExecutionAttemptID: "attempt_1", Stream: StreamStderr, FirstSequence: 1, LastSequence: 1},
+		{TaskID: "tsk_2", ExecutionAttemptID: "attempt_2", Stream: StreamStdout, FirstSequence: 1, LastSequence: 1},
+		{TaskID: "tsk_1", ExecutionAttemptID: "attempt_1", Stream: StreamStdout, FirstSequence: 9, LastSequence: 9},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ranges = %#v, want %#v", got, want)
+	}
+}
@@ -18,6 +18,7 @@ const (
 	TypeTaskLeaseHeartbeat MessageType = "task.lease_heartbeat"
 	TypeTaskOutput         MessageType = "task.output"
 	TypeTaskFinal          MessageType = "task.final"
+	TypeOutputBatch        MessageType = "output.batch"
 	TypeAck                MessageType = "ack"
 	TypeError              MessageType = "error"
 )
@@ -40,6 +41,7 @@ const (
 type HelloCapabilities struct {
 	ResultsEnabled  bool `json:"results_enabled"`
 	DeliveryEnabled bool `json:"delivery_enabled"`
+	OutputBatching  bool `json:"output_batching"`
 }
 
 type HelloPayload struct {
@@ -99,6 +101,18 @@ type HelloAckPayload struct {
 	DiscardedAttempts           []DiscardedAttempt      `json:"discarded_attempts"`
 	OutputReplay                []OutputReplayDirective `json:"output_replay"`
 	DeliveryEnabled             bool                    `json:"delivery_enabled"`
+	// OutputCredit sets the session's initial output window. When absent the
+	// server does not flow-control output.
+	OutputCredit *OutputCredit `json:"output_credit,omitempty"`
+	// OutputBatchingEnabled accepts output.batch frames for this session.
+	OutputBatchingEnabled bool `json:"output_batching_enabled,omitempty"`
+}
+
+// OutputCredit grants the agent permission to send more task output. A zero
+// field leaves that dimension unlimited; grants on acks add to the window.
+type OutputCredit struct {
+	Bytes    int64 `json:"bytes,omitempty"`
+	Messages int   `json:"messages,omitempty"`
 }
 
 type DiscardedAttempt struct {
@@ -133,6 +147,23 @@ type OutputPayload struct {
 	TruncatedLocally bool   `json:"truncated_locally,omitempty"`
 }
 
+// OutputBatchPayload packs output chunks from any streams and tasks into one
+// frame. Each chunk keeps the message ID and sequence it would carry as a
+// standalone task.output message.
+type OutputBatchPayload struct {
+	Chunks []OutputBatchChunk `json:"chunks"`
+}
+
+type OutputBatchChunk struct {
+	MessageID          string `json:"message_id"`
+	TaskID             string `json:"task_id"`
+	ExecutionAttemptID string `json:"execution_attempt_id"`
+	Stream             Stream `json:"stream"`
+	Sequence           int    `json:"sequence"`
+	Data               string `json:"data"`
+	ByteCount          int    `json:"byte_count"`
+}
+
 type FinalPayload struct {
 	Status          FinalStatus `json:"status"`
 	ExitCode        int         `json:"exit_code"`
@@ -143,8 +174,18 @@ type FinalPayload struct {
 }
 
 type TaskDeliverPayload struct {
-	Command  string `json:"command"`
-	Priority int    `json:"priority"`
+	Command      string       `json:"command"`
+	Priority     int          `json:"priority"`
+	OutputPolicy string       `json:"output_policy,omitempty"`
+	EnvSecrets   []string     `json:"env_secrets,omitempty"`
+	Secrets      []TaskSecret `json:"secrets,omitempty"`
+}
+
+// TaskSecret is a secret a delivered task uses, sealed for the agent.
+type TaskSecret struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ValueEnc string `json:"value_enc"`
 }
 
 func (e Envelope) Validate(authenticatedAgentID string) error {
@@ -193,6 +234,24 @@ func (p OutputPayload) Validate() error {
 	return nil
 }
 
+func (p OutputBatchPayload) Validate() error {
+	if len(p.Chunks) == 0 {
+		return fmt.Errorf("chunks must not be empty")
+	}
+	for i, chunk := range p.Chunks {
+		if chunk.MessageID == "" || chunk.TaskID == "" || chunk.ExecutionAttemptID == "" {
+			return fmt.Errorf("chunk %d: message_id, task_id and execution_attempt_id are required", i)
+		}
+		if chunk.Sequence < 1 {
+			return fmt.Errorf("chunk %d: sequence must be positive", i)
+		}
+		if err := (OutputPayload{Stream: chunk.Stream, ByteCount: chunk.ByteCount}).Validate(); err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
 func (p FinalPayload) Validate() error {
 	switch p.Status {
 	case FinalStatusCompleted, FinalStatusFailed, FinalStatusInterrupted:
@@ -233,6 +292,7 @@ func IsSupportedType(messageType MessageType) bool {
 		TypeTaskLeaseHeartbeat,
 		TypeTaskOutput,
 		TypeTaskFinal,
+		TypeOutputBatch,
 		TypeAck,
 		TypeError:
 		return true
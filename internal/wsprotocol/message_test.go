@@ -144,6 +144,7 @@ func TestAcceptedMessageTypes(t *testing.T) {
 		TypeTaskLeaseHeartbeat,
 		TypeTaskOutput,
 		TypeTaskFinal,
+		TypeOutputBatch,
 		TypeAck,
 		TypeError,
 	}
@@ -187,6 +188,29 @@ func TestPayloadValidation(t *testing.T) {
 			t.Fatal("expected invalid status error")
 		}
 	})
+
+	t.Run("valid output batch payload", func(t *testing.T) {
+		payload := OutputBatchPayload{Chunks: []OutputBatchChunk{
+			{MessageID: "msg_1", TaskID: "tsk_123", ExecutionAttemptID: "attempt_123", Stream: StreamStdout, Sequence: 1, Data: "ok", ByteCount: 2},
+		}}
+
+		if err := payload.Validate(); err != nil {
+			t.Fatalf("expected output batch payload to validate, got %v", err)
+		}
+	})
+
+	t.Run("invalid output batch chunk", func(t *testing.T) {
+		payload := OutputBatchPayload{Chunks: []OutputBatchChunk{
+			{MessageID: "msg_1", TaskID: "tsk_123", ExecutionAttemptID: "attempt_123", Stream: StreamStdout, Sequence: 0},
+		}}
+
+		if err := payload.Validate(); err == nil {
+			t.Fatal("expected invalid sequence error")
+		}
+		if err := (OutputBatchPayload{}).Validate(); err == nil {
+			t.Fatal("expected empty batch error")
+		}
+	})
 }
 
 func intPtr(value int) *int {
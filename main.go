@@ -2,34 +2,56 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"hostlink/app"
+	"hostlink/app/jobs/agentlivenessjob"
+	"hostlink/app/jobs/certrenewaljob"
 	"hostlink/app/jobs/heartbeatjob"
+	"hostlink/app/jobs/keyrotationjob"
+	"hostlink/app/jobs/metricrollupjob"
 	"hostlink/app/jobs/metricsjob"
+	"hostlink/app/jobs/noncecleanupjob"
 	"hostlink/app/jobs/registrationjob"
 	"hostlink/app/jobs/selfupdatejob"
+	"hostlink/app/jobs/storecompactionjob"
 	"hostlink/app/jobs/taskjob"
+	"hostlink/app/jobs/webhookdeliveryjob"
+	agentService "hostlink/app/service/agent"
+	"hostlink/app/service/certauthority"
+	"hostlink/app/service/metricrollup"
+	webhookService "hostlink/app/service/webhook"
 	"hostlink/app/services/agentstate"
+	"hostlink/app/services/certrenewal"
 	"hostlink/app/services/heartbeat"
+	"hostlink/app/services/keyrotation"
 	"hostlink/app/services/localtaskstore"
 	"hostlink/app/services/metrics"
+	"hostlink/app/services/reqauth"
 	"hostlink/app/services/requestsigner"
 	"hostlink/app/services/rollout"
 	"hostlink/app/services/taskfetcher"
 	"hostlink/app/services/taskreporter"
+	"hostlink/app/services/tasksecrets"
 	"hostlink/app/services/updatecheck"
 	"hostlink/app/services/updatedownload"
 	"hostlink/app/services/updatepreflight"
 	"hostlink/app/services/wsclient"
+	"hostlink/cmd/keycli"
+	"hostlink/cmd/operatorcli"
+	"hostlink/cmd/storecli"
 	"hostlink/cmd/upgrade"
 	"hostlink/config"
 	"hostlink/config/appconf"
 	"hostlink/internal/dbconn"
 	"hostlink/internal/httpclient"
+	gormRepo "hostlink/internal/repository/gorm"
+	"hostlink/internal/repository/memory"
 	"hostlink/internal/update"
 	"hostlink/internal/validator"
 	"hostlink/version"
 	"log"
+	"net/http"
 	"os"
 	"syscall"
 	"time"
@@ -91,6 +113,9 @@ func newApp() *cli.Command {
 				},
 				Action: runUpgrade,
 			},
+			storecli.StoreCommand(),
+			operatorcli.OperatorCommand(),
+			keycli.RotateKeyCommand(),
 		},
 	}
 }
@@ -237,11 +262,43 @@ func runServer(ctx context.Context, cmd *cli.Command) error {
 	defer dbconn.Close()
 
 	container := app.NewContainer(db)
+	container.TaskClaimLease = appconf.TaskClaimLease()
+	container.TaskRunLease = appconf.TaskRunLease()
+	container.RequireOperatorToken = appconf.OperatorAuthRequired()
+	container.RegistrationService.WithEnrollment(container.Enrollment, appconf.EnrollmentTokenRequired()).
+		WithApproval(appconf.RegistrationApprovalEnabled())
+	switch appconf.NonceStore() {
+	case "sql":
+		container.Nonces = gormRepo.NewNonceRepository(db)
+	case "memory":
+		container.Nonces = memory.NewNonceStore(appconf.NonceCacheSize())
+	}
+	container.MinSignatureVersion = appconf.MinSignatureVersion()
+	container.KeyRotation = agentService.NewKeyRotationService(container.AgentRepository, appconf.KeyRotationOverlap())
+	container.MetricRollup = metricrollup.NewService(container.MetricsRepository, metricrollup.Retention{
+		Raw:      appconf.MetricsRawRetention(),
+		Rollup1m: appconf.MetricsRollup1mRetention(),
+		Rollup5m: appconf.MetricsRollup5mRetention(),
+		Rollup1h: appconf.MetricsRollup1hRetention(),
+	})
+	container.Webhooks = webhookService.NewService(container.WebhookRepository, webhookService.Config{
+		MaxAttempts: appconf.WebhookMaxAttempts(),
+		Timeout:     appconf.WebhookTimeout(),
+		MaxBackoff:  appconf.WebhookMaxBackoff(),
+	})
+	container.Liveness = agentService.NewLivenessService(container.AgentRepository, agentService.LivenessThresholds{
+		StaleAfter:   appconf.AgentStaleAfter(),
+		OfflineAfter: appconf.AgentOfflineAfter(),
+	}).WithPublisher(container.Webhooks)
 
 	if err := container.Migrate(); err != nil {
 		log.Fatal("migration failed", err)
 	}
 
+	if err := configureCertificateAuthority(container); err != nil {
+		log.Fatal("certificate authority setup failed", err)
+	}
+
 	e := echo.New()
 	e.Validator = validator.New()
 
@@ -249,6 +306,12 @@ func runServer(ctx context.Context, cmd *cli.Command) error {
 	e.Use(middleware.Recover())
 
 	config.AddRoutesV2(e, container)
+	startMetricRollupJob(ctx, container.MetricRollup)
+	startAgentLivenessJob(ctx, container.Liveness)
+	startWebhookDeliveryJob(ctx, container.Webhooks)
+	if container.Nonces != nil {
+		startNonceCleanupJob(ctx, container.Nonces)
+	}
 
 	// Agent-related jobs run in goroutine after registration
 	go func() {
@@ -259,6 +322,7 @@ func runServer(ctx context.Context, cmd *cli.Command) error {
 			log.Printf("failed to initialize local task store: %v", err)
 		} else {
 			defer localStore.Close()
+			startStoreCompactionJob(jobCtx, localStore)
 		}
 
 		registeredChan := make(chan bool, 1)
@@ -281,8 +345,15 @@ func runServer(ctx context.Context, cmd *cli.Command) error {
 		log.Println("Agent registered, starting task job...")
 		deliveryCoordinator := rollout.NewCoordinator(appconf.WebSocketDeliveryEnabled(), appconf.WebSocketPollingFallbackThreshold())
 		var resultChannel taskjob.ResultChannel
+		var taskSecrets taskjob.SecretOpener
+		if opener, err := tasksecrets.New(); err != nil {
+			log.Printf("failed to initialize task secrets, tasks using secrets will fail: %v", err)
+		} else {
+			taskSecrets = opener
+		}
 		taskJob := taskjob.NewJobWithConf(taskjob.TaskJobConfig{
 			PollingGate:          deliveryCoordinator,
+			Secrets:              taskSecrets,
 			OutputFlushInterval:  appconf.TaskOutputFlushInterval(),
 			OutputFlushThreshold: appconf.TaskOutputFlushThreshold(),
 			Trigger: func(ctx context.Context, fn func() error) {
@@ -339,10 +410,141 @@ func runServer(ctx context.Context, cmd *cli.Command) error {
 			startSelfUpdateJob(jobCtx)
 		}
 
+		if appconf.MTLSEnabled() {
+			startCertRenewalJob(jobCtx)
+		}
+
+		if appconf.KeyRotationEnabled() {
+			startKeyRotationJob(jobCtx, localStore)
+		}
+
 		<-jobCtx.Done()
 	}()
 
-	return e.Start(fmt.Sprintf(":%s", appconf.Port()))
+	return startHTTPServer(e, container.CertificateAuthority)
+}
+
+func configureCertificateAuthority(container *app.Container) error {
+	container.RequireClientCertificate = appconf.MTLSRequired()
+	if appconf.MTLSCACertPath() == "" {
+		if container.RequireClientCertificate {
+			return fmt.Errorf("HOSTLINK_MTLS_REQUIRED needs HOSTLINK_MTLS_CA_CERT_PATH")
+		}
+		return nil
+	}
+	if container.RequireClientCertificate && appconf.ServerTLSCertPath() == "" {
+		return fmt.Errorf("HOSTLINK_MTLS_REQUIRED needs HOSTLINK_TLS_CERT_PATH")
+	}
+
+	ca, err := certauthority.Load(appconf.MTLSCACertPath(), appconf.MTLSCAKeyPath(), appconf.MTLSClientCertValidity())
+	if err != nil {
+		return err
+	}
+	container.CertificateAuthority = ca
+	return nil
+}
+
+// startHTTPServer serves plain HTTP unless a server certificate is configured.
+// With a certificate authority, client certificates are verified when presented;
+// whether they are mandatory is decided per route by the agent auth middleware.
+func startHTTPServer(e *echo.Echo, ca *certauthority.Authority) error {
+	addr := fmt.Sprintf(":%s", appconf.Port())
+	if appconf.ServerTLSCertPath() == "" {
+		return e.Start(addr)
+	}
+
+	cert, err := tls.LoadX509KeyPair(appconf.ServerTLSCertPath(), appconf.ServerTLSKeyPath())
+	if err != nil {
+		return fmt.Errorf("load server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if ca != nil {
+		tlsConfig.ClientCAs = ca.CertPool()
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return e.StartServer(&http.Server{Addr: addr, TLSConfig: tlsConfig})
+}
+
+func startCertRenewalJob(ctx context.Context) {
+	svc, err := certrenewal.New()
+	if err != nil {
+		log.Printf("failed to initialize certificate renewal: %v", err)
+		return
+	}
+	job := certrenewaljob.NewWithConfig(certrenewaljob.Config{
+		Trigger: func(ctx context.Context, fn func() error) {
+			certrenewaljob.TriggerWithConfig(ctx, fn, certrenewaljob.TriggerConfig{Interval: appconf.ClientCertRenewCheckInterval()})
+		},
+	})
+	job.Register(ctx, svc)
+}
+
+// startKeyRotationJob rotates the agent key on schedule. A local task store
+// encrypted under the agent key gets a data key wrapped with the new key.
+func startKeyRotationJob(ctx context.Context, localStore *localtaskstore.Store) {
+	svc, err := keyrotation.New()
+	if err != nil {
+		log.Printf("failed to initialize key rotation: %v", err)
+		return
+	}
+	if localStore != nil && appconf.LocalTaskStoreEncryption() == "agent-key" {
+		svc.WithAfterRotate(localStore.RotateDataKey)
+	}
+	job := keyrotationjob.NewWithConfig(keyrotationjob.Config{
+		Trigger: func(ctx context.Context, fn func() error) {
+			keyrotationjob.TriggerWithConfig(ctx, fn, keyrotationjob.TriggerConfig{Interval: appconf.KeyRotationCheckInterval()})
+		},
+	})
+	job.Register(ctx, svc)
+}
+
+func startStoreCompactionJob(ctx context.Context, store storecompactionjob.Compactor) {
+	job := storecompactionjob.NewWithConfig(storecompactionjob.Config{
+		Trigger: func(ctx context.Context, fn func() error) {
+			storecompactionjob.TriggerWithConfig(ctx, fn, storecompactionjob.TriggerConfig{Interval: appconf.LocalTaskStoreCompactionInterval()})
+		},
+	})
+	job.Register(ctx, store)
+}
+
+func startMetricRollupJob(ctx context.Context, svc metricrollupjob.Roller) {
+	job := metricrollupjob.NewWithConfig(metricrollupjob.Config{
+		Trigger: func(ctx context.Context, fn func() error) {
+			metricrollupjob.TriggerWithConfig(ctx, fn, metricrollupjob.TriggerConfig{Interval: appconf.MetricsRollupInterval()})
+		},
+	})
+	job.Register(ctx, svc)
+}
+
+func startAgentLivenessJob(ctx context.Context, svc agentlivenessjob.Sweeper) {
+	job := agentlivenessjob.NewWithConfig(agentlivenessjob.Config{
+		Trigger: func(ctx context.Context, fn func() error) {
+			agentlivenessjob.TriggerWithConfig(ctx, fn, agentlivenessjob.TriggerConfig{Interval: appconf.AgentLivenessInterval()})
+		},
+	})
+	job.Register(ctx, svc)
+}
+
+func startNonceCleanupJob(ctx context.Context, store noncecleanupjob.Cleaner) {
+	job := noncecleanupjob.NewWithConfig(noncecleanupjob.Config{
+		Trigger: func(ctx context.Context, fn func() error) {
+			noncecleanupjob.TriggerWithConfig(ctx, fn, noncecleanupjob.TriggerConfig{Interval: appconf.NonceCleanupInterval()})
+		},
+		MaxAge: reqauth.Window,
+	})
+	job.Register(ctx, store)
+}
+
+func startWebhookDeliveryJob(ctx context.Context, svc webhookdeliveryjob.Deliverer) {
+	job := webhookdeliveryjob.NewWithConfig(webhookdeliveryjob.Config{
+		Trigger: func(ctx context.Context, fn func() error) {
+			webhookdeliveryjob.TriggerWithConfig(ctx, fn, webhookdeliveryjob.TriggerConfig{Interval: appconf.WebhookDeliveryInterval()})
+		},
+	})
+	job.Register(ctx, svc)
 }
 
 type webSocketRuntime interface {
@@ -375,19 +577,24 @@ func newDefaultWebSocketRuntime(localStore *localtaskstore.Store, enqueuer wscli
 		return nil, fmt.Errorf("local task store is not available")
 	}
 	return wsclient.New(wsclient.Config{
-		URL:                 appconf.WebSocketURL(),
-		AgentState:          state,
-		PrivateKeyPath:      appconf.AgentPrivateKeyPath(),
-		ReconnectMin:        appconf.WebSocketReconnectMin(),
-		ReconnectMax:        appconf.WebSocketReconnectMax(),
-		PingInterval:        appconf.WebSocketPingInterval(),
-		ResultOutbox:        localStore,
-		ReceiptStore:        localStore,
-		RecoveryStore:       localStore,
-		TaskEnqueuer:        enqueuer,
-		ResultsEnabled:      appconf.WebSocketResultsEnabled(),
-		DeliveryEnabled:     appconf.WebSocketDeliveryEnabled(),
-		DeliveryCoordinator: deliveryCoordinator,
+		URL:                    appconf.WebSocketURL(),
+		AgentState:             state,
+		PrivateKeyPath:         appconf.AgentPrivateKeyPath(),
+		TLSConfig:              httpclient.DefaultTLSOptions().Config(),
+		ReconnectMin:           appconf.WebSocketReconnectMin(),
+		ReconnectMax:           appconf.WebSocketReconnectMax(),
+		PingInterval:           appconf.WebSocketPingInterval(),
+		ResultOutbox:           localStore,
+		ReceiptStore:           localStore,
+		RecoveryStore:          localStore,
+		TaskEnqueuer:           enqueuer,
+		ResultsEnabled:         appconf.WebSocketResultsEnabled(),
+		DeliveryEnabled:        appconf.WebSocketDeliveryEnabled(),
+		DeliveryCoordinator:    deliveryCoordinator,
+		OutputBatchEnabled:     appconf.WebSocketOutputBatchEnabled(),
+		OutputBatchMaxMessages: appconf.WebSocketOutputBatchMaxMessages(),
+		OutputBatchMaxBytes:    appconf.WebSocketOutputBatchMaxBytes(),
+		OutputBatchInterval:    appconf.WebSocketOutputBatchInterval(),
 	})
 }
 
@@ -0,0 +1,97 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"hostlink/app/services/requestsigner"
+	"hostlink/domain/agent"
+	"hostlink/domain/task"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentAccess_QuarantineAndRevoke(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	server := httptest.NewServer(env.echo)
+	defer server.Close()
+	admin := env.login(t, "alice", "admin")
+
+	ctx := context.Background()
+	key, publicKey := generateE2EKeyPair(t)
+	testAgent := &agent.Agent{PublicKey: publicKey, PublicKeyType: "rsa", Fingerprint: "agent-access"}
+	require.NoError(t, env.container.AgentRepository.Create(ctx, testAgent))
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	savePrivateKey(t, keyPath, key)
+	signer, err := requestsigner.New(keyPath, testAgent.ID)
+	require.NoError(t, err)
+	require.NoError(t, env.container.TaskRepository.Create(ctx, &task.Task{Command: "echo quarantined", Status: "pending", Priority: 1}))
+
+	send := func(method, path, body string) (int, []byte) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		require.NoError(t, signer.SignRequest(req))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, data
+	}
+	heartbeatTasks := func() []task.Task {
+		status, body := send(http.MethodPost, "/api/v1/agents/"+testAgent.ID+"/heartbeat", `{}`)
+		require.Equal(t, http.StatusOK, status, string(body))
+		var resp struct {
+			PendingTasks []task.Task `json:"pending_tasks"`
+		}
+		require.NoError(t, json.Unmarshal(body, &resp))
+		return resp.PendingTasks
+	}
+	pushMetrics := func() int {
+		status, _ := send(http.MethodPost, "/api/v1/agents/"+testAgent.ID+"/metrics",
+			`{"version":"1","metric_sets":[{"type":"system","metrics":{"cpu_percent":12.5}}]}`)
+		return status
+	}
+
+	rec := env.do(http.MethodPost, "/api/v2/agents/"+testAgent.ID+"/quarantine", admin, map[string]string{"reason": "suspicious traffic"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	assert.Empty(t, heartbeatTasks(), "a quarantined agent is handed no tasks")
+	assert.Equal(t, http.StatusNoContent, pushMetrics(), "a quarantined agent still pushes metrics")
+	for _, path := range []string{
+		"/api/v1/tasks",
+		"/api/v1/agents/" + testAgent.ID + "/secrets",
+		"/api/v1/agents/" + testAgent.ID + "/credentials",
+	} {
+		status, _ := send(http.MethodGet, path, "")
+		assert.Equal(t, http.StatusForbidden, status, path)
+	}
+
+	rec = env.do(http.MethodPost, "/api/v2/agents/"+testAgent.ID+"/release", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Len(t, heartbeatTasks(), 1, "a released agent is handed tasks again")
+
+	rec = env.do(http.MethodPost, "/api/v2/agents/"+testAgent.ID+"/revoke", admin, map[string]string{"reason": "decommissioned"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	status, _ := send(http.MethodPost, "/api/v1/agents/"+testAgent.ID+"/heartbeat", `{}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, http.StatusForbidden, pushMetrics())
+	rec = env.do(http.MethodPost, "/api/v2/agents/"+testAgent.ID+"/release", admin, nil)
+	assert.Equal(t, http.StatusConflict, rec.Code, "revocation is final")
+
+	stored, err := env.container.AgentRepository.FindByID(ctx, testAgent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, agent.AccessRevoked, stored.Access)
+	assert.Equal(t, "decommissioned", stored.AccessReason)
+}
@@ -33,7 +33,7 @@ func setupAgentDetailsTestEnvironment(t *testing.T) (*echo.Echo, *app.Container)
 
 	e := echo.New()
 	handler := agentController.NewHandlerWithRepo(nil, container.AgentRepository)
-	handler.RegisterRoutes(e.Group("/api/v1/agents"))
+	handler.RegisterReadRoutes(e.Group("/api/v1/agents/:id"))
 
 	return e, container
 }
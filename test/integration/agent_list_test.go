@@ -97,7 +97,7 @@ func TestAgentList(t *testing.T) {
 		inactiveAgent.Status = "inactive"
 		require.NoError(t, container.AgentRepository.Update(context.Background(), inactiveAgent))
 
-		resp, err := http.Get(server.URL + "/api/v1/agents?status=active")
+		resp, err := http.Get(server.URL + "/api/v1/agents?status=online")
 		require.NoError(t, err)
 		defer resp.Body.Close()
 
@@ -106,7 +106,7 @@ func TestAgentList(t *testing.T) {
 		var agents []agent.Agent
 		json.NewDecoder(resp.Body).Decode(&agents)
 		assert.Len(t, agents, 1)
-		assert.Equal(t, "active", agents[0].Status)
+		assert.Equal(t, agent.StatusOnline, agents[0].Status)
 	})
 
 	t.Run("filters agents by fingerprint", func(t *testing.T) {
@@ -164,7 +164,7 @@ func TestAgentList(t *testing.T) {
 		agent2.Status = "inactive"
 		require.NoError(t, container.AgentRepository.Update(context.Background(), agent2))
 
-		resp, err := http.Get(server.URL + "/api/v1/agents?status=active&fingerprint=fp-001")
+		resp, err := http.Get(server.URL + "/api/v1/agents?status=online&fingerprint=fp-001")
 		require.NoError(t, err)
 		defer resp.Body.Close()
 
@@ -174,7 +174,7 @@ func TestAgentList(t *testing.T) {
 		json.NewDecoder(resp.Body).Decode(&agents)
 		assert.Len(t, agents, 1)
 		assert.Equal(t, "fp-001", agents[0].Fingerprint)
-		assert.Equal(t, "active", agents[0].Status)
+		assert.Equal(t, agent.StatusOnline, agents[0].Status)
 	})
 
 	t.Run("returns empty array when no agents match filters", func(t *testing.T) {
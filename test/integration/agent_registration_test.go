@@ -99,7 +99,7 @@ func TestAgentRegistrationIntegration(t *testing.T) {
 			require.NoError(t, err)
 			assert.Equal(t, "integration-test-fp-001", dbAgent.Fingerprint)
 			assert.Equal(t, "ssh-rsa AAAAB3Integration...", dbAgent.PublicKey)
-			assert.Equal(t, "active", dbAgent.Status)
+			assert.Equal(t, agent.StatusOnline, dbAgent.Status)
 			assert.Len(t, dbAgent.Tags, 2)
 
 			// Verify registration record
@@ -0,0 +1,94 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"hostlink/app/services/requestsigner"
+	"hostlink/domain/agent"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentTags_ServerAndDeclared(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	server := httptest.NewServer(env.echo)
+	defer server.Close()
+	admin := env.login(t, "alice", "admin")
+
+	ctx := context.Background()
+	key, publicKey := generateE2EKeyPair(t)
+	testAgent := &agent.Agent{PublicKey: publicKey, PublicKeyType: "rsa", Fingerprint: "agent-tags"}
+	require.NoError(t, env.container.AgentRepository.Create(ctx, testAgent))
+	require.NoError(t, env.container.AgentRepository.AddTags(ctx, testAgent.ID, []agent.AgentTag{{Key: "env", Value: "staging"}}))
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	savePrivateKey(t, keyPath, key)
+	signer, err := requestsigner.New(keyPath, testAgent.ID)
+	require.NoError(t, err)
+
+	heartbeat := func(body string) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/agents/"+testAgent.ID+"/heartbeat", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		require.NoError(t, signer.SignRequest(req))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(data))
+	}
+	effectiveTags := func() map[string]string {
+		stored, err := env.container.AgentRepository.FindByID(ctx, testAgent.ID)
+		require.NoError(t, err)
+		tags := make(map[string]string)
+		for _, tag := range stored.Tags {
+			tags[tag.Key] = tag.Value
+		}
+		return tags
+	}
+
+	heartbeat(`{"declared_tags":[{"key":"env","value":"dev"},{"key":"role","value":"web"}]}`)
+	assert.Equal(t, map[string]string{"env": "staging", "role": "web"}, effectiveTags(), "a tag added without a source is a server tag and shadows the declared one")
+
+	rec := env.do(http.MethodPut, "/api/v2/agents/"+testAgent.ID+"/tags/role", admin, map[string]string{"value": "db"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	heartbeat(`{"declared_tags":[{"key":"env","value":"dev"},{"key":"role","value":"web"},{"key":"rack","value":"r12"}]}`)
+	assert.Equal(t, map[string]string{"env": "staging", "role": "db", "rack": "r12"}, effectiveTags(), "a heartbeat cannot override a server tag")
+
+	rec = env.do(http.MethodGet, "/api/v2/agents/"+testAgent.ID+"/tags", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var listed []struct {
+		Key      string `json:"key"`
+		Source   string `json:"source"`
+		Shadowed bool   `json:"shadowed"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	require.Len(t, listed, 5)
+	shadowed := map[string]string{}
+	for _, tag := range listed {
+		if tag.Shadowed {
+			shadowed[tag.Key] = tag.Source
+		}
+	}
+	assert.Equal(t, map[string]string{"env": "agent", "role": "agent"}, shadowed)
+
+	rec = env.do(http.MethodDelete, "/api/v2/agents/"+testAgent.ID+"/tags/env", admin, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = env.do(http.MethodDelete, "/api/v2/agents/"+testAgent.ID+"/tags/rack", admin, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "declared tags are only changed by the agent")
+	heartbeat(`{}`)
+	assert.Equal(t, map[string]string{"env": "dev", "role": "db", "rack": "r12"}, effectiveTags(), "the declared tag takes effect once the server tag is gone")
+
+	rec = env.do(http.MethodGet, "/api/v2/audit?action=agent.tag.set", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), testAgent.ID)
+}
@@ -0,0 +1,102 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bufio"
+	"encoding/json"
+	"hostlink/domain/audit"
+	"hostlink/domain/operator"
+	"hostlink/domain/task"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit_RecordsControlPlaneActions(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	admin := env.login(t, "admin", operator.RoleAdmin)
+	runner := env.login(t, "runner", operator.RoleOperator)
+	viewer := env.login(t, "viewer", operator.RoleViewer)
+
+	rec := env.do(http.MethodPost, "/api/v2/tasks", runner, map[string]any{"command": "uptime"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created task.Task
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.Equal(t, http.StatusForbidden, env.do(http.MethodPost, "/api/v2/tasks", viewer, map[string]any{"command": "reboot"}).Code)
+	require.Equal(t, http.StatusUnauthorized, env.do(http.MethodGet, "/api/v2/webhooks", "hlo_stolen", nil).Code)
+	// Reads are not audited
+	require.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v2/tasks", viewer, nil).Code)
+
+	rec = env.do(http.MethodGet, "/api/v2/audit", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var entries []audit.Entry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	require.Len(t, entries, 3)
+
+	denied, forbidden, createdEntry := entries[0], entries[1], entries[2]
+	assert.Equal(t, "task.create", createdEntry.Action)
+	assert.Equal(t, audit.OutcomeSuccess, createdEntry.Outcome)
+	assert.Equal(t, audit.ActorOperator, createdEntry.ActorType)
+	assert.Equal(t, "runner", createdEntry.ActorName)
+	assert.NotEmpty(t, createdEntry.TokenID)
+	assert.Equal(t, created.ID, createdEntry.Target)
+	assert.JSONEq(t, `{"command":"uptime","agent_ids":null}`, createdEntry.Detail)
+
+	assert.Equal(t, "task.create", forbidden.Action)
+	assert.Equal(t, audit.OutcomeDenied, forbidden.Outcome)
+	assert.Equal(t, "viewer", forbidden.ActorName)
+
+	assert.Equal(t, "GET /api/v2/webhooks", denied.Action)
+	assert.Equal(t, audit.ActorAnonymous, denied.ActorType)
+	assert.Equal(t, http.StatusUnauthorized, denied.StatusCode)
+
+	rec = env.do(http.MethodGet, "/api/v2/audit?outcome=denied", admin, nil)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	assert.Len(t, entries, 2)
+
+	assert.Equal(t, http.StatusForbidden, env.do(http.MethodGet, "/api/v2/audit", runner, nil).Code)
+}
+
+func TestAudit_ExportVerifiesAndDetectsTampering(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	admin := env.login(t, "admin", operator.RoleAdmin)
+	for _, command := range []string{"uptime", "df -h", "hostname"} {
+		require.Equal(t, http.StatusCreated, env.do(http.MethodPost, "/api/v2/tasks", admin, map[string]any{"command": command}).Code)
+	}
+
+	rec := env.do(http.MethodGet, "/api/v2/audit/export", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var exported []audit.Entry
+	scanner := bufio.NewScanner(strings.NewReader(rec.Body.String()))
+	for scanner.Scan() {
+		var entry audit.Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		exported = append(exported, entry)
+	}
+	require.Len(t, exported, 3)
+	_, _, err := audit.Verify(0, "", exported)
+	assert.NoError(t, err)
+
+	rec = env.do(http.MethodGet, "/api/v2/audit/verify", admin, nil)
+	assert.JSONEq(t, `{"valid":true,"entries":3,"head":"`+exported[2].Hash+`"}`, rec.Body.String())
+
+	// The table rejects edits, so tampering means going around the triggers
+	err = env.container.DB.Exec("UPDATE audit_entries SET target = 'tsk_other' WHERE sequence = 2").Error
+	require.Error(t, err)
+	require.NoError(t, env.container.DB.Exec("DROP TRIGGER audit_entries_no_UPDATE").Error)
+	require.NoError(t, env.container.DB.Exec("UPDATE audit_entries SET target = 'tsk_other' WHERE sequence = 2").Error)
+
+	rec = env.do(http.MethodGet, "/api/v2/audit/verify", admin, nil)
+	var result struct {
+		Valid    bool  `json:"valid"`
+		BrokenAt int64 `json:"broken_at"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(2), result.BrokenAt)
+}
@@ -0,0 +1,94 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"hostlink/app/controller/enrollmenttokens"
+	"hostlink/domain/agent"
+	"hostlink/domain/audit"
+	"hostlink/domain/operator"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrollment_TokensGateRegistration(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	env.container.RegistrationService.WithEnrollment(env.container.Enrollment, true)
+	admin := env.login(t, "admin", operator.RoleAdmin)
+	runner := env.login(t, "runner", operator.RoleOperator)
+
+	assert.Equal(t, http.StatusForbidden, env.do(http.MethodPost, "/api/v2/enrollment-tokens", runner, map[string]any{"name": "staging"}).Code)
+
+	rec := env.do(http.MethodPost, "/api/v2/enrollment-tokens", admin, map[string]any{
+		"name": "staging", "tags": []string{"env=staging"}, "max_uses": 1,
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var token enrollmenttokens.CreatedToken
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &token))
+	assert.Equal(t, "admin", token.CreatedBy)
+
+	register := func(fingerprint, tokenID, tokenKey string) (int, string) {
+		rec := env.do(http.MethodPost, "/api/v1/agents/register", "", map[string]any{
+			"fingerprint":     fingerprint,
+			"token_id":        tokenID,
+			"token_key":       tokenKey,
+			"public_key":      "ssh-rsa AAAAB3Enrollment...",
+			"public_key_type": "ssh-rsa",
+			"tags":            []map[string]string{{"key": "env", "value": "dev"}, {"key": "role", "value": "web"}},
+		})
+		var resp struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.ID
+	}
+
+	code, _ := register("fp-unknown", "default-token-id", "default-token-key")
+	assert.Equal(t, http.StatusUnauthorized, code, "unknown tokens are rejected when enrollment is required")
+	code, _ = register("fp-wrong-key", token.ID, token.Key+"x")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, agentID := register("fp-enrolled", token.ID, token.Key)
+	require.Equal(t, http.StatusOK, code)
+	registered, err := env.container.AgentRepository.FindByID(context.Background(), agentID)
+	require.NoError(t, err)
+	assert.Equal(t, token.ID, registered.TokenID)
+	assert.ElementsMatch(t, []string{"env=staging", "role=web"}, tagStrings(registered.Tags))
+	var registrations []agent.AgentRegistration
+	require.NoError(t, env.container.DB.Where("agent_id = ?", agentID).Find(&registrations).Error)
+	require.Len(t, registrations, 1)
+	assert.Equal(t, token.ID, registrations[0].TokenID)
+
+	code, _ = register("fp-second", token.ID, token.Key)
+	assert.Equal(t, http.StatusUnauthorized, code, "the token allows one use")
+
+	second := env.do(http.MethodPost, "/api/v2/enrollment-tokens", admin, map[string]any{"name": "prod"})
+	require.NoError(t, json.Unmarshal(second.Body.Bytes(), &token))
+	require.Equal(t, http.StatusNoContent, env.do(http.MethodDelete, "/api/v2/enrollment-tokens/"+token.ID, admin, nil).Code)
+	code, _ = register("fp-revoked", token.ID, token.Key)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	rec = env.do(http.MethodGet, "/api/v2/enrollment-tokens", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), token.Key)
+
+	rec = env.do(http.MethodGet, "/api/v2/audit?action=enrollment_token.revoke", admin, nil)
+	var entries []audit.Entry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, token.ID, entries[0].Target)
+}
+
+func tagStrings(tags []agent.AgentTag) []string {
+	var out []string
+	for _, tag := range tags {
+		out = append(out, tag.Key+"="+tag.Value)
+	}
+	return out
+}
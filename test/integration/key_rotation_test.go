@@ -0,0 +1,154 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"hostlink/app"
+	"hostlink/app/services/agentstate"
+	"hostlink/app/services/keyrotation"
+	"hostlink/app/services/requestsigner"
+	"hostlink/config"
+	"hostlink/domain/agent"
+	"hostlink/domain/credential"
+	"hostlink/domain/secret"
+	"hostlink/internal/crypto"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestKeyRotation_EndToEnd(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	container := app.NewContainer(db)
+	require.NoError(t, container.Migrate())
+	e := echo.New()
+	e.Validator = &e2eValidator{}
+	config.AddRoutesV2(e, container)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	ctx := context.Background()
+	oldKey, oldPublicKey := generateE2EKeyPair(t)
+	testAgent := &agent.Agent{PublicKey: oldPublicKey, PublicKeyType: "rsa", Fingerprint: "key-rotation"}
+	require.NoError(t, container.AgentRepository.Create(ctx, testAgent))
+	passwdEnc, err := crypto.EncryptWithPublicKey("s3cret", &oldKey.PublicKey)
+	require.NoError(t, err)
+	cred := &credential.Credential{ID: "crd_rotation", Dialect: "postgresql", AgentID: testAgent.ID, PasswdEnc: passwdEnc}
+	require.NoError(t, container.CredentialRepository.Create(ctx, cred))
+	sec := &secret.Secret{ID: secret.NewID(), AgentID: testAgent.ID, Name: "DB_PASSWORD"}
+	sec.ValueEnc, err = crypto.SealEnvelope([]byte("hunter2"), &oldKey.PublicKey, secret.EnvelopeContext(testAgent.ID, sec.ID, sec.Name)...)
+	require.NoError(t, err)
+	require.NoError(t, container.SecretRepository.Save(ctx, sec))
+
+	stateDir := t.TempDir()
+	keyPath := filepath.Join(stateDir, "agent.key")
+	savePrivateKey(t, keyPath, oldKey)
+	require.NoError(t, agentstate.New(stateDir).SetAgentID(testAgent.ID))
+	t.Setenv("HOSTLINK_STATE_PATH", stateDir)
+	t.Setenv("HOSTLINK_PRIVATE_KEY_PATH", keyPath)
+	t.Setenv("SH_CONTROL_PLANE_URL", server.URL)
+	t.Setenv("HOSTLINK_MTLS_ENABLED", "false")
+	t.Setenv("HOSTLINK_AGENT_KEY_TYPE", "")
+
+	// A signer loaded before the rotation, as in a running agent
+	runningSigner, err := requestsigner.New(keyPath, testAgent.ID)
+	require.NoError(t, err)
+	heartbeat := func(signer *requestsigner.RequestSigner) int {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/agents/"+testAgent.ID+"/heartbeat", strings.NewReader(`{}`))
+		require.NoError(t, err)
+		require.NoError(t, signer.SignRequest(req))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	svc, err := keyrotation.New()
+	require.NoError(t, err)
+	result, err := svc.Rotate()
+	require.NoError(t, err)
+	assert.True(t, result.PreviousKeyValidUntil.After(time.Now()))
+
+	// The RSA agent moves to the default key type
+	newKey, err := crypto.LoadKey(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.KeyTypeEd25519, crypto.KeyType(newKey))
+	newPublicKey, err := crypto.PublicKeyBase64(newKey)
+	require.NoError(t, err)
+	stored, err := container.AgentRepository.FindByID(ctx, testAgent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, newPublicKey, stored.PublicKey)
+	assert.Equal(t, crypto.KeyTypeEd25519, stored.PublicKeyType)
+	assert.Equal(t, oldPublicKey, stored.PreviousPublicKey)
+	assert.NotNil(t, stored.KeyRotatedAt)
+
+	var history []agent.AgentRegistration
+	require.NoError(t, db.Where("agent_id = ? AND event = ?", testAgent.ID, agent.EventKeyRotation).Find(&history).Error)
+	assert.Len(t, history, 1)
+
+	rotatedCred, err := container.CredentialRepository.FindByID(ctx, cred.ID)
+	require.NoError(t, err)
+	assert.True(t, crypto.IsEnvelope(rotatedCred.PasswdEnc), "the legacy password is moved into an envelope")
+	password, err := crypto.OpenEnvelope(rotatedCred.PasswdEnc, newKey, credential.EnvelopeContext(testAgent.ID, cred.ID)...)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", string(password))
+
+	resealed, err := container.SecretRepository.FindByName(ctx, testAgent.ID, sec.Name)
+	require.NoError(t, err)
+	value, err := crypto.OpenEnvelope(resealed.ValueEnc, newKey, secret.EnvelopeContext(testAgent.ID, sec.ID, sec.Name)...)
+	require.NoError(t, err, "the secret is sealed for the new key")
+	assert.Equal(t, "hunter2", string(value))
+
+	assert.Equal(t, http.StatusOK, heartbeat(runningSigner), "a running agent picks up the new key")
+	assert.Equal(t, http.StatusOK, heartbeat(signerWithKey(t, oldKey, testAgent.ID)),
+		"the previous key is accepted during the overlap")
+
+	// Whoever holds only the previous key cannot take the agent over
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/agents/"+testAgent.ID+"/rotate-key", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	require.NoError(t, signerWithKey(t, oldKey, testAgent.ID).SignRequest(req))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "the previous key cannot rotate the key")
+	stored, err = container.AgentRepository.FindByID(ctx, testAgent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, newPublicKey, stored.PublicKey)
+
+	require.NoError(t, db.Model(&agent.Agent{}).Where("id = ?", testAgent.ID).
+		Update("previous_public_key_expires_at", time.Now().Add(-time.Minute)).Error)
+	assert.Equal(t, http.StatusUnauthorized, heartbeat(signerWithKey(t, oldKey, testAgent.ID)),
+		"the previous key is rejected once the overlap ends")
+	assert.Equal(t, http.StatusOK, heartbeat(runningSigner))
+}
+
+// signerWithKey signs with key from a file of its own, as an agent that has
+// not seen the rotation.
+func signerWithKey(t *testing.T, key *rsa.PrivateKey, agentID string) *requestsigner.RequestSigner {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agent.key")
+	savePrivateKey(t, path, key)
+	signer, err := requestsigner.New(path, agentID)
+	require.NoError(t, err)
+	return signer
+}
@@ -0,0 +1,82 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"hostlink/app"
+	"hostlink/app/services/agentstate"
+	"hostlink/config"
+	"hostlink/domain/agent"
+	"hostlink/domain/credential"
+	"hostlink/internal/apiserver"
+	"hostlink/internal/crypto"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestAgentKeyTypes_EndToEnd(t *testing.T) {
+	for _, keyType := range []string{crypto.KeyTypeEd25519, crypto.KeyTypeECDSA} {
+		t.Run(keyType, func(t *testing.T) {
+			db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				if sqlDB, err := db.DB(); err == nil {
+					sqlDB.Close()
+				}
+			})
+			container := app.NewContainer(db)
+			require.NoError(t, container.Migrate())
+			e := echo.New()
+			e.Validator = &e2eValidator{}
+			config.AddRoutesV2(e, container)
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			stateDir := t.TempDir()
+			keyPath := filepath.Join(stateDir, "agent.key")
+			privateKey, err := crypto.LoadOrGenerateKey(keyPath, keyType)
+			require.NoError(t, err)
+			publicKey, err := crypto.PublicKeyBase64(privateKey)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			testAgent := &agent.Agent{PublicKey: publicKey, PublicKeyType: keyType, Fingerprint: "key-type-" + keyType}
+			require.NoError(t, container.AgentRepository.Create(ctx, testAgent))
+			require.NoError(t, agentstate.New(stateDir).SetAgentID(testAgent.ID))
+
+			// The control plane seals the password for the agent's key
+			credentialID := "crd_" + keyType
+			passwdEnc, err := crypto.SealEnvelope([]byte("s3cret"), privateKey.Public(), credential.EnvelopeContext(testAgent.ID, credentialID)...)
+			require.NoError(t, err)
+			require.NoError(t, container.CredentialRepository.Create(ctx, &credential.Credential{
+				ID: credentialID, Dialect: "postgresql", AgentID: testAgent.ID, PasswdEnc: passwdEnc,
+			}))
+
+			t.Setenv("HOSTLINK_STATE_PATH", stateDir)
+			t.Setenv("HOSTLINK_PRIVATE_KEY_PATH", keyPath)
+			t.Setenv("SH_CONTROL_PLANE_URL", server.URL)
+			t.Setenv("HOSTLINK_MTLS_ENABLED", "false")
+
+			// Requests signed with the key authenticate
+			client, err := apiserver.NewDefaultClient()
+			require.NoError(t, err)
+			creds, err := client.GetMetricsCreds(ctx, testAgent.ID)
+			require.NoError(t, err)
+			require.Len(t, creds, 1)
+
+			password, err := crypto.OpenSecret(creds[0].PasswdEnc, privateKey, credential.EnvelopeContext(testAgent.ID, creds[0].ID)...)
+			require.NoError(t, err)
+			assert.Equal(t, "s3cret", password)
+		})
+	}
+}
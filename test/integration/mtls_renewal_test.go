@@ -0,0 +1,108 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"hostlink/app"
+	"hostlink/app/controller/agents"
+	"hostlink/app/service/certauthority"
+	"hostlink/app/services/requestsigner"
+	"hostlink/config"
+	"hostlink/domain/agent"
+	"hostlink/internal/crypto"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestMTLS_RenewalWithoutCertificate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	container := app.NewContainer(db)
+	require.NoError(t, container.Migrate())
+	container.RequireClientCertificate = true
+	container.CertificateAuthority = newTestCertificateAuthority(t)
+	e := echo.New()
+	e.Validator = &e2eValidator{}
+	config.AddRoutesV2(e, container)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	key, publicKey := generateE2EKeyPair(t)
+	testAgent := &agent.Agent{PublicKey: publicKey, PublicKeyType: "rsa", Fingerprint: "mtls-renewal"}
+	require.NoError(t, container.AgentRepository.Create(context.Background(), testAgent))
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	savePrivateKey(t, keyPath, key)
+	signer, err := requestsigner.New(keyPath, testAgent.ID)
+	require.NoError(t, err)
+
+	send := func(path string, body []byte) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/agents/"+testAgent.ID+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		require.NoError(t, signer.SignRequest(req))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// An agent whose certificate expired connects without one
+	assert.Equal(t, http.StatusUnauthorized, send("/heartbeat", nil).StatusCode)
+
+	csr, err := crypto.CreateCertificateRequestPEM(key, testAgent.ID)
+	require.NoError(t, err)
+	body, err := json.Marshal(agents.CertificateRenewalRequest{CSR: csr})
+	require.NoError(t, err)
+	resp := send("/certificate", body)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var renewed agents.CertificateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&renewed))
+	cert, err := crypto.ParseCertificatePEM(renewed.Certificate)
+	require.NoError(t, err)
+	assert.Equal(t, testAgent.ID, cert.Subject.CommonName)
+}
+
+func newTestCertificateAuthority(t *testing.T) *certauthority.Authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "hostlink test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certauthority.New(cert, key, time.Hour)
+}
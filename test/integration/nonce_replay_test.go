@@ -0,0 +1,71 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"hostlink/app"
+	"hostlink/config"
+	"hostlink/domain/agent"
+	"hostlink/domain/nonce"
+	gormRepo "hostlink/internal/repository/gorm"
+	"hostlink/internal/repository/memory"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestNonceReplay_RejectsReusedNonce(t *testing.T) {
+	stores := map[string]func(db *gorm.DB) nonce.Store{
+		"sql":    func(db *gorm.DB) nonce.Store { return gormRepo.NewNonceRepository(db) },
+		"memory": func(db *gorm.DB) nonce.Store { return memory.NewNonceStore(1000) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				if sqlDB, err := db.DB(); err == nil {
+					sqlDB.Close()
+				}
+			})
+			container := app.NewContainer(db)
+			require.NoError(t, container.Migrate())
+			container.Nonces = newStore(db)
+			e := echo.New()
+			e.Validator = &e2eValidator{}
+			config.AddRoutesV2(e, container)
+
+			privateKey, publicKey := generateE2EKeyPair(t)
+			testAgent := &agent.Agent{PublicKey: publicKey, PublicKeyType: "rsa", Fingerprint: "nonce-replay"}
+			require.NoError(t, container.AgentRepository.Create(context.Background(), testAgent))
+
+			send := func(req *http.Request) int {
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				return rec.Code
+			}
+			req := createSignedE2ERequest(t, http.MethodGet, "/api/v1/tasks", testAgent.ID, privateKey, time.Now())
+			replay := req.Clone(context.Background())
+
+			assert.Equal(t, http.StatusOK, send(req))
+			assert.Equal(t, http.StatusUnauthorized, send(replay), "a replayed nonce is rejected")
+			fresh := createSignedE2ERequest(t, http.MethodGet, "/api/v1/tasks", testAgent.ID, privateKey, time.Now())
+			assert.Equal(t, http.StatusOK, send(fresh), "a new nonce is accepted")
+
+			deleted, err := container.Nonces.DeleteExpired(context.Background(), -time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), deleted)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hostlink/app"
+	"hostlink/config"
+	"hostlink/domain/agent"
+	"hostlink/domain/operator"
+	"hostlink/domain/task"
+	"hostlink/internal/validator"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type operatorAuthTestEnv struct {
+	echo      *echo.Echo
+	container *app.Container
+}
+
+func setupOperatorAuthTestEnv(t *testing.T) *operatorAuthTestEnv {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	container := app.NewContainer(db)
+	require.NoError(t, container.Migrate())
+	container.RequireOperatorToken = true
+
+	e := echo.New()
+	e.Validator = validator.New()
+	config.AddRoutesV2(e, container)
+
+	return &operatorAuthTestEnv{echo: e, container: container}
+}
+
+// login creates an operator and returns a token for it.
+func (env *operatorAuthTestEnv) login(t *testing.T, name, role string, scope ...string) string {
+	t.Helper()
+	ctx := context.Background()
+	o, err := env.container.Operators.Create(ctx, name, role, scope)
+	require.NoError(t, err)
+	token, _, err := env.container.Operators.IssueToken(ctx, o.ID, "test", 0)
+	require.NoError(t, err)
+	return token
+}
+
+func (env *operatorAuthTestEnv) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	env.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOperatorAuth_RequiresToken(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+
+	for _, path := range []string{"/api/v2/tasks", "/api/v2/webhooks", "/api/v2/operators", "/api/v2/operators/me"} {
+		assert.Equal(t, http.StatusUnauthorized, env.do(http.MethodGet, path, "", nil).Code, path)
+		assert.Equal(t, http.StatusUnauthorized, env.do(http.MethodGet, path, "hlo_unknown", nil).Code, path)
+	}
+}
+
+func TestOperatorAuth_EnforcesRoles(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	viewer := env.login(t, "viewer", operator.RoleViewer)
+	runner := env.login(t, "runner", operator.RoleOperator)
+	admin := env.login(t, "admin", operator.RoleAdmin)
+	createTask := map[string]any{"command": "uptime"}
+
+	assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v2/tasks", viewer, nil).Code)
+	assert.Equal(t, http.StatusForbidden, env.do(http.MethodPost, "/api/v2/tasks", viewer, createTask).Code)
+	assert.Equal(t, http.StatusCreated, env.do(http.MethodPost, "/api/v2/tasks", runner, createTask).Code)
+
+	assert.Equal(t, http.StatusForbidden, env.do(http.MethodGet, "/api/v2/webhooks", runner, nil).Code)
+	assert.Equal(t, http.StatusForbidden, env.do(http.MethodGet, "/api/v2/operators", runner, nil).Code)
+	assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v2/webhooks", admin, nil).Code)
+	assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v2/operators", admin, nil).Code)
+
+	rec := env.do(http.MethodGet, "/api/v2/operators/me", viewer, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"viewer"`)
+}
+
+func TestOperatorAuth_AdminManagesTokens(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	admin := env.login(t, "admin", operator.RoleAdmin)
+
+	rec := env.do(http.MethodPost, "/api/v2/operators", admin, map[string]any{"name": "ci", "role": "operator"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created operator.Operator
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	rec = env.do(http.MethodPost, "/api/v2/operators/"+created.ID+"/tokens", admin, map[string]any{"name": "pipeline"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var issued struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+	assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v2/tasks", issued.Token, nil).Code)
+
+	var stored operator.Token
+	require.NoError(t, env.container.DB.Where("id = ?", issued.ID).First(&stored).Error)
+	assert.Equal(t, operator.HashToken(issued.Token), stored.Hash)
+	assert.NotContains(t, stored.Hash, issued.Token)
+
+	rec = env.do(http.MethodDelete, "/api/v2/operators/"+created.ID+"/tokens/"+issued.ID, admin, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, env.do(http.MethodGet, "/api/v2/tasks", issued.Token, nil).Code)
+}
+
+func TestOperatorAuth_ScopesTasksByAgentTag(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	ctx := context.Background()
+	staging := &agent.Agent{Fingerprint: "fp-staging", Tags: []agent.AgentTag{{Key: "env", Value: "staging"}}}
+	production := &agent.Agent{Fingerprint: "fp-production", Tags: []agent.AgentTag{{Key: "env", Value: "production"}}}
+	require.NoError(t, env.container.AgentRepository.Create(ctx, staging))
+	require.NoError(t, env.container.AgentRepository.Create(ctx, production))
+	productionTask := &task.Task{Command: "uptime", AgentIDs: []string{production.ID}}
+	require.NoError(t, env.container.TaskRepository.Create(ctx, productionTask))
+
+	scoped := env.login(t, "staging", operator.RoleOperator, "env=staging")
+
+	rec := env.do(http.MethodPost, "/api/v2/tasks", scoped, map[string]any{"command": "uptime", "agent_ids": []string{staging.ID}})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var stagingTask task.Task
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stagingTask))
+
+	rec = env.do(http.MethodPost, "/api/v2/tasks", scoped, map[string]any{"command": "uptime", "agent_ids": []string{production.ID}})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = env.do(http.MethodPost, "/api/v2/tasks", scoped, map[string]any{"command": "uptime"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/v2/tasks", scoped, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var listed []task.Task
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, stagingTask.ID, listed[0].ID)
+
+	assert.Equal(t, http.StatusNotFound, env.do(http.MethodGet, "/api/v2/tasks/"+productionTask.ID, scoped, nil).Code)
+	assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v2/tasks/"+stagingTask.ID, scoped, nil).Code)
+}
+
+func TestOperatorAuth_ScopesAgentReads(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	ctx := context.Background()
+	staging := &agent.Agent{Fingerprint: "fp-staging", Tags: []agent.AgentTag{{Key: "env", Value: "staging"}}}
+	production := &agent.Agent{Fingerprint: "fp-production", Tags: []agent.AgentTag{{Key: "env", Value: "production"}}}
+	require.NoError(t, env.container.AgentRepository.Create(ctx, staging))
+	require.NoError(t, env.container.AgentRepository.Create(ctx, production))
+	viewer := env.login(t, "viewer", operator.RoleViewer)
+	scoped := env.login(t, "staging", operator.RoleViewer, "env=staging")
+
+	for _, path := range []string{
+		"/api/v1/agents/" + production.ID + "/metrics?type=cpu",
+		"/api/v1/agents/" + production.ID + "/events",
+		"/api/v1/agents/" + production.ID,
+	} {
+		assert.Equal(t, http.StatusUnauthorized, env.do(http.MethodGet, path, "", nil).Code, path)
+		assert.Equal(t, http.StatusNotFound, env.do(http.MethodGet, path, scoped, nil).Code, path)
+		assert.Equal(t, http.StatusOK, env.do(http.MethodGet, path, viewer, nil).Code, path)
+	}
+	assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v1/agents/"+staging.ID+"/metrics?type=cpu", scoped, nil).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, env.do(http.MethodGet, "/api/v1/agents", "", nil).Code)
+	rec := env.do(http.MethodGet, "/api/v1/agents", scoped, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var listed []agent.Agent
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, staging.ID, listed[0].ID)
+}
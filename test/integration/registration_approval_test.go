@@ -0,0 +1,74 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"hostlink/app/controller/agents"
+	"hostlink/app/controller/registrations"
+	"hostlink/domain/agent"
+	"hostlink/internal/sysinfo"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrationApproval_DriftedHostReplacesItsAgent(t *testing.T) {
+	env := setupOperatorAuthTestEnv(t)
+	admin := env.login(t, "alice", "admin")
+	hardware := sysinfo.HardwareInfo{
+		BiosHash: "bios", DiskInfo: "disk", HostnameInfo: "web-1", IPAddressInfo: "10.0.0.1",
+		MACAddrInfo: "aa:bb", MachineID: "machine-1", MemoryHash: "memory", ProcessorHash: "cpu", SystemHash: "system",
+	}
+	register := func(fingerprint, previous string, hw sysinfo.HardwareInfo) (int, agents.RegistrationResponse) {
+		info, err := json.Marshal(hw)
+		require.NoError(t, err)
+		rec := env.do(http.MethodPost, "/api/v1/agents/register", "", agents.RegistrationRequest{
+			Fingerprint: fingerprint, TokenID: "token", TokenKey: "key", PublicKey: "key-" + fingerprint, PublicKeyType: "rsa",
+			Tags:     []agents.TagPair{{Key: "env", Value: "prod"}},
+			Hostname: hw.HostnameInfo, MachineID: hw.MachineID, HardwareInfo: info, PreviousFingerprint: previous,
+		})
+		var resp agents.RegistrationResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), rec.Body.String())
+		return rec.Code, resp
+	}
+
+	status, original := register("fp-original", "", hardware)
+	require.Equal(t, http.StatusOK, status)
+
+	drifted := hardware
+	drifted.DiskInfo, drifted.IPAddressInfo = "new-disk", "10.0.0.2"
+	status, held := register("fp-drifted", "fp-original", drifted)
+	require.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, agent.ApprovalPending, held.Status)
+	require.NotEmpty(t, held.RegistrationID)
+
+	status, again := register("fp-drifted", "fp-original", drifted)
+	assert.Equal(t, http.StatusAccepted, status, "the registration stays held until it is approved")
+	assert.Equal(t, held.RegistrationID, again.RegistrationID)
+
+	rec := env.do(http.MethodGet, "/api/v2/registrations", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var pending []agent.PendingRegistration
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pending))
+	require.Len(t, pending, 1)
+	assert.Equal(t, original.ID, pending[0].CandidateAgentID)
+	assert.Equal(t, agent.DriftReplacement, pending[0].Reason)
+	assert.Equal(t, 77, pending[0].SimilarityScore)
+
+	rec = env.do(http.MethodPost, "/api/v2/registrations/"+held.RegistrationID+"/approve", admin, registrations.ApproveRequest{As: "replacement"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	status, replaced := register("fp-drifted", "fp-original", drifted)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, original.ID, replaced.ID, "the host keeps the agent's ID")
+
+	stored, err := env.container.AgentRepository.FindByID(context.Background(), original.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "fp-drifted", stored.Fingerprint)
+	assert.Equal(t, "key-fp-drifted", stored.PublicKey)
+}
@@ -0,0 +1,91 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"hostlink/app"
+	"hostlink/app/services/reqauth"
+	"hostlink/app/services/requestsigner"
+	"hostlink/config"
+	"hostlink/domain/agent"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSignatureVersion_Negotiation(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	container := app.NewContainer(db)
+	require.NoError(t, container.Migrate())
+	e := echo.New()
+	e.Validator = &e2eValidator{}
+	config.AddRoutesV2(e, container)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	privateKey, publicKey := generateE2EKeyPair(t)
+	testAgent := &agent.Agent{PublicKey: publicKey, PublicKeyType: "rsa", Fingerprint: "signature-version"}
+	require.NoError(t, container.AgentRepository.Create(context.Background(), testAgent))
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	savePrivateKey(t, keyPath, privateKey)
+
+	newSigner := func(version int) *requestsigner.RequestSigner {
+		signer, err := requestsigner.New(keyPath, testAgent.ID)
+		require.NoError(t, err)
+		return signer.WithVersion(version)
+	}
+	send := func(signer *requestsigner.RequestSigner, method, path, body string) int {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		require.NoError(t, signer.SignRequest(req))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	heartbeat := "/api/v1/agents/" + testAgent.ID + "/heartbeat"
+
+	assert.Equal(t, http.StatusOK, send(newSigner(reqauth.Version2), http.MethodPost, heartbeat, `{}`))
+	assert.Equal(t, http.StatusOK, send(newSigner(reqauth.Version2), http.MethodGet, "/api/v1/tasks?status=pending", ""))
+	assert.Equal(t, http.StatusOK, send(newSigner(reqauth.Version1), http.MethodPost, heartbeat, `{}`),
+		"agents signing version 1 keep working")
+
+	// Version 2 headers do not authenticate a request they were not made for
+	signed, err := http.NewRequest(http.MethodPost, server.URL+heartbeat, strings.NewReader(`{}`))
+	require.NoError(t, err)
+	require.NoError(t, newSigner(reqauth.Version2).SignRequest(signed))
+	moved, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/tasks", nil)
+	require.NoError(t, err)
+	moved.Header = signed.Header
+	resp, err := http.DefaultClient.Do(moved)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	container.MinSignatureVersion = reqauth.Version2
+	e = echo.New()
+	e.Validator = &e2eValidator{}
+	config.AddRoutesV2(e, container)
+	server.Config.Handler = e
+
+	assert.Equal(t, http.StatusUnauthorized, send(newSigner(reqauth.Version1), http.MethodPost, heartbeat, `{}`),
+		"version 1 is rejected once the server requires version 2")
+	assert.Equal(t, http.StatusOK, send(newSigner(reqauth.Version2), http.MethodPost, heartbeat, `{}`))
+}
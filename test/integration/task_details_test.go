@@ -84,11 +84,9 @@ func TestTaskDetails_GetTaskWithOutput(t *testing.T) {
 
 	dbTask, err := container.TaskRepository.FindByID(nil, createdTask.ID)
 	require.NoError(t, err)
-	dbTask.Status = "completed"
 	dbTask.Output = "hello\n"
 	dbTask.ExitCode = 0
-	err = container.TaskRepository.Update(nil, dbTask)
-	require.NoError(t, err)
+	advanceTask(t, container.TaskRepository, dbTask, "claimed", "completed")
 
 	getResp, err := http.Get(server.URL + "/api/v2/tasks/" + createdTask.ID)
 	require.NoError(t, err)
@@ -44,8 +44,7 @@ func TestTaskList(t *testing.T) {
 		container.TaskRepository.Create(context.Background(), task1)
 		container.TaskRepository.Create(context.Background(), task2)
 
-		task1.Status = "completed"
-		container.TaskRepository.Update(context.Background(), task1)
+		advanceTask(t, container.TaskRepository, task1, "claimed", "completed")
 
 		req := httptest.NewRequest(http.MethodGet, "/api/v2/tasks?status=pending", nil)
 		rec := httptest.NewRecorder()
@@ -69,8 +68,7 @@ func TestTaskList(t *testing.T) {
 		container.TaskRepository.Create(context.Background(), task1)
 		container.TaskRepository.Create(context.Background(), task2)
 
-		task1.Status = "completed"
-		container.TaskRepository.Update(context.Background(), task1)
+		advanceTask(t, container.TaskRepository, task1, "claimed", "completed")
 
 		req := httptest.NewRequest(http.MethodGet, "/api/v2/tasks?status=completed", nil)
 		rec := httptest.NewRecorder()
@@ -91,8 +89,7 @@ func TestTaskList(t *testing.T) {
 		task1 := &task.Task{Command: "task1", Priority: 1}
 		container.TaskRepository.Create(context.Background(), task1)
 
-		task1.Status = "running"
-		container.TaskRepository.Update(context.Background(), task1)
+		advanceTask(t, container.TaskRepository, task1, "claimed", "running")
 
 		req := httptest.NewRequest(http.MethodGet, "/api/v2/tasks?status=running", nil)
 		rec := httptest.NewRecorder()
@@ -113,8 +110,7 @@ func TestTaskList(t *testing.T) {
 		task1 := &task.Task{Command: "task1", Priority: 1}
 		container.TaskRepository.Create(context.Background(), task1)
 
-		task1.Status = "failed"
-		container.TaskRepository.Update(context.Background(), task1)
+		advanceTask(t, container.TaskRepository, task1, "claimed", "failed")
 
 		req := httptest.NewRequest(http.MethodGet, "/api/v2/tasks?status=failed", nil)
 		rec := httptest.NewRecorder()
@@ -161,8 +157,7 @@ func TestTaskList(t *testing.T) {
 		container.TaskRepository.Create(context.Background(), task2)
 		container.TaskRepository.Create(context.Background(), task3)
 
-		task2.Status = "completed"
-		container.TaskRepository.Update(context.Background(), task2)
+		advanceTask(t, container.TaskRepository, task2, "claimed", "completed")
 
 		req := httptest.NewRequest(http.MethodGet, "/api/v2/tasks?status=pending&priority=2", nil)
 		rec := httptest.NewRecorder()
@@ -218,3 +213,13 @@ func TestTaskList(t *testing.T) {
 		assert.Equal(t, "third", tasks[0].Command)
 	})
 }
+
+// advanceTask walks a task through the lifecycle the way an agent's
+// reports would.
+func advanceTask(t *testing.T, repo task.Repository, tk *task.Task, statuses ...string) {
+	t.Helper()
+	for _, status := range statuses {
+		tk.Status = status
+		require.NoError(t, repo.Update(context.Background(), tk))
+	}
+}
@@ -0,0 +1,80 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"hostlink/app/jobs/taskjob"
+	"hostlink/app/services/tasksecrets"
+	"hostlink/domain/secret"
+	"hostlink/domain/task"
+	"hostlink/internal/crypto"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskSecrets_InjectedIntoEnvironmentAndRedacted(t *testing.T) {
+	env := setupTaskJobTestEnv(t)
+	defer env.cleanup()
+	ctx := context.Background()
+	agentID := env.agentState.GetAgentID()
+	keyPath := env.tempDir + "/private_key.pem"
+
+	privateKey, err := crypto.LoadKey(keyPath)
+	require.NoError(t, err)
+	s := &secret.Secret{ID: secret.NewID(), AgentID: agentID, Name: "db_password"}
+	s.ValueEnc, err = crypto.SealEnvelope([]byte("hunter2"), privateKey.Public(), secret.EnvelopeContext(agentID, s.ID, s.Name)...)
+	require.NoError(t, err)
+	require.NoError(t, env.container.SecretRepository.Save(ctx, s))
+
+	testTask := &task.Task{
+		Command:  `test "$DB_PASSWORD" = "{{secret:db_password}}" && echo "password is $DB_PASSWORD"`,
+		Status:   "pending",
+		Priority: 1,
+	}
+	require.NoError(t, env.container.TaskRepository.Create(ctx, testTask))
+
+	var results []map[string]any
+	var mu sync.Mutex
+	env.echo.PUT("/api/v1/tasks/:id", func(c echo.Context) error {
+		var req map[string]any
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		mu.Lock()
+		results = append(results, req)
+		mu.Unlock()
+		return c.NoContent(http.StatusOK)
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	job := taskjob.NewJobWithConf(taskjob.TaskJobConfig{
+		Trigger: func(ctx context.Context, fn func() error) {
+			fn()
+			wg.Done()
+		},
+		Secrets: tasksecrets.NewWithDependencies(env.agentState, keyPath),
+	})
+	defer job.Shutdown()
+	job.Register(ctx, env.fetcher, env.reporter)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, results)
+	final := results[len(results)-1]
+	assert.Equal(t, "completed", final["status"])
+	assert.Equal(t, float64(0), final["exit_code"])
+	assert.Equal(t, "password is [REDACTED]\n", final["output"])
+
+	stored, err := env.container.TaskRepository.FindByID(ctx, testTask.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, stored.Command, "hunter2")
+}
@@ -0,0 +1,76 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hostlink/app/controller/tasks"
+	"hostlink/domain/agent"
+	"hostlink/domain/task"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskStream_RelaysAgentOutput(t *testing.T) {
+	env := setupTaskUpdateTestEnv(t)
+	defer env.cleanup()
+
+	testTask := &task.Task{Command: "echo hello", Priority: 1}
+	require.NoError(t, env.container.TaskRepository.Create(context.Background(), testTask))
+
+	privateKey, publicKeyBase64 := generateTestKeyPair(t)
+	testAgent := &agent.Agent{
+		PublicKey:     publicKeyBase64,
+		PublicKeyType: "rsa",
+		Fingerprint:   "test-fp-stream",
+	}
+	require.NoError(t, env.container.AgentRepository.Create(context.Background(), testAgent))
+	claimTask(t, env, testAgent.ID)
+
+	send := func(method, path string, payload any) int {
+		body, _ := json.Marshal(payload)
+		req := createSignedRequestWithBody(t, method, path, testAgent.ID, privateKey, time.Now(), bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		env.echo.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	outputPath := fmt.Sprintf("/api/v1/tasks/%s/output", testTask.ID)
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPost, outputPath, tasks.OutputRequest{Stream: "stdout", Sequence: 1, Data: "hel"}))
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPost, outputPath, tasks.OutputRequest{Stream: "stdout", Sequence: 1, Data: "hel"}))
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPost, outputPath, tasks.OutputRequest{Stream: "stdout", Sequence: 2, Data: "lo\n"}))
+	assert.Equal(t, http.StatusOK, send(http.MethodPut, fmt.Sprintf("/api/v1/tasks/%s", testTask.ID), tasks.TaskUpdateRequest{Status: "completed", Output: "hello\n"}))
+	assert.Equal(t, http.StatusConflict, send(http.MethodPost, outputPath, tasks.OutputRequest{Stream: "stdout", Sequence: 3, Data: "late"}))
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v2/tasks/%s/stream?since=1", testTask.ID), nil)
+	rec := httptest.NewRecorder()
+	env.echo.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.NotContains(t, body, "id: 1\n")
+	assert.Contains(t, body, "id: 2\nevent: output\n")
+	assert.Contains(t, body, `"data":"lo\n"`)
+	assert.True(t, strings.HasSuffix(body, "event: done\ndata: {\"status\":\"completed\",\"exit_code\":0}\n\n"), body)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v2/tasks/%s/output", testTask.ID), nil)
+	rec = httptest.NewRecorder()
+	env.echo.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var chunks []task.OutputChunk
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &chunks))
+	require.Len(t, chunks, 2)
+	assert.Equal(t, "hel", chunks[0].Data)
+	assert.Equal(t, "lo\n", chunks[1].Data)
+}
@@ -49,6 +49,7 @@ func TestTaskUpdate_Authentication(t *testing.T) {
 		}
 		err = env.container.AgentRepository.Create(context.Background(), testAgent)
 		require.NoError(t, err)
+		claimTask(t, env, testAgent.ID)
 
 		updateReq := tasks.TaskUpdateRequest{
 			Status:   "completed",
@@ -115,6 +116,7 @@ func TestTaskUpdate_Success(t *testing.T) {
 		}
 		err = env.container.AgentRepository.Create(context.Background(), testAgent)
 		require.NoError(t, err)
+		claimTask(t, env, testAgent.ID)
 
 		updateReq := tasks.TaskUpdateRequest{
 			Status:   "completed",
@@ -156,6 +158,7 @@ func TestTaskUpdate_Success(t *testing.T) {
 		}
 		err = env.container.AgentRepository.Create(context.Background(), testAgent)
 		require.NoError(t, err)
+		claimTask(t, env, testAgent.ID)
 
 		updateReq := tasks.TaskUpdateRequest{
 			Status:   "completed",
@@ -197,6 +200,7 @@ func TestTaskUpdate_Success(t *testing.T) {
 		}
 		err = env.container.AgentRepository.Create(context.Background(), testAgent)
 		require.NoError(t, err)
+		claimTask(t, env, testAgent.ID)
 
 		updateReq := tasks.TaskUpdateRequest{
 			Status:   "failed",
@@ -238,6 +242,7 @@ func TestTaskUpdate_Success(t *testing.T) {
 		}
 		err = env.container.AgentRepository.Create(context.Background(), testAgent)
 		require.NoError(t, err)
+		claimTask(t, env, testAgent.ID)
 
 		updateReq := tasks.TaskUpdateRequest{
 			Status:   "failed",
@@ -323,6 +328,35 @@ func TestTaskUpdate_ErrorCases(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
 	})
+
+	t.Run("another agent's report returns 409 and the operator can cancel", func(t *testing.T) {
+		env := setupTaskUpdateTestEnv(t)
+		defer env.cleanup()
+
+		testTask := &task.Task{Command: "sleep 60", Status: "pending", Priority: 1}
+		require.NoError(t, env.container.TaskRepository.Create(context.Background(), testTask))
+		owner := &agent.Agent{Fingerprint: "test-fp-owner"}
+		require.NoError(t, env.container.AgentRepository.Create(context.Background(), owner))
+		otherKey, otherPublicKey := generateTestKeyPair(t)
+		other := &agent.Agent{PublicKey: otherPublicKey, PublicKeyType: "rsa", Fingerprint: "test-fp-other"}
+		require.NoError(t, env.container.AgentRepository.Create(context.Background(), other))
+		claimTask(t, env, owner.ID)
+
+		body, _ := json.Marshal(tasks.TaskUpdateRequest{Status: "completed"})
+		req := createSignedRequestWithBody(t, http.MethodPut, fmt.Sprintf("/api/v1/tasks/%s", testTask.ID), other.ID, otherKey, time.Now(), bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		env.echo.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v2/tasks/%s/cancel", testTask.ID), nil)
+		rec = httptest.NewRecorder()
+		env.echo.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		stored, err := env.container.TaskRepository.FindByID(context.Background(), testTask.ID)
+		require.NoError(t, err)
+		assert.Equal(t, task.StatusCancelled, stored.Status)
+	})
 }
 
 type taskUpdateTestEnv struct {
@@ -369,3 +403,12 @@ func createSignedRequestWithBody(t *testing.T, method, path, agentID string, pri
 	}
 	return req
 }
+
+// claimTask leases the pending tasks to agentID, as its poll would, so the
+// agent is allowed to report on them.
+func claimTask(t *testing.T, env *taskUpdateTestEnv, agentID string) {
+	t.Helper()
+	claimed, err := env.container.TaskRepository.Claim(context.Background(), agentID, time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, claimed)
+}
@@ -73,7 +73,7 @@ func TestTaskJobReporter_SendsUpdateViaAPI(t *testing.T) {
 
 	updatedTask, err := env.container.TaskRepository.FindByID(context.Background(), testTask.ID)
 	require.NoError(t, err)
-	assert.Equal(t, "pending", updatedTask.Status, "Task should not be updated in DB directly by taskjob")
+	assert.Equal(t, "claimed", updatedTask.Status, "Task should only be claimed, not updated in DB directly by taskjob")
 }
 
 func TestTaskJobReporter_CapturesTaskOutput(t *testing.T) {